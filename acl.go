@@ -0,0 +1,198 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ServiceWeaver/weaver/internal/logtype"
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/metrics"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+)
+
+type unauthorizedLabels struct {
+	Caller    string // full caller component name, or "unknown"
+	Component string // full callee component name
+	Method    string // callee component method
+}
+
+var unauthorizedCalls = metrics.NewCounterMap[unauthorizedLabels](
+	"serviceweaver_method_unauthorized_count",
+	"Count of Service Weaver component method invocations rejected because the caller is not allowed to call the component",
+)
+
+// acl authorizes the calls to a component, allowing only the calls of the
+// components listed in its allowed_callers setting.
+type acl struct {
+	component string            // full callee component name
+	methods   []string          // callee component methods, by index
+	allowed   map[uint64]bool   // allowed callers, by key
+	names     map[uint64]string // full names of all components, by key
+	logger    logtype.Logger    // logs denied calls
+
+	mu     sync.Mutex
+	logged map[uint64]bool // callers whose denied calls were logged
+}
+
+// newACL returns the acl of the provided component, or nil if every component
+// may call it.
+func newACL(c *component, logger logtype.Logger) *acl {
+	if len(c.settings.AllowedCallers) == 0 {
+		return nil
+	}
+	a := &acl{
+		component: c.info.Name,
+		allowed:   map[uint64]bool{},
+		names:     callerNames(),
+		logger:    logger,
+		logged:    map[uint64]bool{},
+	}
+	for i, n := 0, c.info.Iface.NumMethod(); i < n; i++ {
+		a.methods = append(a.methods, c.info.Iface.Method(i).Name)
+	}
+	for _, caller := range c.settings.AllowedCallers {
+		a.allowed[callerKey(caller)] = true
+	}
+	return a
+}
+
+// allows returns whether the caller with the provided key may call the
+// component.
+func (a *acl) allows(caller uint64) bool {
+	return a.allowed[caller]
+}
+
+// check returns nil if the caller with the provided key may call the provided
+// method, and otherwise an error that wraps ErrPermissionDenied. Denied calls
+// are counted, and logged once per caller.
+func (a *acl) check(method int, caller uint64) error {
+	if a.allows(caller) {
+		return nil
+	}
+	err := fmt.Errorf("%w: %s may not call %s.%s", ErrPermissionDenied,
+		logging.ShortenComponent(a.name(caller)), logging.ShortenComponent(a.component), a.methods[method])
+	return a.deny(method, caller, err)
+}
+
+// checkRemote is like check, but for a call received over the network, whose
+// caller is only believed if auth, when not nil, authenticates it.
+func (a *acl) checkRemote(ctx context.Context, method int, auth *authenticator) error {
+	caller := call.Caller(ctx)
+	if auth != nil {
+		if err := auth.verify(call.PeerOf(ctx), a.name(caller)); err != nil {
+			return a.deny(method, caller, fmt.Errorf("%w: %s.%s: %v", ErrPermissionDenied,
+				logging.ShortenComponent(a.component), a.methods[method], err))
+		}
+	}
+	return a.check(method, caller)
+}
+
+// name returns the full name of the caller with the provided key.
+func (a *acl) name(caller uint64) string {
+	name, ok := a.names[caller]
+	if !ok {
+		// Calls that don't identify their caller (e.g., the calls of
+		// weavelets running an older version of Service Weaver) are denied
+		// too.
+		name = "unknown"
+	}
+	return name
+}
+
+// deny counts the denied call of the provided method by the caller with the
+// provided key, logs it if it is the first denied call of the caller, and
+// returns err.
+func (a *acl) deny(method int, caller uint64, err error) error {
+	name := a.name(caller)
+	unauthorizedCalls.Get(unauthorizedLabels{
+		Caller:    name,
+		Component: a.component,
+		Method:    a.methods[method],
+	}).Add(1)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.logged[caller] {
+		a.logged[caller] = true
+		a.logger.Error("unauthorized call", err, "caller", name, "component", a.component, "method", a.methods[method])
+	}
+	return err
+}
+
+// authenticator authenticates the callers that remote calls claim to come
+// from. A claimed caller is only believed if it is hosted by the peer that
+// sent the call, as identified by its verified TLS certificate. The calls
+// received over Unix sockets come from the weavelets of the local colocation
+// group, which may claim to be any of the group's components.
+type authenticator struct {
+	trustDomain string                     // if not empty, peers are identified by SPIFFE ID
+	identities  map[string]map[string]bool // components hosted by every peer identity
+	local       map[string]bool            // components of the local colocation group
+}
+
+// newAuthenticator returns an authenticator for the provided TLS config and
+// the components of the local colocation group.
+func newAuthenticator(config runtime.TLSConfig, local []string) *authenticator {
+	a := &authenticator{
+		trustDomain: config.TrustDomain,
+		identities:  map[string]map[string]bool{},
+		local:       map[string]bool{},
+	}
+	for identity, components := range config.Identities {
+		a.identities[identity] = map[string]bool{}
+		for _, component := range components {
+			a.identities[identity][component] = true
+		}
+	}
+	for _, component := range local {
+		a.local[component] = true
+	}
+	return a
+}
+
+// verify returns nil if the provided peer hosts the provided caller.
+func (a *authenticator) verify(peer *call.Peer, caller string) error {
+	switch {
+	case peer == nil:
+		return errors.New("caller not authenticated")
+	case peer.Local:
+		if !a.local[caller] {
+			return fmt.Errorf("local peer does not host %s", caller)
+		}
+		return nil
+	default:
+		id := a.identity(peer.Certificate)
+		if !a.identities[id][caller] {
+			return fmt.Errorf("peer %q does not host %s", id, caller)
+		}
+		return nil
+	}
+}
+
+// identity returns the identity of the peer with the provided verified
+// certificate: its SPIFFE ID if peers are identified by SPIFFE ID, and its
+// common name otherwise.
+func (a *authenticator) identity(cert *x509.Certificate) string {
+	if a.trustDomain != "" && len(cert.URIs) == 1 {
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.CommonName
+}
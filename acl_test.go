@@ -0,0 +1,119 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+)
+
+// errorCountingLogger is a logger that counts the logged errors.
+type errorCountingLogger struct {
+	discardingLogger
+	errors int
+}
+
+func (l *errorCountingLogger) Error(string, error, ...any) {
+	l.errors++
+}
+
+func TestACL(t *testing.T) {
+	logger := &errorCountingLogger{}
+	c := &component{
+		info: &codegen.Registration{
+			Name:  "github.com/ServiceWeaver/weaver/samplingCache",
+			Iface: reflect.TypeOf((*samplingCache)(nil)).Elem(),
+		},
+		settings: &runtime.ComponentSettings{AllowedCallers: []string{"main"}},
+	}
+	a := newACL(c, logger)
+	if a == nil {
+		t.Fatal("newACL: got nil, want an acl")
+	}
+
+	if err := a.check(0, callerKey("main")); err != nil {
+		t.Fatalf("check(main): %v", err)
+	}
+	for _, caller := range []uint64{0, callerKey("github.com/ServiceWeaver/weaver/samplingCache")} {
+		for i := 0; i < 3; i++ {
+			if err := a.check(1, caller); !errors.Is(err, ErrPermissionDenied) {
+				t.Fatalf("check(%d): got %v, want ErrPermissionDenied", caller, err)
+			}
+		}
+	}
+	// Denied calls are logged once per caller.
+	if got, want := logger.errors, 2; got != want {
+		t.Fatalf("logged errors: got %d, want %d", got, want)
+	}
+}
+
+func TestNoACL(t *testing.T) {
+	c := &component{settings: &runtime.ComponentSettings{}}
+	if a := newACL(c, discardingLogger{}); a != nil {
+		t.Fatalf("newACL: got %v, want nil", a)
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	const checkout = "example.com/shop/CheckoutService"
+	const cart = "example.com/shop/CartService"
+	spiffeID := &url.URL{Scheme: "spiffe", Host: "example.org", Path: "/ns/shop/sa/checkout"}
+	svid := &call.Peer{Certificate: &x509.Certificate{URIs: []*url.URL{spiffeID}}}
+	named := &call.Peer{Certificate: &x509.Certificate{Subject: pkix.Name{CommonName: "checkout"}}}
+	local := &call.Peer{Local: true}
+
+	for _, test := range []struct {
+		name        string
+		trustDomain string
+		peer        *call.Peer
+		caller      string
+		ok          bool
+	}{
+		{"SPIFFE ID hosts caller", "example.org", svid, checkout, true},
+		{"SPIFFE ID doesn't host caller", "example.org", svid, cart, false},
+		{"common name hosts caller", "", named, checkout, true},
+		{"common name doesn't host caller", "", named, cart, false},
+		{"unknown identity", "", svid, checkout, false},
+		{"local peer hosts caller", "example.org", local, cart, true},
+		{"local peer doesn't host caller", "example.org", local, checkout, false},
+		{"unauthenticated peer", "", nil, checkout, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := runtime.TLSConfig{
+				TrustDomain: test.trustDomain,
+				Identities: map[string][]string{
+					"spiffe://example.org/ns/shop/sa/checkout": {checkout},
+					"checkout": {checkout},
+				},
+			}
+			a := newAuthenticator(config, []string{cart})
+			err := a.verify(test.peer, test.caller)
+			if test.ok && err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if !test.ok && err == nil {
+				t.Fatal("verify: unexpected success")
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+)
+
+// actor is an instance of a component with actors, which executes the calls
+// with a given routing key. See runtime.ActorPolicy.
+type actor struct {
+	ready  chan struct{}  // closed once the actor is activated
+	obj    any            // implementation object, once activated
+	server codegen.Server // server stub of obj, once activated
+	err    error          // activation error, if any
+
+	mu    sync.Mutex // serializes the calls to the actor
+	calls int        // number of calls executed, guarded by mu
+	saved int        // value of calls at the last snapshot, guarded by mu
+
+	// Guarded by actorPool.mu.
+	pending  int       // number of calls in progress or waiting
+	lastUsed time.Time // when the last call finished
+}
+
+// actorPool holds the active actors of a component. It is used as the
+// implementation object, and server stub, of the component.
+type actorPool struct {
+	ctx  context.Context // weavelet context
+	c    *component
+	idle time.Duration                  // idle timeout of actors
+	load func(key uint64, load float64) // passed to the server stubs of actors
+	now  func() time.Time
+
+	mu     sync.Mutex
+	actors map[uint64]*actor // by routing key
+}
+
+var _ codegen.Server = &actorPool{}
+
+// newActorPool returns the actor pool of the provided component, which
+// passivates idle actors until ctx is done.
+func newActorPool(ctx context.Context, c *component, load func(uint64, float64)) *actorPool {
+	idle := c.settings.Actors.IdleTimeout
+	if idle == 0 {
+		idle = runtime.DefaultActorIdleTimeout
+	}
+	p := &actorPool{
+		ctx:    ctx,
+		c:      c,
+		idle:   idle,
+		load:   load,
+		now:    time.Now,
+		actors: map[uint64]*actor{},
+	}
+	go p.passivateIdle()
+	if c.settings.SnapshotInterval > 0 {
+		go p.snapshotPeriodically(c.settings.SnapshotInterval)
+	}
+	return p
+}
+
+// GetStubFn implements the codegen.Server interface. The returned function
+// executes the method on the actor of the routing key of the call, activating
+// it if needed.
+func (p *actorPool) GetStubFn(method string) func(ctx context.Context, args []byte) ([]byte, error) {
+	return func(ctx context.Context, args []byte) ([]byte, error) {
+		a := p.acquire(call.ShardKey(ctx))
+		defer p.release(a)
+		select {
+		case <-a.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if a.err != nil {
+			return nil, a.err
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.calls++
+		return a.server.GetStubFn(method)(ctx, args)
+	}
+}
+
+// acquire returns the actor of the provided key, activating it if needed, and
+// registers a pending call to it. The caller must call release when the call
+// finishes.
+func (p *actorPool) acquire(key uint64) *actor {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	a, ok := p.actors[key]
+	if !ok {
+		a = &actor{ready: make(chan struct{})}
+		p.actors[key] = a
+		go p.activate(key, a)
+	}
+	a.pending++
+	return a
+}
+
+// activate activates the provided actor.
+func (p *actorPool) activate(key uint64, a *actor) {
+	defer close(a.ready)
+	p.c.wlet.env.SystemLogger().Debug("Activating actor", "component", p.c.info.Name, "key", key)
+	a.obj, a.err = newImplementation(p.ctx, p.c, p.c.wlet.snapshotFile(p.c, key))
+	if a.err != nil {
+		// Forget the actor, so that the next call activates it again.
+		p.mu.Lock()
+		if p.actors[key] == a {
+			delete(p.actors, key)
+		}
+		p.mu.Unlock()
+		return
+	}
+	a.server = p.c.info.ServerStubFn(a.obj, p.load)
+}
+
+// release unregisters a pending call to the provided actor.
+func (p *actorPool) release(a *actor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	a.pending--
+	a.lastUsed = p.now()
+}
+
+// passivateIdle periodically passivates the actors that have been idle for
+// longer than the idle timeout, until p.ctx is done.
+func (p *actorPool) passivateIdle() {
+	interval := p.idle / 2
+	if interval <= 0 {
+		interval = p.idle
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+			p.passivate(ctx, false)
+			cancel()
+		}
+	}
+}
+
+// snapshotPeriodically stores a snapshot of the stateful actors every
+// interval, until p.ctx is done.
+func (p *actorPool) snapshotPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			active := map[uint64]*actor{}
+			for key, a := range p.actors {
+				select {
+				case <-a.ready:
+					active[key] = a
+				default:
+				}
+			}
+			p.mu.Unlock()
+			for key, a := range active {
+				p.save(p.ctx, key, a)
+			}
+		}
+	}
+}
+
+// save stores a snapshot of the provided actor, if it is stateful and has
+// executed calls since its last snapshot. Actors that executed no calls are
+// not saved, so that an actor left behind when its routing key moves to
+// another replica does not overwrite the snapshots of its successor.
+func (p *actorPool) save(ctx context.Context, key uint64, a *actor) {
+	s, ok := a.obj.(stateful)
+	if !ok {
+		return
+	}
+	file := p.c.wlet.snapshotFile(p.c, key)
+	if file == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.calls == a.saved {
+		return
+	}
+	if err := saveSnapshot(ctx, s, file); err != nil {
+		p.c.logger.Error("Actor snapshot failed", err, "file", file)
+		return
+	}
+	a.saved = a.calls
+}
+
+// passivate saves, shuts down, and discards the activated actors that have no
+// pending calls and that have been idle for longer than the idle timeout, or
+// all of them if all is true.
+func (p *actorPool) passivate(ctx context.Context, all bool) {
+	p.mu.Lock()
+	now := p.now()
+	idle := map[uint64]*actor{}
+	for key, a := range p.actors {
+		select {
+		case <-a.ready:
+		default:
+			// The actor is being activated.
+			continue
+		}
+		if a.pending > 0 || (!all && now.Sub(a.lastUsed) < p.idle) {
+			continue
+		}
+		delete(p.actors, key)
+		idle[key] = a
+	}
+	p.mu.Unlock()
+
+	for key, a := range idle {
+		p.save(ctx, key, a)
+		if s, ok := a.obj.(interface{ Shutdown(context.Context) error }); ok {
+			if err := s.Shutdown(ctx); err != nil {
+				p.c.logger.Error("Actor shutdown failed", err)
+			}
+		}
+	}
+}
+
+// Shutdown passivates all the actors with no pending calls. It is called
+// when the weavelet shuts down, in place of the Shutdown method of the
+// component.
+func (p *actorPool) Shutdown(ctx context.Context) error {
+	p.passivate(ctx, true)
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+)
+
+type actorCounter interface {
+	Add(context.Context) (int, error)
+}
+
+// counter is an actor that counts the calls it receives.
+type counter struct {
+	Implements[actorCounter]
+	n         int
+	executing atomic.Bool
+	shutdown  *atomic.Int32 // incremented on shutdown
+}
+
+func (c *counter) Shutdown(context.Context) error {
+	c.shutdown.Add(1)
+	return nil
+}
+
+// counterServer is the server stub of a counter.
+type counterServer struct {
+	c *counter
+}
+
+func (s counterServer) GetStubFn(string) func(context.Context, []byte) ([]byte, error) {
+	return func(context.Context, []byte) ([]byte, error) {
+		if !s.c.executing.CompareAndSwap(false, true) {
+			return nil, fmt.Errorf("concurrent calls")
+		}
+		defer s.c.executing.Store(false)
+		s.c.n++
+		time.Sleep(time.Millisecond)
+		return []byte(fmt.Sprint(s.c.n)), nil
+	}
+}
+
+// newTestActorPool returns an actor pool of counters, along with the number
+// of counters shut down, and a function that advances the pool's clock.
+func newTestActorPool(t *testing.T) (*actorPool, *atomic.Int32, func(time.Duration)) {
+	t.Helper()
+	var shutdown atomic.Int32
+	c := &component{
+		wlet: &weavelet{env: &electionEnv{}, config: &runtime.WeaveletConfig{}},
+		info: &codegen.Registration{
+			Name:  "github.com/ServiceWeaver/weaver/actorCounter",
+			Iface: reflect.TypeOf((*actorCounter)(nil)).Elem(),
+			New:   func() any { return &counter{shutdown: &shutdown} },
+			ServerStubFn: func(impl any, _ func(uint64, float64)) codegen.Server {
+				return counterServer{impl.(*counter)}
+			},
+			Routed: true,
+		},
+		settings: &runtime.ComponentSettings{Actors: runtime.ActorPolicy{Enabled: true}},
+		impl:     &componentImpl{},
+		logger:   discardingLogger{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	p := newActorPool(ctx, c, func(uint64, float64) {})
+	now := time.Now()
+	var mu sync.Mutex
+	p.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+	return p, &shutdown, advance
+}
+
+// add calls the Add method of the actor of the provided key.
+func add(t *testing.T, p *actorPool, key uint64) string {
+	t.Helper()
+	ctx := call.WithMetadata(context.Background(), call.CallOptions{ShardKey: key})
+	reply, err := p.GetStubFn("Add")(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(reply)
+}
+
+func TestActorsPerKey(t *testing.T) {
+	p, _, _ := newTestActorPool(t)
+	for _, test := range []struct {
+		key  uint64
+		want string
+	}{{1, "1"}, {1, "2"}, {2, "1"}, {1, "3"}, {2, "2"}} {
+		if got := add(t, p, test.key); got != test.want {
+			t.Fatalf("Add(%d): got %s, want %s", test.key, got, test.want)
+		}
+	}
+}
+
+func TestActorsSerializeCalls(t *testing.T) {
+	p, _, _ := newTestActorPool(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := call.WithMetadata(context.Background(), call.CallOptions{ShardKey: 1})
+			if _, err := p.GetStubFn("Add")(ctx, nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, want := add(t, p, 1), "21"; got != want {
+		t.Fatalf("Add: got %s, want %s", got, want)
+	}
+}
+
+func TestActorsPassivation(t *testing.T) {
+	p, shutdown, advance := newTestActorPool(t)
+	add(t, p, 1)
+	add(t, p, 2)
+
+	// Actor 2 is used again before actor 1 times out.
+	advance(runtime.DefaultActorIdleTimeout / 2)
+	add(t, p, 2)
+	advance(runtime.DefaultActorIdleTimeout / 2)
+	p.passivate(context.Background(), false)
+	if got, want := shutdown.Load(), int32(1); got != want {
+		t.Fatalf("actors shut down: got %d, want %d", got, want)
+	}
+
+	// Actor 1 is activated again, from scratch.
+	if got, want := add(t, p, 1), "1"; got != want {
+		t.Fatalf("Add(1): got %s, want %s", got, want)
+	}
+	if got, want := add(t, p, 2), "3"; got != want {
+		t.Fatalf("Add(2): got %s, want %s", got, want)
+	}
+
+	// All actors are passivated on shutdown.
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := shutdown.Load(), int32(3); got != want {
+		t.Fatalf("actors shut down: got %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/logtype"
+	"github.com/ServiceWeaver/weaver/runtime/audit"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// auditLog is the audit log of a weavelet, opened when first used.
+type auditLog struct {
+	dir    string               // directory of audit logs
+	info   *protos.WeaveletInfo // weavelet that executes the calls
+	logger logtype.Logger
+
+	once   sync.Once
+	writer *audit.Writer // nil if the log cannot be opened
+}
+
+// get returns the writer of the audit log, or nil if the log cannot be
+// opened.
+func (l *auditLog) get() *audit.Writer {
+	l.once.Do(func() {
+		file := filepath.Join(l.dir, fmt.Sprintf("%s-%s.audit", l.info.DeploymentId, l.info.Id))
+		w, err := audit.NewWriter(file)
+		if err != nil {
+			l.logger.Error("Opening audit log; audited calls will not be recorded", err)
+			return
+		}
+		l.writer = w
+	})
+	return l.writer
+}
+
+// close closes the audit log, if it was opened. Calls recorded after close
+// are dropped.
+func (l *auditLog) close() {
+	l.once.Do(func() {})
+	if l.writer != nil {
+		l.writer.Close()
+	}
+}
+
+// auditor records the calls to the audited methods of a component.
+type auditor struct {
+	component string
+	methods   []string          // component methods, by index
+	audited   []bool            // whether a method is audited, by index
+	names     map[uint64]string // full names of all components, by key
+	log       *auditLog
+	logger    logtype.Logger
+	now       func() time.Time
+}
+
+// newAuditor returns the auditor of the provided component, or nil if none of
+// its methods is audited.
+func newAuditor(c *component, log *auditLog, logger logtype.Logger) *auditor {
+	if len(c.settings.AuditedMethods) == 0 {
+		return nil
+	}
+	a := &auditor{
+		component: c.info.Name,
+		names:     callerNames(),
+		log:       log,
+		logger:    logger,
+		now:       time.Now,
+	}
+	audited := map[string]bool{}
+	for _, method := range c.settings.AuditedMethods {
+		audited[method] = true
+	}
+	for i, n := 0, c.info.Iface.NumMethod(); i < n; i++ {
+		name := c.info.Iface.Method(i).Name
+		a.methods = append(a.methods, name)
+		a.audited = append(a.audited, audited[name])
+	}
+	return a
+}
+
+// record records a call to the provided method, made by the caller with the
+// provided key, if the method is audited.
+func (a *auditor) record(method int, caller, shardKey uint64, err error) {
+	if !a.audited[method] {
+		return
+	}
+	w := a.log.get()
+	if w == nil {
+		return
+	}
+	name, ok := a.names[caller]
+	if !ok {
+		name = "unknown"
+	}
+	e := audit.Entry{
+		Time:       a.now(),
+		Deployment: a.log.info.DeploymentId,
+		Weavelet:   a.log.info.Id,
+		Component:  a.component,
+		Method:     a.methods[method],
+		Caller:     name,
+		RoutingKey: shardKey,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if err := w.Write(e); err != nil {
+		a.logger.Error("Recording audited call", err, "component", a.component, "method", a.methods[method])
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/audit"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAuditor(t *testing.T) {
+	dir := t.TempDir()
+	log := &auditLog{
+		dir:    dir,
+		info:   &protos.WeaveletInfo{DeploymentId: "dep", Id: "wlet"},
+		logger: logging.NewTestLogger(t),
+	}
+	c := &component{
+		info: &codegen.Registration{
+			Name:  "github.com/ServiceWeaver/weaver/samplingCache",
+			Iface: reflect.TypeOf((*samplingCache)(nil)).Elem(),
+		},
+		settings: &runtime.ComponentSettings{AuditedMethods: []string{"Put"}},
+	}
+	a := newAuditor(c, log, logging.NewTestLogger(t))
+	a.record(0, callerKey("main"), 0, nil)     // Get isn't audited
+	a.record(1, callerKey("main"), 42, nil)    // Put is
+	a.record(1, 0, 0, errors.New("disk full")) // by an unknown caller
+	log.close()
+
+	f, err := os.Open(filepath.Join(dir, "dep-wlet.audit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []audit.Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e audit.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+	entry := audit.Entry{
+		Deployment: "dep",
+		Weavelet:   "wlet",
+		Component:  "github.com/ServiceWeaver/weaver/samplingCache",
+		Method:     "Put",
+	}
+	want := []audit.Entry{entry, entry}
+	want[0].Caller, want[0].RoutingKey = "main", 42
+	want[1].Seq, want[1].Caller, want[1].Error = 1, "unknown", "disk full"
+	opts := cmpopts.IgnoreFields(audit.Entry{}, "Prev", "Time")
+	if diff := cmp.Diff(want, got, opts); diff != "" {
+		t.Fatalf("audit log (-want +got):\n%s", diff)
+	}
+}
+
+func TestNoAuditor(t *testing.T) {
+	c := &component{settings: &runtime.ComponentSettings{}}
+	if a := newAuditor(c, nil, nil); a != nil {
+		t.Fatalf("newAuditor: got %v, want nil", a)
+	}
+}
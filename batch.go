@@ -0,0 +1,299 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// batchMethodKey is the key of the method, served by every weavelet, that
+// executes a batch of calls.
+var batchMethodKey = call.MakeMethodKey("", "batch")
+
+// defaultMaxBatchSize is the default runtime.BatchingPolicy.MaxSize.
+const defaultMaxBatchSize = 100
+
+// batcher coalesces concurrent calls to a component into batched RPCs. See
+// runtime.BatchingPolicy for details.
+//
+// A batch is encoded as the number of calls, followed by the method key, the
+// timeout in microseconds (zero if none), and the arguments of every call.
+// Its reply holds, for every call, whether the call succeeded, followed by
+// its results or its error.
+type batcher struct {
+	client   call.Connection
+	maxDelay time.Duration
+	maxSize  int
+	methods  map[call.MethodKey]bool // batched methods, or nil for all
+
+	mu      sync.Mutex
+	pending map[batchKey]*batch // pending batches
+}
+
+// batchKey identifies the calls that may be batched together: the calls with
+// the same shard key, made by the same caller.
+type batchKey struct {
+	shardKey uint64
+	caller   uint64
+}
+
+// batch is a batch of calls with the same batchKey.
+type batch struct {
+	opts  call.CallOptions
+	calls []*batchedCall
+	timer *time.Timer // sends the batch after maxDelay
+}
+
+// batchedCall is a call that is part of a batch.
+type batchedCall struct {
+	ctx   context.Context
+	key   call.MethodKey
+	args  []byte
+	done  chan struct{} // closed once reply and err are set
+	reply []byte
+	err   error
+}
+
+// newBatcher returns a batcher of the calls to the named component made
+// through client, or nil if the calls are not batched.
+func newBatcher(name string, client call.Connection, policy runtime.BatchingPolicy) *batcher {
+	if !policy.Enabled() {
+		return nil
+	}
+	b := &batcher{
+		client:   client,
+		maxDelay: policy.MaxDelay,
+		maxSize:  policy.MaxSize,
+		pending:  map[batchKey]*batch{},
+	}
+	if b.maxSize == 0 {
+		b.maxSize = defaultMaxBatchSize
+	}
+	if len(policy.Methods) > 0 {
+		b.methods = map[call.MethodKey]bool{}
+		for _, method := range policy.Methods {
+			b.methods[call.MakeMethodKey(name, method)] = true
+		}
+	}
+	return b
+}
+
+// batches returns whether calls to the provided method are batched.
+func (b *batcher) batches(key call.MethodKey) bool {
+	return b.methods == nil || b.methods[key]
+}
+
+// call makes a call to the provided method as part of a batch.
+func (b *batcher) call(ctx context.Context, key call.MethodKey, args []byte, opts call.CallOptions) ([]byte, error) {
+	// The caller may reuse args once its call returns.
+	c := &batchedCall{
+		ctx:  ctx,
+		key:  key,
+		args: append([]byte(nil), args...),
+		done: make(chan struct{}),
+	}
+	b.add(c, opts)
+	select {
+	case <-c.done:
+		return c.reply, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// add adds a call to the pending batch for its shard key and caller, and sends
+// the batch if it is full.
+func (b *batcher) add(c *batchedCall, opts call.CallOptions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := batchKey{shardKey: opts.ShardKey, caller: opts.Caller}
+	bt := b.pending[key]
+	if bt == nil {
+		bt = &batch{opts: opts}
+		b.pending[key] = bt
+		bt.timer = time.AfterFunc(b.maxDelay, func() { b.flush(key, bt) })
+	}
+	bt.calls = append(bt.calls, c)
+	if len(bt.calls) >= b.maxSize {
+		bt.timer.Stop()
+		delete(b.pending, key)
+		go b.send(bt)
+	}
+}
+
+// flush sends the provided batch, unless it was already sent.
+func (b *batcher) flush(key batchKey, bt *batch) {
+	b.mu.Lock()
+	if b.pending[key] != bt {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, key)
+	b.mu.Unlock()
+	b.send(bt)
+}
+
+// send sends a batch and hands every call its reply.
+func (b *batcher) send(bt *batch) {
+	// Drop the calls whose callers have given up.
+	calls := bt.calls[:0]
+	for _, c := range bt.calls {
+		if c.ctx.Err() == nil {
+			calls = append(calls, c)
+		}
+	}
+	switch len(calls) {
+	case 0:
+		return
+	case 1:
+		// A batch of one is sent as a regular call.
+		c := calls[0]
+		c.reply, c.err = b.client.Call(c.ctx, c.key, c.args, bt.opts)
+		close(c.done)
+		return
+	}
+
+	ctx, cancel := batchContext(calls)
+	defer cancel()
+	enc := codegen.NewEncoder()
+	enc.Len(len(calls))
+	for _, c := range calls {
+		copy(enc.Grow(len(c.key)), c.key[:])
+		var micros int64
+		if deadline, ok := c.ctx.Deadline(); ok {
+			if micros = time.Until(deadline).Microseconds(); micros <= 0 {
+				// The call is about to expire; zero would mean no timeout.
+				micros = 1
+			}
+		}
+		enc.Int64(micros)
+		enc.Bytes(c.args)
+	}
+	reply, err := b.client.Call(ctx, batchMethodKey, enc.Data(), bt.opts)
+	if err == nil {
+		err = decodeBatchReply(reply, calls)
+	}
+	for _, c := range calls {
+		if err != nil {
+			c.reply, c.err = nil, err
+		}
+		close(c.done)
+	}
+}
+
+// batchContext returns the context of the RPC that sends the provided calls.
+// The RPC is traced as part of the trace of the first call, and its deadline
+// is the latest deadline of the calls, if they all have one.
+func batchContext(calls []*batchedCall) (context.Context, context.CancelFunc) {
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(calls[0].ctx))
+	var latest time.Time
+	for _, c := range calls {
+		deadline, ok := c.ctx.Deadline()
+		if !ok {
+			return context.WithCancel(ctx)
+		}
+		if deadline.After(latest) {
+			latest = deadline
+		}
+	}
+	return context.WithDeadline(ctx, latest)
+}
+
+// decodeBatchReply decodes the reply to a batch of calls into the calls.
+func decodeBatchReply(reply []byte, calls []*batchedCall) (err error) {
+	defer func() {
+		if x := codegen.CatchPanics(recover()); x != nil {
+			err = fmt.Errorf("%w: could not decode batch reply: %v", call.CommunicationError, x)
+		}
+	}()
+	dec := codegen.NewDecoder(reply)
+	if n := dec.Len(); n != len(calls) {
+		return fmt.Errorf("%w: got %d replies to a batch of %d calls", call.CommunicationError, n, len(calls))
+	}
+	for _, c := range calls {
+		if dec.Bool() {
+			c.reply = dec.Bytes()
+		} else {
+			c.err = dec.Error()
+		}
+	}
+	return nil
+}
+
+// serveBatch returns the handler of the batch method, which executes
+// batches of calls to the handlers in hm concurrently.
+func serveBatch(hm *call.HandlerMap) call.Handler {
+	return func(ctx context.Context, args []byte) (reply []byte, err error) {
+		defer func() {
+			if x := codegen.CatchPanics(recover()); x != nil {
+				err = x
+			}
+		}()
+		dec := codegen.NewDecoder(args)
+		n := dec.Len()
+		if n < 0 {
+			return nil, fmt.Errorf("invalid batch of %d calls", n)
+		}
+		type result struct {
+			reply []byte
+			err   error
+		}
+		results := make([]result, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			var key call.MethodKey
+			copy(key[:], dec.Read(len(key)))
+			micros := dec.Int64()
+			args := dec.Bytes()
+			h, ok := hm.Get(key)
+			if !ok || key == batchMethodKey {
+				results[i].err = fmt.Errorf("unknown function")
+				continue
+			}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ctx := ctx
+				if micros > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, time.Duration(micros)*time.Microsecond)
+					defer cancel()
+				}
+				results[i].reply, results[i].err = h(ctx, args)
+			}(i)
+		}
+		wg.Wait()
+
+		enc := codegen.NewEncoder()
+		enc.Len(n)
+		for _, r := range results {
+			enc.Bool(r.err == nil)
+			if r.err == nil {
+				enc.Bytes(r.reply)
+			} else {
+				enc.Error(r.err)
+			}
+		}
+		return enc.Data(), nil
+	}
+}
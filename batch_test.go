@@ -0,0 +1,169 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/runtime"
+)
+
+// batchingClient is a call.Connection that serves calls, and batches of
+// calls, with the handlers of an "echo" component.
+type batchingClient struct {
+	handlers call.HandlerMap
+
+	mu      sync.Mutex
+	calls   int // calls sent alone
+	batches int // batches sent
+}
+
+var _ call.Connection = &batchingClient{}
+
+func newBatchingClient() *batchingClient {
+	c := &batchingClient{}
+	c.handlers.Set("echo", "Echo", func(_ context.Context, args []byte) ([]byte, error) {
+		if strings.HasPrefix(string(args), "fail") {
+			return nil, fmt.Errorf("echo %s", args)
+		}
+		return append([]byte("echo "), args...), nil
+	})
+	c.handlers.Set("", "batch", serveBatch(&c.handlers))
+	return c
+}
+
+func (c *batchingClient) Call(ctx context.Context, key call.MethodKey, args []byte, _ call.CallOptions) ([]byte, error) {
+	c.mu.Lock()
+	if key == batchMethodKey {
+		c.batches++
+	} else {
+		c.calls++
+	}
+	c.mu.Unlock()
+	h, ok := c.handlers.Get(key)
+	if !ok {
+		return nil, errors.New("unknown function")
+	}
+	return h(ctx, args)
+}
+
+func (c *batchingClient) Close() {}
+
+// callConcurrently makes concurrent calls to Echo through b, with the
+// provided arguments, and returns the replies, or errors.
+func callConcurrently(ctx context.Context, b *batcher, args ...string) []string {
+	key := call.MakeMethodKey("echo", "Echo")
+	replies := make([]string, len(args))
+	var wg sync.WaitGroup
+	for i, arg := range args {
+		wg.Add(1)
+		go func(i int, arg string) {
+			defer wg.Done()
+			reply, err := b.call(ctx, key, []byte(arg), call.CallOptions{})
+			if err != nil {
+				replies[i] = "error: " + err.Error()
+			} else {
+				replies[i] = string(reply)
+			}
+		}(i, arg)
+	}
+	wg.Wait()
+	return replies
+}
+
+func TestBatcherMaxSize(t *testing.T) {
+	client := newBatchingClient()
+	b := newBatcher("echo", client, runtime.BatchingPolicy{MaxDelay: time.Hour, MaxSize: 3})
+	got := callConcurrently(context.Background(), b, "a", "fail", "c")
+	want := []string{"echo a", "error: echo fail", "echo c"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("call %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+	if client.batches != 1 || client.calls != 0 {
+		t.Errorf("got %d batches and %d calls, want 1 batch and 0 calls", client.batches, client.calls)
+	}
+}
+
+func TestBatcherMaxDelay(t *testing.T) {
+	client := newBatchingClient()
+	b := newBatcher("echo", client, runtime.BatchingPolicy{MaxDelay: 10 * time.Millisecond})
+	got := callConcurrently(context.Background(), b, "a", "b")
+	if got[0] != "echo a" || got[1] != "echo b" {
+		t.Errorf("got %q, want [echo a, echo b]", got)
+	}
+	// The two calls may or may not make it into the same batch, but every
+	// call is sent exactly once.
+	if sent := 2*client.batches + client.calls; sent != 2 {
+		t.Errorf("got %d batches and %d calls, want 2 calls sent", client.batches, client.calls)
+	}
+
+	// A lone call is sent as a regular call.
+	client.batches, client.calls = 0, 0
+	callConcurrently(context.Background(), b, "a")
+	if client.batches != 0 || client.calls != 1 {
+		t.Errorf("got %d batches and %d calls, want 0 batches and 1 call", client.batches, client.calls)
+	}
+}
+
+func TestBatcherCanceled(t *testing.T) {
+	client := newBatchingClient()
+	b := newBatcher("echo", client, runtime.BatchingPolicy{MaxDelay: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	got := callConcurrently(ctx, b, "a")
+	if want := "error: " + context.DeadlineExceeded.Error(); got[0] != want {
+		t.Errorf("got %q, want %q", got[0], want)
+	}
+}
+
+func TestBatcherMethods(t *testing.T) {
+	b := newBatcher("echo", newBatchingClient(), runtime.BatchingPolicy{MaxDelay: time.Millisecond, Methods: []string{"Echo"}})
+	if !b.batches(call.MakeMethodKey("echo", "Echo")) {
+		t.Error("Echo not batched")
+	}
+	if b.batches(call.MakeMethodKey("echo", "Other")) {
+		t.Error("Other batched")
+	}
+	if newBatcher("echo", nil, runtime.BatchingPolicy{}) != nil {
+		t.Error("batcher without max_delay")
+	}
+}
+
+func TestServeBatchUnknownMethod(t *testing.T) {
+	client := newBatchingClient()
+	b := newBatcher("echo", client, runtime.BatchingPolicy{MaxDelay: time.Hour, MaxSize: 2})
+	key := call.MakeMethodKey("echo", "Missing")
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := b.call(context.Background(), key, nil, call.CallOptions{})
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil || !strings.Contains(err.Error(), "unknown function") {
+			t.Errorf("got error %v, want unknown function", err)
+		}
+	}
+}
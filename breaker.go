@@ -0,0 +1,202 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/metrics"
+	"github.com/ServiceWeaver/weaver/runtime"
+)
+
+// breakerBuckets is the number of buckets in a circuit breaker's window.
+const breakerBuckets = 10
+
+// Circuit breaker states, as reported by the
+// serviceweaver_circuit_breaker_state metric.
+const (
+	breakerClosed   = 0
+	breakerOpen     = 1
+	breakerHalfOpen = 2
+)
+
+type breakerLabels struct {
+	Component string // full callee component name
+}
+
+var (
+	breakerStates = metrics.NewGaugeMap[breakerLabels](
+		"serviceweaver_circuit_breaker_state",
+		"State of the circuit breaker for calls to a Service Weaver component (0 is closed, 1 is open, 2 is half-open)",
+	)
+	breakerRejections = metrics.NewCounterMap[breakerLabels](
+		"serviceweaver_circuit_breaker_rejected_count",
+		"Count of Service Weaver component method invocations rejected by an open circuit breaker",
+	)
+)
+
+// breakerBucket counts the calls that ended during a slice of a circuit
+// breaker's window.
+type breakerBucket struct {
+	start  time.Time // start of the slice
+	calls  int
+	failed int
+	slow   int
+}
+
+// breaker is a circuit breaker that sheds calls to a component when they fail
+// or are slow. See runtime.CircuitBreakerPolicy for details.
+type breaker struct {
+	name     string                       // full component name
+	policy   runtime.CircuitBreakerPolicy // with defaults applied
+	now      func() time.Time             // time.Now usually, but injected fake in tests
+	state    *metrics.Gauge               // see breakerStates
+	rejected *metrics.Counter             // see breakerRejections
+
+	mu         sync.Mutex
+	current    int       // one of breakerClosed, breakerOpen, breakerHalfOpen
+	generation uint64    // incremented on every state change
+	opened     time.Time // when the breaker last opened
+	probes     int       // number of probe calls let through while half-open
+	probed     int       // number of successful probe calls
+	buckets    [breakerBuckets]breakerBucket
+}
+
+// newBreaker returns a new closed circuit breaker for calls to the named
+// component, or nil if the policy disables it.
+func newBreaker(name string, policy runtime.CircuitBreakerPolicy) *breaker {
+	if !policy.Enabled() {
+		return nil
+	}
+	if policy.MinCalls == 0 {
+		policy.MinCalls = 20
+	}
+	if policy.OpenDuration == 0 {
+		policy.OpenDuration = 30 * time.Second
+	}
+	if policy.HalfOpenCalls == 0 {
+		policy.HalfOpenCalls = 1
+	}
+	labels := breakerLabels{Component: name}
+	return &breaker{
+		name:     name,
+		policy:   policy,
+		now:      time.Now,
+		state:    breakerStates.Get(labels),
+		rejected: breakerRejections.Get(labels),
+	}
+}
+
+// allow returns nil if a call may proceed, in which case the outcome of the
+// call must be reported to done. Otherwise, it returns an error that wraps
+// ErrCircuitOpen.
+func (b *breaker) allow() (generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.current {
+	case breakerOpen:
+		if b.now().Sub(b.opened) < b.policy.OpenDuration {
+			b.rejected.Add(1)
+			return 0, fmt.Errorf("%w: component %q", ErrCircuitOpen, b.name)
+		}
+		b.transition(breakerHalfOpen)
+		fallthrough
+	case breakerHalfOpen:
+		if b.probes >= b.policy.HalfOpenCalls {
+			b.rejected.Add(1)
+			return 0, fmt.Errorf("%w: component %q is being probed", ErrCircuitOpen, b.name)
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+// done reports the outcome of a call let through by allow.
+func (b *breaker) done(generation uint64, failed bool, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		// The call started before the last state change.
+		return
+	}
+	slow := b.policy.SlowCall > 0 && latency > b.policy.SlowCall
+	if b.current == breakerHalfOpen {
+		if failed || slow {
+			b.transition(breakerOpen)
+			return
+		}
+		b.probed++
+		if b.probed == b.policy.HalfOpenCalls {
+			b.transition(breakerClosed)
+		}
+		return
+	}
+
+	// Record the call in the bucket for the current slice of the window.
+	now := b.now()
+	width := b.policy.Window / breakerBuckets
+	if width <= 0 {
+		width = 1
+	}
+	start := now.Truncate(width)
+	bucket := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	bucket.calls++
+	if failed {
+		bucket.failed++
+	}
+	if slow {
+		bucket.slow++
+	}
+
+	// Open the breaker if the window has enough bad calls.
+	var calls, bad, slowCalls int
+	for _, bk := range b.buckets {
+		if now.Sub(bk.start) >= b.policy.Window {
+			continue
+		}
+		calls += bk.calls
+		bad += bk.failed
+		slowCalls += bk.slow
+	}
+	if calls < b.policy.MinCalls {
+		return
+	}
+	if (b.policy.ErrorRate > 0 && float64(bad) >= b.policy.ErrorRate*float64(calls)) ||
+		(b.policy.SlowRate > 0 && float64(slowCalls) >= b.policy.SlowRate*float64(calls)) {
+		b.transition(breakerOpen)
+	}
+}
+
+// transition moves the breaker to the provided state.
+//
+// REQUIRES: b.mu is held.
+func (b *breaker) transition(state int) {
+	b.current = state
+	b.generation++
+	b.probes = 0
+	b.probed = 0
+	switch state {
+	case breakerOpen:
+		b.opened = b.now()
+	case breakerClosed:
+		b.buckets = [breakerBuckets]breakerBucket{}
+	}
+	b.state.Set(float64(state))
+}
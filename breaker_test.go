@@ -0,0 +1,138 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+)
+
+// newTestBreaker returns a breaker with the provided policy and a fake clock,
+// which can be advanced with the returned function.
+func newTestBreaker(t *testing.T, policy runtime.CircuitBreakerPolicy) (*breaker, func(time.Duration)) {
+	t.Helper()
+	b := newBreaker(t.Name(), policy)
+	if b == nil {
+		t.Fatal("circuit breaker disabled")
+	}
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	return b, func(d time.Duration) { now = now.Add(d) }
+}
+
+// makeCall makes a call through b that fails or takes the provided latency,
+// and returns whether the call was let through.
+func makeCall(t *testing.T, b *breaker, failed bool, latency time.Duration) bool {
+	t.Helper()
+	generation, err := b.allow()
+	if err != nil {
+		if !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("allow: got %v, want ErrCircuitOpen", err)
+		}
+		return false
+	}
+	b.done(generation, failed, latency)
+	return true
+}
+
+func TestBreakerOpensOnErrors(t *testing.T) {
+	b, advance := newTestBreaker(t, runtime.CircuitBreakerPolicy{
+		Window:       10 * time.Second,
+		MinCalls:     4,
+		ErrorRate:    0.5,
+		OpenDuration: time.Minute,
+	})
+
+	// Not enough calls to open the breaker.
+	for i := 0; i < 3; i++ {
+		if !makeCall(t, b, true, 0) {
+			t.Fatalf("call %d rejected before min_calls", i)
+		}
+	}
+
+	// Failures that fall out of the window are forgotten.
+	advance(time.Minute)
+	for i := 0; i < 3; i++ {
+		makeCall(t, b, false, 0)
+	}
+	if !makeCall(t, b, true, 0) {
+		t.Fatal("call rejected with an error rate below threshold")
+	}
+
+	// Reach the error rate.
+	makeCall(t, b, true, 0)
+	makeCall(t, b, true, 0)
+	if makeCall(t, b, false, 0) {
+		t.Fatal("call let through an open breaker")
+	}
+}
+
+func TestBreakerOpensOnSlowCalls(t *testing.T) {
+	b, _ := newTestBreaker(t, runtime.CircuitBreakerPolicy{
+		Window:   10 * time.Second,
+		MinCalls: 2,
+		SlowCall: 100 * time.Millisecond,
+		SlowRate: 1,
+	})
+	makeCall(t, b, false, time.Second)
+	makeCall(t, b, false, time.Second)
+	if makeCall(t, b, false, 0) {
+		t.Fatal("call let through an open breaker")
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b, advance := newTestBreaker(t, runtime.CircuitBreakerPolicy{
+		Window:        10 * time.Second,
+		MinCalls:      1,
+		ErrorRate:     1,
+		OpenDuration:  time.Minute,
+		HalfOpenCalls: 1,
+	})
+	makeCall(t, b, true, 0)
+	if makeCall(t, b, false, 0) {
+		t.Fatal("call let through an open breaker")
+	}
+
+	// A failed probe opens the breaker again.
+	advance(time.Minute)
+	if !makeCall(t, b, true, 0) {
+		t.Fatal("probe rejected")
+	}
+	if makeCall(t, b, false, 0) {
+		t.Fatal("call let through a reopened breaker")
+	}
+
+	// Only one probe is let through at a time.
+	advance(time.Minute)
+	generation, err := b.allow()
+	if err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if makeCall(t, b, false, 0) {
+		t.Fatal("second probe let through")
+	}
+
+	// A successful probe closes the breaker.
+	b.done(generation, false, 0)
+	for i := 0; i < 10; i++ {
+		if !makeCall(t, b, false, 0) {
+			t.Fatal("call rejected by a closed breaker")
+		}
+	}
+}
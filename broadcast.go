@@ -0,0 +1,157 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+)
+
+// BroadcastResult is the result of the call made by Broadcast to a replica.
+type BroadcastResult[R any] struct {
+	Replica string // address of the replica, or "" if the component is local
+	Value   R      // value returned by the call
+	Err     error  // error returned by the call
+}
+
+// Broadcast calls f, concurrently, with a client of every replica of the
+// component with interface T, and returns the results of the calls, in no
+// particular order. The calls that f makes on the client it is passed are
+// all executed by the same replica, regardless of the component's routing
+// and load balancing. For example, the following code invalidates a cache
+// entry in every replica of a Cache component:
+//
+//	results, err := weaver.Broadcast(ctx, root, func(ctx context.Context, c Cache) (bool, error) {
+//	    return c.Invalidate(ctx, key)
+//	})
+//
+// Broadcast reaches the replicas known to the caller when it is called;
+// replicas started concurrently may be missed. In a single process
+// deployment, the component has a single, local, replica.
+func Broadcast[T, R any](ctx context.Context, requester Instance, f func(context.Context, T) (R, error)) ([]BroadcastResult[R], error) {
+	var zero T
+	iface := reflect.TypeOf(&zero).Elem()
+	rep := requester.rep()
+	component, err := rep.wlet.getComponentByType(iface)
+	if err != nil {
+		return nil, err
+	}
+	replicas, err := rep.wlet.getReplicaInstances(component, rep.info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BroadcastResult[R], len(replicas))
+	var wg sync.WaitGroup
+	for i, replica := range replicas {
+		i, replica := i, replica
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := f(ctx, replica.instance.(T))
+			results[i] = BroadcastResult[R]{Replica: replica.addr, Value: value, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// replicaInstance is a client of a single replica of a component.
+type replicaInstance struct {
+	addr     string // address of the replica, or "" if local
+	instance any
+}
+
+// getReplicaInstances returns a client of every replica of the provided
+// component.
+func (d *weavelet) getReplicaInstances(c *component, requester string) ([]replicaInstance, error) {
+	if d.info.SingleProcess {
+		instance, err := d.getInstance(c, requester)
+		if err != nil {
+			return nil, err
+		}
+		return []replicaInstance{{instance: instance}}, nil
+	}
+
+	// Start the component, if needed, and wait until it is ready.
+	stub, err := d.getStub(c)
+	if err != nil {
+		return nil, err
+	}
+	// Replicas in other colocation groups are only reachable over TCP.
+	client, err := d.getTCPClient(c)
+	if err != nil {
+		return nil, err
+	}
+	policies := methodPolicies(c)
+	for i := range policies {
+		// Hedged calls would go to the same replica.
+		policies[i].hedging = nil
+	}
+	var instances []replicaInstance
+	for _, addr := range client.routelet.replicas() {
+		endpoints, err := parseEndpoints([]string{addr}, d.sockets)
+		if err != nil {
+			return nil, err
+		}
+		// Calls to a single replica are neither mirrored nor batched with
+		// the calls to other replicas, nor do they trip the circuit breaker
+		// of the component.
+		pinned := *stub.stub
+		pinned.client = client.client
+		pinned.balancer = &pinnedBalancer{endpoint: endpoints[0]}
+		pinned.policies = policies
+		pinned.breaker = nil
+		pinned.mirror = nil
+		pinned.batcher = nil
+		pinned.caller = callerKey(requester)
+		instances = append(instances, replicaInstance{
+			addr:     addr,
+			instance: c.info.ClientStubFn(&pinned, requester),
+		})
+	}
+	return instances, nil
+}
+
+// pinnedBalancer is a balancer that always picks the same endpoint.
+type pinnedBalancer struct {
+	endpoint call.Endpoint
+	found    bool // is endpoint among the latest endpoints?
+}
+
+var _ call.Balancer = &pinnedBalancer{}
+
+// Update implements the call.Balancer interface.
+func (b *pinnedBalancer) Update(endpoints []call.Endpoint) {
+	b.found = false
+	for _, endpoint := range endpoints {
+		if endpoint.Address() == b.endpoint.Address() {
+			b.found = true
+			return
+		}
+	}
+}
+
+// Pick implements the call.Balancer interface.
+func (b *pinnedBalancer) Pick(call.CallOptions) (call.Endpoint, error) {
+	if !b.found {
+		return nil, fmt.Errorf("%w: replica %s is gone", call.Unreachable, b.endpoint.Address())
+	}
+	return b.endpoint, nil
+}
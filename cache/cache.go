@@ -0,0 +1,225 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache provides a reusable, sharded cache component.
+//
+// Applications get a handle to the cache like any other component:
+//
+//	c, err := weaver.Get[cache.Cache](root)
+//
+// Calls are routed by key, so every key is owned by a single replica of the
+// cache and replicas do not need to coordinate. Values are opaque byte
+// slices; use Typed for a cache of typed keys and values, encoded as JSON.
+//
+// The cache is configured in the
+// ["github.com/ServiceWeaver/weaver/cache/Cache"] section of the config file:
+//
+//	["github.com/ServiceWeaver/weaver/cache/Cache"]
+//	backend = "memory"    # name of a registered backend
+//	size = 100000         # maximum number of entries per replica
+//	default_ttl = "10m"   # TTL used by Put when the caller passes zero
+//
+// Two backends are always available: "memory", an in-process LRU cache, and
+// "redis", which stores entries in a Redis server configured with the
+// options table of the section (see Config.Options):
+//
+//	["github.com/ServiceWeaver/weaver/cache/Cache"]
+//	backend = "redis"
+//	options = {address = "redis.internal:6379", key_prefix = "myapp/"}
+//
+// Other backends can be plugged in with RegisterBackend.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+//go:generate ../cmd/weaver/weaver generate
+
+// Cache is a key-value cache whose entries may expire.
+type Cache interface {
+	// Get returns the value associated with key, and whether it was found.
+	// Expired entries are never returned.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Put associates value with key. The entry expires after ttl. If ttl is
+	// zero, the configured default TTL is used; if that is zero too, the
+	// entry does not expire (though it may still be evicted).
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Remove removes key from the cache, returning whether it was present.
+	Remove(ctx context.Context, key string) (bool, error)
+}
+
+// Config configures the cache. The same configuration is passed to the
+// backend constructor.
+type Config struct {
+	// Backend is the name of the backend that stores entries. If empty,
+	// defaults to "memory".
+	Backend string
+
+	// Size is the maximum number of entries stored by every replica of the
+	// cache. If zero, defaults to DefaultSize. Backends that don't store
+	// entries in process may ignore it.
+	Size int
+
+	// DefaultTTL is the TTL of entries added by Put with a zero TTL, in a
+	// format accepted by time.ParseDuration. If empty, such entries do not
+	// expire.
+	DefaultTTL string `toml:"default_ttl"`
+
+	// Options holds backend-specific settings, e.g., the address of a
+	// remote server.
+	Options map[string]string
+}
+
+// DefaultSize is the default value of Config.Size.
+const DefaultSize = 1 << 16
+
+// Validate validates the config.
+func (cfg *Config) Validate() error {
+	if cfg.Size < 0 {
+		return fmt.Errorf("invalid negative size %d", cfg.Size)
+	}
+	if cfg.DefaultTTL != "" {
+		ttl, err := time.ParseDuration(cfg.DefaultTTL)
+		if err != nil {
+			return fmt.Errorf("invalid default_ttl %q: %w", cfg.DefaultTTL, err)
+		}
+		if ttl < 0 {
+			return fmt.Errorf("invalid negative default_ttl %q", cfg.DefaultTTL)
+		}
+	}
+	name := cfg.Backend
+	if name == "" {
+		name = memoryBackend
+	}
+	if _, ok := lookupBackend(name); !ok {
+		return fmt.Errorf("unknown backend %q", cfg.Backend)
+	}
+	return nil
+}
+
+// Backend stores the entries of a cache replica. Implementations must be
+// safe for concurrent use.
+type Backend interface {
+	// Get returns the value associated with key, if any. Get must not return
+	// an entry whose expiration time has passed.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Put associates value with key. If expires is not zero, the entry must
+	// not be returned by Get after that time.
+	Put(ctx context.Context, key string, value []byte, expires time.Time) error
+
+	// Remove removes key, returning whether it was present.
+	Remove(ctx context.Context, key string) (bool, error)
+}
+
+// NewBackendFunc returns a new backend for the provided configuration.
+type NewBackendFunc func(*Config) (Backend, error)
+
+var (
+	backendsMu sync.Mutex
+	backends   = map[string]NewBackendFunc{
+		memoryBackend: newMemory,
+		redisBackend:  newRedis,
+	}
+)
+
+// RegisterBackend registers a backend under the provided name, which can
+// then be selected with the "backend" config option. RegisterBackend is
+// typically called from an init function. It panics if a backend with the
+// same name is already registered.
+func RegisterBackend(name string, newBackend NewBackendFunc) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, ok := backends[name]; ok {
+		panic(fmt.Sprintf("cache: backend %q already registered", name))
+	}
+	backends[name] = newBackend
+}
+
+// lookupBackend returns the backend registered under the provided name.
+func lookupBackend(name string) (NewBackendFunc, bool) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	f, ok := backends[name]
+	return f, ok
+}
+
+type router struct{}
+
+func (router) Get(_ context.Context, key string) string { return key }
+func (router) Put(_ context.Context, key string, _ []byte, _ time.Duration) string {
+	return key
+}
+func (router) Remove(_ context.Context, key string) string { return key }
+
+type impl struct {
+	weaver.Implements[Cache]
+	weaver.WithRouter[router]
+	weaver.WithConfig[Config]
+
+	backend    Backend
+	defaultTTL time.Duration
+}
+
+func (c *impl) Init(context.Context) error {
+	cfg := *c.Config()
+	if cfg.Backend == "" {
+		cfg.Backend = memoryBackend
+	}
+	if cfg.Size == 0 {
+		cfg.Size = DefaultSize
+	}
+	if cfg.DefaultTTL != "" {
+		// The TTL was checked by Validate.
+		c.defaultTTL, _ = time.ParseDuration(cfg.DefaultTTL)
+	}
+	newBackend, _ := lookupBackend(cfg.Backend)
+	backend, err := newBackend(&cfg)
+	if err != nil {
+		return fmt.Errorf("cache: create %q backend: %w", cfg.Backend, err)
+	}
+	c.backend = backend
+	c.Logger().Debug("cache started", "backend", cfg.Backend, "size", cfg.Size, "default_ttl", c.defaultTTL)
+	return nil
+}
+
+func (c *impl) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return c.backend.Get(ctx, key)
+}
+
+func (c *impl) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("cache: invalid negative TTL %v", ttl)
+	}
+	if ttl == 0 {
+		ttl = c.defaultTTL
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	return c.backend.Put(ctx, key, value, expires)
+}
+
+func (c *impl) Remove(ctx context.Context, key string) (bool, error) {
+	return c.backend.Remove(ctx, key)
+}
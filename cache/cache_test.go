@@ -0,0 +1,159 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/weavertest"
+)
+
+func TestPutGetRemove(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			c := weavertest.InitComponent[Cache](t, weavertest.Options{SingleProcess: single, Replicas: 1})
+			if err := c.Put(ctx, "key", []byte("value"), 0); err != nil {
+				t.Fatal(err)
+			}
+			got, ok, err := c.Get(ctx, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || string(got) != "value" {
+				t.Fatalf("Get(key): got (%q, %t), want (%q, true)", got, ok, "value")
+			}
+			removed, err := c.Remove(ctx, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !removed {
+				t.Fatal("Remove(key): got false, want true")
+			}
+			if _, ok, err := c.Get(ctx, "key"); err != nil || ok {
+				t.Fatalf("Get(key) after Remove: got (%t, %v), want (false, nil)", ok, err)
+			}
+		})
+	}
+}
+
+func TestTTL(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			c := weavertest.InitComponent[Cache](t, weavertest.Options{
+				SingleProcess: single,
+				Replicas:      1,
+				Config: `
+["github.com/ServiceWeaver/weaver/cache/Cache"]
+default_ttl = "1ms"
+`,
+			})
+			if err := c.Put(ctx, "default", []byte("v"), 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Put(ctx, "explicit", []byte("v"), time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			for _, test := range []struct {
+				key   string
+				found bool
+			}{
+				{"default", false},
+				{"explicit", true},
+			} {
+				t.Run(test.key, func(t *testing.T) {
+					_, found, err := c.Get(ctx, test.key)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if found != test.found {
+						t.Fatalf("Get(%q): got found %t, want %t", test.key, found, test.found)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		cfg  Config
+	}{
+		{"NegativeSize", Config{Size: -1}},
+		{"BadTTL", Config{DefaultTTL: "soon"}},
+		{"NegativeTTL", Config{DefaultTTL: "-1s"}},
+		{"UnknownBackend", Config{Backend: "nonexistent"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.cfg.Validate(); err == nil {
+				t.Fatalf("Validate(%+v): unexpected success", test.cfg)
+			}
+		})
+	}
+}
+
+func TestTyped(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+	type userKey struct {
+		Org string
+		ID  int64
+	}
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			c := weavertest.InitComponent[Cache](t, weavertest.Options{SingleProcess: single, Replicas: 1})
+			users := NewTyped[userKey, user](c, "users/")
+			ages := NewTyped[userKey, int](c, "ages/")
+
+			key := userKey{"acme", 42}
+			want := user{"alice", 30}
+			if err := users.Put(ctx, key, want, 0); err != nil {
+				t.Fatal(err)
+			}
+			got, ok, err := users.Get(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || got != want {
+				t.Fatalf("Get(%v): got (%v, %t), want (%v, true)", key, got, ok, want)
+			}
+
+			// Caches in different namespaces don't collide.
+			if _, ok, err := ages.Get(ctx, key); err != nil || ok {
+				t.Fatalf("ages.Get(%v): got (%t, %v), want (false, nil)", key, ok, err)
+			}
+			if _, ok, err := users.Get(ctx, userKey{"acme", 43}); err != nil || ok {
+				t.Fatalf("Get(other key): got (%t, %v), want (false, nil)", ok, err)
+			}
+
+			if removed, err := users.Remove(ctx, key); err != nil || !removed {
+				t.Fatalf("Remove(%v): got (%t, %v), want (true, nil)", key, removed, err)
+			}
+			if _, ok, err := users.Get(ctx, key); err != nil || ok {
+				t.Fatalf("Get(%v) after Remove: got (%t, %v), want (false, nil)", key, ok, err)
+			}
+		})
+	}
+}
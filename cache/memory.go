@@ -0,0 +1,70 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// memoryBackend is the name of the in-process LRU backend.
+const memoryBackend = "memory"
+
+// memory is a Backend that stores entries in an in-process LRU cache.
+// Expired entries are dropped lazily, when they are read.
+type memory struct {
+	cache *lru.Cache[string, memoryEntry]
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time // zero if the entry doesn't expire
+}
+
+var _ Backend = &memory{}
+
+func newMemory(cfg *Config) (Backend, error) {
+	cache, err := lru.New[string, memoryEntry](cfg.Size)
+	if err != nil {
+		return nil, err
+	}
+	return &memory{cache: cache}, nil
+}
+
+// Get implements the Backend interface.
+func (m *memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	entry, ok := m.cache.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expires.IsZero() && !time.Now().Before(entry.expires) {
+		m.cache.Remove(key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+// Put implements the Backend interface.
+func (m *memory) Put(_ context.Context, key string, value []byte, expires time.Time) error {
+	m.cache.Add(key, memoryEntry{value: value, expires: expires})
+	return nil
+}
+
+// Remove implements the Backend interface.
+func (m *memory) Remove(_ context.Context, key string) (bool, error) {
+	return m.cache.Remove(key), nil
+}
@@ -0,0 +1,263 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// redisBackend is the name of the Redis backend.
+const redisBackend = "redis"
+
+// maxIdleRedisConns is the maximum number of idle connections to Redis kept
+// by a redis backend.
+const maxIdleRedisConns = 8
+
+// redis is a Backend that stores entries in a Redis server, which it talks to
+// using the Redis protocol (RESP). It is configured with the following
+// options:
+//
+//	address     address of the Redis server; defaults to "localhost:6379"
+//	password    password sent with AUTH, if not empty
+//	db          database selected with SELECT, if not empty
+//	key_prefix  prefix added to every key, if not empty
+//
+// Every replica of the cache talks to the same server, so entries survive the
+// restarts of the replicas, and Config.Size is ignored: the server's own
+// eviction policy applies.
+type redis struct {
+	address  string
+	password string
+	db       string
+	prefix   string
+
+	mu   sync.Mutex
+	idle []*redisConn // idle connections, most recently used last
+}
+
+// redisConn is a connection to a Redis server.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// redisError is an error reply sent by a Redis server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+var _ Backend = &redis{}
+
+func newRedis(cfg *Config) (Backend, error) {
+	r := &redis{
+		address:  "localhost:6379",
+		password: cfg.Options["password"],
+		db:       cfg.Options["db"],
+		prefix:   cfg.Options["key_prefix"],
+	}
+	if addr := cfg.Options["address"]; addr != "" {
+		r.address = addr
+	}
+	if r.db != "" {
+		if _, err := strconv.Atoi(r.db); err != nil {
+			return nil, fmt.Errorf("invalid db %q: %w", r.db, err)
+		}
+	}
+	return r, nil
+}
+
+// Get implements the Backend interface.
+func (r *redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := r.do(ctx, "GET", r.prefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	switch v := reply.(type) {
+	case nil:
+		return nil, false, nil
+	case []byte:
+		return v, true, nil
+	default:
+		return nil, false, fmt.Errorf("redis: unexpected GET reply %v", reply)
+	}
+}
+
+// Put implements the Backend interface.
+func (r *redis) Put(ctx context.Context, key string, value []byte, expires time.Time) error {
+	args := []any{"SET", r.prefix + key, value}
+	if !expires.IsZero() {
+		ttl := time.Until(expires).Milliseconds()
+		if ttl <= 0 {
+			// The entry has expired already.
+			_, err := r.do(ctx, "DEL", r.prefix+key)
+			return err
+		}
+		args = append(args, "PX", strconv.FormatInt(ttl, 10))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+// Remove implements the Backend interface.
+func (r *redis) Remove(ctx context.Context, key string) (bool, error) {
+	reply, err := r.do(ctx, "DEL", r.prefix+key)
+	if err != nil {
+		return false, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return false, fmt.Errorf("redis: unexpected DEL reply %v", reply)
+	}
+	return n > 0, nil
+}
+
+// do sends the command with the provided arguments, which are strings or
+// byte slices, and returns its reply: a string for a status reply, an int64
+// for an integer reply, a []byte for a bulk string, or nil for a null reply.
+// An error reply is returned as a redisError. Array replies, which none of
+// the commands used by the backend return, are not supported.
+func (r *redis) do(ctx context.Context, args ...any) (any, error) {
+	c, err := r.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(ctx, args...)
+	var rerr redisError
+	if err != nil && !errors.As(err, &rerr) {
+		// The connection is in an unknown state.
+		c.conn.Close()
+		return nil, err
+	}
+	r.put(c)
+	return reply, err
+}
+
+// get returns an idle connection, or a new one if there are none.
+func (r *redis) get(ctx context.Context) (*redisConn, error) {
+	r.mu.Lock()
+	if n := len(r.idle); n > 0 {
+		c := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mu.Unlock()
+		return c, nil
+	}
+	r.mu.Unlock()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", r.address)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	if r.password != "" {
+		if _, err := c.do(ctx, "AUTH", r.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.db != "" {
+		if _, err := c.do(ctx, "SELECT", r.db); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// put returns a connection to the idle connections.
+func (r *redis) put(c *redisConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.idle) >= maxIdleRedisConns {
+		c.conn.Close()
+		return
+	}
+	r.idle = append(r.idle, c)
+}
+
+// do sends a command and reads its reply. See redis.do.
+func (c *redisConn) do(ctx context.Context, args ...any) (any, error) {
+	deadline, _ := ctx.Deadline()
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var b []byte
+		switch a := arg.(type) {
+		case string:
+			b = []byte(a)
+		case []byte:
+			b = a
+		default:
+			panic(fmt.Sprintf("redis: unexpected argument type %T", arg))
+		}
+		fmt.Fprintf(c.w, "$%d\r\n", len(b))
+		c.w.Write(b)
+		c.w.WriteString("\r\n")
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return c.read()
+}
+
+// read reads a reply. See redis.do.
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, rest := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, redisError(rest)
+	case ':':
+		n, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed integer reply %q", line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: malformed bulk string reply %q", line)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return b[:n], nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/weavertest"
+)
+
+// fakeRedis is a Redis server that supports the commands used by the redis
+// backend.
+type fakeRedis struct {
+	password string
+
+	mu      sync.Mutex
+	entries map[string]fakeRedisEntry
+	keys    []string // keys of the SET commands received, in order
+}
+
+type fakeRedisEntry struct {
+	value   string
+	expires time.Time
+}
+
+// startFakeRedis starts a fake Redis server and returns its address.
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	f := &fakeRedis{password: password, entries: map[string]fakeRedisEntry{}}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, lis.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		if !authenticated && cmd != "AUTH" {
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		fmt.Fprint(conn, f.exec(cmd, args[1:], &authenticated))
+	}
+}
+
+func (f *fakeRedis) exec(cmd string, args []string, authenticated *bool) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch cmd {
+	case "AUTH":
+		if args[0] != f.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		*authenticated = true
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		e, ok := f.entries[args[0]]
+		if !ok || (!e.expires.IsZero() && !time.Now().Before(e.expires)) {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(e.value), e.value)
+	case "SET":
+		e := fakeRedisEntry{value: args[1]}
+		if len(args) == 4 && strings.ToUpper(args[2]) == "PX" {
+			ms, err := strconv.Atoi(args[3])
+			if err != nil {
+				return "-ERR value is not an integer\r\n"
+			}
+			e.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		f.entries[args[0]] = e
+		f.keys = append(f.keys, args[0])
+		return "+OK\r\n"
+	case "DEL":
+		_, ok := f.entries[args[0]]
+		delete(f.entries, args[0])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", cmd)
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func TestRedisBackend(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			fake, addr := startFakeRedis(t, "secret")
+			c := weavertest.InitComponent[Cache](t, weavertest.Options{
+				SingleProcess: single,
+				Replicas:      1,
+				Config: fmt.Sprintf(`
+["github.com/ServiceWeaver/weaver/cache/Cache"]
+backend = "redis"
+default_ttl = "1ms"
+options = {address = %q, password = "secret", db = "1", key_prefix = "app/"}
+`, addr),
+			})
+
+			if err := c.Put(ctx, "key", []byte("value"), time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			got, ok, err := c.Get(ctx, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || string(got) != "value" {
+				t.Fatalf("Get(key): got (%q, %t), want (%q, true)", got, ok, "value")
+			}
+			if removed, err := c.Remove(ctx, "key"); err != nil || !removed {
+				t.Fatalf("Remove(key): got (%t, %v), want (true, nil)", removed, err)
+			}
+			if removed, err := c.Remove(ctx, "key"); err != nil || removed {
+				t.Fatalf("Remove(key) again: got (%t, %v), want (false, nil)", removed, err)
+			}
+
+			// Entries expire after the default TTL.
+			if err := c.Put(ctx, "ttl", []byte("value"), 0); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+			if _, ok, err := c.Get(ctx, "ttl"); err != nil || ok {
+				t.Fatalf("Get(ttl) after TTL: got (%t, %v), want (false, nil)", ok, err)
+			}
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			for _, key := range fake.keys {
+				if !strings.HasPrefix(key, "app/") {
+					t.Errorf("key %q stored without prefix %q", key, "app/")
+				}
+			}
+		})
+	}
+}
+
+func TestRedisBackendErrors(t *testing.T) {
+	ctx := context.Background()
+	_, addr := startFakeRedis(t, "secret")
+	backend, err := newRedis(&Config{Options: map[string]string{"address": addr, "password": "wrong"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := backend.Get(ctx, "key"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Fatalf("Get with wrong password: got %v, want WRONGPASS error", err)
+	}
+
+	if _, err := newRedis(&Config{Options: map[string]string{"db": "zero"}}); err == nil {
+		t.Fatal("newRedis with db zero: unexpected success")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Typed is a cache with keys of type K and values of type V, stored in a
+// Cache. Keys and values are encoded as JSON, so they must be types that
+// encoding/json can encode, and the encoding of a key must identify it, which
+// rules out, e.g., pointer keys. For example:
+//
+//	c, err := weaver.Get[cache.Cache](root)
+//	...
+//	users := cache.NewTyped[int64, User](c, "users/")
+//	users.Put(ctx, 42, User{Name: "alice"}, time.Hour)
+//	user, ok, err := users.Get(ctx, 42)
+//
+// Typed values are cheap to create, and any number of them can share the
+// same Cache. Keys are prefixed with the provided namespace, so that caches of
+// different types don't collide.
+type Typed[K comparable, V any] struct {
+	cache     Cache
+	namespace string
+}
+
+// NewTyped returns a cache of Ks to Vs stored in c, under keys prefixed by
+// namespace.
+func NewTyped[K comparable, V any](c Cache, namespace string) *Typed[K, V] {
+	return &Typed[K, V]{cache: c, namespace: namespace}
+}
+
+// Get returns the value associated with key, and whether it was found.
+func (t *Typed[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	var value V
+	k, err := t.key(key)
+	if err != nil {
+		return value, false, err
+	}
+	data, ok, err := t.cache.Get(ctx, k)
+	if err != nil || !ok {
+		return value, false, err
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, false, fmt.Errorf("cache: decode value of %s: %w", k, err)
+	}
+	return value, true, nil
+}
+
+// Put associates value with key. See Cache.Put for the meaning of ttl.
+func (t *Typed[K, V]) Put(ctx context.Context, key K, value V, ttl time.Duration) error {
+	k, err := t.key(key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cache: encode value of %s: %w", k, err)
+	}
+	return t.cache.Put(ctx, k, data, ttl)
+}
+
+// Remove removes key from the cache, returning whether it was present.
+func (t *Typed[K, V]) Remove(ctx context.Context, key K) (bool, error) {
+	k, err := t.key(key)
+	if err != nil {
+		return false, err
+	}
+	return t.cache.Remove(ctx, k)
+}
+
+// key returns the Cache key for the provided key.
+func (t *Typed[K, V]) key(key K) (string, error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("cache: encode key %v: %w", key, err)
+	}
+	return t.namespace + string(data), nil
+}
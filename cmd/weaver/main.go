@@ -17,26 +17,39 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
+	"syscall"
 
+	"github.com/ServiceWeaver/weaver/internal/status"
+	"github.com/ServiceWeaver/weaver/internal/tool/compose"
+	"github.com/ServiceWeaver/weaver/internal/tool/ecs"
 	"github.com/ServiceWeaver/weaver/internal/tool/generate"
 	"github.com/ServiceWeaver/weaver/internal/tool/multi"
+	"github.com/ServiceWeaver/weaver/internal/tool/nomad"
 	"github.com/ServiceWeaver/weaver/internal/tool/single"
 	"github.com/ServiceWeaver/weaver/internal/tool/ssh"
+	"github.com/ServiceWeaver/weaver/internal/tool/systemd"
 	"github.com/ServiceWeaver/weaver/runtime/tool"
 )
 
 const usage = `USAGE
 
   weaver generate                 // weaver code generator
+  weaver graph                    // print the component graph of a binary
   weaver single    <command> ...  // for single process deployments
   weaver multi     <command> ...  // for multiprocess deployments
   weaver ssh       <command> ...  // for multimachine deployments
+  weaver nomad     <command> ...  // for Nomad deployments
+  weaver compose   <command> ...  // for Docker Compose deployments
+  weaver ecs       <command> ...  // for Amazon ECS deployments
+  weaver systemd   <command> ...  // for systemd deployments
   weaver gke       <command> ...  // for GKE deployments
   weaver gke-local <command> ...  // for simulated GKE deployments
 
@@ -44,8 +57,9 @@ DESCRIPTION
 
   Use the "weaver" command to deploy and manage Weaver applications.
 
-  The "weaver generate", "weaver single", "weaver multi", and "weaver ssh"
-  subcommands are baked in, but all other subcommands of the form
+  The "weaver generate", "weaver graph", "weaver single", "weaver multi",
+  "weaver ssh", "weaver nomad", "weaver compose", "weaver ecs", and
+  "weaver systemd" subcommands are baked in, but all other subcommands of the form
   "weaver <deployer>" dispatch to a binary called "weaver-<deployer>".
   "weaver gke status", for example, dispatches to "weaver-gke status".
 `
@@ -61,10 +75,15 @@ func main() {
 
 	// Handle the internal deployers.
 	internals := map[string]map[string]*tool.Command{
-		"single": single.Commands,
-		"multi":  multi.Commands,
-		"ssh":    ssh.Commands,
+		"single":  single.Commands,
+		"multi":   multi.Commands,
+		"ssh":     ssh.Commands,
+		"nomad":   nomad.Commands,
+		"compose": compose.Commands,
+		"ecs":     ecs.Commands,
+		"systemd": systemd.Commands,
 	}
+	graph := status.GraphCommand("weaver", nil)
 
 	switch flag.Arg(0) {
 	case "generate":
@@ -72,14 +91,31 @@ func main() {
 		generateFlags.Usage = func() {
 			fmt.Fprintln(os.Stderr, generate.Usage)
 		}
+		watch := generateFlags.Bool("watch", false, "Regenerate code when the packages change")
+		fakes := generateFlags.Bool("fakes", false, "Generate a fake for every component interface")
+		schema := generateFlags.Bool("schema", false, "Write a JSON schema of the components and types")
 		generateFlags.Parse(flag.Args()[1:])
-		if err := generate.Generate(".", flag.Args()[1:]); err != nil {
+		if *watch {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			err := generate.Watch(ctx, ".", generateFlags.Args(), generate.Options{Fakes: *fakes, Schema: *schema}, os.Stderr)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+		if err := generate.Generate(".", generateFlags.Args(), generate.Options{Fakes: *fakes, Schema: *schema}); err != nil {
 			fmt.Fprint(os.Stderr, err)
 			os.Exit(1)
 		}
 		return
 
-	case "single", "multi", "ssh":
+	case "graph":
+		tool.Run("weaver", map[string]*tool.Command{"graph": graph})
+		return
+
+	case "single", "multi", "ssh", "nomad", "compose", "ecs", "systemd":
 		os.Args = os.Args[1:]
 		tool.Run("weaver "+flag.Arg(0), internals[flag.Arg(0)])
 		return
@@ -94,6 +130,9 @@ func main() {
 		case n == 2 && command == "generate":
 			// weaver help generate
 			fmt.Fprintln(os.Stdout, generate.Usage)
+		case n == 2 && command == "graph":
+			// weaver help graph
+			fmt.Fprintln(os.Stdout, graph.Help)
 		case n == 2 && internals[command] != nil:
 			// weaver help <command>
 			fmt.Fprintln(os.Stdout, tool.MainHelp("weaver "+command, internals[command]))
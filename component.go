@@ -15,10 +15,14 @@
 package weaver
 
 import (
+	"context"
 	"net"
+	"reflect"
 	"sync"
 
 	"go.opentelemetry.io/otel/trace"
+	"github.com/ServiceWeaver/weaver/internal/faults"
+	"github.com/ServiceWeaver/weaver/runtime"
 	"github.com/ServiceWeaver/weaver/runtime/codegen"
 )
 
@@ -61,6 +65,27 @@ type Instance interface {
 	// address the proxy is listening on.
 	Listener(name string, options ListenerOptions) (*Listener, error)
 
+	// PacketListener returns a UDP listener with the given name, for services
+	// like DNS servers or metrics ingestion that don't run over TCP. The
+	// address of the listener is picked, and traffic to it is proxied, by the
+	// deployer, as for Listener.
+	PacketListener(name string, options ListenerOptions) (*PacketListener, error)
+
+	// LeaderElection returns a new candidate in the leader election with the
+	// given name. Candidates in elections with the same name compete for the
+	// same leadership across all of the processes of a deployment.
+	LeaderElection(name string, options LeaderElectionOptions) *LeaderElection
+
+	// Mutex returns the lock with the given name. Mutexes with the same name
+	// are the same lock across all of the processes of a deployment.
+	Mutex(name string, options MutexOptions) *Mutex
+
+	// WeaveletID returns the unique id of the weavelet, i.e., the replica of
+	// the process, that hosts this component. It can be used to tell replicas
+	// apart, e.g., in metric labels. The id is the one attached to the
+	// weavelet's system logs.
+	WeaveletID() string
+
 	// rep is for internal use.
 	rep() *component
 }
@@ -83,10 +108,16 @@ type componentStub struct {
 
 // component represents a Service Weaver component and all corresponding metadata.
 type component struct {
-	wlet           *weavelet             // read-only, once initialized
-	info           *codegen.Registration // read-only, once initialized
-	processName    string                // read-only, once initialized
-	colocGroupName string                // read-only, once initialized
+	wlet           *weavelet                  // read-only, once initialized
+	info           *codegen.Registration      // read-only, once initialized
+	processName    string                     // read-only, once initialized
+	colocGroupName string                     // read-only, once initialized
+	settings       *runtime.ComponentSettings // read-only, once initialized
+	faults         []faults.Fault             // read-only, once initialized
+	acl            *acl                       // read-only, once initialized
+	audit          *auditor                   // read-only, once initialized
+	record         *recorder                  // read-only, once initialized
+	singleton      *singleton                 // if not nil, component is a singleton
 
 	implInit sync.Once      // used to initialize impl, logger
 	implErr  error          // non-nil if impl creation fails
@@ -146,8 +177,26 @@ func (i *Implements[T]) setInstance(c *componentImpl) { i.componentImpl = c }
 //	    http.Serve(lis, nil)
 //	}
 type Listener struct {
-	net.Listener        // underlying listener
-	proxyAddr    string // address of proxy that forwards to the listener
+	net.Listener              // underlying listener
+	proxyAddr    string       // address of proxy that forwards to the listener
+	conns        *connTracker // open connections accepted by the listener
+}
+
+// Draining returns a channel that is closed when the process starts shutting
+// down, e.g., because a new version of the application is being rolled out.
+// Handlers of long-lived connections, like WebSockets or server-sent events,
+// should then ask their clients to reconnect, ideally after a random delay,
+// so that the clients migrate gradually to the new version. The process
+// waits for the open connections of the listener to be closed, for at most
+// the drain_timeout of the listener's config, before it shuts down.
+func (l *Listener) Draining() <-chan struct{} {
+	return l.conns.draining
+}
+
+// ActiveConns returns the number of open connections accepted by the
+// listener.
+func (l *Listener) ActiveConns() int {
+	return l.conns.active()
 }
 
 // String returns the address clients should dial to connect to the
@@ -166,16 +215,58 @@ func (l *Listener) ProxyAddr() string {
 	return l.proxyAddr
 }
 
+// A PacketListener is Service Weaver's implementation of a net.PacketConn
+// that receives the UDP packets sent to a named listener. For example,
+//
+//	conn, err := root.PacketListener("dns", weaver.ListenerOptions{LocalAddress: ":5353"})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	buf := make([]byte, 512)
+//	for {
+//	    n, addr, err := conn.ReadFrom(buf)
+//	    ...
+//	    conn.WriteTo(reply, addr)
+//	}
+type PacketListener struct {
+	net.PacketConn        // underlying connection
+	proxyAddr      string // address of proxy that forwards to the listener
+}
+
+// String returns the address clients should send packets to; this will be
+// the proxy address if available, otherwise the <host>:<port> for this
+// listener.
+func (l *PacketListener) String() string {
+	if l.proxyAddr != "" {
+		return l.proxyAddr
+	}
+	return l.LocalAddr().String()
+}
+
+// ProxyAddr returns the address of the proxy that forwards packets to this
+// listener, or returns the empty string if there is no such proxy.
+func (l *PacketListener) ProxyAddr() string {
+	return l.proxyAddr
+}
+
 func (c *componentImpl) rep() *component { return c.component }
 
 // Logger returns a logger that associates its log entries with this component.
 func (c *componentImpl) Logger() Logger { return c.component.logger }
 
+// WeaveletID returns the id of the weavelet that hosts this component.
+func (c *componentImpl) WeaveletID() string { return c.component.wlet.info.Id }
+
 // Listener returns a network listener with the given name.
 func (c *componentImpl) Listener(name string, options ListenerOptions) (*Listener, error) {
 	return c.component.wlet.getListener(name, options)
 }
 
+// PacketListener returns a UDP listener with the given name.
+func (c *componentImpl) PacketListener(name string, options ListenerOptions) (*PacketListener, error) {
+	return c.component.wlet.getPacketListener(name, options)
+}
+
 // ListenerOptions specifies optional configuration for a listener.
 type ListenerOptions struct {
 	// LocalAddress will be used as the address where the listener is
@@ -256,6 +347,45 @@ type ListenerOptions struct {
 // correctness. Only use routing to increase performance in the common case.
 type WithRouter[T any] struct{}
 
+// RegisterRouter registers router under the provided name as an alternative
+// router for the component with interface T. router must have every routing
+// method of the router passed to [WithRouter], with the same signatures. The
+// default router, for example, could route calls by user id, and an
+// alternative router by tenant id:
+//
+//	type tenantRouter struct{}
+//	func (tenantRouter) Get(ctx context.Context, key string) string { return tenantOf(key) }
+//	func (tenantRouter) Put(ctx context.Context, key, value string) string { return tenantOf(key) }
+//
+//	func init() {
+//	    weaver.RegisterRouter[Cache]("tenant", tenantRouter{})
+//	}
+//
+// A registered router is used once it is installed, either with SetRouter or
+// with the "router" key in the component's config section. Routers should be
+// registered in init functions, so that they are available when the config is
+// applied.
+func RegisterRouter[T any](name string, router any) {
+	var zero T
+	if err := codegen.RegisterRouter(reflect.TypeOf(&zero).Elem(), name, router); err != nil {
+		panic(err)
+	}
+}
+
+// SetRouter replaces the router used by the calling process to route calls to
+// the component with interface T with the router registered under the
+// provided name. If name is empty, the component's default router is
+// restored. SetRouter lets an application change how calls are routed
+// without being redeployed, e.g., from an admin endpoint.
+//
+// Note that SetRouter only affects the calling process. While processes
+// disagree on the router, calls with the same routing key may be routed to
+// different replicas, which is allowed since routing is best-effort.
+func SetRouter[T any](name string) error {
+	var zero T
+	return codegen.SetRouter(reflect.TypeOf(&zero).Elem(), name)
+}
+
 // AutoMarshal is a type that can be embedded within a struct to indicate that
 // "weaver generate" should generate serialization methods for the struct.
 //
@@ -318,8 +448,16 @@ func (AutoMarshal) WeaverUnmarshal(dec *codegen.Decoder) {}
 //
 //	["example.com/mypkg/MyComponent"]
 //	Size = 1000
+//
+// The config of a running component can be updated by pushing a new config
+// file to the deployment (e.g., with "weaver multi reload"). Components that
+// want to react to such updates can use [WithConfig.Watch].
 type WithConfig[T any] struct {
 	config T
+
+	mu       sync.Mutex
+	latest   *T       // latest updated config, or nil if never updated
+	watchers []chan T // see Watch
 }
 
 // Config returns the configuration information for the component that
@@ -330,6 +468,54 @@ type WithConfig[T any] struct {
 //
 // Any fields in the application config file that are not present in T
 // will be flagged as an error at application startup.
+//
+// If the config is updated while the component is running, Config returns
+// the latest config. The returned value should not be modified.
 func (wc *WithConfig[T]) Config() *T {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	if wc.latest != nil {
+		return wc.latest
+	}
 	return &wc.config
 }
+
+// Watch returns a channel that receives the config of the component every
+// time it is updated. If several updates happen before the channel is read,
+// only the latest config is received. The channel is closed when ctx is
+// done.
+func (wc *WithConfig[T]) Watch(ctx context.Context) <-chan T {
+	ch := make(chan T, 1)
+	wc.mu.Lock()
+	wc.watchers = append(wc.watchers, ch)
+	wc.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		wc.mu.Lock()
+		defer wc.mu.Unlock()
+		for i, w := range wc.watchers {
+			if w == ch {
+				wc.watchers = append(wc.watchers[:i], wc.watchers[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+// setConfig replaces the config of the component with config, which must be
+// a *T, and notifies the watchers.
+func (wc *WithConfig[T]) setConfig(config any) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.latest = config.(*T)
+	for _, ch := range wc.watchers {
+		// Drop the stale config, if any, so that the send doesn't block.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- *wc.latest
+	}
+}
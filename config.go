@@ -0,0 +1,84 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+)
+
+// getSections returns the latest config sections of the application.
+func (d *weavelet) getSections() map[string]string {
+	d.configMu.Lock()
+	defer d.configMu.Unlock()
+	return d.sections
+}
+
+// updateConfig applies updated config sections to the local components. The
+// config of every component whose section changed is parsed and validated
+// before any of them is applied, so that an invalid update leaves all
+// components with their current config.
+func (d *weavelet) updateConfig(sections map[string]string) error {
+	d.configMu.Lock()
+	defer d.configMu.Unlock()
+	if err := runtime.CheckConfigUpdate(d.sections, sections); err != nil {
+		return err
+	}
+
+	d.shutdownMu.Lock()
+	initialized := append([]*component(nil), d.initialized...)
+	d.shutdownMu.Unlock()
+
+	type update struct {
+		c      *component
+		obj    interface{ setConfig(any) }
+		config any
+	}
+	var updates []update
+	for _, c := range initialized {
+		if c.info.ConfigFn == nil || d.sections[c.info.Name] == sections[c.info.Name] {
+			continue
+		}
+		if c.settings.Actors.Enabled {
+			// Actors read the latest config when they are activated.
+			continue
+		}
+		obj, ok := c.impl.impl.(interface{ setConfig(any) })
+		if !ok {
+			return fmt.Errorf("component %q: type %T does not embed weaver.WithConfig", c.info.Name, c.impl.impl)
+		}
+
+		// Parse into a fresh config, rather than the current one, so that
+		// the config returned by earlier calls to Config is left untouched.
+		current := c.info.ConfigFn(c.impl.impl)
+		config := reflect.New(reflect.TypeOf(current).Elem()).Interface()
+		if err := runtime.ParseComponentConfigSection(c.info.Name, sections, config); err != nil {
+			return err
+		}
+		if err := resolveSecrets(d.ctx, config); err != nil {
+			return fmt.Errorf("component %q config: %w", c.info.Name, err)
+		}
+		updates = append(updates, update{c, obj, config})
+	}
+
+	d.sections = sections
+	for _, u := range updates {
+		u.obj.setConfig(u.config)
+		d.env.SystemLogger().Info("Updated config", "component", u.c.info.Name)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"testing"
+)
+
+type watchedConfig struct {
+	Size int
+}
+
+func TestWithConfigWatch(t *testing.T) {
+	var wc WithConfig[watchedConfig]
+	wc.config.Size = 1
+	if got := wc.Config().Size; got != 1 {
+		t.Fatalf("Config().Size: got %d, want 1", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := wc.Watch(ctx)
+	old := wc.Config()
+
+	// Only the latest update is received by a slow watcher.
+	wc.setConfig(&watchedConfig{Size: 2})
+	wc.setConfig(&watchedConfig{Size: 3})
+	if got := (<-ch).Size; got != 3 {
+		t.Fatalf("Watch: got size %d, want 3", got)
+	}
+	if got := wc.Config().Size; got != 3 {
+		t.Fatalf("Config().Size: got %d, want 3", got)
+	}
+	if old.Size != 1 {
+		t.Fatalf("earlier Config().Size changed to %d", old.Size)
+	}
+
+	// The channel is closed when the context is cancelled.
+	cancel()
+	for range ch {
+	}
+	wc.setConfig(&watchedConfig{Size: 4})
+}
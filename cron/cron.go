@@ -0,0 +1,95 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cron runs jobs on a schedule, with at most one replica executing
+// each tick.
+//
+// A component typically starts its jobs in Init:
+//
+//	func (r *reporter) Init(ctx context.Context) error {
+//		go cron.Run(ctx, r, "daily-report", "0 6 * * *", r.report)
+//		return nil
+//	}
+//
+// Every replica of the component runs the job's loop as a candidate in a
+// leader election named after the job (see weaver.LeaderElection), whose
+// leases are kept by the deployer, and only the leader executes the job. A
+// newly elected leader only executes the ticks that follow its election, so
+// no tick is executed twice, provided that the clocks of the machines agree
+// to within the time it takes to elect a new leader. Ticks are skipped while
+// no replica leads, e.g., for up to a lease (15 seconds) after the leader
+// crashes, and a tick is lost if the leader crashes while executing it.
+package cron
+
+import (
+	"context"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+// Run executes fn on the provided schedule until ctx is canceled, returning
+// ctx.Err(). At every tick, fn is called with the time of the tick, on only
+// the replica that leads the election of the job, among the callers of Run
+// with the same job name in the deployment. The context passed to fn is done
+// when the replica stops leading. Run returns an error immediately if the
+// schedule is invalid. The following schedules are accepted:
+//
+//   - "@every <duration>", e.g., "@every 30s". Ticks are aligned as by
+//     time.Time.Truncate, so that all replicas agree on them.
+//   - "@hourly", "@daily", "@weekly", "@monthly", and "@yearly".
+//   - A standard five-field cron expression "minute hour day-of-month month
+//     day-of-week", where every field is "*" or a comma-separated list of
+//     values, ranges ("1-5"), and steps ("*/15", "0-30/10"). As in cron, if
+//     both the day of month and the day of week are restricted, a day
+//     matches if either of them matches. Cron expressions are interpreted
+//     in UTC.
+//
+// Ticks are not queued: if fn is still running at the next tick, that tick is
+// skipped.
+func Run(ctx context.Context, instance weaver.Instance, job, spec string, fn func(context.Context, time.Time)) error {
+	sched, err := parse(spec)
+	if err != nil {
+		return err
+	}
+	election := instance.LeaderElection("cron/"+job, weaver.LeaderElectionOptions{})
+	for {
+		leading, resign, err := election.Lead(ctx)
+		if err != nil {
+			return err
+		}
+		lead(leading, sched, fn)
+		resign()
+	}
+}
+
+// lead executes fn at the ticks of sched until leading is done.
+func lead(leading context.Context, sched schedule, fn func(context.Context, time.Time)) {
+	for {
+		tick := sched.next(time.Now())
+		if tick.IsZero() {
+			// The schedule never fires (e.g., "0 0 30 2 *").
+			<-leading.Done()
+			return
+		}
+		timer := time.NewTimer(time.Until(tick))
+		select {
+		case <-leading.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		fn(leading, tick)
+	}
+}
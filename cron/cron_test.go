@@ -0,0 +1,119 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/weavertest"
+)
+
+func TestNext(t *testing.T) {
+	// 2023-01-02 is a Monday.
+	start := time.Date(2023, 1, 2, 10, 17, 30, 0, time.UTC)
+	for _, test := range []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 1m", time.Date(2023, 1, 2, 10, 18, 0, 0, time.UTC)},
+		{"@every 15m", time.Date(2023, 1, 2, 10, 30, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2023, 1, 2, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2023, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2023, 1, 8, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2023, 1, 2, 10, 20, 0, 0, time.UTC)},
+		{"5 9-17 * * *", time.Date(2023, 1, 2, 11, 5, 0, 0, time.UTC)},
+		{"0 6 * * 5", time.Date(2023, 1, 6, 6, 0, 0, 0, time.UTC)},
+		{"0 6 15 * 5", time.Date(2023, 1, 6, 6, 0, 0, 0, time.UTC)}, // day of month or week
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		t.Run(test.spec, func(t *testing.T) {
+			s, err := parse(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.next(start); !got.Equal(test.want) {
+				t.Fatalf("next(%v): got %v, want %v", start, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"@every",
+		"@every -1s",
+		"@sometimes",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := parse(spec); err == nil {
+				t.Fatalf("parse(%q): unexpected success", spec)
+			}
+		})
+	}
+}
+
+func TestOneReplicaPerTick(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: true})
+
+	// Run the same job on three "replicas".
+	var mu sync.Mutex
+	runs := map[time.Time]int{}
+	replicas := map[int]bool{} // replicas that executed the job
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Run(ctx, root, "job", "@every 10ms", func(_ context.Context, tick time.Time) {
+				mu.Lock()
+				defer mu.Unlock()
+				runs[tick]++
+				replicas[i] = true
+			})
+		}()
+	}
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	if len(runs) == 0 {
+		t.Fatal("job never ran")
+	}
+	if len(replicas) != 1 {
+		t.Errorf("job ran on %d replicas, want only the leader", len(replicas))
+	}
+	for tick, n := range runs {
+		if n != 1 {
+			t.Errorf("tick %v: ran %d times, want 1", tick, n)
+		}
+	}
+}
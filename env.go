@@ -70,6 +70,10 @@ type env interface {
 	// ExportListener exports a listener.
 	ExportListener(ctx context.Context, lis *protos.Listener, opts ListenerOptions) (*protos.ExportListenerReply, error)
 
+	// ElectLeader acquires, renews, or releases the lease on the leadership
+	// of an election.
+	ElectLeader(ctx context.Context, req *protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error)
+
 	// CreateLogSaver creates and returns a function that saves log entries
 	// to the environment.
 	CreateLogSaver(ctx context.Context, component string) func(entry *protos.LogEntry)
@@ -81,6 +85,11 @@ type env interface {
 	// exporting trace spans. A nil exporter value means that no traces
 	// should be exported.
 	CreateTraceExporter() (sdktrace.SpanExporter, error)
+
+	// OnConfigUpdate registers a function that is called with the config
+	// sections whenever the environment pushes an updated config. The error
+	// returned by the function is reported back to the environment.
+	OnConfigUpdate(func(sections map[string]string) error)
 }
 
 // getEnv returns the env to use for this weavelet.
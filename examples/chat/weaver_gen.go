@@ -25,6 +25,7 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return imageScaler_server_stub{impl: impl.(ImageScaler), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Scale": {"img", "maxWidth", "maxHeight"}},
 	})
 	codegen.Register(codegen.Registration{
 		Name:  "github.com/ServiceWeaver/weaver/examples/chat/LocalCache",
@@ -39,6 +40,7 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return localCache_server_stub{impl: impl.(LocalCache), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Get": {"key"}, "Put": {"key", "val"}},
 	})
 	codegen.Register(codegen.Registration{
 		Name:     "github.com/ServiceWeaver/weaver/examples/chat/SQLStore",
@@ -54,7 +56,9 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return sQLStore_server_stub{impl: impl.(SQLStore), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"CreateThread": {"creator", "when", "others", "text", "image"}, "CreatePost": {"creator", "when", "thread", "text"}, "GetFeed": {"user"}, "GetImage": {"_", "image"}},
 	})
+	codegen.RegisterRefs("main", "github.com/ServiceWeaver/weaver/examples/chat/ImageScaler", "github.com/ServiceWeaver/weaver/examples/chat/LocalCache", "github.com/ServiceWeaver/weaver/examples/chat/SQLStore")
 }
 
 // Local stub implementations.
@@ -203,7 +207,8 @@ type imageScaler_client_stub struct {
 func (s imageScaler_client_stub) Scale(ctx context.Context, a0 []byte, a1 int, a2 int) (r0 []byte, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.scaleMetrics.Count.Add(1)
+	methodMetrics := s.scaleMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -221,11 +226,11 @@ func (s imageScaler_client_stub) Scale(ctx context.Context, a0 []byte, a1 int, a
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.scaleMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.scaleMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
@@ -233,8 +238,8 @@ func (s imageScaler_client_stub) Scale(ctx context.Context, a0 []byte, a1 int, a
 	size += (4 + (len(a0) * 1))
 	size += 8
 	size += 8
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	serviceweaver_enc_slice_byte_87461245(enc, a0)
@@ -243,13 +248,13 @@ func (s imageScaler_client_stub) Scale(ctx context.Context, a0 []byte, a1 int, a
 	var shardKey uint64
 
 	// Call the remote method.
-	s.scaleMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.scaleMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -267,7 +272,8 @@ type localCache_client_stub struct {
 func (s localCache_client_stub) Get(ctx context.Context, a0 string) (r0 string, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getMetrics.Count.Add(1)
+	methodMetrics := s.getMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -285,31 +291,31 @@ func (s localCache_client_stub) Get(ctx context.Context, a0 string) (r0 string,
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.getMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.getMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -321,7 +327,8 @@ func (s localCache_client_stub) Get(ctx context.Context, a0 string) (r0 string,
 func (s localCache_client_stub) Put(ctx context.Context, a0 string, a1 string) (err error) {
 	// Update metrics.
 	start := time.Now()
-	s.putMetrics.Count.Add(1)
+	methodMetrics := s.putMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -339,19 +346,19 @@ func (s localCache_client_stub) Put(ctx context.Context, a0 string, a1 string) (
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.putMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.putMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
 	size += (4 + len(a1))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
@@ -359,13 +366,13 @@ func (s localCache_client_stub) Put(ctx context.Context, a0 string, a1 string) (
 	var shardKey uint64
 
 	// Call the remote method.
-	s.putMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 1, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.putMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -384,7 +391,8 @@ type sQLStore_client_stub struct {
 func (s sQLStore_client_stub) CreateThread(ctx context.Context, a0 string, a1 time.Time, a2 []string, a3 string, a4 []byte) (r0 ThreadID, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.createThreadMetrics.Count.Add(1)
+	methodMetrics := s.createThreadMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -402,30 +410,31 @@ func (s sQLStore_client_stub) CreateThread(ctx context.Context, a0 string, a1 ti
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.createThreadMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.createThreadMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Encode arguments.
-	enc := codegen.NewEncoder()
+	enc := codegen.NewPooledEncoder(0)
+	defer enc.Release()
 	enc.String(a0)
-	enc.EncodeBinaryMarshaler(&a1)
+	enc.Time(a1)
 	serviceweaver_enc_slice_string_4af10117(enc, a2)
 	enc.String(a3)
 	serviceweaver_enc_slice_byte_87461245(enc, a4)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.createThreadMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 1, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.createThreadMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -437,7 +446,8 @@ func (s sQLStore_client_stub) CreateThread(ctx context.Context, a0 string, a1 ti
 func (s sQLStore_client_stub) CreatePost(ctx context.Context, a0 string, a1 time.Time, a2 ThreadID, a3 string) (err error) {
 	// Update metrics.
 	start := time.Now()
-	s.createPostMetrics.Count.Add(1)
+	methodMetrics := s.createPostMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -455,29 +465,37 @@ func (s sQLStore_client_stub) CreatePost(ctx context.Context, a0 string, a1 time
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.createPostMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.createPostMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += 16
+	size += 8
+	size += (4 + len(a3))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
 	// Encode arguments.
-	enc := codegen.NewEncoder()
 	enc.String(a0)
-	enc.EncodeBinaryMarshaler(&a1)
+	enc.Time(a1)
 	enc.Int64((int64)(a2))
 	enc.String(a3)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.createPostMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.createPostMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -488,7 +506,8 @@ func (s sQLStore_client_stub) CreatePost(ctx context.Context, a0 string, a1 time
 func (s sQLStore_client_stub) GetFeed(ctx context.Context, a0 string) (r0 []Thread, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getFeedMetrics.Count.Add(1)
+	methodMetrics := s.getFeedMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -506,31 +525,31 @@ func (s sQLStore_client_stub) GetFeed(ctx context.Context, a0 string) (r0 []Thre
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getFeedMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getFeedMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.getFeedMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 2, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.getFeedMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -542,7 +561,8 @@ func (s sQLStore_client_stub) GetFeed(ctx context.Context, a0 string) (r0 []Thre
 func (s sQLStore_client_stub) GetImage(ctx context.Context, a0 string, a1 ImageID) (r0 []byte, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getImageMetrics.Count.Add(1)
+	methodMetrics := s.getImageMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -560,19 +580,19 @@ func (s sQLStore_client_stub) GetImage(ctx context.Context, a0 string, a1 ImageI
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getImageMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getImageMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
 	size += 8
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
@@ -580,13 +600,13 @@ func (s sQLStore_client_stub) GetImage(ctx context.Context, a0 string, a1 ImageI
 	var shardKey uint64
 
 	// Call the remote method.
-	s.getImageMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 3, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.getImageMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -636,6 +656,9 @@ func (s imageScaler_server_stub) scale(ctx context.Context, args []byte) (res []
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += (4 + (len(r0) * 1))
+	enc.Reset(size)
 	serviceweaver_enc_slice_byte_87461245(enc, r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
@@ -678,6 +701,9 @@ func (s localCache_server_stub) get(ctx context.Context, args []byte) (res []byt
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += (4 + len(r0))
+	enc.Reset(size)
 	enc.String(r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
@@ -743,7 +769,7 @@ func (s sQLStore_server_stub) createThread(ctx context.Context, args []byte) (re
 	var a0 string
 	a0 = dec.String()
 	var a1 time.Time
-	dec.DecodeBinaryUnmarshaler(&a1)
+	a1 = dec.Time()
 	var a2 []string
 	a2 = serviceweaver_dec_slice_string_4af10117(dec)
 	var a3 string
@@ -758,6 +784,9 @@ func (s sQLStore_server_stub) createThread(ctx context.Context, args []byte) (re
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += 8
+	enc.Reset(size)
 	enc.Int64((int64)(r0))
 	enc.Error(appErr)
 	return enc.Data(), nil
@@ -776,7 +805,7 @@ func (s sQLStore_server_stub) createPost(ctx context.Context, args []byte) (res
 	var a0 string
 	a0 = dec.String()
 	var a1 time.Time
-	dec.DecodeBinaryUnmarshaler(&a1)
+	a1 = dec.Time()
 	var a2 ThreadID
 	*(*int64)(&a2) = dec.Int64()
 	var a3 string
@@ -840,6 +869,9 @@ func (s sQLStore_server_stub) getImage(ctx context.Context, args []byte) (res []
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += (4 + (len(r0) * 1))
+	enc.Reset(size)
 	serviceweaver_enc_slice_byte_87461245(enc, r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
@@ -855,7 +887,7 @@ func (x *Post) WeaverMarshal(enc *codegen.Encoder) {
 	}
 	enc.Int64((int64)(x.ID))
 	enc.String(x.Creator)
-	enc.EncodeBinaryMarshaler(&x.When)
+	enc.Time(x.When)
 	enc.String(x.Text)
 	enc.Int64((int64)(x.ImageID))
 }
@@ -866,7 +898,7 @@ func (x *Post) WeaverUnmarshal(dec *codegen.Decoder) {
 	}
 	*(*int64)(&x.ID) = dec.Int64()
 	x.Creator = dec.String()
-	dec.DecodeBinaryUnmarshaler(&x.When)
+	x.When = dec.Time()
 	x.Text = dec.String()
 	*(*int64)(&x.ImageID) = dec.Int64()
 }
@@ -912,6 +944,11 @@ func serviceweaver_dec_slice_Post_29a9ee83(dec *codegen.Decoder) []Post {
 	return res
 }
 
+func init() {
+	codegen.RegisterSerializable[Post]()
+	codegen.RegisterSerializable[Thread]()
+}
+
 // Encoding/decoding implementations.
 
 func serviceweaver_enc_slice_string_4af10117(enc *codegen.Encoder, arg []string) {
@@ -938,26 +975,11 @@ func serviceweaver_dec_slice_string_4af10117(dec *codegen.Decoder) []string {
 }
 
 func serviceweaver_enc_slice_byte_87461245(enc *codegen.Encoder, arg []byte) {
-	if arg == nil {
-		enc.Len(-1)
-		return
-	}
-	enc.Len(len(arg))
-	for i := 0; i < len(arg); i++ {
-		enc.Byte(arg[i])
-	}
+	enc.Bytes(arg)
 }
 
 func serviceweaver_dec_slice_byte_87461245(dec *codegen.Decoder) []byte {
-	n := dec.Len()
-	if n == -1 {
-		return nil
-	}
-	res := make([]byte, n)
-	for i := 0; i < n; i++ {
-		res[i] = dec.Byte()
-	}
-	return res
+	return dec.Bytes()
 }
 
 func serviceweaver_enc_slice_Thread_511e1469(enc *codegen.Encoder, arg []Thread) {
@@ -22,6 +22,7 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return even_server_stub{impl: impl.(Even), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Do": {""}},
 	})
 	codegen.Register(codegen.Registration{
 		Name:        "github.com/ServiceWeaver/weaver/examples/collatz/Odd",
@@ -34,7 +35,9 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return odd_server_stub{impl: impl.(Odd), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Do": {""}},
 	})
+	codegen.RegisterRefs("main", "github.com/ServiceWeaver/weaver/examples/collatz/Even", "github.com/ServiceWeaver/weaver/examples/collatz/Odd")
 }
 
 // Local stub implementations.
@@ -93,7 +96,8 @@ type even_client_stub struct {
 func (s even_client_stub) Do(ctx context.Context, a0 int) (r0 int, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.doMetrics.Count.Add(1)
+	methodMetrics := s.doMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -111,31 +115,31 @@ func (s even_client_stub) Do(ctx context.Context, a0 int) (r0 int, err error) {
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.doMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.doMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += 8
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.Int(a0)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.doMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.doMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -152,7 +156,8 @@ type odd_client_stub struct {
 func (s odd_client_stub) Do(ctx context.Context, a0 int) (r0 int, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.doMetrics.Count.Add(1)
+	methodMetrics := s.doMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -170,31 +175,31 @@ func (s odd_client_stub) Do(ctx context.Context, a0 int) (r0 int, err error) {
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.doMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.doMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += 8
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.Int(a0)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.doMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.doMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -240,6 +245,9 @@ func (s even_server_stub) do(ctx context.Context, args []byte) (res []byte, err
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += 8
+	enc.Reset(size)
 	enc.Int(r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
@@ -280,6 +288,9 @@ func (s odd_server_stub) do(ctx context.Context, args []byte) (res []byte, err e
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += 8
+	enc.Reset(size)
 	enc.Int(r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
@@ -16,6 +16,7 @@ func init() {
 		Iface:  reflect.TypeOf((*Factorer)(nil)).Elem(),
 		New:    func() any { return &factorer{} },
 		Routed: true,
+		Router: reflect.TypeOf((*factorer_router)(nil)).Elem(),
 		LocalStubFn: func(impl any, tracer trace.Tracer) any {
 			return factorer_local_stub{impl: impl.(Factorer), tracer: tracer}
 		},
@@ -25,7 +26,9 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return factorer_server_stub{impl: impl.(Factorer), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Factors": {""}},
 	})
+	codegen.RegisterRefs("main", "github.com/ServiceWeaver/weaver/examples/factors/Factorer")
 }
 
 // Local stub implementations.
@@ -62,7 +65,8 @@ type factorer_client_stub struct {
 func (s factorer_client_stub) Factors(ctx context.Context, a0 int) (r0 []int, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.factorsMetrics.Count.Add(1)
+	methodMetrics := s.factorsMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -80,34 +84,33 @@ func (s factorer_client_stub) Factors(ctx context.Context, a0 int) (r0 []int, er
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.factorsMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.factorsMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += 8
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.Int(a0)
 
 	// Set the shardKey.
-	var r router
-	shardKey := _hashFactorer(r.Factors(ctx, a0))
+	shardKey := _hashFactorer(_routerFactorer().Factors(ctx, a0))
 
 	// Call the remote method.
-	s.factorsMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.factorsMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -145,8 +148,7 @@ func (s factorer_server_stub) factors(ctx context.Context, args []byte) (res []b
 	dec := codegen.NewDecoder(args)
 	var a0 int
 	a0 = dec.Int()
-	var r router
-	s.addLoad(_hashFactorer(r.Factors(ctx, a0)), 1.0)
+	s.addLoad(_hashFactorer(_routerFactorer().Factors(ctx, a0)), 1.0)
 
 	// TODO(rgrandl): The deferred function above will recover from panics in the
 	// user code: fix this.
@@ -155,6 +157,9 @@ func (s factorer_server_stub) factors(ctx context.Context, args []byte) (res []b
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += (4 + (len(r0) * 8))
+	enc.Reset(size)
 	serviceweaver_enc_slice_int_7c8c8866(enc, r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
@@ -162,6 +167,19 @@ func (s factorer_server_stub) factors(ctx context.Context, args []byte) (res []b
 
 // Router methods.
 
+// factorer_router holds the routing methods of the Factorer component.
+type factorer_router interface {
+	Factors(ctx context.Context, a0 int) int
+}
+
+// _routerFactorer returns the router installed for the Factorer component.
+func _routerFactorer() factorer_router {
+	if r, ok := codegen.Router("github.com/ServiceWeaver/weaver/examples/factors/Factorer").(factorer_router); ok {
+		return r
+	}
+	return new(router)
+}
+
 // _hashFactorer returns a 64 bit hash of the provided value.
 func _hashFactorer(r int) uint64 {
 	var h codegen.Hasher
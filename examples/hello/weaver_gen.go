@@ -24,7 +24,9 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return reverser_server_stub{impl: impl.(Reverser), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Reverse": {""}},
 	})
+	codegen.RegisterRefs("main", "github.com/ServiceWeaver/weaver/examples/hello/Reverser")
 }
 
 // Local stub implementations.
@@ -61,7 +63,8 @@ type reverser_client_stub struct {
 func (s reverser_client_stub) Reverse(ctx context.Context, a0 string) (r0 string, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.reverseMetrics.Count.Add(1)
+	methodMetrics := s.reverseMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -79,31 +82,31 @@ func (s reverser_client_stub) Reverse(ctx context.Context, a0 string) (r0 string
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.reverseMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.reverseMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.reverseMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.reverseMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -149,6 +152,9 @@ func (s reverser_server_stub) reverse(ctx context.Context, args []byte) (res []b
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += (4 + len(r0))
+	enc.Reset(size)
 	enc.String(r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
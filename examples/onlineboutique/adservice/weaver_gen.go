@@ -23,6 +23,7 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return t_server_stub{impl: impl.(T), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"GetAds": {"keywords"}},
 	})
 }
 
@@ -60,7 +61,8 @@ type t_client_stub struct {
 func (s t_client_stub) GetAds(ctx context.Context, a0 []string) (r0 []Ad, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getAdsMetrics.Count.Add(1)
+	methodMetrics := s.getAdsMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -78,26 +80,27 @@ func (s t_client_stub) GetAds(ctx context.Context, a0 []string) (r0 []Ad, err er
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getAdsMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getAdsMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Encode arguments.
-	enc := codegen.NewEncoder()
+	enc := codegen.NewPooledEncoder(0)
+	defer enc.Release()
 	serviceweaver_enc_slice_string_4af10117(enc, a0)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.getAdsMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.getAdsMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -168,6 +171,10 @@ func (x *Ad) WeaverUnmarshal(dec *codegen.Decoder) {
 	x.Text = dec.String()
 }
 
+func init() {
+	codegen.RegisterSerializable[Ad]()
+}
+
 // Encoding/decoding implementations.
 
 func serviceweaver_enc_slice_string_4af10117(enc *codegen.Encoder, arg []string) {
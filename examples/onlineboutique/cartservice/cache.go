@@ -16,63 +16,452 @@ package cartservice
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/metrics"
 	lru "github.com/hashicorp/golang-lru/v2"
 )
 
 const cacheSize = 1 << 20 // 1M entries
 
+// cacheLabels are the labels attached to every cart cache metric.
+type cacheLabels struct {
+	// Replica uniquely identifies the cache replica that emitted the metric.
+	// See cartCacheImpl.replica.
+	Replica string
+}
+
+var (
+	cacheReads   = metrics.NewCounterMap[cacheLabels]("cartservice_cache_reads", "Number of cart cache reads.")
+	cacheMisses  = metrics.NewCounterMap[cacheLabels]("cartservice_cache_misses", "Number of cart cache misses.")
+	cacheWrites  = metrics.NewCounterMap[cacheLabels]("cartservice_cache_writes", "Number of cart cache writes.")
+	cacheEntries = metrics.NewGaugeMap[cacheLabels]("cartservice_cache_entries", "Number of cart cache entries.")
+)
+
 type errNotFound struct{}
 
 var _ error = errNotFound{}
 
 func (e errNotFound) Error() string { return "not found" }
 
-// TODO(spetrovic): Allow the cache struct to reside in a different package.
+// errVersionExpired is returned by GetChanges when the provided version token
+// is unknown, e.g., because it is older than the retained history. Callers
+// should fall back to reading the entire cart.
+type errVersionExpired struct{}
+
+var _ error = errVersionExpired{}
+
+func (e errVersionExpired) Error() string { return "version expired" }
 
+// cartCache is a cache of carts, keyed by user id. Unlike the general-purpose
+// github.com/ServiceWeaver/weaver/cache component, it tracks cart metadata and
+// version history alongside the items.
 type cartCache interface {
 	Add(context.Context, string, []CartItem) error
 	Get(context.Context, string) ([]CartItem, error)
+	GetWithMetadata(context.Context, string) ([]CartItem, CartMeta, error)
+	Contains(context.Context, string) (bool, error)
 	Remove(context.Context, string) (bool, error)
+	RemoveIfEmpty(context.Context, string) (bool, error)
+	AddItem(context.Context, string, string, int32) error
+	RemoveItem(context.Context, string, string) (bool, error)
+	SetCartMeta(context.Context, string, CartMeta) error
+	GetCartMeta(context.Context, string) (CartMeta, error)
+	GetVersioned(context.Context, string) ([]CartItem, string, error)
+	GetChanges(context.Context, string, string) ([]CartItem, []CartItem, []CartItem, string, error)
+}
+
+// cacheConfig configures the cart cache.
+type cacheConfig struct {
+	// If true, Get returns an empty cart and a nil error when the key is
+	// absent, instead of errNotFound. This simplifies callers that treat a
+	// missing cart as an empty one, at the cost of making a miss
+	// indistinguishable from a cart that is present but empty. Callers that
+	// need to tell the two apart should use Contains.
+	//
+	// By default, a miss is reported explicitly via errNotFound.
+	MissReturnsEmpty bool `toml:"cache_miss_returns_empty"`
+
+	// The number of past versions of every cart retained in the cache, for
+	// the purpose of computing diffs with GetChanges. A version older than
+	// the last HistoryDepth versions of a cart can no longer be diffed
+	// against. The history of a cart is discarded when the cart is removed.
+	//
+	// Every retained version holds a copy of the cart's items, so the memory
+	// used by a cart grows linearly with HistoryDepth. If zero, defaults to
+	// defaultHistoryDepth.
+	HistoryDepth int `toml:"cache_history_depth"`
+}
+
+// defaultHistoryDepth is the default value of cacheConfig.HistoryDepth.
+const defaultHistoryDepth = 8
+
+func (cfg *cacheConfig) Validate() error {
+	if cfg.HistoryDepth < 0 {
+		return fmt.Errorf("invalid negative cache_history_depth %d", cfg.HistoryDepth)
+	}
+	return nil
 }
 
 type cartCacheImpl struct {
 	weaver.Implements[cartCache]
 	weaver.WithRouter[cartCacheRouter]
+	weaver.WithConfig[cacheConfig]
+
+	// replica uniquely identifies this replica of the cache. It is the id of
+	// the weavelet that hosts the replica, so it remains unchanged for the
+	// replica's lifetime and matches the weavelet id in the runtime's own
+	// logs. It is attached as the "replica" label to every
+	// cache metric and as the "replica" attribute to every cache log entry,
+	// which allows operators to attribute hot keys or error spikes to a
+	// specific replica.
+	replica string
+	logger  weaver.Logger
+	labels  cacheLabels
+
+	// mu serializes mutations of the cache, so that compound operations like
+	// RemoveIfEmpty are atomic with respect to Add and Remove.
+	mu      sync.Mutex
+	cache   *lru.Cache[string, cartEntry]
+	version uint64 // last assigned cart version; guarded by mu
+}
+
+// cartEntry is the value stored in the cache for a cart. The cart's metadata
+// is stored alongside its items, so that the two share the same lifetime. An
+// entry is kept while it has either items or metadata.
+type cartEntry struct {
+	items []CartItem
+	meta  CartMeta
 
-	cache *lru.Cache[string, []CartItem]
+	// history holds the most recent versions of the cart's items, oldest
+	// first. The last element is the current version.
+	history []cartVersion
+}
+
+// empty returns whether the entry has neither items nor metadata, in which
+// case removing it from the cache loses nothing.
+func (e cartEntry) empty() bool {
+	return len(e.items) == 0 && e.meta == CartMeta{}
+}
+
+// cartVersion is a version of a cart's items.
+type cartVersion struct {
+	version uint64
+	items   []CartItem
 }
 
 func (c *cartCacheImpl) Init(context.Context) error {
-	cache, err := lru.New[string, []CartItem](cacheSize)
+	c.replica = c.WeaveletID()
+	c.logger = c.Logger().With("replica", c.replica)
+	c.labels = cacheLabels{Replica: c.replica}
+	cache, err := lru.New[string, cartEntry](cacheSize)
+	if err != nil {
+		return err
+	}
 	c.cache = cache
-	return err
+	c.logger.Info("cart cache started", "size", cacheSize)
+	return nil
 }
 
-// Add adds the given (key, val) pair to the cache.
+// Add adds the given (key, val) pair to the cache. If the key is already
+// present, its items are replaced but its metadata is preserved.
 func (c *cartCacheImpl) Add(_ context.Context, key string, val []CartItem) error {
-	c.cache.Add(key, val)
+	cacheWrites.Get(c.labels).Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, _ := c.cache.Peek(key)
+	entry.items = val
+	c.record(&entry)
+	c.cache.Add(key, entry)
+	cacheEntries.Get(c.labels).Set(float64(c.cache.Len()))
 	return nil
 }
 
-// Get returns the value associated with the given key in the cache, or
-// ErrNotFound if there is no associated value.
+// Get returns the value associated with the given key in the cache. If there
+// is no associated value, Get returns errNotFound, or an empty cart if the
+// cache is configured with cache_miss_returns_empty.
 func (c *cartCacheImpl) Get(_ context.Context, key string) ([]CartItem, error) {
-	val, ok := c.cache.Get(key)
+	cacheReads.Get(c.labels).Add(1)
+	entry, ok := c.cache.Get(key)
 	if !ok {
+		cacheMisses.Get(c.labels).Add(1)
+		if c.Config().MissReturnsEmpty {
+			return []CartItem{}, nil
+		}
 		return nil, errNotFound{}
 	}
-	return val, nil
+	return entry.items, nil
+}
+
+// GetWithMetadata is like Get, but it also returns the metadata of the cart.
+func (c *cartCacheImpl) GetWithMetadata(_ context.Context, key string) ([]CartItem, CartMeta, error) {
+	cacheReads.Get(c.labels).Add(1)
+	entry, ok := c.cache.Get(key)
+	if !ok {
+		cacheMisses.Get(c.labels).Add(1)
+		if c.Config().MissReturnsEmpty {
+			return []CartItem{}, CartMeta{}, nil
+		}
+		return nil, CartMeta{}, errNotFound{}
+	}
+	return entry.items, entry.meta, nil
+}
+
+// Contains returns whether the cache has a value for the given key, even if
+// that value is an empty cart.
+func (c *cartCacheImpl) Contains(_ context.Context, key string) (bool, error) {
+	return c.cache.Contains(key), nil
 }
 
 // Remove removes an entry with the given key from the cache.
 func (c *cartCacheImpl) Remove(_ context.Context, key string) (bool, error) {
-	return c.cache.Remove(key), nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := c.cache.Remove(key)
+	cacheEntries.Get(c.labels).Set(float64(c.cache.Len()))
+	return removed, nil
+}
+
+// RemoveIfEmpty atomically removes the entry with the given key from the
+// cache if its cart is empty and has no metadata. It returns whether the
+// entry was removed.
+func (c *cartCacheImpl) RemoveIfEmpty(_ context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache.Peek(key)
+	if !ok || !entry.empty() {
+		return false, nil
+	}
+	removed := c.cache.Remove(key)
+	cacheEntries.Get(c.labels).Set(float64(c.cache.Len()))
+	return removed, nil
+}
+
+// AddItem atomically adds the given quantity of the product with the given id
+// to the cart with the given key, adding the cart if the key is not present.
+// The quantity may be negative. If the product's quantity drops to zero or
+// below, the product is removed from the cart, and, like with RemoveItem, the
+// entry is removed from the cache if the cart becomes empty and has no
+// metadata.
+func (c *cartCacheImpl) AddItem(_ context.Context, key, productID string, quantity int32) error {
+	cacheWrites.Get(c.labels).Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, _ := c.cache.Peek(key)
+
+	// Copy the items since the cache may be local, and the caller of Get
+	// may still hold them.
+	items := make([]CartItem, 0, len(entry.items)+1)
+	found := false
+	for _, item := range entry.items {
+		if item.ProductID == productID {
+			item.Quantity += quantity
+			found = true
+			if item.Quantity <= 0 {
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+	if !found {
+		if quantity <= 0 {
+			// There is nothing to remove.
+			return nil
+		}
+		items = append(items, CartItem{ProductID: productID, Quantity: quantity})
+	}
+	entry.items = items
+	if entry.empty() {
+		c.cache.Remove(key)
+		cacheEntries.Get(c.labels).Set(float64(c.cache.Len()))
+		return nil
+	}
+	c.record(&entry)
+	c.cache.Add(key, entry)
+	cacheEntries.Get(c.labels).Set(float64(c.cache.Len()))
+	return nil
+}
+
+// RemoveItem atomically removes the product with the given id from the cart
+// with the given key. If the cart becomes empty and has no metadata, the entry
+// is removed from the cache altogether, and RemoveItem returns true. An empty
+// cart with metadata is kept, so that the metadata survives.
+func (c *cartCacheImpl) RemoveItem(_ context.Context, key, productID string) (bool, error) {
+	cacheWrites.Get(c.labels).Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache.Peek(key)
+	if !ok {
+		return false, nil
+	}
+	items := make([]CartItem, 0, len(entry.items))
+	for _, item := range entry.items {
+		if item.ProductID != productID {
+			items = append(items, item)
+		}
+	}
+	entry.items = items
+	if entry.empty() {
+		removed := c.cache.Remove(key)
+		cacheEntries.Get(c.labels).Set(float64(c.cache.Len()))
+		return removed, nil
+	}
+	c.record(&entry)
+	c.cache.Add(key, entry)
+	return false, nil
+}
+
+// SetCartMeta sets the metadata of the cart with the given key. If the key is
+// not present, an empty cart with the given metadata is added to the cache.
+func (c *cartCacheImpl) SetCartMeta(_ context.Context, key string, meta CartMeta) error {
+	cacheWrites.Get(c.labels).Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache.Peek(key)
+	if !ok {
+		entry.items = []CartItem{}
+		c.record(&entry)
+	}
+	entry.meta = meta
+	c.cache.Add(key, entry)
+	cacheEntries.Get(c.labels).Set(float64(c.cache.Len()))
+	return nil
+}
+
+// GetCartMeta returns the metadata of the cart with the given key, or
+// errNotFound if the key is not present.
+func (c *cartCacheImpl) GetCartMeta(_ context.Context, key string) (CartMeta, error) {
+	cacheReads.Get(c.labels).Add(1)
+	entry, ok := c.cache.Get(key)
+	if !ok {
+		cacheMisses.Get(c.labels).Add(1)
+		return CartMeta{}, errNotFound{}
+	}
+	return entry.meta, nil
+}
+
+// GetVersioned is like Get, but it also returns a version token identifying
+// the returned version of the cart. The token can be passed to GetChanges.
+// Unlike Get, GetVersioned always returns errNotFound on a miss.
+func (c *cartCacheImpl) GetVersioned(_ context.Context, key string) ([]CartItem, string, error) {
+	cacheReads.Get(c.labels).Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache.Get(key)
+	if !ok {
+		cacheMisses.Get(c.labels).Add(1)
+		return nil, "", errNotFound{}
+	}
+	return entry.items, c.token(entry.history[len(entry.history)-1].version), nil
+}
+
+// GetChanges returns the changes made to the cart with the given key since
+// the version identified by the provided token: the items that were added,
+// the items that were removed, and the items whose quantity changed. Removed
+// items are reported with their old quantity; changed items with their new
+// quantity. GetChanges also returns a token identifying the current version.
+//
+// GetChanges returns errNotFound if the key is not present, and
+// errVersionExpired if the token does not identify one of the retained
+// versions of the cart (see cacheConfig.HistoryDepth).
+func (c *cartCacheImpl) GetChanges(_ context.Context, key, since string) (added, removed, changed []CartItem, token string, err error) {
+	cacheReads.Get(c.labels).Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache.Get(key)
+	if !ok {
+		cacheMisses.Get(c.labels).Add(1)
+		return nil, nil, nil, "", errNotFound{}
+	}
+	version, ok := c.parseToken(since)
+	if !ok {
+		return nil, nil, nil, "", errVersionExpired{}
+	}
+	var old []CartItem
+	found := false
+	for _, v := range entry.history {
+		if v.version == version {
+			old, found = v.items, true
+			break
+		}
+	}
+	if !found {
+		return nil, nil, nil, "", errVersionExpired{}
+	}
+
+	oldQuantities := map[string]int32{}
+	for _, item := range old {
+		oldQuantities[item.ProductID] = item.Quantity
+	}
+	for _, item := range entry.items {
+		q, ok := oldQuantities[item.ProductID]
+		switch {
+		case !ok:
+			added = append(added, item)
+		case q != item.Quantity:
+			changed = append(changed, item)
+		}
+		delete(oldQuantities, item.ProductID)
+	}
+	for _, item := range old {
+		if _, ok := oldQuantities[item.ProductID]; ok {
+			removed = append(removed, item)
+		}
+	}
+	token = c.token(entry.history[len(entry.history)-1].version)
+	return added, removed, changed, token, nil
+}
+
+// record assigns a new version to the entry's current items and appends it
+// to the entry's history, evicting the oldest versions as needed. REQUIRES:
+// c.mu is held.
+func (c *cartCacheImpl) record(entry *cartEntry) {
+	depth := c.Config().HistoryDepth
+	if depth == 0 {
+		depth = defaultHistoryDepth
+	}
+	c.version++
+	history := append(entry.history, cartVersion{version: c.version, items: entry.items})
+	if len(history) > depth {
+		// Copy, rather than reslice, so that evicted versions can be
+		// garbage collected.
+		history = append([]cartVersion(nil), history[len(history)-depth:]...)
+	}
+	entry.history = history
+}
+
+// token returns the version token for the provided version. Tokens embed
+// the replica id, so that tokens issued by one replica are never mistaken
+// for versions of another.
+func (c *cartCacheImpl) token(version uint64) string {
+	return fmt.Sprintf("%s/%d", c.replica, version)
+}
+
+// parseToken parses a token returned by token.
+func (c *cartCacheImpl) parseToken(token string) (uint64, bool) {
+	replica, version, ok := strings.Cut(token, "/")
+	if !ok || replica != c.replica {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(version, 10, 64)
+	return v, err == nil
 }
 
 type cartCacheRouter struct{}
 
-func (cartCacheRouter) Add(_ context.Context, key string, value []CartItem) string { return key }
-func (cartCacheRouter) Get(_ context.Context, key string) string                   { return key }
-func (cartCacheRouter) Remove(_ context.Context, key string) string                { return key }
+func (cartCacheRouter) Add(_ context.Context, key string, value []CartItem) string   { return key }
+func (cartCacheRouter) Get(_ context.Context, key string) string                     { return key }
+func (cartCacheRouter) GetWithMetadata(_ context.Context, key string) string         { return key }
+func (cartCacheRouter) Contains(_ context.Context, key string) string                { return key }
+func (cartCacheRouter) Remove(_ context.Context, key string) string                  { return key }
+func (cartCacheRouter) RemoveIfEmpty(_ context.Context, key string) string           { return key }
+func (cartCacheRouter) AddItem(_ context.Context, key, _ string, _ int32) string     { return key }
+func (cartCacheRouter) RemoveItem(_ context.Context, key, _ string) string           { return key }
+func (cartCacheRouter) SetCartMeta(_ context.Context, key string, _ CartMeta) string { return key }
+func (cartCacheRouter) GetCartMeta(_ context.Context, key string) string             { return key }
+func (cartCacheRouter) GetVersioned(_ context.Context, key string) string            { return key }
+func (cartCacheRouter) GetChanges(_ context.Context, key, _ string) string           { return key }
@@ -0,0 +1,279 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cartservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
+	"github.com/ServiceWeaver/weaver/weavertest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCacheMissReturnsError(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			cache := weavertest.InitComponent[cartCache](t, weavertest.Options{SingleProcess: single, Replicas: 1})
+			if _, err := cache.Get(ctx, "missing"); !errors.Is(err, errNotFound{}) {
+				t.Fatalf("Get(missing): got %v, want errNotFound", err)
+			}
+		})
+	}
+}
+
+func TestCacheMissReturnsEmpty(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			cache := weavertest.InitComponent[cartCache](t, weavertest.Options{
+				SingleProcess: single,
+				Replicas:      1,
+				Config: `
+["github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache"]
+cache_miss_returns_empty = true
+`,
+			})
+			if err := cache.Add(ctx, "empty", []CartItem{}); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, test := range []struct {
+				key     string
+				present bool
+			}{
+				{"missing", false},
+				{"empty", true},
+			} {
+				t.Run(test.key, func(t *testing.T) {
+					cart, err := cache.Get(ctx, test.key)
+					if err != nil {
+						t.Fatalf("Get(%q): %v", test.key, err)
+					}
+					if len(cart) != 0 {
+						t.Fatalf("Get(%q): got %v, want empty cart", test.key, cart)
+					}
+					present, err := cache.Contains(ctx, test.key)
+					if err != nil {
+						t.Fatalf("Contains(%q): %v", test.key, err)
+					}
+					if present != test.present {
+						t.Fatalf("Contains(%q): got %t, want %t", test.key, present, test.present)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestRemoveIfEmpty(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			cache := weavertest.InitComponent[cartCache](t, weavertest.Options{SingleProcess: single, Replicas: 1})
+			if err := cache.Add(ctx, "empty", []CartItem{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := cache.Add(ctx, "full", []CartItem{{ProductID: "a", Quantity: 1}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := cache.SetCartMeta(ctx, "meta", CartMeta{Currency: "USD"}); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, test := range []struct {
+				key     string
+				removed bool
+			}{
+				{"empty", true},
+				{"full", false},
+				{"meta", false},
+				{"missing", false},
+			} {
+				t.Run(test.key, func(t *testing.T) {
+					removed, err := cache.RemoveIfEmpty(ctx, test.key)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if removed != test.removed {
+						t.Fatalf("RemoveIfEmpty(%q): got %t, want %t", test.key, removed, test.removed)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestAddItemNonPositiveQuantity(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			cache := weavertest.InitComponent[cartCache](t, weavertest.Options{SingleProcess: single, Replicas: 1})
+			addItem := func(key, productID string, quantity int32) {
+				t.Helper()
+				if err := cache.AddItem(ctx, key, productID, quantity); err != nil {
+					t.Fatal(err)
+				}
+			}
+			contains := func(key string) bool {
+				t.Helper()
+				ok, err := cache.Contains(ctx, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return ok
+			}
+
+			addItem("key", "a", 2)
+			addItem("key", "b", 1)
+
+			// Lowering a quantity above zero keeps the item.
+			addItem("key", "a", -1)
+			got, err := cache.Get(ctx, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []CartItem{{ProductID: "a", Quantity: 1}, {ProductID: "b", Quantity: 1}}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("Get (-want +got):\n%s", diff)
+			}
+
+			// Lowering a quantity to zero or below removes the item.
+			addItem("key", "a", -1)
+			got, err = cache.Get(ctx, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = []CartItem{{ProductID: "b", Quantity: 1}}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("Get (-want +got):\n%s", diff)
+			}
+
+			// Removing the last item removes the key.
+			addItem("key", "b", -5)
+			if contains("key") {
+				t.Fatal("key not removed after the quantity of the last item dropped below zero")
+			}
+
+			// A non-positive quantity of a missing product is a no-op.
+			addItem("missing", "a", 0)
+			if contains("missing") {
+				t.Fatal("key added by a zero quantity")
+			}
+		})
+	}
+}
+
+func TestCacheMetricsHaveReplicaLabel(t *testing.T) {
+	// The metrics are read from this process, so the cache must run in it.
+	ctx := context.Background()
+	cache := weavertest.InitComponent[cartCache](t, weavertest.Options{SingleProcess: true, Replicas: 1})
+	if err := cache.Add(ctx, "key", []CartItem{{ProductID: "p", Quantity: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]bool{
+		cacheReads.Name():   false,
+		cacheWrites.Name():  false,
+		cacheEntries.Name(): false,
+	}
+	for _, m := range metrics.Snapshot() {
+		if _, ok := names[m.Name]; !ok {
+			continue
+		}
+		names[m.Name] = true
+		if m.Labels["replica"] == "" {
+			t.Errorf("metric %s: missing or empty replica label: %v", m.Name, m.Labels)
+		}
+	}
+	for name, found := range names {
+		if !found {
+			t.Errorf("metric %s not found", name)
+		}
+	}
+}
+
+func TestCacheGetChanges(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			cache := weavertest.InitComponent[cartCache](t, weavertest.Options{
+				SingleProcess: single,
+				Replicas:      1,
+				Config: `
+["github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache"]
+cache_history_depth = 2
+`,
+			})
+			add := func(items ...CartItem) {
+				t.Helper()
+				if err := cache.Add(ctx, "key", items); err != nil {
+					t.Fatal(err)
+				}
+			}
+			a1 := CartItem{ProductID: "a", Quantity: 1}
+			a2 := CartItem{ProductID: "a", Quantity: 2}
+			b1 := CartItem{ProductID: "b", Quantity: 1}
+			c1 := CartItem{ProductID: "c", Quantity: 1}
+
+			add(a1, b1)
+			_, v1, err := cache.GetVersioned(ctx, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			add(a2, c1)
+			added, removed, changed, v2, err := cache.GetChanges(ctx, "key", v1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]CartItem{c1}, added); diff != "" {
+				t.Errorf("added (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff([]CartItem{b1}, removed); diff != "" {
+				t.Errorf("removed (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff([]CartItem{a2}, changed); diff != "" {
+				t.Errorf("changed (-want +got):\n%s", diff)
+			}
+
+			// Diffing against the current version yields no changes.
+			added, removed, changed, v3, err := cache.GetChanges(ctx, "key", v2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(added)+len(removed)+len(changed) != 0 {
+				t.Errorf("unexpected changes: added %v, removed %v, changed %v", added, removed, changed)
+			}
+			if v3 != v2 {
+				t.Errorf("token changed without mutation: got %q, want %q", v3, v2)
+			}
+
+			// With a history depth of 2, v1 expires after one more mutation.
+			add(a1)
+			if _, _, _, _, err := cache.GetChanges(ctx, "key", v1); !errors.Is(err, errVersionExpired{}) {
+				t.Errorf("GetChanges(v1): got %v, want errVersionExpired", err)
+			}
+			if _, _, _, _, err := cache.GetChanges(ctx, "key", v2); err != nil {
+				t.Errorf("GetChanges(v2): %v", err)
+			}
+		})
+	}
+}
@@ -26,10 +26,27 @@ type CartItem struct {
 	Quantity  int32
 }
 
+// CartMeta holds cart-level metadata. It is stored alongside the cart's items
+// and shares the cart's lifetime: it survives item mutations, including the
+// removal of the last item, and it is removed along with the cart by
+// EmptyCart.
+type CartMeta struct {
+	weaver.AutoMarshal
+	Currency string // currency code, e.g., "USD"
+	Locale   string // locale, e.g., "en-US"
+	UserID   string // id of the user owning the cart
+}
+
 type T interface {
 	AddItem(ctx context.Context, userID string, item CartItem) error
+	RemoveItem(ctx context.Context, userID, productID string) error
 	GetCart(ctx context.Context, userID string) ([]CartItem, error)
+	GetCartWithMetadata(ctx context.Context, userID string) ([]CartItem, CartMeta, error)
+	GetCartVersioned(ctx context.Context, userID string) ([]CartItem, string, error)
+	GetCartChanges(ctx context.Context, userID, sinceToken string) (added, removed, changed []CartItem, newToken string, err error)
 	EmptyCart(ctx context.Context, userID string) error
+	SetCartMeta(ctx context.Context, userID string, meta CartMeta) error
+	GetCartMeta(ctx context.Context, userID string) (CartMeta, error)
 }
 
 type impl struct {
@@ -43,17 +60,61 @@ func (s *impl) Init(context.Context) error {
 	return err
 }
 
-// AddItem adds a given item to the user's cart.
+// AddItem adds a given item to the user's cart. A negative quantity lowers
+// the quantity of the item, which is removed once its quantity drops to zero
+// or below.
 func (s *impl) AddItem(ctx context.Context, userID string, item CartItem) error {
 	return s.store.AddItem(ctx, userID, item.ProductID, item.Quantity)
 }
 
+// RemoveItem removes the item with the given product id from the user's cart.
+// If the cart becomes empty and has no metadata, it is removed.
+func (s *impl) RemoveItem(ctx context.Context, userID, productID string) error {
+	return s.store.RemoveItem(ctx, userID, productID)
+}
+
 // GetCart returns the items in the user's cart.
 func (s *impl) GetCart(ctx context.Context, userID string) ([]CartItem, error) {
 	return s.store.GetCart(ctx, userID)
 }
 
+// GetCartWithMetadata returns the items in the user's cart, along with the
+// cart's metadata.
+func (s *impl) GetCartWithMetadata(ctx context.Context, userID string) ([]CartItem, CartMeta, error) {
+	return s.store.GetCartWithMetadata(ctx, userID)
+}
+
+// GetCartVersioned returns the items in the user's cart, along with a token
+// identifying the returned version of the cart. The token can be passed to
+// GetCartChanges to get the changes made to the cart since. If the cart is
+// empty, the returned token is empty.
+func (s *impl) GetCartVersioned(ctx context.Context, userID string) ([]CartItem, string, error) {
+	return s.store.GetCartVersioned(ctx, userID)
+}
+
+// GetCartChanges returns the changes made to the user's cart since the
+// version identified by sinceToken, along with a token identifying the
+// current version of the cart.
+//
+// Only a bounded number of recent versions of a cart are retained (see
+// cacheConfig.HistoryDepth). If sinceToken is older than that, or otherwise
+// unknown, GetCartChanges returns an error, and the caller should fall back
+// to GetCartVersioned.
+func (s *impl) GetCartChanges(ctx context.Context, userID, sinceToken string) ([]CartItem, []CartItem, []CartItem, string, error) {
+	return s.store.GetCartChanges(ctx, userID, sinceToken)
+}
+
 // EmptyCart empties the user's cart.
 func (s *impl) EmptyCart(ctx context.Context, userID string) error {
 	return s.store.EmptyCart(ctx, userID)
 }
+
+// SetCartMeta sets the metadata of the user's cart.
+func (s *impl) SetCartMeta(ctx context.Context, userID string, meta CartMeta) error {
+	return s.store.SetCartMeta(ctx, userID, meta)
+}
+
+// GetCartMeta returns the metadata of the user's cart.
+func (s *impl) GetCartMeta(ctx context.Context, userID string) (CartMeta, error) {
+	return s.store.GetCartMeta(ctx, userID)
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cartservice
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/weavertest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRemoveLastItemRemovesCart(t *testing.T) {
+	ctx := context.Background()
+	root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: true})
+	carts, err := weaver.Get[T](root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := weaver.Get[cartCache](root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const user = "user"
+	contains := func() bool {
+		t.Helper()
+		ok, err := cache.Contains(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	for _, item := range []CartItem{{ProductID: "a", Quantity: 1}, {ProductID: "b", Quantity: 2}} {
+		if err := carts.AddItem(ctx, user, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Removing a non-last item keeps the cart around.
+	if err := carts.RemoveItem(ctx, user, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if !contains() {
+		t.Fatal("cart removed after removing a non-last item")
+	}
+	got, err := carts.GetCart(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]CartItem{{ProductID: "b", Quantity: 2}}, got); diff != "" {
+		t.Fatalf("GetCart (-want +got):\n%s", diff)
+	}
+
+	// Removing the last item removes the cart.
+	if err := carts.RemoveItem(ctx, user, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if contains() {
+		t.Fatal("cart not removed after removing the last item")
+	}
+}
+
+func TestConcurrentAddAndRemoveLastItem(t *testing.T) {
+	// An item added while the last item of a cart is being removed must not
+	// be lost, whichever of the two calls is executed first.
+	ctx := context.Background()
+	root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: true})
+	carts, err := weaver.Get[T](root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		user := fmt.Sprintf("user%d", i)
+		if err := carts.AddItem(ctx, user, CartItem{ProductID: "a", Quantity: 1}); err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := carts.RemoveItem(ctx, user, "a"); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := carts.AddItem(ctx, user, CartItem{ProductID: "b", Quantity: 1}); err != nil {
+				t.Error(err)
+			}
+		}()
+		wg.Wait()
+
+		got, err := carts.GetCart(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]CartItem{{ProductID: "b", Quantity: 1}}, got); diff != "" {
+			t.Fatalf("GetCart (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestCartMetaSurvivesMutations(t *testing.T) {
+	ctx := context.Background()
+	root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: true})
+	carts, err := weaver.Get[T](root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const user = "user"
+	want := CartMeta{Currency: "EUR", Locale: "fr-FR", UserID: user}
+	if err := carts.SetCartMeta(ctx, user, want); err != nil {
+		t.Fatal(err)
+	}
+	check := func(op string) {
+		t.Helper()
+		got, err := carts.GetCartMeta(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("GetCartMeta after %s (-want +got):\n%s", op, diff)
+		}
+	}
+
+	check("SetCartMeta")
+	for _, item := range []CartItem{{ProductID: "a", Quantity: 1}, {ProductID: "b", Quantity: 2}} {
+		if err := carts.AddItem(ctx, user, item); err != nil {
+			t.Fatal(err)
+		}
+		check("AddItem")
+	}
+	if err := carts.RemoveItem(ctx, user, "a"); err != nil {
+		t.Fatal(err)
+	}
+	check("RemoveItem")
+
+	// Removing the last item empties the cart, but keeps its metadata.
+	if err := carts.RemoveItem(ctx, user, "b"); err != nil {
+		t.Fatal(err)
+	}
+	check("RemoveItem of the last item")
+	items, meta, err := carts.GetCartWithMetadata(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("GetCartWithMetadata: got items %v, want none", items)
+	}
+	if diff := cmp.Diff(want, meta); diff != "" {
+		t.Errorf("GetCartWithMetadata (-want +got):\n%s", diff)
+	}
+}
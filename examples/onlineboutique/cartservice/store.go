@@ -36,35 +36,16 @@ func newCartStore(component weaver.Instance) (*cartStore, error) {
 
 func (c *cartStore) AddItem(ctx context.Context, userID, productID string, quantity int32) error {
 	c.component.Logger().Info("AddItem called", "userID", userID, "productID", productID, "quantity", quantity)
-	// Get the cart from the cache.
-	cart, err := c.cache.Get(ctx, userID)
-	if err != nil {
-		if errors.Is(err, errNotFound{}) { // cache miss
-			cart = nil
-		} else {
-			return err
-		}
-	}
-
-	// Copy the cart since the cache may be local, and we don't want to
-	// overwrite the cache value directly.
-	copy := make([]CartItem, 0, len(cart)+1)
-	found := false
-	for _, item := range cart {
-		if item.ProductID == productID {
-			item.Quantity += quantity
-			found = true
-		}
-		copy = append(copy, item)
-	}
-	if !found {
-		copy = append(copy, CartItem{
-			ProductID: productID,
-			Quantity:  quantity,
-		})
-	}
+	return c.cache.AddItem(ctx, userID, productID, quantity)
+}
 
-	return c.cache.Add(ctx, userID, copy)
+// RemoveItem removes the item with the given product id from the user's cart.
+// If the cart becomes empty and has no metadata, it is removed from the cache
+// altogether, so that we don't leave empty carts around.
+func (c *cartStore) RemoveItem(ctx context.Context, userID, productID string) error {
+	c.component.Logger().Info("RemoveItem called", "userID", userID, "productID", productID)
+	_, err := c.cache.RemoveItem(ctx, userID, productID)
+	return err
 }
 
 func (c *cartStore) EmptyCart(ctx context.Context, userID string) error {
@@ -81,3 +62,40 @@ func (c *cartStore) GetCart(ctx context.Context, userID string) ([]CartItem, err
 	}
 	return cart, err
 }
+
+func (c *cartStore) GetCartWithMetadata(ctx context.Context, userID string) ([]CartItem, CartMeta, error) {
+	c.component.Logger().Info("GetCartWithMetadata called", "userID", userID)
+	cart, meta, err := c.cache.GetWithMetadata(ctx, userID)
+	if err != nil && errors.Is(err, errNotFound{}) {
+		return []CartItem{}, CartMeta{}, nil
+	}
+	return cart, meta, err
+}
+
+func (c *cartStore) GetCartVersioned(ctx context.Context, userID string) ([]CartItem, string, error) {
+	c.component.Logger().Info("GetCartVersioned called", "userID", userID)
+	cart, token, err := c.cache.GetVersioned(ctx, userID)
+	if err != nil && errors.Is(err, errNotFound{}) {
+		return []CartItem{}, "", nil
+	}
+	return cart, token, err
+}
+
+func (c *cartStore) GetCartChanges(ctx context.Context, userID, sinceToken string) ([]CartItem, []CartItem, []CartItem, string, error) {
+	c.component.Logger().Info("GetCartChanges called", "userID", userID, "sinceToken", sinceToken)
+	return c.cache.GetChanges(ctx, userID, sinceToken)
+}
+
+func (c *cartStore) SetCartMeta(ctx context.Context, userID string, meta CartMeta) error {
+	c.component.Logger().Info("SetCartMeta called", "userID", userID)
+	return c.cache.SetCartMeta(ctx, userID, meta)
+}
+
+func (c *cartStore) GetCartMeta(ctx context.Context, userID string) (CartMeta, error) {
+	c.component.Logger().Info("GetCartMeta called", "userID", userID)
+	meta, err := c.cache.GetCartMeta(ctx, userID)
+	if err != nil && errors.Is(err, errNotFound{}) {
+		return CartMeta{}, nil
+	}
+	return meta, err
+}
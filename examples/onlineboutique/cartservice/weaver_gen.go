@@ -18,26 +18,30 @@ func init() {
 		New:         func() any { return &impl{} },
 		LocalStubFn: func(impl any, tracer trace.Tracer) any { return t_local_stub{impl: impl.(T), tracer: tracer} },
 		ClientStubFn: func(stub codegen.Stub, caller string) any {
-			return t_client_stub{stub: stub, addItemMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", Method: "AddItem"}), getCartMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", Method: "GetCart"}), emptyCartMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", Method: "EmptyCart"})}
+			return t_client_stub{stub: stub, addItemMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", Method: "AddItem"}), removeItemMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", Method: "RemoveItem"}), getCartMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", Method: "GetCart"}), getCartWithMetadataMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", Method: "GetCartWithMetadata"}), getCartVersionedMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", Method: "GetCartVersioned"}), getCartChangesMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", Method: "GetCartChanges"}), emptyCartMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", Method: "EmptyCart"}), setCartMetaMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", Method: "SetCartMeta"}), getCartMetaMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", Method: "GetCartMeta"})}
 		},
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return t_server_stub{impl: impl.(T), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"AddItem": {"userID", "item"}, "RemoveItem": {"userID", "productID"}, "GetCart": {"userID"}, "GetCartWithMetadata": {"userID"}, "GetCartVersioned": {"userID"}, "GetCartChanges": {"userID", "sinceToken"}, "EmptyCart": {"userID"}, "SetCartMeta": {"userID", "meta"}, "GetCartMeta": {"userID"}},
 	})
 	codegen.Register(codegen.Registration{
-		Name:   "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache",
-		Iface:  reflect.TypeOf((*cartCache)(nil)).Elem(),
-		New:    func() any { return &cartCacheImpl{} },
-		Routed: true,
+		Name:     "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache",
+		Iface:    reflect.TypeOf((*cartCache)(nil)).Elem(),
+		New:      func() any { return &cartCacheImpl{} },
+		ConfigFn: func(i any) any { return i.(*cartCacheImpl).WithConfig.Config() },
+		Routed:   true,
+		Router:   reflect.TypeOf((*cartCache_router)(nil)).Elem(),
 		LocalStubFn: func(impl any, tracer trace.Tracer) any {
 			return cartCache_local_stub{impl: impl.(cartCache), tracer: tracer}
 		},
 		ClientStubFn: func(stub codegen.Stub, caller string) any {
-			return cartCache_client_stub{stub: stub, addMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "Add"}), getMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "Get"}), removeMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "Remove"})}
+			return cartCache_client_stub{stub: stub, addMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "Add"}), getMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "Get"}), getWithMetadataMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "GetWithMetadata"}), containsMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "Contains"}), removeMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "Remove"}), removeIfEmptyMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "RemoveIfEmpty"}), addItemMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "AddItem"}), removeItemMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "RemoveItem"}), setCartMetaMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "SetCartMeta"}), getCartMetaMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "GetCartMeta"}), getVersionedMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "GetVersioned"}), getChangesMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache", Method: "GetChanges"})}
 		},
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return cartCache_server_stub{impl: impl.(cartCache), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Add": {"", ""}, "Get": {""}, "GetWithMetadata": {""}, "Contains": {""}, "Remove": {""}, "RemoveIfEmpty": {""}, "AddItem": {"", "", ""}, "RemoveItem": {"", ""}, "SetCartMeta": {"", ""}, "GetCartMeta": {""}, "GetVersioned": {""}, "GetChanges": {"", ""}},
 	})
 }
 
@@ -65,6 +69,23 @@ func (s t_local_stub) AddItem(ctx context.Context, a0 string, a1 CartItem) (err
 	return s.impl.AddItem(ctx, a0, a1)
 }
 
+func (s t_local_stub) RemoveItem(ctx context.Context, a0 string, a1 string) (err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.T.RemoveItem", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.RemoveItem(ctx, a0, a1)
+}
+
 func (s t_local_stub) GetCart(ctx context.Context, a0 string) (r0 []CartItem, err error) {
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -82,6 +103,57 @@ func (s t_local_stub) GetCart(ctx context.Context, a0 string) (r0 []CartItem, er
 	return s.impl.GetCart(ctx, a0)
 }
 
+func (s t_local_stub) GetCartWithMetadata(ctx context.Context, a0 string) (r0 []CartItem, r1 CartMeta, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.T.GetCartWithMetadata", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.GetCartWithMetadata(ctx, a0)
+}
+
+func (s t_local_stub) GetCartVersioned(ctx context.Context, a0 string) (r0 []CartItem, r1 string, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.T.GetCartVersioned", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.GetCartVersioned(ctx, a0)
+}
+
+func (s t_local_stub) GetCartChanges(ctx context.Context, a0 string, a1 string) (r0 []CartItem, r1 []CartItem, r2 []CartItem, r3 string, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.T.GetCartChanges", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.GetCartChanges(ctx, a0, a1)
+}
+
 func (s t_local_stub) EmptyCart(ctx context.Context, a0 string) (err error) {
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -99,6 +171,40 @@ func (s t_local_stub) EmptyCart(ctx context.Context, a0 string) (err error) {
 	return s.impl.EmptyCart(ctx, a0)
 }
 
+func (s t_local_stub) SetCartMeta(ctx context.Context, a0 string, a1 CartMeta) (err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.T.SetCartMeta", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.SetCartMeta(ctx, a0, a1)
+}
+
+func (s t_local_stub) GetCartMeta(ctx context.Context, a0 string) (r0 CartMeta, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.T.GetCartMeta", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.GetCartMeta(ctx, a0)
+}
+
 type cartCache_local_stub struct {
 	impl   cartCache
 	tracer trace.Tracer
@@ -138,6 +244,40 @@ func (s cartCache_local_stub) Get(ctx context.Context, a0 string) (r0 []CartItem
 	return s.impl.Get(ctx, a0)
 }
 
+func (s cartCache_local_stub) GetWithMetadata(ctx context.Context, a0 string) (r0 []CartItem, r1 CartMeta, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.cartCache.GetWithMetadata", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.GetWithMetadata(ctx, a0)
+}
+
+func (s cartCache_local_stub) Contains(ctx context.Context, a0 string) (r0 bool, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.cartCache.Contains", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.Contains(ctx, a0)
+}
+
 func (s cartCache_local_stub) Remove(ctx context.Context, a0 string) (r0 bool, err error) {
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -155,19 +295,145 @@ func (s cartCache_local_stub) Remove(ctx context.Context, a0 string) (r0 bool, e
 	return s.impl.Remove(ctx, a0)
 }
 
+func (s cartCache_local_stub) RemoveIfEmpty(ctx context.Context, a0 string) (r0 bool, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.cartCache.RemoveIfEmpty", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.RemoveIfEmpty(ctx, a0)
+}
+
+func (s cartCache_local_stub) AddItem(ctx context.Context, a0 string, a1 string, a2 int32) (err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.cartCache.AddItem", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.AddItem(ctx, a0, a1, a2)
+}
+
+func (s cartCache_local_stub) RemoveItem(ctx context.Context, a0 string, a1 string) (r0 bool, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.cartCache.RemoveItem", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.RemoveItem(ctx, a0, a1)
+}
+
+func (s cartCache_local_stub) SetCartMeta(ctx context.Context, a0 string, a1 CartMeta) (err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.cartCache.SetCartMeta", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.SetCartMeta(ctx, a0, a1)
+}
+
+func (s cartCache_local_stub) GetCartMeta(ctx context.Context, a0 string) (r0 CartMeta, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.cartCache.GetCartMeta", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.GetCartMeta(ctx, a0)
+}
+
+func (s cartCache_local_stub) GetVersioned(ctx context.Context, a0 string) (r0 []CartItem, r1 string, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.cartCache.GetVersioned", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.GetVersioned(ctx, a0)
+}
+
+func (s cartCache_local_stub) GetChanges(ctx context.Context, a0 string, a1 string) (r0 []CartItem, r1 []CartItem, r2 []CartItem, r3 string, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "cartservice.cartCache.GetChanges", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.GetChanges(ctx, a0, a1)
+}
+
 // Client stub implementations.
 
 type t_client_stub struct {
-	stub             codegen.Stub
-	addItemMetrics   *codegen.MethodMetrics
-	getCartMetrics   *codegen.MethodMetrics
-	emptyCartMetrics *codegen.MethodMetrics
+	stub                       codegen.Stub
+	addItemMetrics             *codegen.MethodMetrics
+	removeItemMetrics          *codegen.MethodMetrics
+	getCartMetrics             *codegen.MethodMetrics
+	getCartWithMetadataMetrics *codegen.MethodMetrics
+	getCartVersionedMetrics    *codegen.MethodMetrics
+	getCartChangesMetrics      *codegen.MethodMetrics
+	emptyCartMetrics           *codegen.MethodMetrics
+	setCartMetaMetrics         *codegen.MethodMetrics
+	getCartMetaMetrics         *codegen.MethodMetrics
 }
 
 func (s t_client_stub) AddItem(ctx context.Context, a0 string, a1 CartItem) (err error) {
 	// Update metrics.
 	start := time.Now()
-	s.addItemMetrics.Count.Add(1)
+	methodMetrics := s.addItemMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -185,19 +451,19 @@ func (s t_client_stub) AddItem(ctx context.Context, a0 string, a1 CartItem) (err
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.addItemMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.addItemMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
 	size += serviceweaver_size_CartItem_e3591e56(&a1)
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
@@ -205,13 +471,13 @@ func (s t_client_stub) AddItem(ctx context.Context, a0 string, a1 CartItem) (err
 	var shardKey uint64
 
 	// Call the remote method.
-	s.addItemMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.addItemMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -219,15 +485,16 @@ func (s t_client_stub) AddItem(ctx context.Context, a0 string, a1 CartItem) (err
 	return
 }
 
-func (s t_client_stub) GetCart(ctx context.Context, a0 string) (r0 []CartItem, err error) {
+func (s t_client_stub) RemoveItem(ctx context.Context, a0 string, a1 string) (err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getCartMetrics.Count.Add(1)
+	methodMetrics := s.removeItemMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
 		// Create a child span for this method.
-		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.T.GetCart", trace.WithSpanKind(trace.SpanKindClient))
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.T.RemoveItem", trace.WithSpanKind(trace.SpanKindClient))
 	}
 
 	defer func() {
@@ -240,48 +507,50 @@ func (s t_client_stub) GetCart(ctx context.Context, a0 string) (r0 []CartItem, e
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getCartMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getCartMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	size += (4 + len(a1))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
+	enc.String(a1)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.getCartMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
-	results, err = s.stub.Run(ctx, 2, enc.Data(), shardKey)
+	results, err = s.stub.Run(ctx, 7, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.getCartMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
-	r0 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
 	err = dec.Error()
 	return
 }
 
-func (s t_client_stub) EmptyCart(ctx context.Context, a0 string) (err error) {
+func (s t_client_stub) GetCart(ctx context.Context, a0 string) (r0 []CartItem, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.emptyCartMetrics.Count.Add(1)
+	methodMetrics := s.getCartMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
 		// Create a child span for this method.
-		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.T.EmptyCart", trace.WithSpanKind(trace.SpanKindClient))
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.T.GetCart", trace.WithSpanKind(trace.SpanKindClient))
 	}
 
 	defer func() {
@@ -294,54 +563,49 @@ func (s t_client_stub) EmptyCart(ctx context.Context, a0 string) (err error) {
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.emptyCartMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.emptyCartMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.emptyCartMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
-	results, err = s.stub.Run(ctx, 1, enc.Data(), shardKey)
+	results, err = s.stub.Run(ctx, 2, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.emptyCartMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
+	r0 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
 	err = dec.Error()
 	return
 }
 
-type cartCache_client_stub struct {
-	stub          codegen.Stub
-	addMetrics    *codegen.MethodMetrics
-	getMetrics    *codegen.MethodMetrics
-	removeMetrics *codegen.MethodMetrics
-}
-
-func (s cartCache_client_stub) Add(ctx context.Context, a0 string, a1 []CartItem) (err error) {
+func (s t_client_stub) GetCartWithMetadata(ctx context.Context, a0 string) (r0 []CartItem, r1 CartMeta, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.addMetrics.Count.Add(1)
+	methodMetrics := s.getCartWithMetadataMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
 		// Create a child span for this method.
-		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.Add", trace.WithSpanKind(trace.SpanKindClient))
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.T.GetCartWithMetadata", trace.WithSpanKind(trace.SpanKindClient))
 	}
 
 	defer func() {
@@ -354,46 +618,50 @@ func (s cartCache_client_stub) Add(ctx context.Context, a0 string, a1 []CartItem
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.addMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.addMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
 	// Encode arguments.
-	enc := codegen.NewEncoder()
 	enc.String(a0)
-	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, a1)
-
-	// Set the shardKey.
-	var r cartCacheRouter
-	shardKey := _hashCartCache(r.Add(ctx, a0, a1))
+	var shardKey uint64
 
 	// Call the remote method.
-	s.addMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
-	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
+	results, err = s.stub.Run(ctx, 6, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.addMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
+	r0 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
+	(&r1).WeaverUnmarshal(dec)
 	err = dec.Error()
 	return
 }
 
-func (s cartCache_client_stub) Get(ctx context.Context, a0 string) (r0 []CartItem, err error) {
+func (s t_client_stub) GetCartVersioned(ctx context.Context, a0 string) (r0 []CartItem, r1 string, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getMetrics.Count.Add(1)
+	methodMetrics := s.getCartVersionedMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
 		// Create a child span for this method.
-		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.Get", trace.WithSpanKind(trace.SpanKindClient))
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.T.GetCartVersioned", trace.WithSpanKind(trace.SpanKindClient))
 	}
 
 	defer func() {
@@ -406,51 +674,50 @@ func (s cartCache_client_stub) Get(ctx context.Context, a0 string) (r0 []CartIte
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
-
-	// Set the shardKey.
-	var r cartCacheRouter
-	shardKey := _hashCartCache(r.Get(ctx, a0))
+	var shardKey uint64
 
 	// Call the remote method.
-	s.getMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
-	results, err = s.stub.Run(ctx, 1, enc.Data(), shardKey)
+	results, err = s.stub.Run(ctx, 5, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.getMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
 	r0 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
+	r1 = dec.String()
 	err = dec.Error()
 	return
 }
 
-func (s cartCache_client_stub) Remove(ctx context.Context, a0 string) (r0 bool, err error) {
+func (s t_client_stub) GetCartChanges(ctx context.Context, a0 string, a1 string) (r0 []CartItem, r1 []CartItem, r2 []CartItem, r3 string, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.removeMetrics.Count.Add(1)
+	methodMetrics := s.getCartChangesMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
 		// Create a child span for this method.
-		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.Remove", trace.WithSpanKind(trace.SpanKindClient))
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.T.GetCartChanges", trace.WithSpanKind(trace.SpanKindClient))
 	}
 
 	defer func() {
@@ -463,38 +730,914 @@ func (s cartCache_client_stub) Remove(ctx context.Context, a0 string) (r0 bool,
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.removeMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.removeMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	size += (4 + len(a1))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	enc.String(a1)
+	var shardKey uint64
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 3, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
+	r1 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
+	r2 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
+	r3 = dec.String()
+	err = dec.Error()
+	return
+}
+
+func (s t_client_stub) EmptyCart(ctx context.Context, a0 string) (err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.emptyCartMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.T.EmptyCart", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	var shardKey uint64
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 1, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	err = dec.Error()
+	return
+}
+
+func (s t_client_stub) SetCartMeta(ctx context.Context, a0 string, a1 CartMeta) (err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.setCartMetaMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.T.SetCartMeta", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += serviceweaver_size_CartMeta_121bcd35(&a1)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	(a1).WeaverMarshal(enc)
+	var shardKey uint64
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 8, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	err = dec.Error()
+	return
+}
+
+func (s t_client_stub) GetCartMeta(ctx context.Context, a0 string) (r0 CartMeta, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.getCartMetaMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.T.GetCartMeta", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	var shardKey uint64
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 4, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	(&r0).WeaverUnmarshal(dec)
+	err = dec.Error()
+	return
+}
+
+type cartCache_client_stub struct {
+	stub                   codegen.Stub
+	addMetrics             *codegen.MethodMetrics
+	getMetrics             *codegen.MethodMetrics
+	getWithMetadataMetrics *codegen.MethodMetrics
+	containsMetrics        *codegen.MethodMetrics
+	removeMetrics          *codegen.MethodMetrics
+	removeIfEmptyMetrics   *codegen.MethodMetrics
+	addItemMetrics         *codegen.MethodMetrics
+	removeItemMetrics      *codegen.MethodMetrics
+	setCartMetaMetrics     *codegen.MethodMetrics
+	getCartMetaMetrics     *codegen.MethodMetrics
+	getVersionedMetrics    *codegen.MethodMetrics
+	getChangesMetrics      *codegen.MethodMetrics
+}
+
+func (s cartCache_client_stub) Add(ctx context.Context, a0 string, a1 []CartItem) (err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.addMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.Add", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Encode arguments.
+	enc := codegen.NewPooledEncoder(0)
+	defer enc.Release()
+	enc.String(a0)
+	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, a1)
+
+	// Set the shardKey.
+	shardKey := _hashCartCache(_routerCartCache().Add(ctx, a0, a1))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	err = dec.Error()
+	return
+}
+
+func (s cartCache_client_stub) Get(ctx context.Context, a0 string) (r0 []CartItem, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.getMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.Get", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+
+	// Set the shardKey.
+	shardKey := _hashCartCache(_routerCartCache().Get(ctx, a0))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 3, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
+	err = dec.Error()
+	return
+}
+
+func (s cartCache_client_stub) GetWithMetadata(ctx context.Context, a0 string) (r0 []CartItem, r1 CartMeta, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.getWithMetadataMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.GetWithMetadata", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+
+	// Set the shardKey.
+	shardKey := _hashCartCache(_routerCartCache().GetWithMetadata(ctx, a0))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 7, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
+	(&r1).WeaverUnmarshal(dec)
+	err = dec.Error()
+	return
+}
+
+func (s cartCache_client_stub) Contains(ctx context.Context, a0 string) (r0 bool, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.containsMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.Contains", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+
+	// Set the shardKey.
+	shardKey := _hashCartCache(_routerCartCache().Contains(ctx, a0))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 2, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = dec.Bool()
+	err = dec.Error()
+	return
+}
+
+func (s cartCache_client_stub) Remove(ctx context.Context, a0 string) (r0 bool, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.removeMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.Remove", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+
+	// Set the shardKey.
+	shardKey := _hashCartCache(_routerCartCache().Remove(ctx, a0))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 8, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = dec.Bool()
+	err = dec.Error()
+	return
+}
+
+func (s cartCache_client_stub) RemoveIfEmpty(ctx context.Context, a0 string) (r0 bool, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.removeIfEmptyMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.RemoveIfEmpty", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+
+	// Set the shardKey.
+	shardKey := _hashCartCache(_routerCartCache().RemoveIfEmpty(ctx, a0))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 9, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = dec.Bool()
+	err = dec.Error()
+	return
+}
+
+func (s cartCache_client_stub) AddItem(ctx context.Context, a0 string, a1 string, a2 int32) (err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.addItemMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.AddItem", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += (4 + len(a1))
+	size += 4
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	enc.String(a1)
+	enc.Int32(a2)
+
+	// Set the shardKey.
+	shardKey := _hashCartCache(_routerCartCache().AddItem(ctx, a0, a1, a2))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 1, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	err = dec.Error()
+	return
+}
+
+func (s cartCache_client_stub) RemoveItem(ctx context.Context, a0 string, a1 string) (r0 bool, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.removeItemMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.RemoveItem", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += (4 + len(a1))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	enc.String(a1)
+
+	// Set the shardKey.
+	shardKey := _hashCartCache(_routerCartCache().RemoveItem(ctx, a0, a1))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 10, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = dec.Bool()
+	err = dec.Error()
+	return
+}
+
+func (s cartCache_client_stub) SetCartMeta(ctx context.Context, a0 string, a1 CartMeta) (err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.setCartMetaMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.SetCartMeta", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += serviceweaver_size_CartMeta_121bcd35(&a1)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	(a1).WeaverMarshal(enc)
+
+	// Set the shardKey.
+	shardKey := _hashCartCache(_routerCartCache().SetCartMeta(ctx, a0, a1))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 11, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	err = dec.Error()
+	return
+}
+
+func (s cartCache_client_stub) GetCartMeta(ctx context.Context, a0 string) (r0 CartMeta, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.getCartMetaMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.GetCartMeta", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
 
 	// Set the shardKey.
-	var r cartCacheRouter
-	shardKey := _hashCartCache(r.Remove(ctx, a0))
+	shardKey := _hashCartCache(_routerCartCache().GetCartMeta(ctx, a0))
 
 	// Call the remote method.
-	s.removeMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
-	results, err = s.stub.Run(ctx, 2, enc.Data(), shardKey)
+	results, err = s.stub.Run(ctx, 4, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.removeMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
-	r0 = dec.Bool()
+	(&r0).WeaverUnmarshal(dec)
+	err = dec.Error()
+	return
+}
+
+func (s cartCache_client_stub) GetVersioned(ctx context.Context, a0 string) (r0 []CartItem, r1 string, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.getVersionedMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.GetVersioned", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+
+	// Set the shardKey.
+	shardKey := _hashCartCache(_routerCartCache().GetVersioned(ctx, a0))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 6, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
+	r1 = dec.String()
+	err = dec.Error()
+	return
+}
+
+func (s cartCache_client_stub) GetChanges(ctx context.Context, a0 string, a1 string) (r0 []CartItem, r1 []CartItem, r2 []CartItem, r3 string, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.getChangesMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "cartservice.cartCache.GetChanges", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += (4 + len(a1))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	enc.String(a1)
+
+	// Set the shardKey.
+	shardKey := _hashCartCache(_routerCartCache().GetChanges(ctx, a0, a1))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 5, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
+	r1 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
+	r2 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
+	r3 = dec.String()
 	err = dec.Error()
 	return
 }
@@ -511,16 +1654,187 @@ func (s t_server_stub) GetStubFn(method string) func(ctx context.Context, args [
 	switch method {
 	case "AddItem":
 		return s.addItem
+	case "RemoveItem":
+		return s.removeItem
 	case "GetCart":
 		return s.getCart
+	case "GetCartWithMetadata":
+		return s.getCartWithMetadata
+	case "GetCartVersioned":
+		return s.getCartVersioned
+	case "GetCartChanges":
+		return s.getCartChanges
 	case "EmptyCart":
 		return s.emptyCart
+	case "SetCartMeta":
+		return s.setCartMeta
+	case "GetCartMeta":
+		return s.getCartMeta
 	default:
 		return nil
 	}
 }
 
-func (s t_server_stub) addItem(ctx context.Context, args []byte) (res []byte, err error) {
+func (s t_server_stub) addItem(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 CartItem
+	(&a1).WeaverUnmarshal(dec)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	appErr := s.impl.AddItem(ctx, a0, a1)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s t_server_stub) removeItem(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 string
+	a1 = dec.String()
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	appErr := s.impl.RemoveItem(ctx, a0, a1)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s t_server_stub) getCart(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, appErr := s.impl.GetCart(ctx, a0)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, r0)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s t_server_stub) getCartWithMetadata(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, r1, appErr := s.impl.GetCartWithMetadata(ctx, a0)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, r0)
+	(r1).WeaverMarshal(enc)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s t_server_stub) getCartVersioned(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, r1, appErr := s.impl.GetCartVersioned(ctx, a0)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, r0)
+	enc.String(r1)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s t_server_stub) getCartChanges(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 string
+	a1 = dec.String()
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, r1, r2, r3, appErr := s.impl.GetCartChanges(ctx, a0, a1)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, r0)
+	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, r1)
+	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, r2)
+	enc.String(r3)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s t_server_stub) emptyCart(ctx context.Context, args []byte) (res []byte, err error) {
 	// Catch and return any panics detected during encoding/decoding/rpc.
 	defer func() {
 		if err == nil {
@@ -532,13 +1846,11 @@ func (s t_server_stub) addItem(ctx context.Context, args []byte) (res []byte, er
 	dec := codegen.NewDecoder(args)
 	var a0 string
 	a0 = dec.String()
-	var a1 CartItem
-	(&a1).WeaverUnmarshal(dec)
 
 	// TODO(rgrandl): The deferred function above will recover from panics in the
 	// user code: fix this.
 	// Call the local method.
-	appErr := s.impl.AddItem(ctx, a0, a1)
+	appErr := s.impl.EmptyCart(ctx, a0)
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
@@ -546,7 +1858,7 @@ func (s t_server_stub) addItem(ctx context.Context, args []byte) (res []byte, er
 	return enc.Data(), nil
 }
 
-func (s t_server_stub) getCart(ctx context.Context, args []byte) (res []byte, err error) {
+func (s t_server_stub) setCartMeta(ctx context.Context, args []byte) (res []byte, err error) {
 	// Catch and return any panics detected during encoding/decoding/rpc.
 	defer func() {
 		if err == nil {
@@ -558,20 +1870,21 @@ func (s t_server_stub) getCart(ctx context.Context, args []byte) (res []byte, er
 	dec := codegen.NewDecoder(args)
 	var a0 string
 	a0 = dec.String()
+	var a1 CartMeta
+	(&a1).WeaverUnmarshal(dec)
 
 	// TODO(rgrandl): The deferred function above will recover from panics in the
 	// user code: fix this.
 	// Call the local method.
-	r0, appErr := s.impl.GetCart(ctx, a0)
+	appErr := s.impl.SetCartMeta(ctx, a0, a1)
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
-	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
 }
 
-func (s t_server_stub) emptyCart(ctx context.Context, args []byte) (res []byte, err error) {
+func (s t_server_stub) getCartMeta(ctx context.Context, args []byte) (res []byte, err error) {
 	// Catch and return any panics detected during encoding/decoding/rpc.
 	defer func() {
 		if err == nil {
@@ -587,10 +1900,14 @@ func (s t_server_stub) emptyCart(ctx context.Context, args []byte) (res []byte,
 	// TODO(rgrandl): The deferred function above will recover from panics in the
 	// user code: fix this.
 	// Call the local method.
-	appErr := s.impl.EmptyCart(ctx, a0)
+	r0, appErr := s.impl.GetCartMeta(ctx, a0)
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += serviceweaver_size_CartMeta_121bcd35(&r0)
+	enc.Reset(size)
+	(r0).WeaverMarshal(enc)
 	enc.Error(appErr)
 	return enc.Data(), nil
 }
@@ -607,8 +1924,26 @@ func (s cartCache_server_stub) GetStubFn(method string) func(ctx context.Context
 		return s.add
 	case "Get":
 		return s.get
+	case "GetWithMetadata":
+		return s.getWithMetadata
+	case "Contains":
+		return s.contains
 	case "Remove":
 		return s.remove
+	case "RemoveIfEmpty":
+		return s.removeIfEmpty
+	case "AddItem":
+		return s.addItem
+	case "RemoveItem":
+		return s.removeItem
+	case "SetCartMeta":
+		return s.setCartMeta
+	case "GetCartMeta":
+		return s.getCartMeta
+	case "GetVersioned":
+		return s.getVersioned
+	case "GetChanges":
+		return s.getChanges
 	default:
 		return nil
 	}
@@ -628,8 +1963,7 @@ func (s cartCache_server_stub) add(ctx context.Context, args []byte) (res []byte
 	a0 = dec.String()
 	var a1 []CartItem
 	a1 = serviceweaver_dec_slice_CartItem_7a7ff11c(dec)
-	var r cartCacheRouter
-	s.addLoad(_hashCartCache(r.Add(ctx, a0, a1)), 1.0)
+	s.addLoad(_hashCartCache(_routerCartCache().Add(ctx, a0, a1)), 1.0)
 
 	// TODO(rgrandl): The deferred function above will recover from panics in the
 	// user code: fix this.
@@ -654,8 +1988,7 @@ func (s cartCache_server_stub) get(ctx context.Context, args []byte) (res []byte
 	dec := codegen.NewDecoder(args)
 	var a0 string
 	a0 = dec.String()
-	var r cartCacheRouter
-	s.addLoad(_hashCartCache(r.Get(ctx, a0)), 1.0)
+	s.addLoad(_hashCartCache(_routerCartCache().Get(ctx, a0)), 1.0)
 
 	// TODO(rgrandl): The deferred function above will recover from panics in the
 	// user code: fix this.
@@ -669,6 +2002,62 @@ func (s cartCache_server_stub) get(ctx context.Context, args []byte) (res []byte
 	return enc.Data(), nil
 }
 
+func (s cartCache_server_stub) getWithMetadata(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	s.addLoad(_hashCartCache(_routerCartCache().GetWithMetadata(ctx, a0)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, r1, appErr := s.impl.GetWithMetadata(ctx, a0)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, r0)
+	(r1).WeaverMarshal(enc)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s cartCache_server_stub) contains(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	s.addLoad(_hashCartCache(_routerCartCache().Contains(ctx, a0)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, appErr := s.impl.Contains(ctx, a0)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += 1
+	enc.Reset(size)
+	enc.Bool(r0)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
 func (s cartCache_server_stub) remove(ctx context.Context, args []byte) (res []byte, err error) {
 	// Catch and return any panics detected during encoding/decoding/rpc.
 	defer func() {
@@ -681,8 +2070,7 @@ func (s cartCache_server_stub) remove(ctx context.Context, args []byte) (res []b
 	dec := codegen.NewDecoder(args)
 	var a0 string
 	a0 = dec.String()
-	var r cartCacheRouter
-	s.addLoad(_hashCartCache(r.Remove(ctx, a0)), 1.0)
+	s.addLoad(_hashCartCache(_routerCartCache().Remove(ctx, a0)), 1.0)
 
 	// TODO(rgrandl): The deferred function above will recover from panics in the
 	// user code: fix this.
@@ -691,11 +2079,217 @@ func (s cartCache_server_stub) remove(ctx context.Context, args []byte) (res []b
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += 1
+	enc.Reset(size)
+	enc.Bool(r0)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s cartCache_server_stub) removeIfEmpty(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	s.addLoad(_hashCartCache(_routerCartCache().RemoveIfEmpty(ctx, a0)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, appErr := s.impl.RemoveIfEmpty(ctx, a0)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += 1
+	enc.Reset(size)
+	enc.Bool(r0)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s cartCache_server_stub) addItem(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 string
+	a1 = dec.String()
+	var a2 int32
+	a2 = dec.Int32()
+	s.addLoad(_hashCartCache(_routerCartCache().AddItem(ctx, a0, a1, a2)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	appErr := s.impl.AddItem(ctx, a0, a1, a2)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s cartCache_server_stub) removeItem(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 string
+	a1 = dec.String()
+	s.addLoad(_hashCartCache(_routerCartCache().RemoveItem(ctx, a0, a1)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, appErr := s.impl.RemoveItem(ctx, a0, a1)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += 1
+	enc.Reset(size)
 	enc.Bool(r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
 }
 
+func (s cartCache_server_stub) setCartMeta(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 CartMeta
+	(&a1).WeaverUnmarshal(dec)
+	s.addLoad(_hashCartCache(_routerCartCache().SetCartMeta(ctx, a0, a1)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	appErr := s.impl.SetCartMeta(ctx, a0, a1)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s cartCache_server_stub) getCartMeta(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	s.addLoad(_hashCartCache(_routerCartCache().GetCartMeta(ctx, a0)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, appErr := s.impl.GetCartMeta(ctx, a0)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += serviceweaver_size_CartMeta_121bcd35(&r0)
+	enc.Reset(size)
+	(r0).WeaverMarshal(enc)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s cartCache_server_stub) getVersioned(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	s.addLoad(_hashCartCache(_routerCartCache().GetVersioned(ctx, a0)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, r1, appErr := s.impl.GetVersioned(ctx, a0)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, r0)
+	enc.String(r1)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s cartCache_server_stub) getChanges(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 string
+	a1 = dec.String()
+	s.addLoad(_hashCartCache(_routerCartCache().GetChanges(ctx, a0, a1)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, r1, r2, r3, appErr := s.impl.GetChanges(ctx, a0, a1)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, r0)
+	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, r1)
+	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, r2)
+	enc.String(r3)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
 // AutoMarshal implementations.
 
 var _ codegen.AutoMarshal = &CartItem{}
@@ -716,8 +2310,57 @@ func (x *CartItem) WeaverUnmarshal(dec *codegen.Decoder) {
 	x.Quantity = dec.Int32()
 }
 
+var _ codegen.AutoMarshal = &CartMeta{}
+
+func (x *CartMeta) WeaverMarshal(enc *codegen.Encoder) {
+	if x == nil {
+		panic(fmt.Errorf("CartMeta.WeaverMarshal: nil receiver"))
+	}
+	enc.String(x.Currency)
+	enc.String(x.Locale)
+	enc.String(x.UserID)
+}
+
+func (x *CartMeta) WeaverUnmarshal(dec *codegen.Decoder) {
+	if x == nil {
+		panic(fmt.Errorf("CartMeta.WeaverUnmarshal: nil receiver"))
+	}
+	x.Currency = dec.String()
+	x.Locale = dec.String()
+	x.UserID = dec.String()
+}
+
+func init() {
+	codegen.RegisterSerializable[CartItem]()
+	codegen.RegisterSerializable[CartMeta]()
+}
+
 // Router methods.
 
+// cartCache_router holds the routing methods of the cartCache component.
+type cartCache_router interface {
+	Add(ctx context.Context, a0 string, a1 []CartItem) string
+	Get(ctx context.Context, a0 string) string
+	GetWithMetadata(ctx context.Context, a0 string) string
+	Contains(ctx context.Context, a0 string) string
+	Remove(ctx context.Context, a0 string) string
+	RemoveIfEmpty(ctx context.Context, a0 string) string
+	AddItem(ctx context.Context, a0 string, a1 string, a2 int32) string
+	RemoveItem(ctx context.Context, a0 string, a1 string) string
+	SetCartMeta(ctx context.Context, a0 string, a1 CartMeta) string
+	GetCartMeta(ctx context.Context, a0 string) string
+	GetVersioned(ctx context.Context, a0 string) string
+	GetChanges(ctx context.Context, a0 string, a1 string) string
+}
+
+// _routerCartCache returns the router installed for the cartCache component.
+func _routerCartCache() cartCache_router {
+	if r, ok := codegen.Router("github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/cartCache").(cartCache_router); ok {
+		return r
+	}
+	return new(cartCacheRouter)
+}
+
 // _hashCartCache returns a 64 bit hash of the provided value.
 func _hashCartCache(r string) uint64 {
 	var h codegen.Hasher
@@ -768,3 +2411,14 @@ func serviceweaver_size_CartItem_e3591e56(x *CartItem) int {
 	size += 4
 	return size
 }
+
+// serviceweaver_size_CartMeta_121bcd35 returns the size (in bytes) of the serialization
+// of the provided type.
+func serviceweaver_size_CartMeta_121bcd35(x *CartMeta) int {
+	size := 0
+	size += 0
+	size += (4 + len(x.Currency))
+	size += (4 + len(x.Locale))
+	size += (4 + len(x.UserID))
+	return size
+}
@@ -24,7 +24,9 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return t_server_stub{impl: impl.(T), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"PlaceOrder": {"req"}},
 	})
+	codegen.RegisterRefs("github.com/ServiceWeaver/weaver/examples/onlineboutique/checkoutservice/T", "github.com/ServiceWeaver/weaver/examples/onlineboutique/cartservice/T", "github.com/ServiceWeaver/weaver/examples/onlineboutique/currencyservice/T", "github.com/ServiceWeaver/weaver/examples/onlineboutique/emailservice/T", "github.com/ServiceWeaver/weaver/examples/onlineboutique/paymentservice/T", "github.com/ServiceWeaver/weaver/examples/onlineboutique/productcatalogservice/T", "github.com/ServiceWeaver/weaver/examples/onlineboutique/shippingservice/T")
 }
 
 // Local stub implementations.
@@ -61,7 +63,8 @@ type t_client_stub struct {
 func (s t_client_stub) PlaceOrder(ctx context.Context, a0 PlaceOrderRequest) (r0 types.Order, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.placeOrderMetrics.Count.Add(1)
+	methodMetrics := s.placeOrderMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -79,26 +82,27 @@ func (s t_client_stub) PlaceOrder(ctx context.Context, a0 PlaceOrderRequest) (r0
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.placeOrderMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.placeOrderMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Encode arguments.
-	enc := codegen.NewEncoder()
+	enc := codegen.NewPooledEncoder(0)
+	defer enc.Release()
 	(a0).WeaverMarshal(enc)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.placeOrderMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.placeOrderMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -174,3 +178,7 @@ func (x *PlaceOrderRequest) WeaverUnmarshal(dec *codegen.Decoder) {
 	x.Email = dec.String()
 	(&x.CreditCard).WeaverUnmarshal(dec)
 }
+
+func init() {
+	codegen.RegisterSerializable[PlaceOrderRequest]()
+}
@@ -23,6 +23,7 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return t_server_stub{impl: impl.(T), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Convert": {"from", "toCode"}},
 	})
 }
 
@@ -78,7 +79,8 @@ type t_client_stub struct {
 func (s t_client_stub) GetSupportedCurrencies(ctx context.Context) (r0 []string, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getSupportedCurrenciesMetrics.Count.Add(1)
+	methodMetrics := s.getSupportedCurrenciesMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -96,23 +98,23 @@ func (s t_client_stub) GetSupportedCurrencies(ctx context.Context) (r0 []string,
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getSupportedCurrenciesMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getSupportedCurrenciesMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	var shardKey uint64
 
 	// Call the remote method.
-	s.getSupportedCurrenciesMetrics.BytesRequest.Put(0)
+	methodMetrics.BytesRequest.Put(0)
 	var results []byte
 	results, err = s.stub.Run(ctx, 1, nil, shardKey)
 	if err != nil {
 		return
 	}
-	s.getSupportedCurrenciesMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -124,7 +126,8 @@ func (s t_client_stub) GetSupportedCurrencies(ctx context.Context) (r0 []string,
 func (s t_client_stub) Convert(ctx context.Context, a0 money.T, a1 string) (r0 money.T, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.convertMetrics.Count.Add(1)
+	methodMetrics := s.convertMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -142,27 +145,28 @@ func (s t_client_stub) Convert(ctx context.Context, a0 money.T, a1 string) (r0 m
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.convertMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.convertMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Encode arguments.
-	enc := codegen.NewEncoder()
+	enc := codegen.NewPooledEncoder(0)
+	defer enc.Release()
 	(a0).WeaverMarshal(enc)
 	enc.String(a1)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.convertMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.convertMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
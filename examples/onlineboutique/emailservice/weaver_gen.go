@@ -23,6 +23,7 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return t_server_stub{impl: impl.(T), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"SendOrderConfirmation": {"email", "order"}},
 	})
 }
 
@@ -60,7 +61,8 @@ type t_client_stub struct {
 func (s t_client_stub) SendOrderConfirmation(ctx context.Context, a0 string, a1 types.Order) (err error) {
 	// Update metrics.
 	start := time.Now()
-	s.sendOrderConfirmationMetrics.Count.Add(1)
+	methodMetrics := s.sendOrderConfirmationMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -78,27 +80,28 @@ func (s t_client_stub) SendOrderConfirmation(ctx context.Context, a0 string, a1
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.sendOrderConfirmationMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.sendOrderConfirmationMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Encode arguments.
-	enc := codegen.NewEncoder()
+	enc := codegen.NewPooledEncoder(0)
+	defer enc.Release()
 	enc.String(a0)
 	(a1).WeaverMarshal(enc)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.sendOrderConfirmationMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.sendOrderConfirmationMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
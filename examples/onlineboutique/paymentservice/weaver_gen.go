@@ -24,6 +24,7 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return t_server_stub{impl: impl.(T), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Charge": {"amount", "card"}},
 	})
 }
 
@@ -61,7 +62,8 @@ type t_client_stub struct {
 func (s t_client_stub) Charge(ctx context.Context, a0 money.T, a1 CreditCardInfo) (r0 string, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.chargeMetrics.Count.Add(1)
+	methodMetrics := s.chargeMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -79,27 +81,28 @@ func (s t_client_stub) Charge(ctx context.Context, a0 money.T, a1 CreditCardInfo
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.chargeMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.chargeMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Encode arguments.
-	enc := codegen.NewEncoder()
+	enc := codegen.NewPooledEncoder(0)
+	defer enc.Release()
 	(a0).WeaverMarshal(enc)
 	(a1).WeaverMarshal(enc)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.chargeMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.chargeMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -147,6 +150,9 @@ func (s t_server_stub) charge(ctx context.Context, args []byte) (res []byte, err
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += (4 + len(r0))
+	enc.Reset(size)
 	enc.String(r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
@@ -175,3 +181,7 @@ func (x *CreditCardInfo) WeaverUnmarshal(dec *codegen.Decoder) {
 	x.ExpirationYear = dec.Int()
 	*(*int)(&x.ExpirationMonth) = dec.Int()
 }
+
+func init() {
+	codegen.RegisterSerializable[CreditCardInfo]()
+}
@@ -23,6 +23,7 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return t_server_stub{impl: impl.(T), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"GetProduct": {"productID"}, "SearchProducts": {"query"}},
 	})
 }
 
@@ -96,7 +97,8 @@ type t_client_stub struct {
 func (s t_client_stub) ListProducts(ctx context.Context) (r0 []Product, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.listProductsMetrics.Count.Add(1)
+	methodMetrics := s.listProductsMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -114,23 +116,23 @@ func (s t_client_stub) ListProducts(ctx context.Context) (r0 []Product, err erro
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.listProductsMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.listProductsMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	var shardKey uint64
 
 	// Call the remote method.
-	s.listProductsMetrics.BytesRequest.Put(0)
+	methodMetrics.BytesRequest.Put(0)
 	var results []byte
 	results, err = s.stub.Run(ctx, 1, nil, shardKey)
 	if err != nil {
 		return
 	}
-	s.listProductsMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -142,7 +144,8 @@ func (s t_client_stub) ListProducts(ctx context.Context) (r0 []Product, err erro
 func (s t_client_stub) GetProduct(ctx context.Context, a0 string) (r0 Product, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getProductMetrics.Count.Add(1)
+	methodMetrics := s.getProductMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -160,31 +163,31 @@ func (s t_client_stub) GetProduct(ctx context.Context, a0 string) (r0 Product, e
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getProductMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getProductMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.getProductMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.getProductMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -196,7 +199,8 @@ func (s t_client_stub) GetProduct(ctx context.Context, a0 string) (r0 Product, e
 func (s t_client_stub) SearchProducts(ctx context.Context, a0 string) (r0 []Product, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.searchProductsMetrics.Count.Add(1)
+	methodMetrics := s.searchProductsMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -214,31 +218,31 @@ func (s t_client_stub) SearchProducts(ctx context.Context, a0 string) (r0 []Prod
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.searchProductsMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.searchProductsMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.searchProductsMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 2, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.searchProductsMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -389,6 +393,10 @@ func serviceweaver_dec_slice_string_4af10117(dec *codegen.Decoder) []string {
 	return res
 }
 
+func init() {
+	codegen.RegisterSerializable[Product]()
+}
+
 // Encoding/decoding implementations.
 
 func serviceweaver_enc_slice_Product_3e9d9e07(enc *codegen.Encoder, arg []Product) {
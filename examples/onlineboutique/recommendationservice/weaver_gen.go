@@ -22,7 +22,9 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return t_server_stub{impl: impl.(T), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"ListRecommendations": {"userID", "productIDs"}},
 	})
+	codegen.RegisterRefs("github.com/ServiceWeaver/weaver/examples/onlineboutique/recommendationservice/T", "github.com/ServiceWeaver/weaver/examples/onlineboutique/productcatalogservice/T")
 }
 
 // Local stub implementations.
@@ -59,7 +61,8 @@ type t_client_stub struct {
 func (s t_client_stub) ListRecommendations(ctx context.Context, a0 string, a1 []string) (r0 []string, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.listRecommendationsMetrics.Count.Add(1)
+	methodMetrics := s.listRecommendationsMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -77,27 +80,28 @@ func (s t_client_stub) ListRecommendations(ctx context.Context, a0 string, a1 []
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.listRecommendationsMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.listRecommendationsMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Encode arguments.
-	enc := codegen.NewEncoder()
+	enc := codegen.NewPooledEncoder(0)
+	defer enc.Release()
 	enc.String(a0)
 	serviceweaver_enc_slice_string_4af10117(enc, a1)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.listRecommendationsMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.listRecommendationsMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
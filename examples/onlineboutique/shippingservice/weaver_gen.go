@@ -25,6 +25,7 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return t_server_stub{impl: impl.(T), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"GetQuote": {"addr", "items"}, "ShipOrder": {"addr", "items"}},
 	})
 }
 
@@ -80,7 +81,8 @@ type t_client_stub struct {
 func (s t_client_stub) GetQuote(ctx context.Context, a0 Address, a1 []cartservice.CartItem) (r0 money.T, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getQuoteMetrics.Count.Add(1)
+	methodMetrics := s.getQuoteMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -98,27 +100,28 @@ func (s t_client_stub) GetQuote(ctx context.Context, a0 Address, a1 []cartservic
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getQuoteMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getQuoteMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Encode arguments.
-	enc := codegen.NewEncoder()
+	enc := codegen.NewPooledEncoder(0)
+	defer enc.Release()
 	(a0).WeaverMarshal(enc)
 	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, a1)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.getQuoteMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.getQuoteMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -130,7 +133,8 @@ func (s t_client_stub) GetQuote(ctx context.Context, a0 Address, a1 []cartservic
 func (s t_client_stub) ShipOrder(ctx context.Context, a0 Address, a1 []cartservice.CartItem) (r0 string, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.shipOrderMetrics.Count.Add(1)
+	methodMetrics := s.shipOrderMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -148,27 +152,28 @@ func (s t_client_stub) ShipOrder(ctx context.Context, a0 Address, a1 []cartservi
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.shipOrderMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.shipOrderMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Encode arguments.
-	enc := codegen.NewEncoder()
+	enc := codegen.NewPooledEncoder(0)
+	defer enc.Release()
 	(a0).WeaverMarshal(enc)
 	serviceweaver_enc_slice_CartItem_7a7ff11c(enc, a1)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.shipOrderMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 1, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.shipOrderMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -245,6 +250,9 @@ func (s t_server_stub) shipOrder(ctx context.Context, args []byte) (res []byte,
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += (4 + len(r0))
+	enc.Reset(size)
 	enc.String(r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
@@ -276,6 +284,10 @@ func (x *Address) WeaverUnmarshal(dec *codegen.Decoder) {
 	x.ZipCode = dec.Int32()
 }
 
+func init() {
+	codegen.RegisterSerializable[Address]()
+}
+
 // Encoding/decoding implementations.
 
 func serviceweaver_enc_slice_CartItem_7a7ff11c(enc *codegen.Encoder, arg []cartservice.CartItem) {
@@ -34,3 +34,7 @@ func (x *T) WeaverUnmarshal(dec *codegen.Decoder) {
 	x.Units = dec.Int64()
 	x.Nanos = dec.Int32()
 }
+
+func init() {
+	codegen.RegisterSerializable[T]()
+}
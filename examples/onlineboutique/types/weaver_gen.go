@@ -79,3 +79,8 @@ func (x *OrderItem) WeaverUnmarshal(dec *codegen.Decoder) {
 	(&x.Item).WeaverUnmarshal(dec)
 	(&x.Cost).WeaverUnmarshal(dec)
 }
+
+func init() {
+	codegen.RegisterSerializable[Order]()
+	codegen.RegisterSerializable[OrderItem]()
+}
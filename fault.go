@@ -0,0 +1,105 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/faults"
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// faultsByComponent returns the faults that weavertest passed in ctx, if any,
+// indexed by component name. It fails if a fault refers to an unknown
+// component or method.
+func faultsByComponent(ctx context.Context, components map[string]*component) (map[string][]faults.Fault, error) {
+	fs, _ := ctx.Value(faults.Key{}).([]faults.Fault)
+	byComponent := map[string][]faults.Fault{}
+	for _, f := range fs {
+		c, ok := components[f.Component]
+		if !ok {
+			return nil, fmt.Errorf("fault for unknown component %q", f.Component)
+		}
+		if f.Method != "" {
+			if _, ok := c.info.Iface.MethodByName(f.Method); !ok {
+				return nil, fmt.Errorf("fault for unknown method %q of component %q", f.Method, f.Component)
+			}
+		}
+		byComponent[f.Component] = append(byComponent[f.Component], f)
+	}
+	return byComponent, nil
+}
+
+// networkFaults returns the faults that the deployer injects into the calls
+// to the provided component, hosted in another colocation group.
+func networkFaults(component string, nf *protos.NetworkFaults) []faults.Fault {
+	var fs []faults.Fault
+	if nf.DelayProbability > 0 {
+		fs = append(fs, faults.Fault{
+			Component:   component,
+			Probability: nf.DelayProbability,
+			Delay:       time.Duration(nf.DelayMicros) * time.Microsecond,
+		})
+	}
+	if nf.DropProbability > 0 {
+		fs = append(fs, faults.Fault{
+			Component:   component,
+			Probability: nf.DropProbability,
+			Drop:        true,
+		})
+	}
+	return fs
+}
+
+// methodFaults returns the faults that apply to the named method.
+func methodFaults(fs []faults.Fault, method string) []faults.Fault {
+	var matching []faults.Fault
+	for _, f := range fs {
+		if f.Method == "" || f.Method == method {
+			matching = append(matching, f)
+		}
+	}
+	return matching
+}
+
+// injectFaults applies the provided faults to a call, in order. It returns a
+// non-nil error if the call should fail instead of being made.
+func injectFaults(ctx context.Context, fs []faults.Fault) error {
+	for _, f := range fs {
+		if f.Probability > 0 && rand.Float64() >= f.Probability {
+			continue
+		}
+		if f.Delay > 0 {
+			t := time.NewTimer(f.Delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+		}
+		if f.Error != nil {
+			return f.Error
+		}
+		if f.Drop {
+			return fmt.Errorf("%w: call dropped by an injected fault", call.CommunicationError)
+		}
+	}
+	return nil
+}
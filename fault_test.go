@@ -0,0 +1,68 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/faults"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInjectFaultsProbability(t *testing.T) {
+	errInjected := errors.New("injected")
+	fs := []faults.Fault{{Probability: 0.25, Error: errInjected}}
+	const n = 10000
+	failed := 0
+	for i := 0; i < n; i++ {
+		if err := injectFaults(context.Background(), fs); err != nil {
+			failed++
+		}
+	}
+	if failed < n/5 || failed > n*3/10 {
+		t.Fatalf("got %d failed calls out of %d, want about %d", failed, n, n/4)
+	}
+}
+
+func TestInjectFaultsDelay(t *testing.T) {
+	fs := []faults.Fault{{Delay: time.Minute}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := injectFaults(ctx, fs); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestNetworkFaults(t *testing.T) {
+	nf := &protos.NetworkFaults{DelayProbability: 0.1, DelayMicros: 5000, DropProbability: 0.01}
+	got := networkFaults("Cart", nf)
+	want := []faults.Fault{
+		{Component: "Cart", Probability: 0.1, Delay: 5 * time.Millisecond},
+		{Component: "Cart", Probability: 0.01, Drop: true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("networkFaults (-want +got):\n%s", diff)
+	}
+
+	// Faults with a zero probability are omitted, rather than applied to
+	// every call.
+	if got := networkFaults("Cart", &protos.NetworkFaults{DelayMicros: 5000}); len(got) != 0 {
+		t.Fatalf("networkFaults: got %v, want none", got)
+	}
+}
@@ -0,0 +1,530 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphqlgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// executor executes an operation.
+type executor struct {
+	schema  *schema
+	doc     *document
+	defined map[string]bool // defined variables
+	vars    map[string]any  // values of the variables
+}
+
+// call is a call to the method of a top level field.
+type call struct {
+	key      string
+	field    *rootField // nil for __typename
+	typename string     // value of __typename
+	args     []reflect.Value
+	sels     []*selection
+}
+
+// field is a set of field selections with the same response key, which are
+// merged into a single response field.
+type field struct {
+	key  string
+	sels []*selection
+}
+
+// subselections returns the merged selections of the field.
+func (f *field) subselections() []*selection {
+	var sels []*selection
+	for _, s := range f.sels {
+		sels = append(sels, s.sels...)
+	}
+	return sels
+}
+
+// execute executes a request. If readOnly is true, mutations are rejected.
+func execute(ctx context.Context, s *schema, req Request, readOnly bool) Response {
+	fail := func(err error) Response {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	doc, err := parse(req.Query)
+	if err != nil {
+		return fail(err)
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return fail(err)
+	}
+	root := s.query
+	if op.kind == "mutation" {
+		if readOnly {
+			return fail(fmt.Errorf("mutations are not allowed in GET requests"))
+		}
+		if len(s.mutation.fields) == 0 {
+			return fail(fmt.Errorf("the schema has no mutations"))
+		}
+		root = s.mutation
+	}
+	e := &executor{schema: s, doc: doc, defined: map[string]bool{}, vars: map[string]any{}}
+	if err := e.coerceVariables(op, req.Variables); err != nil {
+		return fail(err)
+	}
+	calls, err := e.plan(root, op.sels)
+	if err != nil {
+		return fail(err)
+	}
+
+	// Resolve the top level fields: concurrently for queries, and serially
+	// for mutations.
+	values := make([]any, len(calls))
+	errs := make([]*Error, len(calls))
+	if op.kind == "query" {
+		var wg sync.WaitGroup
+		for i, c := range calls {
+			i, c := i, c
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				values[i], errs[i] = e.run(ctx, c)
+			}()
+		}
+		wg.Wait()
+	} else {
+		for i, c := range calls {
+			values[i], errs[i] = e.run(ctx, c)
+		}
+	}
+
+	var resp Response
+	data := make(object, len(calls))
+	for i, c := range calls {
+		data[i] = member{c.key, values[i]}
+		if errs[i] != nil {
+			resp.Errors = append(resp.Errors, *errs[i])
+		}
+	}
+	if resp.Data, err = json.Marshal(data); err != nil {
+		return fail(err)
+	}
+	return resp
+}
+
+// operation returns the operation with the provided name, or the only
+// operation of the document if name is empty.
+func (d *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, fmt.Errorf("an operation name is required for documents with more than one operation")
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// coerceVariables sets the values of the variables of op from the provided
+// values and the variable defaults.
+func (e *executor) coerceVariables(op *operation, values map[string]any) error {
+	for _, v := range op.vars {
+		if e.defined[v.name] {
+			return fmt.Errorf("duplicate variable $%s", v.name)
+		}
+		e.defined[v.name] = true
+		required := strings.HasSuffix(v.typ, "!")
+		value, ok := values[v.name]
+		switch {
+		case ok && value == nil && required:
+			return fmt.Errorf("variable $%s of type %s must not be null", v.name, v.typ)
+		case ok:
+			e.vars[v.name] = value
+		case v.hasDef:
+			e.vars[v.name] = v.def
+		case required:
+			return fmt.Errorf("variable $%s of type %s was not provided", v.name, v.typ)
+		}
+	}
+	return nil
+}
+
+// value returns the value of a parsed value, replacing variables with their
+// values. It returns false if v is a variable without a value.
+func (e *executor) value(v any) (any, bool, error) {
+	switch x := v.(type) {
+	case variable:
+		if !e.defined[string(x)] {
+			return nil, false, fmt.Errorf("variable $%s is not defined", x)
+		}
+		value, ok := e.vars[string(x)]
+		return value, ok, nil
+	case []any:
+		list := make([]any, len(x))
+		for i, elem := range x {
+			var err error
+			if list[i], _, err = e.value(elem); err != nil {
+				return nil, false, err
+			}
+		}
+		return list, true, nil
+	case map[string]any:
+		obj := make(map[string]any, len(x))
+		for k, elem := range x {
+			value, ok, err := e.value(elem)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				obj[k] = value
+			}
+		}
+		return obj, true, nil
+	default:
+		return v, true, nil
+	}
+}
+
+// include evaluates the @skip and @include directives.
+func (e *executor) include(directives []*directive) (bool, error) {
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			return false, fmt.Errorf("unknown directive @%s", d.name)
+		}
+		v, _, err := e.value(d.args["if"])
+		if err != nil {
+			return false, err
+		}
+		b, ok := v.(bool)
+		if !ok || len(d.args) != 1 {
+			return false, fmt.Errorf("@%s requires a Boolean if argument", d.name)
+		}
+		if b == (d.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// collect returns the fields selected by sels on the provided type, after
+// expanding fragments and evaluating directives.
+func (e *executor) collect(sels []*selection, typeName string) ([]*field, error) {
+	var fields []*field
+	byKey := map[string]*field{}
+	spreading := map[string]bool{}
+	var walk func([]*selection) error
+	walk = func(sels []*selection) error {
+		for _, s := range sels {
+			include, err := e.include(s.directives)
+			if err != nil {
+				return err
+			}
+			if !include {
+				continue
+			}
+			switch s.kind {
+			case fieldSelection:
+				f, ok := byKey[s.key()]
+				if !ok {
+					f = &field{key: s.key()}
+					byKey[f.key] = f
+					fields = append(fields, f)
+				} else if f.sels[0].name != s.name {
+					return fmt.Errorf("fields %q conflict because %s and %s are different fields", f.key, f.sels[0].name, s.name)
+				}
+				f.sels = append(f.sels, s)
+			case spreadSelection:
+				frag, ok := e.doc.fragments[s.name]
+				if !ok {
+					return fmt.Errorf("unknown fragment %q", s.name)
+				}
+				if frag.on != typeName {
+					return fmt.Errorf("fragment %q on %s cannot be spread on type %s", s.name, frag.on, typeName)
+				}
+				if spreading[s.name] {
+					return fmt.Errorf("fragment %q spreads itself", s.name)
+				}
+				spreading[s.name] = true
+				if err := walk(frag.sels); err != nil {
+					return err
+				}
+				delete(spreading, s.name)
+			case inlineSelection:
+				if s.on != "" && s.on != typeName {
+					return fmt.Errorf("fragment on %s cannot be spread on type %s", s.on, typeName)
+				}
+				if err := walk(s.sels); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(sels); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// plan returns the calls of the top level fields selected by sels, after
+// validating the selections and the arguments.
+func (e *executor) plan(root *rootType, sels []*selection) ([]*call, error) {
+	fields, err := e.collect(sels, root.name)
+	if err != nil {
+		return nil, err
+	}
+	var calls []*call
+	for _, f := range fields {
+		s := f.sels[0]
+		c := &call{key: f.key, sels: f.subselections()}
+		switch s.name {
+		case "__typename":
+			if err := e.check(s.name, nil, c.sels); err != nil {
+				return nil, err
+			}
+			c.typename = root.name
+			calls = append(calls, c)
+			continue
+		case "__schema", "__type":
+			return nil, fmt.Errorf("introspection is not supported")
+		}
+		rf, ok := root.byName[s.name]
+		if !ok {
+			return nil, fmt.Errorf("cannot query field %q on type %q", s.name, root.name)
+		}
+		c.field = rf
+		for _, other := range f.sels[1:] {
+			if !reflect.DeepEqual(other.args, s.args) {
+				return nil, fmt.Errorf("fields %q conflict because they have different arguments", f.key)
+			}
+		}
+		if c.args, err = e.args(rf, s.args); err != nil {
+			return nil, err
+		}
+		if err := e.check(s.name, rf.result, c.sels); err != nil {
+			return nil, err
+		}
+		calls = append(calls, c)
+	}
+	return calls, nil
+}
+
+// args returns the method arguments, excluding the context, of a top level
+// field.
+func (e *executor) args(f *rootField, given map[string]any) ([]reflect.Value, error) {
+	for name := range given {
+		found := false
+		for _, a := range f.args {
+			found = found || a.name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown argument %q on field %q", name, f.name)
+		}
+	}
+	args := make([]reflect.Value, len(f.args))
+	for i, a := range f.args {
+		v := reflect.New(a.t)
+		value, ok, err := e.value(given[a.name])
+		if err != nil {
+			return nil, err
+		}
+		if value == nil || !ok {
+			if strings.HasSuffix(a.typ, "!") {
+				return nil, fmt.Errorf("argument %q of type %s on field %q is required", a.name, a.typ, f.name)
+			}
+		} else {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("argument %q on field %q: %w", a.name, f.name, err)
+			}
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(v.Interface()); err != nil {
+				return nil, fmt.Errorf("argument %q on field %q: %w", a.name, f.name, err)
+			}
+		}
+		args[i] = v.Elem()
+	}
+	return args, nil
+}
+
+// check validates the selections of a field with values of type t. t is nil
+// for fields without a Go type.
+func (e *executor) check(name string, t reflect.Type, sels []*selection) error {
+	var obj *objectType
+	if t != nil {
+		obj = e.schema.objectOf(t)
+	}
+	if obj == nil {
+		if len(sels) > 0 {
+			return fmt.Errorf("field %q must not have a selection since its type is a scalar", name)
+		}
+		return nil
+	}
+	if len(sels) == 0 {
+		return fmt.Errorf("field %q of type %s must have a selection of subfields", name, obj.name)
+	}
+	fields, err := e.collect(sels, obj.name)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		s := f.sels[0]
+		for _, s := range f.sels {
+			for arg := range s.args {
+				return fmt.Errorf("unknown argument %q on field %q", arg, s.name)
+			}
+		}
+		if s.name == "__typename" {
+			if err := e.check(s.name, nil, f.subselections()); err != nil {
+				return err
+			}
+			continue
+		}
+		of, ok := obj.byName[s.name]
+		if !ok {
+			return fmt.Errorf("cannot query field %q on type %q", s.name, obj.name)
+		}
+		if err := e.check(s.name, of.t, f.subselections()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run resolves a top level field by calling its method.
+func (e *executor) run(ctx context.Context, c *call) (any, *Error) {
+	if c.field == nil {
+		return c.typename, nil
+	}
+	args := append([]reflect.Value{reflect.ValueOf(ctx)}, c.args...)
+	results := c.field.fn.Call(args)
+	if err, _ := results[len(results)-1].Interface().(error); err != nil {
+		return nil, &Error{Message: err.Error(), Path: []any{c.key}}
+	}
+	var v reflect.Value
+	switch c.field.results {
+	case 0:
+		return true, nil
+	case 1:
+		v = results[0]
+	default:
+		v = reflect.New(c.field.result).Elem()
+		for i := 0; i < c.field.results; i++ {
+			v.Field(i).Set(results[i])
+		}
+	}
+	out, err := e.complete(v, c.sels)
+	if err != nil {
+		return nil, &Error{Message: err.Error(), Path: []any{c.key}}
+	}
+	return out, nil
+}
+
+// complete returns the response value of v for the provided selections.
+func (e *executor) complete(v reflect.Value, sels []*selection) (any, error) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return e.complete(v.Elem(), sels)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		list := make([]any, v.Len())
+		for i := range list {
+			var err error
+			if list[i], err = e.complete(v.Index(i), sels); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case reflect.Struct:
+		if obj, ok := e.schema.outputs[v.Type()]; ok {
+			return e.completeObject(obj, v, sels)
+		}
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(data), nil
+}
+
+// completeObject returns the response object of the struct v of the
+// provided object type.
+func (e *executor) completeObject(obj *objectType, v reflect.Value, sels []*selection) (any, error) {
+	fields, err := e.collect(sels, obj.name)
+	if err != nil {
+		return nil, err
+	}
+	out := make(object, len(fields))
+	for i, f := range fields {
+		name := f.sels[0].name
+		if name == "__typename" {
+			out[i] = member{f.key, obj.name}
+			continue
+		}
+		var value any
+		// FieldByIndexErr fails if the field is promoted through a nil
+		// embedded pointer, in which case the field is null.
+		if fv, err := v.FieldByIndexErr(obj.byName[name].index); err == nil {
+			if value, err = e.complete(fv, f.subselections()); err != nil {
+				return nil, err
+			}
+		}
+		out[i] = member{f.key, value}
+	}
+	return out, nil
+}
+
+// object is a JSON object whose members are encoded in order.
+type object []member
+
+// member is a member of a JSON object.
+type member struct {
+	key   string
+	value any
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,277 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graphqlgateway exposes Service Weaver components through a single
+// GraphQL endpoint, so that clients can query several components in one round
+// trip.
+//
+// The methods to expose are annotated in the component interface as query or
+// mutation fields, optionally followed by the name of the field. By default, a
+// field is named after its method, e.g., "recommend" for Recommend.
+//
+//	type Catalog interface {
+//		//weaver:graphql query product
+//		Get(ctx context.Context, id string) (Product, error)
+//	}
+//
+//	type Cart interface {
+//		//weaver:graphql query cart
+//		Items(ctx context.Context, user string) ([]Item, error)
+//
+//		//weaver:graphql mutation addToCart
+//		Add(ctx context.Context, user string, item Item) error
+//	}
+//
+// "weaver generate" records the annotations. The arguments of a field are the
+// parameters of its method, excluding the context, and its type is the result
+// of the method:
+//
+//   - Booleans, integers, floating point numbers, and strings are Boolean,
+//     Int, Float, and String. Byte slices are base64 encoded strings, and
+//     time.Time values are RFC 3339 strings.
+//   - Structs are object types (or input types, when used as arguments) named
+//     after the struct. Their fields are named after the JSON name of the
+//     struct fields, or the struct field name with a lowercase initial.
+//   - Slices and arrays are lists, and pointers are nullable.
+//   - Maps are values of the JSON scalar type.
+//
+// A method without results returns true. If a method has more than one result
+// besides the error, the field's type is an object type with fields result0,
+// result1, and so on.
+//
+// The top level fields of a query are resolved concurrently, so a query like
+// the following issues its component calls in parallel:
+//
+//	query {
+//		product(id: "p1") { name price }
+//		cart(user: "alice") { productID quantity }
+//	}
+//
+// The top level fields of a mutation are resolved one after another. Queries
+// may use variables, aliases, fragments, and the @skip and @include
+// directives. Introspection, besides __typename, is not supported; the schema
+// is instead served in the GraphQL schema language.
+//
+// For example, in the Init method of a component:
+//
+//	catalog, err := weaver.Get[Catalog](c)
+//	...
+//	cart, err := weaver.Get[Cart](c)
+//	...
+//	gateway, err := graphqlgateway.New(graphqlgateway.Options{},
+//		graphqlgateway.Export("Catalog", catalog),
+//		graphqlgateway.Export("Cart", cart))
+//	...
+//	lis, err := c.Listener("graphql", weaver.ListenerOptions{})
+//	...
+//	go http.Serve(lis, gateway)
+//
+// Requests are served at /graphql and the schema at /schema.graphql by
+// default.
+package graphqlgateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+)
+
+// maxBodySize is the maximum size of a request body.
+const maxBodySize = 4 << 20
+
+// Options configures a Gateway.
+type Options struct {
+	// Path is the path where GraphQL requests are served. If empty, defaults
+	// to "/graphql".
+	Path string
+
+	// SchemaPath is the path where the schema is served. If empty, defaults
+	// to "/schema.graphql".
+	SchemaPath string
+}
+
+// A Service is a component exported through a Gateway.
+type Service struct {
+	name   string
+	iface  reflect.Type
+	impl   any
+	params map[string][]string // parameter names, by method
+	fields map[string]string   // GraphQL fields, by method
+}
+
+// Export exports the annotated methods of the component impl, typically
+// returned by weaver.Get. The name of the service is used in error messages.
+func Export[T any](name string, impl T) Service {
+	iface := reflect.TypeOf((*T)(nil)).Elem()
+	svc := Service{name: name, iface: iface, impl: impl}
+	for _, reg := range codegen.Registered() {
+		if reg.Iface == iface {
+			svc.params = reg.ParamNames
+			svc.fields = reg.GraphQLFields
+		}
+	}
+	return svc
+}
+
+// A Gateway is an http.Handler that serves GraphQL requests for the
+// annotated methods of a set of components.
+type Gateway struct {
+	schema     *schema
+	sdl        string
+	path       string
+	schemaPath string
+}
+
+var _ http.Handler = &Gateway{}
+
+// New returns a gateway for the annotated methods of the provided services.
+// It returns an error if a method can't be exposed as described in the
+// package documentation, or if there are no query fields.
+func New(opts Options, services ...Service) (*Gateway, error) {
+	g := &Gateway{path: opts.Path, schemaPath: opts.SchemaPath}
+	if g.path == "" {
+		g.path = "/graphql"
+	}
+	if g.schemaPath == "" {
+		g.schemaPath = "/schema.graphql"
+	}
+	s := newSchema()
+	for _, svc := range services {
+		if svc.iface.Kind() != reflect.Interface {
+			return nil, fmt.Errorf("graphqlgateway: %s: %v is not an interface", svc.name, svc.iface)
+		}
+		names := make([]string, 0, len(svc.fields))
+		for name := range svc.fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := s.addRootField(svc, name); err != nil {
+				return nil, fmt.Errorf("graphqlgateway: %s.%s: %w", svc.name, name, err)
+			}
+		}
+	}
+	if len(s.query.fields) == 0 {
+		return nil, fmt.Errorf("graphqlgateway: no query fields")
+	}
+	g.schema = s
+	g.sdl = s.sdl()
+	return g, nil
+}
+
+// Schema returns the schema of the gateway in the GraphQL schema language.
+func (g *Gateway) Schema() string {
+	return g.sdl
+}
+
+// A Request is a GraphQL request.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// A Response is a GraphQL response. Data is absent if the request could not
+// be executed, e.g., because the query is invalid.
+type Response struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []Error         `json:"errors,omitempty"`
+}
+
+// An Error is an error in a GraphQL response. Path is the path of the
+// response field that failed, if any, e.g., ["product"].
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// Execute executes a GraphQL request.
+func (g *Gateway) Execute(ctx context.Context, req Request) Response {
+	return execute(ctx, g.schema, req, false)
+}
+
+// ServeHTTP implements the http.Handler interface. Requests are either POST
+// requests with a JSON encoded Request body, or GET requests with query,
+// operationName, and variables query parameters. Mutations are not allowed in
+// GET requests.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == g.schemaPath && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, g.sdl)
+		return
+	case r.URL.Path != g.path:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s not found", r.URL.Path))
+		return
+	}
+
+	var req Request
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("decode variables: %w", err))
+				return
+			}
+		}
+	case http.MethodPost:
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("read body: %w", err))
+			return
+		}
+		if len(data) > maxBodySize {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("body exceeds %d bytes", maxBodySize))
+			return
+		}
+		if err := json.Unmarshal(data, &req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("decode body: %w", err))
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	resp := execute(r.Context(), g.schema, req, r.Method == http.MethodGet)
+	data, err := json.Marshal(resp)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("encode response: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Data == nil {
+		// The request could not be executed.
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	w.Write(data)
+}
+
+// writeError writes an error response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	data, _ := json.Marshal(Response{Errors: []Error{{Message: err.Error()}}})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
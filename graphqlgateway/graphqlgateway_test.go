@@ -0,0 +1,425 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphqlgateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/google/go-cmp/cmp"
+)
+
+type Product struct {
+	weaver.AutoMarshal
+	ID    string   `json:"id"`
+	Name  string   `json:"name"`
+	Price float64  `json:"price"`
+	Tags  []string `json:"tags"`
+}
+
+type Item struct {
+	weaver.AutoMarshal
+	ProductID string
+	Quantity  int
+}
+
+type catalog interface {
+	Get(ctx context.Context, id string) (*Product, error)
+	Search(ctx context.Context, query string, limit int) ([]Product, error)
+}
+
+type cart interface {
+	Items(ctx context.Context, user string) ([]Item, error)
+	Add(ctx context.Context, user string, item Item) (int, bool, error)
+	Clear(ctx context.Context, user string) error
+}
+
+type recommendations interface {
+	Recommend(ctx context.Context, user string) ([]string, error)
+}
+
+type catalogImpl struct {
+	wait func() // if not nil, called by every method
+}
+
+func (c catalogImpl) Get(_ context.Context, id string) (*Product, error) {
+	if c.wait != nil {
+		c.wait()
+	}
+	switch id {
+	case "missing":
+		return nil, nil
+	case "broken":
+		return nil, weaver.ErrRetriable
+	}
+	return &Product{ID: id, Name: "shoe", Price: 9.5, Tags: []string{"red"}}, nil
+}
+
+func (c catalogImpl) Search(_ context.Context, query string, limit int) ([]Product, error) {
+	if c.wait != nil {
+		c.wait()
+	}
+	var ps []Product
+	for i := 0; i < limit; i++ {
+		ps = append(ps, Product{Name: query})
+	}
+	return ps, nil
+}
+
+type cartImpl struct {
+	mu    sync.Mutex
+	items map[string][]Item
+	calls []string
+}
+
+func (c *cartImpl) Items(_ context.Context, user string) ([]Item, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.items[user], nil
+}
+
+func (c *cartImpl) Add(_ context.Context, user string, item Item) (int, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item.ProductID == "" {
+		return 0, false, errors.New("missing product")
+	}
+	c.calls = append(c.calls, "add "+item.ProductID)
+	c.items[user] = append(c.items[user], item)
+	return len(c.items[user]), len(c.items[user]) == 1, nil
+}
+
+func (c *cartImpl) Clear(_ context.Context, user string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, "clear")
+	delete(c.items, user)
+	return nil
+}
+
+type recommendationsImpl struct{}
+
+func (recommendationsImpl) Recommend(_ context.Context, user string) ([]string, error) {
+	return []string{user + "-p1", user + "-p2"}, nil
+}
+
+func newTestGateway(t *testing.T, c catalogImpl, ci *cartImpl) *Gateway {
+	t.Helper()
+	// The parameter names and fields are usually recorded by
+	// "weaver generate".
+	catalogSvc := Export[catalog]("Catalog", c)
+	catalogSvc.params = map[string][]string{"Get": {"id"}, "Search": {"query", "limit"}}
+	catalogSvc.fields = map[string]string{"Get": "query product", "Search": "query"}
+	cartSvc := Export[cart]("Cart", ci)
+	cartSvc.params = map[string][]string{"Items": {"user"}, "Add": {"user", "item"}, "Clear": {"user"}}
+	cartSvc.fields = map[string]string{"Items": "query cart", "Add": "mutation addToCart", "Clear": "mutation clearCart"}
+	recsSvc := Export[recommendations]("Recommendations", recommendationsImpl{})
+	recsSvc.params = map[string][]string{"Recommend": {"user"}}
+	recsSvc.fields = map[string]string{"Recommend": "query"}
+	g, err := New(Options{}, catalogSvc, cartSvc, recsSvc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestSchema(t *testing.T) {
+	g := newTestGateway(t, catalogImpl{}, &cartImpl{})
+	want := `type Query {
+  product(id: String!): Product
+  search(query: String!, limit: Int!): [Product!]
+  cart(user: String!): [Item!]
+  recommend(user: String!): [String!]
+}
+
+type Mutation {
+  addToCart(user: String!, item: ItemInput!): AddToCartResult
+  clearCart(user: String!): Boolean
+}
+
+type Product {
+  id: String!
+  name: String!
+  price: Float!
+  tags: [String!]!
+}
+
+input ItemInput {
+  productID: String
+  quantity: Int
+}
+
+type AddToCartResult {
+  result0: Int!
+  result1: Boolean!
+}
+
+type Item {
+  productID: String!
+  quantity: Int!
+}
+`
+	if diff := cmp.Diff(want, g.Schema()); diff != "" {
+		t.Fatalf("schema (-want +got):\n%s", diff)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	ci := &cartImpl{items: map[string][]Item{"alice": {{ProductID: "p1", Quantity: 2}}}}
+	g := newTestGateway(t, catalogImpl{}, ci)
+	query := `
+		# Everything the cart page needs, in one round trip.
+		query CartPage($user: String!, $withTags: Boolean = false) {
+			__typename
+			cart(user: $user) { productID quantity }
+			product(id: "p1") { ...productFields }
+			recs: recommend(user: $user)
+			missing: product(id: "missing") { id }
+			search(query: "hat", limit: 2) {
+				name
+				... on Product { __typename }
+			}
+		}
+
+		fragment productFields on Product {
+			id
+			name
+			tags @include(if: $withTags)
+			label: name
+		}
+	`
+	resp := g.Execute(context.Background(), Request{Query: query, Variables: map[string]any{"user": "alice"}})
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+	want := `{"__typename":"Query","cart":[{"productID":"p1","quantity":2}],"product":{"id":"p1","name":"shoe","label":"shoe"},"recs":["alice-p1","alice-p2"],"missing":null,"search":[{"name":"hat","__typename":"Product"},{"name":"hat","__typename":"Product"}]}`
+	if got := string(resp.Data); got != want {
+		t.Fatalf("data: got %s, want %s", got, want)
+	}
+}
+
+func TestQueryFieldsResolvedConcurrently(t *testing.T) {
+	// Every call waits for the other call to start, so the query only
+	// completes if the fields are resolved concurrently.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	wait := func() {
+		wg.Done()
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			panic("fields not resolved concurrently")
+		}
+	}
+	g := newTestGateway(t, catalogImpl{wait: wait}, &cartImpl{})
+	resp := g.Execute(context.Background(), Request{Query: `{ product(id: "p1") { id } search(query: "x", limit: 1) { name } }`})
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+}
+
+func TestMutation(t *testing.T) {
+	ci := &cartImpl{items: map[string][]Item{}}
+	g := newTestGateway(t, catalogImpl{}, ci)
+	query := `mutation ($item: ItemInput!) {
+		clearCart(user: "bob")
+		first: addToCart(user: "bob", item: {productID: "p1", quantity: 1}) { result0 result1 }
+		second: addToCart(user: "bob", item: $item) { result0 result1 }
+	}`
+	resp := g.Execute(context.Background(), Request{
+		Query:     query,
+		Variables: map[string]any{"item": map[string]any{"productID": "p2", "quantity": 3}},
+	})
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+	want := `{"clearCart":true,"first":{"result0":1,"result1":true},"second":{"result0":2,"result1":false}}`
+	if got := string(resp.Data); got != want {
+		t.Fatalf("data: got %s, want %s", got, want)
+	}
+	if diff := cmp.Diff([]string{"clear", "add p1", "add p2"}, ci.calls); diff != "" {
+		t.Fatalf("calls (-want +got):\n%s", diff)
+	}
+}
+
+func TestFieldErrors(t *testing.T) {
+	g := newTestGateway(t, catalogImpl{}, &cartImpl{})
+	resp := g.Execute(context.Background(), Request{Query: `{ a: product(id: "broken") { id } b: product(id: "p1") { id } }`})
+	if got, want := string(resp.Data), `{"a":null,"b":{"id":"p1"}}`; got != want {
+		t.Fatalf("data: got %s, want %s", got, want)
+	}
+	want := []Error{{Message: weaver.ErrRetriable.Error(), Path: []any{"a"}}}
+	if diff := cmp.Diff(want, resp.Errors); diff != "" {
+		t.Fatalf("errors (-want +got):\n%s", diff)
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	g := newTestGateway(t, catalogImpl{}, &cartImpl{})
+	for _, test := range []struct {
+		query string
+		want  string
+	}{
+		{`{ product(id: "p1") { id }`, "unexpected end of document"},
+		{`{ product(id: "p1") { id } } { cart(user: "a") { quantity } }`, "operation name is required"},
+		{`{ products { id } }`, `cannot query field "products" on type "Query"`},
+		{`{ product(id: "p1") { sku } }`, `cannot query field "sku" on type "Product"`},
+		{`{ product(id: "p1") }`, `must have a selection of subfields`},
+		{`{ recommend(user: "a") { id } }`, `must not have a selection`},
+		{`{ product { id } }`, `argument "id" of type String! on field "product" is required`},
+		{`{ product(id: "p1", sku: 1) { id } }`, `unknown argument "sku"`},
+		{`{ product(id: 1) { id } }`, `argument "id" on field "product"`},
+		{`{ product(id: $id) { id } }`, `variable $id is not defined`},
+		{`query ($id: String!) { product(id: $id) { id } }`, `variable $id of type String! was not provided`},
+		{`{ product(id: "p1") { ...f } } fragment f on Item { quantity }`, `cannot be spread on type Product`},
+		{`{ product(id: "p1") { ...f } } fragment f on Product { ...f }`, `spreads itself`},
+		{`{ product(id: "p1") { id @deprecated } }`, `unknown directive @deprecated`},
+		{`{ x: product(id: "p1") { id } x: search(query: "a", limit: 1) { id } }`, `different fields`},
+		{`{ __schema { types { name } } }`, `introspection is not supported`},
+		{`subscription { ticks }`, `subscriptions are not supported`},
+		{`{ product(id: "p1\q") { id } }`, `invalid escape`},
+	} {
+		t.Run(test.query, func(t *testing.T) {
+			resp := g.Execute(context.Background(), Request{Query: test.query})
+			if resp.Data != nil {
+				t.Fatalf("unexpected data %s", resp.Data)
+			}
+			if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, test.want) {
+				t.Fatalf("errors: got %v, want %q", resp.Errors, test.want)
+			}
+		})
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	ts := httptest.NewServer(newTestGateway(t, catalogImpl{}, &cartImpl{items: map[string][]Item{}}))
+	defer ts.Close()
+
+	for _, test := range []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		want   string
+	}{
+		{
+			name:   "Post",
+			method: http.MethodPost,
+			target: "/graphql",
+			body:   `{"query": "query P($id: String!) { product(id: $id) { name } }", "variables": {"id": "p1"}}`,
+			status: http.StatusOK,
+			want:   `{"data":{"product":{"name":"shoe"}}}`,
+		},
+		{
+			name:   "Get",
+			method: http.MethodGet,
+			target: "/graphql?query=" + url.QueryEscape(`{ recommend(user: "a") }`),
+			status: http.StatusOK,
+			want:   `{"data":{"recommend":["a-p1","a-p2"]}}`,
+		},
+		{
+			name:   "GetMutation",
+			method: http.MethodGet,
+			target: "/graphql?query=" + url.QueryEscape(`mutation { clearCart(user: "a") }`),
+			status: http.StatusBadRequest,
+			want:   `{"errors":[{"message":"mutations are not allowed in GET requests"}]}`,
+		},
+		{
+			name:   "InvalidBody",
+			method: http.MethodPost,
+			target: "/graphql",
+			body:   `{`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "NotFound",
+			method: http.MethodGet,
+			target: "/other",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "MethodNotAllowed",
+			method: http.MethodPut,
+			target: "/graphql",
+			status: http.StatusMethodNotAllowed,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, ts.URL+test.target, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != test.status {
+				t.Fatalf("status: got %d, want %d: %s", resp.StatusCode, test.status, body)
+			}
+			if test.want != "" && string(body) != test.want {
+				t.Fatalf("body: got %s, want %s", body, test.want)
+			}
+			if !json.Valid(body) {
+				t.Fatalf("invalid JSON body %s", body)
+			}
+		})
+	}
+
+	resp, err := http.Get(ts.URL + "/schema.graphql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.HasPrefix(string(body), "type Query {") {
+		t.Fatalf("schema: got %s", body)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	svc := Export[recommendations]("Recommendations", recommendationsImpl{})
+	if _, err := New(Options{}, svc); err == nil || !strings.Contains(err.Error(), "no query fields") {
+		t.Fatalf("New: got %v, want no query fields error", err)
+	}
+
+	a := Export[catalog]("A", catalogImpl{})
+	a.fields = map[string]string{"Get": "query product"}
+	b := Export[catalog]("B", catalogImpl{})
+	b.fields = map[string]string{"Search": "query product"}
+	if _, err := New(Options{}, a, b); err == nil || !strings.Contains(err.Error(), "already resolved by A.Get") {
+		t.Fatalf("New: got %v, want duplicate field error", err)
+	}
+}
@@ -0,0 +1,732 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphqlgateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This file implements a parser for GraphQL executable documents [1], i.e.,
+// queries and mutations.
+//
+// [1]: https://spec.graphql.org/October2021/#sec-Document
+
+// document is a parsed GraphQL document.
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+// operation is a query or a mutation.
+type operation struct {
+	kind       string // "query" or "mutation"
+	name       string
+	vars       []*varDef
+	directives []*directive
+	sels       []*selection
+}
+
+// varDef is a variable definition, e.g., "$id: ID! = 42".
+type varDef struct {
+	name   string
+	typ    string
+	def    any
+	hasDef bool
+}
+
+// fragment is a named fragment definition.
+type fragment struct {
+	name string
+	on   string // type condition
+	sels []*selection
+}
+
+// selectionKind is the kind of a selection.
+type selectionKind int
+
+const (
+	fieldSelection  selectionKind = iota // e.g., "alias: name(arg: 1) { ... }"
+	spreadSelection                      // e.g., "...name"
+	inlineSelection                      // e.g., "... on Type { ... }"
+)
+
+// selection is an element of a selection set.
+type selection struct {
+	kind       selectionKind
+	alias      string         // field alias, if any
+	name       string         // field or fragment name
+	args       map[string]any // field arguments
+	on         string         // type condition of an inline fragment, if any
+	directives []*directive
+	sels       []*selection // field or inline fragment selections
+	pos        int          // position in the document
+}
+
+// key returns the response key of a field selection.
+func (s *selection) key() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+// directive is a directive, e.g., "@include(if: $flag)".
+type directive struct {
+	name string
+	args map[string]any
+}
+
+// variable is a reference to a variable in a parsed value, e.g., "$id".
+type variable string
+
+// Parsed values are nil, bools, json.Numbers, strings, enum values as
+// strings, []any, map[string]any, and variables.
+
+// tokenKind is the kind of a lexical token.
+type tokenKind int
+
+const (
+	eofToken tokenKind = iota
+	punctToken
+	nameToken
+	intToken
+	floatToken
+	stringToken
+)
+
+// token is a lexical token.
+type token struct {
+	kind tokenKind
+	text string // for strings, the unescaped value
+	pos  int    // byte offset in the document
+}
+
+// parser is a parser of GraphQL documents.
+type parser struct {
+	src    string
+	tokens []token
+	i      int // index of the next token
+}
+
+// parse parses a GraphQL executable document.
+func parse(src string) (*document, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, tokens: tokens}
+	doc := &document{fragments: map[string]*fragment{}}
+	for p.peek().kind != eofToken {
+		t := p.peek()
+		switch {
+		case t.kind == punctToken && t.text == "{":
+			sels, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", sels: sels})
+		case t.kind == nameToken && (t.text == "query" || t.text == "mutation"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case t.kind == nameToken && t.text == "fragment":
+			f, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[f.name]; ok {
+				return nil, fmt.Errorf("duplicate fragment %q", f.name)
+			}
+			doc.fragments[f.name] = f
+		case t.kind == nameToken && t.text == "subscription":
+			return nil, p.errorf(t, "subscriptions are not supported")
+		default:
+			return nil, p.unexpected(t)
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("no operations")
+	}
+	return doc, nil
+}
+
+// operation parses an operation with an explicit operation type.
+func (p *parser) operation() (*operation, error) {
+	op := &operation{kind: p.next().text}
+	if p.peek().kind == nameToken {
+		op.name = p.next().text
+	}
+	if p.isPunct("(") {
+		p.next()
+		for !p.isPunct(")") {
+			v, err := p.varDef()
+			if err != nil {
+				return nil, err
+			}
+			op.vars = append(op.vars, v)
+		}
+		p.next()
+	}
+	var err error
+	if op.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if op.sels, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// varDef parses a variable definition.
+func (p *parser) varDef() (*varDef, error) {
+	if err := p.expect("$"); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	typ, err := p.typ()
+	if err != nil {
+		return nil, err
+	}
+	v := &varDef{name: name, typ: typ}
+	if p.isPunct("=") {
+		p.next()
+		if v.def, err = p.value(true); err != nil {
+			return nil, err
+		}
+		v.hasDef = true
+	}
+	// Directives on variable definitions are allowed, but ignored.
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// typ parses a type reference, e.g., "[String!]!".
+func (p *parser) typ() (string, error) {
+	var typ string
+	if p.isPunct("[") {
+		p.next()
+		elem, err := p.typ()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + elem + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.isPunct("!") {
+		p.next()
+		typ += "!"
+	}
+	return typ, nil
+}
+
+// fragment parses a fragment definition.
+func (p *parser) fragment() (*fragment, error) {
+	p.next()
+	t := p.peek()
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, p.unexpected(t)
+	}
+	if t := p.next(); t.kind != nameToken || t.text != "on" {
+		return nil, p.unexpected(t)
+	}
+	on, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	sels, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &fragment{name: name, on: on, sels: sels}, nil
+}
+
+// selectionSet parses a selection set, e.g., "{ id name }".
+func (p *parser) selectionSet() ([]*selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []*selection
+	for !p.isPunct("}") {
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, s)
+	}
+	p.next()
+	if len(sels) == 0 {
+		return nil, fmt.Errorf("empty selection set")
+	}
+	return sels, nil
+}
+
+// selection parses a selection.
+func (p *parser) selection() (*selection, error) {
+	t := p.peek()
+	s := &selection{pos: t.pos}
+	var err error
+	if p.isPunct("...") {
+		p.next()
+		if t := p.peek(); t.kind == nameToken && t.text != "on" {
+			s.kind = spreadSelection
+			s.name = p.next().text
+			if s.directives, err = p.directives(); err != nil {
+				return nil, err
+			}
+			return s, nil
+		}
+		s.kind = inlineSelection
+		if t := p.peek(); t.kind == nameToken && t.text == "on" {
+			p.next()
+			if s.on, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if s.directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		if s.sels, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	s.kind = fieldSelection
+	if s.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if p.isPunct(":") {
+		p.next()
+		s.alias = s.name
+		if s.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.isPunct("(") {
+		if s.args, err = p.arguments(); err != nil {
+			return nil, err
+		}
+	}
+	if s.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.isPunct("{") {
+		if s.sels, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// arguments parses arguments, e.g., "(id: 1, name: $name)".
+func (p *parser) arguments() (map[string]any, error) {
+	p.next()
+	args := map[string]any{}
+	for !p.isPunct(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.value(false)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := args[name]; ok {
+			return nil, fmt.Errorf("duplicate argument %q", name)
+		}
+		args[name] = v
+	}
+	p.next()
+	return args, nil
+}
+
+// directives parses zero or more directives.
+func (p *parser) directives() ([]*directive, error) {
+	var ds []*directive
+	for p.isPunct("@") {
+		p.next()
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		d := &directive{name: name}
+		if p.isPunct("(") {
+			if d.args, err = p.arguments(); err != nil {
+				return nil, err
+			}
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// value parses a value. If constant is true, variables are not allowed.
+func (p *parser) value(constant bool) (any, error) {
+	t := p.next()
+	switch t.kind {
+	case intToken, floatToken:
+		return json.Number(t.text), nil
+	case stringToken:
+		return t.text, nil
+	case nameToken:
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			return t.text, nil
+		}
+	case punctToken:
+		switch t.text {
+		case "$":
+			if constant {
+				return nil, p.errorf(t, "unexpected variable")
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			return variable(name), nil
+		case "[":
+			list := []any{}
+			for !p.isPunct("]") {
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			obj := map[string]any{}
+			for !p.isPunct("}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				obj[name] = v
+			}
+			p.next()
+			return obj, nil
+		}
+	}
+	return nil, p.unexpected(t)
+}
+
+// name parses a name.
+func (p *parser) name() (string, error) {
+	t := p.next()
+	if t.kind != nameToken {
+		return "", p.unexpected(t)
+	}
+	return t.text, nil
+}
+
+// expect parses the provided punctuator.
+func (p *parser) expect(punct string) error {
+	if t := p.next(); t.kind != punctToken || t.text != punct {
+		return p.unexpected(t)
+	}
+	return nil
+}
+
+// isPunct returns whether the next token is the provided punctuator.
+func (p *parser) isPunct(punct string) bool {
+	t := p.peek()
+	return t.kind == punctToken && t.text == punct
+}
+
+// peek returns the next token, without consuming it.
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+// next consumes and returns the next token. At the end of the document, it
+// keeps returning an EOF token.
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != eofToken {
+		p.i++
+	}
+	return t
+}
+
+// unexpected returns an error for an unexpected token.
+func (p *parser) unexpected(t token) error {
+	if t.kind == eofToken {
+		return p.errorf(t, "unexpected end of document")
+	}
+	return p.errorf(t, "unexpected %q", p.src[t.pos:p.end(t)])
+}
+
+// end returns the end offset of a token.
+func (p *parser) end(t token) int {
+	if t.kind != stringToken {
+		return t.pos + len(t.text)
+	}
+	// The text of a string token is unescaped. Report only the quote.
+	return t.pos + 1
+}
+
+// errorf returns an error at the position of the provided token.
+func (p *parser) errorf(t token, format string, args ...any) error {
+	line, col := position(p.src, t.pos)
+	return fmt.Errorf("%d:%d: %s", line, col, fmt.Sprintf(format, args...))
+}
+
+// position returns the 1-based line and column of a byte offset in src.
+func position(src string, offset int) (int, int) {
+	before := src[:offset]
+	line := strings.Count(before, "\n") + 1
+	col := utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:]) + 1
+	return line, col
+}
+
+// lex splits a GraphQL document into tokens, ending with an EOF token.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	errorf := func(pos int, format string, args ...any) error {
+		line, col := position(src, pos)
+		return fmt.Errorf("%d:%d: %s", line, col, fmt.Sprintf(format, args...))
+	}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, token{punctToken, "...", i})
+			i += 3
+		case strings.IndexByte("!$&()=:@[]{}|", c) >= 0:
+			tokens = append(tokens, token{punctToken, src[i : i+1], i})
+			i++
+		case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || 'a' <= src[j] && src[j] <= 'z' || 'A' <= src[j] && src[j] <= 'Z' || '0' <= src[j] && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, token{nameToken, src[i:j], i})
+			i = j
+		case c == '-' || '0' <= c && c <= '9':
+			t, err := lexNumber(src, i)
+			if err != nil {
+				return nil, errorf(i, "%v", err)
+			}
+			tokens = append(tokens, t)
+			i += len(t.text)
+		case strings.HasPrefix(src[i:], `"""`):
+			j := i + 3
+			var b strings.Builder
+			for {
+				if j >= len(src) {
+					return nil, errorf(i, "unterminated string")
+				}
+				if strings.HasPrefix(src[j:], `\"""`) {
+					b.WriteString(`"""`)
+					j += 4
+					continue
+				}
+				if strings.HasPrefix(src[j:], `"""`) {
+					j += 3
+					break
+				}
+				b.WriteByte(src[j])
+				j++
+			}
+			tokens = append(tokens, token{stringToken, blockString(b.String()), i})
+			i = j
+		case c == '"':
+			s, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, errorf(i, "%v", err)
+			}
+			tokens = append(tokens, token{stringToken, s, i})
+			i += n
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, errorf(i, "unexpected character %q", r)
+		}
+	}
+	return append(tokens, token{kind: eofToken, pos: len(src)}), nil
+}
+
+// lexNumber lexes the number at offset i of src.
+func lexNumber(src string, i int) (token, error) {
+	j := i
+	if src[j] == '-' {
+		j++
+	}
+	digits := func() int {
+		start := j
+		for j < len(src) && '0' <= src[j] && src[j] <= '9' {
+			j++
+		}
+		return j - start
+	}
+	start := j
+	if n := digits(); n == 0 {
+		return token{}, fmt.Errorf("invalid number")
+	} else if n > 1 && src[start] == '0' {
+		return token{}, fmt.Errorf("invalid number %q", src[i:j])
+	}
+	kind := intToken
+	if j < len(src) && src[j] == '.' {
+		j++
+		if digits() == 0 {
+			return token{}, fmt.Errorf("invalid number %q", src[i:j])
+		}
+		kind = floatToken
+	}
+	if j < len(src) && (src[j] == 'e' || src[j] == 'E') {
+		j++
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			j++
+		}
+		if digits() == 0 {
+			return token{}, fmt.Errorf("invalid number %q", src[i:j])
+		}
+		kind = floatToken
+	}
+	return token{kind, src[i:j], i}, nil
+}
+
+// lexString lexes the quoted string at the start of s, and returns its
+// unescaped value and length.
+func lexString(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); {
+		switch c := s[i]; {
+		case c == '"':
+			return b.String(), i + 1, nil
+		case c == '\n' || c == '\r':
+			return "", 0, fmt.Errorf("unterminated string")
+		case c == '\\':
+			if i+1 >= len(s) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			switch e := s[i+1]; e {
+			case '"', '\\', '/':
+				b.WriteByte(e)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if i+6 > len(s) {
+					return "", 0, fmt.Errorf("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(s[i+2:i+6], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid unicode escape %q", s[i:i+6])
+				}
+				b.WriteRune(rune(r))
+				i += 4
+			default:
+				return "", 0, fmt.Errorf("invalid escape %q", s[i:i+2])
+			}
+			i += 2
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// blockString returns the value of a block string with the provided raw
+// contents, removing the common indentation and the leading and trailing
+// blank lines.
+func blockString(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = ""
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,421 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphqlgateway
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// schema is a GraphQL schema derived from the Go types of component methods.
+type schema struct {
+	query    *rootType
+	mutation *rootType
+	objects  []*objectType                // object and input types, in order of creation
+	outputs  map[reflect.Type]*objectType // object types, by Go type
+	inputs   map[reflect.Type]*objectType // input types, by Go type
+	names    map[string]bool              // names of the types
+	usesJSON bool                         // whether the JSON scalar is used
+}
+
+// rootType is the Query or Mutation type.
+type rootType struct {
+	name   string
+	fields []*rootField
+	byName map[string]*rootField
+}
+
+// rootField is a field of a root type, resolved by a component method.
+type rootField struct {
+	name    string
+	service string
+	method  string
+	fn      reflect.Value // component method
+	args    []*argument
+	results int          // number of results, excluding the error
+	result  reflect.Type // type of the results, if any
+	typ     string       // GraphQL type
+}
+
+// argument is an argument of a root field, i.e., a method parameter.
+type argument struct {
+	name string
+	t    reflect.Type
+	typ  string // GraphQL type
+}
+
+// objectType is an object type or an input type, derived from a struct.
+type objectType struct {
+	name   string
+	input  bool
+	fields []*objectField
+	byName map[string]*objectField
+}
+
+// objectField is a field of an object type, derived from a struct field.
+type objectField struct {
+	name  string
+	index []int // index of the struct field, as in reflect.Value.FieldByIndex
+	t     reflect.Type
+	typ   string // GraphQL type
+}
+
+func newSchema() *schema {
+	return &schema{
+		query:    &rootType{name: "Query", byName: map[string]*rootField{}},
+		mutation: &rootType{name: "Mutation", byName: map[string]*rootField{}},
+		outputs:  map[reflect.Type]*objectType{},
+		inputs:   map[reflect.Type]*objectType{},
+		names:    map[string]bool{"Query": true, "Mutation": true, "JSON": true},
+	}
+}
+
+// addRootField adds the root field of the provided method of svc.
+func (s *schema) addRootField(svc Service, method string) error {
+	m, ok := svc.iface.MethodByName(method)
+	if !ok {
+		return fmt.Errorf("method not found")
+	}
+	kind, name, _ := strings.Cut(svc.fields[method], " ")
+	if name == "" {
+		name = lowerInitial(method)
+	}
+	var root *rootType
+	switch kind {
+	case "query":
+		root = s.query
+	case "mutation":
+		root = s.mutation
+	default:
+		return fmt.Errorf("invalid field %q", svc.fields[method])
+	}
+	if other, ok := root.byName[name]; ok {
+		return fmt.Errorf("%s field %q is already resolved by %s.%s", kind, name, other.service, other.method)
+	}
+	t := m.Type
+	if t.NumIn() == 0 || t.In(0) != contextType {
+		return fmt.Errorf("first parameter is not a context.Context")
+	}
+	if t.NumOut() == 0 || t.Out(t.NumOut()-1) != errorType {
+		return fmt.Errorf("last result is not an error")
+	}
+
+	f := &rootField{
+		name:    name,
+		service: svc.name,
+		method:  method,
+		fn:      reflect.ValueOf(svc.impl).MethodByName(method),
+		results: t.NumOut() - 1,
+	}
+	names := svc.params[method]
+	for i := 1; i < t.NumIn(); i++ {
+		a := &argument{name: fmt.Sprintf("arg%d", i-1), t: t.In(i)}
+		if i-1 < len(names) && names[i-1] != "" && names[i-1] != "_" {
+			a.name = names[i-1]
+		}
+		typ, err := s.typeOf(a.t, true)
+		if err != nil {
+			return fmt.Errorf("parameter %s: %w", a.name, err)
+		}
+		a.typ = typ
+		f.args = append(f.args, a)
+	}
+
+	// Root fields are nullable, so that a failed method call doesn't fail
+	// the other fields of a query.
+	switch f.results {
+	case 0:
+		f.typ = "Boolean"
+	case 1:
+		f.result = t.Out(0)
+		typ, err := s.typeOf(f.result, false)
+		if err != nil {
+			return fmt.Errorf("result: %w", err)
+		}
+		f.typ = strings.TrimSuffix(typ, "!")
+	default:
+		var fields []reflect.StructField
+		for i := 0; i < f.results; i++ {
+			fields = append(fields, reflect.StructField{
+				Name: fmt.Sprintf("Result%d", i),
+				Type: t.Out(i),
+				Tag:  reflect.StructTag(fmt.Sprintf(`json:"result%d"`, i)),
+			})
+		}
+		f.result = reflect.StructOf(fields)
+		obj, err := s.newObject(s.uniqueName(upperInitial(name)+"Result", ""), f.result, false)
+		if err != nil {
+			return fmt.Errorf("results: %w", err)
+		}
+		f.typ = obj.name
+	}
+	root.fields = append(root.fields, f)
+	root.byName[name] = f
+	return nil
+}
+
+// typeOf returns the GraphQL type of the Go type t. If input is true, it
+// returns an input type.
+func (s *schema) typeOf(t reflect.Type, input bool) (string, error) {
+	if t == timeType {
+		return "String!", nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "Boolean!", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "Int!", nil
+	case reflect.Float32, reflect.Float64:
+		return "Float!", nil
+	case reflect.String:
+		return "String!", nil
+	case reflect.Pointer:
+		elem, err := s.typeOf(t.Elem(), input)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(elem, "!"), nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// Like encoding/json, encode byte slices as base64 strings.
+			return "String!", nil
+		}
+		elem, err := s.typeOf(t.Elem(), input)
+		if err != nil {
+			return "", err
+		}
+		return "[" + elem + "]!", nil
+	case reflect.Map:
+		s.usesJSON = true
+		return "JSON!", nil
+	case reflect.Struct:
+		obj, err := s.object(t, input)
+		if err != nil {
+			return "", err
+		}
+		return obj.name + "!", nil
+	default:
+		return "", fmt.Errorf("unsupported type %v", t)
+	}
+}
+
+// object returns the object type, or the input type if input is true, of the
+// struct type t.
+func (s *schema) object(t reflect.Type, input bool) (*objectType, error) {
+	objs := s.outputs
+	if input {
+		objs = s.inputs
+	}
+	if obj, ok := objs[t]; ok {
+		return obj, nil
+	}
+	if t.Name() == "" {
+		return nil, fmt.Errorf("unsupported unnamed type %v", t)
+	}
+	name := strings.TrimRight(strings.Map(func(r rune) rune {
+		if r == '_' || r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return '_'
+	}, t.Name()), "_")
+	if input {
+		name += "Input"
+	}
+	return s.newObject(s.uniqueName(name, path.Base(t.PkgPath())), t, input)
+}
+
+// uniqueName returns name, qualified with pkg if name is already taken.
+func (s *schema) uniqueName(name, pkg string) string {
+	if !s.names[name] {
+		return name
+	}
+	if pkg != "" && pkg != "." && !s.names[pkg+"_"+name] {
+		return pkg + "_" + name
+	}
+	for i := 1; ; i++ {
+		if n := fmt.Sprintf("%s%d", name, i); !s.names[n] {
+			return n
+		}
+	}
+}
+
+// newObject returns a new object or input type with the provided name for
+// the struct type t.
+func (s *schema) newObject(name string, t reflect.Type, input bool) (*objectType, error) {
+	obj := &objectType{name: name, input: input, byName: map[string]*objectField{}}
+	if input {
+		s.inputs[t] = obj
+	} else {
+		s.outputs[t] = obj
+	}
+	s.names[name] = true
+	s.objects = append(s.objects, obj)
+
+	for _, sf := range reflect.VisibleFields(t) {
+		if sf.Anonymous || !sf.IsExported() || !accessible(t, sf.Index) {
+			continue
+		}
+		f := &objectField{name: lowerInitial(sf.Name), index: sf.Index, t: sf.Type}
+		if tag, ok := sf.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				f.name = tagName
+			}
+		}
+		if !isName(f.name) {
+			return nil, fmt.Errorf("%v: field %s has invalid GraphQL name %q", t, sf.Name, f.name)
+		}
+		if _, ok := obj.byName[f.name]; ok {
+			return nil, fmt.Errorf("%v: duplicate field %q", t, f.name)
+		}
+		typ, err := s.typeOf(sf.Type, input)
+		if err != nil {
+			return nil, fmt.Errorf("%v: field %s: %w", t, sf.Name, err)
+		}
+		if input {
+			// Fields of input types are optional, and default to the zero
+			// value.
+			typ = strings.TrimSuffix(typ, "!")
+		}
+		f.typ = typ
+		obj.fields = append(obj.fields, f)
+		obj.byName[f.name] = f
+	}
+	return obj, nil
+}
+
+// accessible returns whether the struct field of t with the provided index is
+// accessible, i.e., it is not promoted through an unexported embedded field.
+func accessible(t reflect.Type, index []int) bool {
+	for i := 1; i < len(index); i++ {
+		if !t.FieldByIndex(index[:i]).IsExported() {
+			return false
+		}
+	}
+	return true
+}
+
+// objectOf returns the object type of values of type t, after unwrapping
+// pointers, slices, and arrays, or nil if t is a leaf type.
+func (s *schema) objectOf(t reflect.Type) *objectType {
+	for {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Array:
+			t = t.Elem()
+		case reflect.Slice:
+			if t.Elem().Kind() == reflect.Uint8 {
+				return nil
+			}
+			t = t.Elem()
+		default:
+			return s.outputs[t]
+		}
+	}
+}
+
+// sdl returns the schema in the GraphQL schema language.
+func (s *schema) sdl() string {
+	var b strings.Builder
+	if s.usesJSON {
+		b.WriteString("\"\"\"\nArbitrary JSON values.\n\"\"\"\nscalar JSON\n\n")
+	}
+	for _, root := range []*rootType{s.query, s.mutation} {
+		if len(root.fields) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "type %s {\n", root.name)
+		for _, f := range root.fields {
+			fmt.Fprintf(&b, "  %s", f.name)
+			if len(f.args) > 0 {
+				args := make([]string, len(f.args))
+				for i, a := range f.args {
+					args[i] = a.name + ": " + a.typ
+				}
+				fmt.Fprintf(&b, "(%s)", strings.Join(args, ", "))
+			}
+			fmt.Fprintf(&b, ": %s\n", f.typ)
+		}
+		b.WriteString("}\n\n")
+	}
+	for _, obj := range s.objects {
+		kind := "type"
+		if obj.input {
+			kind = "input"
+		}
+		fmt.Fprintf(&b, "%s %s {\n", kind, obj.name)
+		for _, f := range obj.fields {
+			fmt.Fprintf(&b, "  %s: %s\n", f.name, f.typ)
+		}
+		b.WriteString("}\n\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// isName returns whether s is a valid GraphQL name.
+func isName(s string) bool {
+	if s == "" || strings.HasPrefix(s, "__") {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case '0' <= r && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// lowerInitial lowercases the initialism or the first letter that s starts
+// with, e.g., "ProductID" becomes "productID" and "URLPath" becomes "urlPath".
+func lowerInitial(s string) string {
+	r := []rune(s)
+	n := 0
+	for n < len(r) && unicode.IsUpper(r[n]) {
+		n++
+	}
+	if n > 1 && n < len(r) && unicode.IsLower(r[n]) {
+		n--
+	}
+	for i := 0; i < n; i++ {
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+// upperInitial uppercases the first letter of s.
+func upperInitial(s string) string {
+	r := []rune(s)
+	if len(r) > 0 {
+		r[0] = unicode.ToUpper(r[0])
+	}
+	return string(r)
+}
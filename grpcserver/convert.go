@@ -0,0 +1,173 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcserver
+
+import (
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// toStruct copies the fields of the struct v into the message m.
+func (s *schema) toStruct(m protoreflect.Message, v reflect.Value) {
+	fields := m.Descriptor().Fields()
+	for i, index := range s.fields[v.Type()] {
+		s.toField(m, fields.ByNumber(protoreflect.FieldNumber(i+1)), v.Field(index))
+	}
+}
+
+// toField copies v into the field fd of m.
+func (s *schema) toField(m protoreflect.Message, fd protoreflect.FieldDescriptor, v reflect.Value) {
+	switch {
+	case fd.IsMap():
+		if v.Len() == 0 {
+			return
+		}
+		mp := m.Mutable(fd).Map()
+		iter := v.MapRange()
+		for iter.Next() {
+			key := s.toValue(fd.MapKey(), iter.Key(), nil).MapKey()
+			mp.Set(key, s.toValue(fd.MapValue(), iter.Value(), mp.NewValue))
+		}
+	case fd.IsList():
+		if v.Len() == 0 {
+			return
+		}
+		list := m.Mutable(fd).List()
+		for i := 0; i < v.Len(); i++ {
+			list.Append(s.toValue(fd, v.Index(i), list.NewElement))
+		}
+	case fd.Kind() == protoreflect.MessageKind:
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return
+			}
+			v = v.Elem()
+		}
+		s.toStruct(m.Mutable(fd).Message(), v)
+	default:
+		m.Set(fd, s.toValue(fd, v, nil))
+	}
+}
+
+// toValue converts v into a singular value of the type of fd. newMessage
+// returns a new message, if fd is a message.
+func (s *schema) toValue(fd protoreflect.FieldDescriptor, v reflect.Value, newMessage func() protoreflect.Value) protoreflect.Value {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(v.Bool())
+	case protoreflect.Int32Kind:
+		return protoreflect.ValueOfInt32(int32(v.Int()))
+	case protoreflect.Int64Kind:
+		return protoreflect.ValueOfInt64(v.Int())
+	case protoreflect.Uint32Kind:
+		return protoreflect.ValueOfUint32(uint32(v.Uint()))
+	case protoreflect.Uint64Kind:
+		return protoreflect.ValueOfUint64(v.Uint())
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(float32(v.Float()))
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(v.Float())
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(v.String())
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes(v.Bytes())
+	case protoreflect.MessageKind:
+		msg := newMessage()
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return msg
+			}
+			v = v.Elem()
+		}
+		s.toStruct(msg.Message(), v)
+		return msg
+	default:
+		panic(fmt.Sprintf("unexpected kind %v", fd.Kind()))
+	}
+}
+
+// fromStruct copies the message m into the struct v.
+func (s *schema) fromStruct(m protoreflect.Message, v reflect.Value) {
+	fields := m.Descriptor().Fields()
+	for i, index := range s.fields[v.Type()] {
+		s.fromField(m, fields.ByNumber(protoreflect.FieldNumber(i+1)), v.Field(index))
+	}
+}
+
+// fromField copies the field fd of m into v.
+func (s *schema) fromField(m protoreflect.Message, fd protoreflect.FieldDescriptor, v reflect.Value) {
+	switch {
+	case fd.IsMap():
+		mp := m.Get(fd).Map()
+		if mp.Len() == 0 {
+			return
+		}
+		v.Set(reflect.MakeMapWithSize(v.Type(), mp.Len()))
+		mp.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			k := reflect.New(v.Type().Key()).Elem()
+			s.fromValue(fd.MapKey(), key.Value(), k)
+			e := reflect.New(v.Type().Elem()).Elem()
+			s.fromValue(fd.MapValue(), value, e)
+			v.SetMapIndex(k, e)
+			return true
+		})
+	case fd.IsList():
+		list := m.Get(fd).List()
+		n := list.Len()
+		if v.Kind() == reflect.Slice {
+			if n == 0 {
+				return
+			}
+			v.Set(reflect.MakeSlice(v.Type(), n, n))
+		} else if n > v.Len() {
+			n = v.Len() // extra elements of an array are dropped
+		}
+		for i := 0; i < n; i++ {
+			s.fromValue(fd, list.Get(i), v.Index(i))
+		}
+	case fd.Kind() == protoreflect.MessageKind && !m.Has(fd):
+		// Leave pointers nil.
+	default:
+		s.fromValue(fd, m.Get(fd), v)
+	}
+}
+
+// fromValue copies the singular value x of the type of fd into v.
+func (s *schema) fromValue(fd protoreflect.FieldDescriptor, x protoreflect.Value, v reflect.Value) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		v.SetBool(x.Bool())
+	case protoreflect.Int32Kind, protoreflect.Int64Kind:
+		v.SetInt(x.Int())
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind:
+		v.SetUint(x.Uint())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		v.SetFloat(x.Float())
+	case protoreflect.StringKind:
+		v.SetString(x.String())
+	case protoreflect.BytesKind:
+		v.SetBytes(append([]byte(nil), x.Bytes()...))
+	case protoreflect.MessageKind:
+		if v.Kind() == reflect.Pointer {
+			v.Set(reflect.New(v.Type().Elem()))
+			v = v.Elem()
+		}
+		s.fromStruct(x.Message(), v)
+	default:
+		panic(fmt.Sprintf("unexpected kind %v", fd.Kind()))
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpcserver exposes Service Weaver components as gRPC services, so
+// that clients written without Service Weaver can call them.
+//
+// The protobuf messages and services are derived from the Go types of the
+// component methods: a method
+//
+//	GetProduct(ctx context.Context, productID string) (Product, error)
+//
+// of a component exported as "CatalogService" becomes
+//
+//	service CatalogService {
+//	  rpc GetProduct(GetProductRequest) returns (GetProductResponse);
+//	}
+//
+//	message GetProductRequest {
+//	  string product_id = 1;
+//	}
+//
+//	message GetProductResponse {
+//	  Product result = 1;
+//	}
+//
+// Parameter names are recorded by "weaver generate". Struct types become
+// messages with one field per exported struct field, numbered in declaration
+// order, so adding or reordering fields changes the schema. Use Server.Proto
+// to get the .proto file to share with clients.
+//
+// For example, in the Init method of a component:
+//
+//	catalog, err := weaver.Get[productcatalogservice.T](c)
+//	...
+//	server, err := grpcserver.New(grpcserver.Options{Package: "boutique"},
+//		grpcserver.Export("CatalogService", catalog))
+//	...
+//	go server.ListenAndServe(c, "grpc", weaver.ListenerOptions{}, tlsConfig)
+//
+// Only unary RPCs without compression are supported. The Go standard library
+// only speaks HTTP/2 over TLS, so a server needs either a TLS config or a
+// listener that serves TLS, configured in the listeners section of the
+// application config.
+//
+// Every RPC is traced, as a child of the caller's span if the request carries
+// a W3C traceparent header, and counted in the following metrics, labeled by
+// the full RPC method name, e.g., "/boutique.CatalogService/GetProduct":
+//
+//   - serviceweaver_grpc_request_count: Count of RPCs.
+//   - serviceweaver_grpc_error_count: Count of RPCs that failed, also labeled
+//     by gRPC status code.
+//   - serviceweaver_grpc_request_latency_micros: Duration, in microseconds, of
+//     RPC execution.
+package grpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/metrics"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// maxMessageSize is the maximum size of a request message.
+const maxMessageSize = 4 << 20
+
+// gRPC status codes. See https://grpc.github.io/grpc/core/md_doc_statuscodes.html.
+const (
+	codeOK                = 0
+	codeCanceled          = 1
+	codeUnknown           = 2
+	codeInvalidArgument   = 3
+	codeDeadlineExceeded  = 4
+	codePermissionDenied  = 7
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeUnavailable       = 14
+)
+
+type grpcLabels struct {
+	Method string // full RPC method name, e.g., "/pkg.Service/Method"
+}
+
+type grpcErrorLabels struct {
+	Method string // full RPC method name, e.g., "/pkg.Service/Method"
+	Code   int    // gRPC status code
+}
+
+var (
+	grpcRequestCounts = metrics.NewCounterMap[grpcLabels](
+		"serviceweaver_grpc_request_count",
+		"Count of gRPC requests received",
+	)
+	grpcRequestErrors = metrics.NewCounterMap[grpcErrorLabels](
+		"serviceweaver_grpc_error_count",
+		"Count of gRPC requests that failed",
+	)
+	grpcRequestLatencyMicros = metrics.NewHistogramMapWithUnit[grpcLabels](
+		"serviceweaver_grpc_request_latency_micros",
+		"Duration, in microseconds, of gRPC request execution",
+		"us",
+		metrics.NonNegativeBuckets,
+	)
+)
+
+// Options configures a Server.
+type Options struct {
+	// Package is the protobuf package of the services. If empty, defaults
+	// to "weaver".
+	Package string
+}
+
+// A Service is a component exported as a gRPC service.
+type Service struct {
+	name   string
+	iface  reflect.Type
+	impl   any
+	params map[string][]string // parameter names, by method
+}
+
+// Export exports the component impl, typically returned by weaver.Get, as
+// the gRPC service with the provided name.
+func Export[T any](name string, impl T) Service {
+	iface := reflect.TypeOf((*T)(nil)).Elem()
+	svc := Service{name: name, iface: iface, impl: impl}
+	for _, reg := range codegen.Registered() {
+		if reg.Iface == iface {
+			svc.params = reg.ParamNames
+		}
+	}
+	return svc
+}
+
+// A Server serves a set of exported components over gRPC.
+type Server struct {
+	schema  *schema
+	handler http.Handler // traces the RPCs served by serveHTTP
+}
+
+var _ http.Handler = &Server{}
+
+// New returns a server for the provided services. It returns an error if a
+// method has a parameter or result whose type can't be represented in
+// protobuf, like a function, a channel, or an interface.
+func New(opts Options, services ...Service) (*Server, error) {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "weaver"
+	}
+	for _, svc := range services {
+		if svc.iface.Kind() != reflect.Interface {
+			return nil, fmt.Errorf("grpcserver: %s: %v is not an interface", svc.name, svc.iface)
+		}
+	}
+	s, err := newSchema(pkg, services)
+	if err != nil {
+		return nil, fmt.Errorf("grpcserver: %w", err)
+	}
+	server := &Server{schema: s}
+	server.handler = otelhttp.NewHandler(http.HandlerFunc(server.serveHTTP), "grpc",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return strings.TrimPrefix(r.URL.Path, "/")
+		}))
+	return server, nil
+}
+
+// Serve serves gRPC requests on lis, e.g., a weaver.Listener, until lis is
+// closed. If config is nil, lis must serve TLS itself, like a weaver.Listener
+// configured with a cert_file and a key_file. Otherwise, config must contain
+// a certificate.
+func (s *Server) Serve(lis net.Listener, config *tls.Config) error {
+	server := &http.Server{Handler: s, TLSConfig: config}
+	if config == nil {
+		return server.Serve(lis)
+	}
+	return server.ServeTLS(lis, "", "")
+}
+
+// ListenAndServe serves gRPC requests on the listener of the provided
+// instance with the provided name and options, until the listener is
+// closed. config is as in Serve.
+func (s *Server) ListenAndServe(instance weaver.Instance, name string, opts weaver.ListenerOptions, config *tls.Config) error {
+	lis, err := instance.Listener(name, opts)
+	if err != nil {
+		return fmt.Errorf("grpcserver: %w", err)
+	}
+	instance.Logger().Info("gRPC server listening", "listener", name, "address", lis.String())
+	return s.Serve(lis, config)
+}
+
+// ServeHTTP implements the http.Handler interface. It serves gRPC requests
+// received over HTTP/2.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// serveHTTP serves a gRPC request, and records its metrics and the status
+// of its span.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "grpcserver: not a gRPC request", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Add("Trailer", "Grpc-Status")
+	w.Header().Add("Trailer", "Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	start := time.Now()
+	code, msg := s.serve(w, r)
+	labels := grpcLabels{Method: r.URL.Path}
+	grpcRequestCounts.Get(labels).Add(1)
+	grpcRequestLatencyMicros.Get(labels).PutContext(r.Context(), float64(time.Since(start).Microseconds()))
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", code))
+	if code != codeOK {
+		grpcRequestErrors.Get(grpcErrorLabels{Method: r.URL.Path, Code: code}).Add(1)
+		span.SetStatus(otelcodes.Error, msg)
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", encodeMessage(msg))
+	}
+}
+
+// serve handles a gRPC request, writing the response message, if any, to w.
+// It returns the status of the call.
+func (s *Server) serve(w io.Writer, r *http.Request) (int, string) {
+	m, ok := s.schema.methods[r.URL.Path]
+	if !ok {
+		return codeUnimplemented, fmt.Sprintf("unknown method %s", r.URL.Path)
+	}
+	ctx := r.Context()
+	if timeout := r.Header.Get("Grpc-Timeout"); timeout != "" {
+		d, err := parseTimeout(timeout)
+		if err != nil {
+			return codeInvalidArgument, err.Error()
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	// Read and decode the request.
+	var header [5]byte
+	if _, err := io.ReadFull(r.Body, header[:]); err != nil {
+		return codeInvalidArgument, fmt.Sprintf("read request: %v", err)
+	}
+	if header[0] != 0 {
+		return codeUnimplemented, "compression is not supported"
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n > maxMessageSize {
+		return codeInvalidArgument, fmt.Sprintf("request of %d bytes exceeds %d bytes", n, maxMessageSize)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r.Body, data); err != nil {
+		return codeInvalidArgument, fmt.Sprintf("read request: %v", err)
+	}
+	req := dynamicpb.NewMessage(m.request)
+	if err := proto.Unmarshal(data, req); err != nil {
+		return codeInvalidArgument, fmt.Sprintf("decode request: %v", err)
+	}
+	args := []reflect.Value{reflect.ValueOf(ctx)}
+	fields := m.request.Fields()
+	for i, t := range m.params {
+		v := reflect.New(t).Elem()
+		s.schema.fromField(req, fields.Get(i), v)
+		args = append(args, v)
+	}
+
+	// Call the method.
+	results := m.fn.Call(args)
+	if err, _ := results[len(results)-1].Interface().(error); err != nil {
+		return errorCode(err), err.Error()
+	}
+
+	// Encode and write the response.
+	resp := dynamicpb.NewMessage(m.response)
+	fields = m.response.Fields()
+	for i := range m.results {
+		s.schema.toField(resp, fields.Get(i), results[i])
+	}
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		return codeUnknown, fmt.Sprintf("encode response: %v", err)
+	}
+	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+	if _, err := w.Write(append(header[:], data...)); err != nil {
+		return codeUnknown, fmt.Sprintf("write response: %v", err)
+	}
+	return codeOK, ""
+}
+
+// errorCode returns the gRPC status code for an error returned by a
+// component method.
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return codeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codeDeadlineExceeded
+	case errors.Is(err, weaver.ErrRateLimited):
+		return codeResourceExhausted
+	case errors.Is(err, weaver.ErrPermissionDenied):
+		return codePermissionDenied
+	case errors.Is(err, weaver.ErrRetriable), errors.Is(err, weaver.ErrCircuitOpen):
+		return codeUnavailable
+	default:
+		return codeUnknown
+	}
+}
+
+// parseTimeout parses the value of a grpc-timeout header, e.g., "100m".
+func parseTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", s)
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[s[len(s)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", s)
+	}
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// encodeMessage percent-encodes a status message, as required for the value
+// of the grpc-message trailer.
+func encodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,280 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type Item struct {
+	weaver.AutoMarshal
+	Name   string
+	Tags   []string
+	Price  float64
+	Counts map[string]int
+	Next   *Item
+}
+
+type catalog interface {
+	Get(ctx context.Context, itemID string, n int32) (Item, error)
+	List(ctx context.Context) ([]Item, bool, error)
+	Fail(ctx context.Context) error
+}
+
+type catalogImpl struct{}
+
+func (catalogImpl) Get(_ context.Context, id string, n int32) (Item, error) {
+	return Item{
+		Name:   id,
+		Tags:   []string{"a", "b"},
+		Price:  1.5,
+		Counts: map[string]int{"n": int(n)},
+		Next:   &Item{Name: "next"},
+	}, nil
+}
+
+func (catalogImpl) List(context.Context) ([]Item, bool, error) {
+	return []Item{{Name: "x"}, {Name: "y"}}, true, nil
+}
+
+func (catalogImpl) Fail(context.Context) error {
+	return errors.New("100% broken")
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	svc := Export[catalog]("Catalog", catalogImpl{})
+	// The parameter names are usually recorded by "weaver generate".
+	svc.params = map[string][]string{"Get": {"itemID", "n"}}
+	s, err := New(Options{Package: "test"}, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestProto(t *testing.T) {
+	want := `// Code generated by grpcserver. DO NOT EDIT.
+
+syntax = "proto3";
+
+package test;
+
+service Catalog {
+  rpc Fail(FailRequest) returns (FailResponse);
+  rpc Get(GetRequest) returns (GetResponse);
+  rpc List(ListRequest) returns (ListResponse);
+}
+
+message Item {
+  string name = 1;
+  repeated string tags = 2;
+  double price = 3;
+  map<string, int64> counts = 4;
+  Item next = 5;
+}
+
+message FailRequest {
+}
+
+message FailResponse {
+}
+
+message GetRequest {
+  string item_id = 1;
+  int32 n = 2;
+}
+
+message GetResponse {
+  Item result = 1;
+}
+
+message ListRequest {
+}
+
+message ListResponse {
+  repeated Item result0 = 1;
+  bool result1 = 2;
+}
+`
+	if diff := cmp.Diff(want, newTestServer(t).Proto()); diff != "" {
+		t.Fatalf("Proto (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnsupportedTypes(t *testing.T) {
+	type bad interface {
+		F(context.Context, func()) error
+	}
+	if _, err := New(Options{}, Export[bad]("Bad", nil)); err == nil {
+		t.Fatal("unexpected success exporting a function parameter")
+	}
+}
+
+// call calls the provided method with the provided request, and returns the
+// response message, the grpc-status, and the grpc-message.
+func call(t *testing.T, client *http.Client, url string, s *Server, method string, req proto.Message) (protoreflect.Message, string, string) {
+	t.Helper()
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(data)))
+	body = append(body, data...)
+	httpReq, err := http.NewRequest(http.MethodPost, url+"/test.Catalog/"+method, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	httpReq.Header.Set("Grpc-Timeout", "10S")
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("got protocol %s, want HTTP/2", resp.Proto)
+	}
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg protoreflect.Message
+	if len(out) > 0 {
+		if len(out) < 5 || int(binary.BigEndian.Uint32(out[1:5])) != len(out)-5 {
+			t.Fatalf("malformed response %x", out)
+		}
+		m := s.schema.methods["/test.Catalog/"+method]
+		msg = dynamicpb.NewMessage(m.response)
+		if err := proto.Unmarshal(out[5:], msg.Interface()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return msg, resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+}
+
+func TestServe(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewUnstartedServer(s)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	// Get.
+	m := s.schema.methods["/test.Catalog/Get"]
+	req := dynamicpb.NewMessage(m.request)
+	fields := m.request.Fields()
+	req.Set(fields.ByName("item_id"), protoreflect.ValueOfString("shoe"))
+	req.Set(fields.ByName("n"), protoreflect.ValueOfInt32(3))
+	resp, status, msg := call(t, ts.Client(), ts.URL, s, "Get", req)
+	if status != "0" {
+		t.Fatalf("Get: got status %q (%q), want 0", status, msg)
+	}
+	var got Item
+	s.schema.fromField(resp, m.response.Fields().ByName("result"), reflect.ValueOf(&got).Elem())
+	want, _ := catalogImpl{}.Get(context.Background(), "shoe", 3)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Get (-want +got):\n%s", diff)
+	}
+
+	// List.
+	m = s.schema.methods["/test.Catalog/List"]
+	resp, status, _ = call(t, ts.Client(), ts.URL, s, "List", dynamicpb.NewMessage(m.request))
+	if status != "0" {
+		t.Fatalf("List: got status %q, want 0", status)
+	}
+	if n := resp.Get(m.response.Fields().ByName("result0")).List().Len(); n != 2 {
+		t.Fatalf("List: got %d items, want 2", n)
+	}
+	if !resp.Get(m.response.Fields().ByName("result1")).Bool() {
+		t.Fatal("List: got false, want true")
+	}
+
+	// Fail.
+	m = s.schema.methods["/test.Catalog/Fail"]
+	_, status, msg = call(t, ts.Client(), ts.URL, s, "Fail", dynamicpb.NewMessage(m.request))
+	if status != "2" || msg != "100%25 broken" {
+		t.Fatalf("Fail: got status %q (%q), want 2 (100%%25 broken)", status, msg)
+	}
+
+	// Unknown method.
+	_, status, _ = call(t, ts.Client(), ts.URL, s, "Unknown", dynamicpb.NewMessage(m.request))
+	if status != "12" {
+		t.Fatalf("Unknown: got status %q, want 12", status)
+	}
+}
+
+func TestServeTLSListener(t *testing.T) {
+	// Borrow the certificate and client of an httptest server.
+	ts := httptest.NewUnstartedServer(nil)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	// Serve on a listener that serves TLS itself, like a weaver.Listener
+	// configured with a cert_file and a key_file.
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis := tls.NewListener(l, &tls.Config{
+		Certificates: ts.TLS.Certificates,
+		NextProtos:   []string{"h2", "http/1.1"},
+	})
+	defer lis.Close()
+	s := newTestServer(t)
+	go s.Serve(lis, nil)
+
+	m := s.schema.methods["/test.Catalog/Fail"]
+	url := "https://" + lis.Addr().String()
+	_, status, _ := call(t, ts.Client(), url, s, "Fail", dynamicpb.NewMessage(m.request))
+	if status != "2" {
+		t.Fatalf("Fail: got status %q, want 2", status)
+	}
+
+	// Check that the request was counted.
+	found := map[string]bool{}
+	for _, m := range metrics.Snapshot() {
+		if m.Labels["method"] == "/test.Catalog/Fail" && m.Value > 0 {
+			found[m.Name] = true
+		}
+	}
+	for _, name := range []string{
+		"serviceweaver_grpc_request_count",
+		"serviceweaver_grpc_error_count",
+	} {
+		if !found[name] {
+			t.Errorf("metric %s not found", name)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcserver
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Proto returns the contents of a .proto file that declares the services of
+// the server, for use by clients.
+func (s *Server) Proto() string {
+	fdp := s.schema.fdp
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by grpcserver. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "syntax = \"proto3\";\n\n")
+	fmt.Fprintf(&b, "package %s;\n", fdp.GetPackage())
+	for _, svc := range fdp.Service {
+		fmt.Fprintf(&b, "\nservice %s {\n", svc.GetName())
+		for _, m := range svc.Method {
+			fmt.Fprintf(&b, "  rpc %s(%s) returns (%s);\n", m.GetName(), s.typeName(m.GetInputType()), s.typeName(m.GetOutputType()))
+		}
+		fmt.Fprintf(&b, "}\n")
+	}
+	for _, msg := range fdp.MessageType {
+		fmt.Fprintf(&b, "\nmessage %s {\n", msg.GetName())
+		for _, f := range msg.Field {
+			fmt.Fprintf(&b, "  %s %s = %d;\n", s.fieldType(msg, f), f.GetName(), f.GetNumber())
+		}
+		fmt.Fprintf(&b, "}\n")
+	}
+	return b.String()
+}
+
+// typeName returns the name of a message, relative to the package.
+func (s *Server) typeName(fullName string) string {
+	return strings.TrimPrefix(fullName, "."+s.schema.fdp.GetPackage()+".")
+}
+
+// fieldType returns the type of a field of msg, as written in a .proto file,
+// e.g., "repeated string" or "map<string, Product>".
+func (s *Server) fieldType(msg *descriptorpb.DescriptorProto, f *descriptorpb.FieldDescriptorProto) string {
+	if f.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		for _, entry := range msg.NestedType {
+			if f.GetTypeName() == "."+s.schema.fdp.GetPackage()+"."+msg.GetName()+"."+entry.GetName() {
+				key, value := entry.Field[0], entry.Field[1]
+				return fmt.Sprintf("map<%s, %s>", s.scalarType(key), s.scalarType(value))
+			}
+		}
+	}
+	if f.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		return "repeated " + s.scalarType(f)
+	}
+	return s.scalarType(f)
+}
+
+// scalarType returns the type of a singular field, e.g., "int64" or
+// "Product".
+func (s *Server) scalarType(f *descriptorpb.FieldDescriptorProto) string {
+	if f.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		return s.typeName(f.GetTypeName())
+	}
+	return strings.ToLower(strings.TrimPrefix(f.GetType().String(), "TYPE_"))
+}
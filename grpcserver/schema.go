@@ -0,0 +1,419 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ServiceWeaver/weaver"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var (
+	contextType     = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType       = reflect.TypeOf((*error)(nil)).Elem()
+	autoMarshalType = reflect.TypeOf(weaver.AutoMarshal{})
+)
+
+// schema is the protobuf schema of a set of services, derived from the Go
+// types of their methods.
+type schema struct {
+	fdp     *descriptorpb.FileDescriptorProto
+	file    protoreflect.FileDescriptor
+	fields  map[reflect.Type][]int // indices of the fields of every struct, by field number
+	methods map[string]*method     // keyed by "/<package>.<service>/<method>"
+}
+
+// method is a method of a service.
+type method struct {
+	fn       reflect.Value                  // method of the component
+	params   []reflect.Type                 // parameters, excluding the context
+	results  []reflect.Type                 // results, excluding the error
+	request  protoreflect.MessageDescriptor // message holding the parameters
+	response protoreflect.MessageDescriptor // message holding the results
+}
+
+// builder builds a schema.
+type builder struct {
+	fdp    *descriptorpb.FileDescriptorProto
+	names  map[reflect.Type]string // message names of structs
+	used   map[string]bool         // used message names
+	fields map[reflect.Type][]int
+}
+
+// newSchema returns the schema of the provided services.
+func newSchema(pkg string, services []Service) (*schema, error) {
+	b := &builder{
+		fdp: &descriptorpb.FileDescriptorProto{
+			Name:    proto.String(pkg + ".proto"),
+			Package: proto.String(pkg),
+			Syntax:  proto.String("proto3"),
+		},
+		names:  map[reflect.Type]string{},
+		used:   map[string]bool{},
+		fields: map[reflect.Type][]int{},
+	}
+
+	// Name the structs. Structs are named after their Go type, qualified by
+	// their Go package if two structs have the same name.
+	structs := map[reflect.Type]bool{}
+	for _, svc := range services {
+		for i := 0; i < svc.iface.NumMethod(); i++ {
+			m := svc.iface.Method(i)
+			params, results, err := signature(m.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", svc.name, m.Name, err)
+			}
+			for _, t := range append(params, results...) {
+				if err := collectStructs(t, structs); err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", svc.name, m.Name, err)
+				}
+			}
+		}
+	}
+	count := map[string]int{}
+	for t := range structs {
+		count[t.Name()]++
+	}
+	for t := range structs {
+		name := t.Name()
+		if count[name] > 1 {
+			pkg := t.PkgPath()
+			name = pkg[strings.LastIndex(pkg, "/")+1:] + "_" + name
+		}
+		b.names[t] = name
+		b.used[name] = true
+	}
+
+	// Add the messages of the structs, in a deterministic order.
+	sorted := make([]reflect.Type, 0, len(structs))
+	for t := range structs {
+		sorted = append(sorted, t)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return b.names[sorted[i]] < b.names[sorted[j]] })
+	for _, t := range sorted {
+		msg := &descriptorpb.DescriptorProto{Name: proto.String(b.names[t])}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() || f.Type == autoMarshalType {
+				continue
+			}
+			if err := b.addField(msg, snakeCase(f.Name), f.Type); err != nil {
+				return nil, fmt.Errorf("field %s.%s: %w", t, f.Name, err)
+			}
+			b.fields[t] = append(b.fields[t], i)
+		}
+		b.fdp.MessageType = append(b.fdp.MessageType, msg)
+	}
+
+	// Add the services, along with the messages of their requests and
+	// responses.
+	type pending struct {
+		key      string
+		m        *method
+		request  string
+		response string
+	}
+	var methods []pending
+	for _, svc := range services {
+		sdp := &descriptorpb.ServiceDescriptorProto{Name: proto.String(svc.name)}
+		for i := 0; i < svc.iface.NumMethod(); i++ {
+			m := svc.iface.Method(i)
+			params, results, _ := signature(m.Type) // checked above
+			request, err := b.messageName(svc.name, m.Name, "Request")
+			if err != nil {
+				return nil, err
+			}
+			response, err := b.messageName(svc.name, m.Name, "Response")
+			if err != nil {
+				return nil, err
+			}
+
+			req := &descriptorpb.DescriptorProto{Name: proto.String(request)}
+			names := svc.params[m.Name]
+			for j, t := range params {
+				name := fmt.Sprintf("arg%d", j)
+				if j < len(names) && names[j] != "" && names[j] != "_" {
+					name = snakeCase(names[j])
+				}
+				if err := b.addField(req, name, t); err != nil {
+					return nil, fmt.Errorf("%s.%s: parameter %s: %w", svc.name, m.Name, name, err)
+				}
+			}
+			resp := &descriptorpb.DescriptorProto{Name: proto.String(response)}
+			for j, t := range results {
+				name := "result"
+				if len(results) > 1 {
+					name = fmt.Sprintf("result%d", j)
+				}
+				if err := b.addField(resp, name, t); err != nil {
+					return nil, fmt.Errorf("%s.%s: result %s: %w", svc.name, m.Name, name, err)
+				}
+			}
+			b.fdp.MessageType = append(b.fdp.MessageType, req, resp)
+			sdp.Method = append(sdp.Method, &descriptorpb.MethodDescriptorProto{
+				Name:       proto.String(m.Name),
+				InputType:  proto.String("." + pkg + "." + request),
+				OutputType: proto.String("." + pkg + "." + response),
+			})
+			methods = append(methods, pending{
+				key: "/" + pkg + "." + svc.name + "/" + m.Name,
+				m: &method{
+					fn:      reflect.ValueOf(svc.impl).MethodByName(m.Name),
+					params:  params,
+					results: results,
+				},
+				request:  request,
+				response: response,
+			})
+		}
+		b.fdp.Service = append(b.fdp.Service, sdp)
+	}
+
+	file, err := protodesc.NewFile(b.fdp, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &schema{fdp: b.fdp, file: file, fields: b.fields, methods: map[string]*method{}}
+	for _, p := range methods {
+		p.m.request = file.Messages().ByName(protoreflect.Name(p.request))
+		p.m.response = file.Messages().ByName(protoreflect.Name(p.response))
+		s.methods[p.key] = p.m
+	}
+	return s, nil
+}
+
+// messageName returns an unused name for the request or response message of
+// the provided method: "<method><suffix>" if unused, or
+// "<service><method><suffix>" otherwise.
+func (b *builder) messageName(service, method, suffix string) (string, error) {
+	for _, name := range []string{method + suffix, service + method + suffix} {
+		if !b.used[name] {
+			b.used[name] = true
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("%s.%s: no unused name for the %s message", service, method, strings.ToLower(suffix))
+}
+
+// signature returns the parameters and results of a component method,
+// excluding the leading context and the trailing error.
+func signature(t reflect.Type) ([]reflect.Type, []reflect.Type, error) {
+	if t.NumIn() == 0 || t.In(0) != contextType {
+		return nil, nil, fmt.Errorf("first parameter is not a context.Context")
+	}
+	if t.NumOut() == 0 || t.Out(t.NumOut()-1) != errorType {
+		return nil, nil, fmt.Errorf("last result is not an error")
+	}
+	var params, results []reflect.Type
+	for i := 1; i < t.NumIn(); i++ {
+		params = append(params, t.In(i))
+	}
+	for i := 0; i < t.NumOut()-1; i++ {
+		results = append(results, t.Out(i))
+	}
+	return params, results, nil
+}
+
+// collectStructs adds the structs reachable from t to structs. It returns an
+// error if t can't be represented in protobuf.
+func collectStructs(t reflect.Type, structs map[reflect.Type]bool) error {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return nil // bytes
+		}
+		if k := t.Elem().Kind(); (k == reflect.Slice && t.Elem().Elem().Kind() != reflect.Uint8) || k == reflect.Array || k == reflect.Map {
+			return fmt.Errorf("unsupported nested collection %v", t)
+		}
+		return collectStructs(t.Elem(), structs)
+	case reflect.Map:
+		if !isMapKey(t.Key()) {
+			return fmt.Errorf("unsupported map key type %v", t.Key())
+		}
+		if k := t.Elem().Kind(); (k == reflect.Slice && t.Elem().Elem().Kind() != reflect.Uint8) || k == reflect.Array || k == reflect.Map {
+			return fmt.Errorf("unsupported nested collection %v", t)
+		}
+		return collectStructs(t.Elem(), structs)
+	case reflect.Pointer:
+		if t.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("unsupported pointer type %v", t)
+		}
+		return collectStructs(t.Elem(), structs)
+	case reflect.Struct:
+		if t.Name() == "" {
+			return fmt.Errorf("unsupported unnamed struct %v", t)
+		}
+		if structs[t] {
+			return nil
+		}
+		structs[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() || f.Type == autoMarshalType {
+				continue
+			}
+			if err := collectStructs(f.Type, structs); err != nil {
+				return fmt.Errorf("field %s: %w", f.Name, err)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported type %v", t)
+	}
+}
+
+// isMapKey returns whether t can be the key of a protobuf map.
+func isMapKey(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.String:
+		return true
+	default:
+		return false
+	}
+}
+
+// addField adds a field of type t to msg, numbered after the existing fields.
+// REQUIRES: collectStructs(t) succeeded.
+func (b *builder) addField(msg *descriptorpb.DescriptorProto, name string, t reflect.Type) error {
+	fdp := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		Number:   proto.Int32(int32(len(msg.Field) + 1)),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		JsonName: proto.String(jsonName(name)),
+	}
+	switch {
+	case t.Kind() == reflect.Map:
+		// A map is a repeated field of a nested entry message.
+		entry := &descriptorpb.DescriptorProto{
+			Name:    proto.String(camelCase(name) + "Entry"),
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		}
+		if err := b.addField(entry, "key", t.Key()); err != nil {
+			return err
+		}
+		if err := b.addField(entry, "value", t.Elem()); err != nil {
+			return err
+		}
+		msg.NestedType = append(msg.NestedType, entry)
+		fdp.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		fdp.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		fdp.TypeName = proto.String("." + b.fdp.GetPackage() + "." + msg.GetName() + "." + entry.GetName())
+	case (t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8) || t.Kind() == reflect.Array:
+		fdp.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		b.setType(fdp, t.Elem())
+	default:
+		b.setType(fdp, t)
+	}
+	msg.Field = append(msg.Field, fdp)
+	return nil
+}
+
+// setType sets the type of a singular field, or of the elements of a
+// repeated field.
+func (b *builder) setType(fdp *descriptorpb.FieldDescriptorProto, t reflect.Type) {
+	var typ descriptorpb.FieldDescriptorProto_Type
+	switch t.Kind() {
+	case reflect.Bool:
+		typ = descriptorpb.FieldDescriptorProto_TYPE_BOOL
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		typ = descriptorpb.FieldDescriptorProto_TYPE_INT32
+	case reflect.Int, reflect.Int64:
+		typ = descriptorpb.FieldDescriptorProto_TYPE_INT64
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		typ = descriptorpb.FieldDescriptorProto_TYPE_UINT32
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		typ = descriptorpb.FieldDescriptorProto_TYPE_UINT64
+	case reflect.Float32:
+		typ = descriptorpb.FieldDescriptorProto_TYPE_FLOAT
+	case reflect.Float64:
+		typ = descriptorpb.FieldDescriptorProto_TYPE_DOUBLE
+	case reflect.String:
+		typ = descriptorpb.FieldDescriptorProto_TYPE_STRING
+	case reflect.Slice:
+		typ = descriptorpb.FieldDescriptorProto_TYPE_BYTES
+	case reflect.Pointer:
+		b.setType(fdp, t.Elem())
+		return
+	case reflect.Struct:
+		typ = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+		fdp.TypeName = proto.String("." + b.fdp.GetPackage() + "." + b.names[t])
+	}
+	fdp.Type = typ.Enum()
+}
+
+// snakeCase converts a Go identifier to snake case, e.g., "productID" to
+// "product_id".
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			next := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && next) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// camelCase converts a snake case name to upper camel case, e.g.,
+// "product_id" to "ProductId".
+func camelCase(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// jsonName returns the JSON name of a field, as computed by protoc.
+func jsonName(s string) string {
+	c := camelCase(s)
+	if c == "" {
+		return c
+	}
+	r := []rune(c)
+	if !unicode.IsUpper([]rune(s)[0]) {
+		r[0] = unicode.ToLower(r[0])
+	}
+	return string(r)
+}
@@ -15,10 +15,14 @@
 package weaver
 
 import (
+	"fmt"
+	"math/rand"
 	"net/http"
+	"runtime/debug"
 	"time"
 
 	"github.com/ServiceWeaver/weaver/metrics"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // TODO(mwhittaker): Measure the size of HTTP requests.
@@ -28,11 +32,13 @@ import (
 type httpLabels struct {
 	Label string // user-provided instrumentation label
 	Host  string // URL host
+	Route string // route template (e.g., /users/{id}), if known
 }
 
 type httpErrorLabels struct {
 	Label string // user-provided instrumentation label
 	Host  string // URL host
+	Route string // route template (e.g., /users/{id}), if known
 	Code  int    // HTTP status code (e.g., 404)
 }
 
@@ -45,19 +51,22 @@ var (
 		"serviceweaver_http_error_count",
 		"Count of HTTP replies with a 4XX or 5XX status code",
 	)
-	httpRequestLatencyMicros = metrics.NewHistogramMap[httpLabels](
+	httpRequestLatencyMicros = metrics.NewHistogramMapWithUnit[httpLabels](
 		"serviceweaver_http_request_latency_micros",
 		"Duration, in microseconds, of HTTP request execution",
+		"us",
 		metrics.NonNegativeBuckets,
 	)
-	httpRequestBytesReceived = metrics.NewHistogramMap[httpLabels](
+	httpRequestBytesReceived = metrics.NewHistogramMapWithUnit[httpLabels](
 		"serviceweaver_http_request_bytes_received",
 		"Number of bytes received by HTTP request handlers",
+		"By",
 		metrics.NonNegativeBuckets,
 	)
-	httpRequestBytesReturned = metrics.NewHistogramMap[httpLabels](
+	httpRequestBytesReturned = metrics.NewHistogramMapWithUnit[httpLabels](
 		"serviceweaver_http_request_bytes_returned",
 		"Number of bytes returned by HTTP request handlers",
+		"By",
 		metrics.NonNegativeBuckets,
 	)
 )
@@ -70,7 +79,38 @@ var (
 //   - serviceweaver_http_error_count: Total number of 4XX and 5XX replies.
 //   - serviceweaver_http_request_latency_micros: Execution latency in microseconds.
 func InstrumentHandler(label string, handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return InstrumentHandlerWithOptions(label, handler, HTTPOptions{})
+}
+
+// HTTPOptions configures the middleware installed by
+// [InstrumentHandlerWithOptions]. The zero value only maintains metrics, like
+// [InstrumentHandler].
+type HTTPOptions struct {
+	// Route, if not nil, returns the route template of a request, e.g.,
+	// "/users/{id}" for "/users/42", with which metrics, logs, and spans are
+	// labelled. Routes must have a small number of distinct values.
+	Route func(*http.Request) string
+
+	// Logger, if not nil, logs requests. Requests that panic or fail with a
+	// 5XX status code are always logged. Other requests are logged with
+	// probability LogSampleRate, a fraction between 0 and 1.
+	Logger        Logger
+	LogSampleRate float64
+
+	// RecoverPanics, if true, recovers the panics of the handler, replying
+	// with a 500 status code, if the handler hasn't replied yet.
+	RecoverPanics bool
+
+	// Trace, if true, traces every request, as a child of the caller's span
+	// if the request carries W3C trace context headers.
+	Trace bool
+}
+
+// InstrumentHandlerWithOptions is like [InstrumentHandler], but also installs
+// the request logging, panic recovery, and tracing middleware enabled by the
+// provided options.
+func InstrumentHandlerWithOptions(label string, handler http.Handler, opts HTTPOptions) http.Handler {
+	var instrumented http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		// TODO(spetrovic): It is possible for the user to override r.Host
 		// and therefore get an incorrect host label attached here. Consider
@@ -78,26 +118,86 @@ func InstrumentHandler(label string, handler http.Handler) http.Handler {
 		// listener attached to the HTTP server and return its associated
 		// hostname).
 		labels := httpLabels{Label: label, Host: r.Host}
+		if opts.Route != nil {
+			labels.Route = opts.Route(r)
+		}
 
 		httpRequestCounts.Get(labels).Add(1)
-		defer func() {
-			httpRequestLatencyMicros.Get(labels).Put(
-				float64(time.Since(start).Microseconds()))
-		}()
 		if size, ok := requestSize(r); ok {
 			httpRequestBytesReceived.Get(labels).Put(float64(size))
 		}
 		writer := responseWriterInstrumenter{w: w}
-		handler.ServeHTTP(&writer, r)
-		if writer.statusCode >= 400 && writer.statusCode < 600 {
-			httpRequestErrors.Get(httpErrorLabels{
-				Label: label,
-				Host:  r.Host,
-				Code:  writer.statusCode,
-			}).Add(1)
+		var recovered any
+		defer func() {
+			latency := time.Since(start)
+			if recovered != nil && writer.statusCode == 0 {
+				writer.WriteHeader(http.StatusInternalServerError)
+			}
+			httpRequestLatencyMicros.Get(labels).PutContext(r.Context(),
+				float64(latency.Microseconds()))
+			if writer.statusCode >= 400 && writer.statusCode < 600 {
+				httpRequestErrors.Get(httpErrorLabels{
+					Label: label,
+					Host:  r.Host,
+					Route: labels.Route,
+					Code:  writer.statusCode,
+				}).Add(1)
+			}
+			httpRequestBytesReturned.Get(labels).Put(float64(writer.responseSize(r)))
+			if opts.Logger != nil {
+				logRequest(opts, labels, r, &writer, latency, recovered)
+			}
+		}()
+		if opts.RecoverPanics {
+			defer func() {
+				if x := recover(); x != nil {
+					if x == http.ErrAbortHandler {
+						// The handler aborted the response on purpose.
+						panic(x)
+					}
+					recovered = fmt.Sprintf("%v\n%s", x, debug.Stack())
+				}
+			}()
 		}
-		httpRequestBytesReturned.Get(labels).Put(float64(writer.responseSize(r)))
+		handler.ServeHTTP(&writer, r)
 	})
+	if opts.Trace {
+		instrumented = otelhttp.NewHandler(instrumented, label,
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				if opts.Route != nil {
+					return r.Method + " " + opts.Route(r)
+				}
+				return r.Method + " " + label
+			}))
+	}
+	return instrumented
+}
+
+// logRequest logs a request served by a handler installed by
+// InstrumentHandlerWithOptions.
+func logRequest(opts HTTPOptions, labels httpLabels, r *http.Request, w *responseWriterInstrumenter, latency time.Duration, recovered any) {
+	status := w.statusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	attrs := []any{
+		"label", labels.Label,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"status", status,
+		"latency", latency,
+	}
+	if labels.Route != "" {
+		attrs = append(attrs, "route", labels.Route)
+	}
+	switch {
+	case recovered != nil:
+		opts.Logger.Error("HTTP handler panicked", fmt.Errorf("%v", recovered), attrs...)
+	case status >= 500:
+		opts.Logger.Error("HTTP request failed", nil, attrs...)
+	case rand.Float64() < opts.LogSampleRate:
+		opts.Logger.Info("HTTP request", attrs...)
+	}
 }
 
 // InstrumentHandlerFunc is identical to [InstrumentHandler] but takes a
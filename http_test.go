@@ -16,8 +16,12 @@ package weaver_test
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
 
 	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
 )
 
 func ExampleInstrumentHandler() {
@@ -26,3 +30,95 @@ func ExampleInstrumentHandler() {
 	mux.Handle("/bar", weaver.InstrumentHandler("bar", http.HandlerFunc(func(http.ResponseWriter, *http.Request) { /*...*/ })))
 	http.ListenAndServe(":9000", &mux)
 }
+
+func ExampleInstrumentHandlerWithOptions() {
+	var logger weaver.Logger // e.g., root.Logger()
+	handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { /*...*/ })
+	http.Handle("/users/", weaver.InstrumentHandlerWithOptions("users", handler, weaver.HTTPOptions{
+		Route:         func(*http.Request) string { return "/users/{id}" },
+		Logger:        logger,
+		LogSampleRate: 0.01,
+		RecoverPanics: true,
+		Trace:         true,
+	}))
+	http.ListenAndServe(":9000", nil)
+}
+
+// recordingLogger is a weaver.Logger that records the messages of the
+// entries it logs.
+type recordingLogger struct {
+	weaver.Logger
+	mu     sync.Mutex
+	errors []string
+	infos  []string
+}
+
+func (l *recordingLogger) Info(msg string, _ ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.infos = append(l.infos, msg)
+}
+
+func (l *recordingLogger) Error(msg string, _ error, _ ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, msg)
+}
+
+func TestInstrumentHandlerWithOptions(t *testing.T) {
+	logger := &recordingLogger{}
+	handler := weaver.InstrumentHandlerWithOptions("panicky", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/users/1" {
+			panic("boom")
+		}
+	}), weaver.HTTPOptions{
+		Route:         func(*http.Request) string { return "/users/{id}" },
+		Logger:        logger,
+		LogSampleRate: 1,
+		RecoverPanics: true,
+		Trace:         true,
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for path, want := range map[string]int{
+		"/users/1": http.StatusInternalServerError,
+		"/users/2": http.StatusOK,
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s: got status %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+
+	// Check the logs.
+	logger.mu.Lock()
+	if len(logger.errors) != 1 || logger.errors[0] != "HTTP handler panicked" {
+		t.Errorf("errors: got %v, want [HTTP handler panicked]", logger.errors)
+	}
+	if len(logger.infos) != 1 || logger.infos[0] != "HTTP request" {
+		t.Errorf("infos: got %v, want [HTTP request]", logger.infos)
+	}
+	logger.mu.Unlock()
+
+	// Check the metrics.
+	var requests, errors float64
+	for _, m := range metrics.Snapshot() {
+		if m.Labels["label"] != "panicky" || m.Labels["route"] != "/users/{id}" {
+			continue
+		}
+		switch m.Name {
+		case "serviceweaver_http_request_count":
+			requests += m.Value
+		case "serviceweaver_http_error_count":
+			errors += m.Value
+		}
+	}
+	if requests != 2 || errors != 1 {
+		t.Errorf("got %v requests and %v errors, want 2 and 1", requests, errors)
+	}
+}
@@ -0,0 +1,524 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpgateway exposes Service Weaver components as HTTP/JSON APIs,
+// along with an OpenAPI specification of the APIs and a typed TypeScript
+// client for them.
+//
+// The methods to expose are annotated in the component interface with their
+// HTTP method and path:
+//
+//	type Catalog interface {
+//		//weaver:http GET /products/{id}
+//		Get(ctx context.Context, id string) (Product, error)
+//
+//		//weaver:http GET /products
+//		Search(ctx context.Context, query string, limit int) ([]Product, error)
+//
+//		//weaver:http POST /products
+//		Add(ctx context.Context, p Product) error
+//	}
+//
+// "weaver generate" records the annotations. Method parameters are bound as
+// follows:
+//
+//   - A parameter named in the path, like id above, is bound to the
+//     corresponding path segment.
+//   - For GET and DELETE requests, the other parameters are bound to the query
+//     parameters with the same names, e.g., GET /products?query=shoe&limit=10.
+//     They must be booleans, numbers, strings, or slices of those, which are
+//     bound to repeated query parameters.
+//   - For POST, PUT, and PATCH requests, if a single parameter is left, it is
+//     bound to the JSON request body, like p above. If more parameters are
+//     left, the body is a JSON object with a field for every parameter.
+//
+// A method's result is written as JSON. If a method has more than one result
+// besides the error, the results are written as a JSON object with fields
+// result0, result1, and so on. A method without results returns 204 No
+// Content. Errors are returned as a JSON object with an error field.
+//
+// For example, in the Init method of a component:
+//
+//	catalog, err := weaver.Get[Catalog](c)
+//	...
+//	gateway, err := httpgateway.New(httpgateway.Options{Title: "Catalog"},
+//		httpgateway.Export("Catalog", catalog))
+//	...
+//	lis, err := c.Listener("api", weaver.ListenerOptions{})
+//	...
+//	go http.Serve(lis, gateway)
+//
+// The OpenAPI specification is served at /openapi.json by default, and the
+// TypeScript client at /client.ts. The client has an interface for every
+// struct, and a class for every service, with a method for every route:
+//
+//	const catalog = new CatalogClient({baseURL: "https://api.example.com"});
+//	const products = await catalog.search("shoe", 10);
+//
+// To keep a web frontend in sync with the APIs, write Gateway.TypeScript to a
+// file in the frontend's source tree as part of its build, or fetch it from
+// the gateway.
+package httpgateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+)
+
+// maxBodySize is the maximum size of a request body.
+const maxBodySize = 4 << 20
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Options configures a Gateway.
+type Options struct {
+	// Title and Version are the title and version of the API in the OpenAPI
+	// specification. If empty, they default to "API" and "1.0".
+	Title   string
+	Version string
+
+	// SpecPath is the path where the OpenAPI specification is served. If
+	// empty, defaults to "/openapi.json".
+	SpecPath string
+
+	// ClientPath is the path where the TypeScript client is served. If
+	// empty, defaults to "/client.ts".
+	ClientPath string
+}
+
+// A Service is a component exported through a Gateway.
+type Service struct {
+	name   string
+	iface  reflect.Type
+	impl   any
+	params map[string][]string // parameter names, by method
+	routes map[string]string   // HTTP routes, by method
+}
+
+// Export exports the annotated methods of the component impl, typically
+// returned by weaver.Get. The name of the service is used to tag its
+// operations in the OpenAPI specification.
+func Export[T any](name string, impl T) Service {
+	iface := reflect.TypeOf((*T)(nil)).Elem()
+	svc := Service{name: name, iface: iface, impl: impl}
+	for _, reg := range codegen.Registered() {
+		if reg.Iface == iface {
+			svc.params = reg.ParamNames
+			svc.routes = reg.HTTPRoutes
+		}
+	}
+	return svc
+}
+
+// A Gateway is an http.Handler that serves the annotated methods of a set of
+// components.
+type Gateway struct {
+	routes     []*route
+	specPath   string
+	spec       []byte // JSON-encoded OpenAPI specification
+	clientPath string
+	client     []byte // TypeScript client
+}
+
+var _ http.Handler = &Gateway{}
+
+// route is an HTTP route to a component method.
+type route struct {
+	service  string
+	name     string        // name of the component method
+	method   string        // HTTP method
+	path     string        // e.g., "/products/{id}"
+	segments []string      // segments of path
+	fn       reflect.Value // component method
+	params   []param       // parameters, excluding the context
+	results  []reflect.Type
+	body     []int // indices of the parameters bound to the body
+}
+
+// param is a parameter of a component method.
+type param struct {
+	name string
+	t    reflect.Type
+	in   string // "path", "query", or "body"
+}
+
+// New returns a gateway for the annotated methods of the provided services.
+// It returns an error if a method can't be bound as described in the package
+// documentation.
+func New(opts Options, services ...Service) (*Gateway, error) {
+	g := &Gateway{specPath: opts.SpecPath, clientPath: opts.ClientPath}
+	if g.specPath == "" {
+		g.specPath = "/openapi.json"
+	}
+	if g.clientPath == "" {
+		g.clientPath = "/client.ts"
+	}
+	for _, svc := range services {
+		if svc.iface.Kind() != reflect.Interface {
+			return nil, fmt.Errorf("httpgateway: %s: %v is not an interface", svc.name, svc.iface)
+		}
+		names := make([]string, 0, len(svc.routes))
+		for name := range svc.routes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			r, err := newRoute(svc, name)
+			if err != nil {
+				return nil, fmt.Errorf("httpgateway: %s.%s: %w", svc.name, name, err)
+			}
+			for _, other := range g.routes {
+				if other.method == r.method && other.path == r.path {
+					return nil, fmt.Errorf("httpgateway: %s.%s and %s.%s have the same route %s %s", other.service, other.name, svc.name, name, r.method, r.path)
+				}
+			}
+			g.routes = append(g.routes, r)
+		}
+	}
+	spec, err := json.MarshalIndent(openAPI(opts, g.routes), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("httpgateway: %w", err)
+	}
+	g.spec = spec
+	g.client = typeScript(g.routes)
+	return g, nil
+}
+
+// TypeScript returns the source code of a TypeScript client for the gateway.
+func (g *Gateway) TypeScript() []byte {
+	return g.client
+}
+
+// newRoute returns the route to the provided method of svc.
+func newRoute(svc Service, name string) (*route, error) {
+	m, ok := svc.iface.MethodByName(name)
+	if !ok {
+		return nil, fmt.Errorf("method not found")
+	}
+	method, path, ok := strings.Cut(svc.routes[name], " ")
+	if !ok || !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid route %q", svc.routes[name])
+	}
+	t := m.Type
+	if t.NumIn() == 0 || t.In(0) != contextType {
+		return nil, fmt.Errorf("first parameter is not a context.Context")
+	}
+	if t.NumOut() == 0 || t.Out(t.NumOut()-1) != errorType {
+		return nil, fmt.Errorf("last result is not an error")
+	}
+	r := &route{
+		service:  svc.name,
+		name:     name,
+		method:   method,
+		path:     path,
+		segments: strings.Split(path[1:], "/"),
+		fn:       reflect.ValueOf(svc.impl).MethodByName(name),
+	}
+	for i := 0; i < t.NumOut()-1; i++ {
+		r.results = append(r.results, t.Out(i))
+	}
+
+	inPath := map[string]bool{}
+	for _, s := range r.segments {
+		if isParam(s) {
+			inPath[s[1:len(s)-1]] = true
+		}
+	}
+	names := svc.params[name]
+	for i := 1; i < t.NumIn(); i++ {
+		p := param{name: fmt.Sprintf("arg%d", i-1), t: t.In(i)}
+		if i-1 < len(names) && names[i-1] != "" && names[i-1] != "_" {
+			p.name = names[i-1]
+		}
+		switch {
+		case inPath[p.name]:
+			if !isScalar(p.t) {
+				return nil, fmt.Errorf("path parameter %s has unsupported type %v", p.name, p.t)
+			}
+			p.in = "path"
+			delete(inPath, p.name)
+		case method == http.MethodGet || method == http.MethodDelete:
+			if !isScalar(p.t) && !(p.t.Kind() == reflect.Slice && isScalar(p.t.Elem())) {
+				return nil, fmt.Errorf("query parameter %s has unsupported type %v", p.name, p.t)
+			}
+			p.in = "query"
+		default:
+			p.in = "body"
+			r.body = append(r.body, len(r.params))
+		}
+		r.params = append(r.params, p)
+	}
+	for name := range inPath {
+		return nil, fmt.Errorf("path parameter %q is not a parameter of the method", name)
+	}
+	return r, nil
+}
+
+// isParam returns whether a path segment is a parameter, e.g., "{id}".
+func isParam(segment string) bool {
+	return len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}'
+}
+
+// isScalar returns whether values of type t can be parsed from strings.
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseScalar parses s into a value of type t.
+// REQUIRES: isScalar(t).
+func parseScalar(s string, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		v.SetString(s)
+	}
+	return v, nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == g.specPath && r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(g.spec)
+		return
+	}
+	if r.URL.Path == g.clientPath && r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(g.client)
+		return
+	}
+
+	segments := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	var allowed []string
+	for _, rt := range g.routes {
+		values, ok := rt.match(segments)
+		if !ok {
+			continue
+		}
+		if rt.method != r.Method {
+			allowed = append(allowed, rt.method)
+			continue
+		}
+		rt.serve(w, r, values)
+		return
+	}
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	writeError(w, http.StatusNotFound, fmt.Errorf("%s not found", r.URL.Path))
+}
+
+// match matches the segments of an escaped request path against the route,
+// and returns the unescaped values of the path parameters.
+func (rt *route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(rt.segments) {
+		return nil, false
+	}
+	values := map[string]string{}
+	for i, s := range rt.segments {
+		v, err := url.PathUnescape(segments[i])
+		if err != nil {
+			return nil, false
+		}
+		if isParam(s) {
+			values[s[1:len(s)-1]] = v
+		} else if s != v {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// serve serves a request for the route.
+func (rt *route) serve(w http.ResponseWriter, r *http.Request, values map[string]string) {
+	args := make([]reflect.Value, 1+len(rt.params))
+	args[0] = reflect.ValueOf(r.Context())
+	query := r.URL.Query()
+	for i, p := range rt.params {
+		switch p.in {
+		case "path":
+			v, err := parseScalar(values[p.name], p.t)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("path parameter %s: %w", p.name, err))
+				return
+			}
+			args[1+i] = v
+		case "query":
+			v := reflect.New(p.t).Elem()
+			if p.t.Kind() == reflect.Slice {
+				for _, s := range query[p.name] {
+					e, err := parseScalar(s, p.t.Elem())
+					if err != nil {
+						writeError(w, http.StatusBadRequest, fmt.Errorf("query parameter %s: %w", p.name, err))
+						return
+					}
+					v = reflect.Append(v, e)
+				}
+			} else if query.Has(p.name) {
+				var err error
+				if v, err = parseScalar(query.Get(p.name), p.t); err != nil {
+					writeError(w, http.StatusBadRequest, fmt.Errorf("query parameter %s: %w", p.name, err))
+					return
+				}
+			}
+			args[1+i] = v
+		}
+	}
+	if len(rt.body) > 0 {
+		if err := rt.decodeBody(r, args); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	results := rt.fn.Call(args)
+	if err, _ := results[len(results)-1].Interface().(error); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	var out any
+	switch len(rt.results) {
+	case 0:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case 1:
+		out = results[0].Interface()
+	default:
+		fields := map[string]any{}
+		for i := range rt.results {
+			fields[fmt.Sprintf("result%d", i)] = results[i].Interface()
+		}
+		out = fields
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("encode response: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// decodeBody decodes the request body into the body parameters.
+func (rt *route) decodeBody(r *http.Request, args []reflect.Value) error {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	if len(data) > maxBodySize {
+		return fmt.Errorf("body exceeds %d bytes", maxBodySize)
+	}
+	if len(rt.body) == 1 {
+		i := rt.body[0]
+		v := reflect.New(rt.params[i].t)
+		if err := json.Unmarshal(data, v.Interface()); err != nil {
+			return fmt.Errorf("decode body: %w", err)
+		}
+		args[1+i] = v.Elem()
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("decode body: %w", err)
+	}
+	for _, i := range rt.body {
+		p := rt.params[i]
+		v := reflect.New(p.t)
+		if raw, ok := fields[p.name]; ok {
+			if err := json.Unmarshal(raw, v.Interface()); err != nil {
+				return fmt.Errorf("decode body field %s: %w", p.name, err)
+			}
+			delete(fields, p.name)
+		}
+		args[1+i] = v.Elem()
+	}
+	for name := range fields {
+		return fmt.Errorf("unknown body field %s", name)
+	}
+	return nil
+}
+
+// errorStatus returns the HTTP status for an error returned by a component
+// method.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, weaver.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, weaver.ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, weaver.ErrRetriable), errors.Is(err, weaver.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError writes an error response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
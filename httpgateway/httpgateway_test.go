@@ -0,0 +1,310 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpgateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+type Product struct {
+	weaver.AutoMarshal
+	ID    string   `json:"id"`
+	Name  string   `json:"name"`
+	Tags  []string `json:"tags,omitempty"`
+	Price float64  `json:"price"`
+}
+
+type catalog interface {
+	Get(ctx context.Context, id string) (Product, error)
+	Search(ctx context.Context, query string, limit int, tags []string) ([]Product, error)
+	Add(ctx context.Context, p Product) error
+	Rename(ctx context.Context, id string, name string, force bool) (Product, bool, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type catalogImpl struct{}
+
+func (catalogImpl) Get(_ context.Context, id string) (Product, error) {
+	return Product{ID: id, Name: "shoe", Price: 9.5}, nil
+}
+
+func (catalogImpl) Search(_ context.Context, query string, limit int, tags []string) ([]Product, error) {
+	var ps []Product
+	for i := 0; i < limit; i++ {
+		ps = append(ps, Product{Name: query, Tags: tags})
+	}
+	return ps, nil
+}
+
+func (catalogImpl) Add(_ context.Context, p Product) error {
+	if p.Name == "" {
+		return errors.New("missing name")
+	}
+	return nil
+}
+
+func (catalogImpl) Rename(_ context.Context, id, name string, force bool) (Product, bool, error) {
+	return Product{ID: id, Name: name}, force, nil
+}
+
+func (catalogImpl) Delete(context.Context, string) error {
+	return weaver.ErrRetriable
+}
+
+func newTestGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+	svc := Export[catalog]("Catalog", catalogImpl{})
+	// The parameter names and routes are usually recorded by
+	// "weaver generate".
+	svc.params = map[string][]string{
+		"Get":    {"id"},
+		"Search": {"query", "limit", "tags"},
+		"Add":    {"p"},
+		"Rename": {"id", "name", "force"},
+		"Delete": {"id"},
+	}
+	svc.routes = map[string]string{
+		"Get":    "GET /products/{id}",
+		"Search": "GET /products",
+		"Add":    "POST /products",
+		"Rename": "PATCH /products/{id}",
+		"Delete": "DELETE /products/{id}",
+	}
+	g, err := New(Options{Title: "Catalog"}, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(g)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestGateway(t *testing.T) {
+	ts := newTestGateway(t)
+	for _, test := range []struct {
+		method, path, body string
+		wantStatus         int
+		wantBody           string
+	}{
+		{"GET", "/products/a%2Fb", "", 200, `{"id":"a/b","name":"shoe","price":9.5}`},
+		{"GET", "/products?query=hat&limit=2&tags=x&tags=y", "", 200,
+			`[{"id":"","name":"hat","tags":["x","y"],"price":0},{"id":"","name":"hat","tags":["x","y"],"price":0}]`},
+		{"GET", "/products?limit=many", "", 400, `{"error":"query parameter limit: strconv.ParseInt: parsing \"many\": invalid syntax"}`},
+		{"POST", "/products", `{"id":"1","name":"hat"}`, 204, ``},
+		{"POST", "/products", `{"id":"1"}`, 500, `{"error":"missing name"}`},
+		{"POST", "/products", `not json`, 400, `{"error":"decode body: invalid character 'o' in literal null (expecting 'u')"}`},
+		{"PATCH", "/products/1", `{"name":"cap","force":true}`, 200, `{"result0":{"id":"1","name":"cap","price":0},"result1":true}`},
+		{"PATCH", "/products/1", `{"color":"red"}`, 400, `{"error":"unknown body field color"}`},
+		{"DELETE", "/products/1", ``, 503, `{"error":"retriable"}`},
+		{"PUT", "/products/1", ``, 405, `{"error":"method PUT not allowed"}`},
+		{"GET", "/orders", ``, 404, `{"error":"/orders not found"}`},
+	} {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, ts.URL+test.path, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != test.wantStatus || string(body) != test.wantBody {
+				t.Fatalf("got %d %s, want %d %s", resp.StatusCode, body, test.wantStatus, test.wantBody)
+			}
+		})
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	ts := newTestGateway(t)
+	resp, err := http.Get(ts.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var spec struct {
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]json.RawMessage
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		t.Fatal(err)
+	}
+
+	var ops []string
+	for path, item := range spec.Paths {
+		for method := range item {
+			ops = append(ops, method+" "+path)
+		}
+	}
+	want := []string{
+		"delete /products/{id}",
+		"get /products",
+		"get /products/{id}",
+		"patch /products/{id}",
+		"post /products",
+	}
+	if diff := cmp.Diff(want, ops, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Fatalf("operations (-want +got):\n%s", diff)
+	}
+
+	var product any
+	if err := json.Unmarshal(spec.Components.Schemas["Product"], &product); err != nil {
+		t.Fatal(err)
+	}
+	wantProduct := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id":    map[string]any{"type": "string"},
+			"name":  map[string]any{"type": "string"},
+			"tags":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"price": map[string]any{"type": "number", "format": "double"},
+		},
+	}
+	if diff := cmp.Diff(wantProduct, product); diff != "" {
+		t.Fatalf("Product schema (-want +got):\n%s", diff)
+	}
+}
+
+func TestTypeScript(t *testing.T) {
+	ts := newTestGateway(t)
+	resp, err := http.Get(ts.URL + "/client.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := string(data)
+	for _, want := range []string{
+		`export interface Product {
+  id: string;
+  name: string;
+  tags?: string[];
+  price: number;
+}`,
+		`export class CatalogClient {`,
+		`async get(id: string): Promise<Product> {
+    const path = "/products/" + encodeURIComponent(String(id));
+    return call(this.opts, "GET", path, undefined, undefined);
+  }`,
+		`async search(query_: string, limit: number, tags: string[]): Promise<Product[]> {
+    const path = "/products";
+    const query = new URLSearchParams();
+    query.set("query", String(query_));
+    query.set("limit", String(limit));
+    for (const v of tags ?? []) {
+      query.append("tags", String(v));
+    }
+    return call(this.opts, "GET", path, query, undefined);
+  }`,
+		`async add(p: Product): Promise<void> {`,
+		`return call(this.opts, "POST", path, undefined, p);`,
+		`async rename(id: string, name: string, force: boolean): Promise<{ result0: Product; result1: boolean }> {`,
+		`return call(this.opts, "PATCH", path, undefined, { "name": name, "force": force });`,
+	} {
+		if !strings.Contains(client, want) {
+			t.Errorf("client does not contain %q:\n%s", want, client)
+		}
+	}
+}
+
+type node struct {
+	Value    int               `json:"value"`
+	Children []*node           `json:"children"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Ignored  string            `json:"-"`
+	When     time.Time
+	Point    struct{ X, Y int }
+}
+
+func TestTypeScriptTypes(t *testing.T) {
+	ts := &tsTypes{names: map[reflect.Type]string{}, used: map[string]bool{}}
+	for _, test := range []struct {
+		v    any
+		want string
+	}{
+		{true, "boolean"},
+		{int64(1), "number"},
+		{[]byte{}, "string"},
+		{[3]string{}, "string[]"},
+		{map[string][]int{}, "Record<string, number[]>"},
+		{(*int)(nil), "number | null"},
+		{[]*int{}, "(number | null)[]"},
+		{node{}, "node"},
+	} {
+		if got := ts.typ(reflect.TypeOf(test.v)); got != test.want {
+			t.Errorf("typ(%T): got %q, want %q", test.v, got, test.want)
+		}
+	}
+
+	want := `export interface node {
+  value: number;
+  children: (node | null)[];
+  labels?: Record<string, string>;
+  When: string;
+  Point: { X: number; Y: number; };
+}
+`
+	if diff := cmp.Diff([]string{want}, ts.decls); diff != "" {
+		t.Errorf("declarations (-want +got):\n%s", diff)
+	}
+}
+
+type bad interface {
+	M(ctx context.Context, p Product) error
+}
+
+type badImpl struct{}
+
+func (badImpl) M(context.Context, Product) error { return nil }
+
+func TestInvalidRoutes(t *testing.T) {
+	for _, route := range []string{
+		"GET /products/{name}", // unknown path parameter
+		"GET /products",        // struct query parameter
+		"POST /products/{p}",   // struct path parameter
+	} {
+		t.Run(route, func(t *testing.T) {
+			svc := Export[bad]("Bad", badImpl{})
+			svc.params = map[string][]string{"M": {"p"}}
+			svc.routes = map[string]string{"M": route}
+			if _, err := New(Options{}, svc); err == nil {
+				t.Fatalf("unexpected success for route %q", route)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpgateway
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// object is a JSON object in an OpenAPI specification.
+type object = map[string]any
+
+// openAPI returns the OpenAPI specification of the provided routes.
+func openAPI(opts Options, routes []*route) object {
+	title, version := opts.Title, opts.Version
+	if title == "" {
+		title = "API"
+	}
+	if version == "" {
+		version = "1.0"
+	}
+	s := &schemas{
+		names:   map[reflect.Type]string{},
+		schemas: object{},
+	}
+	s.schemas["Error"] = object{
+		"type":       "object",
+		"properties": object{"error": object{"type": "string"}},
+	}
+	errorResponse := object{
+		"description": "Error",
+		"content":     object{"application/json": object{"schema": ref("Error")}},
+	}
+
+	paths := object{}
+	for _, rt := range routes {
+		op := object{
+			"operationId": rt.service + "_" + rt.name,
+			"tags":        []string{rt.service},
+			"responses":   object{"default": errorResponse},
+		}
+
+		var params []object
+		for _, p := range rt.params {
+			switch p.in {
+			case "path":
+				params = append(params, object{"name": p.name, "in": "path", "required": true, "schema": s.schema(p.t)})
+			case "query":
+				params = append(params, object{"name": p.name, "in": "query", "schema": s.schema(p.t)})
+			}
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if len(rt.body) > 0 {
+			var body object
+			if len(rt.body) == 1 {
+				body = s.schema(rt.params[rt.body[0]].t)
+			} else {
+				props := object{}
+				for _, i := range rt.body {
+					props[rt.params[i].name] = s.schema(rt.params[i].t)
+				}
+				body = object{"type": "object", "properties": props}
+			}
+			op["requestBody"] = object{
+				"required": true,
+				"content":  object{"application/json": object{"schema": body}},
+			}
+		}
+
+		responses := op["responses"].(object)
+		switch len(rt.results) {
+		case 0:
+			responses["204"] = object{"description": "No Content"}
+		default:
+			var result object
+			if len(rt.results) == 1 {
+				result = s.schema(rt.results[0])
+			} else {
+				props := object{}
+				for i, t := range rt.results {
+					props[fmt.Sprintf("result%d", i)] = s.schema(t)
+				}
+				result = object{"type": "object", "properties": props}
+			}
+			responses["200"] = object{
+				"description": "OK",
+				"content":     object{"application/json": object{"schema": result}},
+			}
+		}
+
+		item, ok := paths[rt.path].(object)
+		if !ok {
+			item = object{}
+			paths[rt.path] = item
+		}
+		item[strings.ToLower(rt.method)] = op
+	}
+
+	return object{
+		"openapi":    "3.0.3",
+		"info":       object{"title": title, "version": version},
+		"paths":      paths,
+		"components": object{"schemas": s.schemas},
+	}
+}
+
+// ref returns a reference to the named schema.
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// schemas holds the schemas of named structs.
+type schemas struct {
+	names   map[reflect.Type]string // names of the schemas of structs
+	schemas object                  // schemas, by name
+}
+
+// schema returns the schema of the JSON encoding of values of type t.
+func (s *schemas) schema(t reflect.Type) object {
+	switch {
+	case t == timeType:
+		return object{"type": "string", "format": "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		return object{} // any value
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return object{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return object{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64:
+		return object{"type": "integer", "format": "int64"}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return object{"type": "integer", "format": "int32", "minimum": 0}
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return object{"type": "integer", "format": "int64", "minimum": 0}
+	case reflect.Float32:
+		return object{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return object{"type": "number", "format": "double"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return object{"type": "string", "format": "byte"}
+		}
+		return object{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Array:
+		return object{"type": "array", "items": s.schema(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Pointer:
+		schema := s.schema(t.Elem())
+		if _, ok := schema["$ref"]; ok {
+			// Siblings of $ref are ignored, so wrap the reference.
+			return object{"allOf": []object{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		name, ok := s.names[t]
+		if !ok {
+			name = s.name(t)
+			s.names[t] = name
+			s.schemas[name] = object{} // placeholder, for recursive types
+			s.schemas[name] = s.structSchema(t)
+		}
+		return ref(name)
+	default:
+		return object{} // any value
+	}
+}
+
+// name returns an unused schema name for the struct t: its Go name if
+// unused, or its Go name qualified by its package otherwise.
+func (s *schemas) name(t reflect.Type) string {
+	if _, ok := s.schemas[t.Name()]; !ok {
+		return t.Name()
+	}
+	pkg := t.PkgPath()
+	return pkg[strings.LastIndex(pkg, "/")+1:] + "_" + t.Name()
+}
+
+// structSchema returns the schema of the struct t, following the rules of
+// encoding/json.
+func (s *schemas) structSchema(t reflect.Type) object {
+	props := object{}
+	s.addFields(t, props)
+	return object{"type": "object", "properties": props}
+}
+
+// addFields adds the JSON fields of the struct t to props.
+func (s *schemas) addFields(t reflect.Type, props object) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				// The fields of embedded structs are promoted.
+				s.addFields(ft, props)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := props[name]; !ok {
+			props[name] = s.schema(f.Type)
+		}
+	}
+}
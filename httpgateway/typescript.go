@@ -0,0 +1,373 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpgateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// clientPrelude is the part of a TypeScript client shared by all services.
+const clientPrelude = `// Code generated by httpgateway. DO NOT EDIT.
+
+/** Options configures a client. */
+export interface ClientOptions {
+  /** The URL of the gateway, e.g., "https://api.example.com". Defaults to "". */
+  baseURL?: string;
+  /** Headers added to every request. */
+  headers?: Record<string, string>;
+  /** The fetch function used to send requests. Defaults to fetch. */
+  fetch?: typeof fetch;
+}
+
+/** GatewayError is thrown when a method returns an error. */
+export class GatewayError extends Error {
+  constructor(readonly status: number, message: string) {
+    super(message);
+    this.name = "GatewayError";
+  }
+}
+
+async function call(opts: ClientOptions, method: string, path: string, query?: URLSearchParams, body?: unknown): Promise<any> {
+  let url = (opts.baseURL ?? "") + path;
+  const q = query?.toString();
+  if (q) {
+    url += "?" + q;
+  }
+  const headers: Record<string, string> = { ...opts.headers };
+  const init: RequestInit = { method, headers };
+  if (body !== undefined) {
+    headers["Content-Type"] = "application/json";
+    init.body = JSON.stringify(body);
+  }
+  const resp = await (opts.fetch ?? fetch)(url, init);
+  if (!resp.ok) {
+    let message = resp.statusText;
+    try {
+      message = (await resp.json()).error ?? message;
+    } catch {
+      // Not a JSON error.
+    }
+    throw new GatewayError(resp.status, message);
+  }
+  if (resp.status === 204) {
+    return undefined;
+  }
+  return resp.json();
+}
+`
+
+// tsReserved holds the TypeScript reserved words that may clash with the
+// names of parameters.
+var tsReserved = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true,
+	"continue": true, "debugger": true, "default": true, "delete": true,
+	"do": true, "else": true, "enum": true, "export": true, "extends": true,
+	"false": true, "finally": true, "for": true, "function": true, "if": true,
+	"import": true, "in": true, "instanceof": true, "new": true, "null": true,
+	"return": true, "super": true, "switch": true, "this": true, "throw": true,
+	"true": true, "try": true, "typeof": true, "var": true, "void": true,
+	"while": true, "with": true, "query": true, "body": true, "opts": true,
+}
+
+// typeScript returns a TypeScript client for the provided routes, with an
+// interface for every named struct and a class for every service.
+func typeScript(routes []*route) []byte {
+	ts := &tsTypes{names: map[reflect.Type]string{}, used: map[string]bool{}}
+
+	// Group the routes by service, in order.
+	var services []string
+	byService := map[string][]*route{}
+	for _, rt := range routes {
+		if _, ok := byService[rt.service]; !ok {
+			services = append(services, rt.service)
+		}
+		byService[rt.service] = append(byService[rt.service], rt)
+	}
+
+	var classes strings.Builder
+	for _, svc := range services {
+		fmt.Fprintf(&classes, "\n/** %sClient calls the %s service. */\n", svc, svc)
+		fmt.Fprintf(&classes, "export class %sClient {\n", svc)
+		fmt.Fprintf(&classes, "  constructor(private readonly opts: ClientOptions = {}) {}\n")
+		for _, rt := range byService[svc] {
+			ts.method(&classes, rt)
+		}
+		fmt.Fprintf(&classes, "}\n")
+	}
+
+	var b strings.Builder
+	b.WriteString(clientPrelude)
+	for _, decl := range ts.decls {
+		b.WriteString("\n")
+		b.WriteString(decl)
+	}
+	b.WriteString(classes.String())
+	return []byte(b.String())
+}
+
+// tsTypes holds the TypeScript interfaces of named structs.
+type tsTypes struct {
+	names map[reflect.Type]string // names of the interfaces of structs
+	used  map[string]bool         // used interface names
+	decls []string                // interface declarations
+}
+
+// method writes the method of a client class that calls the route.
+func (ts *tsTypes) method(b *strings.Builder, rt *route) {
+	var params []string
+	names := map[string]string{} // TypeScript names, by parameter name
+	for _, p := range rt.params {
+		name := p.name
+		if tsReserved[name] {
+			name += "_"
+		}
+		names[p.name] = name
+		params = append(params, fmt.Sprintf("%s: %s", name, ts.typ(p.t)))
+	}
+
+	var result string
+	switch len(rt.results) {
+	case 0:
+		result = "void"
+	case 1:
+		result = ts.typ(rt.results[0])
+	default:
+		var fields []string
+		for i, t := range rt.results {
+			fields = append(fields, fmt.Sprintf("result%d: %s", i, ts.typ(t)))
+		}
+		result = "{ " + strings.Join(fields, "; ") + " }"
+	}
+
+	fmt.Fprintf(b, "\n  /** Calls %s %s. */\n", rt.method, rt.path)
+	fmt.Fprintf(b, "  async %s(%s): Promise<%s> {\n", lowerFirst(rt.name), strings.Join(params, ", "), result)
+
+	// Path.
+	var path []string
+	literal := ""
+	for _, s := range rt.segments {
+		literal += "/"
+		if !isParam(s) {
+			literal += s
+			continue
+		}
+		path = append(path, jsString(literal), fmt.Sprintf("encodeURIComponent(String(%s))", names[s[1:len(s)-1]]))
+		literal = ""
+	}
+	if literal != "" {
+		path = append(path, jsString(literal))
+	}
+	fmt.Fprintf(b, "    const path = %s;\n", strings.Join(path, " + "))
+
+	// Query.
+	query := "undefined"
+	for _, p := range rt.params {
+		if p.in != "query" {
+			continue
+		}
+		if query == "undefined" {
+			query = "query"
+			fmt.Fprintf(b, "    const query = new URLSearchParams();\n")
+		}
+		if p.t.Kind() == reflect.Slice {
+			fmt.Fprintf(b, "    for (const v of %s ?? []) {\n", names[p.name])
+			fmt.Fprintf(b, "      query.append(%s, String(v));\n", jsString(p.name))
+			fmt.Fprintf(b, "    }\n")
+		} else {
+			fmt.Fprintf(b, "    query.set(%s, String(%s));\n", jsString(p.name), names[p.name])
+		}
+	}
+
+	// Body.
+	body := "undefined"
+	switch len(rt.body) {
+	case 0:
+	case 1:
+		body = names[rt.params[rt.body[0]].name]
+	default:
+		var fields []string
+		for _, i := range rt.body {
+			p := rt.params[i]
+			fields = append(fields, fmt.Sprintf("%s: %s", jsString(p.name), names[p.name]))
+		}
+		body = "{ " + strings.Join(fields, ", ") + " }"
+	}
+
+	fmt.Fprintf(b, "    return call(this.opts, %s, path, %s, %s);\n", jsString(rt.method), query, body)
+	fmt.Fprintf(b, "  }\n")
+}
+
+// typ returns the TypeScript type of the JSON encoding of values of type t.
+func (ts *tsTypes) typ(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "string"
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		return "unknown"
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string" // base64
+		}
+		return arrayOf(ts.typ(t.Elem()))
+	case reflect.Array:
+		return arrayOf(ts.typ(t.Elem()))
+	case reflect.Map:
+		return fmt.Sprintf("Record<string, %s>", ts.typ(t.Elem()))
+	case reflect.Pointer:
+		return ts.typ(t.Elem()) + " | null"
+	case reflect.Struct:
+		if t.Name() == "" {
+			return ts.structType(t, true)
+		}
+		name, ok := ts.names[t]
+		if !ok {
+			name = ts.name(t)
+			ts.names[t] = name
+			ts.used[name] = true
+			i := len(ts.decls)
+			ts.decls = append(ts.decls, "") // placeholder, for recursive types
+			ts.decls[i] = fmt.Sprintf("export interface %s %s\n", name, ts.structType(t, false))
+		}
+		return name
+	default:
+		return "unknown"
+	}
+}
+
+// arrayOf returns the TypeScript type of an array of elem.
+func arrayOf(elem string) string {
+	if strings.Contains(elem, " ") {
+		return "(" + elem + ")[]"
+	}
+	return elem + "[]"
+}
+
+// name returns an unused interface name for the struct t: its Go name if
+// unused, or its Go name qualified by its package otherwise.
+func (ts *tsTypes) name(t reflect.Type) string {
+	if !ts.used[t.Name()] {
+		return t.Name()
+	}
+	pkg := t.PkgPath()
+	return pkg[strings.LastIndex(pkg, "/")+1:] + "_" + t.Name()
+}
+
+// structType returns the TypeScript type of the struct t, following the rules
+// of encoding/json. Fields with the omitempty option are optional. If inline
+// is true, the type is written on a single line.
+func (ts *tsTypes) structType(t reflect.Type, inline bool) string {
+	type field struct{ name, typ string }
+	var fields []field
+	seen := map[string]bool{}
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					// The fields of embedded structs are promoted.
+					add(ft)
+					continue
+				}
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			key := jsString(name)
+			if isIdentifier(name) {
+				key = name
+			}
+			if strings.Contains(opts, "omitempty") {
+				key += "?"
+			}
+			fields = append(fields, field{key, ts.typ(f.Type)})
+		}
+	}
+	add(t)
+	if len(fields) == 0 {
+		return "{}"
+	}
+	var b strings.Builder
+	if inline {
+		b.WriteString("{")
+		for _, f := range fields {
+			fmt.Fprintf(&b, " %s: %s;", f.name, f.typ)
+		}
+		b.WriteString(" }")
+		return b.String()
+	}
+	b.WriteString("{\n")
+	for _, f := range fields {
+		fmt.Fprintf(&b, "  %s: %s;\n", f.name, f.typ)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// isIdentifier returns whether s is a valid TypeScript identifier.
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if !(r == '_' || r == '$' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// lowerFirst returns s with its first letter in lower case.
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
+
+// jsString returns s as a JavaScript string literal.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
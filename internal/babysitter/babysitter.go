@@ -20,21 +20,24 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
-	"math"
 	"net"
 	"net/http"
 	"os"
 	"sort"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/ServiceWeaver/weaver/internal/election"
 	"github.com/ServiceWeaver/weaver/internal/envelope/conn"
 	"github.com/ServiceWeaver/weaver/internal/logtype"
 	imetrics "github.com/ServiceWeaver/weaver/internal/metrics"
 	"github.com/ServiceWeaver/weaver/internal/net/call"
 	"github.com/ServiceWeaver/weaver/internal/proxy"
+	"github.com/ServiceWeaver/weaver/internal/routing"
 	"github.com/ServiceWeaver/weaver/internal/status"
 	"github.com/ServiceWeaver/weaver/internal/versioned"
+	"github.com/ServiceWeaver/weaver/runtime"
 	"github.com/ServiceWeaver/weaver/runtime/envelope"
 	"github.com/ServiceWeaver/weaver/runtime/logging"
 	"github.com/ServiceWeaver/weaver/runtime/metrics"
@@ -57,6 +60,13 @@ const (
 
 	// appVersionStateKey is the key where we track the state for a given application version.
 	appVersionStateKey = "app_version_state"
+
+	// autoscaleInterval is how often processes are autoscaled.
+	autoscaleInterval = 15 * time.Second
+
+	// scaleDownDelay is how long a process must want fewer replicas before
+	// it is scaled down, to avoid flapping.
+	scaleDownDelay = time.Minute
 )
 
 // See createAndRunEnvelopeForMain.
@@ -87,15 +97,44 @@ type Babysitter struct {
 	// statsProcessor tracks and computes stats to be rendered on the /statusz page.
 	statsProcessor *imetrics.StatsProcessor
 
-	mu          sync.RWMutex
-	managed     map[string][]*envelope.Envelope
-	appInfo     *versioned.Map[*AppVersionState]
-	routingInfo *versioned.Map[*protos.RoutingInfo]
-	proxies     map[string]*proxyInfo // proxies, by listener name
+	// elections tracks the leases of the deployment's leader elections.
+	elections *election.Leases
+
+	mu             sync.RWMutex
+	managed        map[string][]*envelope.Envelope
+	groups         map[string]*protos.ColocationGroup // colocation groups, by process
+	replicaAddrs   map[int64]string                   // replica addresses, by pid
+	scaleDownSince map[string]time.Time               // see autoscaleProcess
+	appInfo        *versioned.Map[*AppVersionState]
+	routingInfo    *versioned.Map[*protos.RoutingInfo]
+	proxies        map[string]*proxyInfo    // proxies, by listener name
+	udpProxies     map[string]*udpProxyInfo // proxies of packet listeners, by listener name
+	replication    int                      // replicas of every process; see SetReplication
+	canary         *CanaryOptions           // canary options, or nil if not a canary
+	chaos          *ChaosOptions            // chaos options, or nil if not in chaos mode
+	canaryBackends map[string][]string      // listeners proxied by the stable deployment
+	retired        chan struct{}            // see Retired
+	retireOnce     sync.Once                // closes retired
+
+	// shadowOf is the status server address of the deployment that this
+	// deployment is a shadow of, or empty if it is not a shadow.
+	shadowOf string
+
+	// shadow is the id of this deployment's shadow deployment, if any, and
+	// shadowComponents the components whose shadow routing info is served.
+	shadow           string
+	shadowComponents map[string]bool
 }
 
 type proxyInfo struct {
 	proxy *proxy.Proxy
+	addr  string             // dialable address of the proxy
+	stop  context.CancelFunc // stops the proxy
+}
+
+// udpProxyInfo holds information about the proxy of a packet listener.
+type udpProxyInfo struct {
+	proxy *proxy.UDPProxy
 	addr  string // dialable address of the proxy
 }
 
@@ -123,25 +162,47 @@ func NewBabysitter(ctx context.Context, dep *protos.Deployment, logSaver func(*p
 	}
 
 	b := &Babysitter{
-		ctx:            ctx,
-		logger:         logger,
-		logSaver:       logSaver,
-		traceSaver:     traceSaver,
-		statsProcessor: imetrics.NewStatsProcessor(),
-		opts:           envelope.Options{Restart: envelope.Never, Retry: retry.DefaultOptions},
-		dep:            dep,
-		managed:        map[string][]*envelope.Envelope{},
-		appInfo:        versioned.NewMap[*AppVersionState](),
-		routingInfo:    versioned.NewMap[*protos.RoutingInfo](),
-		proxies:        map[string]*proxyInfo{},
+		ctx:              ctx,
+		logger:           logger,
+		logSaver:         logSaver,
+		traceSaver:       traceSaver,
+		statsProcessor:   imetrics.NewStatsProcessor(),
+		elections:        election.NewLeases(),
+		replication:      DefaultReplication,
+		opts:             envelope.Options{Restart: envelope.Never, Retry: retry.DefaultOptions},
+		dep:              dep,
+		managed:          map[string][]*envelope.Envelope{},
+		groups:           map[string]*protos.ColocationGroup{},
+		replicaAddrs:     map[int64]string{},
+		scaleDownSince:   map[string]time.Time{},
+		appInfo:          versioned.NewMap[*AppVersionState](),
+		routingInfo:      versioned.NewMap[*protos.RoutingInfo](),
+		proxies:          map[string]*proxyInfo{},
+		udpProxies:       map[string]*udpProxyInfo{},
+		retired:          make(chan struct{}),
+		shadowComponents: map[string]bool{},
 	}
 	go b.statsProcessor.CollectMetrics(b.ctx, b.readMetrics)
+	go b.autoscale()
 	return b, nil
 }
 
+// SetReplication sets the number of replicas of every process started from
+// now on. Processes whose components are autoscaled start with as many
+// replicas as their autoscale policies ask for if every one of n replicas had
+// the target value of the metric. It defaults to DefaultReplication.
+func (b *Babysitter) SetReplication(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.replication = n
+}
+
 // RegisterStatusPages registers the status pages with the provided mux.
 func (b *Babysitter) RegisterStatusPages(mux *http.ServeMux) {
 	status.RegisterServer(mux, b, b.logger)
+	b.registerCanaryHandlers(mux)
+	b.registerShadowHandlers(mux)
+	b.registerConfigHandlers(mux)
 }
 
 // StartColocationGroup implements the protos.EnvelopeHandler interface.
@@ -236,6 +297,7 @@ func (b *Babysitter) RegisterReplica(req *protos.ReplicaToRegister) error {
 	if !found {
 		proc.Replicas = append(proc.Replicas, req.Address)
 		proc.ReplicaPids = append(proc.ReplicaPids, req.Pid)
+		b.replicaAddrs[req.Pid] = req.Address
 	}
 
 	if err := b.mayGenerateNewRoutingInfo(existing, req.App, req.DeploymentId, req.Process); err != nil {
@@ -258,6 +320,11 @@ func (b *Babysitter) GetRoutingInfo(req *protos.GetRoutingInfo) (*protos.Routing
 	return existing, nil
 }
 
+// ElectLeader implements the protos.EnvelopeHandler interface.
+func (b *Babysitter) ElectLeader(req *protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error) {
+	return b.elections.Elect(req, time.Now()), nil
+}
+
 // GetComponentsToStart implements the protos.EnvelopeHandler interface.
 func (b *Babysitter) GetComponentsToStart(req *protos.GetComponentsToStart) (*protos.ComponentsToStart, error) {
 	// Fetch components to start.
@@ -323,12 +390,30 @@ func (b *Babysitter) ExportListener(req *protos.ExportListenerRequest) (*protos.
 	existing.Listeners = append(existing.Listeners, req.Listener)
 	b.appInfo.Update(appVersionStateKey, existing)
 
+	if req.Listener.Network == "udp" {
+		return b.exportPacketListener(req)
+	}
 	if p, ok := b.proxies[req.Listener.Name]; ok {
 		p.proxy.AddBackend(req.Listener.Addr)
 		return &protos.ExportListenerReply{ProxyAddress: p.addr}, nil
 	}
 
-	lis, err := net.Listen("tcp", req.LocalAddress)
+	if b.canary != nil {
+		addr, err := b.exportToStable(req.Listener)
+		if err != nil {
+			return nil, err
+		}
+		if addr != "" {
+			return &protos.ExportListenerReply{ProxyAddress: addr}, nil
+		}
+	}
+
+	localAddr := req.LocalAddress
+	if b.shadowOf != "" {
+		// A shadow receives no traffic of its own.
+		localAddr = "localhost:0"
+	}
+	lis, err := net.Listen("tcp", localAddr)
 	if errors.Is(err, syscall.EADDRINUSE) {
 		// Don't retry if this address is already in use.
 		return &protos.ExportListenerReply{Error: err.Error()}, nil
@@ -340,15 +425,60 @@ func (b *Babysitter) ExportListener(req *protos.ExportListenerRequest) (*protos.
 	b.logger.Info("Proxy listening", "address", addr)
 	proxy := proxy.NewProxy(b.logger)
 	proxy.AddBackend(req.Listener.Addr)
-	b.proxies[req.Listener.Name] = &proxyInfo{proxy: proxy, addr: addr}
+	b.serveProxy(req.Listener.Name, lis, proxy)
+	return &protos.ExportListenerReply{ProxyAddress: addr}, nil
+}
+
+// exportPacketListener exports a UDP listener, behind a UDP proxy. Unlike
+// HTTP listeners, packet listeners are not split between a canary and its
+// stable deployment.
+//
+// REQUIRES: b.mu is held.
+func (b *Babysitter) exportPacketListener(req *protos.ExportListenerRequest) (*protos.ExportListenerReply, error) {
+	if p, ok := b.udpProxies[req.Listener.Name]; ok {
+		p.proxy.AddBackend(req.Listener.Addr)
+		return &protos.ExportListenerReply{ProxyAddress: p.addr}, nil
+	}
+	localAddr := req.LocalAddress
+	if b.shadowOf != "" {
+		// A shadow receives no traffic of its own.
+		localAddr = "localhost:0"
+	}
+	conn, err := net.ListenPacket("udp", localAddr)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		// Don't retry if this address is already in use.
+		return &protos.ExportListenerReply{Error: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("proxy listen: %w", err)
+	}
+	addr := conn.LocalAddr().String()
+	b.logger.Info("UDP proxy listening", "address", addr)
+	proxy := proxy.NewUDPProxy(b.logger)
+	proxy.AddBackend(req.Listener.Addr)
+	b.udpProxies[req.Listener.Name] = &udpProxyInfo{proxy: proxy, addr: addr}
 	go func() {
-		if err := serveHTTP(b.ctx, lis, proxy); err != nil {
-			b.logger.Error("proxy", err)
+		if err := proxy.Serve(b.ctx, conn); err != nil && b.ctx.Err() == nil {
+			b.logger.Error("UDP proxy", err)
 		}
 	}()
 	return &protos.ExportListenerReply{ProxyAddress: addr}, nil
 }
 
+// serveProxy serves the proxy for the named listener on the provided
+// listener.
+//
+// REQUIRES: b.mu is held.
+func (b *Babysitter) serveProxy(name string, lis net.Listener, proxy *proxy.Proxy) {
+	ctx, cancel := context.WithCancel(b.ctx)
+	b.proxies[name] = &proxyInfo{proxy: proxy, addr: lis.Addr().String(), stop: cancel}
+	go func() {
+		if err := serveHTTP(ctx, lis, proxy); err != nil && ctx.Err() == nil {
+			b.logger.Error("proxy", err)
+		}
+	}()
+}
+
 // manage runs the Envelope management loop for a given deployment group.
 func (b *Babysitter) manage(dep *protos.Deployment, group *protos.ColocationGroup) error {
 	var version *call.Version
@@ -373,45 +503,230 @@ func (b *Babysitter) startProcess(dep *protos.Deployment, group *protos.Colocati
 	defer b.mu.Unlock()
 
 	envelopes, ok := b.managed[proc]
-	if ok && len(envelopes) == DefaultReplication {
+	if ok && len(envelopes) > 0 {
 		// Already started.
 		return nil
 	}
 
-	for r := 0; r < DefaultReplication; r++ {
-		// Note that we assign a unique UUID for each group replica. This is because
-		// we use the group replica ids to create replica-local addresses to
-		// communicate between the weavelets.
-		id := uuid.NewHash(sha256.New(), uuid.Nil, []byte(fmt.Sprintf("%d", r)), 0).String()
-
-		// Start the weavelet and capture its logs, traces, and metrics.
-		wlet := &protos.WeaveletInfo{
-			App:               dep.App.Name,
-			DeploymentId:      dep.Id,
-			Group:             group,
-			GroupId:           id,
-			Process:           proc,
-			Id:                uuid.New().String(),
-			SameProcess:       dep.App.SameProcess,
-			Sections:          dep.App.Sections,
-			SingleProcess:     dep.SingleProcess,
-			NetworkStorageDir: dep.NetworkStorageDir,
-		}
-		e, err := envelope.NewEnvelope(wlet, dep.App, b, b.opts)
-		if err != nil {
+	b.groups[proc] = group
+	if b.shadowOf != "" {
+		go b.pushShadowRouting(proc)
+	}
+	n := b.replication
+	if policies := b.autoscalePolicies(proc); len(policies) > 0 {
+		// Start as many replicas as the policies ask for if every replica
+		// had the target value of the metric.
+		n = 0
+		for _, policy := range policies {
+			if r := policy.Replicas(float64(b.replication) * policy.Target); r > n {
+				n = r
+			}
+		}
+	}
+	for r := 0; r < n; r++ {
+		if err := b.startReplica(dep, group, proc, r); err != nil {
 			return err
 		}
-		go func() {
-			// TODO(mwhittaker): Propagate errors.
-			if err := e.Run(b.ctx); err != nil {
-				b.logger.Error("e.Run", err)
+	}
+	return nil
+}
+
+// startReplica starts the rth replica of the provided process.
+//
+// REQUIRES: b.mu is held.
+func (b *Babysitter) startReplica(dep *protos.Deployment, group *protos.ColocationGroup, proc string, r int) error {
+	// Note that we assign a unique UUID for each group replica. This is because
+	// we use the group replica ids to create replica-local addresses to
+	// communicate between the weavelets.
+	id := uuid.NewHash(sha256.New(), uuid.Nil, []byte(fmt.Sprintf("%d", r)), 0).String()
+
+	// Start the weavelet and capture its logs, traces, and metrics.
+	wlet := &protos.WeaveletInfo{
+		App:               dep.App.Name,
+		DeploymentId:      dep.Id,
+		Group:             group,
+		GroupId:           id,
+		Process:           proc,
+		Id:                uuid.New().String(),
+		SameProcess:       dep.App.SameProcess,
+		Sections:          dep.App.Sections,
+		SingleProcess:     dep.SingleProcess,
+		NetworkStorageDir: dep.NetworkStorageDir,
+		NetworkFaults:     b.chaos.networkFaults(),
+	}
+	e, err := envelope.NewEnvelope(wlet, dep.App, b, b.opts)
+	if err != nil {
+		return err
+	}
+	go func() {
+		// TODO(mwhittaker): Propagate errors.
+		if err := e.Run(b.ctx); err != nil {
+			b.logger.Error("e.Run", err)
+		}
+	}()
+	b.managed[proc] = append(b.managed[proc], e)
+	return nil
+}
+
+// stopReplica stops the last replica of the provided process and removes it
+// from the process's routing information.
+//
+// REQUIRES: b.mu is held.
+func (b *Babysitter) stopReplica(proc string) error {
+	envelopes := b.managed[proc]
+	e := envelopes[len(envelopes)-1]
+	b.managed[proc] = envelopes[:len(envelopes)-1]
+	pid := int64(e.Pid())
+	if err := e.Stop(); err != nil {
+		return err
+	}
+	return b.unregisterReplica(proc, pid)
+}
+
+// unregisterReplica removes the replica of the provided process with the
+// provided pid from the process's routing information.
+//
+// REQUIRES: b.mu is held.
+func (b *Babysitter) unregisterReplica(proc string, pid int64) error {
+	addr, ok := b.replicaAddrs[pid]
+	if !ok {
+		// The replica never registered.
+		return nil
+	}
+	delete(b.replicaAddrs, pid)
+	existing, _, err := b.appInfo.Read(b.ctx, appVersionStateKey, "")
+	if err != nil {
+		return err
+	}
+	state := findOrCreateProcess(b.dep.App.Name, b.dep.Id, proc, existing)
+	for i, replica := range state.Replicas {
+		if replica == addr {
+			state.Replicas = append(state.Replicas[:i], state.Replicas[i+1:]...)
+			break
+		}
+	}
+	for i, replicaPid := range state.ReplicaPids {
+		if replicaPid == pid {
+			state.ReplicaPids = append(state.ReplicaPids[:i], state.ReplicaPids[i+1:]...)
+			break
+		}
+	}
+	if err := b.mayGenerateNewRoutingInfo(existing, b.dep.App.Name, b.dep.Id, proc); err != nil {
+		return err
+	}
+	b.appInfo.Update(appVersionStateKey, existing)
+	return nil
+}
+
+// autoscale periodically scales the processes that host components with an
+// autoscaling policy, until b.ctx is cancelled.
+func (b *Babysitter) autoscale() {
+	ticker := time.NewTicker(autoscaleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case now := <-ticker.C:
+			for proc, envelopes := range b.getManagedProcesses() {
+				if err := b.autoscaleProcess(proc, envelopes, now); err != nil {
+					b.logger.Error("Error autoscaling process", err, "process", proc)
+				}
 			}
-		}()
-		b.managed[proc] = append(b.managed[proc], e)
+		}
+	}
+}
+
+// autoscaleProcess scales the provided process, whose replicas are managed by
+// the provided envelopes, to the number of replicas its autoscaling policies
+// ask for. A process is scaled up right away, but it is scaled down only once
+// it has wanted fewer replicas for scaleDownDelay.
+func (b *Babysitter) autoscaleProcess(proc string, envelopes []*envelope.Envelope, now time.Time) error {
+	if len(envelopes) == 0 {
+		return nil
+	}
+	policies := b.autoscalePolicies(proc)
+	if len(policies) == 0 {
+		return nil
+	}
+
+	// Sum the scaling metrics over all replicas.
+	totals := map[string]float64{}
+	for _, e := range envelopes {
+		ms, err := e.ReadMetrics()
+		if err != nil {
+			continue
+		}
+		for _, m := range ms {
+			totals[m.Name] += m.Value
+		}
+	}
+	want := 0
+	for _, policy := range policies {
+		if n := policy.Replicas(totals[policy.Metric]); n > want {
+			want = n
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	have := len(b.managed[proc])
+	if want >= have {
+		delete(b.scaleDownSince, proc)
+	}
+	switch {
+	case want > have:
+		b.logger.Info("Scaling up", "process", proc, "from", have, "to", want)
+		for r := have; r < want; r++ {
+			if err := b.startReplica(b.dep, b.groups[proc], proc, r); err != nil {
+				return err
+			}
+		}
+	case want < have:
+		since, ok := b.scaleDownSince[proc]
+		if !ok {
+			b.scaleDownSince[proc] = now
+			return nil
+		}
+		if now.Sub(since) < scaleDownDelay {
+			return nil
+		}
+		delete(b.scaleDownSince, proc)
+		b.logger.Info("Scaling down", "process", proc, "from", have, "to", want)
+		for r := have; r > want; r-- {
+			if err := b.stopReplica(proc); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+// autoscalePolicies returns the autoscaling policies of the components hosted
+// by the provided process.
+func (b *Babysitter) autoscalePolicies(proc string) []*runtime.AutoscalePolicy {
+	state, _, err := b.appInfo.Read(b.ctx, appVersionStateKey, "")
+	if err != nil || state == nil {
+		return nil
+	}
+	ps, ok := state.Processes[proc]
+	if !ok {
+		return nil
+	}
+	var policies []*runtime.AutoscalePolicy
+	for component := range ps.Components {
+		settings, err := runtime.ParseComponentSettings(component, nil, b.dep.App.Sections)
+		if err != nil {
+			// The weavelet hosting the component fails with this error.
+			continue
+		}
+		if settings.Autoscale.Enabled() {
+			policies = append(policies, &settings.Autoscale)
+		}
+	}
+	return policies
+}
+
 func (b *Babysitter) getProcessesToStart(group string, version *call.Version) (
 	[]string, *call.Version, error) {
 	// Fetch processes to start.
@@ -609,6 +924,12 @@ func (b *Babysitter) Status(ctx context.Context) (*status.Status, error) {
 			Addr: proxy.addr,
 		})
 	}
+	for name, proxy := range b.udpProxies {
+		listeners = append(listeners, &status.Listener{
+			Name: name,
+			Addr: proxy.addr,
+		})
+	}
 
 	return &status.Status{
 		App:            info.App,
@@ -681,84 +1002,16 @@ func (b *Babysitter) updateRoutingInfo(process string, routingInfo *protos.Routi
 	return nil
 }
 
-// routingAlgo is an implementation of a routing algorithm that distributes the
-// entire key space approximately equally across all healthy resources.
-//
-// The algorithm is as follows:
-// - split the entire key space in a number of slices that is more likely to
-// spread uniformly the key space among all healthy resources
-//
-// - distribute the slices round robin across all healthy resources
+// routingAlgo computes a new assignment of the key space of a routed
+// component to the provided healthy replicas. See the routing package for
+// details on the algorithm.
 func routingAlgo(currAssignment *protos.Assignment, candidates []string) (*protos.Assignment, error) {
 	newAssignment := protomsg.Clone(currAssignment)
 	newAssignment.Version++
-
-	// Note that the healthy resources should be sorted. This is required because
-	// we want to do a deterministic assignment of slices to resources among
-	// different invocations, to avoid unnecessary churn while generating
-	// new assignments.
-	sort.Strings(candidates)
-
-	if len(candidates) == 0 {
-		newAssignment.Slices = nil
-		return newAssignment, nil
-	}
-
-	const minSliceKey = 0
-	const maxSliceKey = math.MaxUint64
-
-	// If there is only one healthy resource, assign the entire key space to it.
-	if len(candidates) == 1 {
-		newAssignment.Slices = []*protos.Assignment_Slice{
-			{Start: minSliceKey, Replicas: candidates},
-		}
-		return newAssignment, nil
-	}
-
-	// Compute the total number of slices in the assignment.
-	numSlices := nextPowerOfTwo(len(candidates))
-
-	// Split slices in equal subslices in order to generate numSlices.
-	splits := [][]uint64{{minSliceKey, maxSliceKey}}
-	var curr []uint64
-	for ok := true; ok; ok = len(splits) != numSlices {
-		curr, splits = splits[0], splits[1:]
-		midPoint := curr[0] + uint64(math.Floor(0.5*float64(curr[1]-curr[0])))
-		splitl := []uint64{curr[0], midPoint}
-		splitr := []uint64{midPoint, curr[1]}
-		splits = append(splits, splitl, splitr)
-	}
-
-	// Sort the computed slices in increasing order based on the start key, in
-	// order to provide a deterministic assignment across multiple runs, hence to
-	// minimize churn.
-	sort.Slice(splits, func(i, j int) bool {
-		return splits[i][0] <= splits[j][0]
-	})
-
-	// Assign the computed slices to resources in a round robin fashion.
-	slices := make([]*protos.Assignment_Slice, len(splits))
-	rId := 0
-	for i, s := range splits {
-		slices[i] = &protos.Assignment_Slice{
-			Start:    s[0],
-			Replicas: []string{candidates[rId]},
-		}
-		rId = (rId + 1) % len(candidates)
-	}
-	newAssignment.Slices = slices
+	newAssignment.Slices = routing.Assign(candidates)
 	return newAssignment, nil
 }
 
-// nextPowerOfTwo returns the next power of 2 that is greater or equal to x.
-func nextPowerOfTwo(x int) int {
-	// If x is already power of 2, return x.
-	if x&(x-1) == 0 {
-		return x
-	}
-	return int(math.Pow(2, math.Ceil(math.Log2(float64(x)))))
-}
-
 func findOrCreateProcess(app string, id string, process string, ap *AppVersionState) *ProcessState {
 	if ap == nil {
 		ap = &AppVersionState{
@@ -0,0 +1,333 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package babysitter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/proxy"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/ServiceWeaver/weaver/runtime/retry"
+)
+
+// A canary is a deployment of a new version of an application that receives a
+// percentage of the traffic of a stable deployment of the application. The
+// stable deployment's proxies forward the percentage of the traffic of every
+// listener to the canary's listener with the same name. Listeners that the
+// stable deployment doesn't have are proxied by the canary itself.
+//
+// A canary is eventually either promoted or rolled back. When it is
+// promoted, the stable deployment releases the addresses of its proxies to
+// the canary and retires. When it is rolled back, the stable deployment stops
+// forwarding traffic to the canary, and the canary retires.
+//
+// The babysitters of the stable and canary deployments coordinate through the
+// following endpoints, served by their status servers.
+const (
+	canaryBackendEndpoint  = "/debug/serviceweaver/canary/backend"
+	canaryRemoveEndpoint   = "/debug/serviceweaver/canary/remove"
+	canaryReleaseEndpoint  = "/debug/serviceweaver/canary/release"
+	canaryPromoteEndpoint  = "/debug/serviceweaver/canary/promote"
+	canaryRollbackEndpoint = "/debug/serviceweaver/canary/rollback"
+)
+
+// CanaryOptions configures a babysitter that deploys a canary.
+type CanaryOptions struct {
+	// StableAddr is the address of the stable deployment's status server.
+	StableAddr string
+
+	// Traffic is the percentage of the traffic, between 0 and 100, that is
+	// forwarded to the canary.
+	Traffic float64
+
+	// ListenerTraffic maps listener names to the percentage of the
+	// listener's traffic that is forwarded to the canary, overriding Traffic.
+	ListenerTraffic map[string]float64
+}
+
+// canaryBackendRequest asks a stable deployment to forward traffic to a
+// canary's listener.
+type canaryBackendRequest struct {
+	Deployment string  `json:"deployment"` // canary deployment id
+	Listener   string  `json:"listener"`   // listener name
+	Backend    string  `json:"backend"`    // listener address
+	Traffic    float64 `json:"traffic"`    // percentage of the traffic
+}
+
+// canaryBackendReply is the reply to a canaryBackendRequest.
+type canaryBackendReply struct {
+	// ProxyAddress is the address of the stable deployment's proxy for the
+	// listener, or empty if the stable deployment has no such listener.
+	ProxyAddress string `json:"proxy_address"`
+}
+
+// canaryRequest identifies a canary deployment.
+type canaryRequest struct {
+	Deployment string `json:"deployment"` // canary deployment id
+}
+
+// canaryReleaseReply is the reply to a request to release the proxies of a
+// stable deployment.
+type canaryReleaseReply struct {
+	// Addresses maps listener names to the addresses of the released proxies.
+	Addresses map[string]string `json:"addresses"`
+}
+
+// empty is an empty request or reply.
+type empty struct{}
+
+// SetCanary makes the babysitter deploy a canary of a stable deployment. It
+// must be called before any colocation group is started.
+func (b *Babysitter) SetCanary(opts CanaryOptions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.canary = &opts
+	b.canaryBackends = map[string][]string{}
+}
+
+// Retired returns a channel that is closed when the deployment retires, i.e.,
+// when it is replaced by its promoted canary, or when it is a canary that is
+// rolled back.
+func (b *Babysitter) Retired() <-chan struct{} {
+	return b.retired
+}
+
+// retire retires the deployment.
+func (b *Babysitter) retire() {
+	b.retireOnce.Do(func() { close(b.retired) })
+}
+
+// registerCanaryHandlers registers the canary endpoints with the provided mux.
+func (b *Babysitter) registerCanaryHandlers(mux *http.ServeMux) {
+	mux.HandleFunc(canaryBackendEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, r, b.addCanaryBackend)
+	})
+	mux.HandleFunc(canaryRemoveEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, r, b.removeCanary)
+	})
+	mux.HandleFunc(canaryReleaseEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		if serveJSON(w, r, b.releaseProxies) {
+			b.retire()
+		}
+	})
+	mux.HandleFunc(canaryPromoteEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, r, b.promote)
+	})
+	mux.HandleFunc(canaryRollbackEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		if serveJSON(w, r, b.rollback) {
+			b.retire()
+		}
+	})
+}
+
+// PromoteCanary promotes the canary deployment whose babysitter runs a status
+// server on the provided address.
+func PromoteCanary(ctx context.Context, addr string) error {
+	return postJSON(ctx, addr, canaryPromoteEndpoint, &empty{}, &empty{})
+}
+
+// RollbackCanary rolls back the canary deployment whose babysitter runs a
+// status server on the provided address.
+func RollbackCanary(ctx context.Context, addr string) error {
+	return postJSON(ctx, addr, canaryRollbackEndpoint, &empty{}, &empty{})
+}
+
+// exportToStable asks the stable deployment to forward traffic to the
+// provided canary listener. It returns the address of the stable
+// deployment's proxy, or the empty string if the stable deployment doesn't
+// have the listener.
+//
+// REQUIRES: b.mu is held.
+func (b *Babysitter) exportToStable(lis *protos.Listener) (string, error) {
+	traffic := b.canary.Traffic
+	if t, ok := b.canary.ListenerTraffic[lis.Name]; ok {
+		traffic = t
+	}
+	req := &canaryBackendRequest{
+		Deployment: b.dep.Id,
+		Listener:   lis.Name,
+		Backend:    lis.Addr,
+		Traffic:    traffic,
+	}
+	var reply canaryBackendReply
+	if err := postJSON(b.ctx, b.canary.StableAddr, canaryBackendEndpoint, req, &reply); err != nil {
+		return "", fmt.Errorf("export listener %q to stable deployment: %w", lis.Name, err)
+	}
+	if reply.ProxyAddress != "" {
+		b.canaryBackends[lis.Name] = append(b.canaryBackends[lis.Name], lis.Addr)
+	}
+	return reply.ProxyAddress, nil
+}
+
+// addCanaryBackend forwards traffic from the stable deployment's proxy to a
+// canary's listener.
+func (b *Babysitter) addCanaryBackend(req *canaryBackendRequest) (*canaryBackendReply, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if req.Traffic < 0 || req.Traffic > 100 {
+		return nil, fmt.Errorf("invalid traffic %v not between 0 and 100", req.Traffic)
+	}
+	p, ok := b.proxies[req.Listener]
+	if !ok {
+		return &canaryBackendReply{}, nil
+	}
+	if err := p.proxy.AddCanaryBackend(req.Deployment, req.Backend, req.Traffic/100); err != nil {
+		return nil, err
+	}
+	b.logger.Info("Forwarding traffic to canary", "listener", req.Listener, "deployment", req.Deployment, "traffic", req.Traffic)
+	return &canaryBackendReply{ProxyAddress: p.addr}, nil
+}
+
+// removeCanary stops forwarding traffic to a canary.
+func (b *Babysitter) removeCanary(req *canaryRequest) (*empty, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, p := range b.proxies {
+		p.proxy.RemoveCanary(req.Deployment)
+	}
+	b.logger.Info("Stopped forwarding traffic to canary", "deployment", req.Deployment)
+	return &empty{}, nil
+}
+
+// releaseProxies stops the stable deployment's proxies, so that the canary
+// can take over their addresses.
+func (b *Babysitter) releaseProxies(req *canaryRequest) (*canaryReleaseReply, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	reply := &canaryReleaseReply{Addresses: map[string]string{}}
+	for name, p := range b.proxies {
+		p.stop()
+		reply.Addresses[name] = p.addr
+		delete(b.proxies, name)
+	}
+	b.logger.Info("Released proxies to canary", "deployment", req.Deployment)
+	return reply, nil
+}
+
+// promote promotes the canary, taking over the proxies of the stable
+// deployment.
+func (b *Babysitter) promote(*empty) (*empty, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.canary == nil {
+		return nil, fmt.Errorf("deployment %q is not a canary", b.dep.Id)
+	}
+	var reply canaryReleaseReply
+	req := &canaryRequest{Deployment: b.dep.Id}
+	if err := postJSON(b.ctx, b.canary.StableAddr, canaryReleaseEndpoint, req, &reply); err != nil {
+		return nil, fmt.Errorf("release stable proxies: %w", err)
+	}
+	for name, addr := range reply.Addresses {
+		backends := b.canaryBackends[name]
+		if len(backends) == 0 {
+			b.logger.Error("Dropping listener", fmt.Errorf("canary has no listener %q", name))
+			continue
+		}
+		// The stable deployment closes its proxies asynchronously, so we
+		// retry until the address is available.
+		ctx, cancel := context.WithTimeout(b.ctx, 10*time.Second)
+		var lis net.Listener
+		var err error
+		for r := retry.Begin(); r.Continue(ctx); {
+			lis, err = net.Listen("tcp", addr)
+			if err == nil {
+				break
+			}
+		}
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("proxy listen: %w", err)
+		}
+		p := proxy.NewProxy(b.logger)
+		for _, backend := range backends {
+			p.AddBackend(backend)
+		}
+		b.serveProxy(name, lis, p)
+	}
+	b.canary = nil
+	b.canaryBackends = nil
+	b.logger.Info("Promoted canary")
+	return &empty{}, nil
+}
+
+// rollback rolls back the canary.
+func (b *Babysitter) rollback(*empty) (*empty, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.canary == nil {
+		return nil, fmt.Errorf("deployment %q is not a canary", b.dep.Id)
+	}
+	req := &canaryRequest{Deployment: b.dep.Id}
+	if err := postJSON(b.ctx, b.canary.StableAddr, canaryRemoveEndpoint, req, &empty{}); err != nil {
+		return nil, fmt.Errorf("remove canary from stable deployment: %w", err)
+	}
+	b.logger.Info("Rolled back canary")
+	return &empty{}, nil
+}
+
+// serveJSON decodes a JSON request from r, passes it to fn, and writes fn's
+// reply to w as JSON. It returns whether fn succeeded. The reply is flushed
+// before serveJSON returns.
+func serveJSON[Req, Reply any](w http.ResponseWriter, r *http.Request, fn func(*Req) (*Reply, error)) bool {
+	var req Req
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	reply, err := fn(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reply); err != nil {
+		return false
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return true
+}
+
+// postJSON posts the provided request, encoded as JSON, to the provided path
+// on the provided address, and decodes the JSON reply into reply.
+func postJSON(ctx context.Context, addr, path string, req, reply any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+addr+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package babysitter
+
+import (
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/envelope"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// ChaosOptions configures the faults that a babysitter injects into its
+// deployment, to check that the application copes with them before they
+// happen in production.
+type ChaosOptions struct {
+	// KillInterval is the mean time between kills of a random weavelet,
+	// which is then restarted. The main process is never killed. If zero,
+	// no weavelets are killed.
+	KillInterval time.Duration
+
+	// DelayProbability is the probability that a call to a component in
+	// another colocation group is delayed by Delay.
+	DelayProbability float64
+	Delay            time.Duration
+
+	// DropProbability is the probability that a call to a component in
+	// another colocation group is dropped, failing with a network error.
+	DropProbability float64
+}
+
+// SetChaos puts the babysitter in chaos mode, in which it injects the faults
+// configured by the provided options. It must be called before any
+// colocation group is started.
+func (b *Babysitter) SetChaos(opts ChaosOptions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.chaos = &opts
+	// Killed weavelets are restarted.
+	b.opts.Restart = envelope.OnFailure
+	if opts.KillInterval > 0 {
+		go b.killPeriodically(opts.KillInterval)
+	}
+}
+
+// networkFaults returns the faults injected by weavelets into the calls
+// between colocation groups, or nil if there are none.
+func (c *ChaosOptions) networkFaults() *protos.NetworkFaults {
+	if c == nil || (c.DelayProbability == 0 && c.DropProbability == 0) {
+		return nil
+	}
+	return &protos.NetworkFaults{
+		DelayProbability: c.DelayProbability,
+		DelayMicros:      c.Delay.Microseconds(),
+		DropProbability:  c.DropProbability,
+	}
+}
+
+// killPeriodically kills a random weavelet, other than the main one, at
+// random times, every interval on average, until b.ctx is cancelled.
+func (b *Babysitter) killPeriodically(interval time.Duration) {
+	for {
+		t := time.NewTimer(time.Duration(rand.ExpFloat64() * float64(interval)))
+		select {
+		case <-b.ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		b.killRandomWeavelet()
+	}
+}
+
+// killRandomWeavelet kills a random running weavelet, other than the main
+// one, after removing it from the routing information of its process. Its
+// envelope restarts it.
+func (b *Babysitter) killRandomWeavelet() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	type replica struct {
+		proc string
+		pid  int
+	}
+	var replicas []replica
+	for proc, envelopes := range b.managed {
+		if proc == "main" {
+			continue
+		}
+		for _, e := range envelopes {
+			if pid := e.Pid(); pid != 0 {
+				replicas = append(replicas, replica{proc, pid})
+			}
+		}
+	}
+	if len(replicas) == 0 {
+		return
+	}
+	r := replicas[rand.Intn(len(replicas))]
+	if err := b.unregisterReplica(r.proc, int64(r.pid)); err != nil {
+		b.logger.Error("Chaos: unregistering replica", err, "process", r.proc, "pid", r.pid)
+	}
+	p, err := os.FindProcess(r.pid)
+	if err == nil {
+		err = p.Kill()
+	}
+	if err != nil {
+		b.logger.Error("Chaos: killing weavelet", err, "process", r.proc, "pid", r.pid)
+		return
+	}
+	b.logger.Info("Chaos: killed weavelet", "process", r.proc, "pid", r.pid)
+}
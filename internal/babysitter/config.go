@@ -0,0 +1,78 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package babysitter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/envelope"
+)
+
+// configUpdateEndpoint is the endpoint, served by the status server of a
+// babysitter, that updates the config of a running deployment.
+const configUpdateEndpoint = "/debug/serviceweaver/config/update"
+
+// configUpdateRequest asks a babysitter to push updated config sections to
+// the weavelets of its deployment.
+type configUpdateRequest struct {
+	Sections map[string]string `json:"sections"`
+}
+
+// registerConfigHandlers registers the config endpoints with the provided mux.
+func (b *Babysitter) registerConfigHandlers(mux *http.ServeMux) {
+	mux.HandleFunc(configUpdateEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, r, b.updateConfig)
+	})
+}
+
+// UpdateConfig pushes the provided config sections to the deployment whose
+// babysitter runs a status server on the provided address.
+func UpdateConfig(ctx context.Context, addr string, sections map[string]string) error {
+	return postJSON(ctx, addr, configUpdateEndpoint, &configUpdateRequest{Sections: sections}, &empty{})
+}
+
+// updateConfig pushes updated config sections to all weavelets. Replicas
+// started later receive the updated sections as well.
+func (b *Babysitter) updateConfig(req *configUpdateRequest) (*empty, error) {
+	b.mu.Lock()
+	if err := runtime.CheckConfigUpdate(b.dep.App.Sections, req.Sections); err != nil {
+		b.mu.Unlock()
+		return nil, err
+	}
+	b.dep.App.Sections = req.Sections
+	var envelopes []*envelope.Envelope
+	for _, envs := range b.managed {
+		envelopes = append(envelopes, envs...)
+	}
+	b.mu.Unlock()
+
+	// Note that we don't hold b.mu while pushing the config, as weavelets
+	// may call back into the babysitter while applying it.
+	var errs []error
+	for _, e := range envelopes {
+		if err := e.UpdateConfig(req.Sections); err != nil {
+			wlet := e.Weavelet()
+			errs = append(errs, fmt.Errorf("weavelet %s of process %q: %w", wlet.Id, wlet.Process, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("update config: %v", errs)
+	}
+	b.logger.Info("Updated config", "weavelets", len(envelopes))
+	return &empty{}, nil
+}
@@ -16,23 +16,44 @@ package babysitter
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/ServiceWeaver/weaver/runtime/envelope"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
 	"github.com/ServiceWeaver/weaver/runtime/tool"
 )
 
-// runProfiling runs a profiling request on a set of processes.
+// runProfiling runs a profiling request on a set of processes. If the request
+// names a process, every replica of that process is profiled and the profiles
+// are merged. Otherwise, the replicas of every process are profiled.
 func runProfiling(ctx context.Context, req *protos.RunProfiling,
 	processes map[string][]*envelope.Envelope) (*protos.Profile, error) {
+	profile := func(e *envelope.Envelope) func() (*protos.Profile, error) {
+		return func() (*protos.Profile, error) {
+			return e.RunProfiling(ctx, req)
+		}
+	}
+
+	if req.Process != "" {
+		envelopes, ok := processes[req.Process]
+		if !ok || len(envelopes) == 0 {
+			return nil, fmt.Errorf("process %q not found", req.Process)
+		}
+		// Place every replica in a group of its own, so that all of them
+		// get profiled.
+		groups := make([][]func() (*protos.Profile, error), 0, len(envelopes))
+		for _, e := range envelopes {
+			groups = append(groups, []func() (*protos.Profile, error){profile(e)})
+		}
+		return tool.ProfileGroups(groups)
+	}
+
 	// Collect together the groups we want to profile.
 	groups := make([][]func() (*protos.Profile, error), 0, len(processes))
 	for _, envelopes := range processes {
 		group := make([]func() (*protos.Profile, error), 0, len(envelopes))
 		for _, e := range envelopes {
-			group = append(group, func() (*protos.Profile, error) {
-				return e.RunProfiling(ctx, req)
-			})
+			group = append(group, profile(e))
 		}
 		groups = append(groups, group)
 	}
@@ -0,0 +1,163 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package babysitter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/ServiceWeaver/weaver/runtime/retry"
+	"google.golang.org/protobuf/proto"
+)
+
+// A shadow is a deployment of a new version of an application that receives
+// no traffic of its own. Instead, the weavelets of a stable deployment of the
+// application mirror a fraction of the calls to some components to the
+// shadow's replicas of the components, and discard the replies. See
+// runtime.MirrorPolicy.
+//
+// The shadow's babysitter pushes the routing info of its components to the
+// stable deployment's babysitter, which serves it to its weavelets under the
+// runtime.ShadowRoutingKey of every component, through the following
+// endpoints.
+const (
+	shadowRoutingEndpoint = "/debug/serviceweaver/shadow/routing"
+	shadowRemoveEndpoint  = "/debug/serviceweaver/shadow/remove"
+)
+
+// shadowRoutingRequest carries the routing info of a process of a shadow
+// deployment.
+type shadowRoutingRequest struct {
+	Deployment  string   `json:"deployment"`   // shadow deployment id
+	Components  []string `json:"components"`   // components hosted by the process
+	RoutingInfo []byte   `json:"routing_info"` // serialized protos.RoutingInfo
+}
+
+// SetShadow makes the babysitter deploy a shadow of the stable deployment
+// whose status server is at the provided address. It must be called before
+// any colocation group is started.
+func (b *Babysitter) SetShadow(stableAddr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.shadowOf = stableAddr
+}
+
+// registerShadowHandlers registers the shadow endpoints with the provided mux.
+func (b *Babysitter) registerShadowHandlers(mux *http.ServeMux) {
+	mux.HandleFunc(shadowRoutingEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, r, b.setShadowRouting)
+	})
+	mux.HandleFunc(shadowRemoveEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, r, b.removeShadow)
+	})
+}
+
+// pushShadowRouting pushes every version of the routing info of the provided
+// process to the stable deployment, until b.ctx is cancelled.
+func (b *Babysitter) pushShadowRouting(proc string) {
+	var version string
+	for r := retry.Begin(); r.Continue(b.ctx); {
+		info, newVersion, err := b.routingInfo.Read(b.ctx, toKey(proc), version)
+		if err != nil {
+			continue
+		}
+		if info == nil {
+			info = &protos.RoutingInfo{}
+		}
+		routing, err := proto.Marshal(info)
+		if err != nil {
+			b.logger.Error("Error encoding shadow routing info", err, "process", proc)
+			continue
+		}
+		state, _, err := b.appInfo.Read(b.ctx, appVersionStateKey, "")
+		if err != nil {
+			continue
+		}
+		req := &shadowRoutingRequest{Deployment: b.dep.Id, RoutingInfo: routing}
+		if ps, ok := state.Processes[proc]; ok {
+			for component := range ps.Components {
+				req.Components = append(req.Components, component)
+			}
+		}
+		if err := postJSON(b.ctx, b.shadowOf, shadowRoutingEndpoint, req, &empty{}); err != nil {
+			b.logger.Error("Error pushing shadow routing info", err, "process", proc)
+			continue
+		}
+		version = newVersion
+		r.Reset()
+	}
+}
+
+// setShadowRouting serves the routing info of components of a shadow
+// deployment to the weavelets.
+func (b *Babysitter) setShadowRouting(req *shadowRoutingRequest) (*empty, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.shadow != "" && b.shadow != req.Deployment {
+		return nil, fmt.Errorf("deployment already has shadow deployment %q", b.shadow)
+	}
+	info := &protos.RoutingInfo{}
+	if err := proto.Unmarshal(req.RoutingInfo, info); err != nil {
+		return nil, err
+	}
+	if b.shadow == "" {
+		b.logger.Info("Mirroring calls to shadow", "deployment", req.Deployment)
+	}
+	b.shadow = req.Deployment
+	for _, component := range req.Components {
+		b.shadowComponents[component] = true
+		if err := b.updateRoutingInfo(runtime.ShadowRoutingKey(component), info); err != nil {
+			return nil, err
+		}
+	}
+	return &empty{}, nil
+}
+
+// removeShadow stops mirroring calls to a shadow deployment.
+func (b *Babysitter) removeShadow(req *canaryRequest) (*empty, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.shadow != req.Deployment {
+		return &empty{}, nil
+	}
+	for component := range b.shadowComponents {
+		if err := b.updateRoutingInfo(runtime.ShadowRoutingKey(component), &protos.RoutingInfo{}); err != nil {
+			return nil, err
+		}
+	}
+	b.shadow = ""
+	b.shadowComponents = map[string]bool{}
+	b.logger.Info("Stopped mirroring calls to shadow", "deployment", req.Deployment)
+	return &empty{}, nil
+}
+
+// Detach detaches a canary or shadow deployment from its stable deployment,
+// which stops forwarding traffic or mirroring calls to it. It is a no-op for
+// other deployments.
+func (b *Babysitter) Detach(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	req := &canaryRequest{Deployment: b.dep.Id}
+	switch {
+	case b.canary != nil:
+		return postJSON(ctx, b.canary.StableAddr, canaryRemoveEndpoint, req, &empty{})
+	case b.shadowOf != "":
+		return postJSON(ctx, b.shadowOf, shadowRemoveEndpoint, req, &empty{})
+	}
+	return nil
+}
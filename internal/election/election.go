@@ -0,0 +1,85 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package election implements the leases that back weaver.LeaderElection.
+// Deployers keep a Leases for every deployment and use it to serve the leader
+// election requests of weavelets.
+package election
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+type lease struct {
+	holder  string    // candidate holding the lease
+	expires time.Time // when the lease expires
+	token   int64     // fencing token
+}
+
+// Leases tracks the leases of a set of leader elections.
+type Leases struct {
+	mu     sync.Mutex
+	leases map[string]lease // keyed by deployment and election name
+	tokens map[string]int64 // last fencing token, keyed like leases
+}
+
+// NewLeases returns a new, empty set of leases.
+func NewLeases() *Leases {
+	return &Leases{leases: map[string]lease{}, tokens: map[string]int64{}}
+}
+
+// Elect handles the provided leader election request at the provided time.
+// The candidate is granted the lease if no other candidate holds an
+// unexpired lease, and the current lease holder has its lease renewed. A
+// request with a zero lease releases the lease, if the candidate holds it.
+// Every time the lease is granted to a candidate that didn't hold it, the
+// lease gets a new, larger fencing token.
+func (l *Leases) Elect(req *protos.LeaderElectionRequest, now time.Time) *protos.LeaderElectionReply {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := req.DeploymentId + "/" + req.Election
+	cur, ok := l.leases[key]
+	if ok && !now.Before(cur.expires) {
+		// The lease expired.
+		delete(l.leases, key)
+		ok = false
+	}
+	switch {
+	case req.LeaseNanos <= 0:
+		if ok && cur.holder == req.Candidate {
+			delete(l.leases, key)
+			ok = false
+		}
+	case !ok:
+		l.tokens[key]++
+		cur = lease{holder: req.Candidate, token: l.tokens[key]}
+		fallthrough
+	case cur.holder == req.Candidate:
+		cur.expires = now.Add(time.Duration(req.LeaseNanos))
+		l.leases[key] = cur
+		ok = true
+	}
+	if !ok {
+		return &protos.LeaderElectionReply{}
+	}
+	return &protos.LeaderElectionReply{
+		Leader:     cur.holder,
+		LeaseNanos: int64(cur.expires.Sub(now)),
+		Token:      cur.token,
+	}
+}
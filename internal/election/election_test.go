@@ -0,0 +1,70 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package election
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+func TestElect(t *testing.T) {
+	leases := NewLeases()
+	now := time.Now()
+	elect := func(candidate string, lease time.Duration, at time.Duration) *protos.LeaderElectionReply {
+		t.Helper()
+		req := &protos.LeaderElectionRequest{
+			DeploymentId: "dep",
+			Election:     "compaction",
+			Candidate:    candidate,
+			LeaseNanos:   int64(lease),
+		}
+		return leases.Elect(req, now.Add(at))
+	}
+
+	for _, c := range []struct {
+		candidate string
+		lease     time.Duration
+		at        time.Duration
+		want      string
+		token     int64
+	}{
+		{"a", 10 * time.Second, 0, "a", 1},               // a acquires the lease
+		{"b", 10 * time.Second, time.Second, "a", 1},     // b can't acquire a's lease
+		{"a", 10 * time.Second, 5 * time.Second, "a", 1}, // a renews until 15s
+		{"b", 10 * time.Second, 12 * time.Second, "a", 1},
+		{"b", 10 * time.Second, 15 * time.Second, "b", 2}, // a's lease expired
+		{"a", 0, 16 * time.Second, "b", 2},                // a can't release b's lease
+		{"b", 0, 17 * time.Second, "", 0},                 // b releases the lease
+		{"a", 10 * time.Second, 18 * time.Second, "a", 3},
+	} {
+		reply := elect(c.candidate, c.lease, c.at)
+		if reply.Leader != c.want || reply.Token != c.token {
+			t.Fatalf("%s at %v: got leader %q with token %d, want %q with token %d", c.candidate, c.at, reply.Leader, reply.Token, c.want, c.token)
+		}
+	}
+
+	// Elections in different deployments are independent.
+	req := &protos.LeaderElectionRequest{
+		DeploymentId: "other",
+		Election:     "compaction",
+		Candidate:    "b",
+		LeaseNanos:   int64(time.Second),
+	}
+	if got := leases.Elect(req, now.Add(18*time.Second)).Leader; got != "b" {
+		t.Fatalf("other deployment: got leader %q, want b", got)
+	}
+}
@@ -16,6 +16,7 @@ package conn_test
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"strings"
@@ -25,6 +26,8 @@ import (
 	"github.com/ServiceWeaver/weaver/internal/envelope/conn"
 	"github.com/ServiceWeaver/weaver/metrics"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/pprof/profile"
 	"github.com/google/uuid"
 	"go.opentelemetry.io/otel/sdk/trace"
 )
@@ -80,6 +83,49 @@ func TestMetricPropagation(t *testing.T) {
 	checkValue("TestMetricPropagation.hist", 1000)
 }
 
+func TestGoroutineProfile(t *testing.T) {
+	data, err := conn.Profile(&protos.RunProfiling{ProfileType: protos.ProfileType_Goroutine})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof, err := profile.ParseData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prof.Sample) == 0 {
+		t.Fatal("empty goroutine profile")
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	envelope, weavelet := makeConnections(t, &handlerForTest{})
+
+	// Without a registered function, config updates are rejected.
+	if err := envelope.UpdateConfigRPC(map[string]string{"a": "x = 1"}); err == nil {
+		t.Fatal("unexpected success updating config")
+	}
+
+	var got map[string]string
+	weavelet.OnConfigUpdate(func(sections map[string]string) error {
+		if _, ok := sections["bad"]; ok {
+			return fmt.Errorf("bad section")
+		}
+		got = sections
+		return nil
+	})
+	want := map[string]string{"a": "x = 2"}
+	if err := envelope.UpdateConfigRPC(want); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("sections (-want +got):\n%s", diff)
+	}
+	err := envelope.UpdateConfigRPC(map[string]string{"bad": ""})
+	if err == nil || !strings.Contains(err.Error(), "bad section") {
+		t.Fatalf("UpdateConfigRPC: got %v, want bad section error", err)
+	}
+}
+
 func makeConnections(t *testing.T, handler conn.EnvelopeHandler) (*conn.EnvelopeConn, *conn.WeaveletConn) {
 	t.Helper()
 
@@ -164,3 +210,6 @@ func (h *handlerForTest) GetAddress(*protos.GetAddressRequest) (*protos.GetAddre
 func (h *handlerForTest) ExportListener(*protos.ExportListenerRequest) (*protos.ExportListenerReply, error) {
 	return nil, nil
 }
+func (h *handlerForTest) ElectLeader(*protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error) {
+	return nil, nil
+}
@@ -19,6 +19,7 @@ import (
 	"io"
 
 	"github.com/ServiceWeaver/weaver/internal/traceio"
+	"github.com/ServiceWeaver/weaver/runtime"
 	"github.com/ServiceWeaver/weaver/runtime/metrics"
 	"github.com/ServiceWeaver/weaver/runtime/protomsg"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
@@ -46,6 +47,10 @@ type EnvelopeHandler interface {
 	// ExportListener exports the given listener.
 	ExportListener(req *protos.ExportListenerRequest) (*protos.ExportListenerReply, error)
 
+	// ElectLeader acquires, renews, or releases the lease on the leadership
+	// of an election.
+	ElectLeader(req *protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error)
+
 	// GetRoutingInfo returns the latest routing information for the weavelet.
 	//
 	// This is a blocking method that can be processed out-of-order w.r.t.
@@ -78,8 +83,13 @@ type EnvelopeConn struct {
 // weavelet and an envelope. The connection uses (r,w) to carry messages.
 // Synthesized high-level events are passed to h.
 //
-// NewEnvelopeConn sends the provided protos.Weavelet to the weavelet.
+// NewEnvelopeConn sends the provided protos.Weavelet to the weavelet. If the
+// protocol version is unset, it is set to runtime.ProtocolVersion.
 func NewEnvelopeConn(r io.ReadCloser, w io.WriteCloser, h EnvelopeHandler, weavelet *protos.WeaveletInfo) (*EnvelopeConn, error) {
+	if weavelet.ProtocolVersion == 0 {
+		weavelet = protomsg.Clone(weavelet)
+		weavelet.ProtocolVersion = runtime.ProtocolVersion
+	}
 	e := &EnvelopeConn{
 		handler: h,
 		conn:    conn{name: "envelope", reader: r, writer: w},
@@ -137,6 +147,12 @@ func (e *EnvelopeConn) handleMessage(msg *protos.WeaveletMsg) error {
 		}
 		// Reply with listener info.
 		return e.send(&protos.EnvelopeMsg{Id: -msg.Id, ExportListenerReply: reply})
+	case msg.LeaderElectionRequest != nil:
+		reply, err := e.handler.ElectLeader(msg.LeaderElectionRequest)
+		if err != nil {
+			return e.send(errReply(err))
+		}
+		return e.send(&protos.EnvelopeMsg{Id: -msg.Id, LeaderElectionReply: reply})
 	case msg.GetRoutingInfo != nil:
 		// This is a blocking call and therefore we cannot process it inline:
 		// process it in a separate goroutine. Note that this will cause routing
@@ -233,6 +249,13 @@ func (e *EnvelopeConn) DoProfilingRPC(req *protos.RunProfiling) (*protos.Profile
 	return reply.Profile, nil
 }
 
+// UpdateConfigRPC requests the weavelet to apply the provided config
+// sections to its running components.
+func (e *EnvelopeConn) UpdateConfigRPC(sections map[string]string) error {
+	_, err := e.rpc(&protos.EnvelopeMsg{UpdateConfig: &protos.AppConfig{Sections: sections}})
+	return err
+}
+
 func (e *EnvelopeConn) rpc(request *protos.EnvelopeMsg) (*protos.WeaveletMsg, error) {
 	response, err := e.conn.rpc(request)
 	if err != nil {
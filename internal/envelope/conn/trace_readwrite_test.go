@@ -64,6 +64,9 @@ func (p *pipeForTest) GetAddress(*protos.GetAddressRequest) (*protos.GetAddressR
 func (p *pipeForTest) ExportListener(*protos.ExportListenerRequest) (*protos.ExportListenerReply, error) {
 	return nil, nil
 }
+func (p *pipeForTest) ElectLeader(*protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error) {
+	return nil, nil
+}
 
 func writeAndRead(in sdk.ReadOnlySpan, pipe *pipeForTest) (sdk.ReadOnlySpan, error) {
 	pipe.waitToExportSpans.Add(1)
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"runtime/pprof"
+	"sync"
 	"time"
 
 	"github.com/ServiceWeaver/weaver/runtime"
@@ -33,6 +34,9 @@ type WeaveletConn struct {
 	conn    conn
 	wlet    *protos.WeaveletInfo
 	metrics metrics.Exporter
+
+	mu             sync.Mutex                             // guards onConfigUpdate
+	onConfigUpdate func(sections map[string]string) error // see OnConfigUpdate
 }
 
 // NewWeaveletConn creates the weavelet side of the connection between a
@@ -82,6 +86,15 @@ func (d *WeaveletConn) Weavelet() *protos.WeaveletInfo {
 	return d.wlet
 }
 
+// OnConfigUpdate registers a function that is called with the config
+// sections pushed by the envelope. The error returned by f, if any, is sent
+// back to the envelope.
+func (d *WeaveletConn) OnConfigUpdate(f func(sections map[string]string) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onConfigUpdate = f
+}
+
 // handleMessage handles all messages initiated by the envelope. Note that
 // this method doesn't handle RPC reply messages sent over by the envelope.
 func (d *WeaveletConn) handleMessage(msg *protos.EnvelopeMsg) error {
@@ -121,6 +134,25 @@ func (d *WeaveletConn) handleMessage(msg *protos.EnvelopeMsg) error {
 			}})
 		}()
 		return nil
+	case msg.UpdateConfig != nil:
+		d.mu.Lock()
+		f := d.onConfigUpdate
+		d.mu.Unlock()
+		if f == nil {
+			return d.send(&protos.WeaveletMsg{Id: -msg.Id, Error: "weavelet does not support config updates"})
+		}
+		// Config updates may block while components are being constructed,
+		// so we process them in a separate goroutine.
+		id := msg.Id
+		sections := protomsg.Clone(msg.UpdateConfig).Sections
+		go func() {
+			if err := f(sections); err != nil {
+				d.send(&protos.WeaveletMsg{Id: -id, Error: err.Error()})
+				return
+			}
+			d.send(&protos.WeaveletMsg{Id: -id})
+		}()
+		return nil
 	default:
 		err := fmt.Errorf("unexpected message %v", msg)
 		d.conn.cleanup(err)
@@ -200,6 +232,19 @@ func (d *WeaveletConn) ExportListenerRPC(req *protos.ExportListenerRequest) (*pr
 	return reply.ExportListenerReply, nil
 }
 
+// ElectLeaderRPC requests the envelope to acquire, renew, or release the
+// lease on the leadership of an election.
+func (d *WeaveletConn) ElectLeaderRPC(req *protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error) {
+	reply, err := d.rpc(&protos.WeaveletMsg{LeaderElectionRequest: req})
+	if err != nil {
+		return nil, err
+	}
+	if reply.LeaderElectionReply == nil {
+		return nil, fmt.Errorf("nil LeaderElectionReply received from envelope")
+	}
+	return reply.LeaderElectionReply, nil
+}
+
 func (d *WeaveletConn) rpc(request *protos.WeaveletMsg) (*protos.EnvelopeMsg, error) {
 	response, err := d.conn.rpc(request)
 	if err != nil {
@@ -254,6 +299,10 @@ func Profile(req *protos.RunProfiling) ([]byte, error) {
 		}
 		time.Sleep(dur)
 		pprof.StopCPUProfile()
+	case protos.ProfileType_Goroutine:
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 0); err != nil {
+			return nil, err
+		}
 	default:
 		return nil, fmt.Errorf("unspecified profile collection type")
 	}
@@ -0,0 +1,34 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package faults contains the representation of the faults that weavertest
+// injects into component method calls.
+package faults
+
+import "time"
+
+// Fault is a fault injected into calls to the methods of a component. See
+// weavertest.Fault for details.
+type Fault struct {
+	Component   string        // full component name
+	Method      string        // method name, or empty for every method
+	Probability float64       // probability that a call is affected, or 0 for 1
+	Delay       time.Duration // delay added to affected calls
+	Error       error         // if not nil, returned by affected calls
+	Drop        bool          // if true, affected calls are dropped
+}
+
+// Key is the context key under which weavertest passes the faults, as a
+// []Fault, to weaver.Init.
+type Key struct{}
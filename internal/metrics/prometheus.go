@@ -133,13 +133,7 @@ func translateMetrics(w *bytes.Buffer, metrics []*metrics.MetricSnapshot) string
 	}
 
 	for idx, metric := range metrics {
-		// Trim labels.
-		labels := maps.Clone(metric.Labels)
-		delete(labels, "serviceweaver_app")
-		delete(labels, "serviceweaver_version")
-		if node, ok := labels["serviceweaver_node"]; ok {
-			labels["serviceweaver_node"] = logging.Shorten(node)
-		}
+		labels := trimLabels(metric.Labels)
 
 		// Write the metric definitions.
 		//
@@ -189,6 +183,108 @@ func translateMetrics(w *bytes.Buffer, metrics []*metrics.MetricSnapshot) string
 	return w.String()
 }
 
+// trimLabels returns a copy of the provided metric labels, without the labels
+// that are redundant when exporting metrics.
+func trimLabels(labels map[string]string) map[string]string {
+	labels = maps.Clone(labels)
+	delete(labels, "serviceweaver_app")
+	delete(labels, "serviceweaver_version")
+	if node, ok := labels["serviceweaver_node"]; ok {
+		labels["serviceweaver_node"] = logging.Shorten(node)
+	}
+	return labels
+}
+
+// TranslateMetricsToOpenMetricsTextFormat translates Service Weaver metrics to
+// the OpenMetrics text format [1]. Unlike the Prometheus text format, the
+// OpenMetrics format carries the exemplars of histograms, which link histogram
+// buckets to traces. Prometheus requests the OpenMetrics format when it
+// scrapes an endpoint, and stores exemplars if exemplar storage is enabled.
+//
+// [1] https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md
+func TranslateMetricsToOpenMetricsTextFormat(w *bytes.Buffer, ms []*metrics.MetricSnapshot) {
+	// Sort by name, breaking ties by id. The metrics with the same name form
+	// a metric family, which must not be interleaved with other families.
+	sort.SliceStable(ms, func(i, j int) bool {
+		if ms[i].Name != ms[j].Name {
+			return ms[i].Name < ms[j].Name
+		}
+		return ms[i].Id < ms[j].Id
+	})
+	for i := 0; i < len(ms); {
+		j := i + 1
+		for j < len(ms) && ms[j].Name == ms[i].Name {
+			j++
+		}
+		translateOpenMetrics(w, ms[i:j])
+		i = j
+	}
+	w.WriteString("# EOF\n")
+}
+
+// translateOpenMetrics translates a family of metrics with the same name to
+// the OpenMetrics text format.
+func translateOpenMetrics(w *bytes.Buffer, metrics []*metrics.MetricSnapshot) {
+	metric := metrics[0]
+
+	// The samples of a counter named x are named x_total, and the family is
+	// named x, even if the name of the counter already ends in _total.
+	family := metric.Name
+	if metric.Type == protos.MetricType_COUNTER {
+		family = strings.TrimSuffix(family, "_total")
+	}
+	switch metric.Type {
+	case protos.MetricType_COUNTER:
+		w.WriteString("# TYPE " + family + " counter\n")
+	case protos.MetricType_GAUGE:
+		w.WriteString("# TYPE " + family + " gauge\n")
+	case protos.MetricType_HISTOGRAM:
+		w.WriteString("# TYPE " + family + " histogram\n")
+	}
+	if len(metric.Help) > 0 {
+		w.WriteString("# HELP " + family + " ")
+		escaper.WriteString(w, metric.Help)
+		w.WriteByte('\n')
+	}
+
+	for _, metric := range metrics {
+		labels := trimLabels(metric.Labels)
+		switch metric.Type {
+		case protos.MetricType_COUNTER:
+			writeEntry(w, family, metric.Value, "_total", labels, "", 0)
+		case protos.MetricType_GAUGE:
+			writeEntry(w, family, metric.Value, "", labels, "", 0)
+		case protos.MetricType_HISTOGRAM:
+			var count uint64
+			for idx := 0; idx <= len(metric.Bounds); idx++ {
+				count += metric.Counts[idx]
+				bound := math.Inf(+1)
+				if idx < len(metric.Bounds) {
+					bound = metric.Bounds[idx]
+				}
+				writeEntry(w, family, float64(count), "_bucket", labels, "le", bound)
+				if idx < len(metric.Exemplars) && metric.Exemplars[idx] != nil {
+					writeExemplar(w, metric.Exemplars[idx])
+				}
+				if math.IsInf(bound, +1) {
+					break
+				}
+			}
+			writeEntry(w, family, metric.Value, "_sum", labels, "", 0)
+			writeEntry(w, family, float64(count), "_count", labels, "", 0)
+		}
+	}
+}
+
+// writeExemplar appends an exemplar to the sample that was just written to w.
+func writeExemplar(w *bytes.Buffer, e *metrics.Exemplar) {
+	w.Truncate(w.Len() - 1) // remove the sample's trailing newline
+	fmt.Fprintf(w, " # {trace_id=\"%x\",span_id=\"%x\"} %s %s\n",
+		e.TraceID, e.SpanID,
+		strconv.FormatFloat(e.Value, 'f', -1, 64),
+		strconv.FormatFloat(float64(e.Time.UnixMicro())/1e6, 'f', -1, 64))
+}
+
 // writeEntry generates a metric definition entry.
 func writeEntry(w *bytes.Buffer, metricName string, value float64, suffix string,
 	labels map[string]string, extraLabelName string, extraLabelValue float64) {
@@ -18,6 +18,9 @@ import (
 	"bytes"
 	"regexp"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
 
 	imetrics "github.com/ServiceWeaver/weaver/internal/metrics"
 	"github.com/ServiceWeaver/weaver/runtime/metrics"
@@ -147,3 +150,39 @@ func TestTranslateMetricsToPrometheus(t *testing.T) {
 		})
 	}
 }
+
+func TestTranslateMetricsToOpenMetrics(t *testing.T) {
+	input := []*metrics.MetricSnapshot{
+		{Id: 2, Name: "requests_total", Help: "Number of requests", Type: protos.MetricType_COUNTER, Value: 7},
+		{
+			Id:     1,
+			Name:   "latency",
+			Type:   protos.MetricType_HISTOGRAM,
+			Labels: map[string]string{"method": "Get"},
+			Value:  160,
+			Bounds: []float64{10, 100},
+			Counts: []uint64{1, 0, 1},
+			Exemplars: []*metrics.Exemplar{
+				{Value: 5, Time: time.UnixMilli(1500), TraceID: [16]byte{0xab}, SpanID: [8]byte{0xcd}},
+				nil,
+				{Value: 155, Time: time.Unix(2, 0), TraceID: [16]byte{0x12}, SpanID: [8]byte{0x34}},
+			},
+		},
+	}
+	const want = `# TYPE latency histogram
+latency_bucket{method="Get",le="10"} 1 # {trace_id="ab000000000000000000000000000000",span_id="cd00000000000000"} 5 1.5
+latency_bucket{method="Get",le="100"} 1
+latency_bucket{method="Get",le="+Inf"} 2 # {trace_id="12000000000000000000000000000000",span_id="3400000000000000"} 155 2
+latency_sum{method="Get"} 160
+latency_count{method="Get"} 2
+# TYPE requests counter
+# HELP requests Number of requests
+requests_total 7
+# EOF
+`
+	var b bytes.Buffer
+	imetrics.TranslateMetricsToOpenMetricsTextFormat(&b, input)
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("TranslateMetricsToOpenMetricsTextFormat (-want +got):\n%s", diff)
+	}
+}
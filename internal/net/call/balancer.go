@@ -114,3 +114,124 @@ func Sharded() Balancer {
 		return endpoints[opts.ShardKey%uint64(n)], nil
 	})
 }
+
+type leastOutstanding struct {
+	endpoints []Endpoint
+	next      int
+}
+
+var _ Balancer = &leastOutstanding{}
+
+// LeastOutstanding returns a balancer that picks the endpoint with the fewest
+// calls in progress (see CallOptions.Outstanding). Ties are broken round
+// robin.
+func LeastOutstanding() Balancer {
+	return &leastOutstanding{}
+}
+
+func (lo *leastOutstanding) Update(endpoints []Endpoint) {
+	lo.endpoints = endpoints
+}
+
+func (lo *leastOutstanding) Pick(opts CallOptions) (Endpoint, error) {
+	n := len(lo.endpoints)
+	if n == 0 {
+		return nil, fmt.Errorf("%w: no endpoints available", Unreachable)
+	}
+	if lo.next >= n {
+		lo.next = 0
+	}
+	best, bestLoad := lo.next, load(opts, lo.endpoints[lo.next])
+	for i := 1; i < n && bestLoad > 0; i++ {
+		j := (lo.next + i) % n
+		if l := load(opts, lo.endpoints[j]); l < bestLoad {
+			best, bestLoad = j, l
+		}
+	}
+	lo.next = best + 1
+	return lo.endpoints[best], nil
+}
+
+// PowerOfTwoChoices returns a balancer that picks two endpoints at random and
+// picks the one of the two with the fewer calls in progress (see
+// CallOptions.Outstanding).
+func PowerOfTwoChoices() Balancer {
+	return BalancerFunc(func(endpoints []Endpoint, opts CallOptions) (Endpoint, error) {
+		n := len(endpoints)
+		if n == 0 {
+			return nil, fmt.Errorf("%w: no endpoints available", Unreachable)
+		}
+		if n == 1 {
+			return endpoints[0], nil
+		}
+		i := rand.Intn(n)
+		j := rand.Intn(n - 1)
+		if j >= i {
+			j++
+		}
+		if load(opts, endpoints[j]) < load(opts, endpoints[i]) {
+			return endpoints[j], nil
+		}
+		return endpoints[i], nil
+	})
+}
+
+// load returns the number of calls in progress on the provided endpoint, or 0
+// if unknown.
+func load(opts CallOptions, endpoint Endpoint) int {
+	if opts.Outstanding == nil {
+		return 0
+	}
+	return opts.Outstanding(endpoint)
+}
+
+// localityBalancer is the balancer returned by PreferLocality.
+type localityBalancer struct {
+	locality  string
+	endpoints []Endpoint // endpoints passed to the latest call to Update
+	local     Balancer   // balancer for endpoints in locality
+	remote    Balancer   // balancer for the other endpoints
+	numLocal  int        // number of endpoints in locality
+}
+
+var _ Balancer = &localityBalancer{}
+
+// PreferLocality returns a balancer that picks endpoints in the provided
+// locality (see NetEndpoint.Locality) if there are any, and picks the other
+// endpoints otherwise. The endpoints in and out of the locality are picked by
+// two balancers returned by newBalancer. If locality is empty, no endpoint is
+// considered to be in it.
+func PreferLocality(locality string, newBalancer func() Balancer) Balancer {
+	return &localityBalancer{
+		locality: locality,
+		local:    newBalancer(),
+		remote:   newBalancer(),
+	}
+}
+
+func (lb *localityBalancer) Update(endpoints []Endpoint) {
+	if len(endpoints) == len(lb.endpoints) && (len(endpoints) == 0 || &endpoints[0] == &lb.endpoints[0]) {
+		// The endpoints haven't changed. This is the common case, since a
+		// per-call balancer is updated before every call.
+		return
+	}
+	lb.endpoints = endpoints
+	var local, remote []Endpoint
+	for _, endpoint := range endpoints {
+		if ne, ok := endpoint.(NetEndpoint); ok && lb.locality != "" && ne.Locality == lb.locality {
+			local = append(local, endpoint)
+		} else {
+			remote = append(remote, endpoint)
+		}
+	}
+	lb.numLocal = len(local)
+	lb.local.Update(local)
+	lb.remote.Update(remote)
+}
+
+func (lb *localityBalancer) Pick(opts CallOptions) (Endpoint, error) {
+	if lb.numLocal > 0 {
+		return lb.local.Pick(opts)
+	}
+	return lb.remote.Pick(opts)
+}
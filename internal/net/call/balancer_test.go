@@ -0,0 +1,145 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package call_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+)
+
+func TestPreferLocality(t *testing.T) {
+	a1 := call.NetEndpoint{Net: "tcp", Addr: "a1:80", Locality: "a"}
+	a2 := call.NetEndpoint{Net: "tcp", Addr: "a2:80", Locality: "a"}
+	b1 := call.NetEndpoint{Net: "tcp", Addr: "b1:80", Locality: "b"}
+	none := call.NetEndpoint{Net: "tcp", Addr: "none:80"}
+
+	// picks returns the addresses of the endpoints picked by n calls to Pick.
+	picks := func(b call.Balancer, n int) map[string]bool {
+		t.Helper()
+		got := map[string]bool{}
+		for i := 0; i < n; i++ {
+			e, err := b.Pick(call.CallOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[e.Address()] = true
+		}
+		return got
+	}
+
+	for _, test := range []struct {
+		name      string
+		locality  string
+		endpoints []call.Endpoint
+		want      []call.Endpoint
+	}{
+		{"Local", "a", []call.Endpoint{b1, a1, none, a2}, []call.Endpoint{a1, a2}},
+		{"NoLocal", "c", []call.Endpoint{b1, a1, none}, []call.Endpoint{b1, a1, none}},
+		{"NoLocality", "", []call.Endpoint{b1, none}, []call.Endpoint{b1, none}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b := call.PreferLocality(test.locality, func() call.Balancer { return call.RoundRobin() })
+			b.Update(test.endpoints)
+			got := picks(b, 2*len(test.endpoints))
+			if len(got) != len(test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			for _, e := range test.want {
+				if !got[e.Address()] {
+					t.Fatalf("got %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPreferLocalityFallback(t *testing.T) {
+	local := call.NetEndpoint{Net: "tcp", Addr: "local:80", Locality: "a"}
+	remote := call.NetEndpoint{Net: "tcp", Addr: "remote:80", Locality: "b"}
+	b := call.PreferLocality("a", func() call.Balancer { return call.RoundRobin() })
+
+	b.Update([]call.Endpoint{local, remote})
+	if e, err := b.Pick(call.CallOptions{}); err != nil || e.Address() != local.Address() {
+		t.Fatalf("Pick: got %v, %v, want %v", e, err, local)
+	}
+
+	// The local endpoint goes away.
+	b.Update([]call.Endpoint{remote})
+	if e, err := b.Pick(call.CallOptions{}); err != nil || e.Address() != remote.Address() {
+		t.Fatalf("Pick: got %v, %v, want %v", e, err, remote)
+	}
+
+	b.Update(nil)
+	if _, err := b.Pick(call.CallOptions{}); err == nil {
+		t.Fatal("Pick with no endpoints: unexpected success")
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	a := call.TCP("a:80")
+	b := call.TCP("b:80")
+	c := call.TCP("c:80")
+	load := map[string]int{a.Address(): 2, b.Address(): 0, c.Address(): 1}
+	opts := call.CallOptions{
+		Outstanding: func(e call.Endpoint) int { return load[e.Address()] },
+	}
+
+	lb := call.LeastOutstanding()
+	lb.Update([]call.Endpoint{a, b, c})
+	for i := 0; i < 3; i++ {
+		if e, err := lb.Pick(opts); err != nil || e.Address() != b.Address() {
+			t.Fatalf("Pick: got %v, %v, want %v", e, err, b)
+		}
+	}
+
+	// Ties are broken round robin.
+	load[b.Address()] = 1
+	got := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		e, err := lb.Pick(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[e.Address()] = true
+	}
+	if len(got) != 2 || !got[b.Address()] || !got[c.Address()] {
+		t.Fatalf("Pick: got %v, want %v and %v", got, b, c)
+	}
+}
+
+func TestPowerOfTwoChoices(t *testing.T) {
+	a := call.TCP("a:80")
+	b := call.TCP("b:80")
+	load := map[string]int{a.Address(): 5, b.Address(): 1}
+	opts := call.CallOptions{
+		Outstanding: func(e call.Endpoint) int { return load[e.Address()] },
+	}
+
+	// With two endpoints, both are always considered.
+	lb := call.PowerOfTwoChoices()
+	lb.Update([]call.Endpoint{a, b})
+	for i := 0; i < 10; i++ {
+		if e, err := lb.Pick(opts); err != nil || e.Address() != b.Address() {
+			t.Fatalf("Pick: got %v, %v, want %v", e, err, b)
+		}
+	}
+
+	lb.Update(nil)
+	if _, err := lb.Pick(opts); !errors.Is(err, call.Unreachable) {
+		t.Fatalf("Pick: got %v, want %v", err, call.Unreachable)
+	}
+}
@@ -69,6 +69,7 @@ package call
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -139,6 +140,7 @@ type reconnectingConnection struct {
 type clientConnection struct {
 	logger         logtype.Logger
 	endpoint       Endpoint
+	local          bool             // Is c a Unix socket connection?
 	c              net.Conn
 	cbuf           *bufio.Reader    // Buffered reader wrapped around c
 	wlock          sync.Mutex       // Guards writes to c
@@ -147,6 +149,8 @@ type clientConnection struct {
 	ended          bool             // has this clientConnection ended?
 	loggedShutdown bool             // Have we logged a shutdown error?
 	version        version          // Version number to use for connection
+	compressors    uint8            // Compressors supported by the server
+	versioned      chan struct{}    // Closed once the server's version is known
 	calls          map[uint64]*call // In-progress calls
 	lastID         uint64           // Last assigned request ID for a call
 }
@@ -158,8 +162,9 @@ type call struct {
 
 	// Fields below are accessed across goroutines, but their access is
 	// synchronized via doneSignal, i.e., it is never concurrent.
-	err      error
-	response []byte
+	err        error
+	response   []byte
+	compressed bool // is response compressed?
 
 	// Is the call done?
 	// This field is accessed across goroutines using atomics.
@@ -170,13 +175,16 @@ type call struct {
 // serverConnection manages one network connection on the server-side.
 type serverConnection struct {
 	opts        ServerOptions
+	local       bool          // Is c a Unix socket connection?
 	c           net.Conn
 	cbuf        *bufio.Reader // Buffered reader wrapped around c
 	wlock       sync.Mutex    // Guards writes to c
 	mu          sync.Mutex
 	closed      bool              // has c been closed?
 	version     version           // Version number to use for connection
+	compressors uint8             // Compressors supported by the client
 	cancelFuncs map[uint64]func() // Cancellation functions for in-progress calls
+	peer        *Peer             // Authenticated client, if any
 }
 
 // serverState tracks all live server-side connections so we can clean things up when canceled.
@@ -188,17 +196,28 @@ type serverState struct {
 
 // Serve starts listening for connections and requests on l. Handlers to handle
 // incoming requests are found in hmap.
+//
+// If l is a Unix socket listener, connections are neither encrypted nor
+// compressed, since they never leave the machine.
 func Serve(ctx context.Context, l net.Listener, hmap *HandlerMap, opts ServerOptions) error {
 	opts = opts.withDefaults()
 	ss := &serverState{opts: opts}
 	defer ss.stop()
 
+	_, local := l.(*net.UnixListener)
+	switch {
+	case local:
+	case opts.Transport != nil:
+		l = opts.Transport.Listen(l, opts.TLSConfig)
+	case opts.TLSConfig != nil:
+		l = tls.NewListener(l, opts.TLSConfig)
+	}
 	for ctx.Err() == nil {
 		conn, err := l.Accept()
 		if err != nil {
 			return fmt.Errorf("call server error listening on %s: %w", l.Addr(), err)
 		}
-		ss.serveConnection(ctx, conn, hmap)
+		ss.serveConnection(ctx, conn, hmap, local)
 	}
 	return ctx.Err()
 }
@@ -208,12 +227,13 @@ func Serve(ctx context.Context, l net.Listener, hmap *HandlerMap, opts ServerOpt
 // when using custom networking transports.
 func ServeOn(ctx context.Context, conn net.Conn, hmap *HandlerMap, opts ServerOptions) {
 	ss := &serverState{opts: opts.withDefaults()}
-	ss.serveConnection(ctx, conn, hmap)
+	ss.serveConnection(ctx, conn, hmap, false)
 }
 
-func (ss *serverState) serveConnection(ctx context.Context, conn net.Conn, hmap *HandlerMap) {
+func (ss *serverState) serveConnection(ctx context.Context, conn net.Conn, hmap *HandlerMap, local bool) {
 	c := &serverConnection{
 		opts:        ss.opts,
+		local:       local,
 		c:           conn,
 		cbuf:        bufio.NewReader(conn),
 		version:     initialVersion, // Updated when we hear from client
@@ -221,7 +241,39 @@ func (ss *serverState) serveConnection(ctx context.Context, conn net.Conn, hmap
 	}
 	ss.register(c)
 
-	go c.readRequests(ctx, hmap, func() { ss.unregister(c) })
+	go func() {
+		onDone := func() { ss.unregister(c) }
+		if err := c.authenticate(ctx); err != nil {
+			c.shutdown("server handshake", err)
+			onDone()
+			return
+		}
+		c.readRequests(ctx, hmap, onDone)
+	}()
+}
+
+// authenticate records the client of c, completing the TLS handshake of c if
+// it is a TLS connection.
+func (c *serverConnection) authenticate(ctx context.Context) error {
+	if c.local {
+		c.peer = &Peer{Local: true}
+		return nil
+	}
+	// A connection carried by a Transport exposes the state of the TLS
+	// connection that carries it, if any.
+	tc, ok := c.c.(interface{ ConnectionState() tls.ConnectionState })
+	if !ok {
+		return nil
+	}
+	if tc, ok := c.c.(*tls.Conn); ok {
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return err
+		}
+	}
+	if certs := tc.ConnectionState().PeerCertificates; len(certs) > 0 {
+		c.peer = &Peer{Certificate: certs[0]}
+	}
+	return nil
 }
 
 func (ss *serverState) stop() {
@@ -323,7 +375,7 @@ func (rc *reconnectingConnection) Close() {
 
 // Call makes an RPC over connection c.
 func (rc *reconnectingConnection) Call(ctx context.Context, h MethodKey, arg []byte, opts CallOptions) ([]byte, error) {
-	var hdr [msgHeaderSize]byte
+	var hdr [msgHeaderSize + metadataLen]byte
 	copy(hdr[0:], h[:])
 	deadline, haveDeadline := ctx.Deadline()
 	if haveDeadline {
@@ -358,7 +410,31 @@ func (rc *reconnectingConnection) Call(ctx context.Context, h MethodKey, arg []b
 		return nil, err
 	}
 
-	if err := writeMessage(conn.c, &conn.wlock, requestMessage, rpc.id, hdr[:], arg, rc.opts.WriteFlattenLimit); err != nil {
+	mt := requestMessage
+	hdrLen := msgHeaderSize
+	if opts.ShardKey != 0 || opts.Caller != 0 {
+		// Wait for the server's version, which tells whether the server
+		// supports call metadata.
+		select {
+		case <-conn.versioned:
+		case <-rpc.doneSignal:
+			// The connection failed.
+			return rpc.result()
+		case <-ctx.Done():
+			conn.endCall(rpc)
+			return nil, ctx.Err()
+		}
+	}
+	if (opts.ShardKey != 0 || opts.Caller != 0) && conn.supportsMetadata() {
+		mt |= metadataFlag
+		encodeMetadata(opts, hdr[msgHeaderSize:])
+		hdrLen += metadataLen
+	}
+	if conn.shouldCompress(rc.opts, len(arg)) {
+		mt |= compressedFlag
+		arg = compress(rc.opts.Compression, arg)
+	}
+	if err := writeMessage(conn.c, &conn.wlock, mt, rpc.id, hdr[:hdrLen], arg, rc.opts.WriteFlattenLimit); err != nil {
 		conn.shutdown("client send request", err)
 		conn.endCall(rpc)
 		return nil, fmt.Errorf("%w: %s", CommunicationError, err)
@@ -368,7 +444,7 @@ func (rc *reconnectingConnection) Call(ctx context.Context, h MethodKey, arg []b
 		// Optimistically spin, waiting for the results.
 		for start := time.Now(); time.Since(start) < rc.opts.OptimisticSpinDuration; {
 			if atomic.LoadUint32(&rpc.done) > 0 {
-				return rpc.response, rpc.err
+				return rpc.result()
 			}
 		}
 	}
@@ -393,7 +469,21 @@ func (rc *reconnectingConnection) Call(ctx context.Context, h MethodKey, arg []b
 	} else {
 		<-rpc.doneSignal
 	}
-	return rpc.response, rpc.err
+	return rpc.result()
+}
+
+// result returns the result of a done call.
+func (rpc *call) result() ([]byte, error) {
+	if rpc.err != nil || !rpc.compressed {
+		return rpc.response, rpc.err
+	}
+	// Decompress the response here rather than in readResponses, so that
+	// large responses don't hold up the responses of other calls.
+	response, err := decompress(rpc.response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decompress response: %s", CommunicationError, err)
+	}
+	return response, nil
 }
 
 // watchResolver watches for updates to the set of endpoints. When a new set of
@@ -511,6 +601,7 @@ func (rc *reconnectingConnection) startCall(ctx context.Context, rpc *call, opts
 		balancer = opts.Balancer
 		balancer.Update(rc.endpoints)
 	}
+	opts.Outstanding = rc.outstanding
 
 	// TODO(mwhittaker): Think about the other places where we can perform
 	// automatic retries. We need to be careful about non-idempotent
@@ -541,22 +632,61 @@ func (rc *reconnectingConnection) startCall(ctx context.Context, rpc *call, opts
 	return nil, connectErr
 }
 
+// outstanding returns the number of calls in progress on the provided
+// endpoint.
+// REQUIRES: rc.mu is held.
+func (rc *reconnectingConnection) outstanding(endpoint Endpoint) int {
+	c, ok := rc.connections[endpoint.Address()]
+	if !ok || c.ended {
+		return 0
+	}
+	return len(c.calls)
+}
+
 // reconnect establishes (or re-establishes) the network connection to the server.
 // REQUIRES: rc.mu is held.
 func (rc *reconnectingConnection) reconnect(ctx context.Context, endpoint Endpoint) (*clientConnection, error) {
+	if t := rc.opts.Transport; t != nil && !isUnix(endpoint) {
+		nc, err := t.Dial(ctx, endpoint, rc.opts.TLSConfig)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", CommunicationError, err)
+		}
+		return rc.connected(endpoint, nc, false)
+	}
+
 	nc, err := endpoint.Dial(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", CommunicationError, err)
 	}
+	// Connections over Unix sockets never leave the machine, so they are
+	// neither encrypted nor compressed.
+	_, local := nc.(*net.UnixConn)
+	if rc.opts.TLSConfig != nil && !local {
+		tc := tls.Client(nc, rc.opts.TLSConfig)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("%w: tls handshake: %s", CommunicationError, err)
+		}
+		nc = tc
+	}
+	return rc.connected(endpoint, nc, local)
+}
+
+// connected returns a client connection over the established network
+// connection nc to endpoint.
+// REQUIRES: rc.mu is held.
+func (rc *reconnectingConnection) connected(endpoint Endpoint, nc net.Conn, local bool) (*clientConnection, error) {
 	conn := &clientConnection{
-		logger:   rc.opts.Logger,
-		endpoint: endpoint,
-		c:        nc,
-		cbuf:     bufio.NewReader(nc),
-		mu:       &rc.mu,
-		version:  initialVersion, // Updated when we hear from server
-		calls:    map[uint64]*call{},
-		lastID:   0,
+		logger:    rc.opts.Logger,
+		endpoint:  endpoint,
+		local:     local,
+		c:         nc,
+		cbuf:      bufio.NewReader(nc),
+		mu:        &rc.mu,
+		version:   initialVersion, // Updated when we hear from server
+		versioned: make(chan struct{}),
+		calls:     map[uint64]*call{},
+		lastID:    0,
 	}
 	if err := writeVersion(conn.c, &conn.wlock); err != nil {
 		return nil, fmt.Errorf("%w: client send version: %s", CommunicationError, err)
@@ -565,6 +695,24 @@ func (rc *reconnectingConnection) reconnect(ctx context.Context, endpoint Endpoi
 	return conn, nil
 }
 
+// shouldCompress returns whether a call argument of the provided size should
+// be compressed.
+func (c *clientConnection) shouldCompress(opts ClientOptions, size int) bool {
+	if opts.Compression == NoCompression || c.local {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return shouldCompress(opts.Compression, opts.CompressionThreshold, c.compressors, size)
+}
+
+// supportsMetadata returns whether the server supports call metadata.
+func (c *clientConnection) supportsMetadata() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version >= metadataVersion
+}
+
 func (c *clientConnection) endCall(rpc *call) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -637,15 +785,21 @@ func (c *clientConnection) readResponses() {
 
 		switch mt {
 		case versionMessage:
-			v, err := getVersion(id, msg)
+			v, compressors, err := getVersion(id, msg)
 			if err != nil {
 				c.shutdown("client read", err)
 				return
 			}
 			c.mu.Lock()
 			c.version = v
+			c.compressors = compressors
+			select {
+			case <-c.versioned:
+			default:
+				close(c.versioned)
+			}
 			c.mu.Unlock()
-		case responseMessage, responseError:
+		case responseMessage, responseError, responseMessage | compressedFlag:
 			rpc := c.findAndEndCall(id)
 			if rpc == nil {
 				continue // May have been canceled
@@ -658,6 +812,7 @@ func (c *clientConnection) readResponses() {
 				}
 			} else {
 				rpc.response = msg
+				rpc.compressed = mt&compressedFlag != 0
 			}
 			atomic.StoreUint32(&rpc.done, 1)
 			close(rpc.doneSignal)
@@ -680,7 +835,7 @@ func (c *serverConnection) readRequests(ctx context.Context, hmap *HandlerMap, o
 
 		switch mt {
 		case versionMessage:
-			v, err := getVersion(id, msg)
+			v, compressors, err := getVersion(id, msg)
 			if err != nil {
 				c.shutdown("server read version", err)
 				onDone()
@@ -688,6 +843,7 @@ func (c *serverConnection) readRequests(ctx context.Context, hmap *HandlerMap, o
 			}
 			c.mu.Lock()
 			c.version = v
+			c.compressors = compressors
 			c.mu.Unlock()
 
 			// Respond with my version.
@@ -696,21 +852,22 @@ func (c *serverConnection) readRequests(ctx context.Context, hmap *HandlerMap, o
 				onDone()
 				return
 			}
-		case requestMessage:
+		case requestMessage, requestMessage | compressedFlag, requestMessage | metadataFlag, requestMessage | compressedFlag | metadataFlag:
+			flags := mt & (compressedFlag | metadataFlag)
 			if c.opts.InlineHandlerDuration > 0 {
 				// Run the handler inline. If it doesn't return in the specified
 				// time period, launch another goroutine to read incoming requests.
 				t := time.AfterFunc(c.opts.InlineHandlerDuration, func() {
 					c.readRequests(ctx, hmap, onDone)
 				})
-				c.runHandler(hmap, id, msg)
+				c.runHandler(hmap, id, msg, flags)
 				if !t.Stop() {
 					// Another goroutine is reading incoming requests: bail out.
 					return
 				}
 			} else {
 				// Run the handler in a separate goroutine.
-				go c.runHandler(hmap, id, msg)
+				go c.runHandler(hmap, id, msg, flags)
 			}
 		case cancelMessage:
 			c.endRequest(id)
@@ -726,9 +883,15 @@ func (c *serverConnection) readRequests(ctx context.Context, hmap *HandlerMap, o
 
 // runHandler runs an application specified RPC handler at the server side.
 // The result (or error) from the handler is sent back to the client over c.
-func (c *serverConnection) runHandler(hmap *HandlerMap, id uint64, msg []byte) {
+// The flags of the request message type tell whether the header of msg is
+// followed by call metadata, and whether the call argument is compressed.
+func (c *serverConnection) runHandler(hmap *HandlerMap, id uint64, msg []byte, flags messageType) {
 	// Extract request header from front of payload.
-	if len(msg) < msgHeaderSize {
+	hdrLen := msgHeaderSize
+	if flags&metadataFlag != 0 {
+		hdrLen += metadataLen
+	}
+	if len(msg) < hdrLen {
 		c.shutdown("server handler", fmt.Errorf("missing request header"))
 		return
 	}
@@ -769,13 +932,33 @@ func (c *serverConnection) runHandler(hmap *HandlerMap, id uint64, msg []byte) {
 		}
 	}()
 
+	// Add the call metadata and the client, if any, to the context.
+	if flags&metadataFlag != 0 || c.peer != nil {
+		var m metadata
+		if flags&metadataFlag != 0 {
+			m = decodeMetadata(msg[msgHeaderSize:])
+		}
+		m.peer = c.peer
+		ctx = context.WithValue(ctx, metadataKey{}, m)
+	}
+
 	// Call the handler passing it the payload.
-	payload := msg[msgHeaderSize:]
+	payload := msg[hdrLen:]
 	var err error
 	var result []byte
+	if flags&compressedFlag != 0 {
+		if payload, err = decompress(payload); err != nil {
+			err = fmt.Errorf("%w: decompress argument: %s", CommunicationError, err)
+		}
+	}
 	fn, ok := hmap.handlers[hkey]
-	if !ok {
+	if err != nil {
+		// The argument could not be decompressed.
+	} else if !ok {
 		err = fmt.Errorf("unknown function")
+	} else if err = ctx.Err(); err != nil {
+		// The deadline passed before the handler could start, e.g., because
+		// the server is overloaded. Don't waste any more work on the call.
 	} else {
 		if err := c.startRequest(id, cancelFunc); err != nil {
 			logError(c.opts.Logger, "handle "+hmap.names[hkey], err)
@@ -786,12 +969,24 @@ func (c *serverConnection) runHandler(hmap *HandlerMap, id uint64, msg []byte) {
 		result, err = fn(ctx, payload)
 	}
 
+	if ctx.Err() != nil {
+		// The call was canceled, or its deadline passed. Either way, the
+		// client has given up on it: the server's deadline is never earlier
+		// than the client's, since it is computed from the remaining time
+		// when the request is received. Don't waste bandwidth on a reply.
+		span.SetStatus(codes.Error, ctx.Err().Error())
+		return
+	}
+
 	mt := responseMessage
 	if err != nil {
 		mt = responseError
 		result = encodeError(err)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
+	} else if c.shouldCompress(len(result)) {
+		mt |= compressedFlag
+		result = compress(c.opts.Compression, result)
 	}
 
 	if err := writeMessage(c.c, &c.wlock, mt, id, nil, result, c.opts.WriteFlattenLimit); err != nil {
@@ -799,6 +994,17 @@ func (c *serverConnection) runHandler(hmap *HandlerMap, id uint64, msg []byte) {
 	}
 }
 
+// shouldCompress returns whether a call result of the provided size should be
+// compressed.
+func (c *serverConnection) shouldCompress(size int) bool {
+	if c.opts.Compression == NoCompression || c.local {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return shouldCompress(c.opts.Compression, c.opts.CompressionThreshold, c.compressors, size)
+}
+
 func (c *serverConnection) startRequest(id uint64, cancelFunc func()) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
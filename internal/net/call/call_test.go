@@ -16,12 +16,20 @@ package call_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/big"
 	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -78,8 +86,17 @@ func startServers(ctx context.Context, opts call.ServerOptions) map[string]call.
 	// TODO(mwhittaker): Use test logger.
 	go call.Serve(ctx, tcpListener, handlers, opts)
 
+	// Start the server that uses the TCP protocol through the gRPC transport.
+	grpcListener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		panic(err)
+	}
+	opts.Transport = call.GRPC()
+	go call.Serve(ctx, grpcListener, handlers, opts)
+
 	return map[string]call.Endpoint{
-		"tcp": call.TCP(tcpListener.Addr().String()),
+		"tcp":  call.TCP(tcpListener.Addr().String()),
+		"grpc": call.TCP(grpcListener.Addr().String()),
 	}
 }
 
@@ -184,6 +201,9 @@ func getClientConn(t testing.TB, protocol string, endpoint call.Endpoint, maker
 	ctx := context.Background()
 
 	opts := call.ClientOptions{Logger: logging.NewTestLogger(t)}
+	if protocol == "grpc" {
+		opts.Transport = call.GRPC()
+	}
 	client, err := call.Connect(ctx, maker(endpoint), opts)
 	if err != nil {
 		t.Fatalf("connect: %v", err)
@@ -475,7 +495,7 @@ func TestSingleTCPServer(t *testing.T) {
 		{"TestClose", testClose},
 	}
 
-	protocols := []string{"tcp"}
+	protocols := []string{"tcp", "grpc"}
 	ctx := context.Background()
 	opts := call.ServerOptions{Logger: logging.NewTestLogger(t)}
 	endpoints := startServers(ctx, opts)
@@ -523,6 +543,313 @@ func TestTracePropagation(t *testing.T) {
 	}
 }
 
+// TestCompression tests that large call arguments and results are compressed
+// and decompressed transparently.
+func TestCompression(t *testing.T) {
+	for _, compressor := range []call.Compressor{call.NoCompression, call.Snappy, call.Zstd} {
+		for _, protocol := range []string{"tcp", "grpc"} {
+			t.Run(fmt.Sprintf("%s/%s", compressor, protocol), func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				sopts := call.ServerOptions{
+					Logger:               logging.NewTestLogger(t),
+					Compression:          compressor,
+					CompressionThreshold: 1 << 10,
+				}
+				endpoint := startServers(ctx, sopts)[protocol]
+				copts := call.ClientOptions{
+					Logger:               logging.NewTestLogger(t),
+					Compression:          compressor,
+					CompressionThreshold: 1 << 10,
+				}
+				if protocol == "grpc" {
+					copts.Transport = call.GRPC()
+				}
+				client, err := call.Connect(ctx, call.NewConstantResolver(endpoint), copts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer client.Close()
+
+				for _, size := range []int{0, 1 << 10, 1 << 20} {
+					arg := []byte(strings.Repeat("a", size))
+					result, err := client.Call(ctx, echoKey, arg, call.CallOptions{})
+					if err != nil {
+						t.Fatalf("Call(%d bytes): %v", size, err)
+					}
+					if string(result) != string(arg) {
+						t.Fatalf("Call(%d bytes): got %d bytes, want %d", size, len(result), size)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestSocketEndpoint tests that a NetEndpoint with a Socket prefers the Unix
+// socket and falls back to its address if the socket cannot be dialed.
+func TestSocketEndpoint(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := call.ServerOptions{Logger: logging.NewTestLogger(t)}
+
+	tcpListener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go call.Serve(ctx, tcpListener, handlersFor("tcp"), opts)
+
+	socket := filepath.Join(t.TempDir(), "unix.sock")
+	unixListener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go call.Serve(ctx, unixListener, handlersFor("unix"), opts)
+
+	for _, test := range []struct {
+		socket string
+		want   string
+	}{
+		{socket, "unix"},
+		{filepath.Join(t.TempDir(), "missing.sock"), "tcp"},
+	} {
+		t.Run(test.want, func(t *testing.T) {
+			endpoint := call.TCP(tcpListener.Addr().String())
+			endpoint.Socket = test.socket
+			if got, want := endpoint.Address(), call.TCP(tcpListener.Addr().String()).Address(); got != want {
+				t.Fatalf("Address: got %q, want %q", got, want)
+			}
+			copts := call.ClientOptions{Logger: logging.NewTestLogger(t)}
+			client, err := call.Connect(ctx, call.NewConstantResolver(endpoint), copts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			result, err := client.Call(ctx, whoKey, []byte{}, call.CallOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(result); got != test.want {
+				t.Fatalf("bad result: got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestCallMetadata tests that the shard key and caller in the CallOptions are
+// passed to the handler.
+func TestCallMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hmap := makeHandlerMap()
+	metadataKey := call.MakeMethodKey("", "metadata")
+	hmap.Set("", "metadata", func(ctx context.Context, _ []byte) ([]byte, error) {
+		return []byte(fmt.Sprintf("%d/%d", call.ShardKey(ctx), call.Caller(ctx))), nil
+	})
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go call.Serve(ctx, lis, hmap, call.ServerOptions{Logger: logging.NewTestLogger(t)})
+
+	client, err := call.Connect(ctx, call.NewConstantResolver(call.TCP(lis.Addr().String())), call.ClientOptions{Logger: logging.NewTestLogger(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Metadata is only sent once the client knows the version of the server,
+	// which the server sends in reply to the first call.
+	if _, err := client.Call(ctx, echoKey, nil, call.CallOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		opts call.CallOptions
+		want string
+	}{
+		{call.CallOptions{}, "0/0"},
+		{call.CallOptions{ShardKey: 42}, "42/0"},
+		{call.CallOptions{Caller: 7}, "0/7"},
+		{call.CallOptions{ShardKey: 42, Caller: 7}, "42/7"},
+	} {
+		result, err := client.Call(ctx, metadataKey, []byte("arg"), test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(result); got != test.want {
+			t.Errorf("Call(%+v): got %q, want %q", test.opts, got, test.want)
+		}
+	}
+}
+
+// TestCallMetadataFirstCall tests that the shard key and caller of the first
+// call on a new connection are passed to the handler, since the call waits for
+// the version of the server.
+func TestCallMetadataFirstCall(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hmap := makeHandlerMap()
+	metadataKey := call.MakeMethodKey("", "metadata")
+	hmap.Set("", "metadata", func(ctx context.Context, _ []byte) ([]byte, error) {
+		return []byte(fmt.Sprintf("%d/%d", call.ShardKey(ctx), call.Caller(ctx))), nil
+	})
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go call.Serve(ctx, lis, hmap, call.ServerOptions{Logger: logging.NewTestLogger(t)})
+
+	for i := 0; i < 10; i++ {
+		client, err := call.Connect(ctx, call.NewConstantResolver(call.TCP(lis.Addr().String())), call.ClientOptions{Logger: logging.NewTestLogger(t)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := call.CallOptions{ShardKey: 42, Caller: 7}
+		result, err := client.Call(ctx, metadataKey, []byte("arg"), opts)
+		client.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(result), "42/7"; got != want {
+			t.Fatalf("Call(%+v): got %q, want %q", opts, got, want)
+		}
+	}
+}
+
+// TestCallPeer tests that the handler learns whether the client connected
+// over a Unix socket.
+func TestCallPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hmap := makeHandlerMap()
+	peerKey := call.MakeMethodKey("", "peer")
+	hmap.Set("", "peer", func(ctx context.Context, _ []byte) ([]byte, error) {
+		peer := call.PeerOf(ctx)
+		return []byte(fmt.Sprint(peer != nil && peer.Local)), nil
+	})
+
+	socket := filepath.Join(t.TempDir(), "socket")
+	unixLis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcpLis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := call.ServerOptions{Logger: logging.NewTestLogger(t)}
+	go call.Serve(ctx, unixLis, hmap, opts)
+	go call.Serve(ctx, tcpLis, hmap, opts)
+
+	for _, test := range []struct {
+		endpoint call.Endpoint
+		want     string
+	}{
+		{call.Unix(socket), "true"},
+		{call.TCP(tcpLis.Addr().String()), "false"},
+	} {
+		client, err := call.Connect(ctx, call.NewConstantResolver(test.endpoint), call.ClientOptions{Logger: logging.NewTestLogger(t)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := client.Call(ctx, peerKey, nil, call.CallOptions{})
+		client.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(result); got != test.want {
+			t.Errorf("%v: local: got %s, want %s", test.endpoint, got, test.want)
+		}
+	}
+}
+
+// TestGRPCTransportTLS tests that the gRPC transport secures its streams with
+// TLS and exposes the client's certificate to handlers.
+func TestGRPCTransportTLS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hmap := makeHandlerMap()
+	peerKey := call.MakeMethodKey("", "peer")
+	hmap.Set("", "peer", func(ctx context.Context, _ []byte) ([]byte, error) {
+		peer := call.PeerOf(ctx)
+		if peer == nil || peer.Certificate == nil {
+			return nil, fmt.Errorf("no peer certificate")
+		}
+		return []byte(peer.Certificate.Subject.CommonName), nil
+	})
+
+	cert := newTestCertificate(t, "client")
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sopts := call.ServerOptions{
+		Logger:    logging.NewTestLogger(t),
+		Transport: call.GRPC(),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{newTestCertificate(t, "server")},
+			ClientAuth:   tls.RequireAnyClientCert,
+		},
+	}
+	go call.Serve(ctx, lis, hmap, sopts)
+
+	copts := call.ClientOptions{
+		Logger:    logging.NewTestLogger(t),
+		Transport: call.GRPC(),
+		TLSConfig: &tls.Config{
+			Certificates:       []tls.Certificate{cert},
+			InsecureSkipVerify: true,
+		},
+	}
+	client, err := call.Connect(ctx, call.NewConstantResolver(call.TCP(lis.Addr().String())), copts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	result, err := client.Call(ctx, peerKey, nil, call.CallOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(result), "client"; got != want {
+		t.Errorf("peer: got %q, want %q", got, want)
+	}
+
+	// A client that doesn't speak TLS can't connect.
+	copts.TLSConfig = nil
+	plain, err := call.Connect(ctx, call.NewConstantResolver(call.TCP(lis.Addr().String())), copts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	callCtx, callCancel := context.WithTimeout(ctx, shortDelay*10)
+	defer callCancel()
+	if _, err := plain.Call(callCtx, echoKey, nil, call.CallOptions{}); err == nil {
+		t.Error("call without TLS: unexpected success")
+	}
+}
+
+// newTestCertificate returns a self-signed certificate with the provided
+// common name.
+func newTestCertificate(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(crand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
 // TestMultipleEndpoints tests that RPC calls succeed when the resolver returns
 // a constant set of multiple endpoints.
 func TestMultipleEndpoints(t *testing.T) {
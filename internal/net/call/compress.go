@@ -0,0 +1,130 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package call
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor identifies the algorithm used to compress call arguments and
+// results.
+type Compressor uint8
+
+const (
+	NoCompression Compressor = iota
+	Snappy
+	Zstd
+)
+
+// compressors is the set of compressors that every peer supports, encoded as a
+// bitmask indexed by Compressor. It is sent to the peer in the version
+// message.
+const compressors uint8 = 1<<Snappy | 1<<Zstd
+
+// String implements the fmt.Stringer interface.
+func (c Compressor) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case Snappy:
+		return "snappy"
+	case Zstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("Compressor(%d)", c)
+	}
+}
+
+// The zstd encoder and decoder are expensive to construct, but safe for
+// concurrent use by EncodeAll and DecodeAll, so we share a single instance
+// of each.
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func initZstd() {
+	zstdOnce.Do(func() {
+		var err error
+		zstdEncoder, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if err != nil {
+			panic(err)
+		}
+		zstdDecoder, err = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxMessageSize), zstd.WithDecoderConcurrency(0))
+		if err != nil {
+			panic(err)
+		}
+	})
+}
+
+// shouldCompress returns whether a payload of the provided size should be
+// compressed with c when sent to a peer that supports the provided set of
+// compressors.
+func shouldCompress(c Compressor, threshold int, peer uint8, size int) bool {
+	return c != NoCompression && size > threshold && peer&(1<<c) != 0
+}
+
+// compress returns the compressed form of payload, prefixed with the
+// compressor used.
+func compress(c Compressor, payload []byte) []byte {
+	switch c {
+	case Snappy:
+		dst := make([]byte, 1+s2.MaxEncodedLen(len(payload)))
+		dst[0] = byte(c)
+		return dst[:1+len(s2.EncodeSnappy(dst[1:], payload))]
+	case Zstd:
+		initZstd()
+		return zstdEncoder.EncodeAll(payload, []byte{byte(c)})
+	default:
+		panic(fmt.Sprintf("unexpected compressor %v", c))
+	}
+}
+
+// decompress reverses compress.
+func decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("missing compressor")
+	}
+	c, data := Compressor(data[0]), data[1:]
+	switch c {
+	case Snappy:
+		n, err := s2.DecodedLen(data)
+		if err != nil {
+			return nil, fmt.Errorf("snappy: %w", err)
+		}
+		if n > maxMessageSize {
+			return nil, fmt.Errorf("snappy: overly large decompressed length %d", n)
+		}
+		result, err := s2.Decode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("snappy: %w", err)
+		}
+		return result, nil
+	case Zstd:
+		initZstd()
+		result, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unknown compressor %v", c)
+	}
+}
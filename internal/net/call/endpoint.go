@@ -45,7 +45,7 @@ type Endpoint interface {
 //	TCP("[fe80::1%lo0]:53")
 //	TCP(":80")
 func TCP(address string) NetEndpoint {
-	return NetEndpoint{"tcp", address}
+	return NetEndpoint{Net: "tcp", Addr: address}
 }
 
 // Unix returns an endpoint that uses Unix sockets. The provided filename is
@@ -54,13 +54,19 @@ func TCP(address string) NetEndpoint {
 //	Unix("unix.sock")
 //	Unix("/tmp/unix.sock")
 func Unix(filename string) NetEndpoint {
-	return NetEndpoint{"unix", filename}
+	return NetEndpoint{Net: "unix", Addr: filename}
 }
 
 // NetEndpoint is an Endpoint that implements Dial using net.Dial.
 type NetEndpoint struct {
-	Net  string // e.g., "tcp", "udp", "unix"
-	Addr string // e.g., "localhost:8000", "/tmp/unix.sock"
+	Net      string // e.g., "tcp", "udp", "unix"
+	Addr     string // e.g., "localhost:8000", "/tmp/unix.sock"
+	Locality string // e.g., "us-central1-a", or empty if unknown
+
+	// Socket, if not empty, is the filename of a Unix socket on which the
+	// same server is reachable. Dial prefers Socket over Addr, falling back to
+	// Addr if Socket cannot be dialed. Socket does not affect Address.
+	Socket string
 }
 
 // Check that NetEndpoint implements the Endpoint interface.
@@ -69,6 +75,11 @@ var _ Endpoint = &NetEndpoint{}
 // Dial implements the Endpoint interface.
 func (ne NetEndpoint) Dial(ctx context.Context) (net.Conn, error) {
 	var dialer net.Dialer
+	if ne.Socket != "" {
+		if conn, err := dialer.DialContext(ctx, "unix", ne.Socket); err == nil {
+			return conn, nil
+		}
+	}
 	return dialer.DialContext(ctx, ne.Net, ne.Addr)
 }
 
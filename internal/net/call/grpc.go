@@ -0,0 +1,474 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package call
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// grpcMethod is the bidirectional streaming gRPC method that carries the
+	// connections of the GRPC transport:
+	//
+	//	service Transport {
+	//	  rpc Connect(stream google.protobuf.BytesValue) returns (stream google.protobuf.BytesValue);
+	//	}
+	grpcMethod = "/serviceweaver.Transport/Connect"
+
+	// grpcChunkSize is the maximum number of bytes of the call protocol
+	// carried by a single gRPC message.
+	grpcChunkSize = 64 << 10
+)
+
+// GRPC returns a Transport that carries every connection inside a
+// bidirectional gRPC stream, so that the traffic between clients and servers
+// can traverse L7 load balancers and service meshes that only understand
+// gRPC. The bytes of the call protocol are sent as a sequence of
+// google.protobuf.BytesValue messages on a stream of the method
+// /serviceweaver.Transport/Connect. Every stream has an HTTP/2 connection of
+// its own, over TLS if a TLS config is provided and over cleartext (h2c)
+// otherwise.
+//
+// The call protocol keeps its own framing, multiplexing, and cancellation
+// within a stream, so gRPC intermediaries see one long-lived stream per
+// connection rather than one RPC per call.
+func GRPC() Transport {
+	return grpcTransport{}
+}
+
+type grpcTransport struct{}
+
+var _ Transport = grpcTransport{}
+
+// Listen implements the Transport interface.
+func (grpcTransport) Listen(l net.Listener, config *tls.Config) net.Listener {
+	if config != nil {
+		config = config.Clone()
+		config.NextProtos = []string{http2.NextProtoTLS}
+	}
+	gl := &grpcListener{
+		l:      l,
+		config: config,
+		conns:  make(chan *grpcConn),
+		done:   make(chan struct{}),
+		raw:    map[net.Conn]struct{}{},
+	}
+	go gl.serve()
+	return gl
+}
+
+// Dial implements the Transport interface.
+func (grpcTransport) Dial(ctx context.Context, endpoint Endpoint, config *tls.Config) (net.Conn, error) {
+	nc, err := endpoint.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	if config != nil {
+		config = config.Clone()
+		config.NextProtos = []string{http2.NextProtoTLS}
+		tc := tls.Client(nc, config)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("tls handshake: %w", err)
+		}
+		if p := tc.ConnectionState().NegotiatedProtocol; p != http2.NextProtoTLS {
+			nc.Close()
+			return nil, fmt.Errorf("tls handshake: negotiated protocol %q, want %q", p, http2.NextProtoTLS)
+		}
+		nc, scheme = tc, "https"
+	}
+	var t http2.Transport
+	cc, err := t.NewClientConn(nc)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	// The stream outlives ctx, which only bounds the dialing.
+	streamCtx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	url := fmt.Sprintf("%s://%s%s", scheme, authority(endpoint), grpcMethod)
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodPost, url, pr)
+	if err != nil {
+		cancel()
+		cc.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := cc.RoundTrip(req)
+		results <- result{resp, err}
+	}()
+	var r result
+	select {
+	case r = <-results:
+	case <-ctx.Done():
+		r.err = ctx.Err()
+	}
+	if r.err == nil && r.resp.StatusCode != http.StatusOK {
+		r.resp.Body.Close()
+		r.err = fmt.Errorf("gRPC stream: HTTP status %s", r.resp.Status)
+	}
+	if r.err != nil {
+		cancel()
+		pw.Close()
+		cc.Close()
+		return nil, r.err
+	}
+	return newGRPCConn(r.resp.Body, pw, nil, nil, nc.LocalAddr(), nc.RemoteAddr(), func() {
+		pw.Close()
+		r.resp.Body.Close()
+		cancel()
+		cc.Close()
+	}), nil
+}
+
+// authority returns the authority of the gRPC streams to the provided
+// endpoint, which L7 load balancers may route by.
+func authority(endpoint Endpoint) string {
+	if ne, ok := endpoint.(NetEndpoint); ok && ne.Net == "tcp" {
+		return ne.Addr
+	}
+	return "localhost"
+}
+
+// grpcListener is the listener returned by the GRPC transport. It serves
+// HTTP/2 on the connections accepted by the underlying listener, and returns
+// every gRPC stream as a connection.
+type grpcListener struct {
+	l      net.Listener
+	config *tls.Config // nil for cleartext HTTP/2
+	server http2.Server
+	conns  chan *grpcConn // streams to be accepted
+	done   chan struct{}  // closed when the listener fails
+
+	mu  sync.Mutex
+	err error                 // error of the listener, set before done is closed
+	raw map[net.Conn]struct{} // connections accepted by l
+}
+
+var _ net.Listener = &grpcListener{}
+
+// serve serves the connections accepted by the underlying listener, until
+// it fails.
+func (gl *grpcListener) serve() {
+	for {
+		conn, err := gl.l.Accept()
+		if err != nil {
+			gl.fail(err)
+			return
+		}
+		if !gl.track(conn) {
+			conn.Close()
+			return
+		}
+		go func() {
+			defer gl.untrack(conn)
+			defer conn.Close()
+			if gl.config != nil {
+				tc := tls.Server(conn, gl.config)
+				if err := tc.Handshake(); err != nil {
+					return
+				}
+				conn = tc
+			}
+			gl.server.ServeConn(conn, &http2.ServeConnOpts{Handler: http.HandlerFunc(gl.handle)})
+		}()
+	}
+}
+
+// handle handles a gRPC stream, which it passes to Accept. It returns once
+// the stream's connection is closed.
+func (gl *grpcListener) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != grpcMethod || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, fmt.Sprintf("call: unexpected request %s %s", r.Method, r.URL.Path), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Add("Trailer", "Grpc-Status")
+	w.WriteHeader(http.StatusOK)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return
+	}
+	flusher.Flush()
+
+	local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	remote := grpcAddr(r.RemoteAddr)
+	done := make(chan struct{})
+	conn := newGRPCConn(r.Body, w, flusher.Flush, r.TLS, local, remote, func() { close(done) })
+	select {
+	case gl.conns <- conn:
+	case <-gl.done:
+		return
+	case <-r.Context().Done():
+		return
+	}
+
+	// The stream ends when handle returns, so wait for the connection to be
+	// closed, or for the client to go away.
+	select {
+	case <-done:
+	case <-r.Context().Done():
+		conn.Close()
+	}
+	w.Header().Set("Grpc-Status", "0")
+}
+
+// Accept implements the net.Listener interface.
+func (gl *grpcListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-gl.conns:
+		return conn, nil
+	case <-gl.done:
+		gl.mu.Lock()
+		defer gl.mu.Unlock()
+		return nil, gl.err
+	}
+}
+
+// Close implements the net.Listener interface.
+func (gl *grpcListener) Close() error {
+	err := gl.l.Close()
+	gl.fail(net.ErrClosed)
+	return err
+}
+
+// Addr implements the net.Listener interface.
+func (gl *grpcListener) Addr() net.Addr {
+	return gl.l.Addr()
+}
+
+// fail records the error of the listener, if it hasn't failed yet, and
+// closes the connections it accepted.
+func (gl *grpcListener) fail(err error) {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+	if gl.err != nil {
+		return
+	}
+	gl.err = err
+	close(gl.done)
+	for conn := range gl.raw {
+		conn.Close()
+	}
+}
+
+// track records a connection accepted by the underlying listener, unless the
+// listener has failed.
+func (gl *grpcListener) track(conn net.Conn) bool {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+	if gl.err != nil {
+		return false
+	}
+	gl.raw[conn] = struct{}{}
+	return true
+}
+
+// untrack forgets a connection recorded by track.
+func (gl *grpcListener) untrack(conn net.Conn) {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+	delete(gl.raw, conn)
+}
+
+// grpcConn is a connection carried by a gRPC stream.
+type grpcConn struct {
+	r             io.Reader // messages received
+	buf           []byte    // unread bytes of the last message received
+	local, remote net.Addr
+	state         *tls.ConnectionState // nil for cleartext HTTP/2
+
+	mu      sync.Mutex // guards w, flush, and closed
+	w       io.Writer  // messages sent
+	flush   func()     // if not nil, flushes w
+	closed  bool
+	onClose func()
+}
+
+var _ net.Conn = &grpcConn{}
+
+func newGRPCConn(r io.Reader, w io.Writer, flush func(), state *tls.ConnectionState, local, remote net.Addr, onClose func()) *grpcConn {
+	return &grpcConn{
+		r:       r,
+		local:   local,
+		remote:  remote,
+		state:   state,
+		w:       w,
+		flush:   flush,
+		onClose: onClose,
+	}
+}
+
+// Read implements the net.Conn interface.
+func (c *grpcConn) Read(b []byte) (int, error) {
+	for len(c.buf) == 0 {
+		var header [5]byte
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return 0, fmt.Errorf("gRPC stream: truncated message header")
+			}
+			return 0, err
+		}
+		if header[0] != 0 {
+			return 0, fmt.Errorf("gRPC stream: unexpected compressed message")
+		}
+		n := binary.BigEndian.Uint32(header[1:])
+		if n > grpcChunkSize+16 {
+			return 0, fmt.Errorf("gRPC stream: message of %d bytes exceeds %d bytes", n, grpcChunkSize+16)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(c.r, msg); err != nil {
+			return 0, fmt.Errorf("gRPC stream: read message: %w", err)
+		}
+		value, err := decodeBytesValue(msg)
+		if err != nil {
+			return 0, fmt.Errorf("gRPC stream: %w", err)
+		}
+		c.buf = value
+	}
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// Write implements the net.Conn interface.
+func (c *grpcConn) Write(b []byte) (int, error) {
+	var msgs []byte
+	for chunk := b; len(chunk) > 0; {
+		n := len(chunk)
+		if n > grpcChunkSize {
+			n = grpcChunkSize
+		}
+		msg := protowire.AppendTag(nil, 1, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, chunk[:n])
+		var header [5]byte
+		binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+		msgs = append(msgs, header[:]...)
+		msgs = append(msgs, msg...)
+		chunk = chunk[n:]
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	if _, err := c.w.Write(msgs); err != nil {
+		return 0, err
+	}
+	if c.flush != nil {
+		c.flush()
+	}
+	return len(b), nil
+}
+
+// Close implements the net.Conn interface.
+func (c *grpcConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.onClose()
+	return nil
+}
+
+// ConnectionState returns the state of the TLS connection that carries the
+// stream, like tls.Conn.ConnectionState does.
+func (c *grpcConn) ConnectionState() tls.ConnectionState {
+	if c.state == nil {
+		return tls.ConnectionState{}
+	}
+	return *c.state
+}
+
+// LocalAddr implements the net.Conn interface.
+func (c *grpcConn) LocalAddr() net.Addr { return c.local }
+
+// RemoteAddr implements the net.Conn interface.
+func (c *grpcConn) RemoteAddr() net.Addr { return c.remote }
+
+// SetDeadline implements the net.Conn interface. Deadlines are not
+// supported.
+func (c *grpcConn) SetDeadline(time.Time) error {
+	return errors.New("gRPC stream: deadlines are not supported")
+}
+
+// SetReadDeadline implements the net.Conn interface. Deadlines are not
+// supported.
+func (c *grpcConn) SetReadDeadline(time.Time) error {
+	return errors.New("gRPC stream: deadlines are not supported")
+}
+
+// SetWriteDeadline implements the net.Conn interface. Deadlines are not
+// supported.
+func (c *grpcConn) SetWriteDeadline(time.Time) error {
+	return errors.New("gRPC stream: deadlines are not supported")
+}
+
+// decodeBytesValue decodes a google.protobuf.BytesValue message.
+func decodeBytesValue(msg []byte) ([]byte, error) {
+	var value []byte
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		msg = msg[n:]
+		if num == 1 && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(msg)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			value, msg = v, msg[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, msg)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		msg = msg[n:]
+	}
+	return value, nil
+}
+
+// grpcAddr is the address of the client of a gRPC stream.
+type grpcAddr string
+
+func (a grpcAddr) Network() string { return "tcp" }
+func (a grpcAddr) String() string  { return string(a) }
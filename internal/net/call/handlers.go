@@ -54,3 +54,9 @@ func (hm *HandlerMap) Set(component, method string, handler Handler) {
 	hm.handlers[fp] = handler
 	hm.names[fp] = component + "." + method
 }
+
+// Get returns the handler registered for the provided method key, if any.
+func (hm *HandlerMap) Get(key MethodKey) (Handler, bool) {
+	h, ok := hm.handlers[key]
+	return h, ok
+}
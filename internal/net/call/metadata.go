@@ -0,0 +1,93 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package call
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/binary"
+)
+
+// metadataKey is the context key for the metadata of a call.
+type metadataKey struct{}
+
+// metadata is the metadata sent by a client along with a call. See
+// CallOptions.
+type metadata struct {
+	shardKey uint64
+	caller   uint64
+	peer     *Peer // set by the server, never sent
+}
+
+// Peer is the client of a call, as authenticated by the server, rather than
+// as claimed by the client.
+type Peer struct {
+	// Local is true if the client connected over a Unix socket, and hence
+	// runs on the same machine.
+	Local bool
+
+	// Certificate, if not nil, is the verified TLS certificate of the client.
+	Certificate *x509.Certificate
+}
+
+// encodeMetadata encodes the metadata of a call into b.
+// REQUIRES: len(b) >= metadataLen
+func encodeMetadata(opts CallOptions, b []byte) {
+	binary.LittleEndian.PutUint64(b, opts.ShardKey)
+	binary.LittleEndian.PutUint64(b[8:], opts.Caller)
+}
+
+// decodeMetadata decodes the metadata of a call from b.
+// REQUIRES: len(b) >= metadataLen
+func decodeMetadata(b []byte) metadata {
+	return metadata{
+		shardKey: binary.LittleEndian.Uint64(b),
+		caller:   binary.LittleEndian.Uint64(b[8:]),
+	}
+}
+
+// WithMetadata returns a context that carries the metadata of a call made
+// with the provided options, as the context of a Handler does. It is used to
+// execute in-process calls like remote ones.
+func WithMetadata(ctx context.Context, opts CallOptions) context.Context {
+	if opts.ShardKey == 0 && opts.Caller == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, metadataKey{}, metadata{shardKey: opts.ShardKey, caller: opts.Caller})
+}
+
+// ShardKey returns the shard key that the client sent along with the call
+// handled with the provided context, or 0 if it didn't send one. It must be
+// called from a Handler.
+func ShardKey(ctx context.Context) uint64 {
+	m, _ := ctx.Value(metadataKey{}).(metadata)
+	return m.shardKey
+}
+
+// Caller returns the caller identifier (see CallOptions.Caller) that the
+// client sent along with the call handled with the provided context, or 0 if
+// it didn't send one. It must be called from a Handler.
+func Caller(ctx context.Context) uint64 {
+	m, _ := ctx.Value(metadataKey{}).(metadata)
+	return m.caller
+}
+
+// PeerOf returns the client of the call handled with the provided context, or
+// nil if the client connected neither over a Unix socket nor with a TLS
+// certificate. It must be called from a Handler.
+func PeerOf(ctx context.Context) *Peer {
+	m, _ := ctx.Value(metadataKey{}).(metadata)
+	return m.peer
+}
@@ -31,6 +31,15 @@ const (
 	responseMessage
 	responseError
 	cancelMessage
+
+	// compressedFlag is set in the type of request and response messages
+	// whose call argument or result is compressed.
+	compressedFlag messageType = 0x80
+
+	// metadataFlag is set in the type of request messages whose header is
+	// followed by call metadata.
+	metadataFlag messageType = 0x40
+
 	// Other types to add?
 	// - chunked request/response messages?
 	// - health check
@@ -42,9 +51,23 @@ type version uint32
 
 const (
 	initialVersion version = iota
+	compressionVersion
+	metadataVersion
 )
 
-const currentVersion = initialVersion
+const currentVersion = metadataVersion
+
+// metadataLen is the size of the call metadata sent with a request message
+// whose type has metadataFlag set.
+const metadataLen = 16 // shard key + caller
+
+// maxMessageSize is the maximum size of a message, and of a decompressed call
+// argument or result.
+const maxMessageSize = 100 << 20
+
+// MaxPayloadSize is the maximum size of a call argument or result. Larger
+// messages are rejected by the receiver, which closes the connection.
+const MaxPayloadSize = maxMessageSize - msgHeaderSize - metadataLen
 
 // # Message formats
 //
@@ -57,8 +80,8 @@ const currentVersion = initialVersion
 // The format of payload depends on the message typo.
 //
 // versionMessage: this is the first message sent on a connection by both sides.
-//      version  [4]byte
-//
+//      version     [4]byte
+//      compressors [1]byte	-- bitmask of supported Compressors (version >= compressionVersion)
 //
 //  requestMessage:
 //	headerKey    [16]byte   -- fingerprint of method name
@@ -66,9 +89,25 @@ const currentVersion = initialVersion
 //  traceContext [25]byte   -- zero, or trace context
 //	remainder		        -- call argument serialization
 //
+// If metadataFlag is set in the type of a request message, the trace context
+// is followed by the call metadata:
+//	shardKey      [8]byte   -- zero, or shard key of the call
+//	caller        [8]byte   -- zero, or identifier of the caller
+//
+// A client only sets metadataFlag if the server's version is at least
+// metadataVersion.
+//
 // responseMessage:
 //	payload holds call result serialization
 //
+// If compressedFlag is set in the type of a request or response message, the
+// call argument or result serialization is replaced by:
+//	compressor    [1]byte   -- Compressor
+//	remainder               -- compressed serialization
+//
+// A peer only compresses data with a Compressor that the other peer included
+// in its version message.
+//
 // responseError:
 //	payload holds error serialization
 //
@@ -157,8 +196,7 @@ func readMessage(r io.Reader) (messageType, uint64, []byte, error) {
 	w2 := binary.LittleEndian.Uint64(hdr[8:])
 	mt := messageType(w2 & 0xff)
 	dataLen := w2 >> 8
-	const maxSize = 100 << 20
-	if dataLen > maxSize {
+	if dataLen > maxMessageSize {
 		return 0, 0, nil, fmt.Errorf("overly large message length %d", dataLen)
 	}
 
@@ -172,26 +210,33 @@ func readMessage(r io.Reader) (messageType, uint64, []byte, error) {
 
 // writeVersion sends my version number to the peer.
 func writeVersion(w io.Writer, wlock *sync.Mutex) error {
-	var msg [4]byte
+	var msg [5]byte
 	binary.LittleEndian.PutUint32(msg[:], uint32(currentVersion))
+	msg[4] = compressors
 	return writeFlat(w, wlock, versionMessage, 0, nil, msg[:])
 }
 
 // getVersion extracts the version number sent by the peer and picks the
-// appropriate version number to use for communicating with the peer.
-func getVersion(id uint64, msg []byte) (version, error) {
+// appropriate version number to use for communicating with the peer. It also
+// returns the set of compressors supported by the peer.
+func getVersion(id uint64, msg []byte) (version, uint8, error) {
 	if id != 0 {
-		return 0, fmt.Errorf("invalid ID %d in handshake", id)
+		return 0, 0, fmt.Errorf("invalid ID %d in handshake", id)
 	}
 	// Allow messages longer than needed so that future updates can send more info.
 	if len(msg) < 4 {
-		return 0, fmt.Errorf("bad version message length %d, must be >= 4", len(msg))
+		return 0, 0, fmt.Errorf("bad version message length %d, must be >= 4", len(msg))
 	}
 	v := binary.LittleEndian.Uint32(msg)
 
 	// We use the minimum of the peer and my version numbers.
+	result := currentVersion
 	if v < uint32(currentVersion) {
-		return version(v), nil
+		result = version(v)
+	}
+	var peer uint8
+	if result >= compressionVersion && len(msg) >= 5 {
+		peer = msg[4]
 	}
-	return currentVersion, nil
+	return result, peer, nil
 }
@@ -20,17 +20,32 @@ import (
 )
 
 // A NetworkAddress is a string of the form <network>://<address> (e.g.,
-// "tcp://localhost:8000", "unix:///tmp/unix.sock").
+// "tcp://localhost:8000", "unix:///tmp/unix.sock"), optionally followed by
+// #<locality>, where the locality identifies where the address is, e.g., a
+// zone (e.g., "tcp://10.0.0.1:8000#us-central1-a").
 type NetworkAddress string
 
-// Split splits the network and address from a NetworkAddress. For example,
+// Split splits the network and address from a NetworkAddress, dropping the
+// locality. For example,
 //
-//	NetworkAddress("tcp://localhost:80").Split() // "tcp", "localhost:80"
-//	NetworkAddress("unix://unix.sock").Split()   // "unix", "unix.sock"
+//	NetworkAddress("tcp://localhost:80").Split()    // "tcp", "localhost:80"
+//	NetworkAddress("unix://unix.sock").Split()      // "unix", "unix.sock"
+//	NetworkAddress("tcp://localhost:80#a").Split()  // "tcp", "localhost:80"
 func (na NetworkAddress) Split() (network string, address string, err error) {
-	net, addr, ok := strings.Cut(string(na), "://")
+	s, _, _ := strings.Cut(string(na), "#")
+	net, addr, ok := strings.Cut(s, "://")
 	if !ok {
 		return "", "", fmt.Errorf("%q does not have format <network>://<address>", na)
 	}
 	return net, addr, nil
 }
+
+// Locality returns the locality of a NetworkAddress, or the empty string if
+// it doesn't have one. For example,
+//
+//	NetworkAddress("tcp://localhost:80").Locality()                // ""
+//	NetworkAddress("tcp://10.0.0.1:80#us-central1-a").Locality()   // "us-central1-a"
+func (na NetworkAddress) Locality() string {
+	_, locality, _ := strings.Cut(string(na), "#")
+	return locality
+}
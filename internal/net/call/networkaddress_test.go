@@ -32,6 +32,7 @@ func TestSplit(t *testing.T) {
 		{"EmptyAddress", "network://", "network", ""},
 		{"JustDelim", "://", "", ""},
 		{"ExtraDelim", "network://a://b://c", "network", "a://b://c"},
+		{"Locality", "network://address#locality", "network", "address"},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			network, address, err := call.NetworkAddress(test.s).Split()
@@ -55,3 +56,18 @@ func TestSplitError(t *testing.T) {
 		t.Fatalf("%q.Split(): unexpected success", string(na))
 	}
 }
+
+func TestLocality(t *testing.T) {
+	for _, test := range []struct {
+		s        string
+		locality string
+	}{
+		{"tcp://localhost:80", ""},
+		{"tcp://localhost:80#", ""},
+		{"tcp://10.0.0.1:80#us-central1-a", "us-central1-a"},
+	} {
+		if got := call.NetworkAddress(test.s).Locality(); got != test.locality {
+			t.Errorf("%q.Locality(): got %q, want %q", test.s, got, test.locality)
+		}
+	}
+}
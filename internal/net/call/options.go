@@ -15,6 +15,7 @@
 package call
 
 import (
+	"crypto/tls"
 	"time"
 
 	"go.opentelemetry.io/otel/trace"
@@ -38,6 +39,19 @@ type ClientOptions struct {
 	// If non-zero, all writes smaller than this limit are flattened into
 	// a single buffer before being written on the connection.
 	WriteFlattenLimit int
+
+	// If not nil, connections to servers are secured with TLS using the
+	// provided config.
+	TLSConfig *tls.Config
+
+	// If not nil, connections to servers, other than over Unix sockets, are
+	// carried by Transport, which must match the servers' Transport.
+	Transport Transport
+
+	// If not NoCompression, call arguments larger than CompressionThreshold
+	// bytes are compressed with Compression, if the server supports it.
+	Compression          Compressor
+	CompressionThreshold int
 }
 
 // ServerOption are the options to configure an RPC server.
@@ -55,6 +69,19 @@ type ServerOptions struct {
 	// If non-zero, all writes smaller than this limit are flattened into
 	// a single buffer before being written on the connection.
 	WriteFlattenLimit int
+
+	// If not nil, connections from clients are secured with TLS using the
+	// provided config.
+	TLSConfig *tls.Config
+
+	// If not nil, connections from clients, other than over Unix sockets, are
+	// carried by Transport, which must match the clients' Transport.
+	Transport Transport
+
+	// If not NoCompression, call results larger than CompressionThreshold
+	// bytes are compressed with Compression, if the client supports it.
+	Compression          Compressor
+	CompressionThreshold int
 }
 
 // CallOptions are call-specific options.
@@ -66,10 +93,25 @@ type CallOptions struct {
 	// change to *uint64 for example.
 	ShardKey uint64
 
+	// Caller, if not 0, identifies the caller to the server, which can read
+	// it, along with ShardKey, using the Caller and ShardKey functions. Both
+	// are only sent to servers that support them. Since the client learns
+	// whether a server supports them from the version that the server sends
+	// when a connection is established, a call with a ShardKey or a Caller
+	// that is the first call on a new connection waits for that version,
+	// i.e., for one extra round trip, rather than being sent without them.
+	Caller uint64
+
 	// Balancer, if not nil, is the Balancer to use for a call, instead of the
 	// Balancer that the client was constructed with (provided in
 	// ClientOptions).
 	Balancer Balancer
+
+	// Outstanding returns the number of calls in progress on the provided
+	// endpoint, for the balancers that pick endpoints by load. A Connection
+	// sets Outstanding before passing the CallOptions to Pick, so callers
+	// need not set it.
+	Outstanding func(Endpoint) int
 }
 
 // withDefaults returns a copy of the ClientOptions with zero values replaced
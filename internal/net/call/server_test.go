@@ -0,0 +1,154 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package call
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestAbandonedCalls tests that a server doesn't reply to calls whose
+// deadline passed, and doesn't run handlers whose deadline passed before
+// they could start.
+func TestAbandonedCalls(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	waited := make(chan error, 1)
+	hmap := &HandlerMap{}
+	hmap.Set("", "wait", func(ctx context.Context, _ []byte) ([]byte, error) {
+		<-ctx.Done()
+		waited <- ctx.Err()
+		return nil, ctx.Err()
+	})
+	hmap.Set("", "echo", func(_ context.Context, arg []byte) ([]byte, error) {
+		return arg, nil
+	})
+	go ServeOn(ctx, server, hmap, ServerOptions{})
+
+	var wlock sync.Mutex
+	if err := writeVersion(client, &wlock); err != nil {
+		t.Fatal(err)
+	}
+	if mt, _, _, err := readMessage(client); err != nil || mt != versionMessage {
+		t.Fatalf("handshake: got (%d, %v), want version message", mt, err)
+	}
+	request := func(id uint64, method string, timeout time.Duration, arg string) {
+		var hdr [msgHeaderSize]byte
+		key := MakeMethodKey("", method)
+		copy(hdr[:], key[:])
+		binary.LittleEndian.PutUint64(hdr[16:], uint64(timeout.Microseconds()))
+		if err := writeMessage(client, &wlock, requestMessage, id, hdr[:], []byte(arg), 1<<20); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The handler is canceled when the deadline passes, and no reply is sent.
+	request(1, "wait", 10*time.Millisecond, "")
+	if err := <-waited; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("handler: got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	request(2, "echo", 0, "hello")
+	if mt, id, payload, err := readMessage(client); err != nil || mt != responseMessage || id != 2 || string(payload) != "hello" {
+		t.Fatalf("echo: got (%d, %d, %q, %v), want (%d, 2, \"hello\", nil)", mt, id, payload, err, responseMessage)
+	}
+	if err := client.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if mt, id, _, err := readMessage(client); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("got message %d with id %d, want no reply to abandoned call", mt, id)
+	}
+}
+
+// TestCompressionNegotiation tests that a server only compresses results for
+// clients that support compression.
+func TestCompressionNegotiation(t *testing.T) {
+	hmap := &HandlerMap{}
+	hmap.Set("", "echo", func(_ context.Context, arg []byte) ([]byte, error) {
+		return arg, nil
+	})
+	opts := ServerOptions{Compression: Zstd, CompressionThreshold: 10}
+	arg := bytes.Repeat([]byte("weaver"), 100)
+
+	for _, test := range []struct {
+		name      string
+		version   version
+		argFlag   messageType // flag of the request message
+		wantFlag  messageType // flag of the response message
+		writeArgs func([]byte) []byte
+	}{
+		{"Old", initialVersion, 0, 0, nil},
+		{"Current", currentVersion, 0, compressedFlag, nil},
+		{"CompressedArg", currentVersion, compressedFlag, compressedFlag, func(b []byte) []byte { return compress(Snappy, b) }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go ServeOn(ctx, server, hmap, opts)
+
+			// Write the version message by hand, to be able to pretend to be
+			// an old client.
+			var wlock sync.Mutex
+			msg := []byte{0, 0, 0, 0, compressors}
+			binary.LittleEndian.PutUint32(msg, uint32(test.version))
+			if test.version < compressionVersion {
+				msg = msg[:4]
+			}
+			if err := writeFlat(client, &wlock, versionMessage, 0, nil, msg); err != nil {
+				t.Fatal(err)
+			}
+			if mt, _, _, err := readMessage(client); err != nil || mt != versionMessage {
+				t.Fatalf("handshake: got (%d, %v), want version message", mt, err)
+			}
+
+			var hdr [msgHeaderSize]byte
+			key := MakeMethodKey("", "echo")
+			copy(hdr[:], key[:])
+			payload := arg
+			if test.writeArgs != nil {
+				payload = test.writeArgs(arg)
+			}
+			if err := writeMessage(client, &wlock, requestMessage|test.argFlag, 1, hdr[:], payload, 1<<20); err != nil {
+				t.Fatal(err)
+			}
+			mt, _, result, err := readMessage(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := responseMessage | test.wantFlag; mt != want {
+				t.Fatalf("response type: got %d, want %d", mt, want)
+			}
+			if mt&compressedFlag != 0 {
+				if result, err = decompress(result); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(result, arg) {
+				t.Fatalf("response: got %q, want %q", result, arg)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package call
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// A Transport carries the connections between clients and servers. By
+// default, i.e., with a nil Transport, the call protocol is sent directly
+// over the network connections returned by Endpoint.Dial and by the server's
+// listener, secured with TLS if configured. A Transport can instead carry
+// every connection inside another protocol, e.g., inside a gRPC stream (see
+// GRPC), and is then responsible for TLS as well.
+//
+// Clients and servers must use the same Transport.
+type Transport interface {
+	// Listen returns a listener of the connections that clients make to l,
+	// secured with the provided TLS config, if not nil.
+	Listen(l net.Listener, config *tls.Config) net.Listener
+
+	// Dial returns a connection to the server at the provided endpoint,
+	// secured with the provided TLS config, if not nil.
+	Dial(ctx context.Context, endpoint Endpoint, config *tls.Config) (net.Conn, error)
+}
+
+// isUnix returns whether the provided endpoint is a Unix socket, whose
+// connections are never carried by a Transport.
+func isUnix(endpoint Endpoint) bool {
+	ne, ok := endpoint.(NetEndpoint)
+	return ok && ne.Net == "unix"
+}
@@ -16,6 +16,7 @@ package proxy
 
 import (
 	"errors"
+	"fmt"
 	"math/rand"
 	"net/http"
 	"net/http/httputil"
@@ -24,12 +25,22 @@ import (
 	"github.com/ServiceWeaver/weaver/internal/logtype"
 )
 
-// Proxy is an HTTP proxy that forwards traffic to a set of backends.
+// Proxy is an HTTP proxy that forwards traffic to a set of backends. A
+// fraction of the traffic may be forwarded to the backends of a canary
+// deployment instead.
 type Proxy struct {
 	logger   logtype.Logger        // logger
 	reverse  httputil.ReverseProxy // underlying proxy
-	mu       sync.Mutex            // guards backends
+	mu       sync.Mutex            // guards the following fields
 	backends []string              // backend addresses
+	canary   *canary               // canary deployment, or nil
+}
+
+// canary holds the backends of a canary deployment.
+type canary struct {
+	deployment string   // deployment id
+	fraction   float64  // fraction of the traffic, between 0 and 1
+	backends   []string // backend addresses
 }
 
 // NewProxy returns a new proxy.
@@ -52,6 +63,34 @@ func (p *Proxy) AddBackend(backend string) {
 	p.backends = append(p.backends, backend)
 }
 
+// AddCanaryBackend adds a backend of the provided canary deployment to the
+// proxy, and forwards the provided fraction of the traffic, between 0 and 1,
+// to the canary's backends. It returns an error if the proxy already has the
+// backends of a different canary deployment.
+func (p *Proxy) AddCanaryBackend(deployment, backend string, fraction float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.canary != nil && p.canary.deployment != deployment {
+		return fmt.Errorf("proxy already has canary deployment %q", p.canary.deployment)
+	}
+	if p.canary == nil {
+		p.canary = &canary{deployment: deployment}
+	}
+	p.canary.fraction = fraction
+	p.canary.backends = append(p.canary.backends, backend)
+	return nil
+}
+
+// RemoveCanary removes the backends of the provided canary deployment, if
+// any, from the proxy.
+func (p *Proxy) RemoveCanary(deployment string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.canary != nil && p.canary.deployment == deployment {
+		p.canary = nil
+	}
+}
+
 // director implements a ReverseProxy.Director function [1].
 //
 // [1]: https://pkg.go.dev/net/http/httputil#ReverseProxy
@@ -62,6 +101,10 @@ func (p *Proxy) director(r *http.Request) {
 		p.logger.Error("director", errors.New("no backends"), "url", r.URL)
 		return
 	}
+	backends := p.backends
+	if p.canary != nil && rand.Float64() < p.canary.fraction {
+		backends = p.canary.backends
+	}
 	r.URL.Scheme = "http" // TODO(mwhittaker): Support HTTPS.
-	r.URL.Host = p.backends[rand.Intn(len(p.backends))]
+	r.URL.Host = backends[rand.Intn(len(backends))]
 }
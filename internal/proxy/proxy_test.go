@@ -0,0 +1,72 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+)
+
+// backend returns the address of an HTTP server that replies with name.
+func backend(t *testing.T, name string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name)
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// get issues n requests to the proxy and returns the number of replies from
+// every backend.
+func get(t *testing.T, p *Proxy, n int) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		counts[w.Body.String()]++
+	}
+	return counts
+}
+
+func TestCanary(t *testing.T) {
+	p := NewProxy(logging.NewTestLogger(t))
+	p.AddBackend(backend(t, "stable"))
+
+	if got := get(t, p, 10); got["stable"] != 10 {
+		t.Fatalf("without canary: got %v, want all stable", got)
+	}
+
+	if err := p.AddCanaryBackend("canary", backend(t, "canary"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, p, 10); got["canary"] != 10 {
+		t.Fatalf("with full canary: got %v, want all canary", got)
+	}
+	if err := p.AddCanaryBackend("other", backend(t, "other"), 1); err == nil {
+		t.Fatal("unexpected success adding a second canary")
+	}
+
+	p.RemoveCanary("canary")
+	if got := get(t, p, 10); got["stable"] != 10 {
+		t.Fatalf("after removing canary: got %v, want all stable", got)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/logtype"
+)
+
+// udpSessionTimeout is how long a UDP session lasts without any traffic.
+const udpSessionTimeout = time.Minute
+
+// UDPProxy is a UDP proxy that forwards the packets of every client to one of
+// a set of backends, picked at random, and the replies of the backend back to
+// the client.
+type UDPProxy struct {
+	logger logtype.Logger
+
+	mu       sync.Mutex
+	backends []string               // backend addresses
+	sessions map[string]*udpSession // sessions, keyed by client address
+}
+
+// udpSession forwards the packets of a client to a backend.
+type udpSession struct {
+	upstream *net.UDPConn // connection to the backend
+	active   time.Time    // last time the session had traffic, guarded by UDPProxy.mu
+}
+
+// NewUDPProxy returns a new UDP proxy.
+func NewUDPProxy(logger logtype.Logger) *UDPProxy {
+	return &UDPProxy{logger: logger, sessions: map[string]*udpSession{}}
+}
+
+// AddBackend adds a backend to the proxy. Only new sessions are forwarded to
+// the backend.
+func (p *UDPProxy) AddBackend(backend string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.backends = append(p.backends, backend)
+}
+
+// Serve forwards the packets received on conn until ctx is done or conn
+// fails. It closes conn when it returns.
+func (p *UDPProxy) Serve(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	defer p.closeSessions()
+	buf := make([]byte, 64<<10)
+	for {
+		n, client, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		s, err := p.session(conn, client)
+		if err != nil {
+			p.logger.Error("UDP proxy", err, "client", client.String())
+			continue
+		}
+		if _, err := s.upstream.Write(buf[:n]); err != nil {
+			p.logger.Error("UDP proxy", err, "client", client.String())
+		}
+	}
+}
+
+// session returns the session of the provided client, creating it if needed.
+func (p *UDPProxy) session(conn net.PacketConn, client net.Addr) (*udpSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := client.String()
+	if s, ok := p.sessions[key]; ok {
+		s.active = time.Now()
+		return s, nil
+	}
+	if len(p.backends) == 0 {
+		return nil, errors.New("no backends")
+	}
+	backend, err := net.ResolveUDPAddr("udp", p.backends[rand.Intn(len(p.backends))])
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := net.DialUDP("udp", nil, backend)
+	if err != nil {
+		return nil, err
+	}
+	s := &udpSession{upstream: upstream, active: time.Now()}
+	p.sessions[key] = s
+	go p.reply(conn, client, s)
+	return s, nil
+}
+
+// reply forwards the replies received on a session back to its client, until
+// the session times out.
+func (p *UDPProxy) reply(conn net.PacketConn, client net.Addr, s *udpSession) {
+	defer func() {
+		p.mu.Lock()
+		if p.sessions[client.String()] == s {
+			delete(p.sessions, client.String())
+		}
+		p.mu.Unlock()
+		s.upstream.Close()
+	}()
+	buf := make([]byte, 64<<10)
+	for {
+		s.upstream.SetReadDeadline(time.Now().Add(udpSessionTimeout))
+		n, err := s.upstream.Read(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			p.mu.Lock()
+			idle := time.Since(s.active) >= udpSessionTimeout
+			p.mu.Unlock()
+			if idle {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if _, err := conn.WriteTo(buf[:n], client); err != nil {
+			return
+		}
+		p.mu.Lock()
+		s.active = time.Now()
+		p.mu.Unlock()
+	}
+}
+
+// closeSessions closes all sessions.
+func (p *UDPProxy) closeSessions() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, s := range p.sessions {
+		s.upstream.Close()
+		delete(p.sessions, key)
+	}
+}
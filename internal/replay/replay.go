@@ -0,0 +1,86 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package replay contains the replayer with which weavertest replays a
+// recording of component method calls against a component in isolation.
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ServiceWeaver/weaver/runtime/recording"
+)
+
+// Key is the context key of the *Replayer that weavertest passes to
+// weaver.Init.
+type Key struct{}
+
+// A Replayer replays a recording against a component. The calls that the
+// component makes to other components are not executed, but answered with
+// the results of the matching calls in the recording.
+type Replayer struct {
+	// Component is the full name of the component under test.
+	Component string
+
+	// Call calls the provided method of the component under test, with the
+	// provided serialized arguments, and returns its serialized results. It
+	// is set by the weavelet.
+	Call func(ctx context.Context, method string, args []byte) ([]byte, error)
+
+	mu      sync.Mutex
+	replies map[callKey][]recording.Call // recorded calls, in order, not yet replied with
+}
+
+// callKey identifies the calls with the same arguments to a method.
+type callKey struct {
+	component string
+	method    string
+	args      string
+}
+
+// New returns a replayer of the provided recorded calls against the provided
+// component.
+func New(component string, calls []recording.Call) *Replayer {
+	r := &Replayer{Component: component, replies: map[callKey][]recording.Call{}}
+	for _, c := range calls {
+		if c.Caller != component || c.Component == component {
+			continue
+		}
+		key := callKey{c.Component, c.Method, string(c.Args)}
+		r.replies[key] = append(r.replies[key], c)
+	}
+	return r
+}
+
+// Reply returns the recorded results of a call that the component under test
+// makes to the provided method of another component. The calls with the same
+// arguments are replied with in the order they were recorded.
+func (r *Replayer) Reply(component, method string, args []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := callKey{component, method, string(args)}
+	calls := r.replies[key]
+	if len(calls) == 0 {
+		return nil, fmt.Errorf("replay: no recorded call to %s.%s with these arguments", component, method)
+	}
+	c := calls[0]
+	r.replies[key] = calls[1:]
+	if c.Error != "" {
+		return nil, errors.New(c.Error)
+	}
+	return c.Result, nil
+}
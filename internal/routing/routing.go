@@ -0,0 +1,119 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package routing assigns the key space of routed components to replicas.
+//
+// The key space is split into a fixed number of equally sized slices, and the
+// slices are assigned to replicas using consistent hashing with bounded
+// loads [1]. Consistent hashing minimizes the number of slices, and therefore
+// of keys, that move when replicas are added or removed. Bounding the loads
+// guarantees that no replica is assigned more than a small factor over its
+// fair share of slices.
+//
+// [1]: https://arxiv.org/abs/1608.01350
+package routing
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+const (
+	// numSlices is the number of slices the key space is split into. It
+	// bounds the number of replicas that can be assigned some keys.
+	numSlices = 1024
+
+	// virtualNodes is the number of points every replica has on the hash
+	// ring. More points spread the slices of a removed replica more evenly.
+	virtualNodes = 100
+
+	// loadFactor bounds the number of slices assigned to a replica to
+	// loadFactor times the average number of slices per replica.
+	loadFactor = 1.25
+)
+
+// point is a point on the hash ring, owned by a replica.
+type point struct {
+	hash    uint64
+	replica int // index into the replicas
+}
+
+// Assign returns an assignment of the entire key space to the provided
+// replicas. The assignment is deterministic: it depends only on the set of
+// replicas, not on their order or on previous assignments. Adjacent slices
+// assigned to the same replica are merged.
+func Assign(replicas []string) []*protos.Assignment_Slice {
+	if len(replicas) == 0 {
+		return nil
+	}
+	replicas = append([]string(nil), replicas...)
+	sort.Strings(replicas)
+
+	// Place the replicas on the ring.
+	ring := make([]point, 0, len(replicas)*virtualNodes)
+	for r, replica := range replicas {
+		for i := 0; i < virtualNodes; i++ {
+			ring = append(ring, point{hash(replica + "#" + strconv.Itoa(i)), r})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		if ring[i].hash != ring[j].hash {
+			return ring[i].hash < ring[j].hash
+		}
+		return ring[i].replica < ring[j].replica
+	})
+
+	// Assign every slice to the first replica with spare capacity clockwise
+	// from the slice's position on the ring.
+	capacity := int(math.Ceil(loadFactor * numSlices / float64(len(replicas))))
+	loads := make([]int, len(replicas))
+	owners := make([]int, numSlices)
+	for s := 0; s < numSlices; s++ {
+		h := hash(strconv.Itoa(s))
+		i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+		for ; ; i++ {
+			p := ring[i%len(ring)]
+			if loads[p.replica] < capacity {
+				loads[p.replica]++
+				owners[s] = p.replica
+				break
+			}
+		}
+	}
+
+	// Build the slices, merging adjacent slices with the same owner.
+	const width = math.MaxUint64/numSlices + 1
+	var slices []*protos.Assignment_Slice
+	for s, owner := range owners {
+		if s > 0 && owners[s-1] == owner {
+			continue
+		}
+		slices = append(slices, &protos.Assignment_Slice{
+			Start:    uint64(s) * width,
+			Replicas: []string{replicas[owner]},
+		})
+	}
+	return slices
+}
+
+// hash returns a 64 bit hash of the provided string.
+func hash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.LittleEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// replicas returns n replica addresses.
+func replicas(n int) []string {
+	rs := make([]string, n)
+	for i := range rs {
+		rs[i] = fmt.Sprintf("tcp://10.0.0.%d:9000", i)
+	}
+	return rs
+}
+
+// owners returns the replica that owns each of the numSlices slices.
+func owners(t *testing.T, slices []*protos.Assignment_Slice) []string {
+	t.Helper()
+	if len(slices) == 0 || slices[0].Start != 0 {
+		t.Fatalf("assignment does not start at key 0: %v", slices)
+	}
+	const width = math.MaxUint64/numSlices + 1
+	result := make([]string, numSlices)
+	j := 0
+	for s := range result {
+		for j+1 < len(slices) && slices[j+1].Start <= uint64(s)*width {
+			j++
+		}
+		if len(slices[j].Replicas) != 1 {
+			t.Fatalf("slice %v: want 1 replica", slices[j])
+		}
+		result[s] = slices[j].Replicas[0]
+	}
+	return result
+}
+
+func TestAssignEmpty(t *testing.T) {
+	if slices := Assign(nil); slices != nil {
+		t.Fatalf("Assign(nil): got %v, want nil", slices)
+	}
+}
+
+func TestAssignSingleReplica(t *testing.T) {
+	slices := Assign(replicas(1))
+	if len(slices) != 1 || slices[0].Start != 0 {
+		t.Fatalf("got %v, want a single slice", slices)
+	}
+}
+
+func TestAssignIsDeterministic(t *testing.T) {
+	rs := replicas(5)
+	reversed := []string{rs[4], rs[3], rs[2], rs[1], rs[0]}
+	a, b := owners(t, Assign(rs)), owners(t, Assign(reversed))
+	for s := range a {
+		if a[s] != b[s] {
+			t.Fatalf("slice %d: owner %q != %q", s, a[s], b[s])
+		}
+	}
+}
+
+func TestAssignBoundsLoad(t *testing.T) {
+	for _, n := range []int{2, 3, 7, 10, 64} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			loads := map[string]int{}
+			for _, owner := range owners(t, Assign(replicas(n))) {
+				loads[owner]++
+			}
+			capacity := int(math.Ceil(loadFactor * numSlices / float64(n)))
+			for replica, load := range loads {
+				if load > capacity {
+					t.Errorf("replica %s: load %d > %d", replica, load, capacity)
+				}
+			}
+			if len(loads) != n {
+				t.Errorf("got %d replicas with slices, want %d", len(loads), n)
+			}
+		})
+	}
+}
+
+func TestAssignMovesFewKeys(t *testing.T) {
+	// Adding or removing one of n replicas should ideally move 1/n of the
+	// keys. Allow some slack for the load bound.
+	for _, n := range []int{3, 10, 20} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			before := owners(t, Assign(replicas(n)))
+			after := owners(t, Assign(replicas(n+1)))
+			moved := 0
+			for s := range before {
+				if before[s] != after[s] {
+					moved++
+				}
+			}
+			if max := 2 * numSlices / (n + 1); moved > max {
+				t.Errorf("adding a replica moved %d slices, want <= %d", moved, max)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spiffe implements a client of the SPIFFE Workload API, which
+// workloads use to fetch their X.509 SVIDs and the trust bundles needed to
+// verify their peers. See
+// https://github.com/spiffe/spiffe/blob/main/standards/SPIFFE_Workload_API.md.
+//
+// The Workload API is a gRPC service, usually served by a SPIRE agent over a
+// Unix socket. The client speaks gRPC over cleartext HTTP/2 itself, rather
+// than depend on the gRPC library.
+package spiffe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxMessageSize is the maximum size of a Workload API response.
+const maxMessageSize = 4 << 20
+
+// X509SVID is an X.509 SVID along with the trust bundle of its trust domain.
+type X509SVID struct {
+	ID          string              // SPIFFE ID, e.g., "spiffe://example.org/checkout"
+	Certificate tls.Certificate     // certificate chain and private key
+	Bundle      []*x509.Certificate // CA certificates of the trust domain
+}
+
+// Client is a client of a Workload API endpoint.
+type Client struct {
+	client http.Client
+}
+
+// NewClient returns a client of the Workload API endpoint at the provided
+// address, in the format of the SPIFFE_ENDPOINT_SOCKET environment variable,
+// e.g., "unix:///run/spire/sockets/agent.sock" or "tcp://127.0.0.1:8081".
+func NewClient(addr string) (*Client, error) {
+	network, address, err := parseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	transport := &http2.Transport{
+		// The Workload API is served over cleartext HTTP/2.
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, _, _ string, _ *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+	return &Client{client: http.Client{Transport: transport}}, nil
+}
+
+// parseAddress returns the network and address of the provided Workload API
+// endpoint address.
+func parseAddress(addr string) (string, string, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("spiffe: invalid Workload API address %q: %w", addr, err)
+	}
+	switch {
+	case u.Scheme == "unix" && u.Host == "" && u.Path != "":
+		return "unix", u.Path, nil
+	case u.Scheme == "tcp" && u.Host != "" && (u.Path == "" || u.Path == "/"):
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return "", "", fmt.Errorf("spiffe: invalid Workload API address %q: %w", addr, err)
+		}
+		return "tcp", u.Host, nil
+	default:
+		return "", "", fmt.Errorf("spiffe: invalid Workload API address %q: want unix:///path or tcp://host:port", addr)
+	}
+}
+
+// WatchX509SVIDs streams the X.509 SVIDs of the calling workload. It calls
+// update with the workload's default SVID every time the Workload API sends
+// a new set of SVIDs, e.g., because they were rotated. It blocks until ctx is
+// cancelled or the stream fails, and returns the corresponding error.
+func (c *Client) WatchX509SVIDs(ctx context.Context, update func(*X509SVID)) error {
+	// The request is a single, empty X509SVIDRequest message.
+	body := bytes.NewReader([]byte{0, 0, 0, 0, 0})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/SpiffeWorkloadAPI/FetchX509SVID", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	// The Workload API rejects requests without this header, as a
+	// protection against server-side request forgery.
+	req.Header.Set("Workload.spiffe.io", "true")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("spiffe: fetch X.509 SVIDs: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("spiffe: fetch X.509 SVIDs: HTTP status %s", resp.Status)
+	}
+	if err := status(resp.Header); err != nil {
+		// A response without messages carries its status in its headers.
+		return err
+	}
+
+	for {
+		var header [5]byte
+		if _, err := io.ReadFull(resp.Body, header[:]); err != nil {
+			if !errors.Is(err, io.EOF) {
+				return fmt.Errorf("spiffe: fetch X.509 SVIDs: %w", err)
+			}
+			if err := status(resp.Trailer); err != nil {
+				return err
+			}
+			return errors.New("spiffe: fetch X.509 SVIDs: stream ended")
+		}
+		if header[0] != 0 {
+			return errors.New("spiffe: fetch X.509 SVIDs: unexpected compressed response")
+		}
+		n := binary.BigEndian.Uint32(header[1:])
+		if n > maxMessageSize {
+			return fmt.Errorf("spiffe: fetch X.509 SVIDs: response of %d bytes exceeds %d bytes", n, maxMessageSize)
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(resp.Body, data); err != nil {
+			return fmt.Errorf("spiffe: fetch X.509 SVIDs: %w", err)
+		}
+		svid, err := parseX509SVIDResponse(data)
+		if err != nil {
+			return fmt.Errorf("spiffe: fetch X.509 SVIDs: %w", err)
+		}
+		update(svid)
+	}
+}
+
+// status returns the error corresponding to the gRPC status in the provided
+// headers or trailers, if any.
+func status(h http.Header) error {
+	s := h.Get("Grpc-Status")
+	if s == "" || s == "0" {
+		return nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("spiffe: fetch X.509 SVIDs: invalid grpc-status %q", s)
+	}
+	msg, err := url.PathUnescape(h.Get("Grpc-Message"))
+	if err != nil {
+		msg = h.Get("Grpc-Message")
+	}
+	return fmt.Errorf("spiffe: fetch X.509 SVIDs: gRPC status %d: %s", code, msg)
+}
+
+// parseX509SVIDResponse parses an X509SVIDResponse message and returns its
+// first SVID, which is the workload's default SVID.
+//
+//	message X509SVIDResponse {
+//	  repeated X509SVID svids = 1;
+//	  ...
+//	}
+func parseX509SVIDResponse(data []byte) (*X509SVID, error) {
+	var svids [][]byte
+	err := parseFields(data, func(num protowire.Number, value []byte) {
+		if num == 1 {
+			svids = append(svids, value)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(svids) == 0 {
+		return nil, errors.New("no SVIDs in response")
+	}
+	return parseX509SVID(svids[0])
+}
+
+// parseX509SVID parses an X509SVID message.
+//
+//	message X509SVID {
+//	  string spiffe_id = 1;
+//	  bytes x509_svid = 2;     // ASN.1 DER certificates, leaf first
+//	  bytes x509_svid_key = 3; // ASN.1 DER PKCS#8 private key
+//	  bytes bundle = 4;        // ASN.1 DER CA certificates
+//	  ...
+//	}
+func parseX509SVID(data []byte) (*X509SVID, error) {
+	var id string
+	var chain, key, bundle []byte
+	err := parseFields(data, func(num protowire.Number, value []byte) {
+		switch num {
+		case 1:
+			id = string(value)
+		case 2:
+			chain = value
+		case 3:
+			key = value
+		case 4:
+			bundle = value
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := x509.ParseCertificates(chain)
+	if err != nil {
+		return nil, fmt.Errorf("SVID %q: %w", id, err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("SVID %q: no certificates", id)
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("SVID %q: %w", id, err)
+	}
+	cas, err := x509.ParseCertificates(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("SVID %q: bundle: %w", id, err)
+	}
+	if len(cas) == 0 {
+		return nil, fmt.Errorf("SVID %q: empty bundle", id)
+	}
+	svid := &X509SVID{
+		ID:          id,
+		Certificate: tls.Certificate{PrivateKey: privateKey, Leaf: certs[0]},
+		Bundle:      cas,
+	}
+	for _, cert := range certs {
+		svid.Certificate.Certificate = append(svid.Certificate.Certificate, cert.Raw)
+	}
+	return svid, nil
+}
+
+// parseFields parses the provided protobuf message, calling f with the value
+// of every length-delimited field, i.e., every string, bytes, or message
+// field. Other fields are skipped.
+func parseFields(data []byte, f func(protowire.Number, []byte)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		f(num, value)
+		data = data[n:]
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spiffe
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// newSVIDResponse returns an X509SVIDResponse message holding a newly minted
+// SVID for the provided SPIFFE ID.
+func newSVIDResponse(t *testing.T, id string) []byte {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	ca, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{u},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, caTmpl, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var svid []byte
+	svid = protowire.AppendTag(svid, 1, protowire.BytesType)
+	svid = protowire.AppendString(svid, id)
+	svid = protowire.AppendTag(svid, 2, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, cert)
+	svid = protowire.AppendTag(svid, 3, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, keyDER)
+	svid = protowire.AppendTag(svid, 4, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, ca)
+	var resp []byte
+	resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+	resp = protowire.AppendBytes(resp, svid)
+	return resp
+}
+
+// serve serves a fake Workload API on a Unix socket and returns its address.
+// The fake API streams the provided responses and then fails the stream with
+// the provided gRPC status.
+func serve(t *testing.T, responses [][]byte, code string) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Add("Trailer", "Grpc-Status")
+		w.Header().Add("Trailer", "Grpc-Message")
+		if r.URL.Path != "/SpiffeWorkloadAPI/FetchX509SVID" || r.Header.Get("Workload.spiffe.io") != "true" {
+			w.Header().Set("Grpc-Status", "3")
+			w.Header().Set("Grpc-Message", "bad request")
+			return
+		}
+		for _, resp := range responses {
+			var header [5]byte
+			binary.BigEndian.PutUint32(header[1:], uint32(len(resp)))
+			w.Write(append(header[:], resp...))
+			w.(http.Flusher).Flush()
+		}
+		w.Header().Set("Grpc-Status", code)
+		w.Header().Set("Grpc-Message", "no%20identity")
+	})
+	server := &http.Server{Handler: h2c.NewHandler(handler, &http2.Server{})}
+	go server.Serve(lis)
+	t.Cleanup(func() { server.Close() })
+	return "unix://" + socket
+}
+
+func TestWatchX509SVIDs(t *testing.T) {
+	ids := []string{"spiffe://example.org/a", "spiffe://example.org/b"}
+	addr := serve(t, [][]byte{newSVIDResponse(t, ids[0]), newSVIDResponse(t, ids[1])}, "0")
+	client, err := NewClient(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	err = client.WatchX509SVIDs(context.Background(), func(svid *X509SVID) {
+		got = append(got, svid.ID)
+		if n := len(svid.Certificate.Certificate); n != 1 {
+			t.Errorf("%s: got %d certificates, want 1", svid.ID, n)
+		}
+		if svid.Certificate.PrivateKey == nil {
+			t.Errorf("%s: no private key", svid.ID)
+		}
+		if svid.Certificate.Leaf.URIs[0].String() != svid.ID {
+			t.Errorf("%s: got certificate for %v", svid.ID, svid.Certificate.Leaf.URIs[0])
+		}
+		if _, err := svid.Certificate.Leaf.Verify(x509.VerifyOptions{Roots: pool(svid.Bundle)}); err != nil {
+			t.Errorf("%s: %v", svid.ID, err)
+		}
+	})
+	if err == nil || !strings.Contains(err.Error(), "stream ended") {
+		t.Errorf("WatchX509SVIDs: got %v, want stream ended", err)
+	}
+	if len(got) != len(ids) || got[0] != ids[0] || got[1] != ids[1] {
+		t.Errorf("WatchX509SVIDs: got SVIDs %v, want %v", got, ids)
+	}
+}
+
+func TestWatchX509SVIDsStatus(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		responses [][]byte
+	}{
+		{"NoResponses", nil},
+		{"AfterResponse", [][]byte{newSVIDResponse(t, "spiffe://example.org/a")}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := NewClient(serve(t, test.responses, "7"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = client.WatchX509SVIDs(context.Background(), func(*X509SVID) {})
+			if err == nil || !strings.Contains(err.Error(), "gRPC status 7: no identity") {
+				t.Errorf("WatchX509SVIDs: got %v, want gRPC status 7", err)
+			}
+		})
+	}
+}
+
+func TestWatchX509SVIDsCancel(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake API sends a single SVID and keeps the stream open.
+	resp := newSVIDResponse(t, "spiffe://example.org/a")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		var header [5]byte
+		binary.BigEndian.PutUint32(header[1:], uint32(len(resp)))
+		w.Write(append(header[:], resp...))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	server := &http.Server{Handler: h2c.NewHandler(handler, &http2.Server{})}
+	go server.Serve(lis)
+	defer server.Close()
+
+	client, err := NewClient("unix://" + socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	err = client.WatchX509SVIDs(ctx, func(*X509SVID) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("WatchX509SVIDs: got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	for _, test := range []struct {
+		addr, network, address string
+	}{
+		{"unix:///run/spire/sockets/agent.sock", "unix", "/run/spire/sockets/agent.sock"},
+		{"unix:/run/agent.sock", "unix", "/run/agent.sock"},
+		{"tcp://127.0.0.1:8081", "tcp", "127.0.0.1:8081"},
+	} {
+		network, address, err := parseAddress(test.addr)
+		if err != nil {
+			t.Errorf("parseAddress(%q): %v", test.addr, err)
+			continue
+		}
+		if network != test.network || address != test.address {
+			t.Errorf("parseAddress(%q): got (%q, %q), want (%q, %q)", test.addr, network, address, test.network, test.address)
+		}
+	}
+	for _, addr := range []string{"", "/run/agent.sock", "unix://host/agent.sock", "tcp://127.0.0.1", "tcp://127.0.0.1:8081/path", "http://localhost:80"} {
+		if _, _, err := parseAddress(addr); err == nil {
+			t.Errorf("parseAddress(%q): unexpected success", addr)
+		}
+	}
+}
+
+// pool returns a pool holding the provided certificates.
+func pool(certs []*x509.Certificate) *x509.CertPool {
+	p := x509.NewCertPool()
+	for _, cert := range certs {
+		p.AddCert(cert)
+	}
+	return p
+}
@@ -0,0 +1,271 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	dtool "github.com/ServiceWeaver/weaver/runtime/tool"
+)
+
+// GraphCommand returns a "graph" subcommand that prints the component graph
+// of an application binary. If registry is not nil, the graph can be
+// annotated with the call rates of a deployment registered with registry.
+// tool is the name of the command-line tool the returned subcommand runs as
+// (e.g., "weaver multi").
+func GraphCommand(tool string, registry func(context.Context) (*Registry, error)) *dtool.Command {
+	flags := flag.NewFlagSet("graph", flag.ContinueOnError)
+	format := flags.String("format", "dot", `Output format ("dot" or "svg").`)
+	var deployment *string
+	var window *time.Duration
+	usage := fmt.Sprintf("%s graph [--format=<format>] <binary>", tool)
+	traffic := ""
+	if registry != nil {
+		deployment = flags.String("deployment", "", "Annotate the graph with the call rates of this deployment.")
+		window = flags.Duration("window", 5*time.Second, "Duration over which call rates are measured.")
+		usage = fmt.Sprintf("%s graph [--format=<format>] [--deployment=<deployment>] <binary>", tool)
+		traffic = `
+
+  If --deployment is provided, every edge is labeled with the number of
+  calls per second that the caller made to the callee in the deployment,
+  measured over --window. <deployment> is the id, or a uniquely identifying
+  prefix of the id, of the deployment. Calls that the deployment made but
+  that were not found in the binary are drawn as dashed edges.`
+	}
+	return &dtool.Command{
+		Name:        "graph",
+		Description: "Print the component graph of a Service Weaver application",
+		Help: fmt.Sprintf(`Usage:
+  %s
+
+Flags:
+  -h, --help	Print this help message.
+%s
+
+Description:
+  "%s graph <binary>" prints the component graph of an application
+  binary, in the Graphviz DOT format or, if --format=svg, rendered as an
+  SVG image using the Graphviz "dot" command. The graph has an edge from
+  every component to every component it fetches with weaver.Get. The edges
+  are found by "weaver generate", which attributes a weaver.Get call to the
+  component whose implementation's method makes it, or to the main
+  component if the call is elsewhere in the main package. The binary is run
+  to learn about its components, so it must be runnable on the local
+  machine.%s`, usage, dtool.FlagsHelp(flags), tool, traffic),
+		Flags: flags,
+		Fn: func(ctx context.Context, args []string) error {
+			if len(args) != 1 || args[0] == "" {
+				return fmt.Errorf("usage: %s", usage)
+			}
+			if *format != "dot" && *format != "svg" {
+				return fmt.Errorf("invalid format %q: want \"dot\" or \"svg\"", *format)
+			}
+			g, err := readGraph(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if deployment != nil && *deployment != "" {
+				if *window <= 0 {
+					return fmt.Errorf("invalid non-positive window %v", *window)
+				}
+				reg, err := findDeployment(ctx, registry, *deployment)
+				if err != nil {
+					return err
+				}
+				rates, err := sampleRates(ctx, NewClient(reg.Addr), *window)
+				if err != nil {
+					return err
+				}
+				g.rates = rates
+			}
+
+			var b bytes.Buffer
+			formatDot(&b, g)
+			if *format == "dot" {
+				_, err := io.Copy(os.Stdout, &b)
+				return err
+			}
+			if _, err := exec.LookPath("dot"); err != nil {
+				return fmt.Errorf("--format=svg requires the Graphviz \"dot\" command: %w", err)
+			}
+			cmd := exec.CommandContext(ctx, "dot", "-Tsvg")
+			cmd.Stdin = &b
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			return cmd.Run()
+		},
+	}
+}
+
+// callGraph is the component graph of an application.
+type callGraph struct {
+	components []string              // full component names, in sorted order
+	refs       map[string][]string   // fetched components, by full component name
+	rates      map[graphEdge]float64 // calls per second, or nil if unknown
+}
+
+// graphEdge is an edge from a caller component to a callee component.
+type graphEdge struct {
+	caller    string // full name of the caller component
+	component string // full name of the callee component
+}
+
+// readGraph returns the component graph of the provided application binary.
+func readGraph(ctx context.Context, binary string) (*callGraph, error) {
+	cmd := exec.CommandContext(ctx, binary)
+	cmd.Env = append(os.Environ(), runtime.ComponentGraphKey+"=true")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("read the component graph of %q: %w", binary, err)
+	}
+	return parseGraph(string(out)), nil
+}
+
+// parseGraph parses the component graph printed by an application binary.
+// See runtime.ComponentGraphKey.
+func parseGraph(out string) *callGraph {
+	g := &callGraph{refs: map[string][]string{}}
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		names := strings.Split(line, "\t")
+		g.components = append(g.components, names[0])
+		g.refs[names[0]] = names[1:]
+	}
+	sort.Strings(g.components)
+	return g
+}
+
+// sampleRates returns the number of calls per second between every pair of
+// components of the deployment served by the provided server, measured over
+// the provided window.
+func sampleRates(ctx context.Context, server Server, window time.Duration) (map[graphEdge]float64, error) {
+	before, err := server.Metrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(window):
+	}
+	after, err := server.Metrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return callRates(sampleCalls(before), sampleCalls(after), time.Since(start)), nil
+}
+
+// sampleCalls returns the running totals of the remote calls between every
+// pair of components in the provided metrics.
+func sampleCalls(metrics *Metrics) map[graphEdge]float64 {
+	calls := map[graphEdge]float64{}
+	for _, m := range metrics.Metrics {
+		if m.Name != codegen.MethodCounts.Name() {
+			continue
+		}
+		calls[graphEdge{m.Labels["caller"], m.Labels["component"]}] += m.Value
+	}
+	return calls
+}
+
+// callRates returns the number of calls per second between every pair of
+// components, given the totals sampled elapsed apart.
+func callRates(prev, curr map[graphEdge]float64, elapsed time.Duration) map[graphEdge]float64 {
+	rates := map[graphEdge]float64{}
+	for e, now := range curr {
+		// Totals shrink when replicas that made calls exit.
+		calls := math.Max(now-prev[e], 0)
+		if elapsed > 0 {
+			rates[e] = calls / elapsed.Seconds()
+		}
+	}
+	return rates
+}
+
+// formatDot writes the provided component graph to w in the Graphviz DOT
+// format.
+func formatDot(w io.Writer, g *callGraph) {
+	fmt.Fprintln(w, "digraph {")
+	fmt.Fprintln(w, "  node [shape=box];")
+
+	// Find the edges, including the ones that only show up in traffic.
+	components := map[string]bool{}
+	static := map[graphEdge]bool{}
+	var edges []graphEdge
+	for _, c := range g.components {
+		components[c] = true
+		for _, ref := range g.refs[c] {
+			e := graphEdge{c, ref}
+			static[e] = true
+			edges = append(edges, e)
+		}
+	}
+	for e, rate := range g.rates {
+		if !static[e] && rate > 0 {
+			edges = append(edges, e)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].caller != edges[j].caller {
+			return edges[i].caller < edges[j].caller
+		}
+		return edges[i].component < edges[j].component
+	})
+
+	var nodes []string
+	nodes = append(nodes, g.components...)
+	for _, e := range edges {
+		for _, c := range []string{e.caller, e.component} {
+			if !components[c] {
+				components[c] = true
+				nodes = append(nodes, c)
+			}
+		}
+	}
+	for _, c := range nodes {
+		fmt.Fprintf(w, "  %q [label=%q];\n", c, logging.ShortenComponent(c))
+	}
+	for _, e := range edges {
+		var attrs []string
+		if g.rates != nil {
+			attrs = append(attrs, fmt.Sprintf("label=%q", fmt.Sprintf("%.1f/s", g.rates[e])))
+		}
+		if !static[e] {
+			attrs = append(attrs, "style=dashed")
+		}
+		if len(attrs) == 0 {
+			fmt.Fprintf(w, "  %q -> %q;\n", e.caller, e.component)
+		} else {
+			fmt.Fprintf(w, "  %q -> %q [%s];\n", e.caller, e.component, strings.Join(attrs, ", "))
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
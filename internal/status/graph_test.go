@@ -0,0 +1,74 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	protos "github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormatDot(t *testing.T) {
+	g := parseGraph("main\tapp/A\napp/A\tapp/B\napp/B\n")
+	g.rates = map[graphEdge]float64{
+		{"main", "app/A"}:  2,
+		{"app/B", "app/A"}: 0.5,
+	}
+	var b strings.Builder
+	formatDot(&b, g)
+	want := `digraph {
+  node [shape=box];
+  "app/A" [label="app.A"];
+  "app/B" [label="app.B"];
+  "main" [label="main"];
+  "app/A" -> "app/B" [label="0.0/s"];
+  "app/B" -> "app/A" [label="0.5/s", style=dashed];
+  "main" -> "app/A" [label="2.0/s"];
+}
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("formatDot (-want +got):\n%s", diff)
+	}
+}
+
+func TestCallRates(t *testing.T) {
+	counts := func(caller string, value float64) *protos.MetricSnapshot {
+		return &protos.MetricSnapshot{
+			Name:   codegen.MethodCounts.Name(),
+			Labels: map[string]string{"caller": caller, "component": "app/A"},
+			Value:  value,
+		}
+	}
+	prev := sampleCalls(&Metrics{Metrics: []*protos.MetricSnapshot{
+		counts("main", 10),
+		counts("app/B", 50),
+	}})
+	curr := sampleCalls(&Metrics{Metrics: []*protos.MetricSnapshot{
+		counts("main", 30),
+		counts("app/B", 20), // a replica exited
+	}})
+	got := callRates(prev, curr, 10*time.Second)
+	want := map[graphEdge]float64{
+		{"main", "app/A"}:  2,
+		{"app/B", "app/A"}: 0,
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(graphEdge{})); diff != "" {
+		t.Fatalf("callRates (-want +got):\n%s", diff)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	pprof "github.com/google/pprof/profile"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
 	protos "github.com/ServiceWeaver/weaver/runtime/protos"
 	"github.com/ServiceWeaver/weaver/runtime/tool"
 )
@@ -33,9 +34,10 @@ import (
 // have `weaver profile` wrap `pprof` to make this a single step instead of two.
 
 var (
-	profileFlags    = flag.NewFlagSet("profile", flag.ContinueOnError)
-	profileDuration = profileFlags.Duration("duration", 30*time.Second, "Duration of cpu profiles")
-	profileType     = profileFlags.String("type", "cpu", `Profile type; "cpu" or "heap"`)
+	profileFlags     = flag.NewFlagSet("profile", flag.ContinueOnError)
+	profileDuration  = profileFlags.Duration("duration", 30*time.Second, "Duration of cpu profiles")
+	profileType      = profileFlags.String("type", "cpu", `Profile type; "cpu", "heap", or "goroutine"`)
+	profileComponent = profileFlags.String("component", "", "If non-empty, only profile the replicas hosting this component")
 )
 
 // ProfileCommand returns a "profile" subcommand that gathers pprof profiles.
@@ -54,6 +56,13 @@ Description:
   dashboard'. The id is also printed when the deployment starts. '{{.Tool}}
   profile' writes the profile to a file that can be passed to pprof.
 
+  By default, every process of the deployment is profiled. If --component is
+  provided, only the replicas of the process hosting the component are
+  profiled, and their profiles are merged into a single profile. The
+  component can be named by its full name (e.g.,
+  github.com/example/app/Reverser) or by its short name (e.g., app.Reverser),
+  both of which are shown by '{{.Tool}} status'.
+
 Deployment Ids:
   For convenience, '{{.Tool}} profile' accepts a uniquely identifying prefix
   of a deployment id. For example, consider deployments with the following ids:
@@ -87,8 +96,8 @@ Examples:
 			if prefix == "" {
 				return fmt.Errorf("usage: %s profile [options] <deployment>", toolName)
 			}
-			if *profileType != "cpu" && *profileType != "heap" {
-				return fmt.Errorf("invalid profile type %q; want %q or %q", *profileType, "cpu", "heap")
+			if *profileType != "cpu" && *profileType != "heap" && *profileType != "goroutine" {
+				return fmt.Errorf("invalid profile type %q; want %q, %q, or %q", *profileType, "cpu", "heap", "goroutine")
 			}
 
 			// Get the corresponding deployment id.
@@ -118,20 +127,34 @@ Examples:
 			}
 
 			// Form the profile request.
+			client := NewClient(candidates[0].Addr)
 			req := &protos.RunProfiling{}
-			if *profileType == "heap" {
+			switch *profileType {
+			case "heap":
 				req.ProfileType = protos.ProfileType_Heap
-			} else {
+			case "goroutine":
+				req.ProfileType = protos.ProfileType_Goroutine
+			default:
 				req.ProfileType = protos.ProfileType_CPU
 				req.CpuDurationNs = profileDuration.Nanoseconds()
 			}
+			if *profileComponent != "" {
+				status, err := client.Status(ctx)
+				if err != nil {
+					return fmt.Errorf("get status: %w", err)
+				}
+				process, err := hostingProcess(status, *profileComponent)
+				if err != nil {
+					return err
+				}
+				req.Process = process
+			}
 
 			// Start the profile request.
 			var reply *protos.Profile
 			done := make(chan struct{})
 			go func() {
 				defer close(done)
-				client := NewClient(candidates[0].Addr)
 				reply, err = client.Profile(ctx, req)
 			}()
 
@@ -162,6 +185,10 @@ Examples:
 
 			// Save the profile in a file.
 			name := fmt.Sprintf("serviceweaver_%s_%s_profile_*.pb.gz", reply.AppName, *profileType)
+			if *profileComponent != "" {
+				short := logging.ShortenComponent(*profileComponent)
+				name = fmt.Sprintf("serviceweaver_%s_%s_%s_profile_*.pb.gz", reply.AppName, short, *profileType)
+			}
 			f, err := os.CreateTemp(os.TempDir(), name)
 			if err != nil {
 				return fmt.Errorf("saving profile: %w", err)
@@ -181,6 +208,26 @@ Examples:
 	}
 }
 
+// hostingProcess returns the name of the process that hosts the provided
+// component in the deployment with the provided status. The component may be
+// named by its full name or its short name.
+func hostingProcess(status *Status, component string) (string, error) {
+	var processes []string
+	for _, c := range status.Components {
+		if c.Name == component || logging.ShortenComponent(c.Name) == component {
+			processes = append(processes, c.Process)
+		}
+	}
+	switch len(processes) {
+	case 0:
+		return "", fmt.Errorf("component %q not found", component)
+	case 1:
+		return processes[0], nil
+	default:
+		return "", fmt.Errorf("component name %q is ambiguous; use the full component name", component)
+	}
+}
+
 // spinner prints a spinning progress bar to stderr:
 //
 //	⠏ [8s/10s] Profiling in progress...
@@ -0,0 +1,56 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"testing"
+)
+
+func TestHostingProcess(t *testing.T) {
+	status := &Status{
+		Components: []*Component{
+			{Name: "main", Process: "main"},
+			{Name: "github.com/example/a/Reverser", Process: "github.com/example/a/Reverser"},
+			{Name: "github.com/example/a/Cache", Process: "github.com/example/a/Reverser"},
+			{Name: "github.com/example/b/Reverser", Process: "github.com/example/b/Reverser"},
+			{Name: "github.com/other/b/Reverser", Process: "github.com/other/b/Reverser"},
+		},
+	}
+	for _, test := range []struct {
+		component string
+		want      string
+	}{
+		{"main", "main"},
+		{"github.com/example/a/Cache", "github.com/example/a/Reverser"},
+		{"a.Cache", "github.com/example/a/Reverser"},
+		{"github.com/other/b/Reverser", "github.com/other/b/Reverser"},
+	} {
+		got, err := hostingProcess(status, test.component)
+		if err != nil {
+			t.Errorf("hostingProcess(%q): %v", test.component, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("hostingProcess(%q): got %q, want %q", test.component, got, test.want)
+		}
+	}
+
+	// Ambiguous short names and unknown components are errors.
+	for _, component := range []string{"b.Reverser", "c.Reverser"} {
+		if got, err := hostingProcess(status, component); err == nil {
+			t.Errorf("hostingProcess(%q): got %q, want error", component, got)
+		}
+	}
+}
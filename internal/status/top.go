@@ -0,0 +1,349 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/colors"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	dtool "github.com/ServiceWeaver/weaver/runtime/tool"
+)
+
+// clearScreen moves the cursor to the top left corner of the terminal and
+// clears the screen.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// alertColor is the color of unhealthy statistics.
+var alertColor = colors.Color256(1) // red
+
+// TopCommand returns a "top" subcommand that shows live statistics of the
+// components of a deployment registered with the provided registry,
+// refreshing them in place. tool is the name of the command-line tool the
+// returned subcommand runs as (e.g., "weaver multi").
+func TopCommand(tool string, registry func(context.Context) (*Registry, error)) *dtool.Command {
+	flags := flag.NewFlagSet("top", flag.ContinueOnError)
+	interval := flags.Duration("interval", 2*time.Second, "Refresh interval.")
+	return &dtool.Command{
+		Name:        "top",
+		Description: "Show live statistics of a Service Weaver application",
+		Help: fmt.Sprintf(`Usage:
+  %s top [--interval=<duration>] <deployment>
+
+Flags:
+  -h, --help	Print this help message.
+%s
+
+Description:
+  "%s top <deployment>" shows, for every component of a deployment, the
+  number of healthy replicas, the number of method calls per second, the
+  fraction of calls that failed, and the median and 99th percentile latency
+  of the calls, refreshing them in place. Rates and latencies are computed
+  over the last refresh interval, and only count remote calls. <deployment>
+  is the id, or a uniquely identifying prefix of the id, of the deployment.
+  Hit Ctrl+C to exit.`, tool, dtool.FlagsHelp(flags), tool),
+		Flags: flags,
+		Fn: func(ctx context.Context, args []string) error {
+			if len(args) != 1 || args[0] == "" {
+				return fmt.Errorf("usage: %s top [--interval=<duration>] <deployment>", tool)
+			}
+			if *interval <= 0 {
+				return fmt.Errorf("invalid non-positive interval %v", *interval)
+			}
+			reg, err := findDeployment(ctx, registry, args[0])
+			if err != nil {
+				return err
+			}
+			return top(ctx, os.Stdout, NewClient(reg.Addr), *interval)
+		},
+	}
+}
+
+// findDeployment returns the registration of the deployment, registered with
+// the provided registry, whose id starts with the provided prefix.
+func findDeployment(ctx context.Context, registry func(context.Context) (*Registry, error), prefix string) (Registration, error) {
+	r, err := registry(ctx)
+	if err != nil {
+		return Registration{}, err
+	}
+	regs, err := r.List(ctx)
+	if err != nil {
+		return Registration{}, err
+	}
+	var candidates []Registration
+	for _, reg := range regs {
+		if strings.HasPrefix(reg.DeploymentId, prefix) {
+			candidates = append(candidates, reg)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return Registration{}, fmt.Errorf("no deployment with prefix %q found", prefix)
+	case 1:
+		return candidates[0], nil
+	default:
+		return Registration{}, fmt.Errorf("multiple deployments with prefix %q found", prefix)
+	}
+}
+
+// top repeatedly writes the statistics of the deployment served by the
+// provided server to w, every interval, until ctx is cancelled.
+func top(ctx context.Context, w io.Writer, server Server, interval time.Duration) error {
+	fmt.Fprint(w, clearScreen, "Collecting statistics...\n")
+	prev, err := sampleTop(ctx, server)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		curr, err := sampleTop(ctx, server)
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		b.WriteString(clearScreen)
+		formatTop(&b, curr.status, topRows(prev, curr))
+		fmt.Fprint(w, b.String())
+		prev = curr
+	}
+}
+
+// topSample is a sample of the statistics of a deployment.
+type topSample struct {
+	time       time.Time
+	status     *Status
+	components map[string]*callTotals // totals, by full component name
+}
+
+// callTotals are the running totals of the remote calls to a component.
+type callTotals struct {
+	calls   float64
+	errors  float64
+	bounds  []float64 // latency histogram bounds, in microseconds
+	latency []uint64  // latency histogram counts
+}
+
+// topRow holds the statistics of a component, as shown by top.
+type topRow struct {
+	component string        // full component name
+	replicas  int           // number of replicas
+	healthy   int           // number of healthy replicas
+	qps       float64       // calls per second
+	errorRate float64       // fraction of failed calls
+	p50, p99  time.Duration // latency percentiles
+}
+
+// sampleTop samples the statistics of the deployment served by the provided
+// server.
+func sampleTop(ctx context.Context, server Server) (*topSample, error) {
+	status, err := server.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := server.Metrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &topSample{
+		time:       time.Now(),
+		status:     status,
+		components: sampleMetrics(metrics),
+	}, nil
+}
+
+// sampleMetrics returns the running totals of the remote calls to every
+// component, by full component name, in the provided metrics.
+func sampleMetrics(metrics *Metrics) map[string]*callTotals {
+	components := map[string]*callTotals{}
+	for _, m := range metrics.Metrics {
+		component := m.Labels["component"]
+		totals, ok := components[component]
+		if !ok {
+			totals = &callTotals{}
+			components[component] = totals
+		}
+		switch m.Name {
+		case codegen.MethodCounts.Name():
+			totals.calls += m.Value
+		case codegen.MethodErrors.Name():
+			totals.errors += m.Value
+		case codegen.MethodLatencies.Name():
+			if totals.latency == nil {
+				totals.bounds = m.Bounds
+				totals.latency = make([]uint64, len(m.Counts))
+			}
+			for i, count := range m.Counts {
+				if i < len(totals.latency) {
+					totals.latency[i] += count
+				}
+			}
+		}
+	}
+	return components
+}
+
+// topRows returns the statistics of the components of a deployment between
+// the two provided samples.
+func topRows(prev, curr *topSample) []topRow {
+	elapsed := curr.time.Sub(prev.time).Seconds()
+	var rows []topRow
+	for _, c := range curr.status.Components {
+		row := topRow{component: c.Name, replicas: len(c.Pids)}
+		for _, pid := range c.Pids {
+			if alive(int(pid)) {
+				row.healthy++
+			}
+		}
+		now, ok := curr.components[c.Name]
+		if !ok {
+			rows = append(rows, row)
+			continue
+		}
+		before, ok := prev.components[c.Name]
+		if !ok {
+			before = &callTotals{}
+		}
+		// Totals shrink when replicas that made calls exit.
+		calls := math.Max(now.calls-before.calls, 0)
+		errors := math.Max(now.errors-before.errors, 0)
+		if elapsed > 0 {
+			row.qps = calls / elapsed
+		}
+		if calls > 0 {
+			row.errorRate = math.Min(errors/calls, 1)
+		}
+		latency := make([]uint64, len(now.latency))
+		for i, count := range now.latency {
+			if i < len(before.latency) && before.latency[i] < count {
+				latency[i] = count - before.latency[i]
+			} else if i >= len(before.latency) {
+				latency[i] = count
+			}
+		}
+		row.p50 = micros(percentile(now.bounds, latency, 0.5))
+		row.p99 = micros(percentile(now.bounds, latency, 0.99))
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].component < rows[j].component
+	})
+	return rows
+}
+
+// percentile returns an estimate of the qth quantile, for q between 0 and 1,
+// of the values in the provided histogram, interpolating linearly within
+// buckets. It returns 0 if the histogram is empty.
+func percentile(bounds []float64, counts []uint64, q float64) float64 {
+	var total uint64
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var seen float64
+	for i, count := range counts {
+		if count == 0 || seen+float64(count) < rank {
+			seen += float64(count)
+			continue
+		}
+		// The ith bucket holds values in the range [bounds[i-1], bounds[i]).
+		lo := 0.0
+		if i > 0 {
+			lo = bounds[i-1]
+		}
+		if i >= len(bounds) {
+			// The last bucket is unbounded.
+			return lo
+		}
+		return lo + (bounds[i]-lo)*(rank-seen)/float64(count)
+	}
+	return bounds[len(bounds)-1]
+}
+
+// micros converts microseconds to a duration.
+func micros(x float64) time.Duration {
+	return time.Duration(x * float64(time.Microsecond))
+}
+
+// alive returns whether the process with the provided pid is running on the
+// local machine.
+func alive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// formatTop pretty-prints the provided statistics of the deployment with the
+// provided status.
+func formatTop(w io.Writer, status *Status, rows []topRow) {
+	prefix, suffix := formatId(status.DeploymentId)
+	title := []colors.Text{
+		{{S: status.App, Bold: true}, {S: " "}, prefix, suffix},
+		{{S: time.Now().Format("15:04:05")}},
+	}
+	t := colors.NewTabularizer(w, title, colors.NoDim)
+	defer t.Flush()
+	t.Row("COMPONENT", "REPLICAS", "QPS", "ERRORS", "P50", "P99")
+	for _, row := range rows {
+		replicas := colors.Atom{S: fmt.Sprintf("%d/%d", row.healthy, row.replicas)}
+		if row.healthy < row.replicas {
+			replicas.Color = alertColor
+		}
+		errors := colors.Atom{S: fmt.Sprintf("%.1f%%", 100*row.errorRate)}
+		if row.errorRate > 0 {
+			errors.Color = alertColor
+		}
+		t.Row(
+			logging.ShortenComponent(row.component),
+			replicas,
+			fmt.Sprintf("%.1f", row.qps),
+			errors,
+			formatLatency(row.p50),
+			formatLatency(row.p99),
+		)
+	}
+}
+
+// formatLatency pretty-prints a latency.
+func formatLatency(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "-"
+	case d < time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	default:
+		return d.Round(100 * time.Microsecond).String()
+	}
+}
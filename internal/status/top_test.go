@@ -0,0 +1,84 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	protos "github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPercentile(t *testing.T) {
+	bounds := []float64{10, 20, 50}
+	for _, test := range []struct {
+		name   string
+		counts []uint64
+		q      float64
+		want   float64
+	}{
+		{"empty", []uint64{0, 0, 0, 0}, 0.5, 0},
+		{"first bucket", []uint64{10, 0, 0, 0}, 0.5, 5},
+		{"second bucket", []uint64{0, 4, 0, 0}, 0.25, 12.5},
+		{"spanning buckets", []uint64{5, 5, 0, 0}, 0.9, 18},
+		{"unbounded bucket", []uint64{0, 0, 0, 3}, 0.99, 50},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := percentile(bounds, test.counts, test.q)
+			if math.Abs(got-test.want) > 1e-9 {
+				t.Fatalf("percentile(%v, %v, %v): got %v, want %v", bounds, test.counts, test.q, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTopRows(t *testing.T) {
+	const component = "github.com/example/app/Cache"
+	labels := map[string]string{"caller": "main", "component": component, "method": "Get"}
+	metrics := func(calls, errors float64, latency []uint64) *Metrics {
+		return &Metrics{Metrics: []*protos.MetricSnapshot{
+			{Name: codegen.MethodCounts.Name(), Labels: labels, Value: calls},
+			{Name: codegen.MethodErrors.Name(), Labels: labels, Value: errors},
+			{Name: codegen.MethodLatencies.Name(), Labels: labels, Bounds: []float64{1000, 2000}, Counts: latency},
+		}}
+	}
+	status := &Status{Components: []*Component{
+		{Name: component, Pids: []int64{int64(os.Getpid())}},
+	}}
+
+	start := time.Now()
+	prev := &topSample{time: start, status: status}
+	prev.components = sampleMetrics(metrics(100, 10, []uint64{100, 0, 0}))
+	curr := &topSample{time: start.Add(2 * time.Second), status: status}
+	curr.components = sampleMetrics(metrics(300, 30, []uint64{100, 200, 0}))
+
+	want := []topRow{{
+		component: component,
+		replicas:  1,
+		healthy:   1,
+		qps:       100,
+		errorRate: 0.1,
+		p50:       1500 * time.Microsecond,
+		p99:       1990 * time.Microsecond,
+	}}
+	got := topRows(prev, curr)
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(topRow{})); diff != "" {
+		t.Fatalf("topRows (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package compose implements the "weaver compose" deployer, which runs a
+// Service Weaver application with Docker Compose. "weaver compose generate"
+// emits a docker-compose.yml file with one container for every colocation
+// group, plus a controller container that coordinates them. Unlike
+// "weaver multi", the weavelets communicate over a container network and run
+// from a container image, like they do in production.
+package compose
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/ServiceWeaver/weaver/internal/status"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+)
+
+var (
+	// logDir is where weaver compose deployed applications store their logs.
+	// The directory is mounted into every container, at the same path.
+	logDir = filepath.Join(logging.DefaultLogDir, "weaver_compose")
+
+	Commands = map[string]*tool.Command{
+		"generate": &generateCmd,
+		"logs":     tool.LogsCmd(&logsSpec),
+
+		// Hidden commands.
+		"controller": &controllerCmd,
+		"babysitter": &babysitterCmd,
+	}
+)
+
+var logsSpec = tool.LogsSpec{
+	Tool: "weaver compose",
+	Source: func(context.Context) (logging.Source, error) {
+		return logging.FileSource(logDir), nil
+	},
+}
+
+// registry returns the registry of weaver compose deployments, inside the
+// controller container.
+func registry(ctx context.Context) (*status.Registry, error) {
+	dir, err := status.DefaultRegistryDir()
+	if err != nil {
+		return nil, err
+	}
+	return status.NewRegistry(ctx, filepath.Join(dir, "compose_registry"))
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ServiceWeaver/weaver/internal/tool/ssh/impl"
+	"github.com/ServiceWeaver/weaver/runtime/colors"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+)
+
+var controllerCmd = tool.Command{
+	Name:        "controller",
+	Description: "The weaver compose controller",
+	Help: `Usage:
+  weaver compose controller <group>...
+
+Flags:
+  -h, --help   Print this help message.`,
+	Fn: runController,
+}
+
+// runController runs the manager of the deployment stored in
+// impl.DeploymentKey.
+// The given colocation groups are the ones run by the other containers.
+func runController(ctx context.Context, args []string) error {
+	dep, err := impl.DeploymentFromEnv()
+	if err != nil {
+		return err
+	}
+
+	addr := fmt.Sprintf("%s:%d", controllerHost, controllerPort)
+	stopFn, err := impl.RunManager(ctx, dep, addr, impl.StaticLauncher(args), logDir, nil, registry)
+	if err != nil {
+		return fmt.Errorf("cannot instantiate the manager: %w", err)
+	}
+
+	// Stop when the container is stopped.
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-done
+		if err := stopFn(); err != nil {
+			fmt.Fprintf(os.Stderr, "stop the manager: %v\n", err)
+		}
+		os.Exit(0)
+	}()
+
+	// Follow the logs, so that they show up in "docker compose logs".
+	source := logging.FileSource(logDir)
+	query := fmt.Sprintf(`full_version == %q && !("serviceweaver/system" in attrs)`, dep.Id)
+	r, err := source.Query(ctx, query, true)
+	if err != nil {
+		return err
+	}
+	pp := logging.NewPrettyPrinter(colors.Enabled())
+	for {
+		entry, err := r.Read(ctx)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fmt.Println(pp.Format(entry))
+	}
+}
+
+var babysitterCmd = tool.Command{
+	Name:        "babysitter",
+	Description: "The weaver compose babysitter",
+	Help: `Usage:
+  weaver compose babysitter
+
+Flags:
+  -h, --help   Print this help message.`,
+	Fn: func(ctx context.Context, _ []string) error {
+		info, err := impl.BabysitterInfoFromEnv()
+		if err != nil {
+			return err
+		}
+		return impl.RunBabysitter(ctx, info)
+	},
+}
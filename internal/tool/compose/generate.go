@@ -0,0 +1,315 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package compose
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/ServiceWeaver/weaver/internal/proto"
+	"github.com/ServiceWeaver/weaver/internal/tool/ssh/impl"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+	"github.com/google/uuid"
+)
+
+const (
+	// controllerHost and controllerPort are the address of the controller on
+	// the Docker Compose network.
+	controllerHost = "controller"
+	controllerPort = 9000
+
+	// binDir is the directory of the container image that holds the
+	// binaries.
+	binDir = "/weaver"
+)
+
+var (
+	generateFlags = flag.NewFlagSet("generate", flag.ContinueOnError)
+	outDir        = generateFlags.String("o", "compose", "Output directory")
+
+	generateCmd = tool.Command{
+		Name:        "generate",
+		Description: "Generate a Docker Compose project for a Service Weaver app",
+		Help: `Usage:
+  weaver compose generate [-o <dir>] <configfile>...
+
+Flags:
+  -h, --help   Print this help message.
+  -o           Output directory (default "compose").
+
+"weaver compose generate" writes a docker-compose.yml file, a Dockerfile, and
+the binaries it needs into the output directory. Run the application with:
+
+  docker compose --project-directory <dir> up --build`,
+		Flags: generateFlags,
+		Fn:    generate,
+	}
+)
+
+// composeConfig is the [compose] section of a config file.
+type composeConfig struct {
+	// Image is the name of the container image. Defaults to the name of the
+	// application.
+	Image string `toml:"image"`
+
+	// Ports are the ports published by the container of every colocation
+	// group, keyed by group name, either in full or shortened (e.g.,
+	// "main" or "hello.Reverser"). Every port uses the Docker Compose syntax,
+	// e.g., "8080:8080".
+	Ports map[string][]string `toml:"ports"`
+}
+
+// service is a Docker Compose service.
+type service struct {
+	Name    string
+	Command []string
+	Env     map[string]string
+	Ports   []string
+	Group   string // colocation group, or empty for the controller
+}
+
+// project is a Docker Compose project.
+type project struct {
+	App      string
+	Image    string
+	Binary   string // base name of the application binary
+	LogDir   string
+	Services []*service
+}
+
+// generate generates a Docker Compose project for an application.
+func generate(ctx context.Context, args []string) error {
+	// Validate command line arguments.
+	if len(args) == 0 {
+		return fmt.Errorf("no config file provided")
+	}
+	// Load the config files.
+	app, err := runtime.LoadConfig(args, codegen.ComponentConfigValidator)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	config, err := parseComposeConfig(app)
+	if err != nil {
+		return err
+	}
+
+	// Sanity check the config.
+	if _, err := os.Stat(app.Binary); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("binary %q doesn't exist", app.Binary)
+	}
+
+	// Find the colocation groups.
+	groups, err := impl.ColocationGroups(ctx, app.Binary, app.SameProcess)
+	if err != nil {
+		return err
+	}
+
+	// Write the project.
+	weaver, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	for _, bin := range []struct{ src, dst string }{
+		{weaver, "weaver"},
+		{app.Binary, filepath.Base(app.Binary)},
+	} {
+		if err := copyFile(bin.src, filepath.Join(*outDir, bin.dst)); err != nil {
+			return fmt.Errorf("copy %q: %w", bin.src, err)
+		}
+	}
+
+	dep := &protos.Deployment{Id: uuid.New().String(), App: app}
+	p, err := newProject(dep, config, groups)
+	if err != nil {
+		return err
+	}
+	for file, tmpl := range map[string]*template.Template{
+		"Dockerfile":         dockerfileTmpl,
+		"docker-compose.yml": composeTmpl,
+	} {
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, p); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(*outDir, file), b.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Wrote a Docker Compose project for %s to %s. Run it with:\n\n", app.Name, *outDir)
+	fmt.Printf("  docker compose --project-directory %s up --build\n", *outDir)
+	return nil
+}
+
+// parseComposeConfig parses the [compose] section of the given config,
+// filling in defaults for unspecified fields.
+func parseComposeConfig(app *protos.AppConfig) (*composeConfig, error) {
+	// Compose config as found in TOML config file.
+	const composeKey = "github.com/ServiceWeaver/weaver/compose"
+	const shortComposeKey = "compose"
+
+	config := &composeConfig{}
+	if err := runtime.ParseConfigSection(composeKey, shortComposeKey, app.Sections, config); err != nil {
+		return nil, fmt.Errorf("unable to parse compose config: %w", err)
+	}
+	if config.Image == "" {
+		config.Image = serviceName(app.Name)
+	}
+	return config, nil
+}
+
+// newProject returns the Docker Compose project that runs the given
+// colocation groups of the given deployment.
+func newProject(dep *protos.Deployment, config *composeConfig, groups []string) (*project, error) {
+	binary := filepath.Base(dep.App.Binary)
+	dep.App.Binary = filepath.Join(binDir, binary)
+	env, err := proto.ToEnv(dep)
+	if err != nil {
+		return nil, err
+	}
+	p := &project{
+		App:    dep.App.Name,
+		Image:  config.Image,
+		Binary: binary,
+		LogDir: logDir,
+		Services: []*service{{
+			Name:    controllerHost,
+			Command: append([]string{"controller"}, groups...),
+			Env:     map[string]string{impl.DeploymentKey: env},
+		}},
+	}
+
+	names := map[string]bool{controllerHost: true}
+	for _, group := range groups {
+		name := serviceName(logging.ShortenComponent(group))
+		for i := 2; names[name]; i++ {
+			name = fmt.Sprintf("%s-%d", serviceName(logging.ShortenComponent(group)), i)
+		}
+		names[name] = true
+
+		info := &impl.BabysitterInfo{
+			ManagerAddr: fmt.Sprintf("http://%s:%d", controllerHost, controllerPort),
+			Deployment:  dep,
+			Group:       &protos.ColocationGroup{Name: group},
+			LogDir:      logDir,
+		}
+		env, err := proto.ToEnv(info)
+		if err != nil {
+			return nil, err
+		}
+		ports := config.Ports[group]
+		if ports == nil {
+			ports = config.Ports[logging.ShortenComponent(group)]
+		}
+		p.Services = append(p.Services, &service{
+			Name:    name,
+			Command: []string{"babysitter"},
+			Env:     map[string]string{impl.BabysitterInfoKey: env},
+			Ports:   ports,
+			Group:   group,
+		})
+	}
+	return p, nil
+}
+
+// invalidServiceChars matches the characters that are replaced in service
+// names.
+var invalidServiceChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// serviceName returns a valid Docker Compose service name for s, e.g.,
+// "hello-reverser" for "hello.Reverser".
+func serviceName(s string) string {
+	return strings.Trim(invalidServiceChars.ReplaceAllString(strings.ToLower(s), "-"), "-_")
+}
+
+// copyFile copies the executable file src to dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// quote returns s as a double-quoted YAML string.
+func quote(s string) (string, error) {
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+var dockerfileTmpl = template.Must(template.New("Dockerfile").Parse(`# Code generated by "weaver compose generate". DO NOT EDIT.
+FROM ubuntu:rolling
+COPY weaver {{.Binary}} ` + binDir + `/
+ENTRYPOINT ["` + binDir + `/weaver", "compose"]
+`))
+
+var composeTmpl = template.Must(template.New("docker-compose.yml").Funcs(template.FuncMap{
+	"quote": quote,
+}).Parse(`# Code generated by "weaver compose generate". DO NOT EDIT.
+name: {{quote .Image}}
+services:
+{{- range .Services}}
+  {{.Name}}:
+    {{- if .Group}}
+    # Colocation group {{.Group}}.
+    {{- else}}
+    # Controller of application {{$.App}}.
+    {{- end}}
+    build: .
+    image: {{quote $.Image}}
+    hostname: {{.Name}}
+    command: [{{range $i, $arg := .Command}}{{if $i}}, {{end}}{{quote $arg}}{{end}}]
+    environment:
+    {{- range $k, $v := .Env}}
+      {{$k}}: {{quote $v}}
+    {{- end}}
+    volumes:
+      - {{quote (printf "%s:%s" $.LogDir $.LogDir)}}
+    {{- if .Group}}
+    depends_on:
+      - controller
+    {{- end}}
+    {{- if .Ports}}
+    ports:
+    {{- range .Ports}}
+      - {{quote .}}
+    {{- end}}
+    {{- end}}
+{{- end}}
+`))
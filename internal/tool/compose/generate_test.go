@@ -0,0 +1,94 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package compose
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/internal/proto"
+	"github.com/ServiceWeaver/weaver/internal/tool/ssh/impl"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServiceName(t *testing.T) {
+	for _, test := range []struct{ in, want string }{
+		{"main", "main"},
+		{"hello.Reverser", "hello-reverser"},
+		{"My App!", "my-app"},
+	} {
+		if got := serviceName(test.in); got != test.want {
+			t.Errorf("serviceName(%q): got %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestNewProject(t *testing.T) {
+	dep := &protos.Deployment{
+		Id:  "1a2b3c4d-0000-0000-0000-000000000000",
+		App: &protos.AppConfig{Name: "hello", Binary: "/path/to/hello"},
+	}
+	config := &composeConfig{
+		Image: "hello",
+		Ports: map[string][]string{"main": {"8080:8080"}},
+	}
+	groups := []string{"a/hello/Reverser", "b/hello/Reverser", "main"}
+	p, err := newProject(dep, config, groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, s := range p.Services {
+		names = append(names, s.Name)
+	}
+	if diff := cmp.Diff([]string{"controller", "hello-reverser", "hello-reverser-2", "main"}, names); diff != "" {
+		t.Errorf("service names (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(append([]string{"controller"}, groups...), p.Services[0].Command); diff != "" {
+		t.Errorf("controller command (-want +got):\n%s", diff)
+	}
+
+	main := p.Services[3]
+	if diff := cmp.Diff([]string{"8080:8080"}, main.Ports); diff != "" {
+		t.Errorf("ports (-want +got):\n%s", diff)
+	}
+	info := &impl.BabysitterInfo{}
+	if err := proto.FromEnv(main.Env[impl.BabysitterInfoKey], info); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.ManagerAddr, "http://controller:9000"; got != want {
+		t.Errorf("manager address: got %q, want %q", got, want)
+	}
+	if got, want := info.Deployment.App.Binary, "/weaver/hello"; got != want {
+		t.Errorf("binary: got %q, want %q", got, want)
+	}
+
+	var b bytes.Buffer
+	if err := composeTmpl.Execute(&b, p); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"  controller:\n",
+		"  hello-reverser-2:\n    # Colocation group b/hello/Reverser.\n",
+		`    command: ["controller", "a/hello/Reverser", "b/hello/Reverser", "main"]`,
+		"    ports:\n      - \"8080:8080\"\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("docker-compose.yml does not contain %q:\n%s", want, b.String())
+		}
+	}
+}
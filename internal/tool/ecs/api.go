@@ -0,0 +1,111 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ecs
+
+// Tags of the ECS services of a deployment.
+const (
+	appTag        = "serviceweaver/app"
+	deploymentTag = "serviceweaver/deployment"
+)
+
+// The subset of the inputs of the AWS APIs used by the deployer. See
+// https://docs.aws.amazon.com/AmazonECS/latest/APIReference and
+// https://docs.aws.amazon.com/cloud-map/latest/api for details.
+type (
+	taskDefinitionInput struct {
+		Family                  string                 `json:"family"`
+		RequiresCompatibilities []string               `json:"requiresCompatibilities"`
+		NetworkMode             string                 `json:"networkMode"`
+		CPU                     string                 `json:"cpu"`
+		Memory                  string                 `json:"memory"`
+		ExecutionRoleARN        string                 `json:"executionRoleArn"`
+		TaskRoleARN             string                 `json:"taskRoleArn,omitempty"`
+		ContainerDefinitions    []*containerDefinition `json:"containerDefinitions"`
+	}
+
+	containerDefinition struct {
+		Name             string            `json:"name"`
+		Image            string            `json:"image"`
+		Essential        bool              `json:"essential"`
+		Command          []string          `json:"command"`
+		Environment      []keyValue        `json:"environment"`
+		PortMappings     []portMapping     `json:"portMappings,omitempty"`
+		LogConfiguration *logConfiguration `json:"logConfiguration"`
+	}
+
+	keyValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+
+	portMapping struct {
+		ContainerPort int `json:"containerPort"`
+	}
+
+	logConfiguration struct {
+		LogDriver string            `json:"logDriver"`
+		Options   map[string]string `json:"options"`
+	}
+
+	serviceInput struct {
+		Cluster              string               `json:"cluster"`
+		ServiceName          string               `json:"serviceName"`
+		TaskDefinition       string               `json:"taskDefinition"`
+		DesiredCount         int                  `json:"desiredCount"`
+		LaunchType           string               `json:"launchType"`
+		NetworkConfiguration networkConfiguration `json:"networkConfiguration"`
+		ServiceRegistries    []serviceRegistry    `json:"serviceRegistries"`
+		Tags                 []tag                `json:"tags"`
+	}
+
+	networkConfiguration struct {
+		AWSVPCConfiguration awsVPCConfiguration `json:"awsvpcConfiguration"`
+	}
+
+	awsVPCConfiguration struct {
+		Subnets        []string `json:"subnets"`
+		SecurityGroups []string `json:"securityGroups,omitempty"`
+		AssignPublicIP string   `json:"assignPublicIp"`
+	}
+
+	serviceRegistry struct {
+		RegistryARN string `json:"registryArn"`
+	}
+
+	tag struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+
+	discoveryServiceInput struct {
+		Name                    string                   `json:"Name"`
+		NamespaceID             string                   `json:"NamespaceId"`
+		DNSConfig               dnsConfig                `json:"DnsConfig"`
+		HealthCheckCustomConfig *healthCheckCustomConfig `json:"HealthCheckCustomConfig,omitempty"`
+	}
+
+	dnsConfig struct {
+		RoutingPolicy string      `json:"RoutingPolicy"`
+		DNSRecords    []dnsRecord `json:"DnsRecords"`
+	}
+
+	dnsRecord struct {
+		Type string `json:"Type"`
+		TTL  int    `json:"TTL"`
+	}
+
+	healthCheckCustomConfig struct {
+		FailureThreshold int `json:"FailureThreshold"`
+	}
+)
@@ -0,0 +1,109 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/tool/ssh/impl"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var controllerCmd = tool.Command{
+	Name:        "controller",
+	Description: "The weaver ecs controller",
+	Help: `Usage:
+  weaver ecs controller <group>...
+
+Flags:
+  -h, --help   Print this help message.`,
+	Fn: runController,
+}
+
+// runController runs the manager of the deployment stored in
+// impl.DeploymentKey. The given colocation groups are the ones run by the
+// other ECS services of the deployment.
+func runController(ctx context.Context, args []string) error {
+	dep, err := impl.DeploymentFromEnv()
+	if err != nil {
+		return err
+	}
+	logDir, err := os.MkdirTemp("", "weaver_ecs")
+	if err != nil {
+		return err
+	}
+	addr := fmt.Sprintf(":%d", controllerPort)
+	stopFn, err := impl.RunManager(ctx, dep, addr, impl.StaticLauncher(args), logDir, nil, impl.DefaultRegistry)
+	if err != nil {
+		return fmt.Errorf("cannot instantiate the manager: %w", err)
+	}
+
+	// Stop when the task is stopped.
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-done
+		if err := stopFn(); err != nil {
+			fmt.Fprintf(os.Stderr, "stop the manager: %v\n", err)
+		}
+		os.Exit(0)
+	}()
+
+	// Write the logs to stdout, one JSON encoded entry per line, so that they
+	// are sent to CloudWatch Logs and can be read by "weaver ecs logs".
+	source := logging.FileSource(logDir)
+	r, err := source.Query(ctx, fmt.Sprintf("full_version == %q", dep.Id), true)
+	if err != nil {
+		return err
+	}
+	for {
+		entry, err := r.Read(ctx)
+		if err != nil {
+			return err
+		}
+		b, err := protojson.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	}
+}
+
+var babysitterCmd = tool.Command{
+	Name:        "babysitter",
+	Description: "The weaver ecs babysitter",
+	Help: `Usage:
+  weaver ecs babysitter
+
+Flags:
+  -h, --help   Print this help message.`,
+	Fn: func(ctx context.Context, _ []string) error {
+		info, err := impl.BabysitterInfoFromEnv()
+		if err != nil {
+			return err
+		}
+		// ECS doesn't number the tasks of a service. Pick a random replica
+		// id, so that the metrics of different replicas are kept apart.
+		info.ReplicaId = rand.New(rand.NewSource(time.Now().UnixNano())).Int31()
+		return impl.RunBabysitter(ctx, info)
+	},
+}
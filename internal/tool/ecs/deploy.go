@@ -0,0 +1,440 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ServiceWeaver/weaver/internal/proto"
+	"github.com/ServiceWeaver/weaver/internal/tool/ssh/impl"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+	"github.com/google/uuid"
+)
+
+var deployCmd = tool.Command{
+	Name:        "deploy",
+	Description: "Deploy a Service Weaver app",
+	Help:        "Usage:\n  weaver ecs deploy <configfile>...",
+	Flags:       flag.NewFlagSet("deploy", flag.ContinueOnError),
+	Fn:          deploy,
+}
+
+// ecsConfig is the [ecs] section of a config file.
+type ecsConfig struct {
+	// Cluster is the name of the ECS cluster in which to run the application.
+	Cluster string `toml:"cluster"`
+
+	// Repository is the URI of the ECR repository to which the container
+	// image of the application is pushed, e.g.,
+	// "123456789012.dkr.ecr.us-east-1.amazonaws.com/hello".
+	Repository string `toml:"repository"`
+
+	// Subnets and SecurityGroups are the subnets and security groups of the
+	// tasks. The security groups must allow traffic between the tasks.
+	Subnets        []string `toml:"subnets"`
+	SecurityGroups []string `toml:"security_groups"`
+
+	// AssignPublicIP specifies whether the tasks get a public IP address.
+	AssignPublicIP bool `toml:"assign_public_ip"`
+
+	// NamespaceID is the id of the AWS Cloud Map private DNS namespace in
+	// which the services of the application are registered.
+	NamespaceID string `toml:"namespace_id"`
+
+	// ExecutionRoleARN is the task execution role, which must be allowed to
+	// pull the image and write logs. TaskRoleARN is the optional role of the
+	// application.
+	ExecutionRoleARN string `toml:"execution_role_arn"`
+	TaskRoleARN      string `toml:"task_role_arn"`
+
+	// CPU (in CPU units) and Memory (in MiB) are the resources of every task.
+	// They default to 256 and 512.
+	CPU    int `toml:"cpu"`
+	Memory int `toml:"memory"`
+
+	// Replicas is the number of replicas of every colocation group, keyed by
+	// group name, either in full or shortened (e.g., "collatz.Main"). Groups
+	// not listed have a single replica.
+	Replicas map[string]int `toml:"replicas"`
+}
+
+// replicas returns the number of replicas of the given colocation group.
+func (c *ecsConfig) replicas(group string) int {
+	if n, ok := c.Replicas[group]; ok {
+		return n
+	}
+	if n, ok := c.Replicas[logging.ShortenComponent(group)]; ok {
+		return n
+	}
+	return 1
+}
+
+// deploy deploys an application on Amazon ECS.
+func deploy(ctx context.Context, args []string) error {
+	// Validate command line arguments.
+	if len(args) == 0 {
+		return fmt.Errorf("no config file provided")
+	}
+	// Load the config files.
+	app, config, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+
+	// Sanity check the config.
+	if _, err := os.Stat(app.Binary); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("binary %q doesn't exist", app.Binary)
+	}
+
+	// Find the colocation groups.
+	groups, err := impl.ColocationGroups(ctx, app.Binary, app.SameProcess)
+	if err != nil {
+		return err
+	}
+
+	// Create a deployment.
+	dep := &protos.Deployment{
+		Id:  uuid.New().String(),
+		App: app,
+	}
+	d := &deployer{config: config, run: execRunner}
+	region, err := d.region(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Build and push the container image.
+	image, err := d.pushImage(ctx, dep)
+	if err != nil {
+		return err
+	}
+
+	// Create the ECS services.
+	if err := d.createLogGroup(ctx); err != nil {
+		return err
+	}
+	if err := d.deploy(ctx, dep, groups, image, region); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deployed %s version %s.\n\n", app.Name, dep.Id)
+	fmt.Printf("  Follow the logs with:  weaver ecs logs --follow 'version==%q'\n", logging.Shorten(dep.Id))
+	fmt.Printf("  Kill the app with:     weaver ecs kill %s\n", strings.Join(args, " "))
+	return nil
+}
+
+// loadConfig loads the application config and the [ecs] section of the given
+// config files.
+func loadConfig(files []string) (*protos.AppConfig, *ecsConfig, error) {
+	app, err := runtime.LoadConfig(files, codegen.ComponentConfigValidator)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load config: %w", err)
+	}
+
+	// ECS config as found in TOML config file.
+	const ecsKey = "github.com/ServiceWeaver/weaver/ecs"
+	const shortECSKey = "ecs"
+
+	config := &ecsConfig{}
+	if err := runtime.ParseConfigSection(ecsKey, shortECSKey, app.Sections, config); err != nil {
+		return nil, nil, fmt.Errorf("unable to parse ecs config: %w", err)
+	}
+	for key, val := range map[string]string{
+		"cluster":            config.Cluster,
+		"repository":         config.Repository,
+		"namespace_id":       config.NamespaceID,
+		"execution_role_arn": config.ExecutionRoleARN,
+	} {
+		if val == "" {
+			return nil, nil, fmt.Errorf("ecs config: missing %s", key)
+		}
+	}
+	if len(config.Subnets) == 0 {
+		return nil, nil, fmt.Errorf("ecs config: missing subnets")
+	}
+	if config.CPU == 0 {
+		config.CPU = 256
+	}
+	if config.Memory == 0 {
+		config.Memory = 512
+	}
+	for group, n := range config.Replicas {
+		if n <= 0 {
+			return nil, nil, fmt.Errorf("ecs config: invalid number of replicas %d for group %q", n, group)
+		}
+	}
+	return app, config, nil
+}
+
+// deployer creates the AWS resources of a deployment.
+type deployer struct {
+	config *ecsConfig
+	run    runner
+}
+
+// aws runs the aws command line tool with the given arguments and decodes its
+// JSON output into out, if not nil. If input is not nil, it is passed to the
+// tool as its JSON input.
+func (d *deployer) aws(ctx context.Context, out any, input any, args ...string) error {
+	if input != nil {
+		b, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--cli-input-json", string(b))
+	}
+	args = append(args, "--output", "json")
+	b, err := d.run(ctx, nil, "aws", args...)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+// region returns the AWS region, as configured for the aws tool.
+func (d *deployer) region(ctx context.Context) (string, error) {
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(env); region != "" {
+			return region, nil
+		}
+	}
+	out, err := d.run(ctx, nil, "aws", "configure", "get", "region")
+	if region := strings.TrimSpace(string(out)); err == nil && region != "" {
+		return region, nil
+	}
+	return "", fmt.Errorf("no AWS region configured; set AWS_REGION")
+}
+
+// pushImage builds the container image of the deployment, pushes it to the
+// ECR repository, and returns its name.
+func (d *deployer) pushImage(ctx context.Context, dep *protos.Deployment) (string, error) {
+	dir, err := os.MkdirTemp("", "weaver_ecs")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	weaver, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	binary := filepath.Base(dep.App.Binary)
+	for _, bin := range []struct{ src, dst string }{
+		{weaver, "weaver"},
+		{dep.App.Binary, binary},
+	} {
+		if err := copyFile(bin.src, filepath.Join(dir, bin.dst)); err != nil {
+			return "", fmt.Errorf("copy %q: %w", bin.src, err)
+		}
+	}
+	dockerfile := fmt.Sprintf(`FROM ubuntu:rolling
+COPY weaver %s %s/
+ENTRYPOINT ["%s/weaver", "ecs"]
+`, binary, binDir, binDir)
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		return "", err
+	}
+
+	image := fmt.Sprintf("%s:%s", d.config.Repository, dep.Id)
+	if _, err := d.run(ctx, nil, "docker", "build", "--platform", "linux/amd64", "-t", image, dir); err != nil {
+		return "", err
+	}
+	password, err := d.run(ctx, nil, "aws", "ecr", "get-login-password")
+	if err != nil {
+		return "", err
+	}
+	registry, _, _ := strings.Cut(d.config.Repository, "/")
+	if _, err := d.run(ctx, password, "docker", "login", "--username", "AWS", "--password-stdin", registry); err != nil {
+		return "", err
+	}
+	if _, err := d.run(ctx, nil, "docker", "push", image); err != nil {
+		return "", err
+	}
+	return image, nil
+}
+
+// createLogGroup creates the CloudWatch Logs log group, if it doesn't exist.
+func (d *deployer) createLogGroup(ctx context.Context) error {
+	err := d.aws(ctx, nil, nil, "logs", "create-log-group", "--log-group-name", logGroup)
+	if err != nil && !strings.Contains(err.Error(), "ResourceAlreadyExistsException") {
+		return err
+	}
+	return nil
+}
+
+// deploy creates an ECS service for the controller and for every colocation
+// group of the deployment, all running the given image.
+func (d *deployer) deploy(ctx context.Context, dep *protos.Deployment, groups []string, image, region string) error {
+	var namespace struct{ Namespace struct{ Name string } }
+	if err := d.aws(ctx, &namespace, nil, "servicediscovery", "get-namespace", "--id", d.config.NamespaceID); err != nil {
+		return err
+	}
+
+	dep.App.Binary = filepath.Join(binDir, filepath.Base(dep.App.Binary))
+	env, err := proto.ToEnv(dep)
+	if err != nil {
+		return err
+	}
+	controller := serviceName(dep, "controller")
+	if err := d.createService(ctx, dep, controller, image, region, 1, &containerDefinition{
+		Name:         "controller",
+		Command:      append([]string{"controller"}, groups...),
+		Environment:  []keyValue{{Name: impl.DeploymentKey, Value: env}},
+		PortMappings: []portMapping{{ContainerPort: controllerPort}},
+	}); err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		info := &impl.BabysitterInfo{
+			ManagerAddr: fmt.Sprintf("http://%s.%s:%d", controller, namespace.Namespace.Name, controllerPort),
+			Deployment:  dep,
+			Group:       &protos.ColocationGroup{Name: group},
+		}
+		env, err := proto.ToEnv(info)
+		if err != nil {
+			return err
+		}
+		name := serviceName(dep, logging.ShortenComponent(group))
+		if err := d.createService(ctx, dep, name, image, region, d.config.replicas(group), &containerDefinition{
+			Name:        "babysitter",
+			Command:     []string{"babysitter"},
+			Environment: []keyValue{{Name: impl.BabysitterInfoKey, Value: env}},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createService creates an ECS service with the given name and number of
+// tasks, running the given container, and registers it with AWS Cloud Map
+// under the same name.
+func (d *deployer) createService(ctx context.Context, dep *protos.Deployment, name, image, region string, count int, container *containerDefinition) error {
+	// Register the service with AWS Cloud Map.
+	var registry struct{ Service struct{ Arn string } }
+	if err := d.aws(ctx, &registry, &discoveryServiceInput{
+		Name:        name,
+		NamespaceID: d.config.NamespaceID,
+		DNSConfig: dnsConfig{
+			RoutingPolicy: "MULTIVALUE",
+			DNSRecords:    []dnsRecord{{Type: "A", TTL: 10}},
+		},
+		HealthCheckCustomConfig: &healthCheckCustomConfig{FailureThreshold: 1},
+	}, "servicediscovery", "create-service"); err != nil {
+		return fmt.Errorf("register service %q: %w", name, err)
+	}
+
+	// Register the task definition.
+	container.Image = image
+	container.Essential = true
+	container.LogConfiguration = &logConfiguration{
+		LogDriver: "awslogs",
+		Options: map[string]string{
+			"awslogs-group":         logGroup,
+			"awslogs-region":        region,
+			"awslogs-stream-prefix": name,
+		},
+	}
+	var task struct{ TaskDefinition struct{ TaskDefinitionArn string } }
+	if err := d.aws(ctx, &task, &taskDefinitionInput{
+		Family:                  name,
+		RequiresCompatibilities: []string{"FARGATE"},
+		NetworkMode:             "awsvpc",
+		CPU:                     fmt.Sprint(d.config.CPU),
+		Memory:                  fmt.Sprint(d.config.Memory),
+		ExecutionRoleARN:        d.config.ExecutionRoleARN,
+		TaskRoleARN:             d.config.TaskRoleARN,
+		ContainerDefinitions:    []*containerDefinition{container},
+	}, "ecs", "register-task-definition"); err != nil {
+		return fmt.Errorf("register task definition %q: %w", name, err)
+	}
+
+	// Create the service.
+	assignPublicIP := "DISABLED"
+	if d.config.AssignPublicIP {
+		assignPublicIP = "ENABLED"
+	}
+	if err := d.aws(ctx, nil, &serviceInput{
+		Cluster:        d.config.Cluster,
+		ServiceName:    name,
+		TaskDefinition: task.TaskDefinition.TaskDefinitionArn,
+		DesiredCount:   count,
+		LaunchType:     "FARGATE",
+		NetworkConfiguration: networkConfiguration{
+			AWSVPCConfiguration: awsVPCConfiguration{
+				Subnets:        d.config.Subnets,
+				SecurityGroups: d.config.SecurityGroups,
+				AssignPublicIP: assignPublicIP,
+			},
+		},
+		ServiceRegistries: []serviceRegistry{{RegistryARN: registry.Service.Arn}},
+		Tags: []tag{
+			{Key: appTag, Value: dep.App.Name},
+			{Key: deploymentTag, Value: dep.Id},
+		},
+	}, "ecs", "create-service"); err != nil {
+		return fmt.Errorf("create service %q: %w", name, err)
+	}
+	return nil
+}
+
+// invalidNameChars matches the characters that are replaced in service names.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// serviceName returns the name of the ECS and AWS Cloud Map service that runs
+// the given part of a deployment, e.g., "collatz-main-1a2b3c4d". The name is a
+// valid DNS label.
+func serviceName(dep *protos.Deployment, part string) string {
+	name := strings.ToLower(fmt.Sprintf("%s-%s", dep.App.Name, part))
+	name = strings.Trim(invalidNameChars.ReplaceAllString(name, "-"), "-")
+	if len(name) > 54 {
+		name = strings.TrimRight(name[:54], "-")
+	}
+	return fmt.Sprintf("%s-%s", name, logging.Shorten(dep.Id))
+}
+
+// copyFile copies the executable file src to dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/internal/proto"
+	"github.com/ServiceWeaver/weaver/internal/tool/ssh/impl"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+// fakeAWS is a fake aws command line tool. It records the commands it runs
+// and replies with canned outputs.
+type fakeAWS struct {
+	commands []string          // e.g., "ecs create-service"
+	inputs   map[string][]byte // --cli-input-json, keyed by name of the resource
+	outputs  map[string]string // output, keyed by command
+}
+
+func (f *fakeAWS) run(_ context.Context, _ []byte, name string, args ...string) ([]byte, error) {
+	if name != "aws" || len(args) < 2 {
+		return nil, fmt.Errorf("unexpected command %s %v", name, args)
+	}
+	command := args[0] + " " + args[1]
+	f.commands = append(f.commands, command)
+	for i, arg := range args {
+		if arg == "--cli-input-json" {
+			var input struct {
+				Name, Family, ServiceName string
+			}
+			if err := json.Unmarshal([]byte(args[i+1]), &input); err != nil {
+				return nil, err
+			}
+			f.inputs[command+" "+input.Name+input.Family+input.ServiceName] = []byte(args[i+1])
+		}
+	}
+	return []byte(f.outputs[command]), nil
+}
+
+func TestDeploy(t *testing.T) {
+	fake := &fakeAWS{
+		inputs: map[string][]byte{},
+		outputs: map[string]string{
+			"servicediscovery get-namespace":  `{"Namespace": {"Name": "weaver.local"}}`,
+			"servicediscovery create-service": `{"Service": {"Arn": "arn:srv"}}`,
+			"ecs register-task-definition":    `{"taskDefinition": {"taskDefinitionArn": "arn:task"}}`,
+			"ecs create-service":              `{}`,
+		},
+	}
+	d := &deployer{
+		config: &ecsConfig{
+			Cluster:          "cluster",
+			Subnets:          []string{"subnet-1"},
+			NamespaceID:      "ns-1",
+			ExecutionRoleARN: "arn:role",
+			CPU:              256,
+			Memory:           512,
+			Replicas:         map[string]int{"hello.Reverser": 2},
+		},
+		run: fake.run,
+	}
+	dep := &protos.Deployment{
+		Id:  "1a2b3c4d-0000-0000-0000-000000000000",
+		App: &protos.AppConfig{Name: "hello", Binary: "/path/to/hello"},
+	}
+	groups := []string{"github.com/ServiceWeaver/weaver/examples/hello/Reverser", "main"}
+	if err := d.deploy(context.Background(), dep, groups, "repo:tag", "us-east-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"servicediscovery get-namespace"}
+	for i := 0; i < 3; i++ {
+		want = append(want, "servicediscovery create-service", "ecs register-task-definition", "ecs create-service")
+	}
+	if diff := cmp.Diff(want, fake.commands); diff != "" {
+		t.Fatalf("commands (-want +got):\n%s", diff)
+	}
+
+	// Check the controller.
+	var controller taskDefinitionInput
+	if err := json.Unmarshal(fake.inputs["ecs register-task-definition hello-controller-1a2b3c4d"], &controller); err != nil {
+		t.Fatal(err)
+	}
+	c := controller.ContainerDefinitions[0]
+	if diff := cmp.Diff(append([]string{"controller"}, groups...), c.Command); diff != "" {
+		t.Errorf("controller command (-want +got):\n%s", diff)
+	}
+	got := &protos.Deployment{}
+	if err := proto.FromEnv(c.Environment[0].Value, got); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.App.Binary, "/weaver/hello"; got != want {
+		t.Errorf("binary: got %q, want %q", got, want)
+	}
+
+	// Check a colocation group.
+	var service serviceInput
+	if err := json.Unmarshal(fake.inputs["ecs create-service hello-hello-reverser-1a2b3c4d"], &service); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := service.DesiredCount, 2; got != want {
+		t.Errorf("desired count: got %d, want %d", got, want)
+	}
+	if got, want := service.ServiceRegistries, []serviceRegistry{{RegistryARN: "arn:srv"}}; !cmp.Equal(got, want) {
+		t.Errorf("service registries: got %v, want %v", got, want)
+	}
+	var babysitter taskDefinitionInput
+	if err := json.Unmarshal(fake.inputs["ecs register-task-definition hello-hello-reverser-1a2b3c4d"], &babysitter); err != nil {
+		t.Fatal(err)
+	}
+	info := &impl.BabysitterInfo{}
+	if err := proto.FromEnv(babysitter.ContainerDefinitions[0].Environment[0].Value, info); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.ManagerAddr, "http://hello-controller-1a2b3c4d.weaver.local:9000"; got != want {
+		t.Errorf("manager address: got %q, want %q", got, want)
+	}
+}
+
+func TestKill(t *testing.T) {
+	fake := &fakeAWS{
+		inputs: map[string][]byte{},
+		outputs: map[string]string{
+			"ecs list-services": `{"serviceArns": ["arn:a", "arn:b"]}`,
+			"ecs describe-services": `{"services": [
+				{"serviceName": "a", "taskDefinition": "arn:task", "serviceRegistries": [{"registryArn": "arn:aws:servicediscovery:us-east-1:1:service/srv-1"}], "tags": [{"key": "serviceweaver/app", "value": "hello"}]},
+				{"serviceName": "b", "tags": [{"key": "serviceweaver/app", "value": "other"}]}
+			]}`,
+		},
+	}
+	d := &deployer{config: &ecsConfig{Cluster: "cluster"}, run: fake.run}
+	if err := d.kill(context.Background(), "hello"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ecs list-services",
+		"ecs describe-services",
+		"ecs delete-service",
+		"servicediscovery delete-service",
+		"ecs deregister-task-definition",
+	}
+	if diff := cmp.Diff(want, fake.commands); diff != "" {
+		t.Fatalf("commands (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	entry := &protos.LogEntry{App: "hello", Version: "v1", Msg: "hi", Attrs: []string{"a", "b"}}
+	b, err := protojson.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := parseLine("2023-03-01T12:00:00 " + string(b))
+	if !ok {
+		t.Fatal("parseLine: unexpected failure")
+	}
+	if diff := cmp.Diff(entry, got, protocmp.Transform()); diff != "" {
+		t.Errorf("parseLine (-want +got):\n%s", diff)
+	}
+	for _, line := range []string{"", "2023-03-01T12:00:00 babysitter started", "2023-03-01T12:00:00 {bad"} {
+		if _, ok := parseLine(line); ok {
+			t.Errorf("parseLine(%q): unexpected success", line)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package ecs implements the "weaver ecs" deployer, which runs a Service
+// Weaver application on Amazon ECS, using AWS Fargate.
+//
+// Every colocation group is run as an ECS service, alongside a controller
+// service that runs the manager of the deployment. The services are
+// registered with AWS Cloud Map, so that the babysitters can find the
+// controller, and the logs of the application are sent to Amazon CloudWatch
+// Logs. The deployer uses the aws and docker command line tools, which must be
+// installed and configured.
+package ecs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+)
+
+const (
+	// logGroup is the CloudWatch Logs log group of all applications.
+	logGroup = "/serviceweaver"
+
+	// controllerPort is the port on which the controller listens.
+	controllerPort = 9000
+
+	// binDir is the directory of the container image that holds the
+	// binaries.
+	binDir = "/weaver"
+)
+
+var Commands = map[string]*tool.Command{
+	"deploy": &deployCmd,
+	"logs":   tool.LogsCmd(&logsSpec),
+	"kill":   &killCmd,
+
+	// Hidden commands.
+	"controller": &controllerCmd,
+	"babysitter": &babysitterCmd,
+}
+
+// A runner runs the named command with the given arguments and standard
+// input, and returns its standard output.
+type runner func(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error)
+
+// execRunner is a runner that runs commands as subprocesses.
+func execRunner(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ecs
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+)
+
+var killCmd = tool.Command{
+	Name:        "kill",
+	Description: "Kill a Service Weaver app",
+	Help: `Usage:
+  weaver ecs kill <configfile>...
+
+Flags:
+  -h, --help   Print this help message.
+
+Description:
+  "weaver ecs kill" deletes the ECS services of all deployments of the
+  application in the provided config file, along with their AWS Cloud Map
+  services and task definitions.`,
+	Flags: flag.NewFlagSet("kill", flag.ContinueOnError),
+	Fn:    kill,
+}
+
+// kill kills all the deployments of an application.
+func kill(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no config file provided")
+	}
+	app, config, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+	d := &deployer{config: config, run: execRunner}
+	return d.kill(ctx, app.Name)
+}
+
+// ecsService is the subset of an ECS service's description used by kill.
+type ecsService struct {
+	ServiceName       string            `json:"serviceName"`
+	TaskDefinition    string            `json:"taskDefinition"`
+	ServiceRegistries []serviceRegistry `json:"serviceRegistries"`
+	Tags              []tag             `json:"tags"`
+}
+
+// kill deletes the AWS resources of all deployments of the given application.
+func (d *deployer) kill(ctx context.Context, app string) error {
+	var list struct {
+		ServiceArns []string `json:"serviceArns"`
+	}
+	if err := d.aws(ctx, &list, nil, "ecs", "list-services", "--cluster", d.config.Cluster); err != nil {
+		return err
+	}
+
+	// Find the services of the application. describe-services accepts at
+	// most 10 services at a time.
+	var services []ecsService
+	for len(list.ServiceArns) > 0 {
+		n := len(list.ServiceArns)
+		if n > 10 {
+			n = 10
+		}
+		args := []string{"ecs", "describe-services", "--cluster", d.config.Cluster, "--include", "TAGS", "--services"}
+		args = append(args, list.ServiceArns[:n]...)
+		list.ServiceArns = list.ServiceArns[n:]
+		var desc struct {
+			Services []ecsService `json:"services"`
+		}
+		if err := d.aws(ctx, &desc, nil, args...); err != nil {
+			return err
+		}
+		for _, s := range desc.Services {
+			for _, t := range s.Tags {
+				if t.Key == appTag && t.Value == app {
+					services = append(services, s)
+				}
+			}
+		}
+	}
+	if len(services) == 0 {
+		return fmt.Errorf("no deployments of %s found in cluster %s", app, d.config.Cluster)
+	}
+
+	for _, s := range services {
+		if err := d.aws(ctx, nil, nil, "ecs", "delete-service", "--cluster", d.config.Cluster, "--service", s.ServiceName, "--force"); err != nil {
+			return err
+		}
+		// The AWS Cloud Map service and task definition can only be deleted
+		// once the tasks are stopped. Leaked resources are harmless, so we
+		// only warn if we fail to delete them.
+		for _, r := range s.ServiceRegistries {
+			if err := d.aws(ctx, nil, nil, "servicediscovery", "delete-service", "--id", path.Base(r.RegistryARN)); err != nil {
+				fmt.Fprintf(os.Stderr, "WARNING: delete AWS Cloud Map service of %s: %v\n", s.ServiceName, err)
+			}
+		}
+		if err := d.aws(ctx, nil, nil, "ecs", "deregister-task-definition", "--task-definition", s.TaskDefinition); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: deregister task definition of %s: %v\n", s.ServiceName, err)
+		}
+		fmt.Printf("Deleted %s\n", s.ServiceName)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ecs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var logsSpec = tool.LogsSpec{
+	Tool: "weaver ecs",
+	Source: func(context.Context) (logging.Source, error) {
+		return cloudWatchSource{}, nil
+	},
+}
+
+// cloudWatchSource is a logging.Source that reads the log entries written by
+// the controllers to CloudWatch Logs, using "aws logs tail".
+type cloudWatchSource struct{}
+
+var _ logging.Source = cloudWatchSource{}
+
+// Query implements the logging.Source interface.
+func (cloudWatchSource) Query(ctx context.Context, q logging.Query, follow bool) (logging.Reader, error) {
+	match, err := logging.Matcher(q)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"logs", "tail", logGroup, "--format", "short", "--since", "30d"}
+	if follow {
+		args = append(args, "--follow")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, "aws", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("aws logs tail: %w", err)
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, 1<<20)
+	return &cloudWatchReader{cmd: cmd, cancel: cancel, scanner: scanner, match: match}, nil
+}
+
+// cloudWatchReader is the logging.Reader returned by cloudWatchSource.
+type cloudWatchReader struct {
+	cmd     *exec.Cmd
+	cancel  context.CancelFunc
+	scanner *bufio.Scanner
+	match   func(*protos.LogEntry) (bool, error)
+	closed  bool
+}
+
+var _ logging.Reader = &cloudWatchReader{}
+
+// Read implements the logging.Reader interface.
+func (r *cloudWatchReader) Read(ctx context.Context) (*protos.LogEntry, error) {
+	if r.closed {
+		return nil, fmt.Errorf("closed")
+	}
+	for r.scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		entry, ok := parseLine(r.scanner.Text())
+		if !ok {
+			// Not a log entry written by a controller.
+			continue
+		}
+		matches, err := r.match(entry)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			return entry, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("aws logs tail: %w", err)
+	}
+	return nil, io.EOF
+}
+
+// Close implements the logging.Reader interface.
+func (r *cloudWatchReader) Close() {
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.cancel()
+	r.cmd.Wait()
+}
+
+// parseLine parses a line printed by "aws logs tail --format short", which
+// consists of a timestamp followed by the log message, into a log entry.
+func parseLine(line string) (*protos.LogEntry, bool) {
+	_, msg, ok := strings.Cut(line, " ")
+	if !ok || !strings.HasPrefix(msg, "{") {
+		return nil, false
+	}
+	entry := &protos.LogEntry{}
+	if err := protojson.Unmarshal([]byte(msg), entry); err != nil {
+		return nil, false
+	}
+	return entry, true
+}
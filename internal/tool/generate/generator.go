@@ -25,6 +25,7 @@ import (
 	"go/types"
 	"io"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -46,7 +47,18 @@ const (
 	Usage = `Generate code for a Service Weaver application.
 
 Usage:
-  weaver generate [packages]
+  weaver generate [-watch] [-fakes] [-schema] [packages]
+
+Flags:
+  -watch  Keep running, and regenerate the code for a package whenever one
+          of its Go files changes.
+  -fakes  Also generate a configurable fake, named FakeFoo, for every
+          component interface Foo. Fakes record their calls, return
+          scripted results, and call per-method hooks. They can be used in
+          tests with weavertest.Fake.
+  -schema Also write a machine-readable description of every component
+          interface, method signature, and serializable type, in JSON, to
+          a weaver_schema.json file next to the weaver_gen.go file.
 
 Description:
   "weaver generate" generates code for the Service Weaver applications in the provided
@@ -78,7 +90,16 @@ Examples:
   weaver generate ./foo
 
   # Generate code for all packages in all subdirectories of current directory.
-  weaver generate ./...`
+  weaver generate ./...
+
+  # Same as above, and regenerate the code as the packages change.
+  weaver generate -watch ./...
+
+  # Generate code, including fakes, for the package in the current directory.
+  weaver generate -fakes
+
+  # Generate code, and a schema, for the package in the current directory.
+  weaver generate -schema`
 )
 
 // ErrorList holds a list of errors.
@@ -92,10 +113,21 @@ func (list ErrorList) Error() string {
 	return b.String()
 }
 
+// Options configures Generate.
+type Options struct {
+	// If true, a fake is generated for every component interface. See
+	// Usage for details.
+	Fakes bool
+
+	// If true, the schema of every package is written to a
+	// weaver_schema.json file. See Usage for details.
+	Schema bool
+}
+
 // Generate generates Service Weaver code for the specified packages.
 // The list of supplied packages are treated similarly to the arguments
 // passed to "go build" (see "go help packages" for details).
-func Generate(dir string, pkgs []string) error {
+func Generate(dir string, pkgs []string, opt Options) error {
 	fset := token.NewFileSet()
 	cfg := &packages.Config{
 		Mode:      packages.NeedName | packages.NeedSyntax | packages.NeedImports | packages.NeedTypes | packages.NeedTypesInfo,
@@ -116,6 +148,8 @@ func Generate(dir string, pkgs []string) error {
 			tset:    newTypeSet(p, &automarshals, &typeutil.Map{}),
 			fileset: fset,
 			errors:  nil,
+			fakes:   opt.Fakes,
+			schema:  opt.Schema,
 		}
 		g.processPackage(p)
 		errs = append(errs, g.errors...)
@@ -141,10 +175,13 @@ type generator struct {
 	tset           *typeSet
 	fileset        *token.FileSet
 	errors         []error
+	fakes          bool // generate fakes; see Options.Fakes
+	schema         bool // generate a schema; see Options.Schema
 	components     []*component
-	types          []types.Type // all types that need to be serialized
-	sizeFuncNeeded typeutil.Map // types that need a serviceweaver_size_* function
-	generated      typeutil.Map // memo cache for generateEncDecMethodsFor
+	refs           map[string]map[string]bool // components fetched with weaver.Get, by caller
+	types          []types.Type               // all types that need to be serialized
+	sizeFuncNeeded typeutil.Map               // types that need a serviceweaver_size_* function
+	generated      typeutil.Map               // memo cache for generateEncDecMethodsFor
 }
 
 func (g *generator) addError(pos token.Pos, err error) {
@@ -206,7 +243,17 @@ func (g *generator) processPackage(pkg *packages.Package) {
 		g.findComponents(f)
 	}
 
-	if len(g.errors) == 0 && len(g.components)+g.tset.automarshalCandidates.Len() > 0 {
+	// Find the components fetched by every component. This has to be done
+	// after all components have been found.
+	for _, f := range pkg.Syntax {
+		fname := g.fileset.Position(f.Package).Filename
+		if filepath.Base(fname) == generatedCodeFile {
+			continue
+		}
+		g.findRefs(f)
+	}
+
+	if len(g.errors) == 0 && len(g.components)+len(g.refs)+g.tset.automarshalCandidates.Len() > 0 {
 		g.generate()
 	}
 }
@@ -234,6 +281,106 @@ func (g *generator) findComponents(f *ast.File) {
 	}
 }
 
+// findRefs records the components fetched with weaver.Get in the provided
+// file. A weaver.Get call in a method of a component implementation is
+// attributed to that component. Other calls are attributed to the "main"
+// component if the file belongs to the main package, and ignored otherwise.
+func (g *generator) findRefs(f *ast.File) {
+	for _, d := range f.Decls {
+		fn, ok := d.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		caller := g.caller(fn)
+		if caller == "" {
+			continue
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if ref, ok := g.getRef(call); ok {
+				if g.refs == nil {
+					g.refs = map[string]map[string]bool{}
+				}
+				if g.refs[caller] == nil {
+					g.refs[caller] = map[string]bool{}
+				}
+				g.refs[caller][ref] = true
+			}
+			return true
+		})
+	}
+}
+
+// caller returns the full name of the component that the weaver.Get calls in
+// the provided function are attributed to, or "" if there is none.
+func (g *generator) caller(fn *ast.FuncDecl) string {
+	if fn.Recv != nil && len(fn.Recv.List) == 1 {
+		recv := fn.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = star.X
+		}
+		if ident, ok := recv.(*ast.Ident); ok {
+			for _, comp := range g.components {
+				if comp.implName == ident.Name {
+					return comp.fullName
+				}
+			}
+		}
+	}
+	if g.pkg.Name == "main" {
+		return "main"
+	}
+	return ""
+}
+
+// getRef returns the full name of the component fetched by the provided call,
+// if it is a call to weaver.Get, or to weaver.Lazy or weaver.Optional, which
+// return references to a component.
+func (g *generator) getRef(call *ast.CallExpr) (string, bool) {
+	index, ok := call.Fun.(*ast.IndexExpr)
+	if !ok {
+		return "", false
+	}
+	var ident *ast.Ident
+	switch x := index.X.(type) {
+	case *ast.Ident:
+		ident = x // e.g., Get[Foo] with a dot import
+	case *ast.SelectorExpr:
+		ident = x.Sel // e.g., weaver.Get[Foo]
+	default:
+		return "", false
+	}
+	fn, ok := g.pkg.TypesInfo.Uses[ident].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != weaverPackagePath {
+		return "", false
+	}
+	switch fn.Name() {
+	case "Get", "Lazy", "Optional":
+	default:
+		return "", false
+	}
+	n, ok := g.typeof(index.Index).(*types.Named)
+	if !ok || n.Obj().Pkg() == nil {
+		return "", false
+	}
+	if _, ok := n.Underlying().(*types.Interface); !ok {
+		return "", false
+	}
+	// Qualify the name the way it is qualified in the package that declares
+	// the component. See processComponentImplementation.
+	pkg := n.Obj().Pkg()
+	name := types.TypeString(n, func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Name()
+	})
+	return filepath.Join(pkg.Path(), name), true
+}
+
 // findAutoMarshals returns the types in the provided file which embed the
 // weaver.AutoMarshal struct.
 func (g *generator) findAutoMarshals(f *ast.File) []*types.Named {
@@ -310,6 +457,17 @@ func (g *generator) findAutoMarshals(f *ast.File) []*types.Named {
 				continue
 			}
 
+			if _, err := fieldNumbers(t); err != nil {
+				g.errorf(pos, "type %v: %w", g.tset.typeString(n), err)
+				continue
+			}
+
+			// Types with their own serialization methods opt out of the
+			// generated ones. The code generator calls their methods instead.
+			if g.tset.implementsAutoMarshal(n) || g.tset.hasMarshalBinary(n) {
+				continue
+			}
+
 			automarshals = append(automarshals, n)
 		}
 	}
@@ -402,10 +560,20 @@ func (g *generator) processComponentImplementation(file *ast.File, spec ast.Spec
 		return
 	}
 
+	// A component interface may be an instantiation of a generic interface,
+	// e.g., Store[Item]. Every instantiation is a distinct component.
+	name := g.tset.typeString(componentType)
+	ident := componentType.Obj().Name()
+	if componentType.TypeArgs().Len() > 0 {
+		hash := sha256.Sum256([]byte(uniqueName(componentType)))
+		ident = fmt.Sprintf("%s_%x", ident, hash[:4])
+	}
 	comp := &component{
-		name:      componentType.Obj().Name(),
+		name:      name,
+		ident:     ident,
+		intfType:  g.tset.genTypeString(componentType),
 		pos:       spec.Pos(),
-		fullName:  filepath.Join(componentType.Obj().Pkg().Path(), componentType.Obj().Name()),
+		fullName:  filepath.Join(componentType.Obj().Pkg().Path(), name),
 		implName:  implName,
 		intf:      componentType.Underlying().(*types.Interface),
 		file:      file,
@@ -424,17 +592,22 @@ func (g *generator) processComponentImplementation(file *ast.File, spec ast.Spec
 }
 
 type component struct {
-	name          string           // component interface name
+	name          string           // component interface name, e.g., Foo or Store[Item]
+	ident         string           // identifier derived from name, used to name generated code
+	intfType      string           // component interface type, as written in generated code
 	pos           token.Pos        // Location of component implementation
 	fullName      string           // package-prefixed component interface name
 	implName      string           // name of the component implementation type
 	intf          *types.Interface // component's interface type
 	file          *ast.File        // file that contains component's implementation
 	methods       []*types.Func
-	router        *types.Named    // router type for the component, or nil if there is no router.
-	hasConfig     bool            // True iff implementation contains a weaver.WithConfig field.
-	routingKey    types.Type      // routing key, or nil if there is no router.
-	routedMethods map[string]bool // the set of methods with a routing function
+	router        *types.Named      // router type for the component, or nil if there is no router.
+	hasConfig     bool              // True iff implementation contains a weaver.WithConfig field.
+	routingKey    types.Type        // routing key, or nil if there is no router.
+	routedMethods map[string]bool   // the set of methods with a routing function
+	httpRoutes    map[string]string // method -> HTTP route, from //weaver:http annotations
+	graphQL       map[string]string // method -> GraphQL field, from //weaver:graphql annotations
+	kafka         map[string]string // method -> Kafka binding, from //weaver:kafka annotations
 }
 
 // processMethods fills in the method information for the given component.
@@ -507,6 +680,11 @@ func (g *generator) processMethods(comp *component) {
 	comp.routingKey = routingKey
 	comp.routedMethods = routedMethods
 
+	// Find HTTP routes, GraphQL fields, and Kafka bindings.
+	comp.httpRoutes = g.httpRoutes(comp)
+	comp.graphQL = g.graphQLFields(comp)
+	comp.kafka = g.kafkaBindings(comp)
+
 	// Sort into deterministic order.
 	loc := func(pos token.Pos) (string, int) {
 		p := g.fileset.Position(pos)
@@ -619,8 +797,12 @@ func (g *generator) generate() {
 		g.generateClientStubs(fn)
 		g.generateServerStubs(fn)
 		g.generateAutoMarshalMethods(fn)
+		g.generateSerializableRegistrations(fn)
 		g.generateRouterMethods(fn)
 		g.generateEncDecMethods(fn)
+		if g.fakes {
+			g.generateFakes(fn)
+		}
 
 		// append the size methods
 		if g.sizeFuncNeeded.Len() > 0 {
@@ -675,6 +857,164 @@ func (g *generator) generate() {
 	if err := dst.Close(); err != nil {
 		g.errors = append(g.errors, err)
 	}
+
+	if g.schema {
+		g.generateSchema()
+	}
+}
+
+// httpRoutes returns the HTTP routes of the methods of the provided
+// component, declared by annotations in the doc comments of the methods of
+// the component interface. For example:
+//
+//	type Catalog interface {
+//		//weaver:http GET /products/{id}
+//		Get(ctx context.Context, id string) (Product, error)
+//	}
+//
+// A route is an HTTP method followed by a path. Every path parameter must be
+// the name of a parameter of the method.
+func (g *generator) httpRoutes(comp *component) map[string]string {
+	return g.annotations(comp, "http", func(route string, sig *types.Signature) error {
+		return checkHTTPRoute(route, sig)
+	})
+}
+
+// graphQLFields returns the GraphQL fields of the methods of the provided
+// component, declared by annotations in the doc comments of the methods of
+// the component interface. For example:
+//
+//	type Catalog interface {
+//		//weaver:graphql query product
+//		Get(ctx context.Context, id string) (Product, error)
+//	}
+//
+// An annotation is "query" or "mutation", optionally followed by the name of
+// the field.
+func (g *generator) graphQLFields(comp *component) map[string]string {
+	return g.annotations(comp, "graphql", func(field string, _ *types.Signature) error {
+		parts := strings.Split(field, " ")
+		if parts[0] != "query" && parts[0] != "mutation" {
+			return fmt.Errorf("want query or mutation, got %q", parts[0])
+		}
+		if len(parts) > 2 {
+			return fmt.Errorf("want \"query|mutation [name]\", got %q", field)
+		}
+		if len(parts) == 2 && !graphQLName.MatchString(parts[1]) {
+			return fmt.Errorf("invalid field name %q", parts[1])
+		}
+		return nil
+	})
+}
+
+// kafkaBindings returns the Kafka bindings of the methods of the provided
+// component, declared by annotations in the doc comments of the methods of
+// the component interface. For example:
+//
+//	type Emailer interface {
+//		//weaver:kafka orders emailer
+//		OnOrder(ctx context.Context, msg kafka.Message) error
+//	}
+//
+// An annotation is the name of a topic followed by the name of a consumer
+// group. The method must take a kafka.Message and return only an error.
+func (g *generator) kafkaBindings(comp *component) map[string]string {
+	return g.annotations(comp, "kafka", func(binding string, sig *types.Signature) error {
+		if len(strings.Split(binding, " ")) != 2 {
+			return fmt.Errorf("want \"<topic> <group>\", got %q", binding)
+		}
+		if sig.Params().Len() != 2 || sig.Results().Len() != 1 || !isKafkaMessage(sig.Params().At(1).Type()) {
+			return fmt.Errorf("method must have signature func(context.Context, kafka.Message) error")
+		}
+		return nil
+	})
+}
+
+// isKafkaMessage returns whether t is the kafka.Message type.
+func isKafkaMessage(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Pkg() != nil &&
+		named.Obj().Pkg().Path() == weaverPackagePath+"/kafka" &&
+		named.Obj().Name() == "Message"
+}
+
+// graphQLName matches valid GraphQL names.
+var graphQLName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// annotations returns the values of the //weaver:<kind> annotations in the
+// doc comments of the methods of the provided component, keyed by method.
+// Values are checked with check. Annotations are only found if the component
+// interface is declared in this package.
+func (g *generator) annotations(comp *component, kind string, check func(string, *types.Signature) error) map[string]string {
+	docs := map[token.Pos]*ast.CommentGroup{}
+	for _, f := range g.pkg.Syntax {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if it, ok := n.(*ast.InterfaceType); ok {
+				for _, field := range it.Methods.List {
+					if len(field.Names) == 1 && field.Doc != nil {
+						docs[field.Names[0].Pos()] = field.Doc
+					}
+				}
+				return false
+			}
+			return true
+		})
+	}
+
+	prefix := "//weaver:" + kind + " "
+	values := map[string]string{}
+	for _, m := range comp.methods {
+		doc, ok := docs[m.Pos()]
+		if !ok {
+			continue
+		}
+		for _, c := range doc.List {
+			if !strings.HasPrefix(c.Text, prefix) {
+				continue
+			}
+			value := strings.Join(strings.Fields(strings.TrimPrefix(c.Text, prefix)), " ")
+			if _, ok := values[m.Name()]; ok {
+				g.errorf(c.Pos(), "method %s has more than one %s annotation", m.Name(), strings.TrimSpace(prefix))
+				continue
+			}
+			if err := check(value, m.Type().(*types.Signature)); err != nil {
+				g.errorf(c.Pos(), "invalid %s annotation for method %s: %v", strings.TrimSpace(prefix), m.Name(), err)
+				continue
+			}
+			values[m.Name()] = value
+		}
+	}
+	return values
+}
+
+// checkHTTPRoute checks that route, e.g., "GET /items/{id}", is a valid
+// route for a method with the provided signature.
+func checkHTTPRoute(route string, sig *types.Signature) error {
+	method, path, ok := strings.Cut(route, " ")
+	if !ok {
+		return fmt.Errorf("want \"<method> <path>\", got %q", route)
+	}
+	switch method {
+	case "GET", "POST", "PUT", "PATCH", "DELETE":
+	default:
+		return fmt.Errorf("unsupported HTTP method %q", method)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("path %q doesn't start with /", path)
+	}
+	params := map[string]bool{}
+	for i := 1; i < sig.Params().Len(); i++ {
+		params[sig.Params().At(i).Name()] = true
+	}
+	for _, segment := range strings.Split(path[1:], "/") {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		if name := segment[1 : len(segment)-1]; !params[name] {
+			return fmt.Errorf("path parameter %q is not a parameter of the method", name)
+		}
+	}
+	return nil
 }
 
 // pkgDir returns the directory of the package.
@@ -704,22 +1044,68 @@ func (g *generator) generateImports(p printFn) {
 }
 
 // generateRegisteredComponents generates code that registers the components with Service Weaver.
+// methodMapLiteral returns a map literal with the provided values of the
+// methods of the provided component, in method order. For example:
+//
+//	map[string]string{"Get": "GET /items/{id}"}
+func methodMapLiteral(comp *component, values map[string]string) string {
+	var parts []string
+	for _, m := range comp.methods {
+		if route, ok := values[m.Name()]; ok {
+			parts = append(parts, fmt.Sprintf("%q: %q", m.Name(), route))
+		}
+	}
+	return "map[string]string{" + strings.Join(parts, ", ") + "}"
+}
+
+// paramNames returns a map literal with the parameter names of the methods
+// of the provided component, excluding the context parameter, or the empty
+// string if no method has parameters other than the context. For example:
+//
+//	map[string][]string{"Add": {"x", "y"}}
+func paramNames(comp *component) string {
+	var b strings.Builder
+	for _, m := range comp.methods {
+		sig := m.Type().(*types.Signature)
+		if sig.Params().Len() <= 1 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%q: {", m.Name())
+		for i := 1; i < sig.Params().Len(); i++ {
+			if i > 1 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%q", sig.Params().At(i).Name())
+		}
+		b.WriteString("}")
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "map[string][]string{" + b.String() + "}"
+}
+
 func (g *generator) generateRegisteredComponents(p printFn) {
-	if len(g.components) == 0 {
+	if len(g.components) == 0 && len(g.refs) == 0 {
 		return
 	}
 
-	g.tset.importPackage("context", "context")
+	if len(g.components) > 0 {
+		g.tset.importPackage("context", "context")
+	}
 	p(``)
 	p(`func init() {`)
 	for _, comp := range g.components {
-		name := comp.name
+		name := comp.ident
 
 		// E.g.,
 		//   func(impl any, caller string, tracer trace.Tracer) any {
 		//       return foo_local_stub{imple: impl.(Foo), tracer: tracer, ...}
 		//   }
-		localStubFn := fmt.Sprintf(`func(impl any, tracer %v) any { return %s_local_stub{impl: impl.(%s), tracer: tracer } }`, g.trace().qualify("Tracer"), notExported(name), name)
+		localStubFn := fmt.Sprintf(`func(impl any, tracer %v) any { return %s_local_stub{impl: impl.(%s), tracer: tracer } }`, g.trace().qualify("Tracer"), notExported(name), comp.intfType)
 
 		// E.g.,
 		//   func(stub *codegen.Stub, caller string) any {
@@ -736,7 +1122,7 @@ func (g *generator) generateRegisteredComponents(p printFn) {
 		//   func(impl any, addLoad func(uint64, float64)) codegen.Server {
 		//       return foo_server_stub{impl: impl.(Foo), addLoad: addLoad}
 		//   }
-		serverStubFn := fmt.Sprintf(`func(impl any, addLoad func(uint64, float64)) %s { return %s_server_stub{impl: impl.(%s), addLoad: addLoad } }`, g.codegen().qualify("Server"), notExported(name), name)
+		serverStubFn := fmt.Sprintf(`func(impl any, addLoad func(uint64, float64)) %s { return %s_server_stub{impl: impl.(%s), addLoad: addLoad } }`, g.codegen().qualify("Server"), notExported(name), comp.intfType)
 
 		// E.g.,
 		//	weaver.Register(weaver.Registration{
@@ -749,19 +1135,48 @@ func (g *generator) generateRegisteredComponents(p printFn) {
 		// To get a reflect.Type for an interface, we have to first get a type
 		// of its pointer and then resolve the underlying type. See:
 		//   https://pkg.go.dev/reflect#example-TypeOf
-		p(`		Iface: %s((*%s)(nil)).Elem(),`, reflect.qualify("TypeOf"), name)
+		p(`		Iface: %s((*%s)(nil)).Elem(),`, reflect.qualify("TypeOf"), comp.intfType)
 		p(`		New: func() any { return &%s{} },`, comp.implName)
 		if comp.hasConfig {
 			p(`		ConfigFn: func(i any) any { return i.(*%s).WithConfig.Config() },`, comp.implName)
 		}
 		if comp.router != nil {
 			p(`		Routed: true,`)
+			p(`		Router: %s((*%s_router)(nil)).Elem(),`, reflect.qualify("TypeOf"), notExported(name))
 		}
 		p(`		LocalStubFn: %s,`, localStubFn)
 		p(`		ClientStubFn: %s,`, clientStubFn)
 		p(`		ServerStubFn: %s,`, serverStubFn)
+		if names := paramNames(comp); names != "" {
+			p(`		ParamNames: %s,`, names)
+		}
+		if len(comp.httpRoutes) > 0 {
+			p(`		HTTPRoutes: %s,`, methodMapLiteral(comp, comp.httpRoutes))
+		}
+		if len(comp.graphQL) > 0 {
+			p(`		GraphQLFields: %s,`, methodMapLiteral(comp, comp.graphQL))
+		}
+		if len(comp.kafka) > 0 {
+			p(`		KafkaBindings: %s,`, methodMapLiteral(comp, comp.kafka))
+		}
 		p(`	})`)
 	}
+
+	// E.g.,
+	//	codegen.RegisterRefs("main", "github.com/example/foo/Foo")
+	callers := make([]string, 0, len(g.refs))
+	for caller := range g.refs {
+		callers = append(callers, caller)
+	}
+	sort.Strings(callers)
+	for _, caller := range callers {
+		refs := make([]string, 0, len(g.refs[caller]))
+		for ref := range g.refs[caller] {
+			refs = append(refs, strconv.Quote(ref))
+		}
+		sort.Strings(refs)
+		p(`	%s(%q, %s)`, g.codegen().qualify("RegisterRefs"), caller, strings.Join(refs, ", "))
+	}
 	p(`}`)
 }
 
@@ -773,10 +1188,10 @@ func (g *generator) generateLocalStubs(p printFn) {
 
 	var b strings.Builder
 	for _, comp := range g.components {
-		stub := notExported(comp.name) + "_local_stub"
+		stub := notExported(comp.ident) + "_local_stub"
 		p(``)
 		p(`type %s struct{`, stub)
-		p(`	impl %s`, comp.name)
+		p(`	impl %s`, comp.intfType)
 		p(`	tracer %s`, g.trace().qualify("Tracer"))
 		p(`}`)
 		for _, m := range comp.methods {
@@ -824,7 +1239,7 @@ func (g *generator) generateClientStubs(p printFn) {
 
 	var b strings.Builder
 	for _, comp := range g.components {
-		stub := notExported(comp.name) + "_client_stub"
+		stub := notExported(comp.ident) + "_client_stub"
 		p(``)
 		p(`type %s struct{`, stub)
 		p(`	stub %s`, g.codegen().qualify("Stub"))
@@ -852,7 +1267,8 @@ func (g *generator) generateClientStubs(p printFn) {
 			// Update metrics.
 			p(`	// Update metrics.`)
 			p(`	start := %s()`, g.time().qualify("Now"))
-			p(`	s.%sMetrics.Count.Add(1)`, notExported(m.Name()))
+			p(`	methodMetrics := s.%sMetrics.ForContext(ctx)`, notExported(m.Name()))
+			p(`	methodMetrics.Count.Add(1)`)
 			p(``)
 
 			// Create a child span iff tracing is enabled in ctx.
@@ -874,11 +1290,11 @@ func (g *generator) generateClientStubs(p printFn) {
 			p(`		if err != nil {`)
 			p(`			span.RecordError(err)`)
 			p(`			span.SetStatus(%s, err.Error())`, g.codes().qualify("Error"))
-			p(`			s.%sMetrics.ErrorCount.Add(1)`, notExported(m.Name()))
+			p(`			methodMetrics.ErrorCount.Add(1)`)
 			p(`		}`)
 			p(`		span.End()`)
 			p(``)
-			p(`		s.%sMetrics.Latency.Put(float64(time.Since(start).Microseconds()))`, notExported(m.Name()))
+			p(`		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))`)
 			p(`	}()`)
 			p(``)
 
@@ -900,8 +1316,8 @@ func (g *generator) generateClientStubs(p printFn) {
 						at := mt.Params().At(i).Type()
 						p("	size += %s", g.size(fmt.Sprintf("a%d", i-1), at))
 					}
-					p("	enc := %s", g.codegen().qualify("NewEncoder()"))
-					p("	enc.Reset(size)")
+					p("	enc := %s(size)", g.codegen().qualify("NewPooledEncoder"))
+					p("	defer enc.Release()")
 					preallocated = true
 				}
 			}
@@ -912,7 +1328,8 @@ func (g *generator) generateClientStubs(p printFn) {
 				p(``)
 				p(`	// Encode arguments.`)
 				if !preallocated {
-					p("	enc := %s", g.codegen().qualify("NewEncoder()"))
+					p("	enc := %s(0)", g.codegen().qualify("NewPooledEncoder"))
+					p("	defer enc.Release()")
 				}
 			}
 			for i := 1; i < mt.Params().Len(); i++ { // Skip initial context.Context
@@ -925,14 +1342,13 @@ func (g *generator) generateClientStubs(p printFn) {
 			if comp.routedMethods[m.Name()] {
 				p(``)
 				p(`	// Set the shardKey.`)
-				p(`     var r %s`, g.tset.genTypeString(comp.router))
 				n := mt.Params().Len()
 				args := make([]string, n)
 				args[0] = "ctx"
 				for i := 1; i < n; i++ {
 					args[i] = fmt.Sprintf("a%d", i-1)
 				}
-				p(`	shardKey := _hash%s(r.%s(%s))`, exported(comp.name), m.Name(), strings.Join(args, ", "))
+				p(`	shardKey := _hash%s(_router%s().%s(%s))`, exported(comp.ident), exported(comp.ident), m.Name(), strings.Join(args, ", "))
 			} else {
 				p(`	var shardKey uint64`)
 			}
@@ -943,16 +1359,16 @@ func (g *generator) generateClientStubs(p printFn) {
 			data := "nil"
 			if mt.Params().Len() > 1 {
 				data = "enc.Data()"
-				p(`	s.%sMetrics.BytesRequest.Put(float64(len(enc.Data())))`, notExported(m.Name()))
+				p(`	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))`)
 			} else {
-				p(`	s.%sMetrics.BytesRequest.Put(0)`, notExported(m.Name()))
+				p(`	methodMetrics.BytesRequest.Put(0)`)
 			}
 			p(`	var results []byte`)
 			p(`	results, err = s.stub.Run(ctx, %d, %s, shardKey)`, methodIndex[m.Name()], data)
 			p(`	if err != nil {`)
 			p(`		return`)
 			p(`	}`)
-			p(`	s.%sMetrics.BytesReply.Put(float64(len(results)))`, notExported(m.Name()))
+			p(`	methodMetrics.BytesReply.Put(float64(len(results)))`)
 
 			// Invoke call.Decode.
 			b.Reset()
@@ -1067,6 +1483,9 @@ func (g *generator) isWeaverEncoded(t types.Type) bool {
 		return true
 
 	case *types.Named:
+		if nativeCodec(x) != "" || isSerializableInterface(x) {
+			return true
+		}
 		if s, ok := x.Underlying().(*types.Struct); ok {
 			for i := 0; i < s.NumFields(); i++ {
 				f := s.Field(i)
@@ -1098,6 +1517,7 @@ func (g *generator) size(e string, t types.Type) string {
 	// size(e: map[k]v) = 4 + len(e) * (fixedsize(k) + fixedsize(v))
 	// size(e: struct{...}) = serviceweaver_size_struct_XXXXXXXX(e)
 	// size(e: weaver.AutoMarshal) = 0
+	// size(e: time.Time) = fixedsize(time.Time)
 	// size(e: type t struct{...}) = serviceweaver_size_t(e)
 	// size(e: type t u) = size(e: u)
 
@@ -1143,6 +1563,8 @@ func (g *generator) size(e string, t types.Type) string {
 				// TODO(mwhittaker): This yields a `size += 0` line in the
 				// generated code. Don't produce those lines.
 				return "0"
+			} else if nativeCodec(x) == "Time" {
+				return strconv.Itoa(g.tset.sizeOfType(t))
 			} else if _, ok := x.Underlying().(*types.Struct); ok {
 				return fmt.Sprintf("serviceweaver_size_%s(&%s)", sanitize(t), e)
 			}
@@ -1209,7 +1631,7 @@ func (g *generator) findSizeFuncNeededs(t types.Type) {
 			}
 
 		case *types.Named:
-			if isWeaverAutoMarshal(x) {
+			if isWeaverAutoMarshal(x) || nativeCodec(x) != "" {
 				return
 			}
 			if s, ok := x.Underlying().(*types.Struct); ok {
@@ -1298,10 +1720,10 @@ func (g *generator) generateServerStubs(p printFn) {
 	var b strings.Builder
 
 	for _, comp := range g.components {
-		stub := fmt.Sprintf("%s_server_stub", notExported(comp.name))
+		stub := fmt.Sprintf("%s_server_stub", notExported(comp.ident))
 		p(``)
 		p(`type %s struct{`, stub)
-		p(`	impl %s`, comp.name)
+		p(`	impl %s`, comp.intfType)
 		p(`	addLoad func(key uint64, load float64)`)
 		p(`}`)
 		p(``)
@@ -1370,8 +1792,7 @@ func (g *generator) generateServerStubs(p printFn) {
 
 			// Add load, if needed.
 			if comp.routedMethods[m.Name()] {
-				p(`     var r %s`, g.tset.genTypeString(comp.router))
-				p(`	s.addLoad(_hash%s(r.%s(%s)), 1.0)`, exported(comp.name), m.Name(), argList)
+				p(`	s.addLoad(_hash%s(_router%s().%s(%s)), 1.0)`, exported(comp.ident), exported(comp.ident), m.Name(), argList)
 			}
 
 			b.Reset()
@@ -1396,9 +1817,26 @@ func (g *generator) generateServerStubs(p printFn) {
 
 			p(`	%s := s.impl.%s(%s)`, res, m.Name(), argList)
 
+			// Preallocate a buffer for the results if possible. The buffer
+			// fits a nil error, but may have to grow to fit a non-nil one.
+			canPreallocate := mt.Results().Len() > 1
+			for i := 0; i < mt.Results().Len()-1; i++ { // Skip final error
+				if !g.preallocatable(mt.Results().At(i).Type()) {
+					canPreallocate = false
+					break
+				}
+			}
 			p(``)
 			p(`	// Encode the results.`)
 			p(` enc := %s()`, g.codegen().qualify("NewEncoder"))
+			if canPreallocate {
+				p("	size := 8 // nil error")
+				for i := 0; i < mt.Results().Len()-1; i++ {
+					rt := mt.Results().At(i).Type()
+					p("	size += %s", g.size(fmt.Sprintf("r%d", i), rt))
+				}
+				p("	enc.Reset(size)")
+			}
 
 			b.Reset()
 			for i := 0; i < mt.Results().Len()-1; i++ { // Skip final error
@@ -1413,6 +1851,46 @@ func (g *generator) generateServerStubs(p printFn) {
 	}
 }
 
+// generateSerializableRegistrations registers the types declared in the
+// package that implement codegen.AutoMarshal, either because they embed
+// weaver.AutoMarshal or by hand, so that they can be serialized as the values
+// of interface types.
+func (g *generator) generateSerializableRegistrations(p printFn) {
+	var registered []types.Type
+	for _, t := range g.tset.automarshalCandidates.Keys() {
+		if g.tset.automarshals.At(t) != nil {
+			registered = append(registered, t)
+		}
+	}
+	scope := g.pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || tn.IsAlias() {
+			continue
+		}
+		n, ok := tn.Type().(*types.Named)
+		if !ok || n.TypeParams() != nil || g.tset.automarshals.At(n) != nil || isWeaverAutoMarshal(n) {
+			continue
+		}
+		if g.tset.implementsAutoMarshal(n) {
+			registered = append(registered, n)
+		}
+	}
+	if len(registered) == 0 {
+		return
+	}
+	sort.Slice(registered, func(i, j int) bool {
+		return registered[i].String() < registered[j].String()
+	})
+
+	p(``)
+	p(`func init() {`)
+	for _, t := range registered {
+		p(`	%s[%s]()`, g.codegen().qualify("RegisterSerializable"), g.tset.genTypeString(t))
+	}
+	p(`}`)
+}
+
 // generateAutoMarshalMethods generates WeaverMarshal and WeaverUnmarshal methods
 // for any types that declares itself as weaver.AutoMarshal.
 func (g *generator) generateAutoMarshalMethods(p printFn) {
@@ -1437,6 +1915,11 @@ func (g *generator) generateAutoMarshalMethods(p printFn) {
 		p(``)
 		p(`var _ %s = &%s{}`, g.codegen().qualify("AutoMarshal"), ts(t))
 
+		if isVersioned(t) {
+			g.generateVersionedAutoMarshalMethods(p, t)
+			continue
+		}
+
 		// Generate WeaverMarshal method.
 		fmt := g.tset.importPackage("fmt", "fmt")
 		p(``)
@@ -1474,6 +1957,216 @@ func (g *generator) generateAutoMarshalMethods(p printFn) {
 	}
 }
 
+// generateVersionedAutoMarshalMethods generates the WeaverMarshal and
+// WeaverUnmarshal methods of a versioned struct (see fieldNumbers). Every
+// field is encoded with a header holding its field number and the length of
+// its encoding, so that decoders can skip the fields they don't know, and the
+// fields they don't find keep their zero values.
+func (g *generator) generateVersionedAutoMarshalMethods(p printFn, t types.Type) {
+	ts := g.tset.genTypeString
+	s := t.Underlying().(*types.Struct)
+	nums, err := fieldNumbers(s)
+	if err != nil {
+		panic(fmt.Sprintf("generateVersionedAutoMarshalMethods: %v", err))
+	}
+	var fields []int // indices of the numbered fields
+	for i := 0; i < s.NumFields(); i++ {
+		if nums[i] > 0 {
+			fields = append(fields, i)
+		}
+	}
+
+	// Generate WeaverMarshal method.
+	fmtPkg := g.tset.importPackage("fmt", "fmt")
+	p(``)
+	p(`func (x *%s) WeaverMarshal(enc *%s) {`, ts(t), g.codegen().qualify("Encoder"))
+	p(`	if x == nil {`)
+	p(`		panic(%s("%s.WeaverMarshal: nil receiver"))`, fmtPkg.qualify("Errorf"), ts(t))
+	p(`	}`)
+	p(`	enc.Len(%d)`, len(fields))
+	for _, i := range fields {
+		fi := s.Field(i)
+		p(`	f%d := enc.BeginField(%d)`, nums[i], nums[i])
+		p(`	%s`, g.encode("enc", "x."+fi.Name(), fi.Type()))
+		p(`	enc.EndField(f%d)`, nums[i])
+	}
+	p(`}`)
+
+	// Generate WeaverUnmarshal method.
+	p(``)
+	p(`func (x *%s) WeaverUnmarshal(dec *%s) {`, ts(t), g.codegen().qualify("Decoder"))
+	p(`	if x == nil {`)
+	p(`		panic(%s("%s.WeaverUnmarshal: nil receiver"))`, fmtPkg.qualify("Errorf"), ts(t))
+	p(`	}`)
+	p(`	*x = %s{}`, ts(t))
+	p(`	for n := dec.Len(); n > 0; n-- {`)
+	p(`		switch num, field := dec.Field(); num {`)
+	for _, i := range fields {
+		fi := s.Field(i)
+		p(`		case %d:`, nums[i])
+		p(`			%s`, g.decode("field", "&x."+fi.Name(), fi.Type()))
+	}
+	p(`		}`)
+	p(`	}`)
+	p(`}`)
+
+	// Generate encoding/decoding methods for any inner types.
+	for _, i := range fields {
+		g.generateEncDecMethodsFor(p, s.Field(i).Type())
+	}
+}
+
+// generateFakes generates a fake implementation of every component
+// interface. See Options.Fakes.
+func (g *generator) generateFakes(p printFn) {
+	if len(g.components) == 0 {
+		return
+	}
+	p(``)
+	p(`// Fakes.`)
+
+	syncPkg := g.tset.importPackage("sync", "sync")
+	for _, comp := range g.components {
+		fake := "Fake" + comp.ident
+
+		// Report methods whose helper methods would collide with other
+		// methods of the interface.
+		names := map[string]bool{}
+		for _, m := range comp.methods {
+			names[m.Name()] = true
+		}
+		ok := true
+		for _, m := range comp.methods {
+			for _, helper := range []string{m.Name() + "Calls", m.Name() + "Returns", m.Name() + "Hook"} {
+				if names[helper] {
+					g.errorf(comp.pos, "cannot generate fake for component %s: method %s collides with the fake's %s", comp.name, helper, helper)
+					ok = false
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		p(``)
+		p(`// %s is a configurable fake implementation of the %s component,`, fake, comp.name)
+		p(`// for use with weavertest.Fake. Every method records its calls and then`)
+		p(`// returns the next scripted results, if any, or else calls the method's`)
+		p(`// hook, if set, or else returns zero values.`)
+		p(`type %s struct {`, fake)
+		for _, m := range comp.methods {
+			mt := m.Type().(*types.Signature)
+			p(`	// %sHook, if not nil, is called by %s when no scripted results remain.`, m.Name(), m.Name())
+			p(`	%sHook func(%s) (%s)`, m.Name(), g.args(mt), g.returns(mt))
+			p(``)
+		}
+		p(`	mu %s`, syncPkg.qualify("Mutex"))
+		for _, m := range comp.methods {
+			p(`	%sCalls []%s%sCall`, notExported(m.Name()), fake, m.Name())
+			p(`	%sResults []%s%sResults`, notExported(m.Name()), notExported(fake), m.Name())
+		}
+		p(`}`)
+		p(``)
+		p(`var _ %s = (*%s)(nil)`, comp.intfType, fake)
+
+		for _, m := range comp.methods {
+			mt := m.Type().(*types.Signature)
+			call := fake + m.Name() + "Call"
+			results := notExported(fake) + m.Name() + "Results"
+			fields := fakeFieldNames(mt)
+
+			p(``)
+			p(`// %s records a call to %s.%s.`, call, fake, m.Name())
+			p(`type %s struct {`, call)
+			for i := 1; i < mt.Params().Len(); i++ {
+				p(`	%s %s`, fields[i-1], g.tset.genTypeString(mt.Params().At(i).Type()))
+			}
+			p(`}`)
+			p(``)
+			p(`type %s struct {`, results)
+			for i := 0; i < mt.Results().Len()-1; i++ {
+				p(`	r%d %s`, i, g.tset.genTypeString(mt.Results().At(i).Type()))
+			}
+			p(`	err error`)
+			p(`}`)
+
+			var args, init, hookArgs, res strings.Builder
+			for i := 1; i < mt.Params().Len(); i++ {
+				if i > 1 {
+					init.WriteString(", ")
+				}
+				fmt.Fprintf(&init, "%s: a%d", fields[i-1], i-1)
+				if mt.Variadic() && i == mt.Params().Len()-1 {
+					fmt.Fprintf(&hookArgs, ", a%d...", i-1)
+				} else {
+					fmt.Fprintf(&hookArgs, ", a%d", i-1)
+				}
+			}
+			for i := 0; i < mt.Results().Len()-1; i++ {
+				fmt.Fprintf(&args, "r%d %s, ", i, g.tset.genTypeString(mt.Results().At(i).Type()))
+				fmt.Fprintf(&res, "r%d: r%d, ", i, i)
+			}
+
+			p(``)
+			p(`func (f *%s) %s(%s) (%s) {`, fake, m.Name(), g.args(mt), g.returns(mt))
+			p(`	f.mu.Lock()`)
+			p(`	f.%sCalls = append(f.%sCalls, %s{%s})`, notExported(m.Name()), notExported(m.Name()), call, init.String())
+			p(`	if len(f.%sResults) > 0 {`, notExported(m.Name()))
+			p(`		res := f.%sResults[0]`, notExported(m.Name()))
+			p(`		f.%sResults = f.%sResults[1:]`, notExported(m.Name()), notExported(m.Name()))
+			p(`		f.mu.Unlock()`)
+			var ret strings.Builder
+			for i := 0; i < mt.Results().Len()-1; i++ {
+				fmt.Fprintf(&ret, "res.r%d, ", i)
+			}
+			p(`		return %sres.err`, ret.String())
+			p(`	}`)
+			p(`	hook := f.%sHook`, m.Name())
+			p(`	f.mu.Unlock()`)
+			p(`	if hook != nil {`)
+			p(`		return hook(ctx%s)`, hookArgs.String())
+			p(`	}`)
+			p(`	return`)
+			p(`}`)
+
+			p(``)
+			p(`// %sReturns scripts the results of a call to %s. Scripted results are`, m.Name(), m.Name())
+			p(`// returned in the order in which they were scripted, one per call.`)
+			p(`func (f *%s) %sReturns(%serr error) {`, fake, m.Name(), args.String())
+			p(`	f.mu.Lock()`)
+			p(`	defer f.mu.Unlock()`)
+			p(`	f.%sResults = append(f.%sResults, %s{%serr: err})`, notExported(m.Name()), notExported(m.Name()), results, res.String())
+			p(`}`)
+
+			p(``)
+			p(`// %sCalls returns the calls made to %s, in order.`, m.Name(), m.Name())
+			p(`func (f *%s) %sCalls() []%s {`, fake, m.Name(), call)
+			p(`	f.mu.Lock()`)
+			p(`	defer f.mu.Unlock()`)
+			p(`	return append([]%s(nil), f.%sCalls...)`, call, notExported(m.Name()))
+			p(`}`)
+		}
+	}
+}
+
+// fakeFieldNames returns the names of the fields that record the arguments,
+// other than the initial context.Context, of a call to a method with the
+// provided signature in a generated fake. The fields are named after the
+// method's parameters when possible, e.g., x becomes X.
+func fakeFieldNames(sig *types.Signature) []string {
+	var names []string
+	seen := map[string]bool{}
+	for i := 1; i < sig.Params().Len(); i++ {
+		name := exported(sig.Params().At(i).Name())
+		if name == "" || name == "_" || !token.IsExported(name) || seen[name] {
+			name = fmt.Sprintf("A%d", i-1)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
 // generateRouterMethods generates methods for router types.
 func (g *generator) generateRouterMethods(p printFn) {
 	printed := false
@@ -1491,8 +2184,50 @@ func (g *generator) generateRouterMethods(p printFn) {
 
 // generateRouterMethodsFor generates router methods for the provided router type.
 func (g *generator) generateRouterMethodsFor(p printFn, comp *component, t types.Type) {
-	p(`// _hash%s returns a 64 bit hash of the provided value.`, exported(comp.name))
-	p(`func _hash%s(r %s) uint64 {`, exported(comp.name), g.tset.genTypeString(t))
+	// E.g.,
+	//   type foo_router interface {
+	//       Get(ctx context.Context, a0 string) string
+	//   }
+	iface := notExported(comp.ident) + "_router"
+	p(`// %s holds the routing methods of the %s component.`, iface, comp.name)
+	p(`type %s interface {`, iface)
+	for _, m := range comp.methods {
+		if !comp.routedMethods[m.Name()] {
+			continue
+		}
+		mt := m.Type().(*types.Signature)
+		args := []string{"ctx " + g.tset.genTypeString(mt.Params().At(0).Type())}
+		for i := 1; i < mt.Params().Len(); i++ {
+			at := mt.Params().At(i).Type()
+			if mt.Variadic() && i == mt.Params().Len()-1 {
+				args = append(args, fmt.Sprintf("a%d ...%s", i-1, g.tset.genTypeString(at.(*types.Slice).Elem())))
+			} else {
+				args = append(args, fmt.Sprintf("a%d %s", i-1, g.tset.genTypeString(at)))
+			}
+		}
+		p(`	%s(%s) %s`, m.Name(), strings.Join(args, ", "), g.tset.genTypeString(t))
+	}
+	p(`}`)
+	p(``)
+
+	// E.g.,
+	//   func _routerFoo() foo_router {
+	//       if r, ok := codegen.Router("foo/Foo").(foo_router); ok {
+	//           return r
+	//       }
+	//       return new(router)
+	//   }
+	p(`// _router%s returns the router installed for the %s component.`, exported(comp.ident), comp.name)
+	p(`func _router%s() %s {`, exported(comp.ident), iface)
+	p(`	if r, ok := %s(%q).(%s); ok {`, g.codegen().qualify("Router"), comp.fullName, iface)
+	p(`		return r`)
+	p(`	}`)
+	p(`	return new(%s)`, g.tset.genTypeString(comp.router))
+	p(`}`)
+	p(``)
+
+	p(`// _hash%s returns a 64 bit hash of the provided value.`, exported(comp.ident))
+	p(`func _hash%s(r %s) uint64 {`, exported(comp.ident), g.tset.genTypeString(t))
 	p(`	var h %s`, g.codegen().qualify("Hasher"))
 	if isPrimitiveRouter(t.Underlying()) {
 		tname := t.Underlying().String()
@@ -1509,8 +2244,8 @@ func (g *generator) generateRouterMethodsFor(p printFn, comp *component, t types
 	p(`}`)
 	p(``)
 
-	p(`// _orderedCode%s returns an order-preserving serialization of the provided value.`, exported(comp.name))
-	p(`func _orderedCode%s(r %s) %s {`, exported(comp.name), g.tset.genTypeString(t), g.codegen().qualify("OrderedCode"))
+	p(`// _orderedCode%s returns an order-preserving serialization of the provided value.`, exported(comp.ident))
+	p(`func _orderedCode%s(r %s) %s {`, exported(comp.ident), g.tset.genTypeString(t), g.codegen().qualify("OrderedCode"))
 	p(`	var enc %s`, g.codegen().qualify("OrderedEncoder"))
 	if isPrimitiveRouter(t.Underlying()) {
 		p(`	enc.Write%s(%s(r))`, exported(t.Underlying().String()), t.Underlying().String())
@@ -1566,10 +2301,14 @@ func (g *generator) encode(stub, e string, t types.Type) string {
 	// enc(stub, e: []t) = serviceweaver_enc_[[]t](&stub, e)
 	// enc(stub, e: map[k]v) = serviceweaver_enc_[map[k]v](&stub, e)
 	// enc(stub, e: struct{...}) = serviceweaver_enc_[struct{...}](&stub, &e)
+	// enc(stub, e: time.Time) = stub.Time(e)                  // likewise for netip.Addr
+	// enc(stub, e: big.Int) = stub.BigInt(&e)
 	// enc(stub, e: type t u) = stub.EncodeProto(&e)           // t implements proto.Message
 	// enc(stub, e: type t u) = (e).WeaverMarshal(stub)         // t implements AutoMarshal
 	// enc(stub, e: type t u) = stub.EncodeBinaryMarshaler(&e) // t implements BinaryMarshaler
+	// enc(stub, e: type t u) = stub.Interface(e)               // under(u) = interface{...}
 	// enc(stub, e: type t u) = serviceweaver_enc_[t](&stub, &e)       // under(u) = struct{...}
+	// enc(stub, e: type t u) = serviceweaver_enc_[u](&stub, (*u)(&e)) // under(u) = [N]t
 	// enc(stub, e: type t u) = enc(&stub, under(t)(e))        // otherwise
 	switch x := t.(type) {
 	case *types.Basic:
@@ -1601,6 +2340,13 @@ func (g *generator) encode(stub, e string, t types.Type) string {
 		return fmt.Sprintf("%s(%s, %s)", f(x), stub, ref(e))
 
 	case *types.Named:
+		switch name := nativeCodec(x); name {
+		case "":
+		case "BigInt":
+			return fmt.Sprintf("%s.BigInt(%s)", stub, ref(e))
+		default:
+			return fmt.Sprintf("%s.%s(%s)", stub, name, e)
+		}
 		if g.tset.isProto(x) {
 			return fmt.Sprintf("%s.EncodeProto(%s)", stub, ref(e))
 		}
@@ -1610,10 +2356,17 @@ func (g *generator) encode(stub, e string, t types.Type) string {
 		if g.tset.hasMarshalBinary(x) {
 			return fmt.Sprintf("%s.EncodeBinaryMarshaler(%s)", stub, ref(e))
 		}
+		if isSerializableInterface(x) {
+			return fmt.Sprintf("%s.Interface(%s)", stub, e)
+		}
 		under := x.Underlying()
 		if _, ok := under.(*types.Struct); ok {
 			return fmt.Sprintf("%s(%s, %s)", f(x), stub, ref(e))
 		}
+		if _, ok := under.(*types.Array); ok {
+			// Convert a pointer, as a converted array isn't addressable.
+			return fmt.Sprintf("%s(%s, (*%s)(%s))", f(under), stub, g.tset.genTypeString(under), ref(e))
+		}
 		return g.encode(stub, fmt.Sprintf("(%s)(%s)", g.tset.genTypeString(x.Underlying()), e), under)
 
 	default:
@@ -1639,9 +2392,12 @@ func (g *generator) decode(stub, v string, t types.Type) string {
 	// dec(stub, v: []t) = v := *v = serviceweaver_dec_[[]t](stub)
 	// dec(stub, v: map[k]v) = *v := serviceweaver_dec_[map[k]v](stub)
 	// dec(stub, v: struct{...}) = serviceweaver_dec_[struct{...}](stub, &v)
+	// dec(stub, v: time.Time) = *v = stub.Time()               // likewise for netip.Addr
+	// dec(stub, v: big.Int) = stub.BigInt(v)
 	// dec(stub, v: type t u) = stub.DecodeProto(v)             // t implements proto.Message
 	// dec(stub, v: type t u) = (v).WeaverUnmarshal(stub)        // t implements AutoMarshal
 	// dec(stub, v: type t u) = stub.DecodeBinaryUnmarshaler(v) // t implements BinaryUnmarshaler
+	// dec(stub, v: type t u) = *v = codegen.DecodeInterface[t](stub) // under(u) = interface{...}
 	// dec(stub, v: type t u) = serviceweaver_dec_[t](stub, v)          // under(u) = struct{...}
 	// dec(stub, v: type t u) = dec(stub, (*under(t))(v))       // otherwise
 	switch x := t.(type) {
@@ -1674,6 +2430,13 @@ func (g *generator) decode(stub, v string, t types.Type) string {
 		return fmt.Sprintf("%s(%s, %s)", f(x), stub, v)
 
 	case *types.Named:
+		switch name := nativeCodec(x); name {
+		case "":
+		case "BigInt":
+			return fmt.Sprintf("%s.BigInt(%s)", stub, v)
+		default:
+			return fmt.Sprintf("%s = %s.%s()", deref(v), stub, name)
+		}
 		if g.tset.isProto(x) {
 			return fmt.Sprintf("%s.DecodeProto(%s)", stub, v)
 		}
@@ -1683,6 +2446,9 @@ func (g *generator) decode(stub, v string, t types.Type) string {
 		if g.tset.hasMarshalBinary(x) {
 			return fmt.Sprintf("%s.DecodeBinaryUnmarshaler(%s)", stub, v)
 		}
+		if isSerializableInterface(x) {
+			return fmt.Sprintf("%s = %s[%s](%s)", deref(v), g.codegen().qualify("DecodeInterface"), g.tset.genTypeString(x), stub)
+		}
 		under := x.Underlying()
 		if _, ok := under.(*types.Struct); ok {
 			return fmt.Sprintf("%s(%s, %s)", f(x), stub, v)
@@ -1759,6 +2525,20 @@ func (g *generator) generateEncDecMethodsFor(p printFn, t types.Type) {
 		p(`}`)
 
 	case *types.Array:
+		if isByte(x.Elem()) {
+			// A [N]byte is encoded like any other array, but one byte at a
+			// time is needlessly slow.
+			p(``)
+			p(`func serviceweaver_enc_%s(enc *%s, arg *%s) {`, sanitize(x), g.codegen().qualify("Encoder"), ts(x))
+			p(`	copy(enc.Grow(%d), arg[:])`, x.Len())
+			p(`}`)
+			p(``)
+			p(`func serviceweaver_dec_%s(dec *%s, res *%s) {`, sanitize(x), g.codegen().qualify("Decoder"), ts(x))
+			p(`	copy(res[:], dec.Read(%d))`, x.Len())
+			p(`}`)
+			return
+		}
+
 		g.generateEncDecMethodsFor(p, x.Elem())
 
 		// Note that arg is never nil.
@@ -1778,6 +2558,21 @@ func (g *generator) generateEncDecMethodsFor(p printFn, t types.Type) {
 		p(`}`)
 
 	case *types.Slice:
+		if types.Identical(x.Elem(), types.Typ[types.Byte]) {
+			// A []byte is encoded like any other slice, but one byte at a
+			// time is needlessly slow. Note that the decoded slice aliases
+			// the decoded data, rather than being a copy.
+			p(``)
+			p(`func serviceweaver_enc_%s(enc *%s, arg %s) {`, sanitize(x), g.codegen().qualify("Encoder"), ts(x))
+			p(`	enc.Bytes(arg)`)
+			p(`}`)
+			p(``)
+			p(`func serviceweaver_dec_%s(dec *%s) %s {`, sanitize(x), g.codegen().qualify("Decoder"), ts(x))
+			p(`	return dec.Bytes()`)
+			p(`}`)
+			return
+		}
+
 		g.generateEncDecMethodsFor(p, x.Elem())
 
 		p(``)
@@ -1844,12 +2639,14 @@ func (g *generator) generateEncDecMethodsFor(p printFn, t types.Type) {
 		panic(fmt.Sprintf("generateEncDecFor: unexpected type: %v", t))
 
 	case *types.Named:
-		if g.tset.isProto(x) || g.tset.automarshals.At(x) != nil || g.tset.implementsAutoMarshal(x) || g.tset.hasMarshalBinary(x) {
-			// Types implementing proto.Marshal, weaver.AutoMarshal, or
-			// encoding.BinaryMarshaler and encoding.BinaryUnmarshaler don't
-			// need encoding or decoding methods. Instead, we call methods
-			// directly on a codegen.Encoder or codegen.Decoder (e.g.,
-			// enc.EncodeProto(x), dec.DecodeBinaryUnmarshaler(x)).
+		if nativeCodec(x) != "" || g.tset.isProto(x) || g.tset.automarshals.At(x) != nil || g.tset.implementsAutoMarshal(x) || g.tset.hasMarshalBinary(x) || isSerializableInterface(x) {
+			// Standard library types with native encodings, types
+			// implementing proto.Marshal, weaver.AutoMarshal, or
+			// encoding.BinaryMarshaler and encoding.BinaryUnmarshaler, and
+			// interface types, don't need encoding or decoding methods.
+			// Instead, we call methods directly on a codegen.Encoder or
+			// codegen.Decoder (e.g., enc.Time(x), enc.EncodeProto(x),
+			// dec.DecodeBinaryUnmarshaler(x), enc.Interface(x)).
 			return
 		}
 		// If a named type t is not a struct, e.g. `type t int`, then we
@@ -99,7 +99,7 @@ func runGenerator(t *testing.T, directory, filename, contents string, subdirs []
 	}
 
 	// Run "weaver generate".
-	if err := Generate(tmp, []string{tmp}); err != nil {
+	if err := Generate(tmp, []string{tmp}, Options{}); err != nil {
 		return "", err
 	}
 	output, err := os.ReadFile(filepath.Join(tmp, generatedCodeFile))
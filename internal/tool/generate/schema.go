@@ -0,0 +1,231 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"encoding/json"
+	"go/types"
+	"path/filepath"
+	"sort"
+
+	"github.com/ServiceWeaver/weaver/internal/files"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// schemaFile is the name of the file, placed next to weaver_gen.go, that
+// holds a package's schema. See Options.Schema.
+const schemaFile = "weaver_schema.json"
+
+// Schema is a machine-readable description of the component interfaces, and
+// the serializable types they use, declared in a package. Types are written as
+// Go type strings, with package-path-qualified names, e.g.,
+// "map[string]example.com/foo.Pair".
+type Schema struct {
+	Package    string            `json:"package"`
+	Components []SchemaComponent `json:"components"`
+	Types      []SchemaType      `json:"types"`
+}
+
+// SchemaComponent describes a component interface.
+type SchemaComponent struct {
+	Name           string         `json:"name"` // e.g., example.com/foo/Foo
+	Implementation string         `json:"implementation"`
+	RoutingKey     string         `json:"routing_key,omitempty"`
+	Methods        []SchemaMethod `json:"methods"`
+}
+
+// SchemaMethod describes a component method. Params exclude the leading
+// context.Context, and Results exclude the trailing error.
+type SchemaMethod struct {
+	Name         string        `json:"name"`
+	Params       []SchemaValue `json:"params"`
+	Results      []SchemaValue `json:"results"`
+	Routed       bool          `json:"routed,omitempty"`
+	HTTPRoute    string        `json:"http_route,omitempty"`
+	GraphQLField string        `json:"graphql_field,omitempty"`
+	KafkaBinding string        `json:"kafka_binding,omitempty"`
+}
+
+// SchemaValue describes a parameter or result of a method.
+type SchemaValue struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+}
+
+// SchemaType describes a named serializable type.
+type SchemaType struct {
+	Name string `json:"name"`
+
+	// Encoding is how values of the type are encoded:
+	//
+	//   - "weaver": like the underlying type (see Underlying) or, for
+	//     structs, field by field, in declaration order (see Fields);
+	//   - "versioned": a struct with numbered fields (see Fields);
+	//   - "native": a standard library type with a native encoding;
+	//   - "custom": with hand-written WeaverMarshal methods;
+	//   - "proto": as a protocol buffer;
+	//   - "binary": with MarshalBinary; or
+	//   - "interface": a value of a registered dynamic type, with its type tag.
+	Encoding   string        `json:"encoding"`
+	Underlying string        `json:"underlying,omitempty"`
+	Fields     []SchemaField `json:"fields,omitempty"`
+}
+
+// SchemaField describes a field of a struct.
+type SchemaField struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Number int    `json:"number,omitempty"` // field number of a versioned struct
+}
+
+// generateSchema writes the schema of the package to schemaFile.
+func (g *generator) generateSchema() {
+	schema := Schema{
+		Package:    g.pkg.PkgPath,
+		Components: []SchemaComponent{},
+		Types:      []SchemaType{},
+	}
+	var seen typeutil.Map
+	var visit func(t types.Type)
+	visit = func(t types.Type) {
+		switch x := t.(type) {
+		case *types.Pointer:
+			visit(x.Elem())
+		case *types.Array:
+			visit(x.Elem())
+		case *types.Slice:
+			visit(x.Elem())
+		case *types.Map:
+			visit(x.Key())
+			visit(x.Elem())
+		case *types.Named:
+			if seen.At(t) != nil || isWeaverAutoMarshal(t) {
+				return
+			}
+			seen.Set(t, struct{}{})
+			st, nested := g.schemaType(x)
+			schema.Types = append(schema.Types, st)
+			for _, n := range nested {
+				visit(n)
+			}
+		}
+	}
+
+	for _, comp := range g.components {
+		c := SchemaComponent{
+			Name:           comp.fullName,
+			Implementation: g.pkg.PkgPath + "." + comp.implName,
+			Methods:        []SchemaMethod{},
+		}
+		if comp.routingKey != nil {
+			c.RoutingKey = types.TypeString(comp.routingKey, nil)
+		}
+		for _, m := range comp.methods {
+			sig := m.Type().(*types.Signature)
+			method := SchemaMethod{
+				Name:         m.Name(),
+				Params:       []SchemaValue{},
+				Results:      []SchemaValue{},
+				Routed:       comp.routedMethods[m.Name()],
+				HTTPRoute:    comp.httpRoutes[m.Name()],
+				GraphQLField: comp.graphQL[m.Name()],
+				KafkaBinding: comp.kafka[m.Name()],
+			}
+			for i := 1; i < sig.Params().Len(); i++ {
+				v := sig.Params().At(i)
+				method.Params = append(method.Params, SchemaValue{Name: v.Name(), Type: types.TypeString(v.Type(), nil)})
+				visit(v.Type())
+			}
+			for i := 0; i < sig.Results().Len()-1; i++ {
+				v := sig.Results().At(i)
+				method.Results = append(method.Results, SchemaValue{Name: v.Name(), Type: types.TypeString(v.Type(), nil)})
+				visit(v.Type())
+			}
+			c.Methods = append(c.Methods, method)
+		}
+		schema.Components = append(schema.Components, c)
+	}
+	for _, t := range g.tset.automarshalCandidates.Keys() {
+		visit(t)
+	}
+	sort.Slice(schema.Types, func(i, j int) bool {
+		return schema.Types[i].Name < schema.Types[j].Name
+	})
+
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		g.errors = append(g.errors, err)
+		return
+	}
+	dst := files.NewWriter(filepath.Join(g.pkgDir(), schemaFile))
+	defer dst.Cleanup()
+	if _, err := dst.Write(append(b, '\n')); err != nil {
+		g.errors = append(g.errors, err)
+		return
+	}
+	if err := dst.Close(); err != nil {
+		g.errors = append(g.errors, err)
+	}
+}
+
+// schemaType returns the schema of the provided named type, along with the
+// types nested in it, which also need schemas.
+func (g *generator) schemaType(t *types.Named) (SchemaType, []types.Type) {
+	st := SchemaType{Name: types.TypeString(t, nil)}
+	switch {
+	case nativeCodec(t) != "" || isDuration(t):
+		st.Encoding = "native"
+		return st, nil
+	case g.tset.isProto(t):
+		st.Encoding = "proto"
+		return st, nil
+	case g.tset.implementsAutoMarshal(t) && g.tset.automarshalCandidates.At(t) == nil:
+		st.Encoding = "custom"
+		return st, nil
+	case g.tset.hasMarshalBinary(t):
+		st.Encoding = "binary"
+		return st, nil
+	case isSerializableInterface(t):
+		st.Encoding = "interface"
+		return st, nil
+	}
+
+	s, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		st.Encoding = "weaver"
+		st.Underlying = types.TypeString(t.Underlying(), nil)
+		return st, []types.Type{t.Underlying()}
+	}
+
+	st.Encoding = "weaver"
+	nums, _ := fieldNumbers(s)
+	if isVersioned(t) {
+		st.Encoding = "versioned"
+	}
+	var nested []types.Type
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if f.Embedded() && isWeaverAutoMarshal(f.Type()) {
+			continue
+		}
+		field := SchemaField{Name: f.Name(), Type: types.TypeString(f.Type(), nil)}
+		if nums != nil {
+			field.Number = nums[i]
+		}
+		st.Fields = append(st.Fields, field)
+		nested = append(nested, f.Type())
+	}
+	return st, nested
+}
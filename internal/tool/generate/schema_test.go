@@ -0,0 +1,132 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSchema(t *testing.T) {
+	const src = `package foo
+
+import (
+	"context"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+type ID int64
+
+type Pair struct {
+	weaver.AutoMarshal
+	Key   ID
+	Value []string
+}
+
+type Order struct {
+	weaver.AutoMarshal
+	ID    ID        ` + "`weaver:\"1\"`" + `
+	Pairs []Pair    ` + "`weaver:\"3\"`" + `
+	When  time.Time ` + "`weaver:\"2\"`" + `
+}
+
+type Store interface {
+	//weaver:http GET /orders/{id}
+	Get(ctx context.Context, id ID) (Order, error)
+	Put(ctx context.Context, o *Order) error
+}
+
+type store struct{ weaver.Implements[Store] }
+
+func (store) Get(context.Context, ID) (Order, error) { return Order{}, nil }
+func (store) Put(context.Context, *Order) error     { return nil }
+`
+	tmp := t.TempDir()
+	for f, data := range map[string]string{"foo.go": src, "go.mod": goModFile} {
+		if err := os.WriteFile(filepath.Join(tmp, f), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tidy := exec.Command("go", "mod", "tidy")
+	tidy.Dir = tmp
+	tidy.Stdout = os.Stdout
+	tidy.Stderr = os.Stderr
+	if err := tidy.Run(); err != nil {
+		t.Fatalf("go mod tidy: %v", err)
+	}
+	if err := Generate(tmp, []string{tmp}, Options{Schema: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmp, schemaFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Schema
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := Schema{
+		Package: "foo",
+		Components: []SchemaComponent{{
+			Name:           "foo/Store",
+			Implementation: "foo.store",
+			Methods: []SchemaMethod{
+				{
+					Name:      "Get",
+					Params:    []SchemaValue{{Name: "id", Type: "foo.ID"}},
+					Results:   []SchemaValue{{Type: "foo.Order"}},
+					HTTPRoute: "GET /orders/{id}",
+				},
+				{
+					Name:    "Put",
+					Params:  []SchemaValue{{Name: "o", Type: "*foo.Order"}},
+					Results: []SchemaValue{},
+				},
+			},
+		}},
+		Types: []SchemaType{
+			{Name: "foo.ID", Encoding: "weaver", Underlying: "int64"},
+			{
+				Name:     "foo.Order",
+				Encoding: "versioned",
+				Fields: []SchemaField{
+					{Name: "ID", Type: "foo.ID", Number: 1},
+					{Name: "Pairs", Type: "[]foo.Pair", Number: 3},
+					{Name: "When", Type: "time.Time", Number: 2},
+				},
+			},
+			{
+				Name:     "foo.Pair",
+				Encoding: "weaver",
+				Fields: []SchemaField{
+					{Name: "Key", Type: "foo.ID"},
+					{Name: "Value", Type: "[]string"},
+				},
+			},
+			{Name: "time.Time", Encoding: "native"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("schema (-want +got):\n%s", diff)
+	}
+}
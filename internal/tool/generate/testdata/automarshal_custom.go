@@ -0,0 +1,62 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// EXPECTED
+// enc.EncodeBinaryMarshaler(&a0)
+// (a1).WeaverMarshal(enc)
+// DecodeBinaryUnmarshaler
+// WeaverUnmarshal(dec)
+
+// UNEXPECTED
+// func (x *binary) WeaverMarshal
+// func (x *binary) WeaverUnmarshal
+// func (x *custom) WeaverMarshal
+// func (x *custom) WeaverUnmarshal
+
+// Verify that structs that embed weaver.AutoMarshal but implement their own
+// serialization methods opt out of the generated ones.
+package foo
+
+import (
+	"context"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+)
+
+type binary struct {
+	weaver.AutoMarshal
+	x int
+}
+
+func (binary) MarshalBinary() ([]byte, error) { return nil, nil }
+func (*binary) UnmarshalBinary([]byte) error  { return nil }
+
+type custom struct {
+	weaver.AutoMarshal
+	x int
+}
+
+func (c *custom) WeaverMarshal(enc *codegen.Encoder)   { enc.Int(c.x) }
+func (c *custom) WeaverUnmarshal(dec *codegen.Decoder) { c.x = dec.Int() }
+
+type foo interface {
+	M(context.Context, binary, custom) (binary, custom, error)
+}
+
+type impl struct{ weaver.Implements[foo] }
+
+func (impl) M(context.Context, binary, custom) (binary, custom, error) {
+	return binary{}, custom{}, nil
+}
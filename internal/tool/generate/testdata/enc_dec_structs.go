@@ -37,15 +37,13 @@
 // func (x *W) WeaverUnmarshal(dec *codegen.Decoder)
 // func (x *W) WeaverMarshal(enc *codegen.Encoder)
 // func (x *W) WeaverUnmarshal(dec *codegen.Decoder)
-// EncodeBinaryMarshaler
-// DecodeBinaryUnmarshaler
-
-// UNEXPECTED
+// enc.Time(x.When)
+// dec.Time()
 // Preallocate
 
 // Generate methods for nested structs. Verify that for structs that have
-// all types in the same package or that have custom (Un)marshalBinary methods,
-// enc/dec methods are generated.
+// all types in the same package or that have natively encoded standard library
+// types, enc/dec methods are generated.
 package foo
 
 import (
@@ -0,0 +1,54 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// EXPECTED
+// Name:  "foo/Store[string]",
+// Iface: reflect.TypeOf((*Store[string])(nil)).Elem(),
+// Name:  "foo/Store[int]",
+// Iface: reflect.TypeOf((*Store[int])(nil)).Elem(),
+// impl: impl.(Store[string])
+// impl: impl.(Store[int])
+// Get(ctx context.Context, a0 string) (r0 string, err error)
+// Get(ctx context.Context, a0 string) (r0 int, err error)
+// "foo.Store[string].Get"
+// "foo.Store[int].Get"
+
+// Instantiations of a generic component interface.
+package foo
+
+import (
+	"context"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+type Store[V any] interface {
+	Get(ctx context.Context, key string) (V, error)
+}
+
+type stringStore struct {
+	weaver.Implements[Store[string]]
+}
+
+func (s *stringStore) Get(context.Context, string) (string, error) {
+	return "", nil
+}
+
+type intStore struct {
+	weaver.Implements[Store[int]]
+}
+
+func (s *intStore) Get(context.Context, string) (int, error) {
+	return 0, nil
+}
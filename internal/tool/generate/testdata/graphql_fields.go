@@ -0,0 +1,47 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package foo
+
+import (
+	"context"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+type Product struct {
+	weaver.AutoMarshal
+	ID    string
+	Price float64
+}
+
+type Foo interface {
+	//weaver:graphql query
+	Product(ctx context.Context, id string) (Product, error)
+
+	// Restock adds to the stock of a product.
+	//
+	//weaver:graphql mutation restockProduct
+	Restock(ctx context.Context, id string, n int) error
+
+	Count(ctx context.Context) (int, error)
+}
+
+type foo struct {
+	weaver.Implements[Foo]
+}
+
+func (foo) Product(context.Context, string) (Product, error) { return Product{}, nil }
+func (foo) Restock(context.Context, string, int) error       { return nil }
+func (foo) Count(context.Context) (int, error)               { return 0, nil }
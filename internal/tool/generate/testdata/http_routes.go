@@ -0,0 +1,47 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package foo
+
+import (
+	"context"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+type Item struct {
+	weaver.AutoMarshal
+	ID   string
+	Name string
+}
+
+type Foo interface {
+	//weaver:http GET /items/{id}
+	Get(ctx context.Context, id string) (Item, error)
+
+	// Put stores an item.
+	//
+	//weaver:http PUT /items/{id}
+	Put(ctx context.Context, id string, item Item) error
+
+	List(ctx context.Context) ([]Item, error)
+}
+
+type foo struct {
+	weaver.Implements[Foo]
+}
+
+func (foo) Get(context.Context, string) (Item, error) { return Item{}, nil }
+func (foo) Put(context.Context, string, Item) error   { return nil }
+func (foo) List(context.Context) ([]Item, error)      { return nil, nil }
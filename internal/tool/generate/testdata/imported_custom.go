@@ -15,8 +15,6 @@
 // EXPECTED
 // time
 // A(ctx context.Context, a0 time.Duration)
-
-// UNEXPECTED
 // Preallocate
 
 // Imported type with non-default package name.
@@ -0,0 +1,60 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// EXPECTED
+// enc.Interface(a0)
+// r0 = codegen.DecodeInterface[event](dec)
+// enc.Interface(x.last)
+// codegen.RegisterSerializable[created]()
+// codegen.RegisterSerializable[deleted]()
+// codegen.RegisterSerializable[log]()
+
+// Verify that named interface types are serializable, and that the types that
+// embed weaver.AutoMarshal are registered.
+package foo
+
+import (
+	"context"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+type event interface{ isEvent() }
+
+type created struct {
+	weaver.AutoMarshal
+	id string
+}
+
+type deleted struct {
+	weaver.AutoMarshal
+	id string
+}
+
+func (created) isEvent()  {}
+func (*deleted) isEvent() {}
+
+type log struct {
+	weaver.AutoMarshal
+	events []event
+	last   event
+}
+
+type foo interface {
+	M(context.Context, event, log) (event, error)
+}
+
+type impl struct{ weaver.Implements[foo] }
+
+func (impl) M(_ context.Context, e event, _ log) (event, error) { return e, nil }
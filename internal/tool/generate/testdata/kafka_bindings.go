@@ -0,0 +1,41 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package foo
+
+import (
+	"context"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/kafka"
+)
+
+type Foo interface {
+	//weaver:kafka orders emailer
+	OnOrder(ctx context.Context, msg kafka.Message) error
+
+	Count(ctx context.Context) (int, error)
+}
+
+type fooRouter struct{}
+
+func (fooRouter) OnOrder(_ context.Context, msg kafka.Message) int32 { return msg.Partition }
+
+type foo struct {
+	weaver.Implements[Foo]
+	weaver.WithRouter[fooRouter]
+}
+
+func (foo) OnOrder(context.Context, kafka.Message) error { return nil }
+func (foo) Count(context.Context) (int, error)           { return 0, nil }
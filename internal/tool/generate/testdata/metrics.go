@@ -16,10 +16,12 @@
 // codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "foo/foo", Method: "Method"})
 // methodMetrics *codegen.MethodMetrics
 // start := time.Now()
-// s.methodMetrics.Count.Add(1)
-// s.methodMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
-// s.methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
-// s.methodMetrics.BytesReply.Put(float64(len(results)))
+// methodMetrics := s.methodMetrics.ForContext(ctx)
+// methodMetrics.Count.Add(1)
+// methodMetrics.ErrorCount.Add(1)
+// methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+// methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+// methodMetrics.BytesReply.Put(float64(len(results)))
 
 package foo
 
@@ -22,12 +22,11 @@
 // enc.Int(a1)
 // func (x *Bar) WeaverMarshal(enc *codegen.Encoder)
 // func (x *Bar) WeaverUnmarshal(dec *codegen.Decoder)
-// EncodeBinaryMarshaler
+// enc.Time(x.T)
 // &impl{}
 
 // UNEXPECTED
 // c.Args.Encode(a3)
-// Preallocate
 
 // Multiple args.
 package foo
@@ -17,7 +17,9 @@
 // codegen.Register(codegen.Registration{
 // Routed:
 // true,
-// _hashFoo(r.M(ctx))
+// _hashFoo(_routerFoo().M(ctx))
+// reflect.TypeOf((*foo_router)(nil)).Elem(),
+// func _routerFoo() foo_router
 // func _hashFoo(r int) uint64
 // func _orderedCodeFoo(r int)
 
@@ -0,0 +1,77 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// EXPECTED
+// codegen.RegisterRefs(
+// /a", "
+// /b")
+
+// UNEXPECTED
+// /c")
+
+// Components that fetch other components.
+package foo
+
+import (
+	"context"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+type a interface {
+	M(context.Context) error
+}
+
+type b interface {
+	M(context.Context) error
+}
+
+type c interface {
+	M(context.Context) error
+}
+
+type aImpl struct {
+	weaver.Implements[a]
+}
+
+func (x *aImpl) Init(context.Context) error {
+	_, err := weaver.Get[b](x)
+	return err
+}
+
+func (x *aImpl) M(context.Context) error {
+	return nil
+}
+
+type bImpl struct {
+	weaver.Implements[b]
+}
+
+func (x *bImpl) M(context.Context) error {
+	return nil
+}
+
+type cImpl struct {
+	weaver.Implements[c]
+}
+
+func (x *cImpl) M(context.Context) error {
+	return nil
+}
+
+// getC is not a method of a component implementation, so the call to
+// weaver.Get is not attributed to any component.
+func getC(root weaver.Instance) (c, error) {
+	return weaver.Get[c](root)
+}
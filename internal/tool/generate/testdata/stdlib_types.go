@@ -0,0 +1,67 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// EXPECTED
+// enc.Time(a0)
+// enc.Int64((int64)(a1))
+// enc.Addr(a2)
+// enc.BigInt(arg)
+// (enc, (*[16]byte)(&a4))
+// (enc, (*[16]byte)(&x.id))
+// (dec, (*[16]byte)(&x.id))
+// copy(enc.Grow(16), arg[:])
+// copy(res[:], dec.Read(16))
+// dec.Time()
+// dec.Addr()
+// dec.BigInt(&res)
+// size += 16
+
+// UNEXPECTED
+// EncodeBinaryMarshaler
+// DecodeBinaryUnmarshaler
+
+// Verify that common standard library types, and UUID-like types, have native
+// encodings.
+package foo
+
+import (
+	"context"
+	"math/big"
+	"net/netip"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+// UUID is a UUID-like type that implements encoding.BinaryMarshaler.
+type UUID [16]byte
+
+func (u UUID) MarshalBinary() ([]byte, error)  { return u[:], nil }
+func (u *UUID) UnmarshalBinary(b []byte) error { copy(u[:], b); return nil }
+
+type event struct {
+	weaver.AutoMarshal
+	at time.Time
+	id UUID
+}
+
+type foo interface {
+	M(context.Context, time.Time, time.Duration, netip.Addr, *big.Int, UUID, []event) (time.Time, error)
+}
+
+type impl struct{ weaver.Implements[foo] }
+
+func (impl) M(context.Context, time.Time, time.Duration, netip.Addr, *big.Int, UUID, []event) (time.Time, error) {
+	return time.Time{}, nil
+}
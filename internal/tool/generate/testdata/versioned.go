@@ -0,0 +1,46 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// EXPECTED
+// enc.Len(2)
+// f1 := enc.BeginField(1)
+// enc.EndField(f3)
+// switch num, field := dec.Field(); num {
+// x.b = field.Int()
+
+// UNEXPECTED
+// serviceweaver_size_versioned
+
+// Verify that structs with numbered fields have versioned encodings.
+package foo
+
+import (
+	"context"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+type versioned struct {
+	weaver.AutoMarshal
+	a string `weaver:"1"`
+	b int    `weaver:"3"`
+}
+
+type foo interface {
+	M(context.Context, versioned, []versioned) error
+}
+
+type impl struct{ weaver.Implements[foo] }
+
+func (impl) M(context.Context, versioned, []versioned) error { return nil }
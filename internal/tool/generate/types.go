@@ -18,7 +18,9 @@ import (
 	"fmt"
 	"go/types"
 	"path"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 
 	"golang.org/x/tools/go/packages"
@@ -290,7 +292,16 @@ func (tset *typeSet) checkSerializable(t types.Type) []error {
 			// since the Go compiler takes care of that.
 
 			// Check if the type implements one of the marshaler interfaces.
-			if tset.isProto(x) || tset.automarshals.At(t) != nil || tset.implementsAutoMarshal(x) || tset.hasMarshalBinary(x) {
+			if nativeCodec(x) != "" || tset.isProto(x) || tset.automarshals.At(t) != nil || tset.implementsAutoMarshal(x) || tset.hasMarshalBinary(x) {
+				tset.checked.Set(t, true)
+				break
+			}
+
+			// Named interface types are serializable. Their values are
+			// serialized along with a tag that identifies their dynamic
+			// type, which must be registered with
+			// codegen.RegisterSerializable.
+			if isSerializableInterface(x) {
 				tset.checked.Set(t, true)
 				break
 			}
@@ -404,7 +415,8 @@ func (tset *typeSet) sizeOfType(t types.Type) int {
 	//   s(basic) = size of basic
 	//   s([N]t) = N * s(t), if t is fixed size
 	//   s(struct{..., fi:ti, ...}) = sum of s(ti), if every ti is fixed size
-	//   s(type t u) = s(u)
+	//   s(time.Time) = 16
+	//   s(type t u) = s(u), if t is not a versioned struct
 	//   s(_) = -1
 	if size := tset.sizes.At(t); size != nil {
 		return size.(int)
@@ -451,6 +463,18 @@ func (tset *typeSet) sizeOfType(t types.Type) int {
 		return size
 
 	case *types.Named:
+		if nativeCodec(x) == "Time" {
+			// See codegen.Encoder.Time.
+			return 16
+		}
+		if nativeCodec(x) != "" {
+			return -1
+		}
+		if isVersioned(x) {
+			// The encoding of a versioned struct includes field headers.
+			tset.sizes.Set(t, -1)
+			return -1
+		}
 		size := tset.sizeOfType(x.Underlying())
 		tset.sizes.Set(t, size)
 		return size
@@ -477,7 +501,8 @@ func (tset *typeSet) sizeOfType(t types.Type) int {
 //   - For simplicity, we only consider a type measurable if the type and all
 //     its nested types are package local. For example, a struct { x
 //     otherpackage.T } is not measurable, even if otherpackage.T is
-//     measurable. We make an exception for weaver.AutoMarshal.
+//     measurable. We make an exception for weaver.AutoMarshal,
+//     time.Time, and time.Duration.
 func (tset *typeSet) isMeasurable(t types.Type) bool {
 	rootPkg := tset.pkg.Types
 
@@ -490,6 +515,8 @@ func (tset *typeSet) isMeasurable(t types.Type) bool {
 	//     m(map[k]v) = true if k and v are fixed size.
 	//     m(struct{..., fi:ti, ...}) = true, if every ti is measurable.
 	//     m(weaver.AutoMarshal) = true
+	//     m(time.Time) = m(time.Duration) = true
+	//     m(versioned struct) = false
 	//     m(type t u) = m(u), if t is package local
 	//     m(_) = false
 	if result := tset.measurable.At(t); result != nil {
@@ -536,8 +563,13 @@ func (tset *typeSet) isMeasurable(t types.Type) bool {
 		tset.measurable.Set(t, measurable)
 
 	case *types.Named:
-		if isWeaverAutoMarshal(x) {
+		if isWeaverAutoMarshal(x) || nativeCodec(x) == "Time" || isDuration(x) {
 			tset.measurable.Set(t, true)
+		} else if nativeCodec(x) != "" {
+			tset.measurable.Set(t, false)
+		} else if isVersioned(x) {
+			// The encoding of a versioned struct includes field headers.
+			tset.measurable.Set(t, false)
 		} else if x.Obj().Pkg() != rootPkg {
 			tset.measurable.Set(t, false)
 		} else {
@@ -745,8 +777,18 @@ func isDecoderPtr(t types.Type) bool {
 
 // hasMarshalBinary returns whether the provided type is a concrete type that
 // implements the encoding.BinaryMarshaler and binary.BinaryUnmarshaler
-// interfaces.
+// interfaces. Standard library types with native encodings (see
+// nativeCodec) and UUID-like [16]byte types are encoded natively, even if
+// they implement the interfaces.
 func (tset *typeSet) hasMarshalBinary(t types.Type) bool {
+	if p, ok := t.(*types.Pointer); ok {
+		if nativeCodec(p.Elem()) != "" || isUUID(p.Elem()) {
+			return false
+		}
+	}
+	if nativeCodec(t) != "" || isUUID(t) {
+		return false
+	}
 	if _, ok := t.Underlying().(*types.Interface); ok {
 		// A superinterface of BinaryMarshaler and BinaryUnmarshaler does
 		// "implement" the interfaces, but we only accept concrete types that
@@ -868,6 +910,66 @@ func isWeaverAutoMarshal(t types.Type) bool {
 	return isWeaverType(t, "AutoMarshal", 0)
 }
 
+// fieldNumbers returns the field numbers of the fields of the provided struct,
+// which embeds weaver.AutoMarshal, as given by `weaver:"N"` tags, or nil if
+// the fields aren't numbered. The embedded weaver.AutoMarshal has number 0.
+// Structs with numbered fields have versioned encodings, which tolerate the
+// addition and removal of fields.
+func fieldNumbers(s *types.Struct) ([]int, error) {
+	nums := make([]int, s.NumFields())
+	seen := map[int]string{}
+	numbered, unnumbered := 0, 0
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if f.Embedded() && isWeaverAutoMarshal(f.Type()) {
+			continue
+		}
+		tag, ok := reflect.StructTag(s.Tag(i)).Lookup("weaver")
+		if !ok {
+			unnumbered++
+			continue
+		}
+		num, err := strconv.Atoi(tag)
+		if err != nil || num <= 0 {
+			return nil, fmt.Errorf("field %s: invalid field number %q; field numbers are positive integers", f.Name(), tag)
+		}
+		if other, ok := seen[num]; ok {
+			return nil, fmt.Errorf("fields %s and %s have the same field number %d", other, f.Name(), num)
+		}
+		seen[num] = f.Name()
+		nums[i] = num
+		numbered++
+	}
+	if numbered == 0 {
+		return nil, nil
+	}
+	if unnumbered > 0 {
+		return nil, fmt.Errorf("either every field or no field must have a field number")
+	}
+	return nums, nil
+}
+
+// isVersioned returns whether the provided type is a struct that embeds
+// weaver.AutoMarshal and has numbered fields. See fieldNumbers.
+func isVersioned(t types.Type) bool {
+	n, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	s, ok := n.Underlying().(*types.Struct)
+	if !ok {
+		return false
+	}
+	automarshal := false
+	for i := 0; i < s.NumFields(); i++ {
+		if f := s.Field(i); f.Embedded() && isWeaverAutoMarshal(f.Type()) {
+			automarshal = true
+		}
+	}
+	nums, err := fieldNumbers(s)
+	return automarshal && err == nil && nums != nil
+}
+
 func isContext(t types.Type) bool {
 	n, ok := t.(*types.Named)
 	if !ok {
@@ -876,6 +978,14 @@ func isContext(t types.Type) bool {
 	return n.Obj().Pkg().Path() == "context" && n.Obj().Name() == "Context"
 }
 
+func isDuration(t types.Type) bool {
+	n, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	return n.Obj().Pkg() != nil && n.Obj().Pkg().Path() == "time" && n.Obj().Name() == "Duration"
+}
+
 func isError(t types.Type) bool {
 	n, ok := t.(*types.Named)
 	if !ok {
@@ -884,6 +994,54 @@ func isError(t types.Type) bool {
 	return n.Obj().Pkg() == nil && n.Obj().Name() == "error"
 }
 
+// nativeCodec returns the name of the codegen.Encoder and codegen.Decoder
+// methods that natively serialize the provided standard library type, or ""
+// if the type doesn't have a native encoding. For example, nativeCodec
+// returns "Time" for time.Time, which is encoded with enc.Time(t) and decoded
+// with dec.Time().
+func nativeCodec(t types.Type) string {
+	n, ok := t.(*types.Named)
+	if !ok || n.Obj().Pkg() == nil {
+		return ""
+	}
+	switch path, name := n.Obj().Pkg().Path(), n.Obj().Name(); {
+	case path == "time" && name == "Time":
+		return "Time"
+	case path == "net/netip" && name == "Addr":
+		return "Addr"
+	case path == "math/big" && name == "Int":
+		return "BigInt"
+	default:
+		return ""
+	}
+}
+
+// isUUID returns whether the provided type is a named [16]byte type, like
+// uuid.UUID. These types are encoded as 16 raw bytes, even if they implement
+// encoding.BinaryMarshaler.
+func isUUID(t types.Type) bool {
+	if _, ok := t.(*types.Named); !ok {
+		return false
+	}
+	a, ok := t.Underlying().(*types.Array)
+	return ok && a.Len() == 16 && isByte(a.Elem())
+}
+
+// isByte returns whether the provided type is byte (or uint8).
+func isByte(t types.Type) bool {
+	return types.Identical(t, types.Typ[types.Byte])
+}
+
+// isSerializableInterface returns whether the provided type is a named,
+// non-generic interface type other than error, whose values are serialized
+// with codegen.Encoder.Interface.
+func isSerializableInterface(t *types.Named) bool {
+	if _, ok := t.Underlying().(*types.Interface); !ok {
+		return false
+	}
+	return !isError(t) && t.TypeParams() == nil && t.TypeArgs() == nil
+}
+
 // isPrimitiveRouter returns whether the provided type is a valid primitive
 // router type (i.e. an integer, a float, or a string).
 func isPrimitiveRouter(t types.Type) bool {
@@ -104,6 +104,12 @@ type target interface{
 	MarshalBinary() ([]byte, error)
 	UnmarshalBinary([]byte) error
 }
+`, ""},
+		{"unnamed interface", `
+type target []interface{ M() }
+`, "not currently supported"},
+		{"error", `
+type target []error
 `, "not currently supported"},
 		{"simple recursive", `
 type target *target
@@ -0,0 +1,150 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/tools/go/packages"
+)
+
+// watchDelay is how long Watch waits for more changes after a change, before
+// regenerating code. Editors often save a file with multiple writes, and
+// tools like gofmt or git touch many files at once.
+const watchDelay = 200 * time.Millisecond
+
+// Watch generates code for the specified packages, like Generate, and then
+// watches the packages' directories, regenerating the code for a package
+// whenever one of its Go files changes. Watch runs until ctx is done.
+// Generation errors are reported to w, along with the packages that were
+// regenerated, so that the user can fix the errors and carry on.
+//
+// Note that Watch only watches the packages that exist when it starts.
+func Watch(ctx context.Context, dir string, pkgs []string, opt Options, w io.Writer) error {
+	dirs, err := packageDirs(dir, pkgs)
+	if err != nil {
+		return err
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+	for _, d := range dirs {
+		if err := fsw.Add(d); err != nil {
+			return fmt.Errorf("watch %s: %w", d, err)
+		}
+	}
+
+	wt := &watcher{
+		w: w,
+		generate: func(dirs []string) error {
+			return Generate(dir, dirs, opt)
+		},
+	}
+	wt.run(dirs)
+	return wt.watch(ctx, fsw.Events, fsw.Errors)
+}
+
+// packageDirs returns the directories of the specified packages.
+func packageDirs(dir string, pkgs []string) ([]string, error) {
+	cfg := &packages.Config{Mode: packages.NeedName | packages.NeedFiles, Dir: dir}
+	pkgList, err := packages.Load(cfg, pkgs...)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, p := range pkgList {
+		files := append(p.GoFiles, p.IgnoredFiles...)
+		if len(files) == 0 {
+			continue
+		}
+		dirs = append(dirs, filepath.Dir(files[0]))
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no packages found for %v", pkgs)
+	}
+	return dirs, nil
+}
+
+// watcher regenerates code in response to file system events.
+type watcher struct {
+	w        io.Writer                 // where results are reported
+	generate func(dirs []string) error // generates code for packages in dirs
+}
+
+// watch handles file system events until ctx is done.
+func (wt *watcher) watch(ctx context.Context, events <-chan fsnotify.Event, errs <-chan error) error {
+	dirty := map[string]bool{} // directories of changed packages
+	timer := time.NewTimer(0)
+	<-timer.C
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+
+		case err := <-errs:
+			fmt.Fprintf(wt.w, "watch: %v\n", err)
+
+		case event := <-events:
+			if !triggersGenerate(event) {
+				continue
+			}
+			if len(dirty) == 0 {
+				timer.Reset(watchDelay)
+			}
+			dirty[filepath.Dir(event.Name)] = true
+
+		case <-timer.C:
+			dirs := make([]string, 0, len(dirty))
+			for d := range dirty {
+				dirs = append(dirs, d)
+			}
+			sort.Strings(dirs)
+			dirty = map[string]bool{}
+			wt.run(dirs)
+		}
+	}
+}
+
+// run generates code for the packages in dirs and reports the result.
+func (wt *watcher) run(dirs []string) {
+	if err := wt.generate(dirs); err != nil {
+		fmt.Fprintf(wt.w, "%s generate %s:\n%v\n", time.Now().Format(time.Kitchen), strings.Join(dirs, " "), err)
+		return
+	}
+	fmt.Fprintf(wt.w, "%s generated %s\n", time.Now().Format(time.Kitchen), strings.Join(dirs, " "))
+}
+
+// triggersGenerate returns whether the event should trigger code generation.
+func triggersGenerate(event fsnotify.Event) bool {
+	name := filepath.Base(event.Name)
+	if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || name == generatedCodeFile {
+		return false
+	}
+	// Ignore editor temporary files like .foo.go.swp or #foo.go#.
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "#") {
+		return false
+	}
+	return event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) != 0
+}
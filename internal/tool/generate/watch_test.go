@@ -0,0 +1,80 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTriggersGenerate(t *testing.T) {
+	for _, test := range []struct {
+		event fsnotify.Event
+		want  bool
+	}{
+		{fsnotify.Event{Name: "/a/foo.go", Op: fsnotify.Write}, true},
+		{fsnotify.Event{Name: "/a/foo.go", Op: fsnotify.Create}, true},
+		{fsnotify.Event{Name: "/a/foo.go", Op: fsnotify.Remove}, true},
+		{fsnotify.Event{Name: "/a/foo.go", Op: fsnotify.Chmod}, false},
+		{fsnotify.Event{Name: "/a/weaver_gen.go", Op: fsnotify.Write}, false},
+		{fsnotify.Event{Name: "/a/foo_test.go", Op: fsnotify.Write}, false},
+		{fsnotify.Event{Name: "/a/.foo.go.swp", Op: fsnotify.Write}, false},
+		{fsnotify.Event{Name: "/a/README.md", Op: fsnotify.Write}, false},
+	} {
+		if got := triggersGenerate(test.event); got != test.want {
+			t.Errorf("triggersGenerate(%v): got %t, want %t", test.event, got, test.want)
+		}
+	}
+}
+
+func TestWatchBatchesChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	generated := make(chan []string)
+	wt := &watcher{
+		w: io.Discard,
+		generate: func(dirs []string) error {
+			generated <- dirs
+			return nil
+		},
+	}
+	events := make(chan fsnotify.Event)
+	done := make(chan error)
+	go func() { done <- wt.watch(ctx, events, nil) }()
+
+	// Changes made in quick succession are batched, and every package is
+	// regenerated once.
+	events <- fsnotify.Event{Name: "/b/b.go", Op: fsnotify.Write}
+	events <- fsnotify.Event{Name: "/a/weaver_gen.go", Op: fsnotify.Write}
+	events <- fsnotify.Event{Name: "/a/a.go", Op: fsnotify.Write}
+	events <- fsnotify.Event{Name: "/b/b.go", Op: fsnotify.Write}
+	if diff := cmp.Diff([]string{"/a", "/b"}, <-generated); diff != "" {
+		t.Errorf("generated (-want +got):\n%s", diff)
+	}
+
+	events <- fsnotify.Event{Name: "/a/a.go", Op: fsnotify.Write}
+	if diff := cmp.Diff([]string{"/a"}, <-generated); diff != "" {
+		t.Errorf("generated (-want +got):\n%s", diff)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("watch: got %v, want context.Canceled", err)
+	}
+}
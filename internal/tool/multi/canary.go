@@ -0,0 +1,167 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multi
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ServiceWeaver/weaver/internal/babysitter"
+	"github.com/ServiceWeaver/weaver/internal/status"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+)
+
+var (
+	promoteCmd = tool.Command{
+		Name:        "promote",
+		Description: "Promote a canary deployment",
+		Help: `Usage:
+  weaver multi promote <deployment>
+
+Flags:
+  -h, --help	Print this help message.
+
+Description:
+  'weaver multi promote <deployment>' promotes a canary deployment, started
+  with 'weaver multi deploy --canary'. The canary takes over the listeners of
+  the deployment it is a canary of, which then stops. <deployment> is the id,
+  or a uniquely identifying prefix of the id, of the canary deployment.`,
+		Flags: flag.NewFlagSet("promote", flag.ContinueOnError),
+		Fn: func(ctx context.Context, args []string) error {
+			return canaryCommand(ctx, "promote", args, babysitter.PromoteCanary)
+		},
+	}
+
+	rollbackCmd = tool.Command{
+		Name:        "rollback",
+		Description: "Roll back a canary deployment",
+		Help: `Usage:
+  weaver multi rollback <deployment>
+
+Flags:
+  -h, --help	Print this help message.
+
+Description:
+  'weaver multi rollback <deployment>' rolls back a canary deployment,
+  started with 'weaver multi deploy --canary'. All traffic is sent back to the
+  deployment it is a canary of, and the canary stops. <deployment> is the id,
+  or a uniquely identifying prefix of the id, of the canary deployment.`,
+		Flags: flag.NewFlagSet("rollback", flag.ContinueOnError),
+		Fn: func(ctx context.Context, args []string) error {
+			return canaryCommand(ctx, "rollback", args, babysitter.RollbackCanary)
+		},
+	}
+)
+
+// canaryCommand runs the named canary command, which calls fn with the status
+// server address of the deployment identified by args.
+func canaryCommand(ctx context.Context, name string, args []string, fn func(context.Context, string) error) error {
+	if len(args) != 1 || args[0] == "" {
+		return fmt.Errorf("usage: weaver multi %s <deployment>", name)
+	}
+	reg, err := findDeployment(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if err := fn(ctx, reg.Addr); err != nil {
+		return fmt.Errorf("%s canary %s: %w", name, reg.DeploymentId, err)
+	}
+	return nil
+}
+
+// canaryOptions returns the options of a canary deployment of the provided
+// app, as specified by the deploy flags.
+func canaryOptions(ctx context.Context, app string) (babysitter.CanaryOptions, error) {
+	stable, err := stableDeployment(ctx, *canaryOf, app)
+	if err != nil {
+		return babysitter.CanaryOptions{}, err
+	}
+	listeners, err := parseListenerTraffic(*listenerTraffic)
+	if err != nil {
+		return babysitter.CanaryOptions{}, err
+	}
+	if *traffic < 0 || *traffic > 100 {
+		return babysitter.CanaryOptions{}, fmt.Errorf("invalid --traffic %v not between 0 and 100", *traffic)
+	}
+	return babysitter.CanaryOptions{
+		StableAddr:      stable.Addr,
+		Traffic:         *traffic,
+		ListenerTraffic: listeners,
+	}, nil
+}
+
+// stableDeployment returns the registration of the active deployment of the
+// provided app whose id has the provided prefix.
+func stableDeployment(ctx context.Context, prefix, app string) (status.Registration, error) {
+	stable, err := findDeployment(ctx, prefix)
+	if err != nil {
+		return status.Registration{}, err
+	}
+	if stable.App != app {
+		return status.Registration{}, fmt.Errorf("deployment %s is of app %q, not %q", stable.DeploymentId, stable.App, app)
+	}
+	return stable, nil
+}
+
+// parseListenerTraffic parses a comma-separated list of listener=percentage
+// pairs.
+func parseListenerTraffic(s string) (map[string]float64, error) {
+	traffic := map[string]float64{}
+	if s == "" {
+		return traffic, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --listener_traffic %q: want listener=percentage", pair)
+		}
+		t, err := strconv.ParseFloat(value, 64)
+		if err != nil || t < 0 || t > 100 {
+			return nil, fmt.Errorf("invalid --listener_traffic %q: percentage not between 0 and 100", pair)
+		}
+		traffic[name] = t
+	}
+	return traffic, nil
+}
+
+// findDeployment returns the registration of the active deployment whose id
+// has the provided prefix.
+func findDeployment(ctx context.Context, prefix string) (status.Registration, error) {
+	registry, err := defaultRegistry(ctx)
+	if err != nil {
+		return status.Registration{}, fmt.Errorf("create registry: %w", err)
+	}
+	regs, err := registry.List(ctx)
+	if err != nil {
+		return status.Registration{}, fmt.Errorf("get registrations: %w", err)
+	}
+	var candidates []status.Registration
+	for _, reg := range regs {
+		if strings.HasPrefix(reg.DeploymentId, prefix) {
+			candidates = append(candidates, reg)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return status.Registration{}, fmt.Errorf("no deployment with prefix %q found", prefix)
+	case 1:
+		return candidates[0], nil
+	default:
+		return status.Registration{}, fmt.Errorf("multiple deployments with prefix %q found", prefix)
+	}
+}
@@ -26,12 +26,14 @@ import (
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/ServiceWeaver/weaver/internal/babysitter"
 	"github.com/ServiceWeaver/weaver/internal/status"
 	"github.com/ServiceWeaver/weaver/runtime"
 	"github.com/ServiceWeaver/weaver/runtime/codegen"
 	"github.com/ServiceWeaver/weaver/runtime/colors"
+	"github.com/ServiceWeaver/weaver/runtime/logexport"
 	"github.com/ServiceWeaver/weaver/runtime/logging"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
 	"github.com/ServiceWeaver/weaver/runtime/retry"
@@ -39,13 +41,49 @@ import (
 	"github.com/google/uuid"
 )
 
-var deployCmd = tool.Command{
-	Name:        "deploy",
-	Description: "Deploy a Service Weaver app",
-	Help:        "Usage:\n  weaver multi deploy <configfile>",
-	Flags:       flag.NewFlagSet("deploy", flag.ContinueOnError),
-	Fn:          deploy,
-}
+var (
+	deployFlags     = flag.NewFlagSet("deploy", flag.ContinueOnError)
+	canaryOf        = deployFlags.String("canary", "", "Deploy a canary of the deployment with the provided id or id prefix.")
+	traffic         = deployFlags.Float64("traffic", 10, "Percentage of traffic forwarded to the canary.")
+	listenerTraffic = deployFlags.String("listener_traffic", "", "Percentage of traffic forwarded to the canary, by listener (e.g., checkout=5,api=20).")
+	shadowOf        = deployFlags.String("shadow", "", "Deploy a shadow of the deployment with the provided id or id prefix.")
+
+	deployCmd = tool.Command{
+		Name:        "deploy",
+		Description: "Deploy a Service Weaver app",
+		Help: `Usage:
+  weaver multi deploy [--canary=<deployment> [options]] <configfile>...
+  weaver multi deploy --shadow=<deployment> <configfile>...
+
+Flags:
+  -h, --help	Print this help message.
+` + tool.FlagsHelp(deployFlags) + `
+
+Description:
+  'weaver multi deploy <configfile>' deploys an application on the local
+  machine. Config files may be written in TOML, YAML, or JSON. If multiple
+  config files are provided, they are merged, with later files overriding
+  the settings of earlier ones.
+
+  With --canary, the application is deployed as a canary of the provided
+  deployment of the same application. The canary receives a percentage of the
+  traffic of the deployment's listeners. Use 'weaver multi promote' to send
+  all traffic to the canary and stop the old deployment, or 'weaver multi
+  rollback' to stop the canary.
+
+  With --shadow, the application is deployed as a shadow of the provided
+  deployment of the same application. The shadow receives no traffic of its
+  own. Instead, the deployment mirrors calls to the components configured
+  with a mirror policy to the shadow, and discards the replies.`,
+		Flags: deployFlags,
+		Fn:    deploy,
+	}
+)
+
+const (
+	multiKey      = "github.com/ServiceWeaver/weaver/multi"
+	shortMultiKey = "multi"
+)
 
 // deploy deploys an application on the local machine using a multiprocess
 // deployer. Note that each component is deployed as a separate OS process.
@@ -54,19 +92,10 @@ func deploy(ctx context.Context, args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("no config file provided")
 	}
-	if len(args) > 1 {
-		return fmt.Errorf("too many arguments")
-	}
-
-	// Load the config file.
-	cfgFile := args[0]
-	cfg, err := os.ReadFile(cfgFile)
+	// Load the config files.
+	app, err := runtime.LoadConfig(args, codegen.ComponentConfigValidator)
 	if err != nil {
-		return fmt.Errorf("load config file %q: %w\n", cfgFile, err)
-	}
-	app, err := runtime.ParseConfig(cfgFile, string(cfg), codegen.ComponentConfigValidator)
-	if err != nil {
-		return fmt.Errorf("load config file %q: %w\n", cfgFile, err)
+		return fmt.Errorf("load config: %w", err)
 	}
 
 	// Sanity check the config.
@@ -81,6 +110,24 @@ func deploy(ctx context.Context, args []string) error {
 	}
 	logSaver := fs.Add
 
+	// Export the logs, if configured.
+	exporters, err := logexport.ParseConfig(multiKey, shortMultiKey, app.Sections)
+	if err != nil {
+		return fmt.Errorf("unable to parse multi config: %w", err)
+	}
+	var exportLogs *logexport.Pipeline
+	if len(exporters) > 0 {
+		exportLogs = logexport.NewPipeline(exporters, logexport.Options{
+			OnError: func(err error) {
+				fmt.Fprintf(os.Stderr, "export logs: %v\n", err)
+			},
+		})
+		logSaver = func(entry *protos.LogEntry) {
+			fs.Add(entry)
+			exportLogs.Add(entry)
+		}
+	}
+
 	// Create the babysitter.
 	dep := &protos.Deployment{
 		Id:  uuid.New().String(),
@@ -90,6 +137,29 @@ func deploy(ctx context.Context, args []string) error {
 	if err != nil {
 		return fmt.Errorf("create babysitter: %w", err)
 	}
+	chaos, err := chaosOptions(app)
+	if err != nil {
+		return err
+	}
+	if chaos != nil {
+		b.SetChaos(*chaos)
+	}
+	switch {
+	case *canaryOf != "" && *shadowOf != "":
+		return fmt.Errorf("--canary and --shadow are mutually exclusive")
+	case *canaryOf != "":
+		opts, err := canaryOptions(ctx, app.Name)
+		if err != nil {
+			return err
+		}
+		b.SetCanary(opts)
+	case *shadowOf != "":
+		stable, err := stableDeployment(ctx, *shadowOf, app.Name)
+		if err != nil {
+			return err
+		}
+		b.SetShadow(stable.Addr)
+	}
 
 	// Run a status server.
 	lis, err := net.Listen("tcp", "localhost:0")
@@ -144,16 +214,28 @@ func deploy(ctx context.Context, args []string) error {
 		return fmt.Errorf("register deployment: %w", err)
 	}
 
-	// Wait for the user to kill the app.
+	// Wait for the user to kill the app, or for the deployment to retire.
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
-		<-done // Will block here until user hits ctrl+c
-		fmt.Fprintf(os.Stderr, "Application %s terminated\n", app.Name)
+		code := 1
+		select {
+		case <-done: // Will block here until user hits ctrl+c
+			fmt.Fprintf(os.Stderr, "Application %s terminated\n", app.Name)
+			if err := b.Detach(ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "detach deployment: %v\n", err)
+			}
+		case <-b.Retired():
+			fmt.Fprintf(os.Stderr, "Deployment %s retired\n", dep.Id)
+			code = 0
+		}
 		if err := registry.Unregister(ctx, dep.Id); err != nil {
 			fmt.Fprintf(os.Stderr, "unregister deployment: %v\n", err)
 		}
-		os.Exit(1)
+		if exportLogs != nil {
+			exportLogs.Close()
+		}
+		os.Exit(code)
 	}()
 
 	// Follow the logs.
@@ -175,6 +257,43 @@ func deploy(ctx context.Context, args []string) error {
 	}
 }
 
+// chaosOptions returns the chaos options in the [multi.chaos] section of the
+// provided config, or nil if the section is absent.
+func chaosOptions(app *protos.AppConfig) (*babysitter.ChaosOptions, error) {
+	type chaosConfigSchema struct {
+		KillInterval     time.Duration `toml:"kill_interval"`
+		DelayProbability float64       `toml:"delay_probability"`
+		Delay            time.Duration `toml:"delay"`
+		DropProbability  float64       `toml:"drop_probability"`
+	}
+	type multiConfigSchema struct {
+		Chaos        *chaosConfigSchema `toml:"chaos"`
+		LogExporters []logexport.Config `toml:"log_exporters"` // see deploy
+	}
+	parsed := &multiConfigSchema{}
+	if err := runtime.ParseConfigSection(multiKey, shortMultiKey, app.Sections, parsed); err != nil {
+		return nil, fmt.Errorf("unable to parse multi config: %w", err)
+	}
+	c := parsed.Chaos
+	if c == nil {
+		return nil, nil
+	}
+	if c.KillInterval < 0 || c.Delay < 0 {
+		return nil, fmt.Errorf("chaos: invalid negative duration")
+	}
+	for _, p := range []float64{c.DelayProbability, c.DropProbability} {
+		if p < 0 || p > 1 {
+			return nil, fmt.Errorf("chaos: invalid probability %v not between 0 and 1", p)
+		}
+	}
+	return &babysitter.ChaosOptions{
+		KillInterval:     c.KillInterval,
+		DelayProbability: c.DelayProbability,
+		Delay:            c.Delay,
+		DropProbability:  c.DropProbability,
+	}, nil
+}
+
 // defaultRegistry returns the default registry in
 // $XDG_DATA_HOME/serviceweaver/multi_registry, or
 // ~/.local/share/serviceweaver/multi_registry if XDG_DATA_HOME is not set.
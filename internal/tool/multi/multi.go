@@ -37,12 +37,16 @@ var (
 				{Label: "cat logs", Command: fmt.Sprintf("weaver multi logs 'version==%q'", logging.Shorten(deploymentId))},
 				{Label: "follow logs", Command: fmt.Sprintf("weaver multi logs --follow 'version==%q'", logging.Shorten(deploymentId))},
 				{Label: "profile", Command: fmt.Sprintf("weaver multi profile --duration=30s %s", deploymentId)},
+				{Label: "top", Command: fmt.Sprintf("weaver multi top %s", logging.Shorten(deploymentId))},
 			}
 		},
 	}
 
 	Commands = map[string]*tool.Command{
-		"deploy": &deployCmd,
+		"deploy":   &deployCmd,
+		"promote":  &promoteCmd,
+		"rollback": &rollbackCmd,
+		"reload":   &reloadCmd,
 		"logs": tool.LogsCmd(&tool.LogsSpec{
 			Tool: "weaver multi",
 			Source: func(context.Context) (logging.Source, error) {
@@ -52,6 +56,8 @@ var (
 		"dashboard": status.DashboardCommand(dashboardSpec),
 		"status":    status.StatusCommand("weaver multi", defaultRegistry),
 		"metrics":   status.MetricsCommand("weaver multi", defaultRegistry),
+		"top":       status.TopCommand("weaver multi", defaultRegistry),
 		"profile":   status.ProfileCommand("weaver multi", defaultRegistry),
+		"graph":     status.GraphCommand("weaver multi", defaultRegistry),
 	}
 )
@@ -0,0 +1,70 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multi
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/ServiceWeaver/weaver/internal/babysitter"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+)
+
+var reloadCmd = tool.Command{
+	Name:        "reload",
+	Description: "Push an updated config to a running deployment",
+	Help: `Usage:
+  weaver multi reload <deployment> <configfile>...
+
+Flags:
+  -h, --help	Print this help message.
+
+Description:
+  'weaver multi reload <deployment> <configfile>...' pushes the component
+  config sections of the provided config files to a running deployment,
+  without restarting it. Components embedding weaver.WithConfig receive the
+  updated config through their Config and Watch methods. <deployment> is the
+  id, or a uniquely identifying prefix of the id, of the deployment.
+
+  The [serviceweaver] section of the config cannot be changed by a reload;
+  changing it requires a new deployment.`,
+	Flags: flag.NewFlagSet("reload", flag.ContinueOnError),
+	Fn:    reload,
+}
+
+// reload pushes the config in the provided files to a running deployment.
+func reload(ctx context.Context, args []string) error {
+	if len(args) < 2 || args[0] == "" {
+		return fmt.Errorf("usage: weaver multi reload <deployment> <configfile>...")
+	}
+	app, err := runtime.LoadConfig(args[1:], codegen.ComponentConfigValidator)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	reg, err := findDeployment(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if reg.App != app.Name {
+		return fmt.Errorf("deployment %s is of app %q, not %q", reg.DeploymentId, reg.App, app.Name)
+	}
+	if err := babysitter.UpdateConfig(ctx, reg.Addr, app.Sections); err != nil {
+		return fmt.Errorf("reload deployment %s: %w", reg.DeploymentId, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nomad
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ServiceWeaver/weaver/internal/tool/ssh/impl"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+)
+
+var babysitterCmd = tool.Command{
+	Name:        "babysitter",
+	Description: "The weaver nomad babysitter",
+	Help: `Usage:
+  weaver nomad babysitter
+
+Flags:
+  -h, --help   Print this help message.`,
+	Fn: func(ctx context.Context, args []string) error {
+		info, err := impl.BabysitterInfoFromEnv()
+		if err != nil {
+			return err
+		}
+
+		// Nomad numbers the allocations of a job, downloads the binaries into
+		// the task directory, and garbage collects the allocation directory.
+		// See https://developer.hashicorp.com/nomad/docs/runtime/environment.
+		if index := os.Getenv("NOMAD_ALLOC_INDEX"); index != "" {
+			id, err := strconv.Atoi(index)
+			if err != nil {
+				return fmt.Errorf("bad NOMAD_ALLOC_INDEX %q: %w", index, err)
+			}
+			info.ReplicaId = int32(id)
+		}
+		if dir := os.Getenv("NOMAD_TASK_DIR"); dir != "" {
+			info.Deployment.App.Binary = filepath.Join(dir, filepath.Base(info.Deployment.App.Binary))
+		}
+		if dir := os.Getenv("NOMAD_ALLOC_DIR"); dir != "" {
+			info.LogDir = filepath.Join(dir, "logs", "weaver")
+		}
+		return impl.RunBabysitter(ctx, info)
+	},
+}
@@ -0,0 +1,230 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nomad
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/tool/ssh/impl"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/colors"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+	"github.com/google/uuid"
+)
+
+var deployCmd = tool.Command{
+	Name:        "deploy",
+	Description: "Deploy a Service Weaver app",
+	Help:        "Usage:\n  weaver nomad deploy <configfile>...",
+	Flags:       flag.NewFlagSet("deploy", flag.ContinueOnError),
+	Fn:          deploy,
+}
+
+// nomadConfig is the [nomad] section of a config file.
+type nomadConfig struct {
+	// Address is the address of the Nomad HTTP API. Defaults to $NOMAD_ADDR,
+	// or http://127.0.0.1:4646 if unset.
+	Address string `toml:"address"`
+
+	// Datacenters are the datacenters in which to run the jobs. Defaults to
+	// ["dc1"].
+	Datacenters []string `toml:"datacenters"`
+
+	// Replicas is the number of replicas of every colocation group, keyed by
+	// group name, either in full or shortened (e.g., "collatz.Main"). Groups
+	// not listed have a single replica.
+	Replicas map[string]int `toml:"replicas"`
+
+	// Driver is the Nomad task driver used to run the babysitters. Defaults
+	// to "raw_exec".
+	Driver string `toml:"driver"`
+
+	// CPU (in MHz) and MemoryMB are the resources reserved for every replica.
+	CPU      int `toml:"cpu"`
+	MemoryMB int `toml:"memory_mb"`
+
+	// token is the Nomad ACL token, read from $NOMAD_TOKEN.
+	token string
+}
+
+// replicas returns the number of replicas of the given colocation group.
+func (c *nomadConfig) replicas(group string) int {
+	if n, ok := c.Replicas[group]; ok {
+		return n
+	}
+	if n, ok := c.Replicas[logging.ShortenComponent(group)]; ok {
+		return n
+	}
+	return 1
+}
+
+// deploy deploys an application on a Nomad cluster. Every colocation group is
+// run as a separate Nomad job.
+func deploy(ctx context.Context, args []string) error {
+	// Validate command line arguments.
+	if len(args) == 0 {
+		return fmt.Errorf("no config file provided")
+	}
+	// Load the config files.
+	app, err := runtime.LoadConfig(args, codegen.ComponentConfigValidator)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	config, err := parseNomadConfig(app)
+	if err != nil {
+		return err
+	}
+
+	// Sanity check the config.
+	if _, err := os.Stat(app.Binary); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("binary %q doesn't exist", app.Binary)
+	}
+
+	// Create a deployment.
+	dep := &protos.Deployment{
+		Id:  uuid.New().String(),
+		App: app,
+	}
+
+	// Serve the binaries to the Nomad clients.
+	launcher, err := serveBinaries(ctx, config, dep)
+	if err != nil {
+		return err
+	}
+
+	// Run the manager.
+	stopFn, err := impl.RunManager(ctx, dep, "", launcher, logDir, nil, defaultRegistry)
+	if err != nil {
+		return fmt.Errorf("cannot instantiate the manager: %w", err)
+	}
+
+	// Wait for the user to kill the app.
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-done // Will block here until user hits ctrl+c
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := launcher.stop(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "stop the Nomad jobs: %v\n", err)
+		}
+		fmt.Fprintf(os.Stderr, "Application %s terminated\n", app.Name)
+		if err := stopFn(); err != nil {
+			fmt.Fprintf(os.Stderr, "stop the manager: %v\n", err)
+		}
+		os.Exit(1)
+	}()
+
+	// Follow the logs.
+	source := logging.FileSource(logDir)
+	query := fmt.Sprintf(`full_version == %q && !("serviceweaver/system" in attrs)`, dep.Id)
+	r, err := source.Query(ctx, query, true)
+	if err != nil {
+		return err
+	}
+	pp := logging.NewPrettyPrinter(colors.Enabled())
+	for {
+		entry, err := r.Read(ctx)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fmt.Println(pp.Format(entry))
+	}
+}
+
+// parseNomadConfig parses the [nomad] section of the given config, filling in
+// defaults for unspecified fields.
+func parseNomadConfig(app *protos.AppConfig) (*nomadConfig, error) {
+	// Nomad config as found in TOML config file.
+	const nomadKey = "github.com/ServiceWeaver/weaver/nomad"
+	const shortNomadKey = "nomad"
+
+	config := &nomadConfig{}
+	if err := runtime.ParseConfigSection(nomadKey, shortNomadKey, app.Sections, config); err != nil {
+		return nil, fmt.Errorf("unable to parse nomad config: %w", err)
+	}
+	if config.Address == "" {
+		config.Address = os.Getenv("NOMAD_ADDR")
+	}
+	if config.Address == "" {
+		config.Address = "http://127.0.0.1:4646"
+	}
+	if len(config.Datacenters) == 0 {
+		config.Datacenters = []string{"dc1"}
+	}
+	if config.Driver == "" {
+		config.Driver = "raw_exec"
+	}
+	for group, n := range config.Replicas {
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid number of replicas %d for group %q", n, group)
+		}
+	}
+	config.token = os.Getenv("NOMAD_TOKEN")
+	return config, nil
+}
+
+// serveBinaries serves the weaver tool binary and the application binary over
+// HTTP, so that Nomad clients can download them as job artifacts, and returns
+// a launcher that uses them.
+func serveBinaries(ctx context.Context, config *nomadConfig, dep *protos.Deployment) (*nomadLauncher, error) {
+	weaver, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	app := dep.App.Binary
+
+	host, _ := os.Hostname()
+	lis, err := net.Listen("tcp", fmt.Sprintf("%s:0", host))
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/weaver", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, weaver)
+	})
+	mux.HandleFunc("/"+filepath.Base(app), func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, app)
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(lis)
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	addr := fmt.Sprintf("http://%s", lis.Addr())
+	return &nomadLauncher{
+		config:    config,
+		client:    http.DefaultClient,
+		binaryURL: addr + "/weaver",
+		appURL:    addr + "/" + filepath.Base(app),
+	}, nil
+}
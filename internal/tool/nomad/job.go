@@ -0,0 +1,201 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nomad
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ServiceWeaver/weaver/internal/proto"
+	"github.com/ServiceWeaver/weaver/internal/tool/ssh/impl"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// The subset of the Nomad job specification used by the deployer. See
+// https://developer.hashicorp.com/nomad/api-docs/json-jobs for details.
+type (
+	job struct {
+		ID          string
+		Name        string
+		Type        string
+		Datacenters []string
+		TaskGroups  []*taskGroup
+		Meta        map[string]string `json:",omitempty"`
+	}
+
+	taskGroup struct {
+		Name  string
+		Count int
+		Tasks []*task
+	}
+
+	task struct {
+		Name      string
+		Driver    string
+		Config    map[string]any
+		Env       map[string]string
+		Artifacts []*artifact
+		Resources *resources `json:",omitempty"`
+	}
+
+	artifact struct {
+		GetterSource string
+		RelativeDest string
+	}
+
+	resources struct {
+		CPU      int `json:",omitempty"`
+		MemoryMB int `json:",omitempty"`
+	}
+)
+
+// nomadLauncher is an impl.Launcher that runs every colocation group as a
+// Nomad job.
+type nomadLauncher struct {
+	config    *nomadConfig
+	client    *http.Client
+	binaryURL string // URL from which to download the weaver tool binary
+	appURL    string // URL from which to download the application binary
+
+	mu   sync.Mutex
+	jobs []string // ids of the registered jobs
+}
+
+var _ impl.Launcher = &nomadLauncher{}
+
+// Launch implements the impl.Launcher interface.
+func (l *nomadLauncher) Launch(ctx context.Context, info *impl.BabysitterInfo) error {
+	j, err := l.job(info)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(struct{ Job *job }{j})
+	if err != nil {
+		return err
+	}
+	if err := l.call(ctx, http.MethodPut, "/v1/jobs", body); err != nil {
+		return fmt.Errorf("register job %q: %w", j.ID, err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.jobs = append(l.jobs, j.ID)
+	return nil
+}
+
+// job returns the Nomad job that runs the babysitters of the colocation
+// group info.Group.
+func (l *nomadLauncher) job(info *impl.BabysitterInfo) (*job, error) {
+	env, err := proto.ToEnv(info)
+	if err != nil {
+		return nil, err
+	}
+	dep := info.Deployment
+	app := filepath.Base(dep.App.Binary)
+	t := &task{
+		Name:   "babysitter",
+		Driver: l.config.Driver,
+		Config: map[string]any{
+			"command": "/bin/sh",
+			"args": []string{"-c", fmt.Sprintf(
+				"chmod +x local/weaver local/%s && exec local/weaver nomad babysitter", app)},
+		},
+		Env: map[string]string{impl.BabysitterInfoKey: env},
+		Artifacts: []*artifact{
+			{GetterSource: l.binaryURL, RelativeDest: "local/"},
+			{GetterSource: l.appURL, RelativeDest: "local/"},
+		},
+	}
+	if l.config.CPU > 0 || l.config.MemoryMB > 0 {
+		t.Resources = &resources{CPU: l.config.CPU, MemoryMB: l.config.MemoryMB}
+	}
+	id := jobID(dep, info.Group)
+	return &job{
+		ID:          id,
+		Name:        id,
+		Type:        "service",
+		Datacenters: l.config.Datacenters,
+		TaskGroups: []*taskGroup{{
+			Name:  "weavelets",
+			Count: l.config.replicas(info.Group.Name),
+			Tasks: []*task{t},
+		}},
+		Meta: map[string]string{
+			"serviceweaver_app":        dep.App.Name,
+			"serviceweaver_deployment": dep.Id,
+			"serviceweaver_group":      info.Group.Name,
+		},
+	}, nil
+}
+
+// stop deregisters all the jobs registered by the launcher.
+func (l *nomadLauncher) stop(ctx context.Context) error {
+	l.mu.Lock()
+	jobs := l.jobs
+	l.jobs = nil
+	l.mu.Unlock()
+
+	var errs []string
+	for _, id := range jobs {
+		path := fmt.Sprintf("/v1/job/%s?purge=true", url.PathEscape(id))
+		if err := l.call(ctx, http.MethodDelete, path, nil); err != nil {
+			errs = append(errs, fmt.Sprintf("deregister job %q: %v", id, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// call issues a request to the Nomad HTTP API.
+func (l *nomadLauncher) call(ctx context.Context, method, path string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(l.config.Address, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.config.token != "" {
+		req.Header.Set("X-Nomad-Token", l.config.token)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// invalidJobChars matches the characters that are replaced in job ids.
+var invalidJobChars = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
+
+// jobID returns the id of the Nomad job that runs the given colocation group
+// for the given deployment, e.g., "collatz-main-1a2b3c4d".
+func jobID(dep *protos.Deployment, group *protos.ColocationGroup) string {
+	name := fmt.Sprintf("%s-%s-%s", dep.App.Name, logging.ShortenComponent(group.Name), logging.Shorten(dep.Id))
+	return strings.ToLower(strings.Trim(invalidJobChars.ReplaceAllString(name, "-"), "-"))
+}
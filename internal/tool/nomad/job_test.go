@@ -0,0 +1,129 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nomad
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/internal/proto"
+	"github.com/ServiceWeaver/weaver/internal/tool/ssh/impl"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJobID(t *testing.T) {
+	dep := &protos.Deployment{
+		Id:  "1a2b3c4d-0000-0000-0000-000000000000",
+		App: &protos.AppConfig{Name: "Hello_World"},
+	}
+	group := &protos.ColocationGroup{Name: "github.com/ServiceWeaver/weaver/Main"}
+	if got, want := jobID(dep, group), "hello-world-weaver-main-1a2b3c4d"; got != want {
+		t.Errorf("jobID: got %q, want %q", got, want)
+	}
+}
+
+func TestLaunchAndStop(t *testing.T) {
+	type request struct {
+		method, path, token string
+		job                 *job
+	}
+	var mu sync.Mutex
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{method: r.Method, path: r.URL.RequestURI(), token: r.Header.Get("X-Nomad-Token")}
+		if r.Method == http.MethodPut {
+			var body struct{ Job *job }
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.job = body.Job
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, req)
+	}))
+	defer server.Close()
+
+	l := &nomadLauncher{
+		config: &nomadConfig{
+			Address:     server.URL,
+			Datacenters: []string{"dc1"},
+			Replicas:    map[string]int{"weaver.Main": 3},
+			Driver:      "raw_exec",
+			token:       "secret",
+		},
+		client:    server.Client(),
+		binaryURL: "http://host:1234/weaver",
+		appURL:    "http://host:1234/app",
+	}
+	info := &impl.BabysitterInfo{
+		ManagerAddr: "http://host:5678",
+		Deployment: &protos.Deployment{
+			Id:  "1a2b3c4d-0000-0000-0000-000000000000",
+			App: &protos.AppConfig{Name: "app", Binary: "/path/to/app"},
+		},
+		Group: &protos.ColocationGroup{Name: "github.com/ServiceWeaver/weaver/Main"},
+	}
+	ctx := context.Background()
+	if err := l.Launch(ctx, info); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	register, deregister := requests[0], requests[1]
+	if register.method != http.MethodPut || register.path != "/v1/jobs" || register.token != "secret" {
+		t.Errorf("bad register request %s %s (token %q)", register.method, register.path, register.token)
+	}
+	const id = "app-weaver-main-1a2b3c4d"
+	if deregister.method != http.MethodDelete || deregister.path != "/v1/job/"+id+"?purge=true" {
+		t.Errorf("bad deregister request %s %s", deregister.method, deregister.path)
+	}
+
+	j := register.job
+	if j.ID != id {
+		t.Errorf("job id: got %q, want %q", j.ID, id)
+	}
+	if len(j.TaskGroups) != 1 || len(j.TaskGroups[0].Tasks) != 1 {
+		t.Fatalf("bad job %+v", j)
+	}
+	if got, want := j.TaskGroups[0].Count, 3; got != want {
+		t.Errorf("count: got %d, want %d", got, want)
+	}
+	task := j.TaskGroups[0].Tasks[0]
+	wantArtifacts := []*artifact{
+		{GetterSource: "http://host:1234/weaver", RelativeDest: "local/"},
+		{GetterSource: "http://host:1234/app", RelativeDest: "local/"},
+	}
+	if diff := cmp.Diff(wantArtifacts, task.Artifacts); diff != "" {
+		t.Errorf("artifacts (-want +got):\n%s", diff)
+	}
+	got := &impl.BabysitterInfo{}
+	if err := proto.FromEnv(task.Env[impl.BabysitterInfoKey], got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ManagerAddr != info.ManagerAddr || got.Group.Name != info.Group.Name {
+		t.Errorf("babysitter info: got %v, want %v", got, info)
+	}
+}
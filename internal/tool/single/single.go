@@ -40,6 +40,7 @@ var (
 		"dashboard": status.DashboardCommand(dashboardSpec),
 		"metrics":   status.MetricsCommand("weaver single", defaultRegistry),
 		"profile":   status.ProfileCommand("weaver single", defaultRegistry),
+		"graph":     status.GraphCommand("weaver single", defaultRegistry),
 	}
 )
 
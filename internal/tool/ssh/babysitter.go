@@ -30,6 +30,10 @@ var babysitterCmd = tool.Command{
 Flags:
   -h, --help   Print this help message.`,
 	Fn: func(ctx context.Context, args []string) error {
-		return impl.RunBabysitter(ctx)
+		info, err := impl.BabysitterInfoFromEnv()
+		if err != nil {
+			return err
+		}
+		return impl.RunBabysitter(ctx, info)
 	},
 }
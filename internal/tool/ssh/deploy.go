@@ -34,6 +34,7 @@ import (
 	"github.com/ServiceWeaver/weaver/runtime"
 	"github.com/ServiceWeaver/weaver/runtime/codegen"
 	"github.com/ServiceWeaver/weaver/runtime/colors"
+	"github.com/ServiceWeaver/weaver/runtime/logexport"
 	"github.com/ServiceWeaver/weaver/runtime/logging"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
 	"github.com/ServiceWeaver/weaver/runtime/tool"
@@ -42,11 +43,17 @@ import (
 var deployCmd = tool.Command{
 	Name:        "deploy",
 	Description: "Deploy a Service Weaver app",
-	Help:        "Usage:\n  weaver ssh deploy <configfile>",
+	Help:        "Usage:\n  weaver ssh deploy <configfile>...",
 	Flags:       flag.NewFlagSet("deploy", flag.ContinueOnError),
 	Fn:          deploy,
 }
 
+// SSH config as found in TOML config file.
+const (
+	sshKey      = "github.com/ServiceWeaver/weaver/ssh"
+	shortSSHKey = "ssh"
+)
+
 // deploy deploys an application on a cluster of machines using an SSH deployer.
 // Note that each component is deployed as a separate OS process.
 func deploy(ctx context.Context, args []string) error {
@@ -54,19 +61,10 @@ func deploy(ctx context.Context, args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("no config file provided")
 	}
-	if len(args) > 1 {
-		return fmt.Errorf("too many arguments")
-	}
-
-	// Load the config file.
-	cfgFile := args[0]
-	cfg, err := os.ReadFile(cfgFile)
-	if err != nil {
-		return fmt.Errorf("load config file %q: %w", cfgFile, err)
-	}
-	app, err := runtime.ParseConfig(cfgFile, string(cfg), codegen.ComponentConfigValidator)
+	// Load the config files.
+	app, err := runtime.LoadConfig(args, codegen.ComponentConfigValidator)
 	if err != nil {
-		return fmt.Errorf("load config file %q: %w", cfgFile, err)
+		return fmt.Errorf("load config: %w", err)
 	}
 
 	// Sanity check the config.
@@ -80,6 +78,12 @@ func deploy(ctx context.Context, args []string) error {
 		return err
 	}
 
+	// Create the log exporters, if any.
+	exporters, err := logexport.ParseConfig(sshKey, shortSSHKey, app.Sections)
+	if err != nil {
+		return fmt.Errorf("unable to parse ssh config: %w", err)
+	}
+
 	// Create a deployment.
 	dep := &protos.Deployment{
 		Id:  uuid.New().String(),
@@ -92,7 +96,7 @@ func deploy(ctx context.Context, args []string) error {
 	}
 
 	// Run the manager.
-	stopFn, err := impl.RunManager(ctx, dep, locs, logDir)
+	stopFn, err := impl.RunManager(ctx, dep, "", impl.SSHLauncher(locs), logDir, exporters, impl.DefaultRegistry)
 	if err != nil {
 		return fmt.Errorf("cannot instantiate the manager: %w", err)
 	}
@@ -172,12 +176,9 @@ func terminateDeployment(locs []string, dep *protos.Deployment) error {
 
 // getLocations returns the list of locations at which to deploy the application.
 func getLocations(app *protos.AppConfig) ([]string, error) {
-	// SSH config as found in TOML config file.
-	const sshKey = "github.com/ServiceWeaver/weaver/ssh"
-	const shortSSHKey = "ssh"
-
 	type sshConfigSchema struct {
-		LocationsFile string `toml:"locations_file"`
+		LocationsFile string             `toml:"locations_file"`
+		LogExporters  []logexport.Config `toml:"log_exporters"` // see deploy
 	}
 	parsed := &sshConfigSchema{}
 	if err := runtime.ParseConfigSection(sshKey, shortSSHKey, app.Sections, parsed); err != nil {
@@ -55,14 +55,32 @@ type babysitter struct {
 
 var _ envelope.EnvelopeHandler = &babysitter{}
 
-// RunBabysitter creates and runs a babysitter that was deployed using SSH.
-func RunBabysitter(ctx context.Context) error {
-	// Retrieve the deployment information.
+// BabysitterInfoFromEnv returns the babysitter information stored in the
+// BabysitterInfoKey environment variable by a Launcher.
+func BabysitterInfoFromEnv() (*BabysitterInfo, error) {
 	depInfo := &BabysitterInfo{}
 	if err := proto.FromEnv(os.Getenv(BabysitterInfoKey), depInfo); err != nil {
-		return fmt.Errorf("unable to retrieve deployment info: %w", err)
+		return nil, fmt.Errorf("unable to retrieve deployment info: %w", err)
 	}
+	return depInfo, nil
+}
+
+// DeploymentFromEnv returns the deployment stored in the DeploymentKey
+// environment variable.
+func DeploymentFromEnv() (*protos.Deployment, error) {
+	dep := &protos.Deployment{}
+	if err := proto.FromEnv(os.Getenv(DeploymentKey), dep); err != nil {
+		return nil, fmt.Errorf("unable to retrieve deployment: %w", err)
+	}
+	if dep.App == nil {
+		return nil, fmt.Errorf("no deployment found in %s", DeploymentKey)
+	}
+	return dep, nil
+}
 
+// RunBabysitter creates and runs a babysitter that was launched by a
+// Launcher.
+func RunBabysitter(ctx context.Context, depInfo *BabysitterInfo) error {
 	// Create the log saver.
 	fs, err := logging.NewFileStore(depInfo.LogDir)
 	if err != nil {
@@ -285,6 +303,21 @@ func (b *babysitter) ExportListener(req *protos.ExportListenerRequest) (*protos.
 	return reply, nil
 }
 
+// ElectLeader implements the protos.EnvelopeHandler interface.
+func (b *babysitter) ElectLeader(req *protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error) {
+	reply := &protos.LeaderElectionReply{}
+	if err := protomsg.Call(b.ctx, protomsg.CallArgs{
+		Client:  http.DefaultClient,
+		Addr:    b.mgrAddr,
+		URLPath: electLeaderURL,
+		Request: req,
+		Reply:   reply,
+	}); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
 // GetRoutingInfo implements the protos.EnvelopeHandler interface.
 func (b *babysitter) GetRoutingInfo(req *protos.GetRoutingInfo) (*protos.RoutingInfo, error) {
 	reply := &protos.RoutingInfo{}
@@ -0,0 +1,67 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package impl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// ColocationGroups returns the names of the colocation groups of the given
+// application binary, in sorted order. Deployers that create the containers
+// of every colocation group ahead of time use it.
+//
+// The binary is run to learn about its components, so it must be runnable on
+// the local machine.
+func ColocationGroups(ctx context.Context, binary string, sameProcess []*protos.ComponentGroup) ([]string, error) {
+	cmd := exec.CommandContext(ctx, binary)
+	cmd.Env = append(os.Environ(), runtime.ListComponentsKey+"=true")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("list the components of %q: %w", binary, err)
+	}
+	return colocationGroups(strings.Fields(string(out)), sameProcess), nil
+}
+
+// colocationGroups returns the names of the colocation groups of the given
+// components. It mirrors the placement of components done by weavelets: the
+// components in a same_process entry share a group named after the first of
+// them, and every other component is in a group of its own.
+func colocationGroups(components []string, sameProcess []*protos.ComponentGroup) []string {
+	placed := map[string]bool{}
+	var groups []string
+	for _, g := range sameProcess {
+		if len(g.Components) == 0 {
+			continue
+		}
+		groups = append(groups, g.Components[0])
+		for _, c := range g.Components {
+			placed[c] = true
+		}
+	}
+	for _, c := range components {
+		if !placed[c] {
+			groups = append(groups, c)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
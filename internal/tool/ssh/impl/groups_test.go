@@ -0,0 +1,34 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package impl
+
+import (
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestColocationGroups(t *testing.T) {
+	components := []string{"main", "a/A", "b/B", "c/C", "d/D"}
+	sameProcess := []*protos.ComponentGroup{
+		{Components: []string{"c/C", "a/A"}},
+	}
+	got := colocationGroups(components, sameProcess)
+	want := []string{"b/B", "c/C", "d/D", "main"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("colocationGroups (-want +got):\n%s", diff)
+	}
+}
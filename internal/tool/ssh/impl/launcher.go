@@ -0,0 +1,90 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package impl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/ServiceWeaver/weaver/internal/proto"
+	"github.com/ServiceWeaver/weaver/runtime/protomsg"
+)
+
+// sshLauncher is the Launcher returned by SSHLauncher.
+type sshLauncher struct {
+	locations []string
+}
+
+var _ Launcher = &sshLauncher{}
+
+// SSHLauncher returns a Launcher that launches a replica of every colocation
+// group at every one of the provided locations, using SSH. The tool binary
+// must have been copied to the locations, into a directory named after the
+// deployment id in os.TempDir().
+//
+// TODO(rgrandl): Implement some smarter logic to determine the number of
+// replicas for each group.
+func SSHLauncher(locations []string) Launcher {
+	return &sshLauncher{locations: locations}
+}
+
+// Launch implements the Launcher interface.
+func (l *sshLauncher) Launch(_ context.Context, info *BabysitterInfo) error {
+	for replicaId, loc := range l.locations {
+		replica := protomsg.Clone(info)
+		replica.ReplicaId = int32(replicaId)
+		input, err := proto.ToEnv(replica)
+		if err != nil {
+			return err
+		}
+		env := fmt.Sprintf("%s=%s", BabysitterInfoKey, input)
+		binaryPath := filepath.Join(os.TempDir(), info.Deployment.Id, "weaver")
+		cmd := exec.Command("ssh", loc, env, binaryPath, "ssh", "babysitter")
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("location %s: %w", loc, err)
+		}
+	}
+	return nil
+}
+
+// staticLauncher is the Launcher returned by StaticLauncher.
+type staticLauncher struct {
+	groups map[string]bool
+}
+
+var _ Launcher = &staticLauncher{}
+
+// StaticLauncher returns a Launcher for deployments where the babysitters of
+// the given colocation groups are started ahead of time, e.g., as the
+// containers of a Docker Compose project. The launcher only checks that the
+// colocation groups it is asked to launch are among them.
+func StaticLauncher(groups []string) Launcher {
+	l := &staticLauncher{groups: map[string]bool{}}
+	for _, group := range groups {
+		l.groups[group] = true
+	}
+	return l
+}
+
+// Launch implements the Launcher interface.
+func (l *staticLauncher) Launch(_ context.Context, info *BabysitterInfo) error {
+	if !l.groups[info.Group.Name] {
+		return fmt.Errorf("colocation group %q was not deployed; redeploy the application", info.Group.Name)
+	}
+	return nil
+}
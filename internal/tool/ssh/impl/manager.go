@@ -18,15 +18,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"sync"
 	"syscall"
+	"time"
 
 	imetrics "github.com/ServiceWeaver/weaver/internal/metrics"
 	"github.com/ServiceWeaver/weaver/runtime/metrics"
@@ -34,12 +33,14 @@ import (
 	"github.com/ServiceWeaver/weaver/runtime/protos"
 
 	handler "github.com/ServiceWeaver/weaver/internal/babysitter"
+	"github.com/ServiceWeaver/weaver/internal/election"
 	"github.com/ServiceWeaver/weaver/internal/logtype"
-	"github.com/ServiceWeaver/weaver/internal/proto"
 	"github.com/ServiceWeaver/weaver/internal/proxy"
+	"github.com/ServiceWeaver/weaver/internal/routing"
 	"github.com/ServiceWeaver/weaver/internal/status"
 	"github.com/ServiceWeaver/weaver/internal/traceio"
 	"github.com/ServiceWeaver/weaver/internal/versioned"
+	"github.com/ServiceWeaver/weaver/runtime/logexport"
 	"github.com/ServiceWeaver/weaver/runtime/logging"
 	"github.com/ServiceWeaver/weaver/runtime/protomsg"
 	"github.com/ServiceWeaver/weaver/runtime/retry"
@@ -57,6 +58,7 @@ const (
 	exportListenerURL              = "/manager/export_listener"
 	startComponentURL              = "/manager/start_component"
 	getRoutingInfoURL              = "/manager/get_routing_info"
+	electLeaderURL                 = "/manager/elect_leader"
 	startColocationGroupManagerURL = "/manager/start_colocation_group"
 	recvLogEntryURL                = "/manager/recv_log_entry"
 	recvTraceSpansURL              = "/manager/recv_trace_spans"
@@ -66,6 +68,11 @@ const (
 	// information for a babysitter deployed using SSH.
 	BabysitterInfoKey = "SERVICEWEAVER_BABYSITTER_INFO"
 
+	// DeploymentKey is the name of the env variable that contains the
+	// deployment run by a manager started by a container, rather than by a
+	// deployer tool.
+	DeploymentKey = "SERVICEWEAVER_DEPLOYMENT"
+
 	// routingInfoKey is the key where we track routing information for a given process.
 	routingInfoKey = "routing_entries"
 
@@ -73,6 +80,15 @@ const (
 	appVersionStateKey = "app_version_state"
 )
 
+// A Launcher launches the babysitters that run the replicas of a colocation
+// group, e.g., on a set of machines over SSH, or on a cluster scheduler.
+type Launcher interface {
+	// Launch launches the babysitters of the colocation group info.Group.
+	// Every babysitter should run with info, with ReplicaId set to the index
+	// of its replica, in the BabysitterInfoKey environment variable.
+	Launch(ctx context.Context, info *BabysitterInfo) error
+}
+
 // manager manages an application version deployment across a set of locations,
 // where a location can be a physical or a virtual machine.
 //
@@ -84,10 +100,15 @@ type manager struct {
 	dep        *protos.Deployment
 	logger     logtype.Logger
 	logDir     string
-	locations  []string // addresses of the locations
+	addr       string   // address on which to listen, if not empty
+	launcher   Launcher // launches the babysitters
 	mgrAddress string   // manager address
 	registry   *status.Registry
 
+	// newRegistry returns the registry with which the deployment is
+	// registered, so that it shows up in the dashboard.
+	newRegistry func(context.Context) (*status.Registry, error)
+
 	// logSaver processes log entries generated by the weavelets and babysitters.
 	// The entries either have the timestamp produced by the weavelet/babysitter,
 	// or have a nil Time field. Defaults to a log saver that pretty prints log
@@ -107,11 +128,15 @@ type manager struct {
 	// statsProcessor tracks and computes stats to be rendered on the /statusz page.
 	statsProcessor *imetrics.StatsProcessor
 
+	// elections tracks the leases of the deployment's leader elections.
+	elections *election.Leases
+
 	mu          sync.Mutex
 	started     map[string]bool //  colocation groups started, by group name
 	appInfo     *versioned.Map[*handler.AppVersionState]
 	routingInfo *versioned.Map[*protos.RoutingInfo]
 	proxies     map[string]*proxyInfo                         // proxies, by listener name
+	udpProxies  map[string]*udpProxyInfo                      // proxies of packet listeners, by listener name
 	metrics     map[groupReplicaInfo][]*protos.MetricSnapshot // latest metrics, by group name and replica id
 }
 
@@ -120,6 +145,12 @@ type proxyInfo struct {
 	addr  string // dialable address of the proxy
 }
 
+// udpProxyInfo holds information about the proxy of a packet listener.
+type udpProxyInfo struct {
+	proxy *proxy.UDPProxy
+	addr  string // dialable address of the proxy
+}
+
 type groupReplicaInfo struct {
 	name string
 	id   int32
@@ -127,14 +158,30 @@ type groupReplicaInfo struct {
 
 var _ status.Server = &manager{}
 
-// RunManager creates and runs a new manager.
-func RunManager(ctx context.Context, dep *protos.Deployment, locations []string,
-	logDir string) (func() error, error) {
+// RunManager creates and runs a new manager. The manager listens on addr (or
+// on an ephemeral port of the local host, if addr is empty), launches
+// babysitters using launcher, stores logs in logDir, exports them to
+// logExporters, and registers the deployment with the registry returned by
+// newRegistry.
+func RunManager(ctx context.Context, dep *protos.Deployment, addr string, launcher Launcher,
+	logDir string, logExporters []logexport.Exporter, newRegistry func(context.Context) (*status.Registry, error)) (func() error, error) {
 	fs, err := logging.NewFileStore(logDir)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create log storage: %w", err)
 	}
 	logSaver := fs.Add
+	var exportLogs *logexport.Pipeline
+	if len(logExporters) > 0 {
+		exportLogs = logexport.NewPipeline(logExporters, logexport.Options{
+			OnError: func(err error) {
+				fmt.Fprintf(os.Stderr, "export logs: %v\n", err)
+			},
+		})
+		logSaver = func(entry *protos.LogEntry) {
+			fs.Add(entry)
+			exportLogs.Add(entry)
+		}
+	}
 
 	logger := logging.FuncLogger{
 		Opts: logging.Options{
@@ -161,16 +208,20 @@ func RunManager(ctx context.Context, dep *protos.Deployment, locations []string,
 	m := &manager{
 		ctx:            ctx,
 		dep:            dep,
-		locations:      locations,
+		addr:           addr,
+		launcher:       launcher,
+		newRegistry:    newRegistry,
 		logger:         logger,
 		logDir:         logDir,
 		logSaver:       logSaver,
 		traceSaver:     traceSaver,
 		statsProcessor: imetrics.NewStatsProcessor(),
+		elections:      election.NewLeases(),
 		started:        map[string]bool{},
 		appInfo:        versioned.NewMap[*handler.AppVersionState](),
 		routingInfo:    versioned.NewMap[*protos.RoutingInfo](),
 		proxies:        map[string]*proxyInfo{},
+		udpProxies:     map[string]*udpProxyInfo{},
 		metrics:        map[groupReplicaInfo][]*protos.MetricSnapshot{},
 	}
 
@@ -191,13 +242,20 @@ func RunManager(ctx context.Context, dep *protos.Deployment, locations []string,
 		return result
 	})
 	return func() error {
+		if exportLogs != nil {
+			exportLogs.Close()
+		}
 		return m.registry.Unregister(m.ctx, m.dep.Id)
 	}, nil
 }
 
 func (m *manager) run() error {
-	host, _ := os.Hostname()
-	lis, err := net.Listen("tcp", fmt.Sprintf("%s:0", host))
+	addr := m.addr
+	if addr == "" {
+		host, _ := os.Hostname()
+		addr = fmt.Sprintf("%s:0", host)
+	}
+	lis, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("listen: %w", err)
 	}
@@ -241,7 +299,7 @@ func (m *manager) run() error {
 	}
 
 	// Register the deployment.
-	registry, err := DefaultRegistry(m.ctx)
+	registry, err := m.newRegistry(m.ctx)
 	if err != nil {
 		return fmt.Errorf("create registry: %w", err)
 	}
@@ -263,6 +321,7 @@ func (m *manager) addHTTPHandlers(mux *http.ServeMux) {
 	mux.HandleFunc(exportListenerURL, protomsg.HandlerFunc(m.logger, m.exportListener))
 	mux.HandleFunc(startComponentURL, protomsg.HandlerDo(m.logger, m.startComponent))
 	mux.HandleFunc(getRoutingInfoURL, protomsg.HandlerFunc(m.logger, m.getRoutingInfo))
+	mux.HandleFunc(electLeaderURL, protomsg.HandlerFunc(m.logger, m.electLeader))
 	mux.HandleFunc(startColocationGroupManagerURL, protomsg.HandlerDo(m.logger, m.startColocationGroup))
 	mux.HandleFunc(recvLogEntryURL, protomsg.HandlerDo(m.logger, m.handleLogEntry))
 	mux.HandleFunc(recvTraceSpansURL, protomsg.HandlerDo(m.logger, m.handleTraceSpans))
@@ -334,6 +393,12 @@ func (m *manager) Status(ctx context.Context) (*status.Status, error) {
 			Addr: proxy.addr,
 		})
 	}
+	for name, proxy := range m.udpProxies {
+		listeners = append(listeners, &status.Listener{
+			Name: name,
+			Addr: proxy.addr,
+		})
+	}
 	return &status.Status{
 		App:            info.App,
 		DeploymentId:   info.DeploymentId,
@@ -451,6 +516,9 @@ func (m *manager) exportListener(_ context.Context, req *protos.ExportListenerRe
 	existing.Listeners = append(existing.Listeners, req.Listener)
 	m.appInfo.Update(appVersionStateKey, existing)
 
+	if req.Listener.Network == "udp" {
+		return m.exportPacketListener(req)
+	}
 	if p, ok := m.proxies[req.Listener.Name]; ok {
 		p.proxy.AddBackend(req.Listener.Addr)
 		return &protos.ExportListenerReply{ProxyAddress: p.addr}, nil
@@ -477,6 +545,35 @@ func (m *manager) exportListener(_ context.Context, req *protos.ExportListenerRe
 	return &protos.ExportListenerReply{ProxyAddress: addr}, nil
 }
 
+// exportPacketListener exports a UDP listener, behind a UDP proxy.
+//
+// REQUIRES: m.mu is held.
+func (m *manager) exportPacketListener(req *protos.ExportListenerRequest) (*protos.ExportListenerReply, error) {
+	if p, ok := m.udpProxies[req.Listener.Name]; ok {
+		p.proxy.AddBackend(req.Listener.Addr)
+		return &protos.ExportListenerReply{ProxyAddress: p.addr}, nil
+	}
+	conn, err := net.ListenPacket("udp", req.LocalAddress)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		// Don't retry if the address is already in use.
+		return &protos.ExportListenerReply{Error: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("proxy listen: %w", err)
+	}
+	addr := conn.LocalAddr().String()
+	m.logger.Info("UDP proxy listening", "address", addr)
+	proxy := proxy.NewUDPProxy(m.logger)
+	proxy.AddBackend(req.Listener.Addr)
+	m.udpProxies[req.Listener.Name] = &udpProxyInfo{proxy: proxy, addr: addr}
+	go func() {
+		if err := proxy.Serve(m.ctx, conn); err != nil && m.ctx.Err() == nil {
+			m.logger.Error("UDP proxy", err)
+		}
+	}()
+	return &protos.ExportListenerReply{ProxyAddress: addr}, nil
+}
+
 func (m *manager) startComponent(_ context.Context, req *protos.ComponentToStart) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -547,6 +644,10 @@ func (m *manager) getRoutingInfo(_ context.Context, req *protos.GetRoutingInfo)
 	return existing, nil
 }
 
+func (m *manager) electLeader(_ context.Context, req *protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error) {
+	return m.elections.Elect(req, time.Now()), nil
+}
+
 func (m *manager) startColocationGroup(_ context.Context, group *protos.ColocationGroup) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -556,17 +657,16 @@ func (m *manager) startColocationGroup(_ context.Context, group *protos.Colocati
 		return nil
 	}
 
-	// Start the main colocation group. Right now, the number of replicas for
-	// each colocation group is equal with the number of locations.
-	//
-	// TODO(rgrandl): Implement some smarter logic to determine the number of
-	// replicas for each group.
-	for replicaId, loc := range m.locations {
-		if err := m.startBabysitter(loc, group, replicaId); err != nil {
-			return fmt.Errorf("unable to start babysitter for group %s at location %s: %w\n", group.Name, loc, err)
-		}
-		m.logger.Info("Started babysitter", "location", loc, "colocation group", group.Name)
+	info := &BabysitterInfo{
+		ManagerAddr: m.mgrAddress,
+		Deployment:  m.dep,
+		Group:       group,
+		LogDir:      m.logDir,
+	}
+	if err := m.launcher.Launch(m.ctx, info); err != nil {
+		return fmt.Errorf("unable to start babysitters for group %s: %w", group.Name, err)
 	}
+	m.logger.Info("Started babysitters", "colocation group", group.Name)
 	m.started[group.Name] = true
 	return nil
 }
@@ -590,25 +690,6 @@ func (m *manager) handleRecvMetrics(_ context.Context, metrics *BabysitterMetric
 	return nil
 }
 
-// startBabysitter starts a new babysitter that manages a colocation group using SSH.
-func (m *manager) startBabysitter(loc string, group *protos.ColocationGroup, replicaId int) error {
-	input, err := proto.ToEnv(&BabysitterInfo{
-		ManagerAddr: m.mgrAddress,
-		Deployment:  m.dep,
-		Group:       group,
-		ReplicaId:   int32(replicaId),
-		LogDir:      m.logDir,
-	})
-	if err != nil {
-		return err
-	}
-
-	env := fmt.Sprintf("%s=%s", BabysitterInfoKey, input)
-	binaryPath := filepath.Join(os.TempDir(), m.dep.Id, "weaver")
-	cmd := exec.Command("ssh", loc, env, binaryPath, "ssh", "babysitter")
-	return cmd.Start()
-}
-
 // mayGenerateNewRoutingInfo may generate new routing information for a given process.
 //
 // New routing information is generated when (1) new sharded components are managed
@@ -661,84 +742,16 @@ func (m *manager) updateRoutingInfo(process string, routingInfo *protos.RoutingI
 	return nil
 }
 
-// routingAlgo is an implementation of a routing algorithm that distributes the
-// entire key space approximately equally across all healthy resources.
-//
-// The algorithm is as follows:
-// - split the entire key space in a number of slices that is more likely to
-// spread uniformly the key space among all healthy resources
-//
-// - distribute the slices round robin across all healthy resources
+// routingAlgo computes a new assignment of the key space of a routed
+// component to the provided healthy replicas. See the routing package for
+// details on the algorithm.
 func routingAlgo(currAssignment *protos.Assignment, candidates []string) (*protos.Assignment, error) {
 	newAssignment := protomsg.Clone(currAssignment)
 	newAssignment.Version++
-
-	// Note that the healthy resources should be sorted. This is required because
-	// we want to do a deterministic assignment of slices to resources among
-	// different invocations, to avoid unnecessary churn while generating
-	// new assignments.
-	sort.Strings(candidates)
-
-	if len(candidates) == 0 {
-		newAssignment.Slices = nil
-		return newAssignment, nil
-	}
-
-	const minSliceKey = 0
-	const maxSliceKey = math.MaxUint64
-
-	// If there is only one healthy resource, assign the entire key space to it.
-	if len(candidates) == 1 {
-		newAssignment.Slices = []*protos.Assignment_Slice{
-			{Start: minSliceKey, Replicas: candidates},
-		}
-		return newAssignment, nil
-	}
-
-	// Compute the total number of slices in the assignment.
-	numSlices := nextPowerOfTwo(len(candidates))
-
-	// Split slices in equal subslices in order to generate numSlices.
-	splits := [][]uint64{{minSliceKey, maxSliceKey}}
-	var curr []uint64
-	for ok := true; ok; ok = len(splits) != numSlices {
-		curr, splits = splits[0], splits[1:]
-		midPoint := curr[0] + uint64(math.Floor(0.5*float64(curr[1]-curr[0])))
-		splitl := []uint64{curr[0], midPoint}
-		splitr := []uint64{midPoint, curr[1]}
-		splits = append(splits, splitl, splitr)
-	}
-
-	// Sort the computed slices in increasing order based on the start key, in
-	// order to provide a deterministic assignment across multiple runs, hence to
-	// minimize churn.
-	sort.Slice(splits, func(i, j int) bool {
-		return splits[i][0] <= splits[j][0]
-	})
-
-	// Assign the computed slices to resources in a round robin fashion.
-	slices := make([]*protos.Assignment_Slice, len(splits))
-	rId := 0
-	for i, s := range splits {
-		slices[i] = &protos.Assignment_Slice{
-			Start:    s[0],
-			Replicas: []string{candidates[rId]},
-		}
-		rId = (rId + 1) % len(candidates)
-	}
-	newAssignment.Slices = slices
+	newAssignment.Slices = routing.Assign(candidates)
 	return newAssignment, nil
 }
 
-// nextPowerOfTwo returns the next power of 2 that is greater or equal to x.
-func nextPowerOfTwo(x int) int {
-	// If x is already power of 2, return x.
-	if x&(x-1) == 0 {
-		return x
-	}
-	return int(math.Pow(2, math.Ceil(math.Log2(float64(x)))))
-}
-
 func findOrCreateProcess(app string, id string, process string, ap *handler.AppVersionState) *handler.ProcessState {
 	if ap == nil {
 		ap = &handler.AppVersionState{
@@ -0,0 +1,103 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ServiceWeaver/weaver/internal/tool/ssh/impl"
+	"github.com/ServiceWeaver/weaver/runtime/colors"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+)
+
+var controllerCmd = tool.Command{
+	Name:        "controller",
+	Description: "The weaver systemd controller",
+	Help: `Usage:
+  weaver systemd controller <addr> <group>...
+
+Flags:
+  -h, --help   Print this help message.`,
+	Fn: runController,
+}
+
+// runController runs the manager of the deployment stored in
+// impl.DeploymentKey on the given address. The given colocation groups are
+// the ones run by the other units of the deployment.
+func runController(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no address provided")
+	}
+	dep, err := impl.DeploymentFromEnv()
+	if err != nil {
+		return err
+	}
+	stopFn, err := impl.RunManager(ctx, dep, args[0], impl.StaticLauncher(args[1:]), logDir, nil, impl.DefaultRegistry)
+	if err != nil {
+		return fmt.Errorf("cannot instantiate the manager: %w", err)
+	}
+
+	// Stop when the unit is stopped.
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-done
+		if err := stopFn(); err != nil {
+			fmt.Fprintf(os.Stderr, "stop the manager: %v\n", err)
+		}
+		os.Exit(0)
+	}()
+
+	// Follow the logs, so that they show up in the journal.
+	source := logging.FileSource(logDir)
+	query := fmt.Sprintf(`full_version == %q && !("serviceweaver/system" in attrs)`, dep.Id)
+	r, err := source.Query(ctx, query, true)
+	if err != nil {
+		return err
+	}
+	pp := logging.NewPrettyPrinter(colors.Enabled())
+	for {
+		entry, err := r.Read(ctx)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fmt.Println(pp.Format(entry))
+	}
+}
+
+var babysitterCmd = tool.Command{
+	Name:        "babysitter",
+	Description: "The weaver systemd babysitter",
+	Help: `Usage:
+  weaver systemd babysitter
+
+Flags:
+  -h, --help   Print this help message.`,
+	Fn: func(ctx context.Context, _ []string) error {
+		info, err := impl.BabysitterInfoFromEnv()
+		if err != nil {
+			return err
+		}
+		return impl.RunBabysitter(ctx, info)
+	},
+}
@@ -0,0 +1,491 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/ServiceWeaver/weaver/internal/proto"
+	"github.com/ServiceWeaver/weaver/internal/tool/ssh/impl"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+	"github.com/google/uuid"
+)
+
+var (
+	installCmd = tool.Command{
+		Name:        "install",
+		Description: "Install a Service Weaver app as systemd units",
+		Help: `Usage:
+  weaver systemd install <configfile>...
+
+Flags:
+  -h, --help   Print this help message.
+
+Description:
+  "weaver systemd install" installs the application in the provided config
+  file as a set of systemd units, and starts them. A previously installed
+  version of the application is uninstalled first.`,
+		Flags: flag.NewFlagSet("install", flag.ContinueOnError),
+		Fn: func(ctx context.Context, args []string) error {
+			i, app, err := newInstaller(args)
+			if err != nil {
+				return err
+			}
+			return i.install(ctx, app)
+		},
+	}
+
+	uninstallCmd = tool.Command{
+		Name:        "uninstall",
+		Description: "Uninstall a Service Weaver app",
+		Help: `Usage:
+  weaver systemd uninstall <configfile>...
+
+Flags:
+  -h, --help   Print this help message.
+
+Description:
+  "weaver systemd uninstall" stops and removes the systemd units of the
+  application in the provided config file.`,
+		Flags: flag.NewFlagSet("uninstall", flag.ContinueOnError),
+		Fn: func(ctx context.Context, args []string) error {
+			i, app, err := newInstaller(args)
+			if err != nil {
+				return err
+			}
+			return i.uninstall(ctx, app.Name)
+		},
+	}
+)
+
+// systemdConfig is the [systemd] section of a config file.
+type systemdConfig struct {
+	// User specifies whether to install user units, managed by the user's
+	// service manager, rather than system units. Installing system units
+	// requires root privileges.
+	User bool `toml:"user"`
+
+	// ControllerPort is the port on which the controller listens. Defaults to
+	// a port that is free when the application is installed.
+	ControllerPort int `toml:"controller_port"`
+
+	// Restart and RestartSec are the restart policy of every unit. They
+	// default to "on-failure" and 5 seconds. See systemd.service(5).
+	Restart    string `toml:"restart"`
+	RestartSec int    `toml:"restart_sec"`
+
+	// CPUQuota (e.g., "200%") and MemoryMax (e.g., "1G") are the resource
+	// limits of every unit. See systemd.resource-control(5).
+	CPUQuota  string `toml:"cpu_quota"`
+	MemoryMax string `toml:"memory_max"`
+}
+
+// installer installs applications as systemd units.
+type installer struct {
+	config   *systemdConfig
+	unitDir  string // directory of the unit files
+	stateDir string // directory of the binaries of installed applications
+	run      runner
+}
+
+// newInstaller returns an installer for the application in the config file
+// in args, along with the application config.
+func newInstaller(args []string) (*installer, *protos.AppConfig, error) {
+	// Validate command line arguments.
+	if len(args) == 0 {
+		return nil, nil, fmt.Errorf("no config file provided")
+	}
+	// Load the config files.
+	app, err := runtime.LoadConfig(args, codegen.ComponentConfigValidator)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load config: %w", err)
+	}
+	config, err := parseSystemdConfig(app)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	i := &installer{
+		config:   config,
+		unitDir:  "/etc/systemd/system",
+		stateDir: "/var/lib/serviceweaver/systemd",
+		run:      execRunner,
+	}
+	if config.User {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		i.unitDir = filepath.Join(configDir, "systemd", "user")
+		dataDir := os.Getenv("XDG_DATA_HOME")
+		if dataDir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, nil, err
+			}
+			dataDir = filepath.Join(home, ".local", "share")
+		}
+		i.stateDir = filepath.Join(dataDir, "serviceweaver", "systemd")
+	}
+	return i, app, nil
+}
+
+// parseSystemdConfig parses the [systemd] section of the given config, filling
+// in defaults for unspecified fields.
+func parseSystemdConfig(app *protos.AppConfig) (*systemdConfig, error) {
+	// systemd config as found in TOML config file.
+	const systemdKey = "github.com/ServiceWeaver/weaver/systemd"
+	const shortSystemdKey = "systemd"
+
+	config := &systemdConfig{}
+	if err := runtime.ParseConfigSection(systemdKey, shortSystemdKey, app.Sections, config); err != nil {
+		return nil, fmt.Errorf("unable to parse systemd config: %w", err)
+	}
+	if config.Restart == "" {
+		config.Restart = "on-failure"
+	}
+	if config.RestartSec == 0 {
+		config.RestartSec = 5
+	}
+	return config, nil
+}
+
+// systemctl runs systemctl with the given arguments.
+func (i *installer) systemctl(ctx context.Context, args ...string) error {
+	if i.config.User {
+		args = append([]string{"--user"}, args...)
+	}
+	return i.run(ctx, "systemctl", args...)
+}
+
+// install installs and starts the given application.
+func (i *installer) install(ctx context.Context, app *protos.AppConfig) error {
+	// Sanity check the config.
+	if _, err := os.Stat(app.Binary); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("binary %q doesn't exist", app.Binary)
+	}
+
+	// Find the colocation groups.
+	groups, err := impl.ColocationGroups(ctx, app.Binary, app.SameProcess)
+	if err != nil {
+		return err
+	}
+
+	// Uninstall the previous version of the application, if any.
+	if _, err := os.Stat(filepath.Join(i.unitDir, unitPrefix(app.Name)+".target")); err == nil {
+		if err := i.uninstall(ctx, app.Name); err != nil {
+			return fmt.Errorf("uninstall the previous version: %w", err)
+		}
+	}
+
+	// Copy the binaries.
+	dep := &protos.Deployment{
+		Id:  uuid.New().String(),
+		App: app,
+	}
+	binDir := filepath.Join(i.stateDir, unitPrefix(app.Name), dep.Id)
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return err
+	}
+	weaver, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	for _, bin := range []struct{ src, dst string }{
+		{weaver, "weaver"},
+		{app.Binary, filepath.Base(app.Binary)},
+	} {
+		if err := copyFile(bin.src, filepath.Join(binDir, bin.dst)); err != nil {
+			return fmt.Errorf("copy %q: %w", bin.src, err)
+		}
+	}
+	app.Binary = filepath.Join(binDir, filepath.Base(app.Binary))
+
+	// Write the units.
+	port := i.config.ControllerPort
+	if port == 0 {
+		if port, err = freePort(); err != nil {
+			return err
+		}
+	}
+	units, err := i.units(dep, groups, filepath.Join(binDir, "weaver"), port)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(i.unitDir, 0755); err != nil {
+		return err
+	}
+	for _, u := range units {
+		if err := os.WriteFile(filepath.Join(i.unitDir, u.name), u.contents, 0644); err != nil {
+			return err
+		}
+	}
+
+	// Start the units.
+	if err := i.systemctl(ctx, "daemon-reload"); err != nil {
+		return err
+	}
+	target := unitPrefix(app.Name) + ".target"
+	if err := i.systemctl(ctx, "enable", "--now", target); err != nil {
+		return err
+	}
+
+	journalctl := "journalctl"
+	if i.config.User {
+		journalctl += " --user"
+	}
+	fmt.Printf("Installed %s version %s as %s.\n\n", app.Name, dep.Id, target)
+	fmt.Printf("  Follow the logs with:  weaver systemd logs --follow 'version==%q'\n", logging.Shorten(dep.Id))
+	fmt.Printf("                    or:  %s -f -u %s-controller\n", journalctl, unitPrefix(app.Name))
+	return nil
+}
+
+// uninstall stops and removes the units of the given application.
+func (i *installer) uninstall(ctx context.Context, app string) error {
+	target := unitPrefix(app) + ".target"
+	units, err := wantedUnits(filepath.Join(i.unitDir, target))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("application %s is not installed", app)
+		}
+		return err
+	}
+	if err := i.systemctl(ctx, "disable", "--now", target); err != nil {
+		return err
+	}
+	for _, unit := range append(units, target) {
+		if err := os.Remove(filepath.Join(i.unitDir, unit)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := i.systemctl(ctx, "daemon-reload"); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(i.stateDir, unitPrefix(app)))
+}
+
+// unit is a systemd unit file.
+type unit struct {
+	name     string // e.g., "weaver-hello-main.service"
+	contents []byte
+}
+
+// units returns the units of the given deployment: a service for the
+// controller and for every colocation group, and a target that wants them.
+func (i *installer) units(dep *protos.Deployment, groups []string, weaver string, port int) ([]unit, error) {
+	prefix := unitPrefix(dep.App.Name)
+	target := prefix + ".target"
+	controller := prefix + "-controller"
+	addr := fmt.Sprintf("localhost:%d", port)
+
+	env, err := proto.ToEnv(dep)
+	if err != nil {
+		return nil, err
+	}
+	services := []serviceUnit{{
+		Name:        controller,
+		Description: fmt.Sprintf("Service Weaver controller of %s", dep.App.Name),
+		Target:      target,
+		ExecStart:   append([]string{weaver, "systemd", "controller", addr}, groups...),
+		Env:         fmt.Sprintf("%s=%s", impl.DeploymentKey, env),
+		Config:      i.config,
+	}}
+	names := map[string]bool{controller: true}
+	for _, group := range groups {
+		name := prefix + "-" + sanitize(logging.ShortenComponent(group))
+		for n := 2; names[name]; n++ {
+			name = fmt.Sprintf("%s-%s-%d", prefix, sanitize(logging.ShortenComponent(group)), n)
+		}
+		names[name] = true
+
+		info := &impl.BabysitterInfo{
+			ManagerAddr: "http://" + addr,
+			Deployment:  dep,
+			Group:       &protos.ColocationGroup{Name: group},
+			LogDir:      logDir,
+		}
+		env, err := proto.ToEnv(info)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, serviceUnit{
+			Name:        name,
+			Description: fmt.Sprintf("Service Weaver colocation group %s of %s", group, dep.App.Name),
+			Target:      target,
+			After:       controller + ".service",
+			ExecStart:   []string{weaver, "systemd", "babysitter"},
+			Env:         fmt.Sprintf("%s=%s", impl.BabysitterInfoKey, env),
+			Config:      i.config,
+		})
+	}
+
+	var units []unit
+	var wants []string
+	for _, s := range services {
+		var b bytes.Buffer
+		if err := serviceTmpl.Execute(&b, s); err != nil {
+			return nil, err
+		}
+		units = append(units, unit{name: s.Name + ".service", contents: b.Bytes()})
+		wants = append(wants, s.Name+".service")
+	}
+	wantedBy := "multi-user.target"
+	if i.config.User {
+		wantedBy = "default.target"
+	}
+	var b bytes.Buffer
+	if err := targetTmpl.Execute(&b, struct {
+		App      string
+		Wants    []string
+		WantedBy string
+	}{dep.App.Name, wants, wantedBy}); err != nil {
+		return nil, err
+	}
+	units = append(units, unit{name: target, contents: b.Bytes()})
+	return units, nil
+}
+
+// wantedUnits returns the units listed in the Wants= lines of the given unit
+// file.
+func wantedUnits(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var units []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "Wants=") {
+			units = append(units, strings.Fields(strings.TrimPrefix(line, "Wants="))...)
+		}
+	}
+	return units, scanner.Err()
+}
+
+// invalidUnitChars matches the characters that are replaced in unit names.
+var invalidUnitChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// sanitize returns s, lowercased, with the characters that are invalid in unit
+// names replaced, e.g., "hello-reverser" for "hello.Reverser".
+func sanitize(s string) string {
+	return strings.Trim(invalidUnitChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// unitPrefix returns the prefix of the names of the units of the given
+// application, e.g., "weaver-hello".
+func unitPrefix(app string) string {
+	return "weaver-" + sanitize(app)
+}
+
+// freePort returns a TCP port that is currently free on localhost.
+func freePort() (int, error) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer lis.Close()
+	return lis.Addr().(*net.TCPAddr).Port, nil
+}
+
+// copyFile copies the executable file src to dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// serviceUnit is the input of serviceTmpl.
+type serviceUnit struct {
+	Name        string
+	Description string
+	Target      string   // the target the service is part of
+	After       string   // optional unit to start after
+	ExecStart   []string // command line
+	Env         string   // KEY=VALUE environment variable
+	Config      *systemdConfig
+}
+
+// quote quotes s for use in a unit file. See systemd.syntax(7) and the
+// "Specifiers" section of systemd.unit(5).
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "%", "%%")
+	return `"` + s + `"`
+}
+
+var funcs = template.FuncMap{"quote": quote}
+
+var serviceTmpl = template.Must(template.New("service").Funcs(funcs).Parse(`# Code generated by "weaver systemd install". DO NOT EDIT.
+[Unit]
+Description={{.Description}}
+PartOf={{.Target}}
+{{- if .After}}
+After={{.After}}
+{{- end}}
+
+[Service]
+ExecStart={{range $i, $arg := .ExecStart}}{{if $i}} {{end}}{{quote $arg}}{{end}}
+Environment={{quote .Env}}
+Restart={{.Config.Restart}}
+RestartSec={{.Config.RestartSec}}
+StandardOutput=journal
+StandardError=journal
+SyslogIdentifier={{.Name}}
+{{- if .Config.CPUQuota}}
+CPUQuota={{.Config.CPUQuota}}
+{{- end}}
+{{- if .Config.MemoryMax}}
+MemoryMax={{.Config.MemoryMax}}
+{{- end}}
+`))
+
+var targetTmpl = template.Must(template.New("target").Parse(`# Code generated by "weaver systemd install". DO NOT EDIT.
+[Unit]
+Description=Service Weaver application {{.App}}
+{{- range .Wants}}
+Wants={{.}}
+{{- end}}
+
+[Install]
+WantedBy={{.WantedBy}}
+`))
@@ -0,0 +1,139 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package systemd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnits(t *testing.T) {
+	i := &installer{config: &systemdConfig{
+		Restart:    "on-failure",
+		RestartSec: 5,
+		MemoryMax:  "1G",
+	}}
+	dep := &protos.Deployment{
+		Id:  "1a2b3c4d-0000-0000-0000-000000000000",
+		App: &protos.AppConfig{Name: "Hello", Binary: "/bin/hello"},
+	}
+	groups := []string{"github.com/ServiceWeaver/weaver/examples/hello/Reverser", "main"}
+	units, err := i.units(dep, groups, "/state/weaver", 9000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, u := range units {
+		names = append(names, u.name)
+	}
+	want := []string{
+		"weaver-hello-controller.service",
+		"weaver-hello-hello-reverser.service",
+		"weaver-hello-main.service",
+		"weaver-hello.target",
+	}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Fatalf("units (-want +got):\n%s", diff)
+	}
+
+	for _, test := range []struct {
+		unit  int
+		lines []string
+	}{
+		{0, []string{
+			"PartOf=weaver-hello.target",
+			`ExecStart="/state/weaver" "systemd" "controller" "localhost:9000" "github.com/ServiceWeaver/weaver/examples/hello/Reverser" "main"`,
+			`Environment="SERVICEWEAVER_DEPLOYMENT=`,
+			"Restart=on-failure",
+			"MemoryMax=1G",
+		}},
+		{2, []string{
+			"After=weaver-hello-controller.service",
+			`ExecStart="/state/weaver" "systemd" "babysitter"`,
+			`Environment="SERVICEWEAVER_BABYSITTER_INFO=`,
+			"SyslogIdentifier=weaver-hello-main",
+		}},
+		{3, []string{
+			"Wants=weaver-hello-controller.service",
+			"Wants=weaver-hello-main.service",
+			"WantedBy=multi-user.target",
+		}},
+	} {
+		contents := string(units[test.unit].contents)
+		for _, line := range test.lines {
+			if !strings.Contains(contents, "\n"+line) {
+				t.Errorf("%s does not contain %q:\n%s", units[test.unit].name, line, contents)
+			}
+		}
+	}
+	if strings.Contains(string(units[0].contents), "CPUQuota") {
+		t.Errorf("unexpected CPUQuota in %s", units[0].name)
+	}
+}
+
+func TestUninstall(t *testing.T) {
+	var commands []string
+	i := &installer{
+		config:   &systemdConfig{User: true},
+		unitDir:  t.TempDir(),
+		stateDir: t.TempDir(),
+		run: func(_ context.Context, name string, args ...string) error {
+			commands = append(commands, name+" "+strings.Join(args, " "))
+			return nil
+		},
+	}
+	dep := &protos.Deployment{Id: "1a2b3c4d", App: &protos.AppConfig{Name: "hello"}}
+	units, err := i.units(dep, []string{"main"}, "/state/weaver", 9000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range units {
+		if err := os.WriteFile(filepath.Join(i.unitDir, u.name), u.contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A unit of another application, which should be left alone.
+	other := filepath.Join(i.unitDir, "weaver-hello-world-main.service")
+	if err := os.WriteFile(other, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.uninstall(context.Background(), "hello"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"systemctl --user disable --now weaver-hello.target",
+		"systemctl --user daemon-reload",
+	}
+	if diff := cmp.Diff(want, commands); diff != "" {
+		t.Errorf("commands (-want +got):\n%s", diff)
+	}
+	files, err := filepath.Glob(filepath.Join(i.unitDir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{other}, files); diff != "" {
+		t.Errorf("remaining unit files (-want +got):\n%s", diff)
+	}
+	if err := i.uninstall(context.Background(), "hello"); err == nil {
+		t.Error("uninstall twice: unexpected success")
+	}
+}
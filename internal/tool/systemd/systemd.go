@@ -0,0 +1,68 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package systemd implements the "weaver systemd" deployer, which installs a
+// Service Weaver application on the local machine as a set of systemd units:
+// one for every colocation group, plus a controller unit that coordinates
+// them. systemd restarts failed units, enforces their resource limits, and
+// stores their output in the journal, so deployed applications outlive the
+// "weaver systemd" command that installed them.
+package systemd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/tool"
+)
+
+var (
+	// logDir is where weaver systemd deployed applications store their logs.
+	logDir = filepath.Join(logging.DefaultLogDir, "weaver_systemd")
+
+	Commands = map[string]*tool.Command{
+		"install":   &installCmd,
+		"uninstall": &uninstallCmd,
+		"logs":      tool.LogsCmd(&logsSpec),
+
+		// Hidden commands.
+		"controller": &controllerCmd,
+		"babysitter": &babysitterCmd,
+	}
+)
+
+var logsSpec = tool.LogsSpec{
+	Tool: "weaver systemd",
+	Source: func(context.Context) (logging.Source, error) {
+		return logging.FileSource(logDir), nil
+	},
+}
+
+// A runner runs the named command with the given arguments.
+type runner func(ctx context.Context, name string, args ...string) error
+
+// execRunner is a runner that runs commands as subprocesses.
+func execRunner(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,903 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// BrokerOptions configures a BrokerClient.
+type BrokerOptions struct {
+	// Brokers lists the addresses of the brokers used to discover the
+	// cluster, e.g., "kafka-1:9092". At least one address is required.
+	Brokers []string
+
+	// ClientID identifies the client in the logs and metrics of the
+	// brokers. If empty, defaults to "weaver".
+	ClientID string
+
+	// Timeout bounds every request sent to a broker. If zero, defaults to
+	// 30 seconds.
+	Timeout time.Duration
+
+	// MaxFetchBytes is the maximum number of bytes fetched at once from a
+	// partition. A message larger than MaxFetchBytes is still fetched, by
+	// itself. If zero, defaults to 1 MiB.
+	MaxFetchBytes int32
+}
+
+// BrokerClient is a Client that talks to Kafka brokers using the Kafka
+// protocol.
+//
+// BrokerClient doesn't join the consumer groups whose offsets it reads and
+// commits: Serve manages the groups, and BrokerClient commits their offsets
+// from outside of them, which Kafka allows for groups without members. Groups
+// without a committed offset start consuming at the oldest message, and a
+// group whose committed offset has been deleted by the retention policy of
+// the topic skips to the oldest message that remains.
+//
+// BrokerClient uses plaintext connections, without authentication. It reads
+// uncompressed messages and messages compressed with gzip, snappy, or zstd.
+// It reads the messages of aborted transactions too.
+type BrokerClient struct {
+	opts        BrokerOptions
+	correlation atomic.Int32 // id of the last request
+
+	mu           sync.Mutex
+	brokers      map[int32]string         // broker addresses, by node id
+	leaders      map[partitionKey]int32   // node ids of partition leaders
+	coordinators map[string]string        // coordinator addresses, by group
+	idle         map[string][]*brokerConn // idle connections, by address
+}
+
+var _ Client = &BrokerClient{}
+
+// partitionKey identifies a partition of a topic.
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// brokerConn is a connection to a broker.
+type brokerConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// brokerError is an error code returned by a broker. See
+// https://kafka.apache.org/protocol#protocol_error_codes.
+type brokerError int16
+
+// The error codes handled by a BrokerClient.
+const (
+	errOffsetOutOfRange        brokerError = 1
+	errUnknownTopicOrPartition brokerError = 3
+	errLeaderNotAvailable      brokerError = 5
+)
+
+func (e brokerError) Error() string {
+	return fmt.Sprintf("broker error code %d", int16(e))
+}
+
+// maxIdleBrokerConns is the maximum number of idle connections kept by a
+// BrokerClient for every broker.
+const maxIdleBrokerConns = 8
+
+// maxResponseSize is the maximum size of a response accepted from a broker.
+const maxResponseSize = 1 << 28
+
+// The API keys of the requests sent by a BrokerClient. See
+// https://kafka.apache.org/protocol#protocol_api_keys.
+const (
+	apiFetch           int16 = 1
+	apiListOffsets     int16 = 2
+	apiMetadata        int16 = 3
+	apiOffsetCommit    int16 = 8
+	apiOffsetFetch     int16 = 9
+	apiFindCoordinator int16 = 10
+)
+
+// earliestOffset is the timestamp of a ListOffsets request for the oldest
+// offset of a partition.
+const earliestOffset = -2
+
+// NewBrokerClient returns a new client for the Kafka cluster with the
+// provided brokers.
+func NewBrokerClient(opts BrokerOptions) (*BrokerClient, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka: no brokers")
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = "weaver"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.MaxFetchBytes <= 0 {
+		opts.MaxFetchBytes = 1 << 20
+	}
+	return &BrokerClient{
+		opts:         opts,
+		brokers:      map[int32]string{},
+		leaders:      map[partitionKey]int32{},
+		coordinators: map[string]string{},
+		idle:         map[string][]*brokerConn{},
+	}, nil
+}
+
+// Close closes the idle connections of the client.
+func (c *BrokerClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, conns := range c.idle {
+		for _, conn := range conns {
+			conn.conn.Close()
+		}
+		delete(c.idle, addr)
+	}
+	return nil
+}
+
+// Partitions implements the Client interface.
+func (c *BrokerClient) Partitions(ctx context.Context, topic string) (int32, error) {
+	var e encoder
+	e.int32(1) // topics
+	e.string(topic)
+	var err error
+	for _, addr := range c.opts.Brokers {
+		var d *decoder
+		if d, err = c.roundTrip(ctx, addr, apiMetadata, 1, e.b); err != nil {
+			continue
+		}
+		return c.updateMetadata(d, topic)
+	}
+	return 0, err
+}
+
+// updateMetadata records the brokers and the partition leaders of a Metadata
+// response, and returns the number of partitions of topic.
+func (c *BrokerClient) updateMetadata(d *decoder, topic string) (int32, error) {
+	brokers := map[int32]string{}
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller_id
+	leaders := map[partitionKey]int32{}
+	var partitions int32
+	var topicErr error
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		code := brokerError(d.int16())
+		name := d.string()
+		d.int8() // is_internal
+		if name == topic && code != 0 {
+			topicErr = code
+		}
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			d.int16() // error_code
+			p := d.int32()
+			leaders[partitionKey{name, p}] = d.int32()
+			d.skipArray(4) // replica_nodes
+			d.skipArray(4) // isr_nodes
+			if name == topic {
+				partitions++
+			}
+		}
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, addr := range brokers {
+		c.brokers[id] = addr
+	}
+	for key, leader := range leaders {
+		c.leaders[key] = leader
+	}
+	if topicErr != nil {
+		return 0, fmt.Errorf("kafka: topic %q: %w", topic, topicErr)
+	}
+	if partitions == 0 {
+		return 0, fmt.Errorf("kafka: topic %q: %w", topic, errUnknownTopicOrPartition)
+	}
+	return partitions, nil
+}
+
+// leader returns the address of the leader of a partition.
+func (c *BrokerClient) leader(ctx context.Context, topic string, partition int32) (string, error) {
+	if addr, ok := c.knownLeader(topic, partition); ok {
+		return addr, nil
+	}
+	if _, err := c.Partitions(ctx, topic); err != nil {
+		return "", err
+	}
+	if addr, ok := c.knownLeader(topic, partition); ok {
+		return addr, nil
+	}
+	return "", fmt.Errorf("kafka: topic %q, partition %d: %w", topic, partition, errLeaderNotAvailable)
+}
+
+// knownLeader returns the address of the leader of a partition, if known.
+func (c *BrokerClient) knownLeader(topic string, partition int32) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	leader, ok := c.leaders[partitionKey{topic, partition}]
+	if !ok {
+		return "", false
+	}
+	addr, ok := c.brokers[leader]
+	return addr, ok
+}
+
+// forgetLeader forgets the leader of a partition, which is looked up again
+// by the next request for the partition.
+func (c *BrokerClient) forgetLeader(topic string, partition int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.leaders, partitionKey{topic, partition})
+}
+
+// Fetch implements the Client interface.
+func (c *BrokerClient) Fetch(ctx context.Context, topic string, partition int32, offset int64, max int) ([]Message, error) {
+	msgs, err := c.fetch(ctx, topic, partition, offset, max)
+	if !errors.Is(err, errOffsetOutOfRange) {
+		return msgs, err
+	}
+	// The messages at offset may have been deleted by the retention policy
+	// of the topic. If so, skip to the oldest message that remains.
+	earliest, lerr := c.listOffset(ctx, topic, partition, earliestOffset)
+	if lerr != nil || offset >= earliest {
+		return nil, err
+	}
+	return c.fetch(ctx, topic, partition, earliest, max)
+}
+
+func (c *BrokerClient) fetch(ctx context.Context, topic string, partition int32, offset int64, max int) ([]Message, error) {
+	addr, err := c.leader(ctx, topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	var e encoder
+	e.int32(-1)                   // replica_id
+	e.int32(0)                    // max_wait_ms; Serve polls
+	e.int32(1)                    // min_bytes
+	e.int32(c.opts.MaxFetchBytes) // max_bytes
+	e.int8(0)                     // isolation_level: read uncommitted
+	e.int32(1)                    // topics
+	e.string(topic)
+	e.int32(1) // partitions
+	e.int32(partition)
+	e.int64(offset)
+	e.int32(c.opts.MaxFetchBytes) // partition_max_bytes
+	d, err := c.roundTrip(ctx, addr, apiFetch, 4, e.b)
+	if err != nil {
+		return nil, err
+	}
+
+	d.int32() // throttle_time_ms
+	var records []byte
+	code := errUnknownTopicOrPartition
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		name := d.string()
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			p := d.int32()
+			pcode := brokerError(d.int16())
+			d.int64() // high_watermark
+			d.int64() // last_stable_offset
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				d.int64() // producer_id
+				d.int64() // first_offset
+			}
+			recs := d.bytes()
+			if name == topic && p == partition {
+				code, records = pcode, recs
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if code != 0 {
+		if code != errOffsetOutOfRange {
+			c.forgetLeader(topic, partition)
+		}
+		return nil, fmt.Errorf("kafka: fetch topic %q, partition %d: %w", topic, partition, code)
+	}
+	return decodeBatches(topic, partition, records, offset, max)
+}
+
+// listOffset returns the offset of a partition for the provided timestamp,
+// e.g., earliestOffset.
+func (c *BrokerClient) listOffset(ctx context.Context, topic string, partition int32, timestamp int64) (int64, error) {
+	addr, err := c.leader(ctx, topic, partition)
+	if err != nil {
+		return 0, err
+	}
+	var e encoder
+	e.int32(-1) // replica_id
+	e.int32(1)  // topics
+	e.string(topic)
+	e.int32(1) // partitions
+	e.int32(partition)
+	e.int64(timestamp)
+	d, err := c.roundTrip(ctx, addr, apiListOffsets, 1, e.b)
+	if err != nil {
+		return 0, err
+	}
+	code, offset := errUnknownTopicOrPartition, int64(0)
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		name := d.string()
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			p := d.int32()
+			pcode := brokerError(d.int16())
+			d.int64() // timestamp
+			poffset := d.int64()
+			if name == topic && p == partition {
+				code, offset = pcode, poffset
+			}
+		}
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	if code != 0 {
+		c.forgetLeader(topic, partition)
+		return 0, fmt.Errorf("kafka: list offsets of topic %q, partition %d: %w", topic, partition, code)
+	}
+	return offset, nil
+}
+
+// coordinator returns the address of the coordinator of a consumer group.
+func (c *BrokerClient) coordinator(ctx context.Context, group string) (string, error) {
+	c.mu.Lock()
+	addr, ok := c.coordinators[group]
+	c.mu.Unlock()
+	if ok {
+		return addr, nil
+	}
+
+	var e encoder
+	e.string(group)
+	e.int8(0) // key_type: group
+	var err error
+	for _, bootstrap := range c.opts.Brokers {
+		var d *decoder
+		if d, err = c.roundTrip(ctx, bootstrap, apiFindCoordinator, 1, e.b); err != nil {
+			continue
+		}
+		d.int32() // throttle_time_ms
+		code := brokerError(d.int16())
+		d.string() // error_message
+		d.int32()  // node_id
+		host := d.string()
+		port := d.int32()
+		if d.err != nil {
+			return "", d.err
+		}
+		if code != 0 {
+			return "", fmt.Errorf("kafka: find coordinator of group %q: %w", group, code)
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(int(port)))
+		c.mu.Lock()
+		c.coordinators[group] = addr
+		c.mu.Unlock()
+		return addr, nil
+	}
+	return "", err
+}
+
+// forgetCoordinator forgets the coordinator of a group, which is looked up
+// again by the next request for the group.
+func (c *BrokerClient) forgetCoordinator(group string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.coordinators, group)
+}
+
+// Committed implements the Client interface.
+func (c *BrokerClient) Committed(ctx context.Context, group, topic string, partition int32) (int64, error) {
+	addr, err := c.coordinator(ctx, group)
+	if err != nil {
+		return 0, err
+	}
+	var e encoder
+	e.string(group)
+	e.int32(1) // topics
+	e.string(topic)
+	e.int32(1) // partition_indexes
+	e.int32(partition)
+	d, err := c.roundTrip(ctx, addr, apiOffsetFetch, 1, e.b)
+	if err != nil {
+		c.forgetCoordinator(group)
+		return 0, err
+	}
+	code, offset := errUnknownTopicOrPartition, int64(-1)
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		name := d.string()
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			p := d.int32()
+			poffset := d.int64()
+			d.string() // metadata
+			pcode := brokerError(d.int16())
+			if name == topic && p == partition {
+				code, offset = pcode, poffset
+			}
+		}
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	if code != 0 {
+		c.forgetCoordinator(group)
+		return 0, fmt.Errorf("kafka: fetch offset of group %q: %w", group, code)
+	}
+	if offset < 0 {
+		// The group hasn't committed an offset yet.
+		return c.listOffset(ctx, topic, partition, earliestOffset)
+	}
+	return offset, nil
+}
+
+// Commit implements the Client interface.
+func (c *BrokerClient) Commit(ctx context.Context, group, topic string, partition int32, offset int64) error {
+	addr, err := c.coordinator(ctx, group)
+	if err != nil {
+		return err
+	}
+	var e encoder
+	e.string(group)
+	e.int32(-1)  // generation_id: not a member of the group
+	e.string("") // member_id
+	e.int64(-1)  // retention_time_ms: the broker's default
+	e.int32(1)   // topics
+	e.string(topic)
+	e.int32(1) // partitions
+	e.int32(partition)
+	e.int64(offset)
+	e.int16(-1) // committed_metadata: null
+	d, err := c.roundTrip(ctx, addr, apiOffsetCommit, 2, e.b)
+	if err != nil {
+		c.forgetCoordinator(group)
+		return err
+	}
+	code := errUnknownTopicOrPartition
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		name := d.string()
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			p := d.int32()
+			pcode := brokerError(d.int16())
+			if name == topic && p == partition {
+				code = pcode
+			}
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if code != 0 {
+		c.forgetCoordinator(group)
+		return fmt.Errorf("kafka: commit offset of group %q: %w", group, code)
+	}
+	return nil
+}
+
+// roundTrip sends a request with the provided API key, version, and body to
+// the broker at addr, and returns a decoder of the body of its response.
+func (c *BrokerClient) roundTrip(ctx context.Context, addr string, key, version int16, body []byte) (*decoder, error) {
+	conn, err := c.get(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, conn, key, version, body)
+	if err != nil {
+		// The connection is in an unknown state.
+		conn.conn.Close()
+		return nil, fmt.Errorf("kafka: %s: %w", addr, err)
+	}
+	c.put(addr, conn)
+	return &decoder{b: resp}, nil
+}
+
+// do sends a request on conn and returns the body of its response.
+func (c *BrokerClient) do(ctx context.Context, conn *brokerConn, key, version int16, body []byte) ([]byte, error) {
+	deadline := time.Now().Add(c.opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	id := c.correlation.Add(1)
+	var header encoder
+	header.int16(key)
+	header.int16(version)
+	header.int32(id)
+	header.string(c.opts.ClientID)
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(header.b)+len(body)))
+	conn.w.Write(size[:])
+	conn.w.Write(header.b)
+	conn.w.Write(body)
+	if err := conn.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(conn.r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > maxResponseSize {
+		return nil, fmt.Errorf("invalid response size %d", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(conn.r, resp); err != nil {
+		return nil, err
+	}
+	if got := int32(binary.BigEndian.Uint32(resp)); got != id {
+		return nil, fmt.Errorf("response to request %d, want %d", got, id)
+	}
+	return resp[4:], nil
+}
+
+// get returns an idle connection to addr, or a new one if there are none.
+func (c *BrokerClient) get(ctx context.Context, addr string) (*brokerConn, error) {
+	c.mu.Lock()
+	if conns := c.idle[addr]; len(conns) > 0 {
+		conn := conns[len(conns)-1]
+		c.idle[addr] = conns[:len(conns)-1]
+		c.mu.Unlock()
+		return conn, nil
+	}
+	c.mu.Unlock()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	return &brokerConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}, nil
+}
+
+// put returns a connection to addr to the idle connections.
+func (c *BrokerClient) put(addr string, conn *brokerConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.idle[addr]) >= maxIdleBrokerConns {
+		conn.conn.Close()
+		return
+	}
+	c.idle[addr] = append(c.idle[addr], conn)
+}
+
+// Record batch attributes. See
+// https://kafka.apache.org/documentation/#recordbatch.
+const (
+	compressionMask   = 0x7
+	logAppendTimeFlag = 0x8
+	controlFlag       = 0x20
+)
+
+// recordBatchHeaderSize is the size of the header of a record batch, up to
+// and including its number of records.
+const recordBatchHeaderSize = 61
+
+// decodeBatches decodes up to max messages with an offset of at least offset
+// from the record batches returned by a fetch request. The last batch may be
+// truncated, in which case it is ignored.
+func decodeBatches(topic string, partition int32, records []byte, offset int64, max int) ([]Message, error) {
+	var msgs []Message
+	for len(records) >= 12 && len(msgs) < max {
+		size := 12 + int(int32(binary.BigEndian.Uint32(records[8:])))
+		if size > len(records) {
+			break // truncated
+		}
+		batch := records[:size]
+		records = records[size:]
+		if size < recordBatchHeaderSize {
+			return nil, fmt.Errorf("kafka: record batch of %d bytes", size)
+		}
+		if magic := int8(batch[16]); magic != 2 {
+			return nil, fmt.Errorf("kafka: unsupported message format %d", magic)
+		}
+		if crc := binary.BigEndian.Uint32(batch[17:]); crc != crc32.Checksum(batch[21:], crc32c) {
+			return nil, fmt.Errorf("kafka: corrupt record batch")
+		}
+
+		d := decoder{b: batch}
+		base := d.int64()
+		d.int32() // batch_length
+		d.int32() // partition_leader_epoch
+		d.int8()  // magic
+		d.int32() // crc
+		attrs := d.int16()
+		d.int32() // last_offset_delta
+		baseTime := d.int64()
+		maxTime := d.int64()
+		d.int64() // producer_id
+		d.int16() // producer_epoch
+		d.int32() // base_sequence
+		n := d.int32()
+		if attrs&controlFlag != 0 {
+			continue // transaction markers
+		}
+		data, err := decompress(attrs&compressionMask, d.b)
+		if err != nil {
+			return nil, err
+		}
+
+		d = decoder{b: data}
+		for i := int32(0); i < n && d.err == nil && len(msgs) < max; i++ {
+			d.varint() // length
+			d.int8()   // attributes
+			timeDelta := d.varint()
+			msg := Message{
+				Topic:     topic,
+				Partition: partition,
+				Offset:    base + d.varint(),
+				Key:       d.varbytes(),
+				Value:     d.varbytes(),
+				Time:      time.UnixMilli(baseTime + timeDelta),
+			}
+			if attrs&logAppendTimeFlag != 0 {
+				msg.Time = time.UnixMilli(maxTime)
+			}
+			if h := d.varint(); h > 0 {
+				msg.Headers = make(map[string][]byte, h)
+				for j := int64(0); j < h && d.err == nil; j++ {
+					k := d.varbytes()
+					msg.Headers[string(k)] = d.varbytes()
+				}
+			}
+			if msg.Offset >= offset && d.err == nil {
+				msgs = append(msgs, msg)
+			}
+		}
+		if d.err != nil {
+			return nil, d.err
+		}
+	}
+	return msgs, nil
+}
+
+// crc32c is the table of the checksums of record batches.
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// xerialHeader starts snappy compressed data framed by the snappy-java
+// library used by Java clients.
+var xerialHeader = []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0}
+
+// The zstd decoder is expensive to construct, but safe for concurrent use by
+// DecodeAll, so we share a single instance.
+var (
+	zstdOnce    sync.Once
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// decompress decompresses the records of a record batch compressed with the
+// provided codec.
+func decompress(codec int16, data []byte) ([]byte, error) {
+	switch codec {
+	case 0:
+		return data, nil
+	case 1:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("kafka: gzip: %w", err)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("kafka: gzip: %w", err)
+		}
+		return out, nil
+	case 2:
+		if !bytes.HasPrefix(data, xerialHeader) {
+			out, err := s2.Decode(nil, data)
+			if err != nil {
+				return nil, fmt.Errorf("kafka: snappy: %w", err)
+			}
+			return out, nil
+		}
+		// The header is followed by two versions, and by chunks prefixed
+		// with their size.
+		if len(data) < 16 {
+			return nil, fmt.Errorf("kafka: snappy: truncated header")
+		}
+		var out []byte
+		for data = data[16:]; len(data) > 0; {
+			if len(data) < 4 {
+				return nil, fmt.Errorf("kafka: snappy: truncated chunk")
+			}
+			n := int(binary.BigEndian.Uint32(data))
+			if n < 0 || 4+n > len(data) {
+				return nil, fmt.Errorf("kafka: snappy: truncated chunk")
+			}
+			chunk, err := s2.Decode(nil, data[4:4+n])
+			if err != nil {
+				return nil, fmt.Errorf("kafka: snappy: %w", err)
+			}
+			out = append(out, chunk...)
+			data = data[4+n:]
+		}
+		return out, nil
+	case 4:
+		zstdOnce.Do(func() {
+			zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+		})
+		if zstdErr != nil {
+			return nil, fmt.Errorf("kafka: zstd: %w", zstdErr)
+		}
+		out, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("kafka: zstd: %w", err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("kafka: unsupported compression codec %d", codec)
+	}
+}
+
+// encoder encodes the fields of a request.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8)   { e.b = append(e.b, byte(v)) }
+func (e *encoder) int16(v int16) { e.b = binary.BigEndian.AppendUint16(e.b, uint16(v)) }
+func (e *encoder) int32(v int32) { e.b = binary.BigEndian.AppendUint32(e.b, uint32(v)) }
+func (e *encoder) int64(v int64) { e.b = binary.BigEndian.AppendUint64(e.b, uint64(v)) }
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+// decoder decodes the fields of a response. The first decoding error is
+// stored in err, after which every field decodes as its zero value.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+// errTruncated is the error of a decoder that ran out of bytes.
+var errTruncated = errors.New("kafka: truncated response")
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errTruncated
+		return nil
+	}
+	b := d.b[:n:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) int8() int8 {
+	if b := d.read(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.read(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.read(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.read(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string decodes a nullable string, returning "" for null.
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.read(int(n)))
+}
+
+// bytes decodes nullable bytes, returning nil for null.
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.read(int(n))
+}
+
+// arrayLen decodes the length of a nullable array, returning 0 for null.
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	if int(n) > len(d.b) {
+		// Every element takes at least a byte.
+		d.err = errTruncated
+		return 0
+	}
+	return int(n)
+}
+
+// skipArray skips an array of elements of the provided size.
+func (d *decoder) skipArray(size int) {
+	d.read(d.arrayLen() * size)
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// varbytes decodes bytes prefixed with their varint length, returning nil
+// for a negative length.
+func (d *decoder) varbytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	if n > int64(len(d.b)) {
+		d.err = errTruncated
+		return nil
+	}
+	return d.read(int(n))
+}
@@ -0,0 +1,488 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/weavertest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// fakeKafka is a single Kafka broker that supports the requests sent by a
+// BrokerClient.
+type fakeKafka struct {
+	host string
+	port int32
+
+	mu       sync.Mutex
+	topics   map[string][]*fakePartition
+	offsets  map[string]int64 // committed offsets, by "<group> <topic> <partition>"
+	requests map[int16]int    // number of requests, by API key
+}
+
+// fakePartition holds the record batches of a partition.
+type fakePartition struct {
+	batches  [][]byte
+	next     int64 // offset of the next message
+	earliest int64 // offset of the oldest message not deleted
+}
+
+// startFakeKafka starts a fake Kafka broker and returns it.
+func startFakeKafka(t *testing.T) *fakeKafka {
+	t.Helper()
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	addr := lis.Addr().(*net.TCPAddr)
+	f := &fakeKafka{
+		host:     addr.IP.String(),
+		port:     int32(addr.Port),
+		topics:   map[string][]*fakePartition{},
+		offsets:  map[string]int64{},
+		requests: map[int16]int{},
+	}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeKafka) addr() string {
+	return net.JoinHostPort(f.host, strconv.Itoa(int(f.port)))
+}
+
+// createTopic creates a topic with the provided number of partitions.
+func (f *fakeKafka) createTopic(topic string, partitions int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := 0; i < partitions; i++ {
+		f.topics[topic] = append(f.topics[topic], &fakePartition{})
+	}
+}
+
+// produce appends a record batch with the provided messages, compressed with
+// codec, to a partition.
+func (f *fakeKafka) produce(t *testing.T, topic string, partition int32, codec int16, msgs ...Message) {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.topics[topic][partition]
+	p.batches = append(p.batches, encodeBatch(t, p.next, codec, msgs))
+	p.next += int64(len(msgs))
+}
+
+// deleteBefore deletes the messages of a partition before offset, as the
+// retention policy of a topic would.
+func (f *fakeKafka) deleteBefore(topic string, partition int32, offset int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.topics[topic][partition].earliest = offset
+}
+
+func (f *fakeKafka) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(r, req); err != nil {
+			return
+		}
+		d := &decoder{b: req}
+		key := d.int16()
+		d.int16() // api_version
+		id := d.int32()
+		d.string() // client_id
+
+		var e encoder
+		e.int32(0) // size, set below
+		e.int32(id)
+		f.handle(key, d, &e)
+		binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+		if _, err := conn.Write(e.b); err != nil {
+			return
+		}
+	}
+}
+
+// handle decodes a request with the provided API key and encodes its
+// response.
+func (f *fakeKafka) handle(key int16, d *decoder, e *encoder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[key]++
+	switch key {
+	case apiMetadata:
+		e.int32(1) // brokers
+		e.int32(0)
+		e.string(f.host)
+		e.int32(f.port)
+		e.int16(-1) // rack
+		e.int32(0)  // controller_id
+		n := d.int32()
+		e.int32(n) // topics
+		for i := int32(0); i < n; i++ {
+			topic := d.string()
+			partitions, ok := f.topics[topic]
+			if !ok {
+				e.int16(int16(errUnknownTopicOrPartition))
+			} else {
+				e.int16(0)
+			}
+			e.string(topic)
+			e.int8(0) // is_internal
+			e.int32(int32(len(partitions)))
+			for p := range partitions {
+				e.int16(0)
+				e.int32(int32(p))
+				e.int32(0) // leader
+				e.int32(1) // replica_nodes
+				e.int32(0)
+				e.int32(1) // isr_nodes
+				e.int32(0)
+			}
+		}
+
+	case apiFindCoordinator:
+		e.int32(0)  // throttle_time_ms
+		e.int16(0)  // error_code
+		e.int16(-1) // error_message
+		e.int32(0)  // node_id
+		e.string(f.host)
+		e.int32(f.port)
+
+	case apiOffsetFetch:
+		group := d.string()
+		f.forEachPartition(d, e, func(topic string, p int32) {
+			offset, ok := f.offsets[fmt.Sprint(group, " ", topic, " ", p)]
+			if !ok {
+				offset = -1
+			}
+			e.int64(offset)
+			e.int16(-1) // metadata
+			e.int16(0)
+		})
+
+	case apiOffsetCommit:
+		group := d.string()
+		d.int32()  // generation_id
+		d.string() // member_id
+		d.int64()  // retention_time_ms
+		f.forEachPartition(d, e, func(topic string, p int32) {
+			f.offsets[fmt.Sprint(group, " ", topic, " ", p)] = d.int64()
+			d.string() // committed_metadata
+			e.int16(0)
+		})
+
+	case apiListOffsets:
+		d.int32() // replica_id
+		f.forEachPartition(d, e, func(topic string, p int32) {
+			d.int64() // timestamp
+			e.int16(0)
+			e.int64(-1) // timestamp
+			e.int64(f.topics[topic][p].earliest)
+		})
+
+	case apiFetch:
+		d.int32() // replica_id
+		d.int32() // max_wait_ms
+		d.int32() // min_bytes
+		d.int32() // max_bytes
+		d.int8()  // isolation_level
+		e.int32(0)
+		f.forEachPartition(d, e, func(topic string, p int32) {
+			offset := d.int64()
+			d.int32() // partition_max_bytes
+			part := f.topics[topic][p]
+			outOfRange := offset < part.earliest || offset > part.next
+			if outOfRange {
+				e.int16(int16(errOffsetOutOfRange))
+			} else {
+				e.int16(0)
+			}
+			e.int64(part.next) // high_watermark
+			e.int64(part.next) // last_stable_offset
+			e.int32(-1)        // aborted_transactions
+			if outOfRange {
+				e.int32(-1) // records
+				return
+			}
+			var records []byte
+			for _, batch := range part.batches {
+				last := int64(binary.BigEndian.Uint64(batch)) + int64(binary.BigEndian.Uint32(batch[23:]))
+				if last >= offset && last >= part.earliest {
+					records = append(records, batch...)
+				}
+			}
+			if len(records) > 0 {
+				// Brokers may return a truncated last batch.
+				records = append(records, part.batches[0][:20]...)
+			}
+			e.int32(int32(len(records)))
+			e.b = append(e.b, records...)
+		})
+	}
+}
+
+// forEachPartition decodes the topics and partitions of a request, and
+// encodes the topics and partitions of its response, calling fn for every
+// partition, after its index was decoded and encoded.
+func (f *fakeKafka) forEachPartition(d *decoder, e *encoder, fn func(topic string, p int32)) {
+	n := d.int32()
+	e.int32(n)
+	for i := int32(0); i < n; i++ {
+		topic := d.string()
+		e.string(topic)
+		m := d.int32()
+		e.int32(m)
+		for j := int32(0); j < m; j++ {
+			p := d.int32()
+			e.int32(p)
+			fn(topic, p)
+		}
+	}
+}
+
+// encodeBatch encodes a record batch of messages compressed with codec.
+func encodeBatch(t *testing.T, base int64, codec int16, msgs []Message) []byte {
+	t.Helper()
+	varbytes := func(b []byte, v []byte) []byte {
+		if v == nil {
+			return binary.AppendVarint(b, -1)
+		}
+		return append(binary.AppendVarint(b, int64(len(v))), v...)
+	}
+	baseTime := msgs[0].Time.UnixMilli()
+	var records []byte
+	for i, msg := range msgs {
+		var rec []byte
+		rec = append(rec, 0) // attributes
+		rec = binary.AppendVarint(rec, msg.Time.UnixMilli()-baseTime)
+		rec = binary.AppendVarint(rec, int64(i))
+		rec = varbytes(rec, msg.Key)
+		rec = varbytes(rec, msg.Value)
+		rec = binary.AppendVarint(rec, int64(len(msg.Headers)))
+		for k, v := range msg.Headers {
+			rec = varbytes(rec, []byte(k))
+			rec = varbytes(rec, v)
+		}
+		records = append(binary.AppendVarint(records, int64(len(rec))), rec...)
+	}
+
+	switch codec {
+	case 1:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(records)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		records = buf.Bytes()
+	case 2:
+		// Frame the data like snappy-java does.
+		block := s2.EncodeSnappy(nil, records)
+		framed := append([]byte(nil), xerialHeader...)
+		framed = binary.BigEndian.AppendUint32(framed, 1)
+		framed = binary.BigEndian.AppendUint32(framed, 1)
+		framed = binary.BigEndian.AppendUint32(framed, uint32(len(block)))
+		records = append(framed, block...)
+	case 4:
+		w, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = w.EncodeAll(records, nil)
+	}
+
+	var e encoder
+	e.int64(base)
+	e.int32(int32(recordBatchHeaderSize - 12 + len(records))) // batch_length
+	e.int32(0)                                                // partition_leader_epoch
+	e.int8(2)                                                 // magic
+	e.int32(0)                                                // crc, set below
+	e.int16(codec)                                            // attributes
+	e.int32(int32(len(msgs) - 1))                             // last_offset_delta
+	e.int64(baseTime)
+	e.int64(msgs[len(msgs)-1].Time.UnixMilli()) // max_timestamp
+	e.int64(-1)                                 // producer_id
+	e.int16(-1)                                 // producer_epoch
+	e.int32(-1)                                 // base_sequence
+	e.int32(int32(len(msgs)))
+	e.b = append(e.b, records...)
+	binary.BigEndian.PutUint32(e.b[17:], crc32.Checksum(e.b[21:], crc32c))
+	return e.b
+}
+
+func TestBrokerClientFetch(t *testing.T) {
+	ctx := context.Background()
+	f := startFakeKafka(t)
+	f.createTopic("orders", 1)
+	client, err := NewBrokerClient(BrokerOptions{Brokers: []string{f.addr()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Produce two messages with every supported codec.
+	now := time.UnixMilli(time.Now().UnixMilli())
+	var all []Message
+	for _, codec := range []int16{0, 1, 2, 4} {
+		var batch []Message
+		for i := 0; i < 2; i++ {
+			offset := int64(len(all))
+			msg := Message{
+				Topic:   "orders",
+				Offset:  offset,
+				Key:     []byte(fmt.Sprint("key", offset)),
+				Value:   []byte(fmt.Sprint("value", offset)),
+				Headers: map[string][]byte{"codec": []byte(fmt.Sprint(codec))},
+				Time:    now.Add(time.Duration(offset) * time.Millisecond),
+			}
+			all = append(all, msg)
+			batch = append(batch, msg)
+		}
+		f.produce(t, "orders", 0, codec, batch...)
+	}
+
+	if n, err := client.Partitions(ctx, "orders"); err != nil || n != 1 {
+		t.Fatalf("Partitions(orders): got (%d, %v), want (1, nil)", n, err)
+	}
+	if _, err := client.Partitions(ctx, "unknown"); !errors.Is(err, errUnknownTopicOrPartition) {
+		t.Fatalf("Partitions(unknown): got %v, want %v", err, errUnknownTopicOrPartition)
+	}
+
+	for _, test := range []struct {
+		name   string
+		offset int64
+		max    int
+		want   []Message
+	}{
+		{"All", 0, 100, all},
+		{"MidBatch", 1, 100, all[1:]},
+		{"Max", 1, 3, all[1:4]},
+		{"End", int64(len(all)), 100, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := client.Fetch(ctx, "orders", 0, test.offset, test.max)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatalf("Fetch(%d, %d) (-want +got):\n%s", test.offset, test.max, diff)
+			}
+		})
+	}
+
+	// Deleted messages are skipped.
+	f.deleteBefore("orders", 0, 5)
+	got, err := client.Fetch(ctx, "orders", 0, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(all[5:], got); diff != "" {
+		t.Fatalf("Fetch after deletion (-want +got):\n%s", diff)
+	}
+}
+
+func TestBrokerClientServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: true})
+
+	f := startFakeKafka(t)
+	f.createTopic("orders", 2)
+	want := map[int32][]string{}
+	for i := 0; i < 6; i++ {
+		p := int32(i % 2)
+		value := fmt.Sprint("order", i)
+		f.produce(t, "orders", p, 0, Message{Value: []byte(value), Time: time.Now()})
+		want[p] = append(want[p], value)
+	}
+	client, err := NewBrokerClient(BrokerOptions{Brokers: []string{f.addr()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	impl := &emailerImpl{received: map[int32][]string{}}
+	// The bindings are usually recorded by "weaver generate".
+	svc := Export[emailer]("Emailer", impl)
+	svc.bindings = map[string]string{"OnOrder": "orders emailer"}
+	election := root.LeaderElection("kafka", weaver.LeaderElectionOptions{})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- Serve(ctx, client, election, Options{PollInterval: time.Millisecond}, svc)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for impl.count() < 6 {
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d messages, want 6", impl.count())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Serve: got %v, want context.Canceled", err)
+	}
+	if diff := cmp.Diff(want, impl.received); diff != "" {
+		t.Fatalf("received (-want +got):\n%s", diff)
+	}
+
+	// The offsets were committed to the broker.
+	for p := int32(0); p < 2; p++ {
+		committed, err := client.Committed(context.Background(), "emailer", "orders", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if committed != 3 {
+			t.Errorf("partition %d: committed offset %d, want 3", p, committed)
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.requests[apiOffsetCommit] == 0 {
+		t.Errorf("no offsets committed")
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kafka invokes component methods for the messages published to
+// Kafka topics.
+//
+// A method is bound to a topic and a consumer group with an annotation in the
+// component interface. The method takes a Message and returns an error:
+//
+//	type Emailer interface {
+//		//weaver:kafka orders emailer
+//		OnOrder(ctx context.Context, msg kafka.Message) error
+//	}
+//
+// "weaver generate" records the annotations. Serve, typically started in a
+// goroutine by the Init method of a component, consumes the bound topics and
+// calls the bound methods:
+//
+//	emailer, err := weaver.Get[Emailer](c)
+//	...
+//	go kafka.Serve(ctx, client, c.LeaderElection("kafka", weaver.LeaderElectionOptions{}),
+//		kafka.Options{}, kafka.Export("Emailer", emailer))
+//
+// The consumer group is managed by the Service Weaver runtime, rather than
+// by Kafka's group protocol: only the leader of the election consumes, and it
+// calls the bound method for the messages of every partition through the
+// component's client. To map every partition to a replica of the component,
+// route the method by partition:
+//
+//	type emailerRouter struct{}
+//
+//	func (emailerRouter) OnOrder(_ context.Context, msg kafka.Message) int32 {
+//		return msg.Partition
+//	}
+//
+// The messages of a partition are delivered one at a time, in order. If the
+// method returns an error, it is called again with the same message after a
+// backoff, so a message is only delivered after the previous messages of its
+// partition were handled successfully. The offset of the consumer group is
+// committed after every successful call. Delivery is at least once: a message
+// may be delivered again, e.g., if leadership changes before its offset is
+// committed, so methods must be idempotent.
+//
+// Serve uses a Client to fetch messages and commit offsets. NewBrokerClient
+// returns a client that talks to a Kafka cluster:
+//
+//	client, err := kafka.NewBrokerClient(kafka.BrokerOptions{
+//		Brokers: []string{"kafka-1:9092", "kafka-2:9092"},
+//	})
+//
+// NewMemoryClient returns an in-memory client for tests and local
+// development. Adapters for other Kafka client libraries implement the Client
+// interface.
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+)
+
+//go:generate ../cmd/weaver/weaver generate
+
+// Message is a message, or record, of a Kafka topic.
+type Message struct {
+	weaver.AutoMarshal
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   map[string][]byte
+	Time      time.Time
+}
+
+// A Client fetches the messages of Kafka topics and stores the offsets of
+// consumer groups.
+type Client interface {
+	// Partitions returns the number of partitions of a topic.
+	Partitions(ctx context.Context, topic string) (int32, error)
+
+	// Fetch returns up to max messages of a partition of a topic, in order,
+	// starting at the provided offset. It returns no messages if there are
+	// no messages at the offset yet.
+	Fetch(ctx context.Context, topic string, partition int32, offset int64, max int) ([]Message, error)
+
+	// Committed returns the committed offset of a consumer group for a
+	// partition of a topic, i.e., the offset of the next message to
+	// consume. If the group hasn't committed an offset yet, it returns the
+	// offset where the group should start consuming.
+	Committed(ctx context.Context, group, topic string, partition int32) (int64, error)
+
+	// Commit commits the offset of a consumer group for a partition of a
+	// topic.
+	Commit(ctx context.Context, group, topic string, partition int32, offset int64) error
+}
+
+// Options configures Serve.
+type Options struct {
+	// MaxBatch is the maximum number of messages fetched at once from a
+	// partition. If zero, defaults to 100.
+	MaxBatch int
+
+	// MinBackoff and MaxBackoff bound the exponential backoff between calls
+	// of a method that failed to handle a message. If zero, they default to
+	// 100 milliseconds and 10 seconds.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// PollInterval is how long to wait before fetching from a partition
+	// again, after it had no new messages or the client failed. If zero,
+	// defaults to 100 milliseconds.
+	PollInterval time.Duration
+}
+
+// A Service is a component whose methods are bound to Kafka topics.
+type Service struct {
+	name     string
+	iface    reflect.Type
+	impl     any
+	bindings map[string]string // "<topic> <group>", by method
+}
+
+// Export exports the annotated methods of the component impl, typically
+// returned by weaver.Get.
+func Export[T any](name string, impl T) Service {
+	iface := reflect.TypeOf((*T)(nil)).Elem()
+	svc := Service{name: name, iface: iface, impl: impl}
+	for _, reg := range codegen.Registered() {
+		if reg.Iface == iface {
+			svc.bindings = reg.KafkaBindings
+		}
+	}
+	return svc
+}
+
+// binding is a method bound to a topic and a consumer group.
+type binding struct {
+	service string
+	method  string
+	topic   string
+	group   string
+	fn      reflect.Value // component method
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	messageType = reflect.TypeOf(Message{})
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Serve calls the methods of the provided services for the messages of the
+// topics they are bound to, whenever it is the leader of election, until ctx
+// is canceled. It returns ctx.Err() when ctx is canceled, or an error if a
+// method can't be bound. Errors returned by the client are retried.
+func Serve(ctx context.Context, client Client, election *weaver.LeaderElection, opts Options, services ...Service) error {
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = 100
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 10 * time.Second
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 100 * time.Millisecond
+	}
+	bindings, err := newBindings(services)
+	if err != nil {
+		return err
+	}
+	for {
+		leading, resign, err := election.Lead(ctx)
+		if err != nil {
+			return err
+		}
+		var wg sync.WaitGroup
+		for _, b := range bindings {
+			b := b
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b.serve(leading, client, opts)
+			}()
+		}
+		wg.Wait()
+		resign()
+	}
+}
+
+// newBindings returns the bindings of the annotated methods of services.
+func newBindings(services []Service) ([]*binding, error) {
+	var bindings []*binding
+	bound := map[[2]string]*binding{}
+	for _, svc := range services {
+		if svc.iface.Kind() != reflect.Interface {
+			return nil, fmt.Errorf("kafka: %s: %v is not an interface", svc.name, svc.iface)
+		}
+		methods := make([]string, 0, len(svc.bindings))
+		for method := range svc.bindings {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			m, ok := svc.iface.MethodByName(method)
+			if !ok {
+				return nil, fmt.Errorf("kafka: %s.%s: method not found", svc.name, method)
+			}
+			t := m.Type
+			if t.NumIn() != 2 || t.In(0) != contextType || t.In(1) != messageType || t.NumOut() != 1 || t.Out(0) != errorType {
+				return nil, fmt.Errorf("kafka: %s.%s: method must have signature func(context.Context, kafka.Message) error", svc.name, method)
+			}
+			topic, group, ok := strings.Cut(svc.bindings[method], " ")
+			if !ok || topic == "" || group == "" {
+				return nil, fmt.Errorf("kafka: %s.%s: invalid binding %q", svc.name, method, svc.bindings[method])
+			}
+			key := [2]string{topic, group}
+			if other, ok := bound[key]; ok {
+				return nil, fmt.Errorf("kafka: %s.%s and %s.%s are both bound to topic %q and group %q", other.service, other.method, svc.name, method, topic, group)
+			}
+			b := &binding{
+				service: svc.name,
+				method:  method,
+				topic:   topic,
+				group:   group,
+				fn:      reflect.ValueOf(svc.impl).MethodByName(method),
+			}
+			bound[key] = b
+			bindings = append(bindings, b)
+		}
+	}
+	return bindings, nil
+}
+
+// serve consumes every partition of the binding's topic until ctx is done.
+func (b *binding) serve(ctx context.Context, client Client, opts Options) {
+	var n int32
+	for {
+		var err error
+		if n, err = client.Partitions(ctx, b.topic); err == nil {
+			break
+		}
+		if !sleep(ctx, opts.PollInterval) {
+			return
+		}
+	}
+	var wg sync.WaitGroup
+	for p := int32(0); p < n; p++ {
+		p := p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.consume(ctx, client, p, opts)
+		}()
+	}
+	wg.Wait()
+}
+
+// consume delivers the messages of a partition until ctx is done.
+func (b *binding) consume(ctx context.Context, client Client, partition int32, opts Options) {
+	offset := int64(-1) // unknown
+	for ctx.Err() == nil {
+		if offset < 0 {
+			committed, err := client.Committed(ctx, b.group, b.topic, partition)
+			if err != nil {
+				sleep(ctx, opts.PollInterval)
+				continue
+			}
+			offset = committed
+		}
+		msgs, err := client.Fetch(ctx, b.topic, partition, offset, opts.MaxBatch)
+		if err != nil || len(msgs) == 0 {
+			sleep(ctx, opts.PollInterval)
+			continue
+		}
+		for _, msg := range msgs {
+			if !b.deliver(ctx, msg, opts) {
+				return
+			}
+			offset = msg.Offset + 1
+			// A failed commit is covered by the next successful one. If no
+			// commit succeeds, the message is delivered again later.
+			client.Commit(ctx, b.group, b.topic, partition, offset)
+		}
+	}
+}
+
+// deliver calls the bound method with msg until it succeeds, and returns
+// true, or until ctx is done, and returns false.
+func (b *binding) deliver(ctx context.Context, msg Message, opts Options) bool {
+	backoff := opts.MinBackoff
+	for {
+		results := b.fn.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(msg)})
+		if err, _ := results[0].Interface().(error); err == nil {
+			return true
+		}
+		if !sleep(ctx, backoff) {
+			return false
+		}
+		if backoff *= 2; backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
+
+// sleep sleeps for d, and returns false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/weavertest"
+	"github.com/google/go-cmp/cmp"
+)
+
+type emailer interface {
+	OnOrder(ctx context.Context, msg Message) error
+}
+
+type emailerImpl struct {
+	mu       sync.Mutex
+	received map[int32][]string // values, by partition
+	failed   bool
+}
+
+func (e *emailerImpl) OnOrder(_ context.Context, msg Message) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if string(msg.Value) == "flaky" && !e.failed {
+		e.failed = true
+		return errors.New("flaky failure")
+	}
+	e.received[msg.Partition] = append(e.received[msg.Partition], string(msg.Value))
+	return nil
+}
+
+func (e *emailerImpl) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := 0
+	for _, values := range e.received {
+		n += len(values)
+	}
+	return n
+}
+
+func TestServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: true})
+
+	client := NewMemoryClient()
+	if err := client.CreateTopic("orders", 3); err != nil {
+		t.Fatal(err)
+	}
+	want := map[int32][]string{}
+	produce := func(key, value string) {
+		t.Helper()
+		msg, err := client.Produce("orders", []byte(key), []byte(value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[msg.Partition] = append(want[msg.Partition], value)
+	}
+	for i := 0; i < 10; i++ {
+		produce(fmt.Sprint("user", i%4), fmt.Sprint("order", i))
+	}
+	produce("user1", "flaky")
+	produce("user1", "after flaky")
+
+	impl := &emailerImpl{received: map[int32][]string{}}
+	// The bindings are usually recorded by "weaver generate".
+	svc := Export[emailer]("Emailer", impl)
+	svc.bindings = map[string]string{"OnOrder": "orders emailer"}
+	election := root.LeaderElection("kafka", weaver.LeaderElectionOptions{})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- Serve(ctx, client, election, Options{MinBackoff: time.Millisecond, PollInterval: time.Millisecond}, svc)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for impl.count() < 12 {
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d messages, want 12", impl.count())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Serve: got %v, want context.Canceled", err)
+	}
+
+	// Messages are delivered in order within every partition, and the
+	// flaky message is retried before the next message is delivered.
+	if diff := cmp.Diff(want, impl.received); diff != "" {
+		t.Fatalf("received (-want +got):\n%s", diff)
+	}
+	for p := int32(0); p < 3; p++ {
+		committed, err := client.Committed(context.Background(), "emailer", "orders", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := committed, int64(len(want[p])); got != want {
+			t.Errorf("partition %d: committed offset %d, want %d", p, got, want)
+		}
+	}
+}
+
+type badEmailer interface {
+	OnOrder(ctx context.Context, order string) error
+}
+
+type badEmailerImpl struct{}
+
+func (badEmailerImpl) OnOrder(context.Context, string) error { return nil }
+
+func TestServeErrors(t *testing.T) {
+	ctx := context.Background()
+	client := NewMemoryClient()
+
+	bad := Export[badEmailer]("Bad", badEmailerImpl{})
+	bad.bindings = map[string]string{"OnOrder": "orders emailer"}
+	a := Export[emailer]("A", &emailerImpl{})
+	a.bindings = map[string]string{"OnOrder": "orders emailer"}
+	b := Export[emailer]("B", &emailerImpl{})
+	b.bindings = map[string]string{"OnOrder": "orders emailer"}
+
+	for _, test := range []struct {
+		name     string
+		services []Service
+		want     string
+	}{
+		{"Signature", []Service{bad}, "must have signature"},
+		{"Duplicate", []Service{a, b}, `A.OnOrder and B.OnOrder are both bound to topic "orders" and group "emailer"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := Serve(ctx, client, nil, Options{}, test.services...)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Serve: got %v, want error containing %q", err, test.want)
+			}
+		})
+	}
+}
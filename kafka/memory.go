@@ -0,0 +1,149 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// MemoryClient is a Client that stores topics in memory. It is meant for
+// tests and local development.
+type MemoryClient struct {
+	mu      sync.Mutex
+	topics  map[string]*memoryTopic
+	offsets map[memoryOffset]int64
+}
+
+var _ Client = &MemoryClient{}
+
+// memoryTopic holds the messages of a topic.
+type memoryTopic struct {
+	partitions [][]Message
+	next       int32 // partition of the next message without a key
+}
+
+// memoryOffset identifies the offset of a consumer group for a partition.
+type memoryOffset struct {
+	group     string
+	topic     string
+	partition int32
+}
+
+// NewMemoryClient returns a new in-memory client without topics.
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		topics:  map[string]*memoryTopic{},
+		offsets: map[memoryOffset]int64{},
+	}
+}
+
+// CreateTopic creates a topic with the provided number of partitions.
+func (c *MemoryClient) CreateTopic(topic string, partitions int32) error {
+	if partitions <= 0 {
+		return fmt.Errorf("kafka: invalid number of partitions %d", partitions)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.topics[topic]; ok {
+		return fmt.Errorf("kafka: topic %q already exists", topic)
+	}
+	c.topics[topic] = &memoryTopic{partitions: make([][]Message, partitions)}
+	return nil
+}
+
+// Produce appends a message with the provided key and value to a topic, and
+// returns it. Messages with the same key are appended to the same partition.
+// Messages without a key are spread over the partitions.
+func (c *MemoryClient) Produce(topic string, key, value []byte) (Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.topics[topic]
+	if !ok {
+		return Message{}, fmt.Errorf("kafka: unknown topic %q", topic)
+	}
+	n := int32(len(t.partitions))
+	var p int32
+	if key == nil {
+		p = t.next
+		t.next = (t.next + 1) % n
+	} else {
+		h := fnv.New32a()
+		h.Write(key)
+		p = int32(h.Sum32() % uint32(n))
+	}
+	msg := Message{
+		Topic:     topic,
+		Partition: p,
+		Offset:    int64(len(t.partitions[p])),
+		Key:       key,
+		Value:     value,
+		Time:      time.Now(),
+	}
+	t.partitions[p] = append(t.partitions[p], msg)
+	return msg, nil
+}
+
+// Partitions implements the Client interface.
+func (c *MemoryClient) Partitions(_ context.Context, topic string) (int32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.topics[topic]
+	if !ok {
+		return 0, fmt.Errorf("kafka: unknown topic %q", topic)
+	}
+	return int32(len(t.partitions)), nil
+}
+
+// Fetch implements the Client interface.
+func (c *MemoryClient) Fetch(_ context.Context, topic string, partition int32, offset int64, max int) ([]Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.topics[topic]
+	if !ok {
+		return nil, fmt.Errorf("kafka: unknown topic %q", topic)
+	}
+	if partition < 0 || int(partition) >= len(t.partitions) {
+		return nil, fmt.Errorf("kafka: topic %q has no partition %d", topic, partition)
+	}
+	msgs := t.partitions[partition]
+	if offset < 0 || offset > int64(len(msgs)) {
+		return nil, fmt.Errorf("kafka: offset %d out of range", offset)
+	}
+	msgs = msgs[offset:]
+	if len(msgs) > max {
+		msgs = msgs[:max]
+	}
+	return append([]Message(nil), msgs...), nil
+}
+
+// Committed implements the Client interface. Groups without a committed
+// offset start consuming at the oldest message.
+func (c *MemoryClient) Committed(_ context.Context, group, topic string, partition int32) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offsets[memoryOffset{group, topic, partition}], nil
+}
+
+// Commit implements the Client interface.
+func (c *MemoryClient) Commit(_ context.Context, group, topic string, partition int32, offset int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offsets[memoryOffset{group, topic, partition}] = offset
+	return nil
+}
@@ -0,0 +1,84 @@
+package kafka
+
+// Code generated by "weaver generate". DO NOT EDIT.
+import (
+	"fmt"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+)
+
+
+// Local stub implementations.
+
+// Client stub implementations.
+
+// Server stub implementations.
+
+// AutoMarshal implementations.
+
+var _ codegen.AutoMarshal = &Message{}
+
+func (x *Message) WeaverMarshal(enc *codegen.Encoder) {
+	if x == nil {
+		panic(fmt.Errorf("Message.WeaverMarshal: nil receiver"))
+	}
+	enc.String(x.Topic)
+	enc.Int32(x.Partition)
+	enc.Int64(x.Offset)
+	serviceweaver_enc_slice_byte_87461245(enc, x.Key)
+	serviceweaver_enc_slice_byte_87461245(enc, x.Value)
+	serviceweaver_enc_map_string_slice_byte_7ebbaefa(enc, x.Headers)
+	enc.Time(x.Time)
+}
+
+func (x *Message) WeaverUnmarshal(dec *codegen.Decoder) {
+	if x == nil {
+		panic(fmt.Errorf("Message.WeaverUnmarshal: nil receiver"))
+	}
+	x.Topic = dec.String()
+	x.Partition = dec.Int32()
+	x.Offset = dec.Int64()
+	x.Key = serviceweaver_dec_slice_byte_87461245(dec)
+	x.Value = serviceweaver_dec_slice_byte_87461245(dec)
+	x.Headers = serviceweaver_dec_map_string_slice_byte_7ebbaefa(dec)
+	x.Time = dec.Time()
+}
+
+func serviceweaver_enc_slice_byte_87461245(enc *codegen.Encoder, arg []byte) {
+	enc.Bytes(arg)
+}
+
+func serviceweaver_dec_slice_byte_87461245(dec *codegen.Decoder) []byte {
+	return dec.Bytes()
+}
+
+func serviceweaver_enc_map_string_slice_byte_7ebbaefa(enc *codegen.Encoder, arg map[string][]byte) {
+	if arg == nil {
+		enc.Len(-1)
+		return
+	}
+	enc.Len(len(arg))
+	for k, v := range arg {
+		enc.String(k)
+		serviceweaver_enc_slice_byte_87461245(enc, v)
+	}
+}
+
+func serviceweaver_dec_map_string_slice_byte_7ebbaefa(dec *codegen.Decoder) map[string][]byte {
+	n := dec.Len()
+	if n == -1 {
+		return nil
+	}
+	res := make(map[string][]byte, n)
+	var k string
+	var v []byte
+	for i := 0; i < n; i++ {
+		k = dec.String()
+		v = serviceweaver_dec_slice_byte_87461245(dec)
+		res[k] = v
+	}
+	return res
+}
+
+func init() {
+	codegen.RegisterSerializable[Message]()
+}
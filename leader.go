@@ -0,0 +1,243 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/uuid"
+)
+
+// defaultLease is the default lease of a leader election.
+const defaultLease = 15 * time.Second
+
+// LeaderElectionOptions configures a [LeaderElection].
+type LeaderElectionOptions struct {
+	// Lease is how long a leader remains the leader without renewing its
+	// lease. A leader renews its lease several times per lease period, so a
+	// leader that crashes is replaced after at most one lease. If zero, a
+	// default lease of 15 seconds is used.
+	Lease time.Duration
+}
+
+// A LeaderElection elects a single leader among the candidates that take
+// part in an election with the same name, across all of the processes of a
+// deployment. It is useful to make sure that only one replica of a component
+// performs a task, like a compaction or a periodic job. The leases behind the
+// election are kept by the deployer.
+//
+// For example, a component can run a task only while it is the leader:
+//
+//	func (c *compactor) Init(ctx context.Context) error {
+//	    election := c.LeaderElection("compaction", weaver.LeaderElectionOptions{})
+//	    go func() {
+//	        for {
+//	            leading, resign, err := election.Lead(ctx)
+//	            if err != nil {
+//	                return // ctx is done
+//	            }
+//	            c.compact(leading) // returns when leading is done
+//	            resign()
+//	        }
+//	    }()
+//	    return nil
+//	}
+type LeaderElection struct {
+	env       env
+	info      *protos.WeaveletInfo
+	name      string        // name of the election
+	candidate string        // unique id of this candidate
+	lease     time.Duration // lease requested by this candidate
+	retry     time.Duration // how often a candidate campaigns
+
+	mu      sync.Mutex
+	active  bool  // is Lead in progress or is the candidate leading?
+	leading bool  // is the candidate leading?
+	token   int64 // fencing token of the lease, if leading
+}
+
+// LeaderElection returns a new candidate in the leader election with the
+// provided name.
+func (c *componentImpl) LeaderElection(name string, opts LeaderElectionOptions) *LeaderElection {
+	lease := opts.Lease
+	if lease <= 0 {
+		lease = defaultLease
+	}
+	return newLeaderElection(c.component.wlet, name, lease, lease/3)
+}
+
+func newLeaderElection(wlet *weavelet, name string, lease, retry time.Duration) *LeaderElection {
+	return &LeaderElection{
+		env:       wlet.env,
+		info:      wlet.info,
+		name:      name,
+		candidate: uuid.New().String(),
+		lease:     lease,
+		retry:     retry,
+	}
+}
+
+// Lead blocks until the candidate is elected leader, or until ctx is done.
+// Once elected, Lead returns a context that is done when the candidate stops
+// being the leader, along with a function that resigns the leadership. The
+// candidate stops being the leader when resign is called, when ctx is done,
+// or when it fails to renew its lease in time. Callers should stop the work
+// that requires leadership as soon as the returned context is done, and call
+// resign to release the lease.
+//
+// A candidate can only lead once at a time: Lead returns an error if it is
+// called again before the previous leadership is resigned.
+func (l *LeaderElection) Lead(ctx context.Context) (context.Context, func(), error) {
+	l.mu.Lock()
+	if l.active {
+		l.mu.Unlock()
+		return nil, nil, fmt.Errorf("leader election %q: candidate is already running", l.name)
+	}
+	l.active = true
+	l.mu.Unlock()
+
+	// Campaign until the candidate is elected.
+	var expires time.Time
+	var token int64
+	for {
+		if err := ctx.Err(); err != nil {
+			l.mu.Lock()
+			l.active = false
+			l.mu.Unlock()
+			return nil, nil, err
+		}
+		start := time.Now()
+		reply, err := l.elect(ctx, l.lease)
+		if err != nil {
+			l.env.SystemLogger().Error("leader election", err, "election", l.name)
+		}
+		if reply.GetLeader() == l.candidate {
+			token = reply.Token
+			// Note that the lease is granted after start, so it's safe to
+			// assume it expires after start + l.lease.
+			expires = start.Add(l.lease)
+			break
+		}
+		select {
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.active = false
+			l.mu.Unlock()
+			return nil, nil, ctx.Err()
+		case <-time.After(l.retry):
+		}
+	}
+
+	l.mu.Lock()
+	l.leading = true
+	l.token = token
+	l.mu.Unlock()
+	leading, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.renew(leading, cancel, expires, token)
+	}()
+	var once sync.Once
+	resign := func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+	return leading, resign, nil
+}
+
+// renew renews the lease of the leader until ctx is done, or until the lease
+// can't be renewed. It then releases the lease.
+func (l *LeaderElection) renew(ctx context.Context, cancel context.CancelFunc, expires time.Time, token int64) {
+	// Stop leading when the lease expires, even if a renewal is in progress.
+	expiry := time.AfterFunc(time.Until(expires), cancel)
+	defer func() {
+		expiry.Stop()
+		cancel()
+		l.mu.Lock()
+		l.leading = false
+		l.token = 0
+		l.mu.Unlock()
+
+		// Release the lease, so that the other candidates don't have to
+		// wait for it to expire.
+		if _, err := l.elect(context.Background(), 0); err != nil {
+			l.env.SystemLogger().Error("leader election: release lease", err, "election", l.name)
+		}
+		l.mu.Lock()
+		l.active = false
+		l.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(l.lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		start := time.Now()
+		reply, err := l.elect(ctx, l.lease)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// Keep trying until the lease expires.
+			l.env.SystemLogger().Error("leader election: renew lease", err, "election", l.name)
+			continue
+		}
+		if reply.Leader != l.candidate || reply.Token != token {
+			// Either another candidate holds the lease, or the lease
+			// expired before it was granted to this candidate again.
+			l.env.SystemLogger().Error("leader election", fmt.Errorf("lost leadership"), "election", l.name)
+			return
+		}
+		expiry.Reset(time.Until(start.Add(l.lease)))
+	}
+}
+
+// IsLeader returns whether the candidate is currently the leader.
+func (l *LeaderElection) IsLeader() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leading
+}
+
+// fencingToken returns the fencing token of the lease, or zero if the
+// candidate isn't leading.
+func (l *LeaderElection) fencingToken() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.token
+}
+
+// elect requests a lease of the provided duration, or releases the lease if
+// the duration is zero.
+func (l *LeaderElection) elect(ctx context.Context, lease time.Duration) (*protos.LeaderElectionReply, error) {
+	return l.env.ElectLeader(ctx, &protos.LeaderElectionRequest{
+		App:          l.info.App,
+		DeploymentId: l.info.DeploymentId,
+		Election:     l.name,
+		Candidate:    l.candidate,
+		LeaseNanos:   int64(lease),
+	})
+}
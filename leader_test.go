@@ -0,0 +1,135 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/election"
+	"github.com/ServiceWeaver/weaver/internal/logtype"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// electionEnv is an env that only implements leader elections.
+type electionEnv struct {
+	env // nil; only ElectLeader and SystemLogger are called
+
+	mu       sync.Mutex
+	leases   *election.Leases
+	disabled bool // if true, renewals fail
+}
+
+func (e *electionEnv) ElectLeader(_ context.Context, req *protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.disabled && req.LeaseNanos != 0 {
+		return &protos.LeaderElectionReply{}, nil
+	}
+	return e.leases.Elect(req, time.Now()), nil
+}
+
+func (e *electionEnv) SystemLogger() logtype.Logger {
+	return discardingLogger{}
+}
+
+// newElectionComponent returns a component that runs in the provided env.
+func newElectionComponent(e env) *componentImpl {
+	return &componentImpl{component: &component{wlet: &weavelet{
+		env:  e,
+		info: &protos.WeaveletInfo{App: "app", DeploymentId: "dep"},
+	}}}
+}
+
+func newTestElection(e env, lease time.Duration) *LeaderElection {
+	return newElectionComponent(e).LeaderElection("test", LeaderElectionOptions{Lease: lease})
+}
+
+func TestLeaderElection(t *testing.T) {
+	ctx := context.Background()
+	e := &electionEnv{leases: election.NewLeases()}
+	a := newTestElection(e, time.Second)
+	b := newTestElection(e, time.Second)
+
+	// a is elected.
+	leading, resign, err := a.Lead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsLeader() {
+		t.Fatal("a: not leader after Lead")
+	}
+	if _, _, err := a.Lead(ctx); err == nil {
+		t.Fatal("a: unexpected success leading twice")
+	}
+
+	// b can't be elected while a leads.
+	short, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	if _, _, err := b.Lead(short); err == nil {
+		t.Fatal("b: unexpected election while a leads")
+	}
+
+	// Once a resigns, b is elected.
+	resign()
+	if leading.Err() == nil {
+		t.Fatal("a: leadership context not done after resign")
+	}
+	if a.IsLeader() {
+		t.Fatal("a: leader after resign")
+	}
+	_, resign, err = b.Lead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resign()
+}
+
+func TestLeaderElectionCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e := &electionEnv{leases: election.NewLeases()}
+	a := newTestElection(e, time.Second)
+	if _, _, err := a.Lead(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Lead: got %v, want context.Canceled", err)
+	}
+	if a.IsLeader() {
+		t.Fatal("a: leader after canceled Lead")
+	}
+}
+
+func TestLeaderElectionLostLease(t *testing.T) {
+	ctx := context.Background()
+	e := &electionEnv{leases: election.NewLeases()}
+	a := newTestElection(e, 300*time.Millisecond)
+	leading, resign, err := a.Lead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resign()
+
+	// Once renewals fail, a stops leading.
+	e.mu.Lock()
+	e.disabled = true
+	e.mu.Unlock()
+	select {
+	case <-leading.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("a: still leading after renewals fail")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+)
+
+// listen listens on the provided TCP address, with the provided config. If
+// conns is not nil, it tracks the accepted connections.
+func listen(ctx context.Context, addr string, config runtime.ListenerConfig, conns *connTracker) (net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: config.KeepAlive}
+	if config.ReusePort {
+		lc.Control = reusePort
+	}
+	l, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if config.Backlog > 0 {
+		if err := setBacklog(l.(*net.TCPListener), config.Backlog); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	if conns != nil {
+		// Track the connections below TLS, so that http.Server still sees
+		// the *tls.Conn it needs to serve HTTPS.
+		l = &trackingListener{Listener: l, conns: conns}
+	}
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l = tls.NewListener(l, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+			NextProtos:   []string{"h2", "http/1.1"},
+		})
+	}
+	return l, nil
+}
+
+// A connTracker tracks the open connections accepted by a listener, so that
+// a shutting down weavelet can wait for them to be closed.
+type connTracker struct {
+	draining chan struct{} // closed when the listener starts draining
+	once     sync.Once     // closes draining
+
+	mu      sync.Mutex
+	n       int           // number of open connections
+	idle    chan struct{} // closed when draining and n == 0
+	drained bool          // is idle closed?
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{draining: make(chan struct{}), idle: make(chan struct{})}
+}
+
+// active returns the number of open connections.
+func (t *connTracker) active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.n
+}
+
+// add records a newly accepted connection.
+func (t *connTracker) add() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.n++
+}
+
+// done records the closing of a connection.
+func (t *connTracker) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.n--
+	t.closeIdleIfDrained()
+}
+
+// closeIdleIfDrained closes t.idle if the listener is draining and has no
+// open connections. REQUIRES: t.mu is held.
+func (t *connTracker) closeIdleIfDrained() {
+	select {
+	case <-t.draining:
+	default:
+		return
+	}
+	if t.n == 0 && !t.drained {
+		t.drained = true
+		close(t.idle)
+	}
+}
+
+// drain signals the start of draining and waits until all connections are
+// closed, or until the timeout elapses.
+func (t *connTracker) drain(timeout time.Duration) {
+	t.once.Do(func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		close(t.draining)
+		t.closeIdleIfDrained()
+	})
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-t.idle:
+	case <-timer.C:
+	}
+}
+
+// trackingListener is a net.Listener that records its accepted connections
+// in a connTracker.
+type trackingListener struct {
+	net.Listener
+	conns *connTracker
+}
+
+// Accept implements the net.Listener interface.
+func (l *trackingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.conns.add()
+	return &trackedConn{Conn: c, conns: l.conns}, nil
+}
+
+// trackedConn is a net.Conn that records its closing in a connTracker.
+type trackedConn struct {
+	net.Conn
+	conns *connTracker
+	once  sync.Once
+}
+
+// Close implements the net.Conn interface.
+func (c *trackedConn) Close() error {
+	c.once.Do(c.conns.done)
+	return c.Conn.Close()
+}
@@ -0,0 +1,35 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !unix
+
+package weaver
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"syscall"
+)
+
+// reusePort fails, since SO_REUSEPORT is not supported on this platform.
+func reusePort(_, _ string, _ syscall.RawConn) error {
+	return fmt.Errorf("reuse_port is not supported on %s", runtime.GOOS)
+}
+
+// setBacklog fails, since setting the backlog is not supported on this
+// platform.
+func setBacklog(*net.TCPListener, int) error {
+	return fmt.Errorf("backlog is not supported on %s", runtime.GOOS)
+}
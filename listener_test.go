@@ -0,0 +1,143 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	goruntime "runtime"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+)
+
+func TestListenTLS(t *testing.T) {
+	files := newTestCA(t).writeFiles(t, t.TempDir())
+	config := runtime.ListenerConfig{CertFile: files.CertFile, KeyFile: files.KeyFile}
+	l, err := listen(context.Background(), "localhost:0", config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := len(conn.ConnectionState().PeerCertificates); got == 0 {
+		t.Fatal("no server certificate")
+	}
+}
+
+func TestListenReusePort(t *testing.T) {
+	if goruntime.GOOS == "windows" {
+		t.Skip("SO_REUSEPORT is not supported")
+	}
+	config := runtime.ListenerConfig{ReusePort: true, Backlog: 16}
+	first, err := listen(context.Background(), "localhost:0", config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+
+	// A second listener can listen on the same address.
+	second, err := listen(context.Background(), first.Addr().String(), config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	// Without SO_REUSEPORT, it can't.
+	if l, err := net.Listen("tcp", first.Addr().String()); err == nil {
+		l.Close()
+		t.Fatal("unexpected success listening on a used address")
+	}
+}
+
+func TestListenerDrain(t *testing.T) {
+	conns := newConnTracker()
+	l, err := listen(context.Background(), "localhost:0", runtime.ListenerConfig{}, conns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	lis := &Listener{Listener: l, conns: conns}
+
+	// Open a connection.
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lis.ActiveConns(), 1; got != want {
+		t.Fatalf("ActiveConns: got %d, want %d", got, want)
+	}
+
+	// Draining waits for the connection to be closed.
+	drained := make(chan struct{})
+	go func() {
+		conns.drain(time.Minute)
+		close(drained)
+	}()
+	<-lis.Draining()
+	select {
+	case <-drained:
+		t.Fatal("drain returned with an open connection")
+	case <-time.After(10 * time.Millisecond):
+	}
+	server.Close()
+	server.Close() // closing twice is counted once
+	<-drained
+	if got, want := lis.ActiveConns(), 0; got != want {
+		t.Fatalf("ActiveConns: got %d, want %d", got, want)
+	}
+}
+
+func TestListenerDrainTimeout(t *testing.T) {
+	conns := newConnTracker()
+	l, err := listen(context.Background(), "localhost:0", runtime.ListenerConfig{}, conns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// Draining gives up on the open connection after the timeout.
+	conns.drain(10 * time.Millisecond)
+}
@@ -15,9 +15,15 @@
 package weaver
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/ServiceWeaver/weaver/internal/logtype"
 	"github.com/ServiceWeaver/weaver/runtime/logging"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"golang.org/x/exp/slog"
 )
 
 // Logger can be used to log messages at different levels (Debug, Info, Error).
@@ -133,3 +139,85 @@ func newAttrLogger(app, version, component, weavelet string, saver func(*protos.
 		},
 	}
 }
+
+var (
+	logHandlerMu sync.Mutex
+	logHandler   slog.Handler // see SetLogHandler
+)
+
+// SetLogHandler installs h as an additional destination for the log entries
+// of the components hosted in this process, including main. Log entries are
+// still sent to the deployer as well. This lets you ship logs directly to your
+// own logging pipeline, for example:
+//
+//	func main() {
+//	    weaver.SetLogHandler(slog.NewJSONHandler(os.Stdout))
+//	    root := weaver.Init(context.Background())
+//	    // ...
+//	}
+//
+// Every record passed to h contains the message, level, time, and attributes
+// of a log entry, along with a "serviceweaver" group of attributes that
+// identify its source: "app", "deployment", "component", "weavelet", and, if
+// known, "source" (the file and line of the logging call).
+//
+// SetLogHandler must be called before weaver.Init, since Init never returns in
+// a process that does not host the main component. Every process of an
+// application runs the same binary, so every process installs the handler. The
+// handler must be safe for concurrent use.
+func SetLogHandler(h slog.Handler) {
+	logHandlerMu.Lock()
+	defer logHandlerMu.Unlock()
+	logHandler = h
+}
+
+// withLogHandler returns a log saver that passes log entries to saver and to
+// the handler installed by SetLogHandler, if any.
+func withLogHandler(saver func(*protos.LogEntry)) func(*protos.LogEntry) {
+	logHandlerMu.Lock()
+	h := logHandler
+	logHandlerMu.Unlock()
+	if h == nil {
+		return saver
+	}
+	return func(entry *protos.LogEntry) {
+		saver(entry)
+		level := slogLevel(entry.Level)
+		if !h.Enabled(context.Background(), level) {
+			return
+		}
+		// There is nowhere to report a failure to log, so errors are dropped.
+		h.Handle(slogRecord(entry, level))
+	}
+}
+
+// slogLevel returns the slog level of the provided log entry level.
+func slogLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// slogRecord converts a log entry into a slog record.
+func slogRecord(entry *protos.LogEntry, level slog.Level) slog.Record {
+	r := slog.NewRecord(time.UnixMicro(entry.TimeMicros), level, entry.Msg, 0, nil)
+	for i := 0; i+1 < len(entry.Attrs); i += 2 {
+		r.AddAttrs(slog.String(entry.Attrs[i], entry.Attrs[i+1]))
+	}
+	attrs := []slog.Attr{
+		slog.String("app", entry.App),
+		slog.String("deployment", entry.Version),
+		slog.String("component", entry.Component),
+		slog.String("weavelet", entry.Node),
+	}
+	if entry.File != "" && entry.Line >= 0 {
+		attrs = append(attrs, slog.String("source", fmt.Sprintf("%s:%d", entry.File, entry.Line)))
+	}
+	r.AddAttrs(slog.Group("serviceweaver", attrs...))
+	return r
+}
@@ -15,6 +15,8 @@
 package weaver
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -24,6 +26,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"golang.org/x/exp/slog"
 )
 
 func TestWithAttribute(t *testing.T) {
@@ -110,3 +113,44 @@ func TestConcurrentAttributes(t *testing.T) {
 		lastVal[rIdx] = vIdx
 	}
 }
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogHandler(slog.HandlerOptions{Level: slog.LevelInfo}.NewJSONHandler(&buf))
+	defer SetLogHandler(nil)
+
+	var saved []*protos.LogEntry
+	logSaver := withLogHandler(func(e *protos.LogEntry) { saved = append(saved, e) })
+	logger := newAttrLogger("app", "version", "component", "weavelet", logSaver)
+	logger.Debug("filtered")
+	logger.Info("hello", "foo", "bar")
+
+	// Both entries are saved, but the handler only receives the info entry.
+	if got, want := len(saved), 2; got != want {
+		t.Fatalf("saved %d entries, want %d", got, want)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("bad handler output %q: %v", buf.String(), err)
+	}
+	delete(got, "time")
+	sw := got["serviceweaver"].(map[string]any)
+	if !strings.HasSuffix(sw["source"].(string), "logger_test.go:"+strconv.Itoa(int(saved[1].Line))) {
+		t.Errorf("bad source %q", sw["source"])
+	}
+	delete(sw, "source")
+	want := map[string]any{
+		"level": "INFO",
+		"msg":   "hello",
+		"foo":   "bar",
+		"serviceweaver": map[string]any{
+			"app":        "app",
+			"deployment": "version",
+			"component":  "component",
+			"weavelet":   "weavelet",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("handler output (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/metrics"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+type logLimitLabels struct {
+	Component string // full component name
+	Level     string // log level
+}
+
+var logDropped = metrics.NewCounterMap[logLimitLabels](
+	"serviceweaver_log_dropped_count",
+	"Count of log entries dropped by log sampling or rate limits",
+)
+
+// logLimiter drops the log entries of a component that exceed the component's
+// log policy. See runtime.LogPolicy for details.
+type logLimiter struct {
+	now    func() time.Time // time.Now usually, but injected fake in tests
+	rand   func() float64   // rand.Float64 usually, but injected fake in tests
+	levels map[string]*levelLimiter
+}
+
+// levelLimiter limits the log entries of a single level.
+type levelLimiter struct {
+	fraction float64          // fraction of entries kept; 1 if not sampled
+	rate     float64          // entries per second; 0 if not rate limited
+	burst    float64          // capacity of the token bucket
+	dropped  *metrics.Counter // see logDropped
+
+	mu     sync.Mutex
+	tokens float64   // token bucket holding up to burst tokens
+	last   time.Time // when tokens was last refilled
+}
+
+// limitLogs returns a log saver that passes the log entries that are allowed
+// by the policy to saver and drops the others.
+func limitLogs(component string, policy runtime.LogPolicy, saver func(*protos.LogEntry)) func(*protos.LogEntry) {
+	if !policy.Enabled() {
+		return saver
+	}
+	l := newLogLimiter(component, policy, time.Now, rand.Float64)
+	return func(entry *protos.LogEntry) {
+		if l.allow(entry.Level) {
+			saver(entry)
+		}
+	}
+}
+
+// newLogLimiter returns a new limiter for the log entries of the named
+// component.
+func newLogLimiter(component string, policy runtime.LogPolicy, now func() time.Time, rand func() float64) *logLimiter {
+	l := &logLimiter{now: now, rand: rand, levels: map[string]*levelLimiter{}}
+	get := func(level string) *levelLimiter {
+		if ll, ok := l.levels[level]; ok {
+			return ll
+		}
+		ll := &levelLimiter{
+			fraction: 1,
+			dropped:  logDropped.Get(logLimitLabels{Component: component, Level: level}),
+			last:     now(),
+		}
+		l.levels[level] = ll
+		return ll
+	}
+	for level, fraction := range policy.Sampling {
+		get(level).fraction = fraction
+	}
+	for level, rate := range policy.RateLimits {
+		ll := get(level)
+		ll.rate = rate
+		ll.burst = math.Max(rate, 1)
+		ll.tokens = ll.burst
+	}
+	return l
+}
+
+// allow returns whether a log entry of the provided level should be kept.
+func (l *logLimiter) allow(level string) bool {
+	ll, ok := l.levels[level]
+	if !ok {
+		return true
+	}
+	if ll.fraction < 1 && l.rand() >= ll.fraction {
+		ll.dropped.Add(1)
+		return false
+	}
+	if ll.rate == 0 {
+		return true
+	}
+
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	now := l.now()
+	ll.tokens += now.Sub(ll.last).Seconds() * ll.rate
+	if ll.tokens > ll.burst {
+		ll.tokens = ll.burst
+	}
+	ll.last = now
+	if ll.tokens < 1 {
+		ll.dropped.Add(1)
+		return false
+	}
+	ll.tokens--
+	return true
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// countAllowed returns the number of n log entries of the provided level that
+// l allows.
+func countAllowed(l *logLimiter, level string, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if l.allow(level) {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestLogRateLimit(t *testing.T) {
+	now := time.Now()
+	policy := runtime.LogPolicy{RateLimits: map[string]float64{"debug": 100}}
+	l := newLogLimiter(t.Name(), policy, func() time.Time { return now }, nil)
+
+	// The first second's worth of entries is let through, and then nothing.
+	if got, want := countAllowed(l, "debug", 1000), 100; got != want {
+		t.Fatalf("allowed %d debug entries, want %d", got, want)
+	}
+	// Other levels are not limited.
+	if got, want := countAllowed(l, "info", 1000), 1000; got != want {
+		t.Fatalf("allowed %d info entries, want %d", got, want)
+	}
+	// The limit refills over time.
+	now = now.Add(100 * time.Millisecond)
+	if got, want := countAllowed(l, "debug", 1000), 10; got != want {
+		t.Fatalf("allowed %d debug entries after 100ms, want %d", got, want)
+	}
+	// But never past one second's worth.
+	now = now.Add(time.Hour)
+	if got, want := countAllowed(l, "debug", 1000), 100; got != want {
+		t.Fatalf("allowed %d debug entries after an hour, want %d", got, want)
+	}
+}
+
+func TestLogSlowRateLimit(t *testing.T) {
+	now := time.Now()
+	policy := runtime.LogPolicy{RateLimits: map[string]float64{"error": 0.5}}
+	l := newLogLimiter(t.Name(), policy, func() time.Time { return now }, nil)
+	if got, want := countAllowed(l, "error", 10), 1; got != want {
+		t.Fatalf("allowed %d error entries, want %d", got, want)
+	}
+	now = now.Add(2 * time.Second)
+	if got, want := countAllowed(l, "error", 10), 1; got != want {
+		t.Fatalf("allowed %d error entries after 2s, want %d", got, want)
+	}
+}
+
+func TestLogSampling(t *testing.T) {
+	// A fake random number generator that cycles through 0, 0.1, ..., 0.9.
+	i := 0
+	rand := func() float64 {
+		i++
+		return float64(i%10) / 10
+	}
+	policy := runtime.LogPolicy{Sampling: map[string]float64{"info": 0.3}}
+	l := newLogLimiter(t.Name(), policy, time.Now, rand)
+	if got, want := countAllowed(l, "info", 1000), 300; got != want {
+		t.Fatalf("allowed %d info entries, want %d", got, want)
+	}
+}
+
+func TestLimitLogs(t *testing.T) {
+	var saved []string
+	saver := func(e *protos.LogEntry) { saved = append(saved, e.Msg) }
+	policy := runtime.LogPolicy{Sampling: map[string]float64{"debug": 0}}
+	logger := newAttrLogger("app", "version", t.Name(), "weavelet", limitLogs(t.Name(), policy, saver))
+	logger.Debug("dropped")
+	logger.Info("kept")
+	if len(saved) != 1 || saved[0] != "kept" {
+		t.Fatalf("saved %v, want [kept]", saved)
+	}
+}
@@ -14,6 +14,8 @@
 
 package metrics
 
+import "fmt"
+
 // NonNegativeBuckets provides rounded bucket boundaries for histograms
 // that will only store non-negative values.
 var NonNegativeBuckets = []float64{
@@ -39,3 +41,33 @@ var NonNegativeBuckets = []float64{
 	1000000000000000000, 2000000000000000000, 5000000000000000000,
 	10000000000000000000, 20000000000000000000, 50000000000000000000, // i.e., 5e19
 }
+
+// ExponentialBuckets returns n histogram bucket boundaries, starting at start
+// and growing by factor. For example, ExponentialBuckets(0.1, 2, 4) returns
+// [0.1, 0.2, 0.4, 0.8]. It panics if start is not positive, if factor is not
+// greater than 1, or if n is not positive.
+func ExponentialBuckets(start, factor float64, n int) []float64 {
+	if start <= 0 || factor <= 1 || n <= 0 {
+		panic(fmt.Errorf("invalid exponential buckets: start %v, factor %v, n %d", start, factor, n))
+	}
+	bounds := make([]float64, n)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+	return bounds
+}
+
+// LinearBuckets returns n histogram bucket boundaries, starting at start and
+// spaced width apart. For example, LinearBuckets(0, 5, 4) returns [0, 5, 10,
+// 15]. It panics if width or n is not positive.
+func LinearBuckets(start, width float64, n int) []float64 {
+	if width <= 0 || n <= 0 {
+		panic(fmt.Errorf("invalid linear buckets: width %v, n %d", width, n))
+	}
+	bounds := make([]float64, n)
+	for i := range bounds {
+		bounds[i] = start + float64(i)*width
+	}
+	return bounds
+}
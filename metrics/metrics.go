@@ -15,6 +15,8 @@
 package metrics
 
 import (
+	"context"
+
 	"github.com/ServiceWeaver/weaver/runtime/metrics"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
 )
@@ -196,6 +198,13 @@ func NewHistogram(name, help string, bounds []float64) *Histogram {
 	return &Histogram{impl: metrics.Register(protos.MetricType_HISTOGRAM, name, help, bounds)}
 }
 
+// NewHistogramWithUnit is like NewHistogram, but also records the unit of the
+// values put in the histogram (e.g., "ms", "s", or "By"). The unit is exported
+// alongside the histogram to monitoring systems that support units.
+func NewHistogramWithUnit(name, help, unit string, bounds []float64) *Histogram {
+	return &Histogram{impl: metrics.RegisterWithUnit(protos.MetricType_HISTOGRAM, name, help, unit, bounds)}
+}
+
 // Name returns the name of the histogram.
 func (h *Histogram) Name() string {
 	return h.impl.Name()
@@ -206,6 +215,15 @@ func (h *Histogram) Put(val float64) {
 	h.impl.Put(val)
 }
 
+// PutContext is like Put, but if ctx carries a sampled trace span, it also
+// records the value as an exemplar of its bucket, linked to the span. The
+// exemplars of a histogram are exported to the monitoring systems that
+// support them, which lets you go from a bucket of a histogram, like the
+// bucket of slow requests, to example traces.
+func (h *Histogram) PutContext(ctx context.Context, val float64) {
+	h.impl.PutContext(ctx, val)
+}
+
 // A HistogramMap is a collection of Histograms with the same name and label
 // schema but with different label values. See CounterMap for a description of
 // L.
@@ -220,6 +238,12 @@ func NewHistogramMap[L comparable](name, help string, bounds []float64) *Histogr
 	return &HistogramMap[L]{metrics.RegisterMap[L](protos.MetricType_HISTOGRAM, name, help, bounds)}
 }
 
+// NewHistogramMapWithUnit is like NewHistogramMap, but also records the unit
+// of the values put in the histograms. See NewHistogramWithUnit.
+func NewHistogramMapWithUnit[L comparable](name, help, unit string, bounds []float64) *HistogramMap[L] {
+	return &HistogramMap[L]{metrics.RegisterMapWithUnit[L](protos.MetricType_HISTOGRAM, name, help, unit, bounds)}
+}
+
 // Name returns the name of the HistogramMap.
 func (h *HistogramMap[L]) Name() string {
 	return h.impl.Name()
@@ -15,6 +15,7 @@
 package metrics_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -24,6 +25,7 @@ import (
 	"github.com/ServiceWeaver/weaver/metrics"
 	imetrics "github.com/ServiceWeaver/weaver/runtime/metrics"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func ExampleCounterMap() {
@@ -185,6 +187,59 @@ func TestHistogram(t *testing.T) {
 	})
 }
 
+func TestHistogramWithUnit(t *testing.T) {
+	bounds := metrics.ExponentialBuckets(0.1, 10, 3)
+	h := metrics.NewHistogramWithUnit(uuid.New().String(), "", "ms", bounds)
+	h.Put(0.5)
+	expect(t, &imetrics.MetricSnapshot{
+		Type:   protos.MetricType_HISTOGRAM,
+		Name:   h.Name(),
+		Unit:   "ms",
+		Value:  0.5,
+		Bounds: []float64{0.1, 1, 10},
+		Counts: []uint64{0, 1, 0, 0},
+	})
+}
+
+func TestHistogramPutContext(t *testing.T) {
+	h := metrics.NewHistogram(uuid.New().String(), "", []float64{1, 10})
+	h.PutContext(context.Background(), 0.5)
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	h.PutContext(trace.ContextWithSpanContext(context.Background(), sc), 5)
+
+	var got *imetrics.MetricSnapshot
+	for _, m := range imetrics.Snapshot() {
+		if m.Name == h.Name() {
+			got = m
+		}
+	}
+	if got == nil {
+		t.Fatalf("histogram %q not found", h.Name())
+	}
+	if diff := cmp.Diff([]uint64{1, 1, 0}, got.Counts); diff != "" {
+		t.Fatalf("counts (-want +got):\n%s", diff)
+	}
+	if len(got.Exemplars) != 3 || got.Exemplars[0] != nil || got.Exemplars[1] == nil {
+		t.Fatalf("exemplars: got %v, want one exemplar in bucket 1", got.Exemplars)
+	}
+	if e := got.Exemplars[1]; e.Value != 5 || e.TraceID != sc.TraceID() || e.SpanID != sc.SpanID() {
+		t.Fatalf("exemplar: got %+v, want value 5 of span %v", e, sc)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	if diff := cmp.Diff([]float64{0.1, 0.2, 0.4, 0.8}, metrics.ExponentialBuckets(0.1, 2, 4)); diff != "" {
+		t.Errorf("ExponentialBuckets (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]float64{0, 5, 10, 15}, metrics.LinearBuckets(0, 5, 4)); diff != "" {
+		t.Errorf("LinearBuckets (-want +got):\n%s", diff)
+	}
+}
+
 func TestHistogramMap(t *testing.T) {
 	name := uuid.New().String()
 	bounds := []float64{1, 10, 20}
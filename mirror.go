@@ -0,0 +1,99 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/metrics"
+)
+
+const (
+	// mirrorTimeout bounds the duration of a mirrored call to a method
+	// without a timeout.
+	mirrorTimeout = 10 * time.Second
+
+	// maxMirroredCalls bounds the number of concurrent mirrored calls to a
+	// component. Calls beyond the bound are not mirrored.
+	maxMirroredCalls = 100
+)
+
+type mirrorLabels struct {
+	Component string // full callee component name
+}
+
+var mirrorDrops = metrics.NewCounterMap[mirrorLabels](
+	"serviceweaver_mirror_dropped_count",
+	"Count of Service Weaver component method invocations not mirrored to a shadow deployment because too many mirrored calls were in flight",
+)
+
+// mirror mirrors a fraction of the calls to a component to the replicas of
+// the component in a shadow deployment, discarding the replies. See
+// runtime.MirrorPolicy for details.
+type mirror struct {
+	ctx      context.Context // bounds the mirrored calls
+	client   call.Connection // client to the shadow replicas
+	balancer call.Balancer   // if not nil, shadow component load balancer
+	fraction float64         // fraction of calls mirrored
+	inflight chan struct{}   // semaphore bounding concurrent mirrored calls
+	dropped  *metrics.Counter
+}
+
+// newMirror returns a new mirror for calls to the named component, or nil if
+// the fraction of mirrored calls is zero.
+func newMirror(ctx context.Context, name string, client call.Connection, balancer call.Balancer, fraction float64) *mirror {
+	if fraction == 0 {
+		return nil
+	}
+	return &mirror{
+		ctx:      ctx,
+		client:   client,
+		balancer: balancer,
+		fraction: fraction,
+		inflight: make(chan struct{}, maxMirroredCalls),
+		dropped:  mirrorDrops.Get(mirrorLabels{Component: name}),
+	}
+}
+
+// call mirrors a call to the provided method, if the call is picked to be
+// mirrored. The mirrored call runs asynchronously, for at most the provided
+// timeout if positive, and its reply is discarded.
+func (m *mirror) call(key call.MethodKey, args []byte, shardKey uint64, timeout time.Duration) {
+	if rand.Float64() >= m.fraction {
+		return
+	}
+	select {
+	case m.inflight <- struct{}{}:
+	default:
+		m.dropped.Add(1)
+		return
+	}
+	if timeout <= 0 {
+		timeout = mirrorTimeout
+	}
+	// The caller may reuse args once its call returns.
+	args = append([]byte(nil), args...)
+	opts := call.CallOptions{ShardKey: shardKey, Balancer: m.balancer}
+	go func() {
+		defer func() { <-m.inflight }()
+		ctx, cancel := context.WithTimeout(m.ctx, timeout)
+		defer cancel()
+		// The reply, or error, of a mirrored call is discarded.
+		m.client.Call(ctx, key, args, opts)
+	}()
+}
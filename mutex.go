@@ -0,0 +1,122 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMutexLease is the default lease of a Mutex.
+	defaultMutexLease = 10 * time.Second
+
+	// mutexRetry is how often a blocked Lock tries to acquire a Mutex that
+	// is held by another process.
+	mutexRetry = 100 * time.Millisecond
+)
+
+// MutexOptions configures a [Mutex].
+type MutexOptions struct {
+	// Lease is how long a holder keeps the lock without renewing its lease.
+	// The lease is renewed while the lock is held, so it only bounds how long
+	// a lock held by a crashed process stays locked. If zero, a default lease
+	// of 10 seconds is used.
+	Lease time.Duration
+}
+
+// A Mutex is a lock shared by all of the processes of a deployment. Mutexes
+// with the same name, in any component, are the same lock. For example:
+//
+//	func (i *inventory) Reserve(ctx context.Context, item string) error {
+//	    lock, err := i.Mutex("inventory/"+item, weaver.MutexOptions{}).Lock(ctx)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    defer lock.Unlock()
+//	    return i.store.Decrement(lock.Context(), item, lock.Token())
+//	}
+//
+// A Mutex is backed by a lease. If the holder of a lock fails to renew its
+// lease, for example because its process crashed or was partitioned, the lock
+// is released when the lease expires, and the context of the holder's
+// [MutexLease] is canceled. A stale holder may not notice right away, so
+// storage written under a lock should reject writes with a fencing token
+// lower than the largest token it has seen.
+type Mutex struct {
+	election *LeaderElection
+	sem      chan struct{} // serializes the holders in this process
+}
+
+// Mutex returns the Mutex with the provided name.
+func (c *componentImpl) Mutex(name string, opts MutexOptions) *Mutex {
+	lease := opts.Lease
+	if lease <= 0 {
+		lease = defaultMutexLease
+	}
+	// Mutexes and leader elections are backed by the same leases. The
+	// prefix keeps their names apart.
+	election := newLeaderElection(c.component.wlet, "mutex/"+name, lease, mutexRetry)
+	return &Mutex{election: election, sem: make(chan struct{}, 1)}
+}
+
+// Lock blocks until the lock is acquired, or until ctx is done. The lock is
+// held until Unlock is called on the returned lease, until ctx is done, or
+// until the lease can't be renewed, whichever happens first.
+func (m *Mutex) Lock(ctx context.Context) (*MutexLease, error) {
+	select {
+	case m.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	held, resign, err := m.election.Lead(ctx)
+	if err != nil {
+		<-m.sem
+		return nil, err
+	}
+	return &MutexLease{
+		ctx:   held,
+		token: m.election.fencingToken(),
+		unlock: func() {
+			resign()
+			<-m.sem
+		},
+	}, nil
+}
+
+// A MutexLease is a held lock. See [Mutex].
+type MutexLease struct {
+	ctx    context.Context
+	token  int64
+	once   sync.Once
+	unlock func()
+}
+
+// Context returns a context that is done when the lock is no longer held.
+func (l *MutexLease) Context() context.Context {
+	return l.ctx
+}
+
+// Token returns the fencing token of the lock. Tokens increase every time the
+// lock is acquired.
+func (l *MutexLease) Token() int64 {
+	return l.token
+}
+
+// Unlock releases the lock. It is safe to call Unlock more than once.
+func (l *MutexLease) Unlock() {
+	l.once.Do(l.unlock)
+}
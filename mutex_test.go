@@ -0,0 +1,82 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/election"
+)
+
+func TestMutex(t *testing.T) {
+	// Two processes increment a counter under the same lock.
+	ctx := context.Background()
+	e := &electionEnv{leases: election.NewLeases()}
+	mutexes := []*Mutex{
+		newElectionComponent(e).Mutex("counter", MutexOptions{}),
+		newElectionComponent(e).Mutex("counter", MutexOptions{}),
+	}
+
+	var counter int
+	var lastToken int64
+	var wg sync.WaitGroup
+	for _, m := range mutexes {
+		for i := 0; i < 3; i++ {
+			m := m
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				lock, err := m.Lock(ctx)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer lock.Unlock()
+				if lock.Token() <= lastToken {
+					t.Errorf("got token %d, want > %d", lock.Token(), lastToken)
+				}
+				lastToken = lock.Token()
+				c := counter
+				time.Sleep(10 * time.Millisecond)
+				counter = c + 1
+			}()
+		}
+	}
+	wg.Wait()
+	if counter != 6 {
+		t.Fatalf("got counter %d, want 6", counter)
+	}
+}
+
+func TestMutexLockCanceled(t *testing.T) {
+	ctx := context.Background()
+	e := &electionEnv{leases: election.NewLeases()}
+	a := newElectionComponent(e).Mutex("m", MutexOptions{})
+	b := newElectionComponent(e).Mutex("m", MutexOptions{})
+	lock, err := a.Lock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+
+	short, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	if _, err := b.Lock(short); err == nil {
+		t.Fatal("unexpected success locking a held mutex")
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// defaultOTLPInterval is the interval between two exports of metrics to an
+// OpenTelemetry collector if the config doesn't specify one.
+const defaultOTLPInterval = 15 * time.Second
+
+// exportOTLPMetrics periodically exports the metrics of the weavelet to an
+// OpenTelemetry collector, as configured by the [serviceweaver.otlp] section of
+// the app config. It returns when the weavelet's context is cancelled.
+func (d *weavelet) exportOTLPMetrics() error {
+	config := d.config.OTLP
+	interval := config.Interval
+	if interval == 0 {
+		interval = defaultOTLPInterval
+	}
+	start := time.Now()
+	client := &http.Client{Timeout: interval}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		snapshots := metrics.Snapshot()
+		if len(snapshots) == 0 {
+			continue
+		}
+		req := otlpMetrics(d.resource, snapshots, start, time.Now())
+		if err := postOTLP(d.ctx, client, config.MetricsURL(), config.Headers, req); err != nil {
+			// Keep exporting; the collector may come back.
+			d.env.SystemLogger().Error("export metrics", err, "endpoint", config.Endpoint)
+		}
+	}
+}
+
+// postOTLP posts the provided export request to the provided URL, using the
+// JSON encoding of OTLP over HTTP.
+func postOTLP(ctx context.Context, client *http.Client, url string, headers map[string]string, req *otlpExportRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		httpReq.Header.Set(key, value)
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+// The following types hold the JSON encoding of an OTLP metrics export
+// request [1]. Only the fields that Service Weaver uses are present.
+//
+// [1]: https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/collector/metrics/v1/metrics_service.proto
+type (
+	otlpExportRequest struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+		SchemaURL    string             `json:"schemaUrl,omitempty"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+
+	otlpScopeMetrics struct {
+		Scope   otlpScope    `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+
+	otlpMetric struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description,omitempty"`
+		Unit        string         `json:"unit,omitempty"`
+		Sum         *otlpSum       `json:"sum,omitempty"`
+		Gauge       *otlpGauge     `json:"gauge,omitempty"`
+		Histogram   *otlpHistogram `json:"histogram,omitempty"`
+	}
+
+	otlpSum struct {
+		DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+		AggregationTemporality int                   `json:"aggregationTemporality"`
+		IsMonotonic            bool                  `json:"isMonotonic"`
+	}
+
+	otlpGauge struct {
+		DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+	}
+
+	otlpHistogram struct {
+		DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+		AggregationTemporality int                      `json:"aggregationTemporality"`
+	}
+
+	otlpNumberDataPoint struct {
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		TimeUnixNano      string         `json:"timeUnixNano"`
+		AsDouble          float64        `json:"asDouble"`
+	}
+
+	otlpHistogramDataPoint struct {
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		TimeUnixNano      string         `json:"timeUnixNano"`
+		Count             string         `json:"count"`
+		Sum               float64        `json:"sum"`
+		BucketCounts      []string       `json:"bucketCounts"`
+		ExplicitBounds    []float64      `json:"explicitBounds"`
+		Exemplars         []otlpExemplar `json:"exemplars,omitempty"`
+	}
+
+	otlpExemplar struct {
+		TimeUnixNano string  `json:"timeUnixNano"`
+		AsDouble     float64 `json:"asDouble"`
+		TraceID      string  `json:"traceId"` // hex-encoded
+		SpanID       string  `json:"spanId"`  // hex-encoded
+	}
+
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+
+	otlpAnyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// otlpCumulative is the AGGREGATION_TEMPORALITY_CUMULATIVE OTLP enum value.
+// Service Weaver metrics are never reset, so all of them are cumulative.
+const otlpCumulative = 2
+
+// otlpMetrics returns an OTLP export request that holds the provided metric
+// snapshots, taken at time now, attributed to the provided resource. start is
+// the time at which the metrics started being collected.
+func otlpMetrics(res *resource.Resource, snapshots []*metrics.MetricSnapshot, start, now time.Time) *otlpExportRequest {
+	startNanos := strconv.FormatInt(start.UnixNano(), 10)
+	nowNanos := strconv.FormatInt(now.UnixNano(), 10)
+
+	// Group the snapshots by metric name. Snapshots with the same name only
+	// differ in their labels.
+	var names []string
+	byName := map[string]*otlpMetric{}
+	for _, s := range snapshots {
+		m, ok := byName[s.Name]
+		if !ok {
+			m = &otlpMetric{Name: s.Name, Description: s.Help, Unit: s.Unit}
+			switch s.Type {
+			case protos.MetricType_COUNTER:
+				m.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+			case protos.MetricType_GAUGE:
+				m.Gauge = &otlpGauge{}
+			case protos.MetricType_HISTOGRAM:
+				m.Histogram = &otlpHistogram{AggregationTemporality: otlpCumulative}
+			default:
+				continue
+			}
+			byName[s.Name] = m
+			names = append(names, s.Name)
+		}
+
+		var attrs []otlpKeyValue
+		for _, key := range sortedKeys(s.Labels) {
+			attrs = append(attrs, otlpString(key, s.Labels[key]))
+		}
+		switch {
+		case m.Sum != nil:
+			m.Sum.DataPoints = append(m.Sum.DataPoints, otlpNumberDataPoint{attrs, startNanos, nowNanos, s.Value})
+		case m.Gauge != nil:
+			m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpNumberDataPoint{attrs, startNanos, nowNanos, s.Value})
+		case m.Histogram != nil:
+			var count uint64
+			counts := make([]string, len(s.Counts))
+			for i, c := range s.Counts {
+				count += c
+				counts[i] = strconv.FormatUint(c, 10)
+			}
+			m.Histogram.DataPoints = append(m.Histogram.DataPoints, otlpHistogramDataPoint{
+				Attributes:        attrs,
+				StartTimeUnixNano: startNanos,
+				TimeUnixNano:      nowNanos,
+				Count:             strconv.FormatUint(count, 10),
+				Sum:               s.Value,
+				BucketCounts:      counts,
+				ExplicitBounds:    s.Bounds,
+				Exemplars:         otlpExemplars(s.Exemplars),
+			})
+		}
+	}
+	sort.Strings(names)
+	ms := make([]otlpMetric, 0, len(names))
+	for _, name := range names {
+		ms = append(ms, *byName[name])
+	}
+
+	var attrs []otlpKeyValue
+	for _, kv := range res.Attributes() {
+		attrs = append(attrs, otlpAttribute(kv))
+	}
+	return &otlpExportRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{Attributes: attrs},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: instrumentationLibrary, Version: instrumentationVersion},
+				Metrics: ms,
+			}},
+			SchemaURL: res.SchemaURL(),
+		}},
+	}
+}
+
+// otlpString returns an OTLP attribute with a string value.
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+// otlpAttribute converts an OpenTelemetry attribute to an OTLP attribute.
+func otlpAttribute(kv attribute.KeyValue) otlpKeyValue {
+	key := string(kv.Key)
+	switch kv.Value.Type() {
+	case attribute.BOOL:
+		b := kv.Value.AsBool()
+		return otlpKeyValue{Key: key, Value: otlpAnyValue{BoolValue: &b}}
+	case attribute.INT64:
+		i := strconv.FormatInt(kv.Value.AsInt64(), 10)
+		return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: &i}}
+	case attribute.FLOAT64:
+		f := kv.Value.AsFloat64()
+		return otlpKeyValue{Key: key, Value: otlpAnyValue{DoubleValue: &f}}
+	default:
+		return otlpString(key, kv.Value.Emit())
+	}
+}
+
+// sortedKeys returns the keys of the provided map, in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// otlpExemplars returns the OTLP representation of the provided histogram
+// exemplars, skipping buckets without one.
+func otlpExemplars(exemplars []*metrics.Exemplar) []otlpExemplar {
+	var result []otlpExemplar
+	for _, e := range exemplars {
+		if e == nil {
+			continue
+		}
+		result = append(result, otlpExemplar{
+			TimeUnixNano: strconv.FormatInt(e.Time.UnixNano(), 10),
+			AsDouble:     e.Value,
+			TraceID:      hex.EncodeToString(e.TraceID[:]),
+			SpanID:       hex.EncodeToString(e.SpanID[:]),
+		})
+	}
+	return result
+}
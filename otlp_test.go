@@ -0,0 +1,142 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+func TestOTLPMetrics(t *testing.T) {
+	// Run a fake collector.
+	requests := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Authorization") != "secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests <- body
+	}))
+	defer collector.Close()
+
+	res := resource.NewSchemaless(attribute.String("serviceweaver.app", "app"), attribute.Int("process.pid", 42))
+	snapshots := []*metrics.MetricSnapshot{
+		{Type: protos.MetricType_COUNTER, Name: "calls", Labels: map[string]string{"method": "A"}, Value: 3},
+		{Type: protos.MetricType_COUNTER, Name: "calls", Labels: map[string]string{"method": "B"}, Value: 4},
+		{Type: protos.MetricType_GAUGE, Name: "temperature", Value: 21.5},
+		{
+			Type:   protos.MetricType_HISTOGRAM,
+			Name:   "latency",
+			Value:  17,
+			Bounds: []float64{10},
+			Counts: []uint64{1, 1},
+			Exemplars: []*metrics.Exemplar{
+				nil,
+				{Value: 12, Time: time.Unix(1, 5), TraceID: [16]byte{0xab}, SpanID: [8]byte{0xcd}},
+			},
+		},
+	}
+	start, now := time.Unix(1, 0), time.Unix(2, 0)
+	req := otlpMetrics(res, snapshots, start, now)
+	url := collector.URL + "/v1/metrics"
+	headers := map[string]string{"Authorization": "secret"}
+	if err := postOTLP(context.Background(), http.DefaultClient, url, headers, req); err != nil {
+		t.Fatal(err)
+	}
+
+	type dataPoint struct {
+		Attributes     []map[string]any
+		TimeUnixNano   string
+		AsDouble       float64
+		Count          string
+		BucketCounts   []string
+		ExplicitBounds []float64
+		Exemplars      []map[string]any
+	}
+	type points struct {
+		DataPoints             []dataPoint
+		AggregationTemporality int
+		IsMonotonic            bool
+	}
+	var got struct {
+		ResourceMetrics []struct {
+			Resource struct {
+				Attributes []map[string]any
+			}
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Name      string
+					Sum       *points
+					Gauge     *points
+					Histogram *points
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(<-requests, &got); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(got.ResourceMetrics); n != 1 {
+		t.Fatalf("got %d resource metrics, want 1", n)
+	}
+	rm := got.ResourceMetrics[0]
+	wantAttrs := []map[string]any{
+		{"key": "process.pid", "value": map[string]any{"intValue": "42"}},
+		{"key": "serviceweaver.app", "value": map[string]any{"stringValue": "app"}},
+	}
+	if diff := cmp.Diff(wantAttrs, rm.Resource.Attributes); diff != "" {
+		t.Errorf("resource attributes (-want +got):\n%s", diff)
+	}
+
+	ms := rm.ScopeMetrics[0].Metrics
+	if len(ms) != 3 || ms[0].Name != "calls" || ms[1].Name != "latency" || ms[2].Name != "temperature" {
+		t.Fatalf("got metrics %+v, want calls, latency, and temperature", ms)
+	}
+	if sum := ms[0].Sum; sum == nil || !sum.IsMonotonic || sum.AggregationTemporality != otlpCumulative || len(sum.DataPoints) != 2 {
+		t.Errorf("calls: got %+v, want a cumulative sum with two data points", sum)
+	} else if p := sum.DataPoints[1]; p.AsDouble != 4 || p.TimeUnixNano != "2000000000" {
+		t.Errorf("calls: got data point %+v, want value 4 at 2s", p)
+	}
+	if h := ms[1].Histogram; h == nil || len(h.DataPoints) != 1 {
+		t.Errorf("latency: got %+v, want a histogram with one data point", h)
+	} else if p := h.DataPoints[0]; p.Count != "2" || !cmp.Equal(p.BucketCounts, []string{"1", "1"}) || !cmp.Equal(p.ExplicitBounds, []float64{10}) {
+		t.Errorf("latency: got data point %+v", p)
+	} else {
+		want := []map[string]any{{
+			"timeUnixNano": "1000000005",
+			"asDouble":     12.0,
+			"traceId":      "ab000000000000000000000000000000",
+			"spanId":       "cd00000000000000",
+		}}
+		if diff := cmp.Diff(want, p.Exemplars); diff != "" {
+			t.Errorf("latency: exemplars (-want +got):\n%s", diff)
+		}
+	}
+	if g := ms[2].Gauge; g == nil || len(g.DataPoints) != 1 || g.DataPoints[0].AsDouble != 21.5 {
+		t.Errorf("temperature: got %+v, want a gauge with value 21.5", g)
+	}
+}
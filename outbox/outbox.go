@@ -0,0 +1,201 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package outbox implements the transactional outbox pattern for components
+// that store their state in a SQL database.
+//
+// A component writes a message to the outbox in the same transaction as the
+// state change that the message announces, so that the message is written if
+// and only if the state change is committed:
+//
+//	tx, err := db.BeginTx(ctx, nil)
+//	...
+//	if _, err := tx.ExecContext(ctx, "UPDATE orders SET status='paid' WHERE id=?", id); err != nil {
+//		return err
+//	}
+//	if err := outbox.Write(ctx, tx, box, paid, OrderPaid{ID: id}); err != nil {
+//		return err
+//	}
+//	return tx.Commit()
+//
+// A relay, typically started in the component's Init, publishes the messages
+// written to the outbox to their pubsub topics, and deletes them once
+// published:
+//
+//	go box.Relay(ctx, db, broker, c.LeaderElection("outbox", weaver.LeaderElectionOptions{}))
+//
+// Every replica of the component runs the relay, but only the leader of the
+// election relays messages. Messages are published in the order they were
+// written, at least once: a message may be published again if the relay fails
+// after publishing it and before deleting it.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/pubsub"
+)
+
+const (
+	// relayBatchSize is the maximum number of messages read at once by the
+	// relay.
+	relayBatchSize = 64
+
+	// pollInterval is how long the relay waits before reading the outbox
+	// again, after the outbox was empty or relaying failed.
+	pollInterval = 100 * time.Millisecond
+)
+
+// Options configures an Outbox.
+type Options struct {
+	// Table is the name of the outbox table. If empty, defaults to
+	// "weaver_outbox".
+	Table string
+
+	// Dialect is the SQL dialect of the database: "mysql", "postgres", or
+	// "sqlite".
+	Dialect string
+}
+
+// An Outbox is a table of messages waiting to be published. See the package
+// documentation.
+type Outbox struct {
+	table   string
+	dialect string
+}
+
+// identifier matches valid table names.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// New returns an outbox with the provided options.
+func New(opts Options) (*Outbox, error) {
+	table := opts.Table
+	if table == "" {
+		table = "weaver_outbox"
+	}
+	if !identifier.MatchString(table) {
+		return nil, fmt.Errorf("outbox: invalid table name %q", table)
+	}
+	switch opts.Dialect {
+	case "mysql", "postgres", "sqlite":
+	default:
+		return nil, fmt.Errorf("outbox: unknown dialect %q", opts.Dialect)
+	}
+	return &Outbox{table: table, dialect: opts.Dialect}, nil
+}
+
+// CreateTable creates the outbox table, if it doesn't exist.
+func (o *Outbox) CreateTable(ctx context.Context, db *sql.DB) error {
+	var columns string
+	switch o.dialect {
+	case "mysql":
+		columns = "id BIGINT AUTO_INCREMENT PRIMARY KEY, topic VARCHAR(255) NOT NULL, payload LONGBLOB NOT NULL"
+	case "postgres":
+		columns = "id BIGSERIAL PRIMARY KEY, topic TEXT NOT NULL, payload BYTEA NOT NULL"
+	case "sqlite":
+		columns = "id INTEGER PRIMARY KEY AUTOINCREMENT, topic TEXT NOT NULL, payload BLOB NOT NULL"
+	}
+	_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", o.table, columns))
+	return err
+}
+
+// placeholder returns the placeholder of the i-th (1-based) query argument.
+func (o *Outbox) placeholder(i int) string {
+	if o.dialect == "postgres" {
+		return fmt.Sprintf("$%d", i)
+	}
+	return "?"
+}
+
+// Write writes msg to the outbox as part of tx. Once tx is committed, msg is
+// published to topic by the relay. Like Topic.Publish, msg is encoded as
+// JSON.
+func Write[T any](ctx context.Context, tx *sql.Tx, o *Outbox, topic pubsub.Topic[T], msg T) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	q := fmt.Sprintf("INSERT INTO %s (topic, payload) VALUES (%s, %s)", o.table, o.placeholder(1), o.placeholder(2))
+	_, err = tx.ExecContext(ctx, q, topic.Name(), data)
+	return err
+}
+
+// Relay publishes the messages in the outbox to broker, whenever it is the
+// leader of election, until ctx is canceled. It returns ctx.Err() when ctx is
+// canceled. Errors returned by the database or the broker are retried.
+func (o *Outbox) Relay(ctx context.Context, db *sql.DB, broker pubsub.Broker, election *weaver.LeaderElection) error {
+	for {
+		leading, resign, err := election.Lead(ctx)
+		if err != nil {
+			return err
+		}
+		for leading.Err() == nil {
+			n, err := o.relay(leading, db, broker)
+			if err == nil && n == relayBatchSize {
+				continue
+			}
+			select {
+			case <-leading.Done():
+			case <-time.After(pollInterval):
+			}
+		}
+		resign()
+	}
+}
+
+// relay publishes a batch of messages, oldest first, and returns the number
+// of published messages.
+func (o *Outbox) relay(ctx context.Context, db *sql.DB, broker pubsub.Broker) (int, error) {
+	q := fmt.Sprintf("SELECT id, topic, payload FROM %s ORDER BY id LIMIT %d", o.table, relayBatchSize)
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	type message struct {
+		id      int64
+		topic   string
+		payload []byte
+	}
+	var msgs []message
+	for rows.Next() {
+		var m message
+		if err := rows.Scan(&m.id, &m.topic, &m.payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		msgs = append(msgs, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	del := fmt.Sprintf("DELETE FROM %s WHERE id = %s", o.table, o.placeholder(1))
+	for i, m := range msgs {
+		// Stop at the first failure, to preserve the order of messages.
+		if err := broker.Publish(ctx, m.topic, m.payload); err != nil {
+			return i, err
+		}
+		if _, err := db.ExecContext(ctx, del, m.id); err != nil {
+			return i, err
+		}
+	}
+	return len(msgs), nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/pubsub"
+	"github.com/ServiceWeaver/weaver/weavertest"
+	_ "modernc.org/sqlite"
+)
+
+func TestRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: true})
+	broker, err := weaver.Get[pubsub.Broker](root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	box, err := New(Options{Dialect: "sqlite"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := box.CreateTable(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the subscription before writing.
+	topic := pubsub.NewTopic[string](broker, "events")
+	if _, err := broker.Pull(ctx, topic.Name(), "sub", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write messages in a committed and in a rolled back transaction.
+	write := func(msg string, commit bool) {
+		t.Helper()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Write(ctx, tx, box, topic, msg); err != nil {
+			t.Fatal(err)
+		}
+		if commit {
+			err = tx.Commit()
+		} else {
+			err = tx.Rollback()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("committed", true)
+	write("rolled back", false)
+	write("committed again", true)
+
+	go box.Relay(ctx, db, broker, root.LeaderElection("outbox", weaver.LeaderElectionOptions{}))
+
+	var got []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(got) < 2 && time.Now().Before(deadline) {
+		msgs, err := broker.Pull(ctx, topic.Name(), "sub", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range msgs {
+			got = append(got, string(m.Data))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	want := []string{`"committed"`, `"committed again"`}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// Published messages are deleted from the outbox.
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		var n int
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM weaver_outbox").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d messages in the outbox, want 0", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
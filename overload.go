@@ -0,0 +1,117 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ServiceWeaver/weaver/metrics"
+	"github.com/ServiceWeaver/weaver/runtime"
+)
+
+type overloadLabels struct {
+	Component string // full component name
+}
+
+var (
+	inFlightCalls = metrics.NewGaugeMap[overloadLabels](
+		"serviceweaver_component_in_flight_calls",
+		"Number of calls from other processes being executed by a replica of a Service Weaver component",
+	)
+	queuedCalls = metrics.NewGaugeMap[overloadLabels](
+		"serviceweaver_component_queued_calls",
+		"Number of calls from other processes waiting to be executed by a replica of a Service Weaver component",
+	)
+	overloadedCalls = metrics.NewCounterMap[overloadLabels](
+		"serviceweaver_component_overloaded_count",
+		"Count of calls to a Service Weaver component rejected because the replica was overloaded",
+	)
+)
+
+// concurrencyLimiter caps the number of calls that a replica of a component
+// executes concurrently. See runtime.ConcurrencyPolicy for details.
+type concurrencyLimiter struct {
+	name       string // full component name
+	maxQueued  int
+	slots      chan struct{} // holds a token for every call in flight
+	inFlight   *metrics.Gauge
+	queued     *metrics.Gauge
+	overloaded *metrics.Counter
+
+	mu      sync.Mutex
+	waiting int // number of queued calls
+}
+
+// newConcurrencyLimiter returns a concurrencyLimiter for the calls to the named
+// component, or nil if the policy doesn't limit them.
+func newConcurrencyLimiter(name string, policy runtime.ConcurrencyPolicy) *concurrencyLimiter {
+	if policy.MaxInFlight == 0 {
+		return nil
+	}
+	labels := overloadLabels{Component: name}
+	return &concurrencyLimiter{
+		name:       name,
+		maxQueued:  policy.MaxQueued,
+		slots:      make(chan struct{}, policy.MaxInFlight),
+		inFlight:   inFlightCalls.Get(labels),
+		queued:     queuedCalls.Get(labels),
+		overloaded: overloadedCalls.Get(labels),
+	}
+}
+
+// acquire waits until a call may be executed, in which case it returns nil
+// and the caller must call release when the call finishes. It returns an error
+// that wraps ErrOverloaded if too many calls are already waiting, or the
+// context's error if ctx is done first.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		l.inFlight.Add(1)
+		return nil
+	default:
+	}
+
+	l.mu.Lock()
+	if l.waiting >= l.maxQueued {
+		l.mu.Unlock()
+		l.overloaded.Add(1)
+		return fmt.Errorf("%w: component %q is executing %d calls", ErrOverloaded, l.name, cap(l.slots))
+	}
+	l.waiting++
+	l.queued.Set(float64(l.waiting))
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.queued.Set(float64(l.waiting))
+		l.mu.Unlock()
+	}()
+	select {
+	case l.slots <- struct{}{}:
+		l.inFlight.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release releases the slot of a call that finished.
+func (l *concurrencyLimiter) release() {
+	l.inFlight.Sub(1)
+	<-l.slots
+}
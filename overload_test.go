@@ -0,0 +1,95 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+)
+
+func TestConcurrencyLimiterDisabled(t *testing.T) {
+	if l := newConcurrencyLimiter(t.Name(), runtime.ConcurrencyPolicy{}); l != nil {
+		t.Fatalf("newConcurrencyLimiter: got %v, want nil", l)
+	}
+}
+
+func TestConcurrencyLimiterRejects(t *testing.T) {
+	ctx := context.Background()
+	l := newConcurrencyLimiter(t.Name(), runtime.ConcurrencyPolicy{MaxInFlight: 2})
+	for i := 0; i < 2; i++ {
+		if err := l.acquire(ctx); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+	if err := l.acquire(ctx); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("acquire: got %v, want ErrOverloaded", err)
+	}
+
+	// Once a call finishes, another one may run.
+	l.release()
+	if err := l.acquire(ctx); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+}
+
+func TestConcurrencyLimiterQueues(t *testing.T) {
+	ctx := context.Background()
+	l := newConcurrencyLimiter(t.Name(), runtime.ConcurrencyPolicy{MaxInFlight: 1, MaxQueued: 1})
+	if err := l.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second call waits for the first one to finish.
+	acquired := make(chan error, 1)
+	go func() { acquired <- l.acquire(ctx) }()
+	for {
+		l.mu.Lock()
+		waiting := l.waiting
+		l.mu.Unlock()
+		if waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The third call doesn't fit in the queue.
+	if err := l.acquire(ctx); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("acquire: got %v, want ErrOverloaded", err)
+	}
+
+	l.release()
+	if err := <-acquired; err != nil {
+		t.Fatalf("queued acquire: %v", err)
+	}
+}
+
+func TestConcurrencyLimiterCanceled(t *testing.T) {
+	l := newConcurrencyLimiter(t.Name(), runtime.ConcurrencyPolicy{MaxInFlight: 1, MaxQueued: 1})
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire: got %v, want context.DeadlineExceeded", err)
+	}
+	if l.waiting != 0 {
+		t.Fatalf("waiting: got %d, want 0", l.waiting)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/envelope/conn"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+const (
+	// defaultProfilingInterval is the interval between two rounds of
+	// profiles if the config doesn't specify one.
+	defaultProfilingInterval = time.Minute
+
+	// defaultCPUProfileDuration is the duration of CPU profiles if the
+	// config doesn't specify one.
+	defaultCPUProfileDuration = 10 * time.Second
+
+	// defaultCloudProfilerEndpoint is the endpoint of Google Cloud Profiler.
+	defaultCloudProfilerEndpoint = "https://cloudprofiler.googleapis.com"
+)
+
+// capturedProfile is a pprof profile captured by a weavelet.
+type capturedProfile struct {
+	typ   protos.ProfileType
+	data  []byte // pprof-encoded profile
+	start time.Time
+	end   time.Time
+}
+
+// profileUploader uploads profiles to a profiling backend.
+type profileUploader struct {
+	config   runtime.ProfilingConfig
+	client   *http.Client
+	app      string            // application name
+	tags     map[string]string // tags attached to every profile
+	duration time.Duration     // duration of CPU profiles
+	tokens   metadataTokens    // access tokens for Google Cloud Profiler
+}
+
+// runProfiling periodically profiles the weavelet's process and uploads the
+// profiles to the backend configured by the [serviceweaver.profiling] section
+// of the app config. It returns when the weavelet's context is cancelled.
+func (d *weavelet) runProfiling() error {
+	config := d.config.Profiling
+	interval := config.Interval
+	if interval == 0 {
+		interval = defaultProfilingInterval
+	}
+	duration := config.Duration
+	if duration == 0 {
+		duration = defaultCPUProfileDuration
+	}
+	u := &profileUploader{
+		config:   config,
+		client:   &http.Client{Timeout: interval},
+		app:      d.info.App,
+		duration: duration,
+		tags: map[string]string{
+			"deployment": d.info.DeploymentId,
+			"group":      d.info.Group.Name,
+			"weavelet":   d.info.Id,
+		},
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		for _, typ := range config.ProfileTypes() {
+			p, err := u.capture(typ)
+			if err != nil {
+				// A CPU profile fails if one is already being captured,
+				// e.g., by "weaver multi profile". Try again next round.
+				d.env.SystemLogger().Error("capture profile", err, "type", typ)
+				continue
+			}
+			if err := u.upload(d.ctx, p); err != nil {
+				// Keep profiling; the backend may come back.
+				d.env.SystemLogger().Error("upload profile", err, "type", typ, "backend", config.Backend)
+			}
+		}
+	}
+}
+
+// capture captures a profile of the provided type.
+func (u *profileUploader) capture(typ protos.ProfileType) (*capturedProfile, error) {
+	start := time.Now()
+	data, err := conn.Profile(&protos.RunProfiling{
+		ProfileType:   typ,
+		CpuDurationNs: u.duration.Nanoseconds(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &capturedProfile{typ: typ, data: data, start: start, end: time.Now()}, nil
+}
+
+// upload uploads the provided profile to the configured backend.
+func (u *profileUploader) upload(ctx context.Context, p *capturedProfile) error {
+	switch u.config.Backend {
+	case runtime.PyroscopeBackend:
+		return u.uploadPyroscope(ctx, p)
+	case runtime.CloudProfilerBackend:
+		return u.uploadCloudProfiler(ctx, p)
+	default:
+		return fmt.Errorf("unknown profiling backend %q", u.config.Backend)
+	}
+}
+
+// uploadPyroscope uploads the provided profile to a Pyroscope server, using
+// its HTTP ingestion API [1].
+//
+// [1]: https://grafana.com/docs/pyroscope/latest/configure-server/about-server-api/
+func (u *profileUploader) uploadPyroscope(ctx context.Context, p *capturedProfile) error {
+	// The name of a profile is the application name, followed by its tags,
+	// e.g., "collatz{deployment=1234,group=main,weavelet=5678}".
+	var tags []string
+	for _, key := range sortedKeys(u.tags) {
+		tags = append(tags, key+"="+u.tags[key])
+	}
+	query := url.Values{}
+	query.Set("name", fmt.Sprintf("%s{%s}", u.app, strings.Join(tags, ",")))
+	query.Set("from", strconv.FormatInt(p.start.Unix(), 10))
+	query.Set("until", strconv.FormatInt(p.end.Unix(), 10))
+	query.Set("format", "pprof")
+	query.Set("spyName", "gospy")
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("profile", "profile.pprof")
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(p.data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	ingestURL := strings.TrimSuffix(u.config.Endpoint, "/") + "/ingest?" + query.Encode()
+	return u.post(ctx, ingestURL, w.FormDataContentType(), &body, u.config.Headers)
+}
+
+// cloudProfile is the JSON encoding of a Google Cloud Profiler profile [1].
+// Only the fields that Service Weaver uses are present.
+//
+// [1]: https://cloud.google.com/profiler/docs/reference/v2/rest/v2/projects.profiles
+type cloudProfile struct {
+	ProfileType  string            `json:"profileType"`
+	Deployment   cloudDeployment   `json:"deployment"`
+	Duration     string            `json:"duration,omitempty"`
+	ProfileBytes []byte            `json:"profileBytes"` // base64-encoded by encoding/json
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+type cloudDeployment struct {
+	ProjectID string            `json:"projectId"`
+	Target    string            `json:"target"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// cloudProfileTypes maps profile types to Google Cloud Profiler profile types.
+var cloudProfileTypes = map[protos.ProfileType]string{
+	protos.ProfileType_CPU:       "CPU",
+	protos.ProfileType_Heap:      "HEAP",
+	protos.ProfileType_Goroutine: "THREADS",
+}
+
+// uploadCloudProfiler uploads the provided profile to Google Cloud Profiler.
+// The deployment id is used as the version of the profiled deployment, so
+// that profiles can be filtered by deployment in the Cloud Profiler UI.
+func (u *profileUploader) uploadCloudProfiler(ctx context.Context, p *capturedProfile) error {
+	typ, ok := cloudProfileTypes[p.typ]
+	if !ok {
+		return fmt.Errorf("profile type %v not supported by Google Cloud Profiler", p.typ)
+	}
+	profile := cloudProfile{
+		ProfileType: typ,
+		Deployment: cloudDeployment{
+			ProjectID: u.config.Project,
+			Target:    strings.ToLower(u.app),
+			Labels: map[string]string{
+				"language": "go",
+				"version":  u.tags["deployment"],
+			},
+		},
+		ProfileBytes: p.data,
+		Labels:       u.tags,
+	}
+	if p.typ == protos.ProfileType_CPU {
+		profile.Duration = fmt.Sprintf("%gs", p.end.Sub(p.start).Seconds())
+	}
+	body, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+
+	// Authenticate with an access token from the metadata server, unless
+	// the config provides credentials of its own.
+	headers := map[string]string{}
+	for key, value := range u.config.Headers {
+		headers[key] = value
+	}
+	if _, ok := headers["Authorization"]; !ok {
+		token, err := u.tokens.get(ctx, u.client)
+		if err != nil {
+			return fmt.Errorf("get access token: %w", err)
+		}
+		headers["Authorization"] = "Bearer " + token
+	}
+
+	endpoint := u.config.Endpoint
+	if endpoint == "" {
+		endpoint = defaultCloudProfilerEndpoint
+	}
+	profilesURL := fmt.Sprintf("%s/v2/projects/%s/profiles:createOffline", strings.TrimSuffix(endpoint, "/"), url.PathEscape(u.config.Project))
+	return u.post(ctx, profilesURL, "application/json", bytes.NewReader(body), headers)
+}
+
+// post posts the provided body to the provided URL.
+func (u *profileUploader) post(ctx context.Context, url, contentType string, body io.Reader, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/pprof/profile"
+)
+
+// newTestUploader returns a profile uploader for the provided backend and
+// endpoint, as configured by a weavelet of app "collatz".
+func newTestUploader(backend, endpoint string) *profileUploader {
+	return &profileUploader{
+		config: runtime.ProfilingConfig{
+			Backend:  backend,
+			Endpoint: endpoint,
+			Project:  "my-project",
+			Headers:  map[string]string{"Authorization": "secret"},
+		},
+		client:   &http.Client{Timeout: 5 * time.Second},
+		app:      "Collatz",
+		duration: 100 * time.Millisecond,
+		tags: map[string]string{
+			"deployment": "1234",
+			"group":      "main",
+			"weavelet":   "5678",
+		},
+	}
+}
+
+// checkProfile checks that the provided data is a valid pprof profile.
+func checkProfile(t *testing.T, data []byte) {
+	t.Helper()
+	if _, err := profile.ParseData(data); err != nil {
+		t.Errorf("invalid profile: %v", err)
+	}
+}
+
+func TestUploadPyroscope(t *testing.T) {
+	// Run a fake Pyroscope server.
+	type upload struct {
+		query map[string]string
+		data  []byte
+	}
+	uploads := make(chan upload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ingest" || r.Header.Get("Authorization") != "secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		f, _, err := r.FormFile("profile")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query := map[string]string{}
+		for _, key := range []string{"name", "format", "spyName"} {
+			query[key] = r.URL.Query().Get(key)
+		}
+		uploads <- upload{query, data}
+	}))
+	defer server.Close()
+
+	u := newTestUploader(runtime.PyroscopeBackend, server.URL)
+	p, err := u.capture(protos.ProfileType_Heap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.upload(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	got := <-uploads
+	want := map[string]string{
+		"name":    "Collatz{deployment=1234,group=main,weavelet=5678}",
+		"format":  "pprof",
+		"spyName": "gospy",
+	}
+	if diff := cmp.Diff(want, got.query); diff != "" {
+		t.Errorf("query (-want +got):\n%s", diff)
+	}
+	checkProfile(t, got.data)
+}
+
+func TestUploadCloudProfiler(t *testing.T) {
+	// Run a fake Cloud Profiler server.
+	uploads := make(chan cloudProfile, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/projects/my-project/profiles:createOffline" || r.Header.Get("Authorization") != "secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var p cloudProfile
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		uploads <- p
+	}))
+	defer server.Close()
+
+	u := newTestUploader(runtime.CloudProfilerBackend, server.URL)
+	p, err := u.capture(protos.ProfileType_CPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.upload(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	got := <-uploads
+	checkProfile(t, got.ProfileBytes)
+	if got.Duration == "" {
+		t.Error("missing duration of CPU profile")
+	}
+	got.ProfileBytes, got.Duration = nil, ""
+	want := cloudProfile{
+		ProfileType: "CPU",
+		Deployment: cloudDeployment{
+			ProjectID: "my-project",
+			Target:    "collatz",
+			Labels:    map[string]string{"language": "go", "version": "1234"},
+		},
+		Labels: map[string]string{"deployment": "1234", "group": "main", "weavelet": "5678"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("profile (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	imetrics "github.com/ServiceWeaver/weaver/internal/metrics"
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
+)
+
+// defaultPrometheusPath is the HTTP path of the Prometheus endpoint if the
+// config doesn't specify one.
+const defaultPrometheusPath = "/metrics"
+
+// servePrometheus serves the metrics of the weavelet in the Prometheus text
+// format, or in the OpenMetrics text format if requested, as configured by the
+// [serviceweaver.prometheus] section of the app config. It returns when the
+// weavelet's context is cancelled.
+func (d *weavelet) servePrometheus() error {
+	config := d.config.Prometheus
+	path := config.Path
+	if path == "" {
+		path = defaultPrometheusPath
+	}
+	lis, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return fmt.Errorf("prometheus: listen on %q: %w", config.Address, err)
+	}
+	d.env.SystemLogger().Info("Prometheus endpoint available", "address", lis.Addr().String(), "path", path)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		var b bytes.Buffer
+		if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+			// Only the OpenMetrics format carries exemplars.
+			imetrics.TranslateMetricsToOpenMetricsTextFormat(&b, d.prometheusSnapshots())
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		} else {
+			imetrics.TranslateMetricsToPrometheusTextFormat(&b, d.prometheusSnapshots(), r.Host, path)
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		}
+		w.Write(b.Bytes())
+	})
+	return serveHTTP(d.ctx, lis, mux)
+}
+
+// prometheusSnapshots returns snapshots of the metrics of the weavelet,
+// labeled with the app, deployment, component, and replica labels described
+// in runtime.PrometheusConfig. Labels that a metric already has are kept.
+func (d *weavelet) prometheusSnapshots() []*metrics.MetricSnapshot {
+	snapshots := metrics.Snapshot()
+	for _, s := range snapshots {
+		if s.Labels == nil {
+			s.Labels = map[string]string{}
+		}
+		for key, value := range map[string]string{
+			"app":        d.info.App,
+			"deployment": d.info.DeploymentId,
+			"component":  d.info.Process,
+			"replica":    d.info.Id,
+		} {
+			if _, ok := s.Labels[key]; !ok {
+				s.Labels[key] = value
+			}
+		}
+	}
+	return snapshots
+}
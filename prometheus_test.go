@@ -0,0 +1,76 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+func TestPrometheusLabels(t *testing.T) {
+	d := &weavelet{info: &protos.WeaveletInfo{
+		App:          "app",
+		DeploymentId: "deployment",
+		Process:      "github.com/example/app/Reverser",
+		Id:           "replica",
+	}}
+	metrics.Register(protos.MetricType_COUNTER, "TestPrometheusLabels", "", nil)
+	codegen.MethodCounts.Get(codegen.MethodLabels{
+		Caller:    "main",
+		Component: "github.com/example/app/Cache",
+		Method:    "TestPrometheusLabels",
+	}).Add(1)
+
+	var user, method map[string]string
+	for _, s := range d.prometheusSnapshots() {
+		switch {
+		case s.Name == "TestPrometheusLabels":
+			user = s.Labels
+		case s.Name == codegen.MethodCounts.Name() && s.Labels["method"] == "TestPrometheusLabels":
+			method = s.Labels
+		}
+	}
+	for _, test := range []struct {
+		name   string
+		labels map[string]string
+		want   map[string]string
+	}{
+		{"user metric", user, map[string]string{
+			"app":        "app",
+			"deployment": "deployment",
+			"component":  "github.com/example/app/Reverser",
+			"replica":    "replica",
+		}},
+		{"method metric", method, map[string]string{
+			"app":        "app",
+			"deployment": "deployment",
+			"component":  "github.com/example/app/Cache",
+			"replica":    "replica",
+		}},
+	} {
+		if test.labels == nil {
+			t.Errorf("%s: not found", test.name)
+			continue
+		}
+		for key, want := range test.want {
+			if got := test.labels[key]; got != want {
+				t.Errorf("%s: label %q: got %q, want %q", test.name, key, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryBackend is the name of the in-process backend.
+const memoryBackend = "memory"
+
+// memory is a Backend that holds messages in memory.
+type memory struct {
+	ackDeadline time.Duration
+	now         func() time.Time // time.Now usually, but injected fake in tests
+
+	mu     sync.Mutex
+	topics map[string]map[string]*subscription // topic -> name -> subscription
+}
+
+// subscription holds the messages that haven't been acknowledged by a
+// subscription yet.
+type subscription struct {
+	nextID   uint64
+	queue    []*pending          // messages not yet delivered, oldest first
+	inflight map[uint64]*pending // delivered but unacknowledged messages
+}
+
+type pending struct {
+	msg      Message
+	deadline time.Time // ack deadline of an inflight message
+}
+
+var _ Backend = &memory{}
+
+func newMemory(cfg *Config) (Backend, error) {
+	return &memory{
+		ackDeadline: cfg.ackDeadline(),
+		now:         time.Now,
+		topics:      map[string]map[string]*subscription{},
+	}, nil
+}
+
+// Publish implements the Backend interface.
+func (m *memory) Publish(_ context.Context, topic string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sub := range m.topics[topic] {
+		sub.nextID++
+		sub.queue = append(sub.queue, &pending{msg: Message{ID: sub.nextID, Data: data}})
+	}
+	return nil
+}
+
+// Pull implements the Backend interface.
+func (m *memory) Pull(_ context.Context, topic, name string, max int) ([]Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subs, ok := m.topics[topic]
+	if !ok {
+		subs = map[string]*subscription{}
+		m.topics[topic] = subs
+	}
+	sub, ok := subs[name]
+	if !ok {
+		sub = &subscription{inflight: map[uint64]*pending{}}
+		subs[name] = sub
+	}
+
+	now := m.now()
+	var msgs []Message
+	deliver := func(p *pending) {
+		p.msg.Attempts++
+		p.deadline = now.Add(m.ackDeadline)
+		sub.inflight[p.msg.ID] = p
+		msgs = append(msgs, p.msg)
+	}
+
+	// Redeliver expired messages first, since they are the oldest.
+	for _, p := range sub.inflight {
+		if len(msgs) == max {
+			return msgs, nil
+		}
+		if !now.Before(p.deadline) {
+			deliver(p)
+		}
+	}
+	for len(msgs) < max && len(sub.queue) > 0 {
+		deliver(sub.queue[0])
+		sub.queue[0] = nil
+		sub.queue = sub.queue[1:]
+	}
+	return msgs, nil
+}
+
+// Ack implements the Backend interface.
+func (m *memory) Ack(_ context.Context, topic, name string, ids []uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub, ok := m.topics[topic][name]
+	if !ok {
+		return nil
+	}
+	for _, id := range ids {
+		delete(sub.inflight, id)
+	}
+	return nil
+}
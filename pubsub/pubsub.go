@@ -0,0 +1,234 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pubsub provides a publish/subscribe broker component with
+// at-least-once delivery.
+//
+// Publishers and subscribers use a typed Topic on top of the Broker
+// component:
+//
+//	broker, err := weaver.Get[pubsub.Broker](root)
+//	orders := pubsub.NewTopic[Order](broker, "orders")
+//
+//	// Publisher.
+//	err := orders.Publish(ctx, order)
+//
+//	// Subscriber, e.g., in a goroutine started by a component's Init.
+//	err := orders.Subscribe(ctx, "email", func(ctx context.Context, o Order) error {
+//		return sendConfirmation(ctx, o)
+//	})
+//
+// Every subscription receives every message published to its topic after the
+// subscription was created, i.e., after its first pull. A message is
+// redelivered if its handler returns an error or doesn't finish within the
+// ack deadline, so handlers must be idempotent. Multiple subscribers may pull
+// from the same subscription to share its load.
+//
+// Calls are routed by topic, so every topic is owned by a single replica of
+// the broker.
+//
+// The broker is configured in the
+// ["github.com/ServiceWeaver/weaver/pubsub/Broker"] section of the config
+// file:
+//
+//	["github.com/ServiceWeaver/weaver/pubsub/Broker"]
+//	backend = "memory"     # name of a registered backend
+//	ack_deadline = "30s"   # time given to subscribers to ack a message
+//
+// The "memory" backend, which is always available, holds messages in the
+// memory of the replica that owns their topic, and loses them if the replica
+// fails. Other backends, e.g., ones that store messages in Kafka or Cloud
+// Pub/Sub, can be plugged in with RegisterBackend.
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+//go:generate ../cmd/weaver/weaver generate
+
+// Broker stores the messages published to topics until every subscription
+// of the topic has acknowledged them.
+type Broker interface {
+	// Publish publishes a message to the provided topic. The message is
+	// delivered to every subscription of the topic. If the topic has no
+	// subscriptions, the message is dropped.
+	Publish(ctx context.Context, topic string, data []byte) error
+
+	// Pull returns up to max messages from the provided subscription of the
+	// topic, creating the subscription if it doesn't exist. Pulled messages
+	// must be acknowledged with Ack before the ack deadline expires, or they
+	// are delivered again.
+	Pull(ctx context.Context, topic, subscription string, max int) ([]Message, error)
+
+	// Ack acknowledges the delivery of the messages with the provided ids.
+	// Unknown ids, e.g., of messages whose ack deadline has expired and that
+	// have since been acknowledged by another subscriber, are ignored.
+	Ack(ctx context.Context, topic, subscription string, ids []uint64) error
+}
+
+// Message is a message pulled from a subscription.
+type Message struct {
+	weaver.AutoMarshal
+	ID       uint64 // unique within the subscription
+	Data     []byte // payload passed to Publish
+	Attempts int    // number of times the message was delivered, including this one
+}
+
+// Config configures the broker. The same configuration is passed to the
+// backend constructor.
+type Config struct {
+	// Backend is the name of the backend that stores messages. If empty,
+	// defaults to "memory".
+	Backend string
+
+	// AckDeadline is how long a subscriber has to acknowledge a pulled
+	// message before it is delivered again, in a format accepted by
+	// time.ParseDuration. If empty, defaults to DefaultAckDeadline.
+	AckDeadline string `toml:"ack_deadline"`
+
+	// Options holds backend-specific settings, e.g., the address of a
+	// remote broker.
+	Options map[string]string
+}
+
+// DefaultAckDeadline is the default value of Config.AckDeadline.
+const DefaultAckDeadline = 30 * time.Second
+
+// Validate validates the config.
+func (cfg *Config) Validate() error {
+	if cfg.AckDeadline != "" {
+		d, err := time.ParseDuration(cfg.AckDeadline)
+		if err != nil {
+			return fmt.Errorf("invalid ack_deadline %q: %w", cfg.AckDeadline, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid non-positive ack_deadline %q", cfg.AckDeadline)
+		}
+	}
+	name := cfg.Backend
+	if name == "" {
+		name = memoryBackend
+	}
+	if _, ok := lookupBackend(name); !ok {
+		return fmt.Errorf("unknown backend %q", cfg.Backend)
+	}
+	return nil
+}
+
+// ackDeadline returns the ack deadline of the config, which must be valid.
+func (cfg *Config) ackDeadline() time.Duration {
+	if cfg.AckDeadline == "" {
+		return DefaultAckDeadline
+	}
+	d, _ := time.ParseDuration(cfg.AckDeadline)
+	return d
+}
+
+// Backend stores the messages of the topics owned by a broker replica.
+// Implementations must be safe for concurrent use, and follow the delivery
+// semantics documented on the methods of Broker.
+type Backend interface {
+	// Publish publishes a message to the provided topic.
+	Publish(ctx context.Context, topic string, data []byte) error
+
+	// Pull returns up to max messages from the provided subscription of the
+	// topic, creating the subscription if it doesn't exist. max is positive.
+	Pull(ctx context.Context, topic, subscription string, max int) ([]Message, error)
+
+	// Ack acknowledges the delivery of the messages with the provided ids.
+	Ack(ctx context.Context, topic, subscription string, ids []uint64) error
+}
+
+// NewBackendFunc returns a new backend for the provided configuration.
+type NewBackendFunc func(*Config) (Backend, error)
+
+var (
+	backendsMu sync.Mutex
+	backends   = map[string]NewBackendFunc{
+		memoryBackend: newMemory,
+	}
+)
+
+// RegisterBackend registers a backend under the provided name, which can
+// then be selected with the "backend" config option. RegisterBackend is
+// typically called from an init function. It panics if a backend with the
+// same name is already registered.
+func RegisterBackend(name string, newBackend NewBackendFunc) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, ok := backends[name]; ok {
+		panic(fmt.Sprintf("pubsub: backend %q already registered", name))
+	}
+	backends[name] = newBackend
+}
+
+// lookupBackend returns the backend registered under the provided name.
+func lookupBackend(name string) (NewBackendFunc, bool) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	f, ok := backends[name]
+	return f, ok
+}
+
+type router struct{}
+
+func (router) Publish(_ context.Context, topic string, _ []byte) string { return topic }
+func (router) Pull(_ context.Context, topic, _ string, _ int) string    { return topic }
+func (router) Ack(_ context.Context, topic, _ string, _ []uint64) string {
+	return topic
+}
+
+type broker struct {
+	weaver.Implements[Broker]
+	weaver.WithRouter[router]
+	weaver.WithConfig[Config]
+
+	backend Backend
+}
+
+func (b *broker) Init(context.Context) error {
+	cfg := *b.Config()
+	if cfg.Backend == "" {
+		cfg.Backend = memoryBackend
+	}
+	newBackend, _ := lookupBackend(cfg.Backend)
+	backend, err := newBackend(&cfg)
+	if err != nil {
+		return fmt.Errorf("pubsub: create %q backend: %w", cfg.Backend, err)
+	}
+	b.backend = backend
+	b.Logger().Debug("broker started", "backend", cfg.Backend, "ack_deadline", cfg.ackDeadline())
+	return nil
+}
+
+func (b *broker) Publish(ctx context.Context, topic string, data []byte) error {
+	return b.backend.Publish(ctx, topic, data)
+}
+
+func (b *broker) Pull(ctx context.Context, topic, name string, max int) ([]Message, error) {
+	if max <= 0 {
+		return nil, fmt.Errorf("pubsub: invalid non-positive max %d", max)
+	}
+	return b.backend.Pull(ctx, topic, name, max)
+}
+
+func (b *broker) Ack(ctx context.Context, topic, name string, ids []uint64) error {
+	return b.backend.Ack(ctx, topic, name, ids)
+}
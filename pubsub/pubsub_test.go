@@ -0,0 +1,220 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/weavertest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedeliverUnacked(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			b := weavertest.InitComponent[Broker](t, weavertest.Options{
+				SingleProcess: single,
+				Replicas:      1,
+				Config: `
+["github.com/ServiceWeaver/weaver/pubsub/Broker"]
+ack_deadline = "10ms"
+`,
+			})
+			pull := func() []Message {
+				t.Helper()
+				msgs, err := b.Pull(ctx, "topic", "sub", 10)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return msgs
+			}
+
+			pull() // create the subscription
+			if err := b.Publish(ctx, "topic", []byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			msgs := pull()
+			if len(msgs) != 1 || string(msgs[0].Data) != "hello" || msgs[0].Attempts != 1 {
+				t.Fatalf("first pull: got %v, want one first delivery of hello", msgs)
+			}
+			if msgs := pull(); len(msgs) != 0 {
+				t.Fatalf("pull before ack deadline: got %v, want nothing", msgs)
+			}
+
+			// Without an ack, the message is redelivered after the deadline.
+			time.Sleep(20 * time.Millisecond)
+			msgs = pull()
+			if len(msgs) != 1 || msgs[0].Attempts != 2 {
+				t.Fatalf("pull after ack deadline: got %v, want one redelivery", msgs)
+			}
+			if err := b.Ack(ctx, "topic", "sub", []uint64{msgs[0].ID}); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(20 * time.Millisecond)
+			if msgs := pull(); len(msgs) != 0 {
+				t.Fatalf("pull after ack: got %v, want nothing", msgs)
+			}
+		})
+	}
+}
+
+func TestTopicFanout(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			b := weavertest.InitComponent[Broker](t, weavertest.Options{
+				SingleProcess: single,
+				Replicas:      1,
+				Config: `
+["github.com/ServiceWeaver/weaver/pubsub/Broker"]
+ack_deadline = "10ms"
+`,
+			})
+			topic := NewTopic[int](b, "numbers")
+
+			// Create the subscriptions before publishing.
+			subs := []string{"a", "b"}
+			for _, sub := range subs {
+				if _, err := b.Pull(ctx, topic.Name(), sub, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 3; i++ {
+				if err := topic.Publish(ctx, i); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var mu sync.Mutex
+			got := map[string][]int{}
+			failed := false
+			var wg sync.WaitGroup
+			for _, sub := range subs {
+				sub := sub
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					topic.Subscribe(ctx, sub, func(_ context.Context, n int) error {
+						mu.Lock()
+						defer mu.Unlock()
+						if sub == "a" && n == 1 && !failed {
+							// Fail once, to force a redelivery.
+							failed = true
+							return errors.New("injected failure")
+						}
+						got[sub] = append(got[sub], n)
+						return nil
+					})
+				}()
+			}
+
+			want := map[string][]int{"a": {0, 1, 2}, "b": {0, 1, 2}}
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				mu.Lock()
+				for _, ns := range got {
+					sort.Ints(ns)
+				}
+				diff := cmp.Diff(want, got)
+				mu.Unlock()
+				if diff == "" {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("delivered messages (-want +got):\n%s", diff)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			cancel()
+			wg.Wait()
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		cfg  Config
+	}{
+		{"BadAckDeadline", Config{AckDeadline: "soon"}},
+		{"ZeroAckDeadline", Config{AckDeadline: "0s"}},
+		{"UnknownBackend", Config{Backend: "nonexistent"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.cfg.Validate(); err == nil {
+				t.Fatalf("Validate(%+v): unexpected success", test.cfg)
+			}
+		})
+	}
+}
+
+// prefixBackend is a memory backend that adds the "prefix" option to the
+// messages published to it.
+type prefixBackend struct {
+	Backend
+	prefix string
+}
+
+func init() {
+	RegisterBackend("prefix", func(cfg *Config) (Backend, error) {
+		m, err := newMemory(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &prefixBackend{Backend: m, prefix: cfg.Options["prefix"]}, nil
+	})
+}
+
+func (p *prefixBackend) Publish(ctx context.Context, topic string, data []byte) error {
+	return p.Backend.Publish(ctx, topic, append([]byte(p.prefix), data...))
+}
+
+func TestRegisteredBackend(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			b := weavertest.InitComponent[Broker](t, weavertest.Options{
+				SingleProcess: single,
+				Replicas:      1,
+				Config: `
+["github.com/ServiceWeaver/weaver/pubsub/Broker"]
+backend = "prefix"
+options = {prefix = "prefixed "}
+`,
+			})
+			if _, err := b.Pull(ctx, "topic", "sub", 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Publish(ctx, "topic", []byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			msgs, err := b.Pull(ctx, "topic", "sub", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != 1 || string(msgs[0].Data) != "prefixed hello" {
+				t.Fatalf("Pull: got %v, want one message %q", msgs, "prefixed hello")
+			}
+		})
+	}
+}
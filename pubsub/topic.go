@@ -0,0 +1,95 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// pullBatchSize is the maximum number of messages pulled at once by
+	// Subscribe.
+	pullBatchSize = 64
+
+	// pollInterval is how long Subscribe waits before pulling again from a
+	// subscription that had no messages.
+	pollInterval = 100 * time.Millisecond
+)
+
+// Topic is a typed handle to a topic of a Broker. Messages are encoded as
+// JSON, so T must be JSON-serializable.
+type Topic[T any] struct {
+	broker Broker
+	name   string
+}
+
+// NewTopic returns a handle to the topic with the provided name.
+func NewTopic[T any](broker Broker, name string) Topic[T] {
+	return Topic[T]{broker: broker, name: name}
+}
+
+// Name returns the name of the topic.
+func (t Topic[T]) Name() string {
+	return t.name
+}
+
+// Publish publishes msg to the topic.
+func (t Topic[T]) Publish(ctx context.Context, msg T) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return t.broker.Publish(ctx, t.name, data)
+}
+
+// Subscribe repeatedly pulls messages from the provided subscription of the
+// topic and passes them to handler, until ctx is canceled. A message is
+// acknowledged if the handler returns nil, and is delivered again otherwise.
+// Messages that cannot be decoded are acknowledged and dropped.
+//
+// Subscribe returns ctx.Err() when ctx is canceled. Errors returned by the
+// broker are retried.
+func (t Topic[T]) Subscribe(ctx context.Context, subscription string, handler func(context.Context, T) error) error {
+	for ctx.Err() == nil {
+		msgs, err := t.broker.Pull(ctx, t.name, subscription, pullBatchSize)
+		if err == nil && len(msgs) > 0 {
+			var acks []uint64
+			for _, m := range msgs {
+				var msg T
+				if err := json.Unmarshal(m.Data, &msg); err != nil {
+					acks = append(acks, m.ID)
+					continue
+				}
+				if err := handler(ctx, msg); err == nil {
+					acks = append(acks, m.ID)
+				}
+			}
+			if len(acks) > 0 {
+				// If the ack fails, the messages are delivered again.
+				t.broker.Ack(ctx, t.name, subscription, acks)
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+	return ctx.Err()
+}
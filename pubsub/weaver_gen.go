@@ -0,0 +1,497 @@
+package pubsub
+
+// Code generated by "weaver generate". DO NOT EDIT.
+import (
+	"context"
+	"fmt"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"reflect"
+	"time"
+)
+
+func init() {
+	codegen.Register(codegen.Registration{
+		Name:        "github.com/ServiceWeaver/weaver/pubsub/Broker",
+		Iface:       reflect.TypeOf((*Broker)(nil)).Elem(),
+		New:         func() any { return &broker{} },
+		ConfigFn:    func(i any) any { return i.(*broker).WithConfig.Config() },
+		Routed:      true,
+		Router:      reflect.TypeOf((*broker_router)(nil)).Elem(),
+		LocalStubFn: func(impl any, tracer trace.Tracer) any { return broker_local_stub{impl: impl.(Broker), tracer: tracer} },
+		ClientStubFn: func(stub codegen.Stub, caller string) any {
+			return broker_client_stub{stub: stub, publishMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/pubsub/Broker", Method: "Publish"}), pullMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/pubsub/Broker", Method: "Pull"}), ackMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/pubsub/Broker", Method: "Ack"})}
+		},
+		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
+			return broker_server_stub{impl: impl.(Broker), addLoad: addLoad}
+		},
+		ParamNames: map[string][]string{"Publish": {"topic", "data"}, "Pull": {"topic", "subscription", "max"}, "Ack": {"topic", "subscription", "ids"}},
+	})
+}
+
+// Local stub implementations.
+
+type broker_local_stub struct {
+	impl   Broker
+	tracer trace.Tracer
+}
+
+func (s broker_local_stub) Publish(ctx context.Context, a0 string, a1 []byte) (err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "pubsub.Broker.Publish", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.Publish(ctx, a0, a1)
+}
+
+func (s broker_local_stub) Pull(ctx context.Context, a0 string, a1 string, a2 int) (r0 []Message, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "pubsub.Broker.Pull", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.Pull(ctx, a0, a1, a2)
+}
+
+func (s broker_local_stub) Ack(ctx context.Context, a0 string, a1 string, a2 []uint64) (err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "pubsub.Broker.Ack", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.Ack(ctx, a0, a1, a2)
+}
+
+// Client stub implementations.
+
+type broker_client_stub struct {
+	stub           codegen.Stub
+	publishMetrics *codegen.MethodMetrics
+	pullMetrics    *codegen.MethodMetrics
+	ackMetrics     *codegen.MethodMetrics
+}
+
+func (s broker_client_stub) Publish(ctx context.Context, a0 string, a1 []byte) (err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.publishMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "pubsub.Broker.Publish", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += (4 + (len(a1) * 1))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	serviceweaver_enc_slice_byte_87461245(enc, a1)
+
+	// Set the shardKey.
+	shardKey := _hashBroker(_routerBroker().Publish(ctx, a0, a1))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 1, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	err = dec.Error()
+	return
+}
+
+func (s broker_client_stub) Pull(ctx context.Context, a0 string, a1 string, a2 int) (r0 []Message, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.pullMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "pubsub.Broker.Pull", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += (4 + len(a1))
+	size += 8
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	enc.String(a1)
+	enc.Int(a2)
+
+	// Set the shardKey.
+	shardKey := _hashBroker(_routerBroker().Pull(ctx, a0, a1, a2))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 2, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = serviceweaver_dec_slice_Message_c2a9c1da(dec)
+	err = dec.Error()
+	return
+}
+
+func (s broker_client_stub) Ack(ctx context.Context, a0 string, a1 string, a2 []uint64) (err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.ackMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "pubsub.Broker.Ack", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += (4 + len(a1))
+	size += (4 + (len(a2) * 8))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	enc.String(a1)
+	serviceweaver_enc_slice_uint64_489cb07a(enc, a2)
+
+	// Set the shardKey.
+	shardKey := _hashBroker(_routerBroker().Ack(ctx, a0, a1, a2))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	err = dec.Error()
+	return
+}
+
+// Server stub implementations.
+
+type broker_server_stub struct {
+	impl    Broker
+	addLoad func(key uint64, load float64)
+}
+
+// GetStubFn implements the stub.Server interface.
+func (s broker_server_stub) GetStubFn(method string) func(ctx context.Context, args []byte) ([]byte, error) {
+	switch method {
+	case "Publish":
+		return s.publish
+	case "Pull":
+		return s.pull
+	case "Ack":
+		return s.ack
+	default:
+		return nil
+	}
+}
+
+func (s broker_server_stub) publish(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 []byte
+	a1 = serviceweaver_dec_slice_byte_87461245(dec)
+	s.addLoad(_hashBroker(_routerBroker().Publish(ctx, a0, a1)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	appErr := s.impl.Publish(ctx, a0, a1)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s broker_server_stub) pull(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 string
+	a1 = dec.String()
+	var a2 int
+	a2 = dec.Int()
+	s.addLoad(_hashBroker(_routerBroker().Pull(ctx, a0, a1, a2)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, appErr := s.impl.Pull(ctx, a0, a1, a2)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	serviceweaver_enc_slice_Message_c2a9c1da(enc, r0)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s broker_server_stub) ack(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 string
+	a1 = dec.String()
+	var a2 []uint64
+	a2 = serviceweaver_dec_slice_uint64_489cb07a(dec)
+	s.addLoad(_hashBroker(_routerBroker().Ack(ctx, a0, a1, a2)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	appErr := s.impl.Ack(ctx, a0, a1, a2)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+// AutoMarshal implementations.
+
+var _ codegen.AutoMarshal = &Message{}
+
+func (x *Message) WeaverMarshal(enc *codegen.Encoder) {
+	if x == nil {
+		panic(fmt.Errorf("Message.WeaverMarshal: nil receiver"))
+	}
+	enc.Uint64(x.ID)
+	serviceweaver_enc_slice_byte_87461245(enc, x.Data)
+	enc.Int(x.Attempts)
+}
+
+func (x *Message) WeaverUnmarshal(dec *codegen.Decoder) {
+	if x == nil {
+		panic(fmt.Errorf("Message.WeaverUnmarshal: nil receiver"))
+	}
+	x.ID = dec.Uint64()
+	x.Data = serviceweaver_dec_slice_byte_87461245(dec)
+	x.Attempts = dec.Int()
+}
+
+func serviceweaver_enc_slice_byte_87461245(enc *codegen.Encoder, arg []byte) {
+	enc.Bytes(arg)
+}
+
+func serviceweaver_dec_slice_byte_87461245(dec *codegen.Decoder) []byte {
+	return dec.Bytes()
+}
+
+func init() {
+	codegen.RegisterSerializable[Message]()
+}
+
+// Router methods.
+
+// broker_router holds the routing methods of the Broker component.
+type broker_router interface {
+	Publish(ctx context.Context, a0 string, a1 []byte) string
+	Pull(ctx context.Context, a0 string, a1 string, a2 int) string
+	Ack(ctx context.Context, a0 string, a1 string, a2 []uint64) string
+}
+
+// _routerBroker returns the router installed for the Broker component.
+func _routerBroker() broker_router {
+	if r, ok := codegen.Router("github.com/ServiceWeaver/weaver/pubsub/Broker").(broker_router); ok {
+		return r
+	}
+	return new(router)
+}
+
+// _hashBroker returns a 64 bit hash of the provided value.
+func _hashBroker(r string) uint64 {
+	var h codegen.Hasher
+	h.WriteString(string(r))
+	return h.Sum64()
+}
+
+// _orderedCodeBroker returns an order-preserving serialization of the provided value.
+func _orderedCodeBroker(r string) codegen.OrderedCode {
+	var enc codegen.OrderedEncoder
+	enc.WriteString(string(r))
+	return enc.Encode()
+}
+
+// Encoding/decoding implementations.
+
+func serviceweaver_enc_slice_uint64_489cb07a(enc *codegen.Encoder, arg []uint64) {
+	if arg == nil {
+		enc.Len(-1)
+		return
+	}
+	enc.Len(len(arg))
+	for i := 0; i < len(arg); i++ {
+		enc.Uint64(arg[i])
+	}
+}
+
+func serviceweaver_dec_slice_uint64_489cb07a(dec *codegen.Decoder) []uint64 {
+	n := dec.Len()
+	if n == -1 {
+		return nil
+	}
+	res := make([]uint64, n)
+	for i := 0; i < n; i++ {
+		res[i] = dec.Uint64()
+	}
+	return res
+}
+
+func serviceweaver_enc_slice_Message_c2a9c1da(enc *codegen.Encoder, arg []Message) {
+	if arg == nil {
+		enc.Len(-1)
+		return
+	}
+	enc.Len(len(arg))
+	for i := 0; i < len(arg); i++ {
+		(arg[i]).WeaverMarshal(enc)
+	}
+}
+
+func serviceweaver_dec_slice_Message_c2a9c1da(dec *codegen.Decoder) []Message {
+	n := dec.Len()
+	if n == -1 {
+		return nil
+	}
+	res := make([]Message, n)
+	for i := 0; i < n; i++ {
+		(&res[i]).WeaverUnmarshal(dec)
+	}
+	return res
+}
@@ -0,0 +1,424 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package queue provides a task queue component with at-least-once delivery,
+// retries, and dead-lettering.
+//
+// Producers and workers use a typed Queue on top of the Server component:
+//
+//	server, err := weaver.Get[queue.Server](root)
+//	emails := queue.New[Email](server, "emails")
+//
+//	// Producer.
+//	err := emails.Enqueue(ctx, email)
+//
+//	// Worker, e.g., in a goroutine started by a component's Init.
+//	err := emails.Work(ctx, func(ctx context.Context, e Email) error {
+//		return send(ctx, e)
+//	})
+//
+// Every task is delivered to one worker at a time. A task is retried, with
+// exponential backoff, if its handler returns an error or doesn't finish
+// within the lease timeout, so handlers must be idempotent. A task that fails
+// max_attempts times is moved to the queue's dead letters, where it can be
+// inspected with Server.DeadLetters and requeued with Server.Requeue.
+//
+// Calls are routed by queue, so every queue is owned by a single replica of
+// the server. Tasks are persisted in a Store, selected in the config of the
+// server:
+//
+//	["github.com/ServiceWeaver/weaver/queue/Server"]
+//	store = "file"
+//	dir = "/var/lib/myapp/queues"
+//
+// By default, tasks are held in memory and are lost if the replica fails.
+// Custom stores, e.g., backed by a database, can be registered with
+// RegisterStore. While the server's routing assignment changes, e.g., when
+// its replicas are added or removed, a task may be delivered twice.
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+//go:generate ../cmd/weaver/weaver generate
+
+// Server stores the tasks of queues and leases them to workers.
+type Server interface {
+	// Enqueue adds a task with the provided payload to the queue, and
+	// returns the id of the task.
+	Enqueue(ctx context.Context, queue string, data []byte) (uint64, error)
+
+	// Lease returns up to max tasks that are ready to be executed. Leased
+	// tasks must be acknowledged with Ack or failed with Fail before the
+	// lease timeout expires, or they are retried.
+	Lease(ctx context.Context, queue string, max int) ([]Task, error)
+
+	// Ack acknowledges the successful execution of the tasks with the
+	// provided ids, and removes them from the queue. Unknown ids are
+	// ignored.
+	Ack(ctx context.Context, queue string, ids []uint64) error
+
+	// Fail reports that the execution of the task with the provided id
+	// failed. The task is retried after a backoff, or moved to the dead
+	// letters if it has exhausted its attempts. Unknown ids are ignored.
+	Fail(ctx context.Context, queue string, id uint64, reason string) error
+
+	// DeadLetters returns the dead letters of the queue.
+	DeadLetters(ctx context.Context, queue string) ([]Task, error)
+
+	// Requeue moves the dead letters with the provided ids back to the
+	// queue, with a fresh set of attempts. Unknown ids are ignored.
+	Requeue(ctx context.Context, queue string, ids []uint64) error
+}
+
+// Task is a task in a queue.
+type Task struct {
+	weaver.AutoMarshal
+	ID        uint64 // unique within the queue
+	Data      []byte // payload passed to Enqueue
+	Attempts  int    // number of times the task was leased
+	LastError string // reason of the last failure, if any
+	ReadyAt   int64  // when the task can be leased, in nanoseconds since the Unix epoch
+	Dead      bool   // is the task a dead letter?
+}
+
+// config configures the server.
+type config struct {
+	// LeaseTimeout is how long a worker has to execute a leased task before
+	// the task is retried, in a format accepted by time.ParseDuration. If
+	// empty, defaults to defaultLeaseTimeout.
+	LeaseTimeout string `toml:"lease_timeout"`
+
+	// MaxAttempts is the number of times a task is attempted before it is
+	// moved to the dead letters. If zero, defaults to defaultMaxAttempts.
+	MaxAttempts int `toml:"max_attempts"`
+
+	// MinBackoff and MaxBackoff bound the delay before a failed task is
+	// retried. The delay doubles with every attempt. If empty, they default
+	// to defaultMinBackoff and defaultMaxBackoff.
+	MinBackoff string `toml:"min_backoff"`
+	MaxBackoff string `toml:"max_backoff"`
+
+	// Store is the name of the store that persists tasks: "memory" (the
+	// default), "file", or the name of a store registered with
+	// RegisterStore.
+	Store string `toml:"store"`
+
+	// Dir is the directory where the "file" store keeps its files.
+	Dir string `toml:"dir"`
+}
+
+const (
+	defaultLeaseTimeout = 30 * time.Second
+	defaultMaxAttempts  = 5
+	defaultMinBackoff   = time.Second
+	defaultMaxBackoff   = time.Minute
+)
+
+func (cfg *config) Validate() error {
+	for _, d := range []struct{ name, value string }{
+		{"lease_timeout", cfg.LeaseTimeout},
+		{"min_backoff", cfg.MinBackoff},
+		{"max_backoff", cfg.MaxBackoff},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", d.name, d.value, err)
+		}
+		if v <= 0 {
+			return fmt.Errorf("invalid non-positive %s %q", d.name, d.value)
+		}
+	}
+	if cfg.MaxAttempts < 0 {
+		return fmt.Errorf("invalid negative max_attempts %d", cfg.MaxAttempts)
+	}
+	switch cfg.Store {
+	case "", "memory":
+	case "file":
+		if cfg.Dir == "" {
+			return fmt.Errorf("missing dir for the file store")
+		}
+	default:
+		if lookupStore(cfg.Store) == nil {
+			return fmt.Errorf("unknown store %q", cfg.Store)
+		}
+	}
+	return nil
+}
+
+type router struct{}
+
+func (router) Enqueue(_ context.Context, queue string, _ []byte) string { return queue }
+func (router) Lease(_ context.Context, queue string, _ int) string      { return queue }
+func (router) Ack(_ context.Context, queue string, _ []uint64) string   { return queue }
+func (router) Fail(_ context.Context, queue string, _ uint64, _ string) string {
+	return queue
+}
+func (router) DeadLetters(_ context.Context, queue string) string         { return queue }
+func (router) Requeue(_ context.Context, queue string, _ []uint64) string { return queue }
+
+type server struct {
+	weaver.Implements[Server]
+	weaver.WithRouter[router]
+	weaver.WithConfig[config]
+
+	leaseTimeout time.Duration
+	maxAttempts  int
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	store        Store
+	now          func() time.Time // time.Now usually, but injected fake in tests
+
+	mu     sync.Mutex
+	queues map[string]*queueState
+}
+
+// queueState holds the tasks of a queue that were loaded from the store.
+type queueState struct {
+	nextID uint64
+	tasks  map[uint64]*entry
+}
+
+type entry struct {
+	task    Task
+	expires time.Time // lease expiration of a leased task
+}
+
+func (s *server) Init(context.Context) error {
+	cfg := s.Config()
+	duration := func(value string, def time.Duration) time.Duration {
+		if value == "" {
+			return def
+		}
+		// The duration was checked by Validate.
+		d, _ := time.ParseDuration(value)
+		return d
+	}
+	s.leaseTimeout = duration(cfg.LeaseTimeout, defaultLeaseTimeout)
+	s.minBackoff = duration(cfg.MinBackoff, defaultMinBackoff)
+	s.maxBackoff = duration(cfg.MaxBackoff, defaultMaxBackoff)
+	s.maxAttempts = cfg.MaxAttempts
+	if s.maxAttempts == 0 {
+		s.maxAttempts = defaultMaxAttempts
+	}
+	switch cfg.Store {
+	case "", "memory":
+		s.store = NewMemoryStore()
+	case "file":
+		store, err := NewFileStore(cfg.Dir)
+		if err != nil {
+			return err
+		}
+		s.store = store
+	default:
+		s.store = lookupStore(cfg.Store)
+	}
+	s.now = time.Now
+	s.queues = map[string]*queueState{}
+	return nil
+}
+
+// queue returns the state of the provided queue, loading it from the store
+// if needed. REQUIRES: s.mu is held.
+func (s *server) queue(ctx context.Context, name string) (*queueState, error) {
+	if q, ok := s.queues[name]; ok {
+		return q, nil
+	}
+	tasks, err := s.store.Load(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("queue: load %q: %w", name, err)
+	}
+	q := &queueState{tasks: map[uint64]*entry{}}
+	for _, t := range tasks {
+		q.tasks[t.ID] = &entry{task: t}
+		if t.ID > q.nextID {
+			q.nextID = t.ID
+		}
+	}
+	s.queues[name] = q
+	return q, nil
+}
+
+func (s *server) Enqueue(ctx context.Context, name string, data []byte) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	task := Task{ID: q.nextID + 1, Data: data, ReadyAt: s.now().UnixNano()}
+	if err := s.store.Put(ctx, name, task); err != nil {
+		return 0, err
+	}
+	q.nextID++
+	q.tasks[task.ID] = &entry{task: task}
+	return task.ID, nil
+}
+
+func (s *server) Lease(ctx context.Context, name string, max int) ([]Task, error) {
+	if max <= 0 {
+		return nil, fmt.Errorf("queue: invalid non-positive max %d", max)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	var ready []*entry
+	for _, e := range q.tasks {
+		if !e.task.Dead && e.task.ReadyAt <= now.UnixNano() && !now.Before(e.expires) {
+			ready = append(ready, e)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool { return ready[i].task.ID < ready[j].task.ID })
+
+	var tasks []Task
+	for _, e := range ready {
+		if len(tasks) == max {
+			break
+		}
+		task := e.task
+		if task.Attempts >= s.maxAttempts {
+			// The last attempt's lease expired.
+			task.Dead = true
+			task.LastError = "lease expired"
+			if err := s.store.Put(ctx, name, task); err != nil {
+				return tasks, err
+			}
+			e.task = task
+			continue
+		}
+		task.Attempts++
+		if err := s.store.Put(ctx, name, task); err != nil {
+			return tasks, err
+		}
+		e.task = task
+		e.expires = now.Add(s.leaseTimeout)
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (s *server) Ack(ctx context.Context, name string, ids []uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if e, ok := q.tasks[id]; !ok || e.task.Dead {
+			continue
+		}
+		if err := s.store.Delete(ctx, name, id); err != nil {
+			return err
+		}
+		delete(q.tasks, id)
+	}
+	return nil
+}
+
+func (s *server) Fail(ctx context.Context, name string, id uint64, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(ctx, name)
+	if err != nil {
+		return err
+	}
+	e, ok := q.tasks[id]
+	if !ok || e.task.Dead {
+		return nil
+	}
+	task := e.task
+	task.LastError = reason
+	if task.Attempts >= s.maxAttempts {
+		task.Dead = true
+	} else {
+		task.ReadyAt = s.now().Add(s.backoff(task.Attempts)).UnixNano()
+	}
+	if err := s.store.Put(ctx, name, task); err != nil {
+		return err
+	}
+	e.task = task
+	e.expires = time.Time{}
+	return nil
+}
+
+// backoff returns the delay before a task that failed the provided number of
+// attempts is retried.
+func (s *server) backoff(attempts int) time.Duration {
+	d := s.minBackoff
+	for i := 1; i < attempts && d < s.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > s.maxBackoff {
+		d = s.maxBackoff
+	}
+	return d
+}
+
+func (s *server) DeadLetters(ctx context.Context, name string) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var dead []Task
+	for _, e := range q.tasks {
+		if e.task.Dead {
+			dead = append(dead, e.task)
+		}
+	}
+	sort.Slice(dead, func(i, j int) bool { return dead[i].ID < dead[j].ID })
+	return dead, nil
+}
+
+func (s *server) Requeue(ctx context.Context, name string, ids []uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		e, ok := q.tasks[id]
+		if !ok || !e.task.Dead {
+			continue
+		}
+		task := e.task
+		task.Dead = false
+		task.Attempts = 0
+		task.ReadyAt = s.now().UnixNano()
+		if err := s.store.Put(ctx, name, task); err != nil {
+			return err
+		}
+		e.task = task
+		e.expires = time.Time{}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/weavertest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			s := weavertest.InitComponent[Server](t, weavertest.Options{
+				SingleProcess: single,
+				Replicas:      1,
+				Config: `
+["github.com/ServiceWeaver/weaver/queue/Server"]
+lease_timeout = "10ms"
+max_attempts = 2
+min_backoff = "10ms"
+`,
+			})
+			lease := func() []Task {
+				t.Helper()
+				tasks, err := s.Lease(ctx, "q", 10)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return tasks
+			}
+
+			id, err := s.Enqueue(ctx, "q", []byte("hello"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tasks := lease()
+			if len(tasks) != 1 || tasks[0].ID != id || tasks[0].Attempts != 1 {
+				t.Fatalf("first lease: got %v, want one first attempt", tasks)
+			}
+			if tasks := lease(); len(tasks) != 0 {
+				t.Fatalf("lease while leased: got %v, want nothing", tasks)
+			}
+
+			// A failed task is retried after a backoff.
+			if err := s.Fail(ctx, "q", id, "oops"); err != nil {
+				t.Fatal(err)
+			}
+			if tasks := lease(); len(tasks) != 0 {
+				t.Fatalf("lease during backoff: got %v, want nothing", tasks)
+			}
+			time.Sleep(20 * time.Millisecond)
+			tasks = lease()
+			if len(tasks) != 1 || tasks[0].Attempts != 2 || tasks[0].LastError != "oops" {
+				t.Fatalf("lease after backoff: got %v, want one second attempt", tasks)
+			}
+
+			// After its last attempt expires, the task is dead-lettered.
+			time.Sleep(20 * time.Millisecond)
+			if tasks := lease(); len(tasks) != 0 {
+				t.Fatalf("lease after last attempt: got %v, want nothing", tasks)
+			}
+			dead, err := s.DeadLetters(ctx, "q")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dead) != 1 || dead[0].ID != id || dead[0].LastError != "lease expired" {
+				t.Fatalf("dead letters: got %v, want the task", dead)
+			}
+
+			// A requeued task gets a fresh set of attempts.
+			if err := s.Requeue(ctx, "q", []uint64{id}); err != nil {
+				t.Fatal(err)
+			}
+			tasks = lease()
+			if len(tasks) != 1 || tasks[0].Attempts != 1 {
+				t.Fatalf("lease after requeue: got %v, want one first attempt", tasks)
+			}
+			if err := s.Ack(ctx, "q", []uint64{id}); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(20 * time.Millisecond)
+			if tasks := lease(); len(tasks) != 0 {
+				t.Fatalf("lease after ack: got %v, want nothing", tasks)
+			}
+		})
+	}
+}
+
+func TestQueueWork(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			s := weavertest.InitComponent[Server](t, weavertest.Options{
+				SingleProcess: single,
+				Replicas:      1,
+				Config: `
+["github.com/ServiceWeaver/weaver/queue/Server"]
+min_backoff = "1ms"
+`,
+			})
+			q := New[int](s, "numbers")
+			for i := 0; i < 5; i++ {
+				if err := q.Enqueue(ctx, i); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var mu sync.Mutex
+			var got []int
+			failed := false
+			var wg sync.WaitGroup
+			for i := 0; i < 2; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					q.Work(ctx, func(_ context.Context, n int) error {
+						mu.Lock()
+						defer mu.Unlock()
+						if n == 3 && !failed {
+							// Fail once, to force a retry.
+							failed = true
+							return errors.New("injected failure")
+						}
+						got = append(got, n)
+						return nil
+					})
+				}()
+			}
+
+			want := []int{0, 1, 2, 3, 4}
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				mu.Lock()
+				diff := cmp.Diff(want, got, cmpopts.SortSlices(func(a, b int) bool { return a < b }))
+				mu.Unlock()
+				if diff == "" {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("executed tasks (-want +got):\n%s", diff)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			cancel()
+			wg.Wait()
+		})
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := uint64(1); id <= 3; id++ {
+		if err := store.Put(ctx, "a/b", Task{ID: id, Data: []byte{byte(id)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Put(ctx, "a/b", Task{ID: 2, Data: []byte{2}, Attempts: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "a/b", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash while writing a record.
+	filename := filepath.Join(dir, "a%2Fb.jsonl")
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"put":{"ID":4`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := store.Put(ctx, "a/b", Task{ID: 5, Dead: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Task{
+		{ID: 2, Data: []byte{2}, Attempts: 1},
+		{ID: 3, Data: []byte{3}},
+		{ID: 5, Dead: true},
+	}
+	for i := 0; i < 2; i++ {
+		// The second load reads the compacted log.
+		got, err := store.Load(ctx, "a/b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(got, func(i, j int) bool { return got[i].ID < got[j].ID })
+		if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(Task{})); diff != "" {
+			t.Fatalf("load %d (-want +got):\n%s", i, diff)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// A Store persists the tasks of queues. A Store must be safe for concurrent
+// use.
+type Store interface {
+	// Load returns the tasks of the provided queue, including its dead
+	// letters.
+	Load(ctx context.Context, queue string) ([]Task, error)
+
+	// Put inserts or replaces the task with the same id in the queue. When
+	// Put returns successfully, the task must be durable.
+	Put(ctx context.Context, queue string, task Task) error
+
+	// Delete removes the task with the provided id from the queue, if it
+	// exists.
+	Delete(ctx context.Context, queue string, id uint64) error
+}
+
+// RegisterStore registers a store that a Server can use by setting the store
+// field of its config to the provided name. Stores should be registered in
+// init functions, so that they are available when the Server is created.
+//
+// RegisterStore panics if a store is already registered with the name, or if
+// the name is "memory" or "file".
+func RegisterStore(name string, store Store) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if _, ok := stores[name]; ok || name == "memory" || name == "file" {
+		panic(fmt.Sprintf("queue store %q already registered", name))
+	}
+	stores[name] = store
+}
+
+var (
+	storesMu sync.Mutex
+	stores   = map[string]Store{}
+)
+
+// lookupStore returns the store registered with the provided name, or nil.
+func lookupStore(name string) Store {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	return stores[name]
+}
+
+// memoryStore is a Store that keeps tasks in memory.
+type memoryStore struct {
+	mu     sync.Mutex
+	queues map[string]map[uint64]Task
+}
+
+var _ Store = &memoryStore{}
+
+// NewMemoryStore returns a Store that keeps tasks in memory. Tasks are lost
+// when the process exits.
+func NewMemoryStore() Store {
+	return &memoryStore{queues: map[string]map[uint64]Task{}}
+}
+
+// Load implements the Store interface.
+func (m *memoryStore) Load(_ context.Context, queue string) ([]Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tasks []Task
+	for _, t := range m.queues[queue] {
+		tasks = append(tasks, t)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+// Put implements the Store interface.
+func (m *memoryStore) Put(_ context.Context, queue string, task Task) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.queues[queue]; !ok {
+		m.queues[queue] = map[uint64]Task{}
+	}
+	m.queues[queue][task.ID] = task
+	return nil
+}
+
+// Delete implements the Store interface.
+func (m *memoryStore) Delete(_ context.Context, queue string, id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.queues[queue], id)
+	return nil
+}
+
+// fileStore is a Store that keeps every queue in a log file, with one
+// JSON-encoded record per line. The log is compacted when it is loaded.
+type fileStore struct {
+	dir string
+	mu  sync.Mutex // serializes writes
+}
+
+var _ Store = &fileStore{}
+
+// record is a line in the log of a queue.
+type record struct {
+	Put    *Task  `json:"put,omitempty"`
+	Delete uint64 `json:"delete,omitempty"`
+}
+
+// NewFileStore returns a Store that keeps tasks in files under the provided
+// directory, creating the directory if needed. Tasks survive process
+// restarts, but not the loss of the machine or disk.
+func NewFileStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (f *fileStore) path(queue string) string {
+	return filepath.Join(f.dir, url.PathEscape(queue)+".jsonl")
+}
+
+// Load implements the Store interface.
+func (f *fileStore) Load(_ context.Context, queue string) ([]Task, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	filename := f.path(queue)
+	file, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	live := map[uint64]Task{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// A line is incomplete if the process crashed while writing it.
+			// The record wasn't durable, so it is ignored.
+			continue
+		}
+		if r.Put != nil {
+			live[r.Put.ID] = *r.Put
+		} else {
+			delete(live, r.Delete)
+		}
+	}
+	file.Close()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	tasks := make([]Task, 0, len(live))
+	for _, t := range live {
+		tasks = append(tasks, t)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+
+	// Compact the log, replacing it atomically.
+	tmp := filename + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(out)
+	for i := range tasks {
+		line, err := json.Marshal(record{Put: &tasks[i]})
+		if err != nil {
+			out.Close()
+			return nil, err
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Put implements the Store interface.
+func (f *fileStore) Put(_ context.Context, queue string, task Task) error {
+	return f.append(queue, record{Put: &task})
+}
+
+// Delete implements the Store interface.
+func (f *fileStore) Delete(_ context.Context, queue string, id uint64) error {
+	return f.append(queue, record{Delete: id})
+}
+
+func (f *fileStore) append(queue string, r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.path(queue), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if info, err := file.Stat(); err != nil {
+		file.Close()
+		return err
+	} else if info.Size() > 0 {
+		// If the process crashed while writing the last line, terminate the
+		// incomplete line, so that it doesn't corrupt the new one.
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+			file.Close()
+			return err
+		}
+		if last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
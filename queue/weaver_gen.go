@@ -0,0 +1,820 @@
+package queue
+
+// Code generated by "weaver generate". DO NOT EDIT.
+import (
+	"context"
+	"fmt"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"reflect"
+	"time"
+)
+
+func init() {
+	codegen.Register(codegen.Registration{
+		Name:        "github.com/ServiceWeaver/weaver/queue/Server",
+		Iface:       reflect.TypeOf((*Server)(nil)).Elem(),
+		New:         func() any { return &server{} },
+		ConfigFn:    func(i any) any { return i.(*server).WithConfig.Config() },
+		Routed:      true,
+		Router:      reflect.TypeOf((*server_router)(nil)).Elem(),
+		LocalStubFn: func(impl any, tracer trace.Tracer) any { return server_local_stub{impl: impl.(Server), tracer: tracer} },
+		ClientStubFn: func(stub codegen.Stub, caller string) any {
+			return server_client_stub{stub: stub, enqueueMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/queue/Server", Method: "Enqueue"}), leaseMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/queue/Server", Method: "Lease"}), ackMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/queue/Server", Method: "Ack"}), failMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/queue/Server", Method: "Fail"}), deadLettersMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/queue/Server", Method: "DeadLetters"}), requeueMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/queue/Server", Method: "Requeue"})}
+		},
+		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
+			return server_server_stub{impl: impl.(Server), addLoad: addLoad}
+		},
+		ParamNames: map[string][]string{"Enqueue": {"queue", "data"}, "Lease": {"queue", "max"}, "Ack": {"queue", "ids"}, "Fail": {"queue", "id", "reason"}, "DeadLetters": {"queue"}, "Requeue": {"queue", "ids"}},
+	})
+}
+
+// Local stub implementations.
+
+type server_local_stub struct {
+	impl   Server
+	tracer trace.Tracer
+}
+
+func (s server_local_stub) Enqueue(ctx context.Context, a0 string, a1 []byte) (r0 uint64, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "queue.Server.Enqueue", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.Enqueue(ctx, a0, a1)
+}
+
+func (s server_local_stub) Lease(ctx context.Context, a0 string, a1 int) (r0 []Task, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "queue.Server.Lease", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.Lease(ctx, a0, a1)
+}
+
+func (s server_local_stub) Ack(ctx context.Context, a0 string, a1 []uint64) (err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "queue.Server.Ack", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.Ack(ctx, a0, a1)
+}
+
+func (s server_local_stub) Fail(ctx context.Context, a0 string, a1 uint64, a2 string) (err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "queue.Server.Fail", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.Fail(ctx, a0, a1, a2)
+}
+
+func (s server_local_stub) DeadLetters(ctx context.Context, a0 string) (r0 []Task, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "queue.Server.DeadLetters", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.DeadLetters(ctx, a0)
+}
+
+func (s server_local_stub) Requeue(ctx context.Context, a0 string, a1 []uint64) (err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "queue.Server.Requeue", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.Requeue(ctx, a0, a1)
+}
+
+// Client stub implementations.
+
+type server_client_stub struct {
+	stub               codegen.Stub
+	enqueueMetrics     *codegen.MethodMetrics
+	leaseMetrics       *codegen.MethodMetrics
+	ackMetrics         *codegen.MethodMetrics
+	failMetrics        *codegen.MethodMetrics
+	deadLettersMetrics *codegen.MethodMetrics
+	requeueMetrics     *codegen.MethodMetrics
+}
+
+func (s server_client_stub) Enqueue(ctx context.Context, a0 string, a1 []byte) (r0 uint64, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.enqueueMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "queue.Server.Enqueue", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += (4 + (len(a1) * 1))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	serviceweaver_enc_slice_byte_87461245(enc, a1)
+
+	// Set the shardKey.
+	shardKey := _hashServer(_routerServer().Enqueue(ctx, a0, a1))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 2, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = dec.Uint64()
+	err = dec.Error()
+	return
+}
+
+func (s server_client_stub) Lease(ctx context.Context, a0 string, a1 int) (r0 []Task, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.leaseMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "queue.Server.Lease", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += 8
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	enc.Int(a1)
+
+	// Set the shardKey.
+	shardKey := _hashServer(_routerServer().Lease(ctx, a0, a1))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 4, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = serviceweaver_dec_slice_Task_8224ae8b(dec)
+	err = dec.Error()
+	return
+}
+
+func (s server_client_stub) Ack(ctx context.Context, a0 string, a1 []uint64) (err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.ackMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "queue.Server.Ack", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += (4 + (len(a1) * 8))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	serviceweaver_enc_slice_uint64_489cb07a(enc, a1)
+
+	// Set the shardKey.
+	shardKey := _hashServer(_routerServer().Ack(ctx, a0, a1))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	err = dec.Error()
+	return
+}
+
+func (s server_client_stub) Fail(ctx context.Context, a0 string, a1 uint64, a2 string) (err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.failMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "queue.Server.Fail", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += 8
+	size += (4 + len(a2))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	enc.Uint64(a1)
+	enc.String(a2)
+
+	// Set the shardKey.
+	shardKey := _hashServer(_routerServer().Fail(ctx, a0, a1, a2))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 3, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	err = dec.Error()
+	return
+}
+
+func (s server_client_stub) DeadLetters(ctx context.Context, a0 string) (r0 []Task, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.deadLettersMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "queue.Server.DeadLetters", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+
+	// Set the shardKey.
+	shardKey := _hashServer(_routerServer().DeadLetters(ctx, a0))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 1, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = serviceweaver_dec_slice_Task_8224ae8b(dec)
+	err = dec.Error()
+	return
+}
+
+func (s server_client_stub) Requeue(ctx context.Context, a0 string, a1 []uint64) (err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.requeueMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "queue.Server.Requeue", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += (4 + len(a0))
+	size += (4 + (len(a1) * 8))
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.String(a0)
+	serviceweaver_enc_slice_uint64_489cb07a(enc, a1)
+
+	// Set the shardKey.
+	shardKey := _hashServer(_routerServer().Requeue(ctx, a0, a1))
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 5, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	err = dec.Error()
+	return
+}
+
+// Server stub implementations.
+
+type server_server_stub struct {
+	impl    Server
+	addLoad func(key uint64, load float64)
+}
+
+// GetStubFn implements the stub.Server interface.
+func (s server_server_stub) GetStubFn(method string) func(ctx context.Context, args []byte) ([]byte, error) {
+	switch method {
+	case "Enqueue":
+		return s.enqueue
+	case "Lease":
+		return s.lease
+	case "Ack":
+		return s.ack
+	case "Fail":
+		return s.fail
+	case "DeadLetters":
+		return s.deadLetters
+	case "Requeue":
+		return s.requeue
+	default:
+		return nil
+	}
+}
+
+func (s server_server_stub) enqueue(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 []byte
+	a1 = serviceweaver_dec_slice_byte_87461245(dec)
+	s.addLoad(_hashServer(_routerServer().Enqueue(ctx, a0, a1)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, appErr := s.impl.Enqueue(ctx, a0, a1)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += 8
+	enc.Reset(size)
+	enc.Uint64(r0)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s server_server_stub) lease(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 int
+	a1 = dec.Int()
+	s.addLoad(_hashServer(_routerServer().Lease(ctx, a0, a1)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, appErr := s.impl.Lease(ctx, a0, a1)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	serviceweaver_enc_slice_Task_8224ae8b(enc, r0)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s server_server_stub) ack(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 []uint64
+	a1 = serviceweaver_dec_slice_uint64_489cb07a(dec)
+	s.addLoad(_hashServer(_routerServer().Ack(ctx, a0, a1)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	appErr := s.impl.Ack(ctx, a0, a1)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s server_server_stub) fail(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 uint64
+	a1 = dec.Uint64()
+	var a2 string
+	a2 = dec.String()
+	s.addLoad(_hashServer(_routerServer().Fail(ctx, a0, a1, a2)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	appErr := s.impl.Fail(ctx, a0, a1, a2)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s server_server_stub) deadLetters(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	s.addLoad(_hashServer(_routerServer().DeadLetters(ctx, a0)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, appErr := s.impl.DeadLetters(ctx, a0)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	serviceweaver_enc_slice_Task_8224ae8b(enc, r0)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+func (s server_server_stub) requeue(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 string
+	a0 = dec.String()
+	var a1 []uint64
+	a1 = serviceweaver_dec_slice_uint64_489cb07a(dec)
+	s.addLoad(_hashServer(_routerServer().Requeue(ctx, a0, a1)), 1.0)
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	appErr := s.impl.Requeue(ctx, a0, a1)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
+// AutoMarshal implementations.
+
+var _ codegen.AutoMarshal = &Task{}
+
+func (x *Task) WeaverMarshal(enc *codegen.Encoder) {
+	if x == nil {
+		panic(fmt.Errorf("Task.WeaverMarshal: nil receiver"))
+	}
+	enc.Uint64(x.ID)
+	serviceweaver_enc_slice_byte_87461245(enc, x.Data)
+	enc.Int(x.Attempts)
+	enc.String(x.LastError)
+	enc.Int64(x.ReadyAt)
+	enc.Bool(x.Dead)
+}
+
+func (x *Task) WeaverUnmarshal(dec *codegen.Decoder) {
+	if x == nil {
+		panic(fmt.Errorf("Task.WeaverUnmarshal: nil receiver"))
+	}
+	x.ID = dec.Uint64()
+	x.Data = serviceweaver_dec_slice_byte_87461245(dec)
+	x.Attempts = dec.Int()
+	x.LastError = dec.String()
+	x.ReadyAt = dec.Int64()
+	x.Dead = dec.Bool()
+}
+
+func serviceweaver_enc_slice_byte_87461245(enc *codegen.Encoder, arg []byte) {
+	enc.Bytes(arg)
+}
+
+func serviceweaver_dec_slice_byte_87461245(dec *codegen.Decoder) []byte {
+	return dec.Bytes()
+}
+
+func init() {
+	codegen.RegisterSerializable[Task]()
+}
+
+// Router methods.
+
+// server_router holds the routing methods of the Server component.
+type server_router interface {
+	Enqueue(ctx context.Context, a0 string, a1 []byte) string
+	Lease(ctx context.Context, a0 string, a1 int) string
+	Ack(ctx context.Context, a0 string, a1 []uint64) string
+	Fail(ctx context.Context, a0 string, a1 uint64, a2 string) string
+	DeadLetters(ctx context.Context, a0 string) string
+	Requeue(ctx context.Context, a0 string, a1 []uint64) string
+}
+
+// _routerServer returns the router installed for the Server component.
+func _routerServer() server_router {
+	if r, ok := codegen.Router("github.com/ServiceWeaver/weaver/queue/Server").(server_router); ok {
+		return r
+	}
+	return new(router)
+}
+
+// _hashServer returns a 64 bit hash of the provided value.
+func _hashServer(r string) uint64 {
+	var h codegen.Hasher
+	h.WriteString(string(r))
+	return h.Sum64()
+}
+
+// _orderedCodeServer returns an order-preserving serialization of the provided value.
+func _orderedCodeServer(r string) codegen.OrderedCode {
+	var enc codegen.OrderedEncoder
+	enc.WriteString(string(r))
+	return enc.Encode()
+}
+
+// Encoding/decoding implementations.
+
+func serviceweaver_enc_slice_uint64_489cb07a(enc *codegen.Encoder, arg []uint64) {
+	if arg == nil {
+		enc.Len(-1)
+		return
+	}
+	enc.Len(len(arg))
+	for i := 0; i < len(arg); i++ {
+		enc.Uint64(arg[i])
+	}
+}
+
+func serviceweaver_dec_slice_uint64_489cb07a(dec *codegen.Decoder) []uint64 {
+	n := dec.Len()
+	if n == -1 {
+		return nil
+	}
+	res := make([]uint64, n)
+	for i := 0; i < n; i++ {
+		res[i] = dec.Uint64()
+	}
+	return res
+}
+
+func serviceweaver_enc_slice_Task_8224ae8b(enc *codegen.Encoder, arg []Task) {
+	if arg == nil {
+		enc.Len(-1)
+		return
+	}
+	enc.Len(len(arg))
+	for i := 0; i < len(arg); i++ {
+		(arg[i]).WeaverMarshal(enc)
+	}
+}
+
+func serviceweaver_dec_slice_Task_8224ae8b(dec *codegen.Decoder) []Task {
+	n := dec.Len()
+	if n == -1 {
+		return nil
+	}
+	res := make([]Task, n)
+	for i := 0; i < n; i++ {
+		(&res[i]).WeaverUnmarshal(dec)
+	}
+	return res
+}
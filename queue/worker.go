@@ -0,0 +1,88 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// pollInterval is how long Work waits before leasing again from a queue that
+// had no ready tasks.
+const pollInterval = 100 * time.Millisecond
+
+// Queue is a typed handle to a queue of a Server. Tasks are encoded as JSON,
+// so T must be JSON-serializable.
+type Queue[T any] struct {
+	server Server
+	name   string
+}
+
+// New returns a handle to the queue with the provided name.
+func New[T any](server Server, name string) Queue[T] {
+	return Queue[T]{server: server, name: name}
+}
+
+// Name returns the name of the queue.
+func (q Queue[T]) Name() string {
+	return q.name
+}
+
+// Enqueue adds task to the queue.
+func (q Queue[T]) Enqueue(ctx context.Context, task T) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	_, err = q.server.Enqueue(ctx, q.name, data)
+	return err
+}
+
+// Work repeatedly leases tasks from the queue and passes them to handler, one
+// at a time, until ctx is canceled. A task is acknowledged if the handler
+// returns nil, and is retried or dead-lettered otherwise. Tasks that cannot
+// be decoded are failed. To execute tasks concurrently, call Work from
+// multiple goroutines.
+//
+// Work returns ctx.Err() when ctx is canceled. Errors returned by the server
+// are retried.
+func (q Queue[T]) Work(ctx context.Context, handler func(context.Context, T) error) error {
+	for ctx.Err() == nil {
+		tasks, err := q.server.Lease(ctx, q.name, 1)
+		if err == nil && len(tasks) > 0 {
+			t := tasks[0]
+			var task T
+			if err := json.Unmarshal(t.Data, &task); err != nil {
+				q.server.Fail(ctx, q.name, t.ID, "decode: "+err.Error())
+			} else if err := handler(ctx, task); err != nil {
+				// If the failure can't be reported, the task is retried
+				// when its lease expires.
+				q.server.Fail(ctx, q.name, t.ID, err.Error())
+			} else {
+				// If the ack fails, the task is retried.
+				q.server.Ack(ctx, q.name, []uint64{t.ID})
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+	return ctx.Err()
+}
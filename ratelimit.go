@@ -0,0 +1,191 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/metrics"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+)
+
+// maxRateLimitBuckets is the number of token buckets of a keyed rate limiter
+// above which full buckets are discarded. A full bucket is identical to a new
+// one, so discarding it doesn't change which calls are allowed.
+const maxRateLimitBuckets = 10000
+
+type rateLimitLabels struct {
+	Component string // full callee component name
+	Method    string // callee component method
+}
+
+var rateLimitedCalls = metrics.NewCounterMap[rateLimitLabels](
+	"serviceweaver_method_rate_limited_count",
+	"Count of Service Weaver component method invocations rejected because they exceeded the rate limit of the method",
+)
+
+// tokenBucket is a token bucket of a rateLimiter.
+type tokenBucket struct {
+	tokens float64   // tokens in the bucket at time last
+	last   time.Time // when tokens was last updated
+}
+
+// rateLimiter caps the rate of the calls to a component method. See
+// runtime.RateLimitPolicy for details.
+type rateLimiter struct {
+	component string
+	method    string
+	rate      float64 // tokens added per second
+	burst     float64 // capacity of every bucket
+	key       string  // see runtime.RateLimitPolicy.Key
+	now       func() time.Time
+	rejected  *metrics.Counter
+
+	mu      sync.Mutex
+	buckets map[uint64]*tokenBucket // by key
+}
+
+// newRateLimiters returns the rate limiters of the methods of the provided
+// component, indexed like the methods of the component interface, or nil if
+// none of the methods is rate limited.
+func newRateLimiters(c *component) []*rateLimiter {
+	if len(c.settings.MethodRateLimits) == 0 {
+		return nil
+	}
+	n := c.info.Iface.NumMethod()
+	limiters := make([]*rateLimiter, n)
+	for i := 0; i < n; i++ {
+		method := c.info.Iface.Method(i).Name
+		if policy, ok := c.settings.MethodRateLimits[method]; ok {
+			limiters[i] = newRateLimiter(c.info.Name, method, policy)
+		}
+	}
+	return limiters
+}
+
+// newRateLimiter returns a rate limiter for the calls to the provided method.
+func newRateLimiter(component, method string, policy runtime.RateLimitPolicy) *rateLimiter {
+	burst := float64(policy.Burst)
+	if burst == 0 {
+		burst = math.Ceil(policy.Rate)
+	}
+	return &rateLimiter{
+		component: component,
+		method:    method,
+		rate:      policy.Rate,
+		burst:     burst,
+		key:       policy.Key,
+		now:       time.Now,
+		rejected:  rateLimitedCalls.Get(rateLimitLabels{Component: component, Method: method}),
+		buckets:   map[uint64]*tokenBucket{},
+	}
+}
+
+// keyOf returns the key of the call handled with the provided context.
+func (l *rateLimiter) keyOf(ctx context.Context) uint64 {
+	switch l.key {
+	case runtime.RateLimitByRoutingKey:
+		return call.ShardKey(ctx)
+	case runtime.RateLimitByCaller:
+		return call.Caller(ctx)
+	default:
+		return 0
+	}
+}
+
+// allow returns nil if a call with the provided key may be executed, and
+// otherwise an error that wraps ErrRateLimited.
+func (l *rateLimiter) allow(key uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.discardFull(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+	if b.tokens < 1 {
+		l.rejected.Add(1)
+		return fmt.Errorf("%w: %s.%s", ErrRateLimited, logging.ShortenComponent(l.component), l.method)
+	}
+	b.tokens--
+	return nil
+}
+
+// refill adds the tokens accrued since the bucket was last updated.
+// REQUIRES: l.mu is held.
+func (l *rateLimiter) refill(b *tokenBucket, now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+}
+
+// discardFull discards the buckets that are full.
+// REQUIRES: l.mu is held.
+func (l *rateLimiter) discardFull(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// callerKey returns the identifier of the named caller component, sent to the
+// callee with calls (see call.CallOptions.Caller).
+func callerKey(caller string) uint64 {
+	sum := sha256.Sum256([]byte(caller))
+	key := binary.LittleEndian.Uint64(sum[:8])
+	if key == 0 {
+		// Zero means no caller.
+		key = 1
+	}
+	return key
+}
+
+// callerNames returns the full names of all registered components, by their
+// callerKey.
+func callerNames() map[uint64]string {
+	names := map[uint64]string{}
+	for _, reg := range codegen.Registered() {
+		names[callerKey(reg.Name)] = reg.Name
+	}
+	return names
+}
+
+// keysByCaller returns whether the calls to any method of the provided
+// component are rate limited by caller.
+func keysByCaller(c *component) bool {
+	for _, policy := range c.settings.MethodRateLimits {
+		if policy.Key == runtime.RateLimitByCaller {
+			return true
+		}
+	}
+	return false
+}
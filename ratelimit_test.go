@@ -0,0 +1,100 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+)
+
+// newTestRateLimiter returns a rate limiter with the provided policy and a
+// fake clock, which can be advanced with the returned function.
+func newTestRateLimiter(t *testing.T, policy runtime.RateLimitPolicy) (*rateLimiter, func(time.Duration)) {
+	t.Helper()
+	l := newRateLimiter(t.Name(), "Get", policy)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+// allowed returns the number of n calls with the provided key that l allows.
+func allowed(t *testing.T, l *rateLimiter, key uint64, n int) int {
+	t.Helper()
+	var allowed int
+	for i := 0; i < n; i++ {
+		err := l.allow(key)
+		switch {
+		case err == nil:
+			allowed++
+		case !errors.Is(err, ErrRateLimited):
+			t.Fatalf("allow: got %v, want ErrRateLimited", err)
+		}
+	}
+	return allowed
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	l, advance := newTestRateLimiter(t, runtime.RateLimitPolicy{Rate: 10, Burst: 5})
+	if got, want := allowed(t, l, 0, 10), 5; got != want {
+		t.Fatalf("allowed: got %d, want %d", got, want)
+	}
+
+	// Tokens are added at the rate.
+	advance(200 * time.Millisecond)
+	if got, want := allowed(t, l, 0, 10), 2; got != want {
+		t.Fatalf("allowed after 200ms: got %d, want %d", got, want)
+	}
+
+	// The bucket never holds more than the burst.
+	advance(time.Hour)
+	if got, want := allowed(t, l, 0, 10), 5; got != want {
+		t.Fatalf("allowed after 1h: got %d, want %d", got, want)
+	}
+}
+
+func TestRateLimiterDefaultBurst(t *testing.T) {
+	l, _ := newTestRateLimiter(t, runtime.RateLimitPolicy{Rate: 2.5})
+	if got, want := allowed(t, l, 0, 10), 3; got != want {
+		t.Fatalf("allowed: got %d, want %d", got, want)
+	}
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	for _, key := range []string{runtime.RateLimitByRoutingKey, runtime.RateLimitByCaller} {
+		t.Run(key, func(t *testing.T) {
+			l, _ := newTestRateLimiter(t, runtime.RateLimitPolicy{Rate: 1, Burst: 2, Key: key})
+			for _, k := range []uint64{1, 2} {
+				if got, want := allowed(t, l, k, 5), 2; got != want {
+					t.Fatalf("allowed(%d): got %d, want %d", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterDiscardsFullBuckets(t *testing.T) {
+	l, advance := newTestRateLimiter(t, runtime.RateLimitPolicy{Rate: 1, Burst: 1, Key: runtime.RateLimitByCaller})
+	for k := uint64(1); k <= maxRateLimitBuckets; k++ {
+		allowed(t, l, k, 1)
+	}
+	advance(time.Second)
+	allowed(t, l, maxRateLimitBuckets+1, 1)
+	if got, want := len(l.buckets), 1; got != want {
+		t.Fatalf("buckets: got %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/logtype"
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/internal/replay"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/ServiceWeaver/weaver/runtime/recording"
+)
+
+// recordingLog is the recording of the calls executed by a weavelet, opened
+// when first used.
+type recordingLog struct {
+	dir    string               // directory of recordings
+	info   *protos.WeaveletInfo // weavelet that executes the calls
+	logger logtype.Logger
+
+	once   sync.Once
+	writer *recording.Writer // nil if the recording cannot be opened
+}
+
+// get returns the writer of the recording, or nil if the recording cannot be
+// opened.
+func (l *recordingLog) get() *recording.Writer {
+	l.once.Do(func() {
+		file := filepath.Join(l.dir, fmt.Sprintf("%s-%s.recording", l.info.DeploymentId, l.info.Id))
+		w, err := recording.NewWriter(file)
+		if err != nil {
+			l.logger.Error("Opening recording; calls will not be recorded", err)
+			return
+		}
+		l.writer = w
+	})
+	return l.writer
+}
+
+// close closes the recording, if it was opened. Calls recorded after close
+// are dropped.
+func (l *recordingLog) close() {
+	l.once.Do(func() {})
+	if l.writer != nil {
+		l.writer.Close()
+	}
+}
+
+// recorder records the calls to the methods of a component.
+type recorder struct {
+	component string
+	methods   []string          // component methods, by index
+	names     map[uint64]string // full names of all components, by key
+	log       *recordingLog
+	logger    logtype.Logger
+}
+
+// newRecorder returns the recorder of the provided component, or nil if
+// calls are not recorded.
+func newRecorder(c *component, log *recordingLog, logger logtype.Logger) *recorder {
+	if log.dir == "" {
+		return nil
+	}
+	r := &recorder{
+		component: c.info.Name,
+		names:     callerNames(),
+		log:       log,
+		logger:    logger,
+	}
+	for i, n := 0, c.info.Iface.NumMethod(); i < n; i++ {
+		r.methods = append(r.methods, c.info.Iface.Method(i).Name)
+	}
+	return r
+}
+
+// record records a call to the provided method, made by the caller with the
+// provided key, that started at the provided time.
+func (r *recorder) record(method int, caller, shardKey uint64, start time.Time, args, result []byte, err error) {
+	w := r.log.get()
+	if w == nil {
+		return
+	}
+	name, ok := r.names[caller]
+	if !ok {
+		name = "unknown"
+	}
+	c := recording.Call{
+		Start:      start,
+		Deployment: r.log.info.DeploymentId,
+		Weavelet:   r.log.info.Id,
+		Component:  r.component,
+		Method:     r.methods[method],
+		Caller:     name,
+		RoutingKey: shardKey,
+		Args:       args,
+	}
+	if err != nil {
+		c.Error = err.Error()
+	} else {
+		c.Result = result
+	}
+	if err := w.Write(c); err != nil {
+		r.logger.Error("Recording call", err, "component", r.component, "method", r.methods[method])
+	}
+}
+
+// replayConnection is a call.Connection that answers the calls to a component
+// with the results recorded in a recording, instead of executing them.
+type replayConnection struct {
+	component string
+	replayer  *replay.Replayer
+	names     map[call.MethodKey]string // method key -> method name
+}
+
+var _ call.Connection = &replayConnection{}
+
+// newReplayConnection returns a replayConnection for the provided component.
+func newReplayConnection(c *component, replayer *replay.Replayer) *replayConnection {
+	names := map[call.MethodKey]string{}
+	for i, key := range methodKeys(c) {
+		names[key] = c.info.Iface.Method(i).Name
+	}
+	return &replayConnection{component: c.info.Name, replayer: replayer, names: names}
+}
+
+// Call implements the call.Connection interface.
+func (r *replayConnection) Call(_ context.Context, key call.MethodKey, args []byte, _ call.CallOptions) ([]byte, error) {
+	name, ok := r.names[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown method %v", key)
+	}
+	return r.replayer.Reply(r.component, name, args)
+}
+
+// Close implements the call.Connection interface.
+func (r *replayConnection) Close() {}
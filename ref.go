@@ -0,0 +1,86 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"reflect"
+	"sync"
+)
+
+// LazyRef is a reference to the component of type T that is resolved, by
+// calling Get, the first time it is used. Unlike Get, Lazy doesn't create the
+// component, so a component that is rarely used, or only used in some
+// configurations, isn't started until it is needed. For example:
+//
+//	type server struct {
+//	    weaver.Implements[Server]
+//	    exporter *weaver.LazyRef[Exporter]
+//	}
+//
+//	func (s *server) Init(context.Context) error {
+//	    s.exporter = weaver.Lazy[Exporter](s)
+//	    return nil
+//	}
+//
+//	func (s *server) Export(ctx context.Context, data []byte) error {
+//	    exporter, err := s.exporter.Get()
+//	    if err != nil {
+//	        return err
+//	    }
+//	    return exporter.Export(ctx, data)
+//	}
+type LazyRef[T any] struct {
+	requester Instance
+	once      sync.Once
+	value     T
+	err       error
+}
+
+// Lazy returns a lazy reference to the component of type T. See LazyRef.
+func Lazy[T any](requester Instance) *LazyRef[T] {
+	return &LazyRef[T]{requester: requester}
+}
+
+// Get returns the component of type T, creating it if necessary. Get returns
+// the same component, or error, every time it is called.
+func (r *LazyRef[T]) Get() (T, error) {
+	r.once.Do(func() { r.value, r.err = Get[T](r.requester) })
+	return r.value, r.err
+}
+
+// OptionalRef is a LazyRef to a component of type T that may not be linked
+// into the application binary, e.g., a plugin that is only linked into some
+// builds of the application. See Optional.
+type OptionalRef[T any] struct {
+	ref LazyRef[T]
+}
+
+// Optional returns a lazy reference to the component of type T, which may
+// not be linked into the application binary.
+func Optional[T any](requester Instance) *OptionalRef[T] {
+	return &OptionalRef[T]{ref: LazyRef[T]{requester: requester}}
+}
+
+// Get returns the component of type T, creating it if necessary, and true,
+// or false if the component is not linked into the application binary.
+func (r *OptionalRef[T]) Get() (T, bool, error) {
+	var zero T
+	rep := r.ref.requester.rep()
+	if _, ok := rep.wlet.componentsByType[reflect.TypeOf(&zero).Elem()]; !ok {
+		return zero, false, nil
+	}
+	value, err := r.ref.Get()
+	return value, true, err
+}
@@ -17,7 +17,9 @@ package weaver
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
 	"sync"
 
 	"github.com/ServiceWeaver/weaver/internal/envelope/conn"
@@ -203,25 +205,66 @@ func (e *remoteEnv) CreateTraceExporter() (sdktrace.SpanExporter, error) {
 	return traceio.NewWriter(e.conn.SendTraceSpans), nil
 }
 
+// ElectLeader implements the Env interface.
+func (e *remoteEnv) ElectLeader(_ context.Context, req *protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error) {
+	return e.conn.ElectLeaderRPC(req)
+}
+
+// OnConfigUpdate implements the Env interface.
+func (e *remoteEnv) OnConfigUpdate(f func(sections map[string]string) error) {
+	e.conn.OnConfigUpdate(f)
+}
+
 // parseEndpoints parses a list of endpoint addresses into a list of
-// call.Endpoints.
-func parseEndpoints(addrs []string) ([]call.Endpoint, error) {
+// call.Endpoints. Endpoints on this machine are reached through the Unix
+// sockets in sockets, if any.
+func parseEndpoints(addrs []string, sockets hostSockets) ([]call.Endpoint, error) {
 	var endpoints []call.Endpoint
 	for _, addr := range addrs {
 		endpoint, err := parseEndpoint(addr)
 		if err != nil {
 			return nil, err
 		}
-		endpoints = append(endpoints, endpoint)
+		endpoints = append(endpoints, sockets.endpoint(endpoint))
 	}
 	return endpoints, nil
 }
 
-// parseEndpoint parses an endpoint address into a call.Endpoint.
-func parseEndpoint(endpoint string) (call.Endpoint, error) {
+// parseEndpoint parses an endpoint address into a call.NetEndpoint.
+func parseEndpoint(endpoint string) (call.NetEndpoint, error) {
 	net, addr, err := call.NetworkAddress(endpoint).Split()
 	if err != nil {
-		return nil, fmt.Errorf("bad endpoint %q: %w", endpoint, err)
+		return call.NetEndpoint{}, fmt.Errorf("bad endpoint %q: %w", endpoint, err)
+	}
+	return call.NetEndpoint{Net: net, Addr: addr, Locality: call.NetworkAddress(endpoint).Locality()}, nil
+}
+
+// hostSockets names the Unix sockets on which the weavelets of a deployment
+// that run on this machine serve their external traffic, alongside TCP. Calls
+// to a weavelet on the same machine use its Unix socket rather than the
+// loopback TCP stack. The zero value disables Unix sockets.
+type hostSockets struct {
+	host   string // host of this machine's TCP addresses, e.g., "10.0.0.1"
+	dir    string // directory holding the sockets
+	prefix string // socket filename prefix unique to the deployment
+}
+
+// path returns the Unix socket for the weavelet listening on the provided TCP
+// port of this machine.
+func (h hostSockets) path(port string) string {
+	return filepath.Join(h.dir, fmt.Sprintf("%s.port%s", h.prefix, port))
+}
+
+// endpoint returns the provided endpoint, with its Socket set if it is a TCP
+// endpoint on this machine.
+func (h hostSockets) endpoint(e call.NetEndpoint) call.NetEndpoint {
+	if h.host == "" || e.Net != "tcp" {
+		return e
+	}
+	host, port, err := net.SplitHostPort(e.Addr)
+	if err != nil || host != h.host {
+		return e
 	}
-	return call.NetEndpoint{Net: net, Addr: addr}, nil
+	e.Socket = h.path(port)
+	return e
 }
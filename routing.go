@@ -38,7 +38,8 @@ import (
 // routelet maintains the latest routing information for a process by
 // communicating with the manager.
 type routelet struct {
-	env env
+	env     env
+	sockets hostSockets // Unix sockets of weavelets on this machine
 
 	mu          sync.Mutex                  // guards the following fields
 	routingInfo *protos.RoutingInfo         // latest routing info from assigner
@@ -50,8 +51,9 @@ type routelet struct {
 // newRoutelet returns a new routelet for the provided process. The lifetime of
 // the routelet is bound to the provided context. When the context is
 // cancelled, the routelet stops tracking the latest routing information.
-func newRoutelet(ctx context.Context, env env, process string) *routelet {
-	r := &routelet{env: env, balancers: map[string]*routingBalancer{}}
+// Replicas on this machine are reached through the Unix sockets in sockets.
+func newRoutelet(ctx context.Context, env env, process string, sockets hostSockets) *routelet {
+	r := &routelet{env: env, sockets: sockets, balancers: map[string]*routingBalancer{}}
 	go r.watchRoutingInfo(ctx, env, process)
 	return r
 }
@@ -80,7 +82,7 @@ func (r *routelet) balancer(component string) call.Balancer {
 	}
 
 	// Register the balancer.
-	balancer = &routingBalancer{balancer: call.RoundRobin()}
+	balancer = &routingBalancer{balancer: call.RoundRobin(), sockets: r.sockets}
 	r.balancers[component] = balancer
 
 	// Update the balancer with its initial assignment, if any.
@@ -96,6 +98,16 @@ func (r *routelet) balancer(component string) call.Balancer {
 	return balancer
 }
 
+// replicas returns the addresses of the replicas in the latest routing info.
+func (r *routelet) replicas() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.routingInfo == nil {
+		return nil
+	}
+	return r.routingInfo.Replicas
+}
+
 // onChange registers a callback that is invoked every time the routing info
 // changes.
 func (r *routelet) onChange(callback func(*protos.RoutingInfo)) {
@@ -138,7 +150,7 @@ func (r *routelet) update(routingInfo *protos.RoutingInfo, version *call.Version
 
 	// Update resolver.
 	if r.res != nil {
-		endpoints, err := parseEndpoints(routingInfo.Replicas)
+		endpoints, err := parseEndpoints(routingInfo.Replicas, r.sockets)
 		if err != nil {
 			return err
 		}
@@ -167,6 +179,7 @@ func (r *routelet) update(routingInfo *protos.RoutingInfo, version *call.Version
 // not interact with routingBalancer directly and instead use a routelet.
 type routingBalancer struct {
 	balancer call.Balancer // default balancer
+	sockets  hostSockets   // Unix sockets of weavelets on this machine
 
 	mu         sync.RWMutex
 	assignment *protos.Assignment
@@ -222,7 +235,7 @@ func (rb *routingBalancer) Pick(opts call.CallOptions) (call.Endpoint, error) {
 	// TODO(mwhittaker): Parse the endpoints when an assignment is received,
 	// rather than once per call.
 	addr := slice.replicas[rand.Intn(len(slice.replicas))]
-	endpoints, err := parseEndpoints([]string{addr})
+	endpoints, err := parseEndpoints([]string{addr}, rb.sockets)
 	if err != nil {
 		return nil, err
 	}
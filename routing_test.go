@@ -234,3 +234,36 @@ func TestRoutingResolverUpdate(t *testing.T) {
 		t.Fatalf("version: got %v, want %v", version, &v1)
 	}
 }
+
+func TestHostSockets(t *testing.T) {
+	sockets := hostSockets{host: "10.0.0.1", dir: "/tmp", prefix: "app.12345678"}
+	for _, test := range []struct {
+		addr   string
+		socket string
+	}{
+		{"tcp://10.0.0.1:9000", "/tmp/app.12345678.port9000"},
+		{"tcp://10.0.0.1:9000#us-west1-a", "/tmp/app.12345678.port9000"},
+		{"tcp://10.0.0.2:9000", ""},
+		{"unix:///tmp/socket", ""},
+	} {
+		t.Run(test.addr, func(t *testing.T) {
+			endpoints, err := parseEndpoints([]string{test.addr}, sockets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			endpoint := endpoints[0].(call.NetEndpoint)
+			if got, want := endpoint.Socket, test.socket; got != want {
+				t.Fatalf("Socket: got %q, want %q", got, want)
+			}
+		})
+	}
+
+	// The zero value disables Unix sockets.
+	endpoints, err := parseEndpoints([]string{"tcp://10.0.0.1:9000"}, hostSockets{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := endpoints[0].(call.NetEndpoint).Socket; got != "" {
+		t.Fatalf("Socket: got %q, want \"\"", got)
+	}
+}
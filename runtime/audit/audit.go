@@ -0,0 +1,142 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit implements tamper-evident audit logs of component method
+// calls.
+//
+// An audit log is a file of JSON entries, one per line. Every entry holds its
+// sequence number and the SHA-256 hash of the previous line, so that
+// modifying, reordering, or removing any entry but the last ones breaks the
+// chain, which Verify detects.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is an entry of an audit log, which records a call to a component
+// method.
+type Entry struct {
+	Seq        int64     `json:"seq"`                   // sequence number, starting at 0
+	Prev       string    `json:"prev"`                  // hex SHA-256 of the previous line, or empty
+	Time       time.Time `json:"time"`                  // when the call finished
+	Deployment string    `json:"deployment"`            // deployment id
+	Weavelet   string    `json:"weavelet"`              // id of the weavelet that executed the call
+	Component  string    `json:"component"`             // full component name
+	Method     string    `json:"method"`                // component method
+	Caller     string    `json:"caller"`                // full caller component name, or "unknown"
+	RoutingKey uint64    `json:"routing_key,omitempty"` // routing key of the call, if routed
+	Error      string    `json:"error,omitempty"`       // error returned by the call, if any
+}
+
+// Writer appends entries to an audit log. It is safe for concurrent use.
+type Writer struct {
+	mu   sync.Mutex
+	f    *os.File
+	seq  int64  // sequence number of the next entry
+	prev string // hash of the last line
+}
+
+// NewWriter returns a writer that appends entries to the audit log in the
+// provided file, creating it if needed. If the file already holds entries,
+// their chain is verified and extended.
+func NewWriter(file string) (*Writer, error) {
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	n, prev, err := verify(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("audit: %s: %w", file, err)
+	}
+	return &Writer{f: f, seq: n, prev: prev}, nil
+}
+
+// Write appends the provided entry to the audit log, overwriting its Seq and
+// Prev fields.
+func (w *Writer) Write(e Entry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e.Seq, e.Prev = w.seq, w.prev
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	// Write the line with a single write, so that a crash can only leave a
+	// truncated last line behind.
+	if _, err := w.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	w.seq++
+	w.prev = hash(line)
+	return nil
+}
+
+// Close closes the audit log.
+func (w *Writer) Close() error {
+	return w.f.Close()
+}
+
+// Verify verifies the chain of the entries of an audit log, and returns the
+// number of entries verified. If the chain is broken, Verify returns an error
+// that identifies the first offending line.
+func Verify(r io.Reader) (int64, error) {
+	n, _, err := verify(r)
+	return n, err
+}
+
+// verify is like Verify, but also returns the hash of the last line.
+func verify(r io.Reader) (int64, string, error) {
+	var n int64
+	var prev string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var e Entry
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&e); err != nil {
+			return n, prev, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		if e.Seq != n {
+			return n, prev, fmt.Errorf("line %d: got sequence number %d, want %d", n+1, e.Seq, n)
+		}
+		if e.Prev != prev {
+			return n, prev, fmt.Errorf("line %d: previous hash mismatch", n+1)
+		}
+		n++
+		prev = hash(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return n, prev, err
+	}
+	return n, prev, nil
+}
+
+// hash returns the hex SHA-256 hash of the provided line.
+func hash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeEntries writes n entries to the audit log in the provided file.
+func writeEntries(t *testing.T, file string, n int) {
+	t.Helper()
+	w, err := NewWriter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for i := 0; i < n; i++ {
+		if err := w.Write(Entry{Component: "PaymentService", Method: "Charge", Caller: "main"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	writeEntries(t, file, 3)
+	// Reopened logs extend the chain.
+	writeEntries(t, file, 2)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := Verify(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("Verify: got %d entries, want 5", n)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	writeEntries(t, file, 3)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+
+	for _, test := range []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"modified", []string{lines[0], strings.Replace(lines[1], "main", "other", 1), lines[2]}, "line 3: previous hash mismatch"},
+		{"removed", []string{lines[0], lines[2]}, "line 2: got sequence number 2, want 1"},
+		{"reordered", []string{lines[1], lines[0], lines[2]}, "line 1: got sequence number 1, want 0"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Verify(strings.NewReader(strings.Join(test.lines, "")))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Verify: got %v, want %q", err, test.want)
+			}
+		})
+	}
+
+	// Tampered logs cannot be extended.
+	tampered := strings.Join([]string{lines[0], lines[2]}, "")
+	if err := os.WriteFile(file, []byte(tampered), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWriter(file); err == nil {
+		t.Fatal("NewWriter: unexpected success on a tampered log")
+	}
+}
@@ -34,6 +34,23 @@ const (
 	// for messages sent from weavelet to envelope is stored. For internal use by
 	// Service Weaver infrastructure.
 	ToEnvelopeKey = "WEAVELET_TO_ENVELOPE_FD"
+
+	// LocalityKey is the environment variable under which the locality (e.g.,
+	// the zone) of a weavelet is stored. Deployers that know where weavelets
+	// run set it, and the "locality" placement policy uses it.
+	LocalityKey = "SERVICEWEAVER_LOCALITY"
+
+	// ListComponentsKey is the environment variable that, if set, makes
+	// [weaver.Init] print the names of the registered components, one per
+	// line, and exit. Deployers use it to learn about the components of an
+	// application binary before deploying it.
+	ListComponentsKey = "SERVICEWEAVER_LIST_COMPONENTS"
+
+	// ComponentGraphKey is the environment variable that, if set, makes
+	// [weaver.Init] print the component graph of the application and exit.
+	// Every line holds the name of a registered component followed by the
+	// names of the components it fetches, all separated by tabs.
+	ComponentGraphKey = "SERVICEWEAVER_COMPONENT_GRAPH"
 )
 
 // Bootstrap holds configuration information used to start a process execution.
@@ -15,7 +15,9 @@
 package codegen
 
 // AutoMarshal is the interface implemented by structs with weaver.AutoMarshal
-// declarations.
+// declarations. Types can also implement it by hand to serialize themselves
+// with a tuned encoding, in which case the code generator calls their methods
+// instead of generating its own, even if they embed weaver.AutoMarshal.
 type AutoMarshal interface {
 	WeaverMarshal(enc *Encoder)
 	WeaverUnmarshal(dec *Decoder)
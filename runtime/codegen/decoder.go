@@ -86,6 +86,15 @@ func (d *Decoder) Read(n int) []byte {
 	return b
 }
 
+// Field decodes the header of a field of a versioned struct, encoded by
+// Encoder.BeginField and Encoder.EndField. It returns the field's number and a
+// decoder for the field's value, and advances the decoder past the value.
+func (d *Decoder) Field() (int, *Decoder) {
+	num := d.Uint32()
+	n := d.Uint32()
+	return int(num), NewDecoder(d.Read(int(n)))
+}
+
 // Uint8 decodes a value of type uint8.
 func (d *Decoder) Uint8() uint8 {
 	return d.Read(1)[0]
@@ -184,7 +193,8 @@ func (d *Decoder) String() string {
 	return string(d.Bytes())
 }
 
-// Bytes decodes a value of type []byte.
+// Bytes decodes a value of type []byte. The returned slice is not a copy: it
+// aliases the data the Decoder was created with.
 func (d *Decoder) Bytes() []byte {
 	n := d.Int32()
 
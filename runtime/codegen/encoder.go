@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sync"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -52,6 +53,31 @@ func NewEncoder() *Encoder {
 	return &enc
 }
 
+// maxPooledSize is the capacity above which the buffer of a released Encoder
+// is dropped rather than pooled, so that a single large call doesn't pin a
+// large buffer for the lifetime of the process.
+const maxPooledSize = 16 << 20
+
+var encoderPool = sync.Pool{New: func() interface{} { return NewEncoder() }}
+
+// NewPooledEncoder returns an Encoder, taken from a pool of encoders, whose
+// buffer has a capacity of at least size. Call Release once the encoded data
+// is no longer needed to return the encoder to the pool.
+func NewPooledEncoder(size int) *Encoder {
+	enc := encoderPool.Get().(*Encoder)
+	enc.Reset(size)
+	return enc
+}
+
+// Release returns an Encoder returned by NewPooledEncoder to the pool. Neither
+// the Encoder nor the data it returned may be used after Release.
+func (e *Encoder) Release() {
+	if cap(e.data) > maxPooledSize {
+		e.data = e.space[:0]
+	}
+	encoderPool.Put(e)
+}
+
 // Reset resets the Encoder to use a buffer with a capacity of at least the
 // provided size. All encoded data is lost.
 func (e *Encoder) Reset(n int) {
@@ -250,6 +276,29 @@ func (e *Encoder) Len(l int) {
 	e.Int32(int32(l))
 }
 
+// BeginField begins the encoding of the field with the provided number of a
+// versioned struct. It returns a value to pass to EndField once the field's
+// value is encoded.
+func (e *Encoder) BeginField(num int) int {
+	if num <= 0 || num > math.MaxUint32 {
+		panic(makeEncodeError("invalid field number %d", num))
+	}
+	e.Uint32(uint32(num))
+	start := len(e.data)
+	e.Uint32(0) // length of the field's value, filled in by EndField
+	return start
+}
+
+// EndField ends the encoding of a field of a versioned struct, begun by
+// BeginField.
+func (e *Encoder) EndField(start int) {
+	n := len(e.data) - start - 4
+	if n > math.MaxUint32 {
+		panic(makeEncodeError("field length can't be represented in 4 bytes"))
+	}
+	binary.LittleEndian.PutUint32(e.data[start:], uint32(n))
+}
+
 // Error encodes an arg of type error. We save enough type information
 // to allow errors.Unwrap() and errors.Is() to work correctly.
 func (e *Encoder) Error(err error) {
@@ -74,6 +74,28 @@ func TestReset(t *testing.T) {
 	}
 }
 
+// TestPooledEncoder tests that pooled encoders are reset, and that released
+// encoders don't hold on to large buffers.
+func TestPooledEncoder(t *testing.T) {
+	for _, n := range []int{0, 10, 100, 1000, 10000} {
+		enc := NewPooledEncoder(n)
+		if got, want := len(enc.Data()), 0; got != want {
+			t.Fatalf("NewPooledEncoder(%d): len(enc.data): got %d, want %d", n, got, want)
+		}
+		if got, want := cap(enc.Data()), n; got < want {
+			t.Fatalf("NewPooledEncoder(%d): cap(enc.data): got %d, want at least %d", n, got, want)
+		}
+		enc.String("this is garbage text that will get reset")
+		enc.Release()
+	}
+
+	enc := NewPooledEncoder(maxPooledSize + 1)
+	enc.Release()
+	if got, want := cap(enc.data), len(enc.space); got != want {
+		t.Fatalf("released large encoder: cap(enc.data): got %d, want %d", got, want)
+	}
+}
+
 // TestEncodeDecode encodes a value and then decodes it. Verify that the value
 // is decoded as expected.
 func TestEncodeDecode(t *testing.T) {
@@ -14,38 +14,91 @@
 
 package codegen
 
-import "github.com/ServiceWeaver/weaver/metrics"
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	weavermetrics "github.com/ServiceWeaver/weaver/metrics"
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
 
 var (
 	// The following metrics are automatically populated for the user.
 	//
 	// TODO(mwhittaker): Allow the user to disable these metrics.
 	// It adds ~169ns of latency per method call.
-	MethodCounts = metrics.NewCounterMap[MethodLabels](
+	//
+	// The bounds of the histograms can be overridden in the application
+	// config. See runtime.MetricsConfig.
+	MethodCounts = metrics.RegisterMap[MethodLabels](
+		protos.MetricType_COUNTER,
 		"serviceweaver_remote_method_count",
 		"Count of Service Weaver component method invocations",
+		nil,
 	)
-	MethodErrors = metrics.NewCounterMap[MethodLabels](
+	MethodErrors = metrics.RegisterMap[MethodLabels](
+		protos.MetricType_COUNTER,
 		"serviceweaver_remote_method_error_count",
 		"Count of Service Weaver component method invocations that result in an error",
+		nil,
 	)
-	MethodLatencies = metrics.NewHistogramMap[MethodLabels](
+	MethodLatencies = metrics.RegisterMapWithUnit[MethodLabels](
+		protos.MetricType_HISTOGRAM,
 		"serviceweaver_remote_method_latency_micros",
 		"Duration, in microseconds, of Service Weaver component method execution",
-		metrics.NonNegativeBuckets,
+		"us",
+		weavermetrics.NonNegativeBuckets,
 	)
-	MethodBytesRequest = metrics.NewHistogramMap[MethodLabels](
+	MethodBytesRequest = metrics.RegisterMapWithUnit[MethodLabels](
+		protos.MetricType_HISTOGRAM,
 		"serviceweaver_remote_method_bytes_request",
 		"Number of bytes in Service Weaver component method requests",
-		metrics.NonNegativeBuckets,
+		"By",
+		weavermetrics.NonNegativeBuckets,
 	)
-	MethodBytesReply = metrics.NewHistogramMap[MethodLabels](
+	MethodBytesReply = metrics.RegisterMapWithUnit[MethodLabels](
+		protos.MetricType_HISTOGRAM,
 		"serviceweaver_remote_method_bytes_reply",
 		"Number of bytes in Service Weaver component method replies",
-		metrics.NonNegativeBuckets,
+		"By",
+		weavermetrics.NonNegativeBuckets,
 	)
 )
 
+// DefaultMethodLabelSets is the default maximum number of distinct sets of
+// user labels recorded for a method. See SetMethodLabelSets.
+const DefaultMethodLabelSets = 100
+
+// OverflowLabelValue replaces the values of the user labels of a method call
+// once the method has reached its maximum number of label sets.
+const OverflowLabelValue = "other"
+
+var (
+	// methodLabelSets is the maximum number of distinct sets of user labels
+	// recorded for a method.
+	methodLabelSets = DefaultMethodLabelSets
+
+	// methodMetrics caches the metrics returned by MethodMetricsFor.
+	methodMetricsMu sync.Mutex
+	methodMetrics   = map[MethodLabels]*MethodMetrics{}
+)
+
+// SetMethodLabelSets sets the maximum number of distinct sets of user labels
+// recorded in the metrics of a method. Once a method reaches the limit, calls
+// with new sets of labels are recorded with the label values replaced by
+// OverflowLabelValue. SetMethodLabelSets should be called before any method
+// call.
+func SetMethodLabelSets(n int) {
+	methodMetricsMu.Lock()
+	defer methodMetricsMu.Unlock()
+	methodLabelSets = n
+}
+
 type MethodLabels struct {
 	Caller    string // full calling component name
 	Component string // full callee component name
@@ -54,20 +107,130 @@ type MethodLabels struct {
 
 // MethodMetrics contains metrics for a single Service Weaver component method.
 type MethodMetrics struct {
-	Count        *metrics.Counter   // See MethodCounts.
-	ErrorCount   *metrics.Counter   // See MethodErrors.
-	Latency      *metrics.Histogram // See MethodLatencies.
-	BytesRequest *metrics.Histogram // See MethodBytesRequest.
-	BytesReply   *metrics.Histogram // See MethodBytesReply.
+	Count        *metrics.Metric // See MethodCounts.
+	ErrorCount   *metrics.Metric // See MethodErrors.
+	Latency      *metrics.Metric // See MethodLatencies.
+	BytesRequest *metrics.Metric // See MethodBytesRequest.
+	BytesReply   *metrics.Metric // See MethodBytesReply.
+
+	labels  MethodLabels
+	mu      sync.Mutex                // guards labeled
+	labeled map[string]*MethodMetrics // metrics with user labels, by labels
 }
 
 // MethodMetricsFor returns metrics for the specified method.
 func MethodMetricsFor(labels MethodLabels) *MethodMetrics {
-	return &MethodMetrics{
+	methodMetricsMu.Lock()
+	defer methodMetricsMu.Unlock()
+	if m, ok := methodMetrics[labels]; ok {
+		return m
+	}
+	m := &MethodMetrics{
 		Count:        MethodCounts.Get(labels),
 		ErrorCount:   MethodErrors.Get(labels),
 		Latency:      MethodLatencies.Get(labels),
 		BytesRequest: MethodBytesRequest.Get(labels),
 		BytesReply:   MethodBytesReply.Get(labels),
+		labels:       labels,
+	}
+	methodMetrics[labels] = m
+	return m
+}
+
+// ForContext returns the metrics for a call of the method made with the
+// provided context. If the context carries user labels (see
+// WithMetricLabels), the returned metrics have these labels in addition to
+// the method labels. Otherwise, ForContext returns m.
+func (m *MethodMetrics) ForContext(ctx context.Context) *MethodMetrics {
+	labels, ok := ctx.Value(metricLabelsKey{}).(*metricLabels)
+	if !ok {
+		return m
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if labeled, ok := m.labeled[labels.key]; ok {
+		return labeled
+	}
+	methodMetricsMu.Lock()
+	limit := methodLabelSets
+	methodMetricsMu.Unlock()
+	extra := labels.kvs
+	if len(m.labeled) >= limit {
+		// Guard against unbounded label cardinality. Calls with new label
+		// sets share the overflow label set with the same label names.
+		extra = make([]string, len(labels.kvs))
+		for i := 0; i < len(extra); i += 2 {
+			extra[i] = labels.kvs[i]
+			extra[i+1] = OverflowLabelValue
+		}
+		overflow := &metricLabels{kvs: extra, key: joinLabels(extra)}
+		if labeled, ok := m.labeled[overflow.key]; ok {
+			return labeled
+		}
+		labels = overflow
+	}
+	labeled := &MethodMetrics{
+		Count:        MethodCounts.GetWithExtraLabels(m.labels, extra),
+		ErrorCount:   MethodErrors.GetWithExtraLabels(m.labels, extra),
+		Latency:      MethodLatencies.GetWithExtraLabels(m.labels, extra),
+		BytesRequest: MethodBytesRequest.GetWithExtraLabels(m.labels, extra),
+		BytesReply:   MethodBytesReply.GetWithExtraLabels(m.labels, extra),
+		labels:       m.labels,
 	}
+	if m.labeled == nil {
+		m.labeled = map[string]*MethodMetrics{}
+	}
+	m.labeled[labels.key] = labeled
+	return labeled
+}
+
+// metricLabelsKey is the context key for the user labels attached to the
+// metrics of method calls.
+type metricLabelsKey struct{}
+
+// metricLabels holds the user labels attached to a context.
+type metricLabels struct {
+	kvs []string // alternating label names and values, sorted by name
+	key string   // kvs, joined
+}
+
+// WithMetricLabels returns a copy of ctx that attaches the provided labels,
+// given as alternating label names and values, to the metrics of the method
+// calls made with the returned context. The labels are merged with the labels
+// already attached to ctx, if any, overriding the labels with the same names.
+// The label names must have been checked by the caller.
+func WithMetricLabels(ctx context.Context, kvs ...string) context.Context {
+	merged := map[string]string{}
+	if old, ok := ctx.Value(metricLabelsKey{}).(*metricLabels); ok {
+		for i := 0; i < len(old.kvs); i += 2 {
+			merged[old.kvs[i]] = old.kvs[i+1]
+		}
+	}
+	for i := 0; i+1 < len(kvs); i += 2 {
+		merged[kvs[i]] = kvs[i+1]
+	}
+	names := maps.Keys(merged)
+	sort.Strings(names)
+	labels := &metricLabels{kvs: make([]string, 0, 2*len(names))}
+	for _, name := range names {
+		labels.kvs = append(labels.kvs, name, merged[name])
+	}
+	labels.key = joinLabels(labels.kvs)
+	return context.WithValue(ctx, metricLabelsKey{}, labels)
+}
+
+// MetricLabels returns the user labels attached to ctx by WithMetricLabels,
+// as alternating label names and values sorted by name.
+func MetricLabels(ctx context.Context) []string {
+	labels, ok := ctx.Value(metricLabelsKey{}).(*metricLabels)
+	if !ok {
+		return nil
+	}
+	return slices.Clone(labels.kvs)
+}
+
+// joinLabels joins alternating label names and values into a map key.
+func joinLabels(kvs []string) string {
+	return strings.Join(kvs, "\x00")
 }
@@ -15,10 +15,79 @@
 package codegen
 
 import (
+	"context"
+	"fmt"
 	"testing"
 	"time"
+
+	"github.com/google/go-cmp/cmp"
 )
 
+func TestMetricLabels(t *testing.T) {
+	ctx := WithMetricLabels(context.Background(), "tenant", "acme", "class", "gold")
+	ctx = WithMetricLabels(ctx, "class", "silver")
+	got := MetricLabels(ctx)
+	want := []string{"class", "silver", "tenant", "acme"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("MetricLabels (-want +got):\n%s", diff)
+	}
+	if got := MetricLabels(context.Background()); got != nil {
+		t.Fatalf("MetricLabels: got %v, want nil", got)
+	}
+}
+
+func TestMethodMetricsForContext(t *testing.T) {
+	m := MethodMetricsFor(MethodLabels{
+		Caller:    "caller",
+		Component: "component",
+		Method:    "TestMethodMetricsForContext",
+	})
+	if got := m.ForContext(context.Background()); got != m {
+		t.Fatal("ForContext without labels: got new metrics, want m")
+	}
+
+	ctx := WithMetricLabels(context.Background(), "tenant", "acme")
+	labeled := m.ForContext(ctx)
+	if labeled == m {
+		t.Fatal("ForContext with labels: got m, want new metrics")
+	}
+	if got := m.ForContext(WithMetricLabels(context.Background(), "tenant", "acme")); got != labeled {
+		t.Fatal("ForContext with the same labels: got different metrics")
+	}
+	labeled.Count.Add(1)
+	labeled.Count.Init()
+	snap := labeled.Count.Snapshot()
+	if got, want := snap.Labels["tenant"], "acme"; got != want {
+		t.Fatalf("tenant label: got %q, want %q", got, want)
+	}
+	if got, want := snap.Labels["method"], "TestMethodMetricsForContext"; got != want {
+		t.Fatalf("method label: got %q, want %q", got, want)
+	}
+}
+
+func TestMethodMetricsOverflow(t *testing.T) {
+	SetMethodLabelSets(3)
+	defer SetMethodLabelSets(DefaultMethodLabelSets)
+
+	m := MethodMetricsFor(MethodLabels{
+		Caller:    "caller",
+		Component: "component",
+		Method:    "TestMethodMetricsOverflow",
+	})
+	tenants := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		ctx := WithMetricLabels(context.Background(), "tenant", fmt.Sprint(i))
+		metrics := m.ForContext(ctx)
+		metrics.Count.Add(1)
+		metrics.Count.Init()
+		tenants[metrics.Count.Snapshot().Labels["tenant"]] = true
+	}
+	want := map[string]bool{"0": true, "1": true, "2": true, OverflowLabelValue: true}
+	if diff := cmp.Diff(want, tenants); diff != "" {
+		t.Fatalf("tenant labels (-want +got):\n%s", diff)
+	}
+}
+
 func BenchmarkMetrics(b *testing.B) {
 	metrics := MethodMetricsFor(MethodLabels{
 		Caller:    "caller",
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 
 	"github.com/ServiceWeaver/weaver/runtime"
@@ -40,6 +41,20 @@ func Registered() []*Registration {
 	return globalRegistry.allComponents()
 }
 
+// RegisterRefs records that the component with the provided full name
+// fetches the components named by refs using weaver.Get. Calls to it are
+// generated by "weaver generate", which finds the weaver.Get calls in the
+// component's implementation.
+func RegisterRefs(caller string, refs ...string) {
+	globalRegistry.registerRefs(caller, refs)
+}
+
+// Refs returns the full names of the components that the component with the
+// provided full name fetches using weaver.Get, in sorted order.
+func Refs(caller string) []string {
+	return globalRegistry.refsOf(caller)
+}
+
 // registry is a repository for registered Service Weaver components.
 // Entries are typically added to the default registry by calls
 // to Register in init functions in code generated by "weaver generate".
@@ -47,6 +62,7 @@ type registry struct {
 	m          sync.Mutex
 	components map[reflect.Type]*Registration // the set of registered components, by their interface types
 	byName     map[string]*Registration       // map from full component name to registration
+	refs       map[string]map[string]bool     // components fetched by every component, by full name
 }
 
 // Registration is the configuration needed to register a Service Weaver component.
@@ -56,11 +72,30 @@ type Registration struct {
 	New      func() any         // returns a new instance of the implementation type
 	ConfigFn func(impl any) any // returns pointer to config field in local impl if non-nil
 	Routed   bool               // True if calls to this component should be routed
+	Router   reflect.Type       // interface with the routing methods, or nil if not routed
 
 	// Functions that return different types of stubs.
 	LocalStubFn  func(impl any, tracer trace.Tracer) any
 	ClientStubFn func(stub Stub, caller string) any
 	ServerStubFn func(impl any, load func(key uint64, load float64)) Server
+
+	// ParamNames holds the names of the parameters of every method,
+	// excluding the context, keyed by method name. Methods whose only
+	// parameter is the context are omitted. Names may be empty or "_".
+	ParamNames map[string][]string
+
+	// HTTPRoutes holds the HTTP routes of the methods annotated with
+	// //weaver:http, e.g., "GET /items/{id}", keyed by method name.
+	HTTPRoutes map[string]string
+
+	// GraphQLFields holds the GraphQL fields of the methods annotated with
+	// //weaver:graphql, e.g., "query product", keyed by method name.
+	GraphQLFields map[string]string
+
+	// KafkaBindings holds the Kafka bindings of the methods annotated with
+	// //weaver:kafka, i.e., a topic and a consumer group separated by a
+	// space, keyed by method name.
+	KafkaBindings map[string]string
 }
 
 // register registers a Service Weaver component. If the registry's close method was
@@ -115,6 +150,31 @@ func (r *registry) allComponents() []*Registration {
 	return components
 }
 
+func (r *registry) registerRefs(caller string, refs []string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.refs == nil {
+		r.refs = map[string]map[string]bool{}
+	}
+	if r.refs[caller] == nil {
+		r.refs[caller] = map[string]bool{}
+	}
+	for _, ref := range refs {
+		r.refs[caller][ref] = true
+	}
+}
+
+func (r *registry) refsOf(caller string) []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+	refs := make([]string, 0, len(r.refs[caller]))
+	for ref := range r.refs[caller] {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
 func (r *registry) find(path string) (*Registration, bool) {
 	r.m.Lock()
 	defer r.m.Unlock()
@@ -130,15 +190,28 @@ func ComponentConfigValidator(path, cfg string) error {
 		// Not for a known component.
 		return nil
 	}
+	config := &protos.AppConfig{Sections: map[string]string{path: cfg}}
+	settings, err := runtime.ParseComponentSettings(path, info.Iface, config.Sections)
+	if err != nil {
+		return fmt.Errorf("%v: bad config: %w", info.Iface, err)
+	}
+	for _, caller := range settings.AllowedCallers {
+		if _, ok := globalRegistry.find(caller); !ok {
+			return fmt.Errorf("%v: bad config: allowed_callers: unknown component %q", info.Iface, caller)
+		}
+	}
 	if info.ConfigFn == nil {
-		return fmt.Errorf("unexpected configuration for component %v "+
-			"that does not support configuration (add a "+
-			"weaver.WithConfig[configType] embedded field to %v ",
-			info.Name, info.Iface)
+		// Only the settings interpreted by Service Weaver are allowed.
+		if err := runtime.ParseConfigSection(path, "", config.Sections, &runtime.ComponentSettings{}); err != nil {
+			return fmt.Errorf("unexpected configuration for component %v "+
+				"that does not support configuration (add a "+
+				"weaver.WithConfig[configType] embedded field to %v): %w",
+				info.Name, info.Iface, err)
+		}
+		return nil
 	}
 	objConfig := info.ConfigFn(info.New())
-	config := &protos.AppConfig{Sections: map[string]string{path: cfg}}
-	if err := runtime.ParseConfigSection(path, "", config.Sections, objConfig); err != nil {
+	if err := runtime.ParseComponentConfigSection(path, config.Sections, objConfig); err != nil {
 		return fmt.Errorf("%v: bad config: %w", info.Iface, err)
 	}
 	return nil
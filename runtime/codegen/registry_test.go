@@ -66,6 +66,18 @@ func TestComponentConfigValidatorErrors(t *testing.T) {
 	}
 }
 
+func TestRefs(t *testing.T) {
+	codegen.RegisterRefs(typeWithConfig, typeWithoutConfig)
+	codegen.RegisterRefs(typeWithConfig, typeWithoutConfig, "codegen_test/other")
+	want := []string{"codegen_test/other", typeWithoutConfig}
+	if got := codegen.Refs(typeWithConfig); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Refs(%q): got %v, want %v", typeWithConfig, got, want)
+	}
+	if got := codegen.Refs(typeWithoutConfig); len(got) != 0 {
+		t.Fatalf("Refs(%q): got %v, want none", typeWithoutConfig, got)
+	}
+}
+
 const (
 	typeWithoutConfig = "codegen_test/withoutConfig"
 	typeWithConfig    = "codegen_test/withConfig"
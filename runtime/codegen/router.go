@@ -0,0 +1,98 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// globalRouters holds the routers registered with RegisterRouter and
+// installed with SetRouter.
+var globalRouters routers
+
+// routers is a repository of alternative routers for routed components.
+type routers struct {
+	mu         sync.Mutex
+	registered map[reflect.Type]map[string]any // routers, by component interface and name
+	installed  sync.Map                        // installed router, by component name
+}
+
+// RegisterRouter registers router under the provided name as an alternative
+// router for the component with the provided interface type. The router is
+// not used until it is installed with SetRouter.
+func RegisterRouter(iface reflect.Type, name string, router any) error {
+	if name == "" {
+		return fmt.Errorf("RegisterRouter(%v): empty router name", iface)
+	}
+	if router == nil {
+		return fmt.Errorf("RegisterRouter(%v, %q): nil router", iface, name)
+	}
+	globalRouters.mu.Lock()
+	defer globalRouters.mu.Unlock()
+	if globalRouters.registered == nil {
+		globalRouters.registered = map[reflect.Type]map[string]any{}
+	}
+	byName := globalRouters.registered[iface]
+	if byName == nil {
+		byName = map[string]any{}
+		globalRouters.registered[iface] = byName
+	}
+	if _, ok := byName[name]; ok {
+		return fmt.Errorf("RegisterRouter(%v, %q): router already registered", iface, name)
+	}
+	byName[name] = router
+	return nil
+}
+
+// SetRouter installs the router registered under the provided name as the
+// router for the component with the provided interface type, replacing the
+// component's current router. If name is empty, the component's default
+// router, i.e., the one passed to weaver.WithRouter, is reinstalled.
+func SetRouter(iface reflect.Type, name string) error {
+	globalRegistry.m.Lock()
+	reg, ok := globalRegistry.components[iface]
+	globalRegistry.m.Unlock()
+	if !ok {
+		return fmt.Errorf("SetRouter(%v): component not found", iface)
+	}
+	if reg.Router == nil {
+		return fmt.Errorf("SetRouter(%v): component is not routed", iface)
+	}
+	if name == "" {
+		globalRouters.installed.Delete(reg.Name)
+		return nil
+	}
+
+	globalRouters.mu.Lock()
+	router, ok := globalRouters.registered[iface][name]
+	globalRouters.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("SetRouter(%v, %q): router not registered", iface, name)
+	}
+	if t := reflect.TypeOf(router); !t.Implements(reg.Router) {
+		return fmt.Errorf("SetRouter(%v, %q): router type %v does not have the routing methods of the component's default router", iface, name, t)
+	}
+	globalRouters.installed.Store(reg.Name, router)
+	return nil
+}
+
+// Router returns the router installed with SetRouter for the named component,
+// or nil if the component uses its default router.
+func Router(component string) any {
+	router, _ := globalRouters.installed.Load(component)
+	return router
+}
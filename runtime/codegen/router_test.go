@@ -0,0 +1,122 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const typeRouted = "codegen_test/routed"
+
+type componentRouted interface {
+	Get(ctx context.Context, key string) (string, error)
+}
+
+// routedRouter is the set of routing methods of componentRouted, like the
+// interface generated by "weaver generate".
+type routedRouter interface {
+	Get(ctx context.Context, key string) string
+}
+
+type keyRouter struct{}
+
+func (keyRouter) Get(_ context.Context, key string) string { return key }
+
+type prefixRouter struct{}
+
+func (prefixRouter) Get(_ context.Context, key string) string { return key[:1] }
+
+type badRouter struct{}
+
+func (badRouter) Get(_ context.Context, key string) int { return len(key) }
+
+func init() {
+	codegen.Register(codegen.Registration{
+		Name:         typeRouted,
+		Iface:        reflect.TypeOf((*componentRouted)(nil)).Elem(),
+		New:          func() any { return nil },
+		Routed:       true,
+		Router:       reflect.TypeOf((*routedRouter)(nil)).Elem(),
+		LocalStubFn:  func(any, trace.Tracer) any { return nil },
+		ClientStubFn: func(codegen.Stub, string) any { return nil },
+		ServerStubFn: func(any, func(uint64, float64)) codegen.Server { return nil },
+	})
+	iface := reflect.TypeOf((*componentRouted)(nil)).Elem()
+	if err := codegen.RegisterRouter(iface, "prefix", prefixRouter{}); err != nil {
+		panic(err)
+	}
+	if err := codegen.RegisterRouter(iface, "bad", badRouter{}); err != nil {
+		panic(err)
+	}
+}
+
+func TestSetRouter(t *testing.T) {
+	iface := reflect.TypeOf((*componentRouted)(nil)).Elem()
+	route := func() string {
+		r, ok := codegen.Router(typeRouted).(routedRouter)
+		if !ok {
+			r = keyRouter{}
+		}
+		return r.Get(context.Background(), "hello")
+	}
+	if got, want := route(), "hello"; got != want {
+		t.Fatalf("default router: got %q, want %q", got, want)
+	}
+	if err := codegen.SetRouter(iface, "prefix"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := route(), "h"; got != want {
+		t.Fatalf("prefix router: got %q, want %q", got, want)
+	}
+	if err := codegen.SetRouter(iface, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := route(), "hello"; got != want {
+		t.Fatalf("restored router: got %q, want %q", got, want)
+	}
+}
+
+func TestSetRouterErrors(t *testing.T) {
+	routed := reflect.TypeOf((*componentRouted)(nil)).Elem()
+	for _, test := range []struct {
+		name  string
+		iface reflect.Type
+		want  string
+	}{
+		{"unknown", reflect.TypeOf((*routedRouter)(nil)).Elem(), "component not found"},
+		{"", reflect.TypeOf((*componentWithConfig)(nil)).Elem(), "not routed"},
+		{"missing", routed, "not registered"},
+		{"bad", routed, "does not have the routing methods"},
+	} {
+		t.Run(test.want, func(t *testing.T) {
+			err := codegen.SetRouter(test.iface, test.name)
+			if err == nil {
+				t.Fatal("unexpected success")
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("error %q does not contain %q", err, test.want)
+			}
+		})
+	}
+	if err := codegen.RegisterRouter(routed, "prefix", keyRouter{}); err == nil {
+		t.Error("duplicate RegisterRouter: unexpected success")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// serializables holds the types registered with RegisterSerializable, keyed
+// by their tags (see typeTag).
+var serializables sync.Map // string -> reflect.Type
+
+// The kinds of the values encoded by Encoder.Interface, which follow their
+// type tags.
+const (
+	valueKind      uint8 = iota // a value of type T
+	pointerKind                 // a non-nil value of type *T
+	nilPointerKind              // a nil value of type *T
+)
+
+// RegisterSerializable registers type T, so that values of type T and *T can
+// be serialized as the values of interface types, with Encoder.Interface.
+// Type T must be a named type, and *T must implement AutoMarshal. Calls to
+// RegisterSerializable are generated by "weaver generate" for every type that
+// embeds weaver.AutoMarshal or implements AutoMarshal by hand.
+func RegisterSerializable[T any]() {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Name() == "" {
+		panic(fmt.Errorf("RegisterSerializable: unnamed type %v", t))
+	}
+	if !reflect.PointerTo(t).Implements(reflect.TypeOf((*AutoMarshal)(nil)).Elem()) {
+		panic(fmt.Errorf("RegisterSerializable: %v does not implement AutoMarshal", reflect.PointerTo(t)))
+	}
+	serializables.Store(typeTag(t), t)
+}
+
+// typeTag returns the tag that identifies the provided named type on the
+// wire, e.g., "github.com/example/events.Created".
+func typeTag(t reflect.Type) string {
+	return t.PkgPath() + "." + t.Name()
+}
+
+// Interface encodes value, the value of an interface type, along with a tag
+// that identifies its dynamic type. The value must be nil, or of type T or
+// *T, where T is registered with RegisterSerializable.
+func (e *Encoder) Interface(value any) {
+	if value == nil {
+		e.String("")
+		return
+	}
+	v := reflect.ValueOf(value)
+	t := v.Type()
+	kind := valueKind
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		kind = pointerKind
+		if v.IsNil() {
+			kind = nilPointerKind
+		}
+	}
+	if registered, ok := serializables.Load(typeTag(t)); !ok || registered != t {
+		panic(makeEncodeError("type %T not registered; does it embed weaver.AutoMarshal?", value))
+	}
+	e.String(typeTag(t))
+	e.Uint8(kind)
+	switch kind {
+	case valueKind:
+		// The methods of AutoMarshal have pointer receivers.
+		p := reflect.New(t)
+		p.Elem().Set(v)
+		p.Interface().(AutoMarshal).WeaverMarshal(e)
+	case pointerKind:
+		value.(AutoMarshal).WeaverMarshal(e)
+	}
+}
+
+// Interface decodes a value encoded by Encoder.Interface.
+func (d *Decoder) Interface() any {
+	tag := d.String()
+	if tag == "" {
+		return nil
+	}
+	registered, ok := serializables.Load(tag)
+	if !ok {
+		panic(makeDecodeError("type %s not registered", tag))
+	}
+	t := registered.(reflect.Type)
+	switch kind := d.Uint8(); kind {
+	case valueKind:
+		p := reflect.New(t)
+		p.Interface().(AutoMarshal).WeaverUnmarshal(d)
+		return p.Elem().Interface()
+	case pointerKind:
+		p := reflect.New(t)
+		p.Interface().(AutoMarshal).WeaverUnmarshal(d)
+		return p.Interface()
+	case nilPointerKind:
+		return reflect.Zero(reflect.PointerTo(t)).Interface()
+	default:
+		panic(makeDecodeError("type %s: invalid kind %d", tag, kind))
+	}
+}
+
+// DecodeInterface decodes a value of interface type T encoded by
+// Encoder.Interface.
+func DecodeInterface[T any](d *Decoder) T {
+	var value T
+	x := d.Interface()
+	if x == nil {
+		return value
+	}
+	value, ok := x.(T)
+	if !ok {
+		panic(makeDecodeError("%T does not implement %v", x, reflect.TypeOf(&value).Elem()))
+	}
+	return value
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type shape interface{ area() int }
+
+// square implements shape and AutoMarshal, by hand.
+type square struct{ side int }
+
+func (s square) area() int                     { return s.side * s.side }
+func (s *square) WeaverMarshal(enc *Encoder)   { enc.Int(s.side) }
+func (s *square) WeaverUnmarshal(dec *Decoder) { s.side = dec.Int() }
+
+// circle implements shape, but is not registered.
+type circle struct{ radius int }
+
+func (c *circle) area() int                    { return 3 * c.radius * c.radius }
+func (c *circle) WeaverMarshal(enc *Encoder)   { enc.Int(c.radius) }
+func (c *circle) WeaverUnmarshal(dec *Decoder) { c.radius = dec.Int() }
+
+func init() {
+	RegisterSerializable[square]()
+}
+
+func TestInterface(t *testing.T) {
+	for _, want := range []shape{nil, square{2}, &square{3}, (*square)(nil)} {
+		enc := NewEncoder()
+		enc.Interface(want)
+		got := DecodeInterface[shape](NewDecoder(enc.Data()))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	}
+}
+
+func TestInterfaceNotRegistered(t *testing.T) {
+	err := func() (err error) {
+		defer func() { err = CatchPanics(recover()) }()
+		NewEncoder().Interface(&circle{1})
+		return nil
+	}()
+	if !errors.As(err, &encoderError{}) {
+		t.Fatalf("got error %v, want encoder error", err)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"math"
+	"math/big"
+	"net/netip"
+	"time"
+)
+
+// This file contains native encodings of commonly used standard library
+// types. These encodings are more compact and cheaper to compute than the
+// types' MarshalBinary methods.
+
+// utcOffset is the zone offset that marks a time.Time in UTC.
+const utcOffset = math.MinInt32
+
+// Time encodes an arg of type time.Time as its Unix time in seconds, its
+// nanoseconds, and its zone offset in seconds. Like MarshalBinary, Time
+// encodes a time's zone offset but not its location name, and it drops its
+// monotonic clock reading.
+func (e *Encoder) Time(arg time.Time) {
+	offset := int32(utcOffset)
+	if arg.Location() != time.UTC {
+		_, off := arg.Zone()
+		offset = int32(off)
+	}
+	e.Int64(arg.Unix())
+	e.Int32(int32(arg.Nanosecond()))
+	e.Int32(offset)
+}
+
+// Addr encodes an arg of type netip.Addr as its length in bytes (0, 4, or
+// 16), its bytes, and, for IPv6 addresses, its zone.
+func (e *Encoder) Addr(arg netip.Addr) {
+	b := arg.AsSlice()
+	e.Uint8(uint8(len(b)))
+	copy(e.Grow(len(b)), b)
+	if arg.Is6() {
+		e.String(arg.Zone())
+	}
+}
+
+// BigInt encodes an arg of type big.Int as its sign and the big-endian bytes
+// of its absolute value.
+func (e *Encoder) BigInt(arg *big.Int) {
+	e.Bool(arg.Sign() < 0)
+	e.Bytes(arg.Bytes())
+}
+
+// Time decodes a value of type time.Time.
+func (d *Decoder) Time() time.Time {
+	sec := d.Int64()
+	nsec := d.Int32()
+	offset := d.Int32()
+	t := time.Unix(sec, int64(nsec))
+	if offset == utcOffset {
+		return t.UTC()
+	}
+	if _, off := t.Zone(); off == int(offset) {
+		return t
+	}
+	return t.In(time.FixedZone("", int(offset)))
+}
+
+// Addr decodes a value of type netip.Addr.
+func (d *Decoder) Addr() netip.Addr {
+	n := int(d.Uint8())
+	switch n {
+	case 0:
+		return netip.Addr{}
+	case 4, 16:
+	default:
+		panic(makeDecodeError("invalid IP address length: %d", n))
+	}
+	addr, _ := netip.AddrFromSlice(d.Read(n))
+	if n == 16 {
+		addr = addr.WithZone(d.String())
+	}
+	return addr
+}
+
+// BigInt decodes a value of type big.Int into the provided argument.
+func (d *Decoder) BigInt(res *big.Int) {
+	neg := d.Bool()
+	res.SetBytes(d.Bytes())
+	if neg {
+		res.Neg(res)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"math/big"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestTime(t *testing.T) {
+	now := time.Now()
+	for _, want := range []time.Time{
+		{},
+		now,
+		now.UTC(),
+		now.In(time.FixedZone("", -7*60*60)),
+		time.Date(1900, 1, 2, 3, 4, 5, 6, time.UTC),
+	} {
+		enc := NewEncoder()
+		enc.Time(want)
+		if got := len(enc.Data()); got != 16 {
+			t.Errorf("len(enc.Time(%v)): got %d, want 16", want, got)
+		}
+		got := NewDecoder(enc.Data()).Time()
+		if !got.Equal(want) {
+			t.Errorf("Time(%v): got %v", want, got)
+		}
+		_, gotOffset := got.Zone()
+		_, wantOffset := want.Zone()
+		if gotOffset != wantOffset {
+			t.Errorf("Time(%v): got offset %d, want %d", want, gotOffset, wantOffset)
+		}
+	}
+
+	// The zero time and times in UTC round trip exactly.
+	for _, want := range []time.Time{{}, now.UTC().Round(0)} {
+		enc := NewEncoder()
+		enc.Time(want)
+		if got := NewDecoder(enc.Data()).Time(); got != want {
+			t.Errorf("Time(%v): got %v", want, got)
+		}
+	}
+}
+
+func TestAddr(t *testing.T) {
+	for _, want := range []netip.Addr{
+		{},
+		netip.MustParseAddr("127.0.0.1"),
+		netip.MustParseAddr("::1"),
+		netip.MustParseAddr("::ffff:10.0.0.1"),
+		netip.MustParseAddr("fe80::1%eth0"),
+	} {
+		enc := NewEncoder()
+		enc.Addr(want)
+		if got := NewDecoder(enc.Data()).Addr(); got != want {
+			t.Errorf("Addr(%v): got %v", want, got)
+		}
+	}
+}
+
+func TestBigInt(t *testing.T) {
+	huge, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	for _, want := range []*big.Int{
+		big.NewInt(0),
+		big.NewInt(42),
+		big.NewInt(-42),
+		huge,
+	} {
+		enc := NewEncoder()
+		enc.BigInt(want)
+		var got big.Int
+		NewDecoder(enc.Data()).BigInt(&got)
+		if got.Cmp(want) != 0 {
+			t.Errorf("BigInt(%v): got %v", want, &got)
+		}
+	}
+}
@@ -34,6 +34,10 @@ type Stub interface {
 	// ordered. method is the index into this slice. args and results are the
 	// serialized arguments and results, respectively. shardKey is the shard
 	// key for routed components, and 0 otherwise.
+	//
+	// Run must not retain args once it returns: the caller reuses the
+	// buffer for other calls. results, on the other hand, is owned by the
+	// caller, which may decode byte slices that alias it.
 	Run(ctx context.Context, method int, args []byte, shardKey uint64) (results []byte, err error)
 
 	// WrapError embeds ErrRetriable into the appropriate errors. The codegen
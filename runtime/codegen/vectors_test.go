@@ -0,0 +1,274 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// vector is a test vector for the data encoding, shared with weavelets
+// written in other languages. See testdata/vectors.json.
+type vector struct {
+	Name  string          `json:"name"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+	Hex   string          `json:"hex"`
+
+	// DecodeOnly is true for vectors that a decoder must accept, but that no
+	// encoder produces, e.g., a versioned struct with an unknown field.
+	DecodeOnly bool `json:"decode_only"`
+}
+
+// vectorStruct is the Go type of the struct and versioned struct vectors.
+type vectorStruct struct {
+	ID    string
+	Count int32
+}
+
+// vectorCodec encodes and decodes the values of a vector type.
+type vectorCodec struct {
+	parse func(json.RawMessage) (any, error)
+	enc   func(*Encoder, any)
+	dec   func(*Decoder) any
+}
+
+// codecOf returns a vectorCodec for values of type T, which are represented
+// in JSON the way encoding/json represents them.
+func codecOf[T any](enc func(*Encoder, T), dec func(*Decoder) T) vectorCodec {
+	return vectorCodec{
+		parse: func(b json.RawMessage) (any, error) {
+			var v T
+			err := json.Unmarshal(b, &v)
+			return v, err
+		},
+		enc: func(e *Encoder, v any) { enc(e, v.(T)) },
+		dec: func(d *Decoder) any { return dec(d) },
+	}
+}
+
+var vectorCodecs = map[string]vectorCodec{
+	"bool":    codecOf((*Encoder).Bool, (*Decoder).Bool),
+	"int8":    codecOf((*Encoder).Int8, (*Decoder).Int8),
+	"uint8":   codecOf((*Encoder).Uint8, (*Decoder).Uint8),
+	"int16":   codecOf((*Encoder).Int16, (*Decoder).Int16),
+	"uint16":  codecOf((*Encoder).Uint16, (*Decoder).Uint16),
+	"int32":   codecOf((*Encoder).Int32, (*Decoder).Int32),
+	"uint32":  codecOf((*Encoder).Uint32, (*Decoder).Uint32),
+	"int64":   codecOf((*Encoder).Int64, (*Decoder).Int64),
+	"uint64":  codecOf((*Encoder).Uint64, (*Decoder).Uint64),
+	"int":     codecOf((*Encoder).Int, (*Decoder).Int),
+	"uint":    codecOf((*Encoder).Uint, (*Decoder).Uint),
+	"float32": codecOf((*Encoder).Float32, (*Decoder).Float32),
+	"float64": codecOf((*Encoder).Float64, (*Decoder).Float64),
+	"string":  codecOf((*Encoder).String, (*Decoder).String),
+
+	// A complex number is represented as [real, imag].
+	"complex128": codecOf(
+		func(e *Encoder, v [2]float64) { e.Complex128(complex(v[0], v[1])) },
+		func(d *Decoder) [2]float64 { c := d.Complex128(); return [2]float64{real(c), imag(c)} },
+	),
+
+	// A byte slice is represented as a string, or null for a nil slice.
+	"[]byte": codecOf(
+		func(e *Encoder, v *string) {
+			if v == nil {
+				e.Bytes(nil)
+				return
+			}
+			e.Bytes([]byte(*v))
+		},
+		func(d *Decoder) *string {
+			b := d.Bytes()
+			if b == nil {
+				return nil
+			}
+			s := string(b)
+			return &s
+		},
+	),
+
+	"[]string": codecOf(
+		func(e *Encoder, v []string) {
+			if v == nil {
+				e.Len(-1)
+				return
+			}
+			e.Len(len(v))
+			for _, s := range v {
+				e.String(s)
+			}
+		},
+		func(d *Decoder) []string {
+			n := d.Len()
+			if n == -1 {
+				return nil
+			}
+			v := make([]string, n)
+			for i := range v {
+				v[i] = d.String()
+			}
+			return v
+		},
+	),
+
+	"map[string]int64": codecOf(
+		func(e *Encoder, v map[string]int64) {
+			if v == nil {
+				e.Len(-1)
+				return
+			}
+			e.Len(len(v))
+			for k, x := range v {
+				e.String(k)
+				e.Int64(x)
+			}
+		},
+		func(d *Decoder) map[string]int64 {
+			n := d.Len()
+			if n == -1 {
+				return nil
+			}
+			v := make(map[string]int64, n)
+			for i := 0; i < n; i++ {
+				k := d.String()
+				v[k] = d.Int64()
+			}
+			return v
+		},
+	),
+
+	"*int64": codecOf(
+		func(e *Encoder, v *int64) {
+			e.Bool(v != nil)
+			if v != nil {
+				e.Int64(*v)
+			}
+		},
+		func(d *Decoder) *int64 {
+			if !d.Bool() {
+				return nil
+			}
+			x := d.Int64()
+			return &x
+		},
+	),
+
+	// A struct is represented as a JSON object.
+	"struct{ID string; Count int32}": codecOf(
+		func(e *Encoder, v vectorStruct) {
+			e.String(v.ID)
+			e.Int32(v.Count)
+		},
+		func(d *Decoder) vectorStruct {
+			return vectorStruct{ID: d.String(), Count: d.Int32()}
+		},
+	),
+
+	// A versioned struct is represented as a JSON object too. Decoders skip
+	// unknown fields and leave missing fields zero.
+	"struct{ID string `weaver:\"1\"`; Count int32 `weaver:\"2\"`}": codecOf(
+		func(e *Encoder, v vectorStruct) {
+			e.Len(2)
+			f1 := e.BeginField(1)
+			e.String(v.ID)
+			e.EndField(f1)
+			f2 := e.BeginField(2)
+			e.Int32(v.Count)
+			e.EndField(f2)
+		},
+		func(d *Decoder) vectorStruct {
+			var v vectorStruct
+			for n := d.Len(); n > 0; n-- {
+				switch num, field := d.Field(); num {
+				case 1:
+					v.ID = field.String()
+				case 2:
+					v.Count = field.Int32()
+				}
+			}
+			return v
+		},
+	),
+
+	// An error is represented by its message, or null for a nil error. The
+	// type information that accompanies every error in the chain is specific
+	// to the encoding language, so error vectors are only decoded.
+	"error": {
+		parse: func(b json.RawMessage) (any, error) {
+			var v *string
+			err := json.Unmarshal(b, &v)
+			return v, err
+		},
+		dec: func(d *Decoder) any {
+			err := d.Error()
+			if err == nil {
+				return (*string)(nil)
+			}
+			s := err.Error()
+			return &s
+		},
+	},
+}
+
+// TestVectors checks the data encoding against the test vectors in
+// testdata/vectors.json.
+func TestVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []vector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			codec, ok := vectorCodecs[v.Type]
+			if !ok {
+				t.Fatalf("unknown type %q", v.Type)
+			}
+			want, err := hex.DecodeString(v.Hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			val, err := codec.parse(v.Value)
+			if err != nil {
+				t.Fatalf("parse value: %v", err)
+			}
+
+			if codec.enc != nil && !v.DecodeOnly {
+				enc := NewEncoder()
+				codec.enc(enc, val)
+				if got := hex.EncodeToString(enc.Data()); got != v.Hex {
+					t.Errorf("encode: got %s, want %s", got, v.Hex)
+				}
+			}
+
+			dec := NewDecoder(want)
+			got := codec.dec(dec)
+			if !dec.Empty() {
+				t.Errorf("decode: leftover bytes")
+			}
+			if diff := cmp.Diff(val, got); diff != "" {
+				t.Errorf("decode (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -15,29 +15,229 @@
 package runtime
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
+	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/ServiceWeaver/weaver/internal/env"
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"gopkg.in/yaml.v3"
 )
 
 // ParseConfig parses the specified configuration input, which should
-// hold a set of sections in TOML format from the specified file.
-// The section corresponding to the common Service Weaver application
-// configuration is parsed and returned as a *AppConfig.
+// hold a set of sections from the specified file. The format of the input
+// is given by the extension of the file: YAML for .yaml and .yml files, JSON
+// for .json files, and TOML otherwise. The section corresponding to the
+// common Service Weaver application configuration is parsed and returned as
+// a *AppConfig.
+//
+// References to environment variables in the string values of the input are
+// expanded after the input is parsed (see ExpandEnv).
 //
 // sectionValidator(key, val) is used to validate every section config entry.
+// Sections are passed to sectionValidator, and stored in the returned
+// config, in TOML format, whatever the format of the input.
 func ParseConfig(file string, input string, sectionValidator func(string, string) error) (*protos.AppConfig, error) {
-	// Extract sections from toml file.
-	var sections map[string]toml.Primitive
-	_, err := toml.Decode(input, &sections)
+	sections, err := decodeConfig(file, input)
 	if err != nil {
 		return nil, err
 	}
+	return parseSections(file, sections, sectionValidator)
+}
+
+// LoadConfig reads the provided config files and merges them into a single
+// config, which is parsed like ParseConfig does. Files are merged in order:
+// tables, including sections, are merged key by key, and other values in a
+// file replace the values of earlier files. For example, a base config file
+// can be followed by a file that overrides some of its settings for a
+// particular environment.
+//
+// A relative binary path is interpreted relative to the directory of the file
+// that specifies it.
+func LoadConfig(files []string, sectionValidator func(string, string) error) (*protos.AppConfig, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no config file provided")
+	}
+	merged := map[string]any{}
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("load config file %q: %w", file, err)
+		}
+		sections, err := decodeConfig(file, string(contents))
+		if err != nil {
+			return nil, fmt.Errorf("load config file %q: %w", file, err)
+		}
+
+		// Use the same key for the app section in every file, so that the
+		// app sections are merged.
+		if app, ok := sections[appKey]; ok {
+			if _, ok := sections[shortAppKey]; ok {
+				return nil, fmt.Errorf("load config file %q: conflicting sections %q and %q", file, shortAppKey, appKey)
+			}
+			delete(sections, appKey)
+			sections[shortAppKey] = app
+		}
+		if app, ok := sections[shortAppKey].(map[string]any); ok {
+			if bin, ok := app["binary"].(string); ok && bin != "" && !filepath.IsAbs(bin) {
+				abs, err := filepath.Abs(filepath.Join(filepath.Dir(file), bin))
+				if err != nil {
+					return nil, err
+				}
+				app["binary"] = abs
+			}
+		}
+		mergeTables(merged, sections)
+	}
+	return parseSections(files[0], merged, sectionValidator)
+}
+
+// mergeTables merges src into dst. Tables present in both are merged
+// recursively; other values in src replace the values in dst.
+func mergeTables(dst, src map[string]any) {
+	for key, value := range src {
+		if s, ok := value.(map[string]any); ok {
+			if d, ok := dst[key].(map[string]any); ok {
+				mergeTables(d, s)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// decodeConfig decodes the provided input into sections, and expands the
+// references to environment variables in their string values. The format of
+// the input is given by the extension of file.
+func decodeConfig(file string, input string) (map[string]any, error) {
+	var sections map[string]any
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal([]byte(input), &sections); err != nil {
+			return nil, err
+		}
+	case ".json":
+		// Decode numbers as json.Number, so that integers can be told
+		// apart from floats.
+		dec := json.NewDecoder(strings.NewReader(input))
+		dec.UseNumber()
+		if err := dec.Decode(&sections); err != nil {
+			return nil, err
+		}
+	default:
+		if _, err := toml.Decode(input, &sections); err != nil {
+			return nil, err
+		}
+	}
+
+	// Every section must be a table.
+	for key, value := range sections {
+		switch v := normalize(value).(type) {
+		case nil:
+			sections[key] = map[string]any{}
+		case map[string]any:
+			sections[key] = v
+		default:
+			return nil, fmt.Errorf("%q is not a section", key)
+		}
+		expanded, err := expandValues(sections[key], os.LookupEnv)
+		if err != nil {
+			return nil, fmt.Errorf("section %q: %w", key, err)
+		}
+		sections[key] = expanded
+	}
+	return sections, nil
+}
+
+// expandValues returns the provided decoded value with the references to
+// environment variables in its strings expanded (see ExpandEnv). Keys are
+// left as is.
+func expandValues(value any, lookup func(string) (string, bool)) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return ExpandEnv(v, lookup)
+	case map[string]any:
+		for key, elem := range v {
+			expanded, err := expandValues(elem, lookup)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			v[key] = expanded
+		}
+		return v, nil
+	case []map[string]any:
+		// TOML arrays of tables.
+		for _, elem := range v {
+			if _, err := expandValues(elem, lookup); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	case []any:
+		for i, elem := range v {
+			expanded, err := expandValues(elem, lookup)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// normalize returns the provided value, decoded from YAML or JSON, with the
+// types that TOML decoding would produce: tables have string keys, integers
+// are int64, and null values are removed.
+func normalize(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, elem := range v {
+			if elem == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = normalize(elem)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, elem := range v {
+			if elem != nil {
+				m[fmt.Sprint(key)] = normalize(elem)
+			}
+		}
+		return m
+	case []any:
+		for i, elem := range v {
+			v[i] = normalize(elem)
+		}
+		return v
+	case int:
+		return int64(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
+}
+
+// parseSections returns the config with the provided sections, which were
+// read from the provided file.
+func parseSections(file string, sections map[string]any, sectionValidator func(string, string) error) (*protos.AppConfig, error) {
 	config := &protos.AppConfig{Sections: map[string]string{}}
 	for k, v := range sections {
 		var buf strings.Builder
@@ -62,10 +262,55 @@ func ParseConfig(file string, input string, sectionValidator func(string, string
 	return config, nil
 }
 
+// envRef matches a reference to an environment variable, with an optional
+// default value, or an escaped "$${".
+var envRef = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// ExpandEnv replaces the references to environment variables in the provided
+// string with their values, as returned by lookup. A reference is either
+// ${VAR}, which expands to the value of VAR, or ${VAR:-default}, which expands
+// to default if VAR is unset or empty. A reference to an unset variable
+// without a default is an error. "$${" expands to a literal "${".
+//
+// Config files are parsed before the references in their string values are
+// expanded, so comments, keys and non-string values are never expanded, and
+// expanded values are never parsed.
+func ExpandEnv(input string, lookup func(string) (string, bool)) (string, error) {
+	var unset []string
+	expanded := envRef.ReplaceAllStringFunc(input, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		m := envRef.FindStringSubmatch(ref)
+		name, def := m[1], m[2]
+		value, ok := lookup(name)
+		if def != "" {
+			if !ok || value == "" {
+				return strings.TrimPrefix(def, ":-")
+			}
+			return value
+		}
+		if !ok {
+			unset = append(unset, name)
+		}
+		return value
+	})
+	if len(unset) > 0 {
+		return "", fmt.Errorf("environment variables %v referenced in config are not set", unset)
+	}
+	return expanded, nil
+}
+
 // ParseConfigSection parses the config section for key into dst.
 // If shortKey is not empty, either key or shortKey is accepted.
 // If the named section is not found, returns nil without changing dst.
 func ParseConfigSection(key, shortKey string, sections map[string]string, dst any) error {
+	return parseConfigSection(key, shortKey, sections, dst, nil)
+}
+
+// parseConfigSection is like ParseConfigSection, but it ignores the top-level
+// keys in ignored.
+func parseConfigSection(key, shortKey string, sections map[string]string, dst any, ignored map[string]bool) error {
 	section, ok := sections[key]
 	if shortKey != "" {
 		// Fetch section listed for shortKey, if any
@@ -84,7 +329,13 @@ func ParseConfigSection(key, shortKey string, sections map[string]string, dst an
 	if err != nil {
 		return err
 	}
-	if unknown := md.Undecoded(); len(unknown) != 0 {
+	var unknown []toml.Key
+	for _, k := range md.Undecoded() {
+		if !ignored[k[0]] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) != 0 {
 		return fmt.Errorf("section %q has unknown keys %v", key, unknown)
 	}
 	if x, ok := dst.(interface{ Validate() error }); ok {
@@ -95,23 +346,168 @@ func ParseConfigSection(key, shortKey string, sections map[string]string, dst an
 	return nil
 }
 
-func extractApp(file string, config *protos.AppConfig) error {
-	const appKey = "github.com/ServiceWeaver/weaver"
-	const shortAppKey = "serviceweaver"
+const (
+	appKey      = "github.com/ServiceWeaver/weaver"
+	shortAppKey = "serviceweaver"
+)
+
+// appConfig holds the data from under appKey in the TOML config.
+// It matches the contents of the Config proto, plus the WeaveletConfig
+// settings that weavelets read directly from the config sections.
+type appConfig struct {
+	Name     string
+	Binary   string
+	Args     []string
+	Env      []string
+	Colocate [][]string
+	Rollout  time.Duration
+	WeaveletConfig
+}
+
+// WeaveletConfig holds the settings in the app section of a config file that
+// are interpreted by weavelets rather than by deployers.
+type WeaveletConfig struct {
+	// TLS configures mutual TLS between weavelets.
+	TLS TLSConfig
+
+	// Compression configures the compression of calls between weavelets.
+	Compression CompressionConfig
+
+	// Transport is the transport of the calls between weavelets in different
+	// colocation groups: TCPTransport, the default, sends the calls directly
+	// over TCP connections, and GRPCTransport carries every connection inside
+	// a gRPC stream, over HTTP/2, so that the calls can traverse L7 load
+	// balancers and service meshes that only understand gRPC.
+	Transport string `toml:"transport"`
+
+	// Prometheus configures the Prometheus scrape endpoint of weavelets.
+	Prometheus PrometheusConfig
+
+	// OTLP configures the export of metrics to an OpenTelemetry collector.
+	OTLP OTLPConfig
+
+	// StatsD configures the export of metrics to a StatsD server.
+	StatsD StatsDConfig
+
+	// Metrics configures the metrics exported by weavelets.
+	Metrics MetricsConfig
+
+	// Tracing configures the tracing of requests by weavelets.
+	Tracing TracingConfig
+
+	// Profiling configures the continuous profiling of weavelets.
+	Profiling ProfilingConfig
+
+	// Audit configures the audit logs of the calls to audited methods.
+	Audit AuditConfig
+
+	// Snapshots configures the storage of the snapshots of stateful
+	// components.
+	Snapshots SnapshotsConfig
 
-	// appConfig holds the data from under appKey in the TOML config.
-	// It matches the contents of the Config proto.
-	type appConfig struct {
-		Name     string
-		Binary   string
-		Args     []string
-		Env      []string
-		Colocate [][]string
-		Rollout  time.Duration
+	// Recording configures the recording of component method calls.
+	Recording RecordingConfig
+
+	// Listeners configures the network listeners returned by
+	// weaver.Instance.Listener, by listener name.
+	Listeners map[string]ListenerConfig `toml:"listeners"`
+
+	// MaxMessageSize is the maximum size, in bytes, of the serialized
+	// arguments, and of the serialized results, of a call to a component
+	// method, unless overridden in the component's settings. If zero, the
+	// MaxMessageSize constant applies.
+	MaxMessageSize int `toml:"max_message_size"`
+
+	// ShutdownTimeout bounds the time given to components to shut down
+	// gracefully, i.e., the total time spent in their Shutdown methods. If
+	// zero, DefaultShutdownTimeout is used.
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout"`
+}
+
+// DefaultShutdownTimeout is the shutdown timeout of a weavelet whose config
+// doesn't set one. See WeaveletConfig.ShutdownTimeout.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// StopTimeout returns how long a weavelet with this config may take to shut
+// down gracefully: the longest drain timeout of its listeners, followed by
+// its shutdown timeout. An envelope kills a weavelet that is still running
+// once this time has elapsed since it asked the weavelet to stop.
+func (c *WeaveletConfig) StopTimeout() time.Duration {
+	var drain time.Duration
+	for _, l := range c.Listeners {
+		if l.DrainTimeout > drain {
+			drain = l.DrainTimeout
+		}
+	}
+	if c.ShutdownTimeout == 0 {
+		return drain + DefaultShutdownTimeout
 	}
+	return drain + c.ShutdownTimeout
+}
 
+// validate validates the weavelet config.
+func (c *WeaveletConfig) validate() error {
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("invalid negative shutdown_timeout %v", c.ShutdownTimeout)
+	}
+	if err := validateMaxMessageSize(c.MaxMessageSize); err != nil {
+		return err
+	}
+	if err := c.Prometheus.validate(); err != nil {
+		return err
+	}
+	if err := c.OTLP.validate(); err != nil {
+		return err
+	}
+	if err := c.StatsD.validate(); err != nil {
+		return err
+	}
+	if err := c.Metrics.validate(); err != nil {
+		return err
+	}
+	if err := c.Tracing.validate(); err != nil {
+		return err
+	}
+	if err := c.Profiling.validate(); err != nil {
+		return err
+	}
+	if err := c.Compression.validate(); err != nil {
+		return err
+	}
+	switch c.Transport {
+	case "", TCPTransport, GRPCTransport:
+	default:
+		return fmt.Errorf("unknown transport %q, want %q or %q", c.Transport, TCPTransport, GRPCTransport)
+	}
+	if err := c.Audit.validate(); err != nil {
+		return err
+	}
+	if err := c.Snapshots.validate(); err != nil {
+		return err
+	}
+	if err := c.Recording.validate(); err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(c.Listeners) {
+		if err := c.Listeners[name].validate(); err != nil {
+			return fmt.Errorf("listener %q: %w", name, err)
+		}
+	}
+	return c.TLS.validate()
+}
+
+// parseAppConfig parses the app section, if any, from the provided sections.
+func parseAppConfig(sections map[string]string) (*appConfig, error) {
 	parsed := &appConfig{}
-	if err := ParseConfigSection(appKey, shortAppKey, config.Sections, parsed); err != nil {
+	if err := ParseConfigSection(appKey, shortAppKey, sections, parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+func extractApp(file string, config *protos.AppConfig) error {
+	parsed, err := parseAppConfig(config.Sections)
+	if err != nil {
 		return err
 	}
 
@@ -128,6 +524,620 @@ func extractApp(file string, config *protos.AppConfig) error {
 	if err := canonicalizeConfig(config, filepath.Dir(file)); err != nil {
 		return err
 	}
+	if err := parsed.WeaveletConfig.validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// TLSConfig configures mutual TLS for the traffic between weavelets in
+// different colocation groups. For example:
+//
+//	[serviceweaver.tls]
+//	cert_file = "/etc/weaver/tls/weavelet.crt"
+//	key_file = "/etc/weaver/tls/weavelet.key"
+//	ca_file = "/etc/weaver/tls/ca.crt"
+//
+// Every weavelet presents the certificate in CertFile and only accepts peers
+// that present a certificate signed by a CA in CAFile. The files are read by
+// every weavelet, so they must be present on every machine that runs the
+// application. The files are re-read when they change, which allows
+// certificates to be rotated without restarting the application.
+//
+// With TrustDomain, the files may hold SPIFFE X.509 SVIDs, e.g., as written
+// and rotated by a SPIRE agent's spiffe-helper, and peers are only accepted
+// if their certificate holds a SPIFFE ID in the trust domain, e.g.,
+// "spiffe://example.org/ns/shop/sa/checkout" for trust domain "example.org".
+//
+// Identities maps the identity of a peer, i.e., its SPIFFE ID with
+// TrustDomain and the common name of its certificate otherwise, to the full
+// names of the components that the peer hosts. A call to a component with
+// allowed_callers is only accepted if the component that the call claims to
+// come from is hosted by the peer that sent it. For example:
+//
+//	[serviceweaver.tls.identities]
+//	"spiffe://example.org/ns/shop/sa/checkout" = ["example.com/shop/CheckoutService"]
+//
+// With WorkloadAPI instead of the files, every weavelet fetches its X.509
+// SVID and the trust bundle of its trust domain from the SPIFFE Workload API
+// endpoint at that address, e.g., a SPIRE agent, and follows the rotations
+// that the endpoint streams. For example:
+//
+//	[serviceweaver.tls]
+//	workload_api = "unix:///run/spire/sockets/agent.sock"
+//	trust_domain = "example.org"
+type TLSConfig struct {
+	CertFile    string              `toml:"cert_file"`    // PEM-encoded certificate chain
+	KeyFile     string              `toml:"key_file"`     // PEM-encoded private key
+	CAFile      string              `toml:"ca_file"`      // PEM-encoded trusted CA certificates
+	WorkloadAPI string              `toml:"workload_api"` // SPIFFE Workload API address, instead of the files
+	TrustDomain string              `toml:"trust_domain"` // if not empty, SPIFFE trust domain of peers
+	Identities  map[string][]string `toml:"identities"`   // components hosted by every peer identity
+}
+
+// Enabled returns whether TLS is configured.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.CAFile != "" || c.WorkloadAPI != "" || c.TrustDomain != "" || len(c.Identities) > 0
+}
+
+// validate checks that the TLS config is either empty or complete.
+func (c TLSConfig) validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	for _, f := range []struct{ name, path string }{
+		{"cert_file", c.CertFile},
+		{"key_file", c.KeyFile},
+		{"ca_file", c.CAFile},
+	} {
+		if c.WorkloadAPI != "" {
+			if f.path != "" {
+				return fmt.Errorf("tls: %s and workload_api are mutually exclusive", f.name)
+			}
+			continue
+		}
+		if f.path == "" {
+			return fmt.Errorf("tls: missing %s", f.name)
+		}
+		// The files are read by weavelets, which may run in a different
+		// working directory (or on a different machine) than the tool that
+		// parses the config file.
+		if !filepath.IsAbs(f.path) {
+			return fmt.Errorf("tls: %s %q is not an absolute path", f.name, f.path)
+		}
+	}
+	if c.WorkloadAPI != "" && !strings.HasPrefix(c.WorkloadAPI, "unix:") && !strings.HasPrefix(c.WorkloadAPI, "tcp:") {
+		return fmt.Errorf("tls: workload_api %q is not a unix: or tcp: address", c.WorkloadAPI)
+	}
+	if !validTrustDomain(c.TrustDomain) {
+		return fmt.Errorf("tls: invalid trust_domain %q", c.TrustDomain)
+	}
+	for identity, components := range c.Identities {
+		if identity == "" {
+			return fmt.Errorf("tls: identities: empty identity")
+		}
+		for _, component := range components {
+			if component == "" {
+				return fmt.Errorf("tls: identities: %q: empty component name", identity)
+			}
+		}
+	}
+	return nil
+}
+
+// validTrustDomain returns whether the provided SPIFFE trust domain is empty
+// or valid, i.e., only holds lowercase letters, digits, dots, dashes, and
+// underscores. See https://github.com/spiffe/spiffe/blob/main/standards/SPIFFE-ID.md.
+func validTrustDomain(domain string) bool {
+	for _, r := range domain {
+		switch {
+		case 'a' <= r && r <= 'z', '0' <= r && r <= '9', r == '.', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// AuditConfig configures the audit logs of the calls to the methods listed in
+// the audited_methods setting of their components. For example:
+//
+//	[serviceweaver.audit]
+//	dir = "/var/log/weaver/audit"
+//
+// Every weavelet that executes calls to audited methods appends an entry per
+// call to its own audit log in Dir, named after the deployment and weavelet
+// ids. Audit logs are tamper-evident; see the runtime/audit package.
+type AuditConfig struct {
+	Dir string `toml:"dir"` // absolute path of the directory of audit logs
+}
+
+// validate checks that the audit config is valid.
+func (c AuditConfig) validate() error {
+	// The directory is used by weavelets, which may run in a different
+	// working directory than the tool that parses the config file.
+	if c.Dir != "" && !filepath.IsAbs(c.Dir) {
+		return fmt.Errorf("audit: dir %q is not an absolute path", c.Dir)
+	}
+	return nil
+}
+
+// RecordingConfig configures the recording of the calls to every component
+// method, with their arguments and results. For example:
+//
+//	[serviceweaver.recording]
+//	dir = "/var/log/weaver/recordings"
+//
+// Every weavelet appends an entry per call it executes to its own recording
+// in Dir, named after the deployment and weavelet ids. Recordings can be
+// replayed with weavertest.Replay; see the runtime/recording package.
+type RecordingConfig struct {
+	Dir string `toml:"dir"` // absolute path of the directory of recordings
+}
+
+// validate checks that the recording config is valid.
+func (c RecordingConfig) validate() error {
+	if c.Dir != "" && !filepath.IsAbs(c.Dir) {
+		return fmt.Errorf("recording: dir %q is not an absolute path", c.Dir)
+	}
+	return nil
+}
+
+// SnapshotsConfig configures the storage of the snapshots of the state of
+// stateful components. For example:
+//
+//	[serviceweaver.snapshots]
+//	dir = "/var/lib/weaver/snapshots"
+//
+// Snapshots are stored in Dir by application and component name, so that they
+// outlive deployments: a new version of an application restores the state
+// checkpointed by the previous one. Dir must be shared by all the machines
+// that run replicas of stateful components, e.g., on a network file system.
+type SnapshotsConfig struct {
+	Dir string `toml:"dir"` // absolute path of the directory of snapshots
+}
+
+// validate checks that the snapshots config is valid.
+func (c SnapshotsConfig) validate() error {
+	if c.Dir != "" && !filepath.IsAbs(c.Dir) {
+		return fmt.Errorf("snapshots: dir %q is not an absolute path", c.Dir)
+	}
+	return nil
+}
+
+// ListenerConfig configures a network listener. For example:
+//
+//	[serviceweaver.listeners.api]
+//	cert_file = "/etc/weaver/api.pem"
+//	key_file = "/etc/weaver/api.key"
+//	reuse_port = true
+//	keep_alive = "30s"
+//	backlog = 4096
+type ListenerConfig struct {
+	// CertFile and KeyFile, if not empty, hold the PEM-encoded certificate
+	// chain and private key with which the listener serves TLS.
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+
+	// ReusePort, if true, sets the SO_REUSEPORT option of the listener's
+	// socket, so that other processes can listen on the same address.
+	ReusePort bool `toml:"reuse_port"`
+
+	// KeepAlive is the TCP keep-alive period of the accepted connections. If
+	// zero, a default period is used. If negative, keep-alives are disabled.
+	KeepAlive time.Duration `toml:"keep_alive"`
+
+	// Backlog, if positive, is the maximum length of the queue of pending
+	// connections of the listener, which the operating system may cap.
+	Backlog int `toml:"backlog"`
+
+	// DrainTimeout is how long a shutting down weavelet waits for the open
+	// connections of the listener, e.g., WebSockets, to be closed before it
+	// shuts down its components. If zero, it doesn't wait.
+	DrainTimeout time.Duration `toml:"drain_timeout"`
+}
+
+// validate checks that the listener config is valid.
+func (c ListenerConfig) validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	for _, f := range []struct{ name, path string }{
+		{"cert_file", c.CertFile},
+		{"key_file", c.KeyFile},
+	} {
+		if f.path != "" && !filepath.IsAbs(f.path) {
+			return fmt.Errorf("%s %q is not an absolute path", f.name, f.path)
+		}
+	}
+	if c.Backlog < 0 {
+		return fmt.Errorf("invalid negative backlog %d", c.Backlog)
+	}
+	if c.DrainTimeout < 0 {
+		return fmt.Errorf("invalid negative drain_timeout %v", c.DrainTimeout)
+	}
+	return nil
+}
+
+// MaxMessageSize is the largest size, in bytes, of the serialized arguments,
+// or results, of a call between processes.
+const MaxMessageSize = 100 << 20
+
+// validateMaxMessageSize checks that a max_message_size setting is valid.
+func validateMaxMessageSize(size int) error {
+	if size < 0 {
+		return fmt.Errorf("invalid negative max_message_size %d", size)
+	}
+	if size > MaxMessageSize {
+		return fmt.Errorf("max_message_size %d larger than the maximum of %d", size, MaxMessageSize)
+	}
+	return nil
+}
+
+// Transports of the calls between weavelets.
+const (
+	TCPTransport  = "tcp"
+	GRPCTransport = "grpc"
+)
+
+// Compression algorithms.
+const (
+	SnappyCompression = "snappy"
+	ZstdCompression   = "zstd"
+)
+
+// DefaultCompressionThreshold is the default value of
+// CompressionConfig.Threshold.
+const DefaultCompressionThreshold = 64 << 10
+
+// CompressionConfig configures the compression of the arguments and results
+// of the calls between weavelets in different colocation groups. For example:
+//
+//	[serviceweaver.compression]
+//	algorithm = "zstd"
+//	threshold = 16384
+//
+// Arguments and results larger than Threshold bytes are compressed with
+// Algorithm, if the receiving weavelet supports it; smaller ones are sent
+// as is. Snappy is cheaper, and zstd compresses better. The calls between
+// weavelets in the same colocation group never leave the machine, and are
+// never compressed.
+type CompressionConfig struct {
+	Algorithm string `toml:"algorithm"` // "snappy" or "zstd"; empty disables compression
+	Threshold int    `toml:"threshold"` // in bytes; DefaultCompressionThreshold if zero
+}
+
+// validate checks that the compression config is valid.
+func (c CompressionConfig) validate() error {
+	switch c.Algorithm {
+	case "", SnappyCompression, ZstdCompression:
+	default:
+		return fmt.Errorf("compression: unknown algorithm %q, want %q or %q", c.Algorithm, SnappyCompression, ZstdCompression)
+	}
+	if c.Threshold < 0 {
+		return fmt.Errorf("compression: invalid negative threshold %d", c.Threshold)
+	}
+	return nil
+}
+
+// PrometheusConfig configures a Prometheus scrape endpoint, served by every
+// weavelet, that exports the metrics of the weavelet. For example:
+//
+//	[serviceweaver.prometheus]
+//	address = ":9464"
+//	path = "/metrics"
+//
+// Every metric is labeled with the application name (app), the deployment id
+// (deployment), the weavelet id (replica), and the component (component). The
+// auto-generated method metrics are labeled with the component whose method
+// was called; other metrics are labeled with the process that exports them.
+//
+// If the port of Address is 0, every weavelet picks a port of its own and logs
+// it. This is handy when many weavelets run on the same machine.
+type PrometheusConfig struct {
+	Address string `toml:"address"` // listening address; empty disables the endpoint
+	Path    string `toml:"path"`    // HTTP path of the endpoint; "/metrics" if empty
+}
+
+// Enabled returns whether the Prometheus endpoint is configured.
+func (c PrometheusConfig) Enabled() bool {
+	return c.Address != ""
+}
+
+// validate checks that the Prometheus config is valid.
+func (c PrometheusConfig) validate() error {
+	if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("prometheus: path %q does not start with /", c.Path)
+	}
+	if c.Path != "" && !c.Enabled() {
+		return fmt.Errorf("prometheus: path %q given without an address", c.Path)
+	}
+	return nil
+}
+
+// OTLPConfig configures the periodic export of metrics, by every weavelet,
+// to an OpenTelemetry collector using OTLP over HTTP. For example:
+//
+//	[serviceweaver.otlp]
+//	endpoint = "http://localhost:4318"
+//	interval = "15s"
+//	headers = {"Authorization" = "Bearer secret"}
+//
+// The metrics are attributed to the same resource as the traces of the
+// weavelet, so that metrics and traces can be correlated.
+type OTLPConfig struct {
+	Endpoint string            `toml:"endpoint"` // collector base URL; empty disables the export
+	Interval time.Duration     `toml:"interval"` // export interval; 15 seconds if zero
+	Headers  map[string]string `toml:"headers"`  // HTTP headers sent with every export
+}
+
+// Enabled returns whether the OTLP export is configured.
+func (c OTLPConfig) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+// MetricsURL returns the URL that metrics are exported to.
+func (c OTLPConfig) MetricsURL() string {
+	return strings.TrimSuffix(c.Endpoint, "/") + "/v1/metrics"
+}
+
+// validate checks that the OTLP config is valid.
+func (c OTLPConfig) validate() error {
+	if !c.Enabled() {
+		if c.Interval != 0 || len(c.Headers) > 0 {
+			return fmt.Errorf("otlp: interval or headers given without an endpoint")
+		}
+		return nil
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return fmt.Errorf("otlp: invalid endpoint %q: %w", c.Endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("otlp: endpoint %q is not an http or https URL", c.Endpoint)
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("otlp: invalid negative interval %v", c.Interval)
+	}
+	return nil
+}
+
+// StatsDConfig configures the periodic export of metrics, by every weavelet,
+// to a StatsD server, like a DogStatsD server run by the Datadog Agent. For
+// example:
+//
+//	[serviceweaver.statsd]
+//	address = "localhost:8125"
+//	prefix = "todo."
+//	tags = {env = "prod"}
+//	tag_mapping = {component = "service", replica = ""}
+//
+// Metrics carry the same labels as the Prometheus endpoint. With the
+// "dogstatsd" format, the labels are sent as tags, renamed by TagMapping; a
+// label mapped to the empty string is dropped. The plain "statsd" format has
+// no tags, so labels and Tags are dropped.
+type StatsDConfig struct {
+	Address    string            `toml:"address"`     // UDP address; empty disables the export
+	Format     string            `toml:"format"`      // "dogstatsd" (default) or "statsd"
+	Prefix     string            `toml:"prefix"`      // prepended to every metric name
+	Interval   time.Duration     `toml:"interval"`    // export interval; 10 seconds if zero
+	Tags       map[string]string `toml:"tags"`        // tags added to every metric
+	TagMapping map[string]string `toml:"tag_mapping"` // tag names, by label name
+}
+
+// Enabled returns whether the StatsD export is configured.
+func (c StatsDConfig) Enabled() bool {
+	return c.Address != ""
+}
+
+// validate checks that the StatsD config is valid.
+func (c StatsDConfig) validate() error {
+	if !c.Enabled() {
+		if c.Format != "" || c.Prefix != "" || c.Interval != 0 || len(c.Tags) > 0 || len(c.TagMapping) > 0 {
+			return fmt.Errorf("statsd: settings given without an address")
+		}
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("statsd: invalid address %q: %w", c.Address, err)
+	}
+	switch c.Format {
+	case "", "dogstatsd", "statsd":
+	default:
+		return fmt.Errorf("statsd: unknown format %q; want dogstatsd or statsd", c.Format)
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("statsd: invalid negative interval %v", c.Interval)
+	}
+	return nil
+}
+
+// MetricsConfig configures the metrics exported by weavelets. For example:
+//
+//	[serviceweaver.metrics.buckets]
+//	serviceweaver_remote_method_latency_micros = [10, 50, 100, 500, 1000, 5000]
+//	batch_job_duration_seconds = [1, 5, 10, 30, 60, 300]
+//
+// Buckets overrides the bucket bounds of the named histograms, including the
+// auto-generated method metrics. The bounds must be strictly increasing.
+//
+// MethodLabelSets is the maximum number of distinct sets of user labels,
+// attached with weaver.WithMetricLabels, recorded in the auto-generated
+// metrics of a method. It defaults to 100.
+type MetricsConfig struct {
+	Buckets         map[string][]float64 `toml:"buckets"`           // histogram bounds, by metric name
+	MethodLabelSets int                  `toml:"method_label_sets"` // label sets per method; 100 if zero
+}
+
+// validate checks that the metrics config is valid.
+func (c MetricsConfig) validate() error {
+	if c.MethodLabelSets < 0 {
+		return fmt.Errorf("metrics: invalid negative method_label_sets %d", c.MethodLabelSets)
+	}
+	for name, bounds := range c.Buckets {
+		if len(bounds) == 0 {
+			return fmt.Errorf("metrics: no buckets given for %q", name)
+		}
+		if err := metrics.CheckBounds(bounds); err != nil {
+			return fmt.Errorf("metrics: %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// TracingConfig configures the tracing of requests. For example:
+//
+//	[serviceweaver.tracing]
+//	sampling = 0.01
+//
+// Sampling is the fraction, between 0 and 1, of traces that are recorded,
+// decided when a trace starts, e.g., when an instrumented HTTP handler
+// receives a request. If nil, every trace is recorded. Spans whose parent is
+// part of a trace take the sampling decision of the parent, unless the span
+// is the call of a component method with its own sampling rate (see
+// ComponentSettings.TraceSampling). Sampling decisions are always respected
+// across processes.
+type TracingConfig struct {
+	Sampling *float64 `toml:"sampling"`
+}
+
+// validate checks that the tracing config is valid.
+func (c TracingConfig) validate() error {
+	if c.Sampling != nil && (*c.Sampling < 0 || *c.Sampling > 1) {
+		return fmt.Errorf("tracing: invalid sampling %v not between 0 and 1", *c.Sampling)
+	}
+	return nil
+}
+
+// Profiling backends.
+const (
+	PyroscopeBackend     = "pyroscope"
+	CloudProfilerBackend = "cloud_profiler"
+)
+
+// ProfilingConfig configures the continuous profiling of weavelets. Every
+// weavelet periodically profiles its OS process and uploads the profiles to a
+// profiling backend, either Pyroscope or Google Cloud Profiler. For example:
+//
+//	[serviceweaver.profiling]
+//	backend = "pyroscope"
+//	endpoint = "http://localhost:4040"
+//	interval = "1m"
+//	types = ["cpu", "heap"]
+//
+// or
+//
+//	[serviceweaver.profiling]
+//	backend = "cloud_profiler"
+//	project = "my-gcp-project"
+//
+// The profiles are tagged with the application name, the deployment id, the
+// colocation group, and the weavelet id.
+type ProfilingConfig struct {
+	Backend  string            `toml:"backend"`  // "pyroscope" or "cloud_profiler"; empty disables profiling
+	Endpoint string            `toml:"endpoint"` // backend base URL; required for pyroscope
+	Project  string            `toml:"project"`  // Google Cloud project; required for cloud_profiler
+	Interval time.Duration     `toml:"interval"` // time between two rounds of profiles; 1 minute if zero
+	Duration time.Duration     `toml:"duration"` // duration of CPU profiles; 10 seconds if zero
+	Types    []string          `toml:"types"`    // "cpu", "heap", or "goroutine"; cpu and heap if empty
+	Headers  map[string]string `toml:"headers"`  // HTTP headers sent with every upload
+}
+
+// Enabled returns whether continuous profiling is configured.
+func (c ProfilingConfig) Enabled() bool {
+	return c.Backend != ""
+}
+
+// ProfileTypes returns the types of the profiles to capture.
+func (c ProfilingConfig) ProfileTypes() []protos.ProfileType {
+	if len(c.Types) == 0 {
+		return []protos.ProfileType{protos.ProfileType_CPU, protos.ProfileType_Heap}
+	}
+	types := make([]protos.ProfileType, len(c.Types))
+	for i, t := range c.Types {
+		types[i] = profileTypes[t]
+	}
+	return types
+}
+
+// profileTypes maps the profile type names in the config to profile types.
+var profileTypes = map[string]protos.ProfileType{
+	"cpu":       protos.ProfileType_CPU,
+	"heap":      protos.ProfileType_Heap,
+	"goroutine": protos.ProfileType_Goroutine,
+}
+
+// validate checks that the profiling config is valid.
+func (c ProfilingConfig) validate() error {
+	switch c.Backend {
+	case "":
+		if c.Endpoint != "" || c.Project != "" || c.Interval != 0 || c.Duration != 0 || len(c.Types) > 0 || len(c.Headers) > 0 {
+			return fmt.Errorf("profiling: settings given without a backend")
+		}
+		return nil
+	case PyroscopeBackend:
+		if c.Endpoint == "" {
+			return fmt.Errorf("profiling: missing endpoint for backend %q", c.Backend)
+		}
+		if c.Project != "" {
+			return fmt.Errorf("profiling: project given for backend %q", c.Backend)
+		}
+	case CloudProfilerBackend:
+		if c.Project == "" {
+			return fmt.Errorf("profiling: missing project for backend %q", c.Backend)
+		}
+	default:
+		return fmt.Errorf("profiling: unknown backend %q; want %q or %q", c.Backend, PyroscopeBackend, CloudProfilerBackend)
+	}
+	if c.Endpoint != "" {
+		u, err := url.Parse(c.Endpoint)
+		if err != nil {
+			return fmt.Errorf("profiling: invalid endpoint %q: %w", c.Endpoint, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("profiling: endpoint %q is not an http or https URL", c.Endpoint)
+		}
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("profiling: invalid negative interval %v", c.Interval)
+	}
+	if c.Duration < 0 {
+		return fmt.Errorf("profiling: invalid negative duration %v", c.Duration)
+	}
+	if c.Interval != 0 && c.Duration > c.Interval {
+		return fmt.Errorf("profiling: duration %v is longer than interval %v", c.Duration, c.Interval)
+	}
+	for _, t := range c.Types {
+		if _, ok := profileTypes[t]; !ok {
+			return fmt.Errorf("profiling: unknown profile type %q; want cpu, heap, or goroutine", t)
+		}
+	}
+	return nil
+}
+
+// ParseWeaveletConfig returns the weavelet settings in the app section of the
+// provided config sections.
+func ParseWeaveletConfig(sections map[string]string) (*WeaveletConfig, error) {
+	parsed, err := parseAppConfig(sections)
+	if err != nil {
+		return nil, err
+	}
+	if err := parsed.WeaveletConfig.validate(); err != nil {
+		return nil, err
+	}
+	return &parsed.WeaveletConfig, nil
+}
+
+// CheckConfigUpdate checks that the config sections of a running
+// application can be updated from old to new. Component sections can be
+// updated freely, but the app section can only be changed by redeploying the
+// application.
+func CheckConfigUpdate(old, new map[string]string) error {
+	for _, key := range []string{appKey, shortAppKey} {
+		if old[key] != new[key] {
+			return fmt.Errorf("section %q cannot be updated without redeploying the application", key)
+		}
+	}
 	return nil
 }
 
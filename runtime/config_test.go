@@ -16,9 +16,11 @@ package runtime_test
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ServiceWeaver/weaver/runtime"
 	"github.com/ServiceWeaver/weaver/runtime/codegen"
@@ -102,6 +104,265 @@ func TestParseConfigSection(t *testing.T) {
 	}
 }
 
+func TestMetricsConfig(t *testing.T) {
+	const cfg = `
+[serviceweaver.metrics.buckets]
+cache_latency_ms = [0.1, 0.5, 1]
+job_duration_seconds = [1, 10, 60]
+`
+	config, err := runtime.ParseConfig("weaver.toml", cfg, codegen.ComponentConfigValidator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := runtime.ParseWeaveletConfig(config.Sections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]float64{
+		"cache_latency_ms":     {0.1, 0.5, 1},
+		"job_duration_seconds": {1, 10, 60},
+	}
+	if diff := cmp.Diff(want, got.Metrics.Buckets); diff != "" {
+		t.Fatalf("buckets (-want +got):\n%s", diff)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{"HOST": "redis.internal", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	for _, c := range []struct{ input, want string }{
+		{`host = "${HOST}"`, `host = "redis.internal"`},
+		{`host = "${HOST}:6379"`, `host = "redis.internal:6379"`},
+		{`host = "${HOST:-localhost}"`, `host = "redis.internal"`},
+		{`host = "${UNSET:-localhost:6379}"`, `host = "localhost:6379"`},
+		{`host = "${EMPTY:-localhost}"`, `host = "localhost"`},
+		{`host = "${EMPTY}"`, `host = ""`},
+		{`host = "${UNSET:-}"`, `host = ""`},
+		{`host = "$${HOST}"`, `host = "${HOST}"`},
+		{`price = "$HOST"`, `price = "$HOST"`},
+	} {
+		got, err := runtime.ExpandEnv(c.input, lookup)
+		if err != nil {
+			t.Errorf("ExpandEnv(%q): %v", c.input, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ExpandEnv(%q): got %q, want %q", c.input, got, c.want)
+		}
+	}
+
+	_, err := runtime.ExpandEnv(`host = "${UNSET}"`, lookup)
+	if err == nil || !strings.Contains(err.Error(), "UNSET") {
+		t.Errorf("ExpandEnv: got %v, want error for UNSET", err)
+	}
+}
+
+func TestParseConfigExpandsEnv(t *testing.T) {
+	t.Setenv("WEAVER_TEST_SHUTDOWN_TIMEOUT", "5s")
+	t.Setenv("WEAVER_TEST_GREETING", "Hi\"\nRepeat = 100 # ")
+	const cfg = `
+# References in comments, like ${WEAVER_TEST_UNSET}, are not expanded.
+[serviceweaver]
+name = "${WEAVER_TEST_APP:-collatz}"
+shutdown_timeout = "${WEAVER_TEST_SHUTDOWN_TIMEOUT}"
+
+["example.com/mypkg/Greeter"]
+Greeting = "${WEAVER_TEST_GREETING}"
+Template = "$${WEAVER_TEST_GREETING}"
+`
+	config, err := runtime.ParseConfig("weaver.toml", cfg, codegen.ComponentConfigValidator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Name != "collatz" {
+		t.Errorf("name: got %q, want %q", config.Name, "collatz")
+	}
+
+	// Expanded values are not parsed, so they can't inject config.
+	type greeterConfig struct {
+		Greeting string
+		Template string
+		Repeat   int
+	}
+	var got greeterConfig
+	if err := runtime.ParseConfigSection("example.com/mypkg/Greeter", "", config.Sections, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := greeterConfig{Greeting: "Hi\"\nRepeat = 100 # ", Template: "${WEAVER_TEST_GREETING}"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("greeter config (-want +got):\n%s", diff)
+	}
+	wc, err := runtime.ParseWeaveletConfig(config.Sections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wc.ShutdownTimeout != 5*time.Second {
+		t.Errorf("shutdown_timeout: got %v, want 5s", wc.ShutdownTimeout)
+	}
+
+	const unset = `
+[serviceweaver]
+name = "collatz"
+args = ["--host=${WEAVER_TEST_UNSET}"]
+`
+	_, err = runtime.ParseConfig("weaver.toml", unset, codegen.ComponentConfigValidator)
+	if err == nil || !strings.Contains(err.Error(), "WEAVER_TEST_UNSET") {
+		t.Errorf("ParseConfig: got %v, want error for WEAVER_TEST_UNSET", err)
+	}
+}
+
+func TestParseConfigFormats(t *testing.T) {
+	type greeterConfig struct {
+		Greeting string
+		Repeat   int
+		Weights  map[string]float64
+	}
+	want := greeterConfig{"Bonjour", 3, map[string]float64{"a": 0.5, "b": 2}}
+	for _, c := range []struct{ file, cfg string }{
+		{"weaver.toml", `
+[serviceweaver]
+name = "hello"
+shutdown_timeout = "5s"
+
+["example.com/mypkg/Greeter"]
+Greeting = "Bonjour"
+Repeat = 3
+Weights = {a = 0.5, b = 2.0}
+`},
+		{"weaver.yaml", `
+serviceweaver:
+  name: hello
+  shutdown_timeout: 5s
+
+# Comments and anchors are allowed.
+defaults: &defaults
+  Repeat: 3
+
+example.com/mypkg/Greeter:
+  <<: *defaults
+  Greeting: Bonjour
+  Weights: {a: 0.5, b: 2}
+`},
+		{"weaver.json", `{
+  "serviceweaver": {"name": "hello", "shutdown_timeout": "5s"},
+  "example.com/mypkg/Greeter": {"Greeting": "Bonjour", "Repeat": 3, "Weights": {"a": 0.5, "b": 2}}
+}`},
+	} {
+		t.Run(c.file, func(t *testing.T) {
+			config, err := runtime.ParseConfig(c.file, c.cfg, codegen.ComponentConfigValidator)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Name != "hello" {
+				t.Errorf("name: got %q, want %q", config.Name, "hello")
+			}
+			wc, err := runtime.ParseWeaveletConfig(config.Sections)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wc.ShutdownTimeout != 5*time.Second {
+				t.Errorf("shutdown_timeout: got %v, want 5s", wc.ShutdownTimeout)
+			}
+			var got greeterConfig
+			if err := runtime.ParseConfigSection("example.com/mypkg/Greeter", "", config.Sections, &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("greeter config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	// Write a base config file and an overlay in a different directory.
+	dir := t.TempDir()
+	base := filepath.Join(dir, "weaver.toml")
+	overlay := filepath.Join(dir, "prod", "weaver.yaml")
+	if err := os.MkdirAll(filepath.Dir(overlay), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(base, []byte(`
+[serviceweaver]
+name = "hello"
+binary = "./hello"
+shutdown_timeout = "5s"
+
+["example.com/mypkg/Cache"]
+Host = "localhost:6379"
+Size = 100
+Tags = ["dev"]
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(overlay, []byte(`
+github.com/ServiceWeaver/weaver:
+  shutdown_timeout: 30s
+
+example.com/mypkg/Cache:
+  Host: redis.prod:6379
+  Tags: [prod]
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := runtime.LoadConfig([]string{base, overlay}, codegen.ComponentConfigValidator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "hello"); config.Binary != want {
+		t.Errorf("binary: got %q, want %q", config.Binary, want)
+	}
+	wc, err := runtime.ParseWeaveletConfig(config.Sections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wc.ShutdownTimeout != 30*time.Second {
+		t.Errorf("shutdown_timeout: got %v, want 30s", wc.ShutdownTimeout)
+	}
+	type cacheConfig struct {
+		Host string
+		Size int
+		Tags []string
+	}
+	var got cacheConfig
+	if err := runtime.ParseConfigSection("example.com/mypkg/Cache", "", config.Sections, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := cacheConfig{"redis.prod:6379", 100, []string{"prod"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("cache config (-want +got):\n%s", diff)
+	}
+}
+
+func TestCheckConfigUpdate(t *testing.T) {
+	old := map[string]string{
+		"serviceweaver": `name = "app"`,
+		"pkg/Cache":     `size = 10`,
+	}
+	for _, c := range []struct {
+		name    string
+		new     map[string]string
+		wantErr bool
+	}{
+		{"unchanged", old, false},
+		{"component", map[string]string{"serviceweaver": `name = "app"`, "pkg/Cache": `size = 20`}, false},
+		{"new component", map[string]string{"serviceweaver": `name = "app"`, "pkg/Other": `x = 1`}, false},
+		{"app", map[string]string{"serviceweaver": `name = "other"`, "pkg/Cache": `size = 10`}, true},
+		{"long app key", map[string]string{"serviceweaver": `name = "app"`, "github.com/ServiceWeaver/weaver": `name = "app"`}, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			err := runtime.CheckConfigUpdate(old, c.new)
+			if gotErr := err != nil; gotErr != c.wantErr {
+				t.Fatalf("CheckConfigUpdate: got %v, want error %t", err, c.wantErr)
+			}
+		})
+	}
+}
+
 func TestConfigErrors(t *testing.T) {
 	type testCase struct {
 		name          string
@@ -152,6 +413,243 @@ rollout = "hello"
 `,
 			expectedError: "invalid duration",
 		},
+		{
+			name: "negative shutdown timeout",
+			cfg: `
+[serviceweaver]
+shutdown_timeout = "-1s"
+`,
+			expectedError: "invalid negative shutdown_timeout",
+		},
+		{
+			name: "max message size too large",
+			cfg: `
+[serviceweaver]
+max_message_size = 1_000_000_000
+`,
+			expectedError: "larger than the maximum",
+		},
+		{
+			name: "incomplete tls",
+			cfg: `
+[serviceweaver.tls]
+cert_file = "/etc/weaver/cert.pem"
+`,
+			expectedError: "missing key_file",
+		},
+		{
+			name: "relative tls path",
+			cfg: `
+[serviceweaver.tls]
+cert_file = "cert.pem"
+key_file = "/etc/weaver/key.pem"
+ca_file = "/etc/weaver/ca.pem"
+`,
+			expectedError: "not an absolute path",
+		},
+		{
+			name: "relative audit dir",
+			cfg: `
+[serviceweaver.audit]
+dir = "audit"
+`,
+			expectedError: "not an absolute path",
+		},
+		{
+			name: "relative snapshots dir",
+			cfg: `
+[serviceweaver.snapshots]
+dir = "snapshots"
+`,
+			expectedError: "not an absolute path",
+		},
+		{
+			name: "relative recording dir",
+			cfg: `
+[serviceweaver.recording]
+dir = "recordings"
+`,
+			expectedError: "not an absolute path",
+		},
+		{
+			name: "listener without key file",
+			cfg: `
+[serviceweaver.listeners.api]
+cert_file = "/etc/weaver/api.pem"
+`,
+			expectedError: "cert_file and key_file must be set together",
+		},
+		{
+			name: "negative listener backlog",
+			cfg: `
+[serviceweaver.listeners.api]
+backlog = -1
+`,
+			expectedError: "invalid negative backlog",
+		},
+		{
+			name: "negative listener drain timeout",
+			cfg: `
+[serviceweaver.listeners.api]
+drain_timeout = "-1s"
+`,
+			expectedError: "invalid negative drain_timeout",
+		},
+		{
+			name: "invalid trust domain",
+			cfg: `
+[serviceweaver.tls]
+cert_file = "/etc/weaver/cert.pem"
+key_file = "/etc/weaver/key.pem"
+ca_file = "/etc/weaver/ca.pem"
+trust_domain = "spiffe://Example.org"
+`,
+			expectedError: "invalid trust_domain",
+		},
+		{
+			name: "empty identity component",
+			cfg: `
+[serviceweaver.tls]
+cert_file = "/etc/weaver/cert.pem"
+key_file = "/etc/weaver/key.pem"
+ca_file = "/etc/weaver/ca.pem"
+identities = {checkout = [""]}
+`,
+			expectedError: "empty component name",
+		},
+		{
+			name: "tls files and workload api",
+			cfg: `
+[serviceweaver.tls]
+cert_file = "/etc/weaver/cert.pem"
+workload_api = "unix:///run/spire/sockets/agent.sock"
+`,
+			expectedError: "cert_file and workload_api are mutually exclusive",
+		},
+		{
+			name: "invalid workload api",
+			cfg: `
+[serviceweaver.tls]
+workload_api = "/run/spire/sockets/agent.sock"
+`,
+			expectedError: "not a unix: or tcp: address",
+		},
+		{
+			name: "unknown transport",
+			cfg: `
+[serviceweaver]
+transport = "quic"
+`,
+			expectedError: "unknown transport",
+		},
+		{
+			name: "unknown compression algorithm",
+			cfg: `
+[serviceweaver.compression]
+algorithm = "gzip"
+`,
+			expectedError: "unknown algorithm",
+		},
+		{
+			name: "negative compression threshold",
+			cfg: `
+[serviceweaver.compression]
+algorithm = "zstd"
+threshold = -1
+`,
+			expectedError: "invalid negative threshold",
+		},
+		{
+			name: "relative prometheus path",
+			cfg: `
+[serviceweaver.prometheus]
+address = ":9464"
+path = "metrics"
+`,
+			expectedError: "does not start with /",
+		},
+		{
+			name: "bad otlp endpoint",
+			cfg: `
+[serviceweaver.otlp]
+endpoint = "localhost:4318"
+`,
+			expectedError: "not an http or https URL",
+		},
+		{
+			name: "bad statsd format",
+			cfg: `
+[serviceweaver.statsd]
+address = "localhost:8125"
+format = "graphite"
+`,
+			expectedError: "unknown format",
+		},
+		{
+			name: "bad metric buckets",
+			cfg: `
+[serviceweaver.metrics.buckets]
+latency = [10, 5, 1]
+`,
+			expectedError: "non-ascending histogram bounds",
+		},
+		{
+			name: "bad method label sets",
+			cfg: `
+[serviceweaver.metrics]
+method_label_sets = -1
+`,
+			expectedError: "invalid negative method_label_sets",
+		},
+		{
+			name: "bad trace sampling",
+			cfg: `
+[serviceweaver.tracing]
+sampling = 2.0
+`,
+			expectedError: "invalid sampling",
+		},
+		{
+			name: "top-level value",
+			cfg: `
+name = "foo"
+`,
+			expectedError: "not a section",
+		},
+		{
+			name: "unset environment variable",
+			cfg: `
+[serviceweaver]
+name = "${WEAVER_TEST_UNSET}"
+`,
+			expectedError: "WEAVER_TEST_UNSET",
+		},
+		{
+			name: "unknown profiling backend",
+			cfg: `
+[serviceweaver.profiling]
+backend = "pprof"
+`,
+			expectedError: "unknown backend",
+		},
+		{
+			name: "missing profiling project",
+			cfg: `
+[serviceweaver.profiling]
+backend = "cloud_profiler"
+`,
+			expectedError: "missing project",
+		},
+		{
+			name: "unknown profile type",
+			cfg: `
+[serviceweaver.profiling]
+backend = "pyroscope"
+endpoint = "http://localhost:4040"
+types = ["cpu", "threads"]
+`,
+			expectedError: "unknown profile type",
+		},
 	} {
 		t.Run(c.name, func(t *testing.T) {
 			_, err := runtime.ParseConfig("weaver.toml", c.cfg, codegen.ComponentConfigValidator)
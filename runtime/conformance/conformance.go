@@ -0,0 +1,431 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package conformance checks that a weavelet implements the weavelet protocol.
+//
+// Service Weaver deployers run every weavelet through an envelope, and
+// weavelets call each other's components over RPC. A weavelet written in a
+// language other than Go can join a deployment as long as it implements both
+// protocols, as specified in the "Weavelet Protocol" section of the Service
+// Weaver documentation. Run launches a weavelet binary under an envelope and
+// checks the behavior that every weavelet must exhibit:
+//
+//   - it accepts the WeaveletInfo handshake and registers a replica with a
+//     dialable TCP address;
+//   - it answers health and metrics requests from the envelope; and
+//   - its RPC server performs the version handshake, answers the "ready"
+//     method, reports unknown methods as errors, and tolerates cancellations.
+//
+// For example, a Python weavelet can be checked with a Go test like this:
+//
+//	func TestPythonWeavelet(t *testing.T) {
+//	    conformance.Run(t, conformance.Options{
+//	        Binary: "python3",
+//	        Args:   []string{"weavelet.py"},
+//	    })
+//	}
+package conformance
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/colors"
+	"github.com/ServiceWeaver/weaver/runtime/envelope"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Options configures a conformance run.
+type Options struct {
+	// Binary and Args are the weavelet command to run.
+	Binary string
+	Args   []string
+
+	// Env holds extra environment variables, in the form "KEY=value",
+	// passed to the weavelet.
+	Env []string
+
+	// Timeout bounds how long to wait for each step of the protocol, e.g.,
+	// for the weavelet to register its replica. Defaults to 30 seconds.
+	Timeout time.Duration
+
+	// Logf, if not nil, receives the weavelet's log entries. Defaults to
+	// t.Logf.
+	Logf func(format string, args ...any)
+}
+
+// RPC message types. See the "RPC Protocol" section of the documentation.
+const (
+	versionMessage  = 0
+	requestMessage  = 1
+	responseMessage = 2
+	responseError   = 3
+	cancelMessage   = 4
+)
+
+// rpcVersion is the RPC protocol version spoken by Run.
+const rpcVersion = 0
+
+// Run runs the weavelet described by opts under an envelope and checks that
+// it implements the weavelet protocol. Every check is reported as a subtest
+// of t.
+func Run(t *testing.T, opts Options) {
+	t.Helper()
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.Logf == nil {
+		opts.Logf = t.Logf
+	}
+
+	wlet := &protos.WeaveletInfo{
+		App:               "conformance",
+		DeploymentId:      uuid.New().String(),
+		Group:             &protos.ColocationGroup{Name: "main"},
+		GroupId:           uuid.New().String(),
+		Process:           "main",
+		Id:                uuid.New().String(),
+		UseLocalhost:      true,
+		ProcessPicksPorts: true,
+		ProtocolVersion:   runtime.ProtocolVersion,
+	}
+	config := &protos.AppConfig{
+		Name:   "conformance",
+		Binary: opts.Binary,
+		Args:   opts.Args,
+		Env:    opts.Env,
+	}
+	h := &handler{
+		logf:     opts.Logf,
+		pp:       logging.NewPrettyPrinter(colors.Enabled()),
+		done:     make(chan struct{}),
+		replicas: make(chan *protos.ReplicaToRegister, 16),
+	}
+	e, err := envelope.NewEnvelope(wlet, config, h, envelope.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- e.Run(ctx) }()
+	defer func() {
+		close(h.done)
+		cancel()
+		e.Stop() //nolint:errcheck // the weavelet is killed either way
+		<-errs
+	}()
+
+	// The weavelet must register a replica. Everything else depends on it.
+	var replica *protos.ReplicaToRegister
+	select {
+	case replica = <-h.replicas:
+	case err := <-errs:
+		t.Fatalf("weavelet exited before registering a replica: %v", err)
+	case <-time.After(opts.Timeout):
+		t.Fatalf("weavelet did not register a replica within %v", opts.Timeout)
+	}
+
+	var addr string
+	t.Run("RegisterReplica", func(t *testing.T) {
+		if replica.App != wlet.App || replica.DeploymentId != wlet.DeploymentId || replica.Process != wlet.Process {
+			t.Errorf("replica %v does not match weavelet %v", replica, wlet)
+		}
+		if replica.Pid <= 0 {
+			t.Errorf("replica pid: got %d, want > 0", replica.Pid)
+		}
+		a, err := parseAddress(replica.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr = a
+	})
+
+	t.Run("HealthStatus", func(t *testing.T) {
+		if got, want := e.HealthStatus(), protos.HealthStatus_HEALTHY; got != want {
+			t.Errorf("health status: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		if _, err := e.ReadMetrics(); err != nil {
+			t.Errorf("metrics: %v", err)
+		}
+	})
+
+	if addr == "" {
+		return
+	}
+	t.Run("RPC", func(t *testing.T) {
+		c, err := dial(addr, opts.Timeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		t.Run("Version", func(t *testing.T) {
+			if err := c.handshake(); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if t.Failed() {
+			return
+		}
+
+		t.Run("Ready", func(t *testing.T) {
+			mt, payload, err := c.call(methodKey("", "ready"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mt != responseMessage {
+				t.Fatalf("ready: got message type %d (%q), want %d", mt, payload, responseMessage)
+			}
+		})
+
+		t.Run("UnknownMethod", func(t *testing.T) {
+			mt, payload, err := c.call(methodKey("conformance", "NoSuchMethod"), []byte("args"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mt != responseError {
+				t.Fatalf("unknown method: got message type %d, want %d", mt, responseError)
+			}
+			if err := decodeError(payload); err == nil {
+				t.Fatal("unknown method: got nil error, want non-nil")
+			}
+		})
+
+		t.Run("Cancel", func(t *testing.T) {
+			// Cancelling a call the server does not know about must be a
+			// no-op that leaves the connection usable.
+			if err := c.write(cancelMessage, 1<<40, nil); err != nil {
+				t.Fatal(err)
+			}
+			mt, _, err := c.call(methodKey("", "ready"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mt != responseMessage {
+				t.Fatalf("ready after cancel: got message type %d, want %d", mt, responseMessage)
+			}
+		})
+	})
+}
+
+// parseAddress parses a replica address of the form
+// "tcp://host:port[#locality]" and returns "host:port".
+func parseAddress(address string) (string, error) {
+	if !strings.HasPrefix(address, "tcp://") {
+		return "", fmt.Errorf("replica address %q: want tcp://host:port", address)
+	}
+	hostport, _, _ := strings.Cut(strings.TrimPrefix(address, "tcp://"), "#")
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		return "", fmt.Errorf("replica address %q: %w", address, err)
+	}
+	return hostport, nil
+}
+
+// methodKey returns the key of the provided method, i.e., the first 16 bytes
+// of the SHA-256 hash of "<component>.<method>".
+func methodKey(component, method string) [16]byte {
+	sum := sha256.Sum256([]byte(component + "." + method))
+	var key [16]byte
+	copy(key[:], sum[:])
+	return key
+}
+
+// decodeError decodes an error encoded in a responseError message.
+func decodeError(payload []byte) (err error) {
+	defer func() {
+		if x := codegen.CatchPanics(recover()); x != nil {
+			err = fmt.Errorf("malformed error: %w", x)
+		}
+	}()
+	return codegen.NewDecoder(payload).Error()
+}
+
+// rpcConn is a client connection speaking the RPC protocol. It is written
+// from the specification, rather than on top of the Go implementation, so
+// that it checks the wire format.
+type rpcConn struct {
+	net.Conn
+	timeout time.Duration
+	nextID  uint64
+}
+
+// dial connects to the weavelet listening on addr.
+func dial(addr string, timeout time.Duration) (*rpcConn, error) {
+	c, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcConn{Conn: c, timeout: timeout}, nil
+}
+
+// handshake exchanges version messages with the server.
+func (c *rpcConn) handshake() error {
+	var v [4]byte
+	binary.LittleEndian.PutUint32(v[:], rpcVersion)
+	if err := c.write(versionMessage, 0, v[:]); err != nil {
+		return err
+	}
+	mt, id, payload, err := c.read()
+	if err != nil {
+		return err
+	}
+	if mt != versionMessage || id != 0 {
+		return fmt.Errorf("handshake: got message type %d with id %d, want type %d with id 0", mt, id, versionMessage)
+	}
+	if len(payload) < 4 {
+		return fmt.Errorf("handshake: version payload has %d bytes, want >= 4", len(payload))
+	}
+	return nil
+}
+
+// call issues a request for the provided method and returns the type and
+// payload of the matching reply. The request carries a deadline and a trace
+// context, both of which the server must accept.
+func (c *rpcConn) call(key [16]byte, args []byte) (byte, []byte, error) {
+	c.nextID++
+	id := c.nextID
+	hdr := make([]byte, 16+8+25, 16+8+25+len(args))
+	copy(hdr, key[:])
+	binary.LittleEndian.PutUint64(hdr[16:], uint64(c.timeout.Microseconds()))
+	hdr[24] = 1 // trace id
+	hdr[40] = 1 // span id
+	hdr[48] = 1 // sampled
+	if err := c.write(requestMessage, id, append(hdr, args...)); err != nil {
+		return 0, nil, err
+	}
+	for {
+		mt, got, payload, err := c.read()
+		if err != nil {
+			return 0, nil, err
+		}
+		if got != id {
+			// A reply to an earlier call, e.g., one that was cancelled.
+			continue
+		}
+		if mt != responseMessage && mt != responseError {
+			return 0, nil, fmt.Errorf("call: got message type %d, want %d or %d", mt, responseMessage, responseError)
+		}
+		return mt, payload, nil
+	}
+}
+
+// write writes a message.
+func (c *rpcConn) write(mt byte, id uint64, payload []byte) error {
+	msg := make([]byte, 16+len(payload))
+	binary.LittleEndian.PutUint64(msg, id)
+	binary.LittleEndian.PutUint64(msg[8:], uint64(mt)|uint64(len(payload))<<8)
+	copy(msg[16:], payload)
+	if err := c.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	_, err := c.Write(msg)
+	return err
+}
+
+// read reads a message.
+func (c *rpcConn) read() (byte, uint64, []byte, error) {
+	if err := c.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, 0, nil, err
+	}
+	var hdr [16]byte
+	if _, err := io.ReadFull(c, hdr[:]); err != nil {
+		return 0, 0, nil, fmt.Errorf("read header: %w", err)
+	}
+	id := binary.LittleEndian.Uint64(hdr[:])
+	x := binary.LittleEndian.Uint64(hdr[8:])
+	mt, n := byte(x), x>>8
+	const maxSize = 100 << 20
+	if n > maxSize {
+		return 0, 0, nil, fmt.Errorf("read: message of %d bytes exceeds the %d byte limit", n, maxSize)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c, payload); err != nil {
+		return 0, 0, nil, fmt.Errorf("read payload: %w", err)
+	}
+	return mt, id, payload, nil
+}
+
+// handler is the envelope.EnvelopeHandler used by Run. It records replica
+// registrations and parks the blocking requests until Run finishes.
+type handler struct {
+	logf     func(format string, args ...any)
+	pp       *logging.PrettyPrinter
+	done     chan struct{}
+	replicas chan *protos.ReplicaToRegister
+}
+
+var _ envelope.EnvelopeHandler = &handler{}
+
+var errDone = errors.New("conformance run finished")
+
+func (h *handler) RecvLogEntry(entry *protos.LogEntry) {
+	select {
+	case <-h.done:
+		// Run has returned, and t.Logf may no longer be called.
+	default:
+		h.logf("%s", h.pp.Format(entry))
+	}
+}
+
+func (h *handler) RecvTraceSpans([]trace.ReadOnlySpan) error          { return nil }
+func (h *handler) StartComponent(*protos.ComponentToStart) error      { return nil }
+func (h *handler) StartColocationGroup(*protos.ColocationGroup) error { return nil }
+func (h *handler) ReportLoad(*protos.WeaveletLoadReport) error        { return nil }
+
+func (h *handler) RegisterReplica(replica *protos.ReplicaToRegister) error {
+	select {
+	case h.replicas <- replica:
+	default:
+	}
+	return nil
+}
+
+func (h *handler) GetAddress(*protos.GetAddressRequest) (*protos.GetAddressReply, error) {
+	return &protos.GetAddressReply{Address: "localhost:0"}, nil
+}
+
+func (h *handler) ExportListener(*protos.ExportListenerRequest) (*protos.ExportListenerReply, error) {
+	return &protos.ExportListenerReply{}, nil
+}
+
+func (h *handler) ElectLeader(*protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error) {
+	return &protos.LeaderElectionReply{}, nil
+}
+
+func (h *handler) GetRoutingInfo(*protos.GetRoutingInfo) (*protos.RoutingInfo, error) {
+	<-h.done
+	return nil, errDone
+}
+
+func (h *handler) GetComponentsToStart(*protos.GetComponentsToStart) (*protos.ComponentsToStart, error) {
+	<-h.done
+	return nil, errDone
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conformance_test
+
+import (
+	"context"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/runtime/conformance"
+)
+
+func TestMain(m *testing.M) {
+	// When run with the "weavelet" subcommand, this test binary acts as the
+	// weavelet under test instead of running the tests.
+	flag.Parse()
+	if flag.Arg(0) == "weavelet" {
+		weaver.Init(context.Background())
+		select {}
+	}
+	os.Exit(m.Run())
+}
+
+func TestGoWeavelet(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conformance.Run(t, conformance.Options{
+		Binary: executable,
+		Args:   []string{"weavelet"},
+	})
+}
@@ -26,6 +26,7 @@ import (
 	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/ServiceWeaver/weaver/internal/envelope/conn"
 	"github.com/ServiceWeaver/weaver/internal/logtype"
@@ -33,6 +34,7 @@ import (
 	"github.com/ServiceWeaver/weaver/runtime"
 	"github.com/ServiceWeaver/weaver/runtime/logging"
 	"github.com/ServiceWeaver/weaver/runtime/metrics"
+	"github.com/ServiceWeaver/weaver/runtime/protomsg"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
 	"github.com/ServiceWeaver/weaver/runtime/retry"
 	"go.opentelemetry.io/otel/sdk/trace"
@@ -59,6 +61,10 @@ type EnvelopeHandler interface {
 	// ExportListener exports the given listener.
 	ExportListener(req *protos.ExportListenerRequest) (*protos.ExportListenerReply, error)
 
+	// ElectLeader acquires, renews, or releases the lease on the leadership
+	// of an election.
+	ElectLeader(req *protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error)
+
 	// GetRoutingInfo returns the latest routing information for the weavelet.
 	//
 	// This is a blocking method that can be processed out-of-order w.r.t.
@@ -144,9 +150,11 @@ type Envelope struct {
 
 	mu        sync.Mutex         // guards the following fields
 	process   *os.Process        // the currently running subprocess, or nil
+	exited    chan struct{}      // closed when process exits
 	conn      *conn.EnvelopeConn // conn to weavelet
 	stopped   bool               // has Stop() been called?
 	profiling bool               // are we currently collecting a profile?
+	sections  map[string]string  // updated config sections, or nil
 }
 
 func NewEnvelope(wlet *protos.WeaveletInfo, config *protos.AppConfig, h EnvelopeHandler, opts Options) (*Envelope, error) {
@@ -259,6 +267,34 @@ func (e *Envelope) RunProfiling(_ context.Context, req *protos.RunProfiling) (*p
 	return prof, nil
 }
 
+// UpdateConfig pushes the provided config sections to the weavelet, which
+// applies them to its running components. The sections are also used if the
+// weavelet is restarted.
+func (e *Envelope) UpdateConfig(sections map[string]string) error {
+	e.mu.Lock()
+	e.sections = sections
+	conn := e.conn
+	e.mu.Unlock()
+	if conn == nil {
+		// The weavelet is not running. It will receive the sections when it
+		// is (re)started.
+		return nil
+	}
+	return conn.UpdateConfigRPC(sections)
+}
+
+// weaveletInfo returns the information sent to a newly started weavelet.
+func (e *Envelope) weaveletInfo() *protos.WeaveletInfo {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.sections == nil {
+		return e.weavelet
+	}
+	wlet := protomsg.Clone(e.weavelet)
+	wlet.Sections = e.sections
+	return wlet
+}
+
 // runWeavelet with the provided environment and wait for it to terminate.
 //
 // It returns true,_ if some incoming argument is bad any retries should be stopped.
@@ -279,7 +315,7 @@ func (e *Envelope) runWeavelet(ctx context.Context) (bool, error) {
 		return false, fmt.Errorf("cannot create weavelet response pipe: %w", err)
 	}
 
-	conn, err := conn.NewEnvelopeConn(toEnvelope, toWeavelet, e.handler, e.weavelet)
+	conn, err := conn.NewEnvelopeConn(toEnvelope, toWeavelet, e.handler, e.weaveletInfo())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Unable to start envelope conn: %v\n", err)
 		return false, err
@@ -322,8 +358,10 @@ func (e *Envelope) runWeavelet(ctx context.Context) (bool, error) {
 	if err := cmd.Start(); err != nil {
 		return false, err
 	}
+	exited := make(chan struct{})
 	e.mu.Lock()
 	e.process = cmd.Process
+	e.exited = exited
 	e.mu.Unlock()
 
 	// Set the connection only after the weavelet information was sent to the
@@ -332,46 +370,92 @@ func (e *Envelope) runWeavelet(ctx context.Context) (bool, error) {
 	e.setConn(conn)
 
 	// Wait for the command to terminate.
-	//
-	// NOTE(mwhittaker): Stop also calls Wait. If Stop is called, then the
-	// redundant wait leads to a "waitid: no child processes" error which we
-	// ignore.
 	wait.Wait()
 	runErr := cmd.Wait()
+	e.mu.Lock()
+	e.process = nil
+	e.conn = nil
+	close(exited)
+	e.mu.Unlock()
 	for _, err := range []error{runErr, stdoutErr, stderrErr, weaveletConnErr} {
 		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrClosed) && !errors.Is(err, syscall.ECHILD) {
 			return false, err
 		}
 	}
-	e.mu.Lock()
-	e.process = nil
-	e.conn = nil
-	e.mu.Unlock()
 	return false, nil
 }
 
 // Stop permanently terminates the weavelet process managed by the envelope.
+//
+// Stop first asks the weavelet to shut down gracefully by sending it SIGTERM,
+// which lets the weavelet drain its listeners and calls and run the Shutdown
+// methods of its components. If the weavelet is still running once its stop
+// timeout has elapsed (see runtime.WeaveletConfig.StopTimeout), Stop kills
+// it. Stop returns once the weavelet has exited.
 func (e *Envelope) Stop() error {
 	e.mu.Lock()
-	defer e.mu.Unlock()
 	e.stopped = true
-	if e.process == nil {
+	process, exited := e.process, e.exited
+	sections := e.sections
+	e.mu.Unlock()
+	if process == nil {
 		return nil
 	}
-	if err := e.process.Kill(); err != nil {
-		e.logger.Error("Failed to kill process", err, "pid", e.process.Pid)
+
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			<-exited
+			return nil
+		}
+		e.logger.Error("Failed to stop process", err, "pid", process.Pid)
 		return err
 	}
-	// NOTE(mwhittaker): runWeavelet also calls Wait. The redundant wait leads
-	// to a "waitid: no child processes" error which we ignore.
-	if _, err := e.process.Wait(); err != nil && !errors.Is(err, syscall.ECHILD) {
-		e.logger.Error("Failed to kill process", err, "pid", e.process.Pid)
+	timeout := e.stopTimeout(sections)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-exited:
+		e.logger.Debug("Stopped process", "pid", process.Pid)
+		return nil
+	case <-timer.C:
+	}
+
+	e.logger.Error("Failed to stop process; killing it", fmt.Errorf("still running after %v", timeout), "pid", process.Pid)
+	if err := process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		e.logger.Error("Failed to kill process", err, "pid", process.Pid)
 		return err
 	}
-	e.logger.Debug("Killed process", "pid", e.process.Pid)
+	<-exited
+	e.logger.Debug("Killed process", "pid", process.Pid)
 	return nil
 }
 
+// stopTimeout returns how long Stop waits for the weavelet to shut down
+// gracefully, given the config sections pushed by UpdateConfig, if any.
+func (e *Envelope) stopTimeout(sections map[string]string) time.Duration {
+	if sections == nil {
+		sections = e.config.Sections
+	}
+	config, err := runtime.ParseWeaveletConfig(sections)
+	if err != nil {
+		// The weavelet fails to start with an invalid config, so the
+		// default is as good as any.
+		return runtime.DefaultShutdownTimeout
+	}
+	return config.StopTimeout()
+}
+
+// Pid returns the process id of the running weavelet, or 0 if the weavelet is
+// not running.
+func (e *Envelope) Pid() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.process == nil {
+		return 0
+	}
+	return e.process.Pid
+}
+
 // ReadMetrics returns the set of all captured metrics.
 func (e *Envelope) ReadMetrics() ([]*metrics.MetricSnapshot, error) {
 	conn := e.getConn()
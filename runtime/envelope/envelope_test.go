@@ -21,10 +21,12 @@ import (
 	"math/rand"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -67,6 +69,12 @@ func TestMain(m *testing.M) {
 					time.Sleep(10 * time.Millisecond)
 				}
 			},
+			"ignore_sigterm": func() error {
+				signal.Ignore(syscall.SIGTERM)
+				for {
+					time.Sleep(10 * time.Millisecond)
+				}
+			},
 			"succeed": func() error { return nil },
 			"fail":    func() error { os.Exit(1); return nil },
 			"flip":    failOften,
@@ -206,6 +214,9 @@ func (h *handlerForTest) GetAddress(*protos.GetAddressRequest) (*protos.GetAddre
 func (h *handlerForTest) ExportListener(*protos.ExportListenerRequest) (*protos.ExportListenerReply, error) {
 	return nil, nil
 }
+func (h *handlerForTest) ElectLeader(*protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error) {
+	return nil, nil
+}
 
 func TestRun(t *testing.T) {
 	for _, test := range []struct {
@@ -345,6 +356,38 @@ func TestCancel(t *testing.T) {
 	}
 }
 
+// TestStopKillsAfterTimeout tests that Stop kills a weavelet that doesn't
+// shut down within its stop timeout.
+func TestStopKillsAfterTimeout(t *testing.T) {
+	wlet, config := wlet(executable, "ignore_sigterm")
+	config.Sections = map[string]string{
+		"github.com/ServiceWeaver/weaver": `shutdown_timeout = "100ms"`,
+	}
+	h := &handlerForTest{logSaver: testSaver(t)}
+	e, err := NewEnvelope(wlet, config, h, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- e.Run(context.Background()) }()
+	for e.Pid() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give the subprocess time to ignore SIGTERM.
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if err := e.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Stop returned after %v, before the 100ms stop timeout", elapsed)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
 func createWeaveletConn() (*conn.WeaveletConn, error) {
 	bootstrap, err := runtime.GetBootstrap(context.Background())
 	if err != nil {
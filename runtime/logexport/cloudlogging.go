@@ -0,0 +1,170 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logexport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// metadataTokenURL is the URL of the GCE metadata server endpoint that returns
+// an access token for the default service account.
+const metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// cloudLogging exports log entries to Google Cloud Logging [1]. Labels become
+// log entry labels. The message and the remaining attributes form the JSON
+// payload.
+//
+// Unless an Authorization header is configured, the exporter authenticates
+// with an access token from the GCE metadata server, so it only works out of
+// the box on Google Cloud.
+//
+// [1]: https://cloud.google.com/logging/docs/reference/v2/rest/v2/entries/write
+type cloudLogging struct {
+	config   Config
+	tokenURL string // overridden in tests
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+var _ Exporter = &cloudLogging{}
+
+// clEntry is a Cloud Logging LogEntry.
+type clEntry struct {
+	Timestamp      string            `json:"timestamp"`
+	Severity       string            `json:"severity"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	JSONPayload    map[string]string `json:"jsonPayload"`
+	SourceLocation *clSourceLocation `json:"sourceLocation,omitempty"`
+}
+
+// clSourceLocation is a Cloud Logging LogEntrySourceLocation.
+type clSourceLocation struct {
+	File string `json:"file"`
+	Line string `json:"line"`
+}
+
+// severities maps weaver log levels to Cloud Logging severities.
+var severities = map[string]string{
+	"debug": "DEBUG",
+	"info":  "INFO",
+	"warn":  "WARNING",
+	"error": "ERROR",
+}
+
+// Export implements the Exporter interface.
+func (c *cloudLogging) Export(ctx context.Context, entries []*protos.LogEntry) error {
+	logName := c.config.LogName
+	if logName == "" {
+		logName = "serviceweaver"
+	}
+	req := struct {
+		LogName  string            `json:"logName"`
+		Resource map[string]string `json:"resource"`
+		Entries  []clEntry         `json:"entries"`
+	}{
+		LogName:  fmt.Sprintf("projects/%s/logs/%s", c.config.Project, logName),
+		Resource: map[string]string{"type": "global"},
+	}
+	for _, e := range entries {
+		severity, ok := severities[e.Level]
+		if !ok {
+			severity = "DEFAULT"
+		}
+		payload := attrs(e, c.config.Labels)
+		payload["message"] = e.Msg
+		entry := clEntry{
+			Timestamp:   time.UnixMicro(e.TimeMicros).UTC().Format(time.RFC3339Nano),
+			Severity:    severity,
+			Labels:      labels(e, c.config.Labels),
+			JSONPayload: payload,
+		}
+		if e.File != "" {
+			entry.SourceLocation = &clSourceLocation{File: e.File, Line: fmt.Sprint(e.Line)}
+		}
+		req.Entries = append(req.Entries, entry)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{}
+	for k, v := range c.config.Headers {
+		headers[k] = v
+	}
+	if _, ok := headers["Authorization"]; !ok {
+		token, err := c.accessToken(ctx)
+		if err != nil {
+			return fmt.Errorf("cloud logging: %w", err)
+		}
+		headers["Authorization"] = "Bearer " + token
+	}
+	url := c.config.URL
+	if url == "" {
+		url = "https://logging.googleapis.com"
+	}
+	url = strings.TrimSuffix(url, "/") + "/v2/entries:write"
+	_, err = post(ctx, url, "application/json", headers, body)
+	return err
+}
+
+// accessToken returns a cached access token, fetching a new one from the
+// metadata server if needed.
+func (c *cloudLogging) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	url := c.tokenURL
+	if url == "" {
+		url = metadataTokenURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetch access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch access token: %s", resp.Status)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("fetch access token: %w", err)
+	}
+	c.token = token.AccessToken
+	// Refresh the token a minute before it expires.
+	c.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
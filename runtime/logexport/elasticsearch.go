@@ -0,0 +1,117 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logexport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// elasticsearch exports log entries to Elasticsearch [1], using the bulk API.
+// Every entry is indexed as a document with the fields @timestamp, message,
+// level, app, version, component, node, source, and attrs.
+//
+// [1]: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-bulk.html
+type elasticsearch struct {
+	config Config
+}
+
+var _ Exporter = &elasticsearch{}
+
+// esDocument is the Elasticsearch document of a log entry.
+type esDocument struct {
+	Timestamp string            `json:"@timestamp"`
+	Message   string            `json:"message"`
+	Level     string            `json:"level,omitempty"`
+	App       string            `json:"app,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	Component string            `json:"component,omitempty"`
+	Node      string            `json:"node,omitempty"`
+	Source    string            `json:"source,omitempty"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+}
+
+// Export implements the Exporter interface.
+func (es *elasticsearch) Export(ctx context.Context, entries []*protos.LogEntry) error {
+	index := es.config.Index
+	if index == "" {
+		index = "serviceweaver-logs"
+	}
+	action, err := json.Marshal(map[string]any{"create": map[string]string{"_index": index}})
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range entries {
+		body.Write(action)
+		body.WriteByte('\n')
+		doc := esDocument{
+			Timestamp: time.UnixMicro(e.TimeMicros).UTC().Format(time.RFC3339Nano),
+			Message:   e.Msg,
+			Level:     e.Level,
+			App:       e.App,
+			Version:   e.Version,
+			Component: e.Component,
+			Node:      e.Node,
+			Source:    source(e),
+			Attrs:     attrs(e, nil),
+		}
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+
+	url := strings.TrimSuffix(es.config.URL, "/") + "/_bulk"
+	data, err := post(ctx, url, "application/x-ndjson", es.config.Headers, body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	// The bulk API returns 200 OK even if some documents were not indexed.
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Error *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("elasticsearch: decode bulk response: %w", err)
+	}
+	if !resp.Errors {
+		return nil
+	}
+	failed := 0
+	reason := ""
+	for _, item := range resp.Items {
+		for _, result := range item {
+			if result.Error != nil {
+				failed++
+				reason = fmt.Sprintf("%s: %s", result.Error.Type, result.Error.Reason)
+			}
+		}
+	}
+	return fmt.Errorf("elasticsearch: %d/%d documents not indexed: %s", failed, len(entries), reason)
+}
@@ -0,0 +1,338 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logexport ships log entries to external log stores, like Loki,
+// Elasticsearch, and Google Cloud Logging.
+//
+// Deployers configure exporters with a log_exporters key in their config
+// section. For example:
+//
+//	[multi]
+//	log_exporters = [
+//	  {kind = "loki", url = "http://localhost:3100", labels = ["tenant"]},
+//	  {kind = "elasticsearch", url = "http://localhost:9200", index = "logs"},
+//	  {kind = "cloud_logging", project = "my-project"},
+//	]
+//
+// The weaver attributes of a log entry (app, version, component, and level)
+// are mapped to labels, along with the user attributes listed in labels. See the documentation of every kind of exporter for details.
+package logexport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"google.golang.org/protobuf/proto"
+)
+
+// An Exporter ships log entries to a log store.
+type Exporter interface {
+	// Export exports a batch of log entries.
+	Export(ctx context.Context, entries []*protos.LogEntry) error
+}
+
+// Config configures an exporter.
+type Config struct {
+	// Kind is the kind of exporter: "loki", "elasticsearch", or
+	// "cloud_logging".
+	Kind string `toml:"kind"`
+
+	// URL is the URL of the log store, e.g., "http://localhost:3100" for
+	// Loki. Cloud Logging exporters default to
+	// "https://logging.googleapis.com".
+	URL string `toml:"url"`
+
+	// Headers are added to every request, e.g., for authentication.
+	Headers map[string]string `toml:"headers"`
+
+	// Labels are the user attributes mapped to labels, in addition to the
+	// weaver attributes. Only Loki and Cloud Logging exporters distinguish
+	// labels from other attributes.
+	Labels []string `toml:"labels"`
+
+	// Index is the Elasticsearch index. Defaults to "serviceweaver-logs".
+	Index string `toml:"index"`
+
+	// Project and LogName are the Google Cloud project and log name of a
+	// Cloud Logging exporter. LogName defaults to "serviceweaver".
+	Project string `toml:"project"`
+	LogName string `toml:"log_name"`
+}
+
+// Validate validates a config.
+func (c *Config) Validate() error {
+	switch c.Kind {
+	case "loki", "elasticsearch":
+		if c.URL == "" {
+			return fmt.Errorf("%s log exporter: missing url", c.Kind)
+		}
+	case "cloud_logging":
+		if c.Project == "" {
+			return fmt.Errorf("cloud_logging log exporter: missing project")
+		}
+	default:
+		return fmt.Errorf("unknown log exporter kind %q; want loki, elasticsearch, or cloud_logging", c.Kind)
+	}
+	return nil
+}
+
+// New returns the exporter configured by c.
+func New(c Config) (Exporter, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	switch c.Kind {
+	case "loki":
+		return &loki{config: c}, nil
+	case "elasticsearch":
+		return &elasticsearch{config: c}, nil
+	default:
+		return &cloudLogging{config: c}, nil
+	}
+}
+
+// ParseConfig returns the exporters configured by the log_exporters key of the
+// config section with the provided key (or shortKey). Other keys in the
+// section are ignored. Deployers that parse their section strictly should
+// declare a log_exporters field of type []Config.
+func ParseConfig(key, shortKey string, sections map[string]string) ([]Exporter, error) {
+	section, ok := sections[shortKey]
+	if !ok {
+		section = sections[key]
+	}
+	var parsed struct {
+		LogExporters []Config `toml:"log_exporters"`
+	}
+	if _, err := toml.Decode(section, &parsed); err != nil {
+		return nil, err
+	}
+	var exporters []Exporter
+	for _, c := range parsed.LogExporters {
+		e, err := New(c)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, e)
+	}
+	return exporters, nil
+}
+
+// labels returns the labels of a log entry: the weaver attributes and the
+// user attributes in names.
+func labels(e *protos.LogEntry, names []string) map[string]string {
+	l := map[string]string{
+		"app":       e.App,
+		"version":   logging.Shorten(e.Version),
+		"component": logging.ShortenComponent(e.Component),
+		"level":     e.Level,
+	}
+	for k, v := range l {
+		if v == "" {
+			delete(l, k)
+		}
+	}
+	for i := 0; i+1 < len(e.Attrs); i += 2 {
+		for _, name := range names {
+			if e.Attrs[i] == name {
+				l[name] = e.Attrs[i+1]
+			}
+		}
+	}
+	return l
+}
+
+// attrs returns the user attributes of a log entry, excluding the ones in
+// names.
+func attrs(e *protos.LogEntry, names []string) map[string]string {
+	a := map[string]string{}
+	for i := 0; i+1 < len(e.Attrs); i += 2 {
+		a[e.Attrs[i]] = e.Attrs[i+1]
+	}
+	for _, name := range names {
+		delete(a, name)
+	}
+	return a
+}
+
+// source returns the file:line of a log entry, or "" if unknown.
+func source(e *protos.LogEntry) string {
+	if e.File == "" {
+		return ""
+	}
+	return e.File + ":" + strconv.Itoa(int(e.Line))
+}
+
+// sortedKeys returns the keys of m, in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// post sends a POST request with the provided body and headers, and returns
+// the response body, or an error if the response status isn't 2xx.
+func post(ctx context.Context, url, contentType string, headers map[string]string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("POST %s: %s: %s", url, resp.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
+
+// Options configures a Pipeline.
+type Options struct {
+	// BatchSize is the maximum number of entries exported at once. Defaults
+	// to 1000.
+	BatchSize int
+
+	// FlushInterval is the maximum time an entry is buffered before it is
+	// exported. Defaults to one second.
+	FlushInterval time.Duration
+
+	// BufferSize is the maximum number of buffered entries. Entries added to
+	// a full buffer are dropped. Defaults to 10,000.
+	BufferSize int
+
+	// OnError, if not nil, is called with the errors returned by the
+	// exporters.
+	OnError func(error)
+}
+
+// A Pipeline batches log entries and exports them to a set of exporters in the
+// background. Exporting never blocks logging: if the exporters fall behind,
+// entries are dropped.
+type Pipeline struct {
+	exporters []Exporter
+	opts      Options
+	entries   chan *protos.LogEntry
+	dropped   atomic.Int64
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPipeline returns a pipeline that exports entries to the provided
+// exporters. Call Close to flush the buffered entries.
+func NewPipeline(exporters []Exporter, opts Options) *Pipeline {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 10000
+	}
+	p := &Pipeline{
+		exporters: exporters,
+		opts:      opts,
+		entries:   make(chan *protos.LogEntry, opts.BufferSize),
+		done:      make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Add adds an entry to the pipeline. It is safe to call Add concurrently,
+// but not after Close.
+func (p *Pipeline) Add(e *protos.LogEntry) {
+	// Callers may reuse entries, so copy them.
+	e = proto.Clone(e).(*protos.LogEntry)
+	if e.TimeMicros == 0 {
+		e.TimeMicros = time.Now().UnixMicro()
+	}
+	select {
+	case p.entries <- e:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of entries dropped because the buffer was full.
+func (p *Pipeline) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+// Close exports the buffered entries and stops the pipeline.
+func (p *Pipeline) Close() {
+	p.closeOnce.Do(func() {
+		close(p.entries)
+		<-p.done
+	})
+}
+
+func (p *Pipeline) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+	var batch []*protos.LogEntry
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		for _, e := range p.exporters {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err := e.Export(ctx, batch)
+			cancel()
+			if err != nil && p.opts.OnError != nil {
+				p.opts.OnError(err)
+			}
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case e, ok := <-p.entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= p.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
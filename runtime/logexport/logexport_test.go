@@ -0,0 +1,227 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logexport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+)
+
+// entry is a log entry used in tests.
+var entry = &protos.LogEntry{
+	App:        "app",
+	Version:    "01234567-89ab-cdef-0123-456789abcdef",
+	Component:  "github.com/foo/bar/Baz",
+	Node:       "node",
+	TimeMicros: 1_000_000,
+	Level:      "warn",
+	File:       "main.go",
+	Line:       42,
+	Msg:        "Hello, World!",
+	Attrs:      []string{"tenant", "acme", "user", "alice smith"},
+}
+
+// server returns a test server that records the bodies of the requests it
+// receives and replies with resp.
+func server(t *testing.T, resp string) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var bodies []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		header := strings.TrimSpace(r.Method + " " + r.URL.Path + " " + r.Header.Get("Authorization"))
+		bodies = append(bodies, header+"\n"+string(data))
+		mu.Unlock()
+		w.Write([]byte(resp))
+	}))
+	t.Cleanup(s.Close)
+	return s, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func TestLoki(t *testing.T) {
+	s, bodies := server(t, "")
+	e, err := New(Config{Kind: "loki", URL: s.URL, Labels: []string{"tenant"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Export(context.Background(), []*protos.LogEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+	got := bodies()
+	want := []string{`POST /loki/api/v1/push
+{"streams":[{"stream":{"app":"app","component":"bar.Baz","level":"warn","tenant":"acme","version":"01234567"},"values":[["1000000000","msg=\"Hello, World!\" user=\"alice smith\" source=main.go:42"]]}]}`}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("bad request (-want +got):\n%s", diff)
+	}
+}
+
+func TestElasticsearch(t *testing.T) {
+	s, bodies := server(t, `{"errors":false}`)
+	e, err := New(Config{Kind: "elasticsearch", URL: s.URL, Headers: map[string]string{"Authorization": "ApiKey key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Export(context.Background(), []*protos.LogEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+	got := bodies()
+	want := []string{`POST /_bulk ApiKey key
+{"create":{"_index":"serviceweaver-logs"}}
+{"@timestamp":"1970-01-01T00:00:01Z","message":"Hello, World!","level":"warn","app":"app","version":"01234567-89ab-cdef-0123-456789abcdef","component":"github.com/foo/bar/Baz","node":"node","source":"main.go:42","attrs":{"tenant":"acme","user":"alice smith"}}
+`}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("bad request (-want +got):\n%s", diff)
+	}
+}
+
+func TestElasticsearchErrors(t *testing.T) {
+	s, _ := server(t, `{"errors":true,"items":[{"create":{"error":{"type":"mapper_parsing_exception","reason":"bad"}}}]}`)
+	e, err := New(Config{Kind: "elasticsearch", URL: s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.Export(context.Background(), []*protos.LogEntry{entry})
+	if err == nil || !strings.Contains(err.Error(), "mapper_parsing_exception") {
+		t.Fatalf("Export: got %v, want mapper_parsing_exception error", err)
+	}
+}
+
+func TestCloudLogging(t *testing.T) {
+	tokens, _ := server(t, `{"access_token":"token","expires_in":3600}`)
+	s, bodies := server(t, "{}")
+	e, err := New(Config{Kind: "cloud_logging", URL: s.URL, Project: "project"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.(*cloudLogging).tokenURL = tokens.URL
+	if err := e.Export(context.Background(), []*protos.LogEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+	got := bodies()
+	want := []string{`POST /v2/entries:write Bearer token
+{"logName":"projects/project/logs/serviceweaver","resource":{"type":"global"},"entries":[{"timestamp":"1970-01-01T00:00:01Z","severity":"WARNING","labels":{"app":"app","component":"bar.Baz","level":"warn","version":"01234567"},"jsonPayload":{"message":"Hello, World!","tenant":"acme","user":"alice smith"},"sourceLocation":{"file":"main.go","line":"42"}}]}`}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("bad request (-want +got):\n%s", diff)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, c := range []Config{
+		{},
+		{Kind: "splunk", URL: "http://localhost"},
+		{Kind: "loki"},
+		{Kind: "elasticsearch"},
+		{Kind: "cloud_logging"},
+	} {
+		if _, err := New(c); err == nil {
+			t.Errorf("New(%+v): unexpected success", c)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	sections := map[string]string{"multi": `
+listeners.foo = {address = "localhost:9000"}
+log_exporters = [
+  {kind = "loki", url = "http://localhost:3100"},
+  {kind = "elasticsearch", url = "http://localhost:9200", index = "logs"},
+]
+`}
+	exporters, err := ParseConfig("github.com/ServiceWeaver/weaver/multi", "multi", sections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exporters) != 2 {
+		t.Fatalf("got %d exporters, want 2", len(exporters))
+	}
+	if got, want := exporters[1].(*elasticsearch).config.Index, "logs"; got != want {
+		t.Fatalf("index: got %q, want %q", got, want)
+	}
+}
+
+// recorder is an Exporter that records the entries it exports.
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]*protos.LogEntry
+}
+
+func (r *recorder) Export(_ context.Context, entries []*protos.LogEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, entries)
+	return nil
+}
+
+func TestPipeline(t *testing.T) {
+	r := &recorder{}
+	p := NewPipeline([]Exporter{r}, Options{BatchSize: 2, FlushInterval: time.Hour})
+	e := &protos.LogEntry{Msg: "a"}
+	p.Add(e)
+	e.Msg = "b" // entries may be reused after Add returns
+	p.Add(e)
+	p.Add(&protos.LogEntry{Msg: "c"})
+	p.Close()
+
+	var got [][]string
+	for _, batch := range r.batches {
+		var msgs []string
+		for _, e := range batch {
+			if e.TimeMicros == 0 {
+				t.Errorf("entry %q: missing timestamp", e.Msg)
+			}
+			msgs = append(msgs, e.Msg)
+		}
+		got = append(got, msgs)
+	}
+	want := [][]string{{"a", "b"}, {"c"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("bad batches (-want +got):\n%s", diff)
+	}
+}
+
+func TestPipelineErrors(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer s.Close()
+	e, err := New(Config{Kind: "loki", URL: s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	p := NewPipeline([]Exporter{e}, Options{OnError: func(err error) { errs = append(errs, err) }})
+	p.Add(entry)
+	p.Close()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "boom") {
+		t.Fatalf("got errors %v, want one boom error", errs)
+	}
+}
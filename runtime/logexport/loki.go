@@ -0,0 +1,109 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logexport
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// loki exports log entries to Grafana Loki [1]. Labels become Loki stream
+// labels. The message, the remaining attributes, and the source location form
+// the log line, in logfmt.
+//
+// [1]: https://grafana.com/docs/loki/latest/reference/api/#push-log-entries-to-loki
+type loki struct {
+	config Config
+}
+
+var _ Exporter = &loki{}
+
+// lokiStream is a Loki stream, as encoded by the push API.
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Export implements the Exporter interface.
+func (l *loki) Export(ctx context.Context, entries []*protos.LogEntry) error {
+	// Group entries into streams by their labels.
+	streams := map[string]*lokiStream{}
+	var keys []string
+	for _, e := range entries {
+		ls := labels(e, l.config.Labels)
+		var b strings.Builder
+		for _, k := range sortedKeys(ls) {
+			b.WriteString(k)
+			b.WriteByte(0)
+			b.WriteString(ls[k])
+			b.WriteByte(0)
+		}
+		key := b.String()
+		s, ok := streams[key]
+		if !ok {
+			s = &lokiStream{Stream: ls}
+			streams[key] = s
+			keys = append(keys, key)
+		}
+		ts := strconv.FormatInt(e.TimeMicros*1000, 10)
+		s.Values = append(s.Values, [2]string{ts, l.line(e)})
+	}
+
+	var req struct {
+		Streams []*lokiStream `json:"streams"`
+	}
+	for _, key := range keys {
+		req.Streams = append(req.Streams, streams[key])
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(l.config.URL, "/") + "/loki/api/v1/push"
+	_, err = post(ctx, url, "application/json", l.config.Headers, body)
+	return err
+}
+
+// line returns the log line of an entry, e.g.,
+// `msg="Hello, World!" user=alice source=main.go:42`.
+func (l *loki) line(e *protos.LogEntry) string {
+	var b strings.Builder
+	b.WriteString("msg=")
+	b.WriteString(strconv.Quote(e.Msg))
+	a := attrs(e, l.config.Labels)
+	for _, k := range sortedKeys(a) {
+		b.WriteByte(' ')
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(a[k]))
+	}
+	if src := source(e); src != "" {
+		b.WriteString(" source=")
+		b.WriteString(src)
+	}
+	return b.String()
+}
+
+// logfmtValue returns s, quoted if needed.
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -122,6 +122,23 @@ func Parse(query Query) (*cel.Ast, error) {
 	return ast, err
 }
 
+// Matcher returns a function that reports whether a log entry matches the
+// provided query. Log sources that cannot evaluate queries themselves can use
+// it to filter log entries.
+func Matcher(query Query) (func(*protos.LogEntry) (bool, error), error) {
+	env, ast, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := compile(env, ast)
+	if err != nil {
+		return nil, err
+	}
+	return func(entry *protos.LogEntry) (bool, error) {
+		return matches(prog, entry)
+	}, nil
+}
+
 // parse parses and type-checks a query.
 func parse(query Query) (*cel.Env, *cel.Ast, error) {
 	// Build the environment.
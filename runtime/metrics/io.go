@@ -79,6 +79,7 @@ func (i *Importer) Import(update *protos.MetricUpdate) ([]*MetricSnapshot, error
 			Name:   def.Name,
 			Type:   def.Typ,
 			Help:   def.Help,
+			Unit:   def.Unit,
 			Labels: def.Labels,
 			Bounds: def.Bounds,
 		}
@@ -16,28 +16,36 @@
 package metrics
 
 import (
+	"context"
 	"encoding/binary"
 	"expvar"
 	"fmt"
 	"math"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
 )
 
 var (
-	// metricNames stores the name of every metric (labeled or not).
+	// metricNames stores the name and type of every metric (labeled or not).
 	metricNamesMu sync.RWMutex
-	metricNames   = map[string]bool{}
+	metricNames   = map[string]protos.MetricType{}
 
 	// metrics stores every metric.
 	metricsMu sync.RWMutex
 	metrics   = []*Metric{}
+
+	// boundsOverrides stores the histogram bounds set by OverrideBounds, by
+	// metric name. It is guarded by metricsMu.
+	boundsOverrides = map[string][]float64{}
 )
 
 // Metric is a thread-safe readable and writeable metric. It is the underlying
@@ -57,6 +65,7 @@ type Metric struct {
 	typ         protos.MetricType        // the type of the metric
 	name        string                   // the globally unique metric name
 	help        string                   // a short description of the metric
+	unit        string                   // the unit of the metric's values, if any
 	labelsThunk func() map[string]string // the (deferred) metric labels
 
 	// Users may call Get on the critical path of their application, so we want
@@ -69,10 +78,47 @@ type Metric struct {
 	id     uint64            // globally unique metric id
 	labels map[string]string // materialized labels from calling labelsThunk
 
-	version atomic.Uint64   // incremented on every update, for change detection
-	value   expvar.Float    // value for Counter and Gauge, sum for Histogram
-	bounds  []float64       // histogram bounds
-	counts  []atomic.Uint64 // histogram counts
+	version atomic.Uint64             // incremented on every update, for change detection
+	value   expvar.Float              // value for Counter and Gauge, sum for Histogram
+	hist    atomic.Pointer[histogram] // histogram bounds and counts
+}
+
+// histogram holds the bounds, counts, and exemplars of a histogram. The bounds
+// of a histogram can be replaced by OverrideBounds, so a Metric stores them
+// behind an atomic pointer.
+type histogram struct {
+	bounds    []float64
+	counts    []atomic.Uint64
+	exemplars []atomic.Pointer[Exemplar] // latest exemplar of every bucket
+}
+
+// newHistogram returns a new histogram with the provided bounds.
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds:    bounds,
+		counts:    make([]atomic.Uint64, len(bounds)+1),
+		exemplars: make([]atomic.Pointer[Exemplar], len(bounds)+1),
+	}
+}
+
+// bucket returns the index of the bucket that val falls in.
+func (h *histogram) bucket(val float64) int {
+	idx := sort.SearchFloat64s(h.bounds, val)
+	if idx < len(h.bounds) && val == h.bounds[idx] {
+		idx++
+	}
+	return idx
+}
+
+// An Exemplar is a value put in a histogram, along with the trace span that
+// put it. Exemplars let monitoring systems link a histogram bucket, like the
+// bucket of slow requests, to example traces. A histogram keeps the latest
+// exemplar of every bucket.
+type Exemplar struct {
+	Value   float64   // the value put in the histogram
+	Time    time.Time // when the value was put
+	TraceID [16]byte  // the trace id of the span
+	SpanID  [8]byte   // the span id of the span
 }
 
 // A MetricSnapshot is a snapshot of a metric.
@@ -82,10 +128,18 @@ type MetricSnapshot struct {
 	Name   string
 	Labels map[string]string
 	Help   string
+	Unit   string
 
 	Value  float64
 	Bounds []float64
 	Counts []uint64
+
+	// Exemplars holds the latest exemplar of every bucket of a histogram, or
+	// nil if the bucket has none. It is nil if the histogram has no
+	// exemplars at all. Exemplars are not included in the proto equivalent
+	// of a snapshot, so they are only available in the process that
+	// recorded them.
+	Exemplars []*Exemplar
 }
 
 // MetricDef returns a MetricDef derived from the metric.
@@ -97,6 +151,7 @@ func (m *MetricSnapshot) MetricDef() *protos.MetricDef {
 		Help:   m.Help,
 		Labels: m.Labels,
 		Bounds: m.Bounds,
+		Unit:   m.Unit,
 	}
 }
 
@@ -120,6 +175,7 @@ func (m *MetricSnapshot) ToProto() *protos.MetricSnapshot {
 		Bounds: m.Bounds,
 		Value:  m.Value,
 		Counts: m.Counts,
+		Unit:   m.Unit,
 	}
 }
 
@@ -131,6 +187,7 @@ func UnProto(m *protos.MetricSnapshot) *MetricSnapshot {
 		Name:   m.Name,
 		Labels: m.Labels,
 		Help:   m.Help,
+		Unit:   m.Unit,
 		Value:  m.Value,
 		Bounds: m.Bounds,
 		Counts: m.Counts,
@@ -143,6 +200,7 @@ func (m *MetricSnapshot) Clone() *MetricSnapshot {
 	c.Labels = maps.Clone(m.Labels)
 	c.Bounds = slices.Clone(m.Bounds)
 	c.Counts = slices.Clone(m.Counts)
+	c.Exemplars = slices.Clone(m.Exemplars)
 	return &c
 }
 
@@ -153,6 +211,7 @@ type config struct {
 	Labels func() map[string]string
 	Bounds []float64
 	Help   string
+	Unit   string
 }
 
 // Register registers and returns a new metric. Panics if a metric with the same name
@@ -162,6 +221,13 @@ func Register(typ protos.MetricType, name string, help string, bounds []float64)
 	return m.Get(struct{}{})
 }
 
+// RegisterWithUnit is like Register, but also records the unit of the
+// metric's values (e.g., "ms" or "bytes").
+func RegisterWithUnit(typ protos.MetricType, name, help, unit string, bounds []float64) *Metric {
+	m := RegisterMapWithUnit[struct{}](typ, name, help, unit, bounds)
+	return m.Get(struct{}{})
+}
+
 // newMetric registers and returns a new metric.
 func newMetric(config config) *Metric {
 	metricsMu.Lock()
@@ -170,11 +236,15 @@ func newMetric(config config) *Metric {
 		typ:         config.Type,
 		name:        config.Name,
 		help:        config.Help,
+		unit:        config.Unit,
 		labelsThunk: config.Labels,
-		bounds:      config.Bounds,
 	}
 	if config.Type == protos.MetricType_HISTOGRAM {
-		metric.counts = make([]atomic.Uint64, len(config.Bounds)+1)
+		bounds := config.Bounds
+		if override, ok := boundsOverrides[config.Name]; ok {
+			bounds = override
+		}
+		metric.hist.Store(newHistogram(bounds))
 	}
 	metrics = append(metrics, metric)
 	return metric
@@ -205,15 +275,34 @@ func (m *Metric) Set(val float64) {
 
 // Put adds the provided value to the metric's histogram.
 func (m *Metric) Put(val float64) {
-	idx := sort.SearchFloat64s(m.bounds, val)
-	if idx < len(m.bounds) && val == m.bounds[idx] {
-		idx++
-	}
-	m.counts[idx].Add(1)
+	h := m.hist.Load()
+	h.counts[h.bucket(val)].Add(1)
+	m.value.Add(val)
+	m.version.Add(1)
+}
+
+// PutExemplar is like Put, but also records the value, along with the
+// provided trace span, as the exemplar of the value's bucket.
+func (m *Metric) PutExemplar(val float64, traceID [16]byte, spanID [8]byte) {
+	h := m.hist.Load()
+	idx := h.bucket(val)
+	h.exemplars[idx].Store(&Exemplar{Value: val, Time: time.Now(), TraceID: traceID, SpanID: spanID})
+	h.counts[idx].Add(1)
 	m.value.Add(val)
 	m.version.Add(1)
 }
 
+// PutContext is like Put, but if ctx carries a sampled trace span, it also
+// records the value as the exemplar of its bucket, linked to the span.
+func (m *Metric) PutContext(ctx context.Context, val float64) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsSampled() {
+		m.Put(val)
+		return
+	}
+	m.PutExemplar(val, sc.TraceID(), sc.SpanID())
+}
+
 // Init initializes the id and labels of a metric.
 func (m *Metric) Init() {
 	m.once.Do(func() {
@@ -233,47 +322,72 @@ func (m *Metric) Version() uint64 {
 // Snapshot returns a snapshot of the metric. You must call Init at least once
 // before calling Snapshot.
 func (m *Metric) Snapshot() *MetricSnapshot {
-	var counts []uint64
-	if n := len(m.counts); n > 0 {
-		counts = make([]uint64, n)
-		for i := range m.counts {
-			counts[i] = m.counts[i].Load()
+	bounds, counts := m.histogram()
+	return &MetricSnapshot{
+		Id:        m.id,
+		Name:      m.name,
+		Type:      m.typ,
+		Help:      m.help,
+		Unit:      m.unit,
+		Labels:    maps.Clone(m.labels),
+		Value:     m.value.Value(),
+		Bounds:    bounds,
+		Counts:    counts,
+		Exemplars: m.exemplars(),
+	}
+}
+
+// exemplars returns the exemplars of the metric's histogram, or nil if it has
+// none.
+func (m *Metric) exemplars() []*Exemplar {
+	h := m.hist.Load()
+	if h == nil {
+		return nil
+	}
+	var exemplars []*Exemplar
+	for i := range h.exemplars {
+		if e := h.exemplars[i].Load(); e != nil {
+			if exemplars == nil {
+				exemplars = make([]*Exemplar, len(h.exemplars))
+			}
+			exemplars[i] = e
 		}
 	}
-	return &MetricSnapshot{
-		Id:     m.id,
-		Name:   m.name,
-		Type:   m.typ,
-		Help:   m.help,
-		Labels: maps.Clone(m.labels),
-		Value:  m.value.Value(),
-		Bounds: slices.Clone(m.bounds),
-		Counts: counts,
+	return exemplars
+}
+
+// histogram returns a copy of the metric's histogram bounds and counts, or
+// nil if the metric is not a histogram.
+func (m *Metric) histogram() ([]float64, []uint64) {
+	h := m.hist.Load()
+	if h == nil {
+		return nil, nil
+	}
+	counts := make([]uint64, len(h.counts))
+	for i := range h.counts {
+		counts[i] = h.counts[i].Load()
 	}
+	return slices.Clone(h.bounds), counts
 }
 
 // MetricDef returns a MetricDef derived from the metric. You must call Init at
 // least once before calling Snapshot.
 func (m *Metric) MetricDef() *protos.MetricDef {
+	bounds, _ := m.histogram()
 	return &protos.MetricDef{
 		Id:     m.id,
 		Name:   m.name,
 		Typ:    m.typ,
 		Help:   m.help,
+		Unit:   m.unit,
 		Labels: maps.Clone(m.labels),
-		Bounds: slices.Clone(m.bounds),
+		Bounds: bounds,
 	}
 }
 
 // MetricValue returns a MetricValue derived from the metric.
 func (m *Metric) MetricValue() *protos.MetricValue {
-	var counts []uint64
-	if n := len(m.counts); n > 0 {
-		counts = make([]uint64, n)
-		for i := range m.counts {
-			counts[i] = m.counts[i].Load()
-		}
-	}
+	_, counts := m.histogram()
 	return &protos.MetricValue{
 		Id:     m.id,
 		Value:  m.value.Value(),
@@ -288,13 +402,26 @@ func (m *Metric) MetricValue() *protos.MetricValue {
 // TODO(mwhittaker): Understand the behavior of prometheus and Google Cloud
 // Metrics when we add or remove metric labels over time.
 type MetricMap[L comparable] struct {
-	config    config             // configures the metrics returned by Get
-	extractor *labelExtractor[L] // extracts labels from a value of type L
-	mu        sync.Mutex         // guards metrics
-	metrics   map[L]*Metric      // cache of metrics, by label
+	config    config                  // configures the metrics returned by Get
+	extractor *labelExtractor[L]      // extracts labels from a value of type L
+	mu        sync.Mutex              // guards metrics and extras
+	metrics   map[L]*Metric           // cache of metrics, by label
+	extras    map[extraKey[L]]*Metric // cache of metrics with extra labels
+}
+
+// extraKey identifies a metric returned by MetricMap.GetWithExtraLabels.
+type extraKey[L comparable] struct {
+	labels L
+	extra  string // the extra labels, joined with \x00
 }
 
 func RegisterMap[L comparable](typ protos.MetricType, name string, help string, bounds []float64) *MetricMap[L] {
+	return RegisterMapWithUnit[L](typ, name, help, "", bounds)
+}
+
+// RegisterMapWithUnit is like RegisterMap, but also records the unit of the
+// metrics' values (e.g., "ms" or "bytes").
+func RegisterMapWithUnit[L comparable](typ protos.MetricType, name, help, unit string, bounds []float64) *MetricMap[L] {
 	if err := typecheckLabels[L](); err != nil {
 		panic(err)
 	}
@@ -304,25 +431,18 @@ func RegisterMap[L comparable](typ protos.MetricType, name string, help string,
 	if typ == protos.MetricType_INVALID {
 		panic(fmt.Errorf("metric %q: invalid metric type %v", name, typ))
 	}
-	for _, x := range bounds {
-		if math.IsNaN(x) {
-			panic(fmt.Errorf("metric %q: NaN histogram bound", name))
-		}
-	}
-	for i := 0; i < len(bounds)-1; i++ {
-		if bounds[i] >= bounds[i+1] {
-			panic(fmt.Errorf("metric %q: non-ascending histogram bounds %v", name, bounds))
-		}
+	if err := CheckBounds(bounds); err != nil {
+		panic(fmt.Errorf("metric %q: %w", name, err))
 	}
 
 	metricNamesMu.Lock()
 	defer metricNamesMu.Unlock()
-	if metricNames[name] {
+	if _, ok := metricNames[name]; ok {
 		panic(fmt.Errorf("metric %q already exists", name))
 	}
-	metricNames[name] = true
+	metricNames[name] = typ
 	return &MetricMap[L]{
-		config:    config{Type: typ, Name: name, Help: help, Bounds: bounds},
+		config:    config{Type: typ, Name: name, Help: help, Unit: unit, Bounds: bounds},
 		extractor: newLabelExtractor[L](),
 		metrics:   map[L]*Metric{},
 	}
@@ -351,6 +471,103 @@ func (mm *MetricMap[L]) Get(labels L) *Metric {
 	return metric
 }
 
+// GetWithExtraLabels is like Get, but the returned metric also has the
+// provided extra labels, given as alternating label names and values. The
+// extra labels override the labels in L with the same names. Multiple calls to
+// GetWithExtraLabels with the same labels, in the same order, return the same
+// metric.
+func (mm *MetricMap[L]) GetWithExtraLabels(labels L, extra []string) *Metric {
+	if len(extra) == 0 {
+		return mm.Get(labels)
+	}
+	key := extraKey[L]{labels: labels, extra: strings.Join(extra, "\x00")}
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if metric, ok := mm.extras[key]; ok {
+		return metric
+	}
+	extra = slices.Clone(extra)
+	config := mm.config
+	config.Labels = func() map[string]string {
+		result := mm.extractor.Extract(labels)
+		for i := 0; i+1 < len(extra); i += 2 {
+			result[extra[i]] = extra[i+1]
+		}
+		return result
+	}
+	metric := newMetric(config)
+	if mm.extras == nil {
+		mm.extras = map[extraKey[L]]*Metric{}
+	}
+	mm.extras[key] = metric
+	return metric
+}
+
+// CheckBounds returns an error if the provided histogram bounds are not
+// strictly increasing.
+func CheckBounds(bounds []float64) error {
+	for _, x := range bounds {
+		if math.IsNaN(x) {
+			return fmt.Errorf("NaN histogram bound")
+		}
+	}
+	for i := 0; i < len(bounds)-1; i++ {
+		if bounds[i] >= bounds[i+1] {
+			return fmt.Errorf("non-ascending histogram bounds %v", bounds)
+		}
+	}
+	return nil
+}
+
+// OverrideBounds replaces the bounds of the named histograms with the provided
+// bounds, e.g., the bounds specified in the application config. The values
+// recorded so far by a histogram whose bounds change are discarded, so
+// OverrideBounds should be called before the histograms are used.
+//
+// OverrideBounds returns an error if a name does not refer to a registered
+// histogram or if the provided bounds are invalid.
+func OverrideBounds(overrides map[string][]float64) error {
+	for name, bounds := range overrides {
+		if err := checkOverride(name, bounds); err != nil {
+			return err
+		}
+	}
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	for name, bounds := range overrides {
+		boundsOverrides[name] = slices.Clone(bounds)
+	}
+	for _, metric := range metrics {
+		bounds, ok := overrides[metric.name]
+		if !ok || slices.Equal(metric.hist.Load().bounds, bounds) {
+			continue
+		}
+		metric.hist.Store(newHistogram(boundsOverrides[metric.name]))
+		metric.value.Set(0)
+		metric.version.Add(1)
+	}
+	return nil
+}
+
+// checkOverride checks that name refers to a registered histogram and that
+// bounds are valid histogram bounds.
+func checkOverride(name string, bounds []float64) error {
+	metricNamesMu.RLock()
+	defer metricNamesMu.RUnlock()
+	typ, ok := metricNames[name]
+	if !ok {
+		return fmt.Errorf("metric %q not found", name)
+	}
+	if typ != protos.MetricType_HISTOGRAM {
+		return fmt.Errorf("metric %q is not a histogram", name)
+	}
+	if err := CheckBounds(bounds); err != nil {
+		return fmt.Errorf("metric %q: %w", name, err)
+	}
+	return nil
+}
+
 // Snapshot returns a snapshot of all currently registered metrics. The
 // snapshot is not guaranteed to be atomic.
 func Snapshot() []*MetricSnapshot {
@@ -18,6 +18,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"math"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -36,8 +37,9 @@ const (
 
 // clear clears all registered metrics.
 func clear() {
-	metricNames = map[string]bool{}
+	metricNames = map[string]protos.MetricType{}
 	metrics = []*Metric{}
+	boundsOverrides = map[string][]float64{}
 }
 
 func TestMetrics(t *testing.T) {
@@ -110,6 +112,36 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestGetWithExtraLabels(t *testing.T) {
+	clear()
+	type dog struct {
+		Name string
+	}
+	counter := RegisterMap[dog](counterType, "TestGetWithExtraLabels/counter", "", nil)
+	fido := dog{"fido"}
+	counter.Get(fido).Add(1)
+	counter.GetWithExtraLabels(fido, []string{"owner", "alice"}).Add(2)
+	counter.GetWithExtraLabels(fido, []string{"owner", "alice"}).Add(3)
+	counter.GetWithExtraLabels(fido, []string{"owner", "bob", "name", "rex"}).Add(4)
+	if counter.GetWithExtraLabels(fido, nil) != counter.Get(fido) {
+		t.Error("GetWithExtraLabels without extra labels != Get")
+	}
+
+	var got []string
+	for _, snap := range Snapshot() {
+		got = append(got, fmt.Sprintf("%v %v", snap.Labels, snap.Value))
+	}
+	sort.Strings(got)
+	want := []string{
+		"map[name:fido owner:alice] 5",
+		"map[name:fido] 1",
+		"map[name:rex owner:bob] 4",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("bad snapshots (-want +got):\n%s", diff)
+	}
+}
+
 func TestSnapshot(t *testing.T) {
 	clear()
 
@@ -258,6 +290,92 @@ func TestDuplicateMetric(t *testing.T) {
 	Register(counterType, name, "", nil)
 }
 
+func TestUnit(t *testing.T) {
+	clear()
+	histogram := RegisterWithUnit(histogramType, "TestUnit/histogram", "", "ms", []float64{1, 10})
+	histogram.Init()
+	if got, want := histogram.Snapshot().Unit, "ms"; got != want {
+		t.Errorf("Snapshot().Unit: got %q, want %q", got, want)
+	}
+	if got, want := histogram.MetricDef().Unit, "ms"; got != want {
+		t.Errorf("MetricDef().Unit: got %q, want %q", got, want)
+	}
+}
+
+func TestExemplars(t *testing.T) {
+	clear()
+	histogram := Register(histogramType, "TestExemplars/histogram", "", []float64{10, 100})
+	histogram.Init()
+	histogram.Put(5)
+	if got := histogram.Snapshot().Exemplars; got != nil {
+		t.Fatalf("Exemplars: got %v, want nil", got)
+	}
+
+	histogram.PutExemplar(50, [16]byte{1}, [8]byte{1})
+	histogram.PutExemplar(60, [16]byte{2}, [8]byte{2})
+	snap := histogram.Snapshot()
+	if diff := cmp.Diff([]uint64{1, 2, 0}, snap.Counts); diff != "" {
+		t.Fatalf("counts (-want +got):\n%s", diff)
+	}
+	if len(snap.Exemplars) != 3 || snap.Exemplars[0] != nil || snap.Exemplars[2] != nil {
+		t.Fatalf("Exemplars: got %v, want one exemplar in bucket 1", snap.Exemplars)
+	}
+	// The latest exemplar of a bucket wins.
+	got := snap.Exemplars[1]
+	if got.Value != 60 || got.TraceID != [16]byte{2} || got.SpanID != [8]byte{2} {
+		t.Fatalf("Exemplars[1]: got %+v, want value 60 of trace 2", got)
+	}
+}
+
+func TestOverrideBounds(t *testing.T) {
+	clear()
+	type labels struct{ A string }
+	histograms := RegisterMap[labels](histogramType, "TestOverrideBounds/histograms", "", []float64{1, 10, 100})
+	before := histograms.Get(labels{"before"})
+	before.Put(5)
+
+	bounds := []float64{0.1, 0.5, 1, 5}
+	if err := OverrideBounds(map[string][]float64{"TestOverrideBounds/histograms": bounds}); err != nil {
+		t.Fatal(err)
+	}
+	after := histograms.Get(labels{"after"})
+	for _, m := range []*Metric{before, after} {
+		m.Put(0.2)
+		snap := m.Snapshot()
+		if diff := cmp.Diff(bounds, snap.Bounds); diff != "" {
+			t.Errorf("bounds (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff([]uint64{0, 1, 0, 0, 0}, snap.Counts); diff != "" {
+			t.Errorf("counts (-want +got):\n%s", diff)
+		}
+		if got, want := snap.Value, 0.2; got != want {
+			t.Errorf("value: got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestOverrideBoundsErrors(t *testing.T) {
+	clear()
+	Register(counterType, "TestOverrideBoundsErrors/counter", "", nil)
+	Register(histogramType, "TestOverrideBoundsErrors/histogram", "", []float64{1, 2})
+	for _, test := range []struct {
+		name      string
+		overrides map[string][]float64
+		want      string
+	}{
+		{"unknown", map[string][]float64{"unknown": {1}}, "not found"},
+		{"counter", map[string][]float64{"TestOverrideBoundsErrors/counter": {1}}, "not a histogram"},
+		{"invalid", map[string][]float64{"TestOverrideBoundsErrors/histogram": {2, 1}}, "non-ascending"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := OverrideBounds(test.overrides)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("OverrideBounds: got %v, want error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
 type labels1 struct {
 	L1 string
 }
@@ -0,0 +1,134 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recording implements recordings of component method calls, with
+// their arguments and results, which weavertest.Replay replays against a
+// component in isolation.
+//
+// A recording is a file of JSON entries, one per line, appended to as calls
+// finish. Arguments and results are stored in their serialized form, as sent
+// between processes.
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Call is an entry of a recording, which records a call to a component
+// method.
+type Call struct {
+	Seq        int64     `json:"seq"`                   // sequence number in its file, starting at 0
+	Start      time.Time `json:"start"`                 // when the call started
+	Deployment string    `json:"deployment"`            // deployment id
+	Weavelet   string    `json:"weavelet"`              // id of the weavelet that executed the call
+	Component  string    `json:"component"`             // full component name
+	Method     string    `json:"method"`                // component method
+	Caller     string    `json:"caller"`                // full caller component name, or "unknown"
+	RoutingKey uint64    `json:"routing_key,omitempty"` // routing key of the call, if routed
+	Args       []byte    `json:"args"`                  // serialized arguments
+	Result     []byte    `json:"result,omitempty"`      // serialized results, if the call succeeded
+	Error      string    `json:"error,omitempty"`       // error that failed the call, if any
+}
+
+// Writer appends calls to a recording. It is safe for concurrent use.
+type Writer struct {
+	mu  sync.Mutex
+	f   *os.File
+	seq int64 // sequence number of the next call
+}
+
+// NewWriter returns a writer that appends calls to the recording in the
+// provided file, creating it if needed.
+func NewWriter(file string) (*Writer, error) {
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("recording: %w", err)
+	}
+	calls, err := read(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("recording: %s: %w", file, err)
+	}
+	return &Writer{f: f, seq: int64(len(calls))}, nil
+}
+
+// Write appends the provided call to the recording, overwriting its Seq
+// field.
+func (w *Writer) Write(c Call) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c.Seq = w.seq
+	line, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("recording: %w", err)
+	}
+	// Write the line with a single write, so that a crash can only leave a
+	// truncated last line behind.
+	if _, err := w.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("recording: %w", err)
+	}
+	w.seq++
+	return nil
+}
+
+// Close closes the recording.
+func (w *Writer) Close() error {
+	return w.f.Close()
+}
+
+// Read returns the calls recorded in the provided files, ordered by the time
+// they started.
+func Read(files ...string) ([]Call, error) {
+	var calls []Call
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("recording: %w", err)
+		}
+		fileCalls, err := read(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("recording: %s: %w", file, err)
+		}
+		calls = append(calls, fileCalls...)
+	}
+	sort.SliceStable(calls, func(i, j int) bool {
+		return calls[i].Start.Before(calls[j].Start)
+	})
+	return calls, nil
+}
+
+// read returns the calls recorded in the provided file.
+func read(f *os.File) ([]Call, error) {
+	var calls []Call
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 256<<20)
+	for scanner.Scan() {
+		var c Call
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("line %d: %w", len(calls)+1, err)
+		}
+		calls = append(calls, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
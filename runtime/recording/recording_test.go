@@ -0,0 +1,60 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recording
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteRead(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	write := func(file string, calls ...Call) {
+		t.Helper()
+		w, err := NewWriter(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		for _, c := range calls {
+			if err := w.Write(c); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	a := filepath.Join(dir, "a.recording")
+	b := filepath.Join(dir, "b.recording")
+	write(a, Call{Start: now, Method: "Checkout", Args: []byte{1, 2}, Result: []byte{3}})
+	write(b, Call{Start: now.Add(time.Second), Method: "Charge", Error: "boom"})
+	// Reopened recordings continue the sequence numbers.
+	write(a, Call{Start: now.Add(2 * time.Second), Method: "Checkout"})
+
+	got, err := Read(b, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Call{
+		{Seq: 0, Start: now, Method: "Checkout", Args: []byte{1, 2}, Result: []byte{3}},
+		{Seq: 0, Start: now.Add(time.Second), Method: "Charge", Error: "boom"},
+		{Seq: 1, Start: now.Add(2 * time.Second), Method: "Checkout"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Read (-want +got):\n%s", diff)
+	}
+}
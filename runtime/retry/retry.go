@@ -39,12 +39,19 @@ type Retry struct {
 
 // Options are the options that configure a retry loop. Before the ith
 // iteration of a retry loop, retry.Continue() sleeps for a duration of
-// BackoffMinDuration * BackoffMultiplier^i, with added jitter.
+// BackoffMinDuration * BackoffMultiplier^i, capped to BackoffMaxDuration, with
+// added jitter.
 type Options struct {
 	BackoffMultiplier  float64 // If specified, must be at least 1.
 	BackoffMinDuration time.Duration
+	BackoffMaxDuration time.Duration // If specified, caps the backoff.
+	Jitter             *float64      // If specified, must be in [0, 1]. Defaults to DefaultJitter.
 }
 
+// DefaultJitter is the default fraction of every backoff that is randomly
+// subtracted from it. See Options.Jitter.
+const DefaultJitter = 0.4
+
 // DefaultOptions is the default set of Options.
 var DefaultOptions = Options{
 	BackoffMultiplier:  1.3,
@@ -83,7 +90,7 @@ func BeginWithOptions(options Options) *Retry {
 // call does not sleep.
 func (r *Retry) Continue(ctx context.Context) bool {
 	if r.attempt != 0 {
-		randomized(ctx, backoffDelay(r.attempt, r.options))
+		sleep(ctx, r.delay())
 	}
 	r.attempt++
 	return ctx.Err() == nil
@@ -105,17 +112,33 @@ func (r *Retry) Reset() {
 	r.attempt = 0
 }
 
+// delay returns the duration of the sleep before the next attempt.
+func (r *Retry) delay() time.Duration {
+	jitter := DefaultJitter
+	if r.options.Jitter != nil {
+		jitter = *r.options.Jitter
+	}
+	return randomized(backoffDelay(r.attempt, r.options), jitter)
+}
+
 func backoffDelay(i int, opts Options) time.Duration {
 	mult := math.Pow(opts.BackoffMultiplier, float64(i))
-	return time.Duration(float64(opts.BackoffMinDuration) * mult)
+	d := time.Duration(float64(opts.BackoffMinDuration) * mult)
+	if opts.BackoffMaxDuration > 0 && (d > opts.BackoffMaxDuration || d < 0) {
+		// Note that d is negative if the multiplication overflowed.
+		d = opts.BackoffMaxDuration
+	}
+	return d
 }
 
-// randomized sleeps for a random duration close to d, or until context is done,
-// whichever occurs first.
-func randomized(ctx context.Context, d time.Duration) {
-	const jitter = 0.4
-	mult := 1 - jitter*randomFloat() // Subtract up to 40%
-	sleep(ctx, time.Duration(float64(d)*mult))
+// randomized returns a random duration close to d: up to a fraction jitter of
+// d is subtracted from it. If jitter is zero, randomized returns d.
+func randomized(d time.Duration, jitter float64) time.Duration {
+	if jitter == 0 {
+		return d
+	}
+	mult := 1 - jitter*randomFloat()
+	return time.Duration(float64(d) * mult)
 }
 
 // sleep sleeps for the specified duration d, or until context is done,
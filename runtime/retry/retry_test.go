@@ -88,7 +88,7 @@ func TestRandomization(t *testing.T) {
 	var sum time.Duration
 	for i := 0; i < N; i++ {
 		start := time.Now()
-		randomized(context.Background(), delay)
+		sleep(context.Background(), randomized(delay, DefaultJitter))
 		elapsed := time.Since(start)
 		t.Logf("sleep duration: %v", elapsed)
 		diff := float64(elapsed - delay)
@@ -104,3 +104,54 @@ func TestRandomization(t *testing.T) {
 		t.Errorf("sleep interval was too consistent (+- %.1f%%)", stdDevFraction*100)
 	}
 }
+
+func TestBackoffDelay(t *testing.T) {
+	opts := Options{
+		BackoffMultiplier:  2,
+		BackoffMinDuration: time.Millisecond,
+		BackoffMaxDuration: 5 * time.Millisecond,
+	}
+	for _, test := range []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 2 * time.Millisecond},
+		{2, 4 * time.Millisecond},
+		{3, 5 * time.Millisecond},
+		{100, 5 * time.Millisecond},
+	} {
+		if got := backoffDelay(test.attempt, opts); got != test.want {
+			t.Errorf("backoffDelay(%d): got %v, want %v", test.attempt, got, test.want)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	opts := Options{
+		BackoffMultiplier:  2,
+		BackoffMinDuration: time.Millisecond,
+		BackoffMaxDuration: 5 * time.Millisecond,
+	}
+	noJitter := 0.0
+	for _, test := range []struct {
+		name   string
+		jitter *float64
+		min    float64 // minimum fraction of the backoff delay
+	}{
+		{"Default", nil, 1 - DefaultJitter},
+		{"None", &noJitter, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opts := opts
+			opts.Jitter = test.jitter
+			r := BeginWithOptions(opts)
+			for r.attempt = 1; r.attempt < 5; r.attempt++ {
+				backoff := backoffDelay(r.attempt, opts)
+				min := time.Duration(float64(backoff) * test.min)
+				if got := r.delay(); got < min || got > backoff {
+					t.Errorf("attempt %d: delay %v not in [%v, %v]", r.attempt, got, min, backoff)
+				}
+			}
+		})
+	}
+}
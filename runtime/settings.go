@@ -0,0 +1,802 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ComponentSettings holds the settings in a component's config section that
+// are interpreted by Service Weaver rather than by the component itself.
+// They may appear in the config section of any component, whether or not the
+// component has a config of its own. For example:
+//
+//	["github.com/example/app/Cache"]
+//	method_timeouts = {Get = "50ms", Put = "200ms"}
+//	retry = {max_attempts = 3, retry_on = ["unreachable"]}
+//	size = 1000 # interpreted by the Cache component
+//
+// The keys of ComponentSettings are therefore reserved in every component
+// config section.
+type ComponentSettings struct {
+	// MethodTimeouts maps method names to the maximum duration of a call to
+	// the method. A call that doesn't complete in time fails with
+	// context.DeadlineExceeded.
+	MethodTimeouts map[string]time.Duration `toml:"method_timeouts"`
+
+	// Retry is the retry policy of the component's methods, unless
+	// overridden in MethodRetries.
+	Retry RetryPolicy `toml:"retry"`
+
+	// MethodRetries maps method names to the retry policy of the method.
+	MethodRetries map[string]RetryPolicy `toml:"method_retries"`
+
+	// MethodHedging maps method names to the hedging policy of the method.
+	// Only idempotent methods should be hedged.
+	MethodHedging map[string]HedgingPolicy `toml:"method_hedging"`
+
+	// MethodRateLimits maps method names to the rate limit of the method.
+	MethodRateLimits map[string]RateLimitPolicy `toml:"method_rate_limits"`
+
+	// CircuitBreaker configures the circuit breaker that sheds calls to the
+	// component when they fail or are slow.
+	CircuitBreaker CircuitBreakerPolicy `toml:"circuit_breaker"`
+
+	// Concurrency caps the number of calls to the component's methods that
+	// a replica executes concurrently.
+	Concurrency ConcurrencyPolicy `toml:"concurrency"`
+
+	// Batching configures the coalescing of concurrent calls to the
+	// component's methods into batched RPCs.
+	Batching BatchingPolicy `toml:"batching"`
+
+	// Router is the name of the router, registered with weaver.RegisterRouter,
+	// used to route calls to the component instead of the component's default
+	// router. It applies only to routed components.
+	Router string `toml:"router"`
+
+	// Actors configures a routed component to have an instance per routing
+	// key, rather than an instance per replica.
+	Actors ActorPolicy `toml:"actors"`
+
+	// SnapshotInterval is how often the runtime checkpoints the state of a
+	// stateful component, i.e., a component whose implementation has
+	// Snapshot and Restore methods, to the snapshots directory configured in
+	// the application config. If zero, the state is checkpointed only when the
+	// component, or an actor of the component, is shut down.
+	SnapshotInterval time.Duration `toml:"snapshot_interval"`
+
+	// Singleton, if true, makes a single replica of the component active
+	// deployment-wide. The replicas elect the active replica, which executes
+	// all calls to the component; the other replicas stand by, without
+	// initializing the component, and one of them takes over if the active
+	// replica fails. Routed components cannot be singletons.
+	Singleton bool `toml:"singleton"`
+
+	// Placement is the policy used to pick the replica that executes a call
+	// to the component:
+	//
+	//   - "" or "any": any replica, picked round robin.
+	//   - "locality": a replica in the caller's locality (e.g., zone) if
+	//     there is one, and any replica otherwise.
+	//
+	// Calls to routed methods are placed by their routing key instead.
+	Placement string `toml:"placement"`
+
+	// Balancing is the policy used to pick, among the replicas allowed by
+	// Placement, the replica that executes a call to the component:
+	//
+	//   - "" or "round_robin": the replicas in turn.
+	//   - "least_outstanding": the replica with the fewest calls in progress
+	//     from the caller.
+	//   - "power_of_two": the one of two random replicas with the fewer calls
+	//     in progress from the caller.
+	//
+	// Calls to routed methods are placed by their routing key instead.
+	Balancing string `toml:"balancing"`
+
+	// Autoscale configures the autoscaling of the process that hosts the
+	// component, driven by a metric exported by the component.
+	Autoscale AutoscalePolicy `toml:"autoscale"`
+
+	// Mirror configures the mirroring of calls to the component to a shadow
+	// deployment.
+	Mirror MirrorPolicy `toml:"mirror"`
+
+	// Logging configures the sampling and rate limiting of the log entries
+	// written by the component.
+	Logging LogPolicy `toml:"logging"`
+
+	// TraceSampling is the fraction, between 0 and 1, of the calls to the
+	// component's methods that are traced, unless overridden in
+	// MethodTraceSampling. If nil, calls are traced if and only if their
+	// caller is traced. See the tracing section of the application config.
+	TraceSampling *float64 `toml:"trace_sampling"`
+
+	// MethodTraceSampling maps method names to the fraction of the calls to
+	// the method that are traced.
+	MethodTraceSampling map[string]float64 `toml:"method_trace_sampling"`
+
+	// AuditedMethods lists the methods whose calls are recorded in the audit
+	// logs configured in the audit section of the application config.
+	AuditedMethods []string `toml:"audited_methods"`
+
+	// AllowedCallers, if not empty, lists the only components allowed to call
+	// the component's methods, by their full names, e.g.,
+	// "github.com/example/shop/CheckoutService", or "main" for the main
+	// component. Calls from the other components fail with an error that
+	// wraps weaver.ErrPermissionDenied.
+	AllowedCallers []string `toml:"allowed_callers"`
+
+	// MaxMessageSize is the maximum size, in bytes, of the serialized
+	// arguments, and of the serialized results, of a call to the component's
+	// methods. If zero, the max_message_size of the application config
+	// applies.
+	MaxMessageSize int `toml:"max_message_size"`
+}
+
+// Placement policies.
+const (
+	PlacementAny      = "any"
+	PlacementLocality = "locality"
+)
+
+// Balancing policies.
+const (
+	BalancingRoundRobin       = "round_robin"
+	BalancingLeastOutstanding = "least_outstanding"
+	BalancingPowerOfTwo       = "power_of_two"
+)
+
+// RetryPolicy configures the retries of failed calls to a component method.
+// Before the ith retry, the caller sleeps for a duration of
+// InitialBackoff * Multiplier^(i-1), capped to MaxBackoff, with jitter. The
+// method timeout, if any, bounds the duration of all attempts together.
+//
+// Only calls that failed in one of the RetryOn error classes are retried.
+// Errors returned by the method itself are never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// one. If zero or one, failed calls are not retried.
+	MaxAttempts int `toml:"max_attempts"`
+
+	// InitialBackoff is the backoff before the first retry. If zero,
+	// defaults to 10ms.
+	InitialBackoff time.Duration `toml:"initial_backoff"`
+
+	// MaxBackoff bounds the backoff between retries. If zero, the backoff
+	// is unbounded.
+	MaxBackoff time.Duration `toml:"max_backoff"`
+
+	// Multiplier is the factor by which the backoff grows after every retry.
+	// If zero, defaults to 1.3. Otherwise, it must be at least 1.
+	Multiplier float64 `toml:"multiplier"`
+
+	// Jitter is the fraction of every backoff that is randomly subtracted
+	// from it, between 0 and 1. If nil, defaults to 0.4. If zero, backoffs
+	// are not randomized.
+	Jitter *float64 `toml:"jitter"`
+
+	// RetryOn lists the classes of errors that are retried:
+	//
+	//   - "unreachable": no replica of the component could be reached, so
+	//     the call was not sent.
+	//   - "communication": the connection to the replica failed during the
+	//     call, so the method may or may not have executed.
+	//   - "overloaded": the replica was executing too many calls (see
+	//     ConcurrencyPolicy), so the method was not executed.
+	//
+	// If empty, defaults to ["unreachable", "overloaded"], which is safe for
+	// methods that are not idempotent.
+	RetryOn []string `toml:"retry_on"`
+}
+
+// Retry error classes.
+const (
+	RetryOnUnreachable   = "unreachable"
+	RetryOnCommunication = "communication"
+	RetryOnOverloaded    = "overloaded"
+)
+
+// HedgingPolicy configures the hedging of calls to a component method. If a
+// call has not returned after Delay, the caller sends the same call again,
+// which the load balancer places on another replica, and takes the first
+// reply. It keeps doing so every Delay until MaxAttempts calls are in flight.
+// Once a reply arrives, the other calls are canceled.
+//
+// A hedged method may execute more than once per call, so only idempotent
+// methods should be hedged. Hedging reduces the tail latency caused by slow
+// replicas at the cost of extra load, so Delay is usually set around the
+// method's 95th or 99th percentile latency.
+type HedgingPolicy struct {
+	// Delay is how long to wait for a reply before sending the call again.
+	Delay time.Duration `toml:"delay"`
+
+	// MaxAttempts is the maximum number of calls in flight, including the
+	// first one. If zero, defaults to 2.
+	MaxAttempts int `toml:"max_attempts"`
+}
+
+// validate checks that the policy is valid.
+func (p *HedgingPolicy) validate() error {
+	switch {
+	case p.Delay <= 0:
+		return fmt.Errorf("invalid non-positive delay %v", p.Delay)
+	case p.MaxAttempts < 0:
+		return fmt.Errorf("invalid negative max_attempts %d", p.MaxAttempts)
+	case p.MaxAttempts == 1:
+		return fmt.Errorf("max_attempts of 1 disables hedging")
+	}
+	return nil
+}
+
+// RateLimitPolicy caps the rate of the calls from other processes that a
+// replica of a component executes for a method, using a token bucket that
+// holds up to Burst tokens and is refilled with Rate tokens per second. Every
+// call takes a token; calls made while the bucket is empty fail with an error
+// that wraps weaver.ErrRateLimited, without being executed.
+//
+// If Key is set, calls are split by key, and every key has its own bucket:
+//
+//   - "routing_key": the routing key of the call, for routed methods.
+//   - "caller": the component that makes the call.
+type RateLimitPolicy struct {
+	// Rate is the number of calls allowed per second.
+	Rate float64 `toml:"rate"`
+
+	// Burst is the maximum number of calls allowed at once. If zero,
+	// defaults to Rate, rounded up.
+	Burst int `toml:"burst"`
+
+	// Key is the key by which calls are split, if any.
+	Key string `toml:"key"`
+}
+
+// Rate limit keys.
+const (
+	RateLimitByRoutingKey = "routing_key"
+	RateLimitByCaller     = "caller"
+)
+
+// validate checks that the policy is valid.
+func (p *RateLimitPolicy) validate() error {
+	switch {
+	case p.Rate <= 0:
+		return fmt.Errorf("invalid non-positive rate %v", p.Rate)
+	case p.Burst < 0:
+		return fmt.Errorf("invalid negative burst %d", p.Burst)
+	}
+	switch p.Key {
+	case "", RateLimitByRoutingKey, RateLimitByCaller:
+	default:
+		return fmt.Errorf("unknown key %q", p.Key)
+	}
+	return nil
+}
+
+// CircuitBreakerPolicy configures a circuit breaker. The breaker starts
+// closed, letting calls through. It opens when, over the last Window, at least
+// MinCalls calls were made and the fraction of failed calls reached ErrorRate
+// or the fraction of slow calls reached SlowRate. While open, calls fail
+// immediately. After OpenDuration, the breaker lets HalfOpenCalls probe calls
+// through: it closes if they all succeed quickly, and opens again otherwise.
+//
+// A call fails if it could not be completed, e.g., because the component was
+// unreachable or the call timed out. Errors returned by the method itself
+// don't count as failures.
+type CircuitBreakerPolicy struct {
+	// Window is the duration over which calls are counted. If zero, the
+	// circuit breaker is disabled.
+	Window time.Duration `toml:"window"`
+
+	// MinCalls is the minimum number of calls in the window for the breaker
+	// to open. If zero, defaults to 20.
+	MinCalls int `toml:"min_calls"`
+
+	// ErrorRate is the fraction of failed calls, between 0 and 1, at which
+	// the breaker opens. If zero, failed calls don't open the breaker.
+	ErrorRate float64 `toml:"error_rate"`
+
+	// SlowCall is the duration above which a call is slow.
+	SlowCall time.Duration `toml:"slow_call"`
+
+	// SlowRate is the fraction of slow calls, between 0 and 1, at which the
+	// breaker opens. If zero, slow calls don't open the breaker.
+	SlowRate float64 `toml:"slow_rate"`
+
+	// OpenDuration is how long the breaker stays open before probing the
+	// component. If zero, defaults to 30s.
+	OpenDuration time.Duration `toml:"open_duration"`
+
+	// HalfOpenCalls is the number of probe calls. If zero, defaults to 1.
+	HalfOpenCalls int `toml:"half_open_calls"`
+}
+
+// Enabled returns whether the circuit breaker is enabled.
+func (p *CircuitBreakerPolicy) Enabled() bool {
+	return p.Window > 0 && (p.ErrorRate > 0 || p.SlowRate > 0)
+}
+
+// validate checks that the policy is valid.
+func (p *CircuitBreakerPolicy) validate() error {
+	switch {
+	case p.Window < 0:
+		return fmt.Errorf("invalid negative window %v", p.Window)
+	case p.MinCalls < 0:
+		return fmt.Errorf("invalid negative min_calls %d", p.MinCalls)
+	case p.ErrorRate < 0 || p.ErrorRate > 1:
+		return fmt.Errorf("invalid error_rate %v not between 0 and 1", p.ErrorRate)
+	case p.SlowRate < 0 || p.SlowRate > 1:
+		return fmt.Errorf("invalid slow_rate %v not between 0 and 1", p.SlowRate)
+	case p.SlowCall < 0:
+		return fmt.Errorf("invalid negative slow_call %v", p.SlowCall)
+	case p.SlowRate > 0 && p.SlowCall == 0:
+		return fmt.Errorf("slow_rate requires slow_call")
+	case p.OpenDuration < 0:
+		return fmt.Errorf("invalid negative open_duration %v", p.OpenDuration)
+	case p.HalfOpenCalls < 0:
+		return fmt.Errorf("invalid negative half_open_calls %d", p.HalfOpenCalls)
+	}
+	return nil
+}
+
+// ConcurrencyPolicy caps the number of calls from other processes that a
+// replica of a component executes concurrently. Calls beyond MaxInFlight wait
+// for a running call to finish, up to MaxQueued of them. The other calls fail
+// with an error that wraps weaver.ErrOverloaded, without being executed.
+type ConcurrencyPolicy struct {
+	// MaxInFlight is the maximum number of calls executed concurrently. If
+	// zero, the number of calls is unlimited.
+	MaxInFlight int `toml:"max_in_flight"`
+
+	// MaxQueued is the maximum number of calls waiting to be executed. If
+	// zero, calls beyond MaxInFlight fail right away.
+	MaxQueued int `toml:"max_queued"`
+}
+
+// validate checks that the policy is valid.
+func (p *ConcurrencyPolicy) validate() error {
+	switch {
+	case p.MaxInFlight < 0:
+		return fmt.Errorf("invalid negative max_in_flight %d", p.MaxInFlight)
+	case p.MaxQueued < 0:
+		return fmt.Errorf("invalid negative max_queued %d", p.MaxQueued)
+	case p.MaxQueued > 0 && p.MaxInFlight == 0:
+		return fmt.Errorf("max_queued requires max_in_flight")
+	}
+	return nil
+}
+
+// ActorPolicy configures a routed component to have a logical instance, or
+// actor, per routing key. An actor is activated, i.e., created and
+// initialized, when it receives its first call, and is passivated, i.e., shut
+// down and discarded, once it receives no calls for IdleTimeout. The calls to
+// an actor are executed one at a time, in the replica that the routing key is
+// routed to.
+type ActorPolicy struct {
+	// Enabled enables actors.
+	Enabled bool `toml:"enabled"`
+
+	// IdleTimeout is how long an actor remains active without receiving
+	// calls. If zero, DefaultActorIdleTimeout is used.
+	IdleTimeout time.Duration `toml:"idle_timeout"`
+}
+
+// DefaultActorIdleTimeout is the default ActorPolicy.IdleTimeout.
+const DefaultActorIdleTimeout = 10 * time.Minute
+
+// validate checks that the policy is valid.
+func (p *ActorPolicy) validate() error {
+	switch {
+	case p.IdleTimeout < 0:
+		return fmt.Errorf("invalid negative idle_timeout %v", p.IdleTimeout)
+	case p.IdleTimeout > 0 && !p.Enabled:
+		return fmt.Errorf("idle_timeout requires enabled")
+	}
+	return nil
+}
+
+// AutoscalePolicy configures the number of replicas of the process that hosts
+// a component, based on the value of a metric exported by the component, like
+// the depth of a queue. The value of the metric is summed over all replicas
+// and divided by Target, and the result, rounded up and bounded by MinReplicas
+// and MaxReplicas, is the desired number of replicas. Gauges make the best
+// scaling signals.
+//
+// Autoscaling is applied by the deployers that support it, like "weaver
+// multi". If multiple components hosted by the same process have a policy,
+// the process gets the largest number of replicas that any policy asks for.
+type AutoscalePolicy struct {
+	// Metric is the name of the metric. If empty, autoscaling is disabled.
+	Metric string `toml:"metric"`
+
+	// Target is the value of the metric that a single replica should handle.
+	Target float64 `toml:"target"`
+
+	// MinReplicas is the minimum number of replicas. If zero, defaults to 1.
+	MinReplicas int `toml:"min_replicas"`
+
+	// MaxReplicas is the maximum number of replicas.
+	MaxReplicas int `toml:"max_replicas"`
+}
+
+// Enabled returns whether autoscaling is enabled.
+func (p *AutoscalePolicy) Enabled() bool {
+	return p.Metric != ""
+}
+
+// Replicas returns the desired number of replicas, given the value of the
+// metric summed over all replicas.
+func (p *AutoscalePolicy) Replicas(total float64) int {
+	min := p.MinReplicas
+	if min == 0 {
+		min = 1
+	}
+	n := math.Ceil(total / p.Target)
+	switch {
+	case n < float64(min):
+		return min
+	case n > float64(p.MaxReplicas):
+		return p.MaxReplicas
+	}
+	return int(n)
+}
+
+// validate checks that the policy is valid.
+func (p *AutoscalePolicy) validate() error {
+	if !p.Enabled() {
+		return nil
+	}
+	switch {
+	case p.Target <= 0:
+		return fmt.Errorf("invalid non-positive target %v", p.Target)
+	case p.MinReplicas < 0:
+		return fmt.Errorf("invalid negative min_replicas %d", p.MinReplicas)
+	case p.MaxReplicas < 1:
+		return fmt.Errorf("invalid non-positive max_replicas %d", p.MaxReplicas)
+	case p.MaxReplicas < p.MinReplicas:
+		return fmt.Errorf("max_replicas %d less than min_replicas %d", p.MaxReplicas, p.MinReplicas)
+	}
+	return nil
+}
+
+// BatchingPolicy configures the batching of calls to a component. For example:
+//
+//	["github.com/example/app/Scorer"]
+//	batching = {max_delay = "500us", max_size = 64, methods = ["Score"]}
+//
+// makes callers of Scorer.Score hold each remote call for up to 500
+// microseconds, so that it can be sent to the same replica in a single RPC
+// along with other concurrent calls. A batch is sent as soon as it holds 64
+// calls. Every caller receives its own results, or error, as if its call had
+// been sent alone. Calls to routed components are batched with calls that
+// have the same routing key. Batching trades latency for throughput: it pays
+// off for many small, concurrent calls, and it never applies to local calls.
+type BatchingPolicy struct {
+	// MaxDelay is the longest a call waits for other calls to join its batch.
+	// If zero, calls are not batched.
+	MaxDelay time.Duration `toml:"max_delay"`
+
+	// MaxSize is the largest number of calls in a batch. If zero, defaults
+	// to 100.
+	MaxSize int `toml:"max_size"`
+
+	// Methods holds the names of the batched methods. If empty, calls to all
+	// methods are batched.
+	Methods []string `toml:"methods"`
+}
+
+// Enabled returns whether calls are batched.
+func (p *BatchingPolicy) Enabled() bool {
+	return p.MaxDelay > 0
+}
+
+// validate checks that the policy is valid for a component with the provided
+// interface type, if not nil.
+func (p *BatchingPolicy) validate(iface reflect.Type) error {
+	switch {
+	case p.MaxDelay < 0:
+		return fmt.Errorf("invalid negative max_delay %v", p.MaxDelay)
+	case p.MaxSize < 0:
+		return fmt.Errorf("invalid negative max_size %d", p.MaxSize)
+	}
+	for _, method := range p.Methods {
+		if !hasMethod(iface, method) {
+			return fmt.Errorf("unknown method %q", method)
+		}
+	}
+	return nil
+}
+
+// MirrorPolicy configures the mirroring of calls to a component to the
+// replicas of the component in a shadow deployment, i.e., a deployment of a new
+// version of the application that receives no traffic of its own. The replies
+// of mirrored calls are discarded, but the shadow deployment records their
+// logs, metrics, and traces.
+//
+// Only remote calls are mirrored, and only by the deployers that support
+// shadow deployments, like "weaver multi".
+type MirrorPolicy struct {
+	// Fraction is the fraction of calls, between 0 and 1, that are mirrored.
+	// If zero, calls are not mirrored.
+	Fraction float64 `toml:"fraction"`
+}
+
+// validate checks that the policy is valid.
+func (p *MirrorPolicy) validate() error {
+	if p.Fraction < 0 || p.Fraction > 1 {
+		return fmt.Errorf("invalid fraction %v not between 0 and 1", p.Fraction)
+	}
+	return nil
+}
+
+// LogPolicy limits the log entries that a component writes, per log level
+// ("debug", "info", or "error"). For example:
+//
+//	["github.com/example/app/CartCache"]
+//	logging = {sampling = {debug = 0.1}, rate_limits = {debug = 100, info = 1000}}
+//
+// keeps a random 10% of the debug entries of CartCache, and then at most 100
+// of them per second. The limits are enforced by every replica of the
+// component independently, before log entries leave the weavelet. Dropped
+// entries are counted by the serviceweaver_log_dropped_count metric.
+type LogPolicy struct {
+	// Sampling maps log levels to the fraction of log entries, between 0
+	// and 1, that are kept. Levels that are missing are not sampled.
+	Sampling map[string]float64 `toml:"sampling"`
+
+	// RateLimits maps log levels to the maximum number of log entries per
+	// second that are kept, with bursts of up to one second's worth of
+	// entries (or one entry, if the rate is below one). Levels that are
+	// missing are not rate limited.
+	RateLimits map[string]float64 `toml:"rate_limits"`
+}
+
+// Enabled returns whether the policy limits any log entries.
+func (p *LogPolicy) Enabled() bool {
+	return len(p.Sampling) > 0 || len(p.RateLimits) > 0
+}
+
+// validate checks that the policy is valid.
+func (p *LogPolicy) validate() error {
+	for _, level := range sortedKeys(p.Sampling) {
+		if !isLogLevel(level) {
+			return fmt.Errorf("sampling: unknown log level %q", level)
+		}
+		if f := p.Sampling[level]; f < 0 || f > 1 {
+			return fmt.Errorf("sampling: invalid fraction %v for level %q not between 0 and 1", f, level)
+		}
+	}
+	for _, level := range sortedKeys(p.RateLimits) {
+		if !isLogLevel(level) {
+			return fmt.Errorf("rate_limits: unknown log level %q", level)
+		}
+		if r := p.RateLimits[level]; r <= 0 {
+			return fmt.Errorf("rate_limits: invalid non-positive rate %v for level %q", r, level)
+		}
+	}
+	return nil
+}
+
+// isLogLevel returns whether level is the name of a log level.
+func isLogLevel(level string) bool {
+	return level == "debug" || level == "info" || level == "error"
+}
+
+// sortedKeys returns the sorted keys of m.
+func sortedKeys[V any](m map[string]V) []string {
+	levels := make([]string, 0, len(m))
+	for level := range m {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	return levels
+}
+
+// ShadowRoutingKey returns the name that a weavelet passes, in place of a
+// process name, to get the routing info of the named component in a shadow
+// deployment. See MirrorPolicy.
+func ShadowRoutingKey(component string) string {
+	return "shadow:" + component
+}
+
+// validate checks that the policy is valid.
+func (p *RetryPolicy) validate() error {
+	switch {
+	case p.MaxAttempts < 0:
+		return fmt.Errorf("invalid negative max_attempts %d", p.MaxAttempts)
+	case p.InitialBackoff < 0:
+		return fmt.Errorf("invalid negative initial_backoff %v", p.InitialBackoff)
+	case p.MaxBackoff < 0:
+		return fmt.Errorf("invalid negative max_backoff %v", p.MaxBackoff)
+	case p.Multiplier != 0 && p.Multiplier < 1:
+		return fmt.Errorf("invalid multiplier %v less than 1", p.Multiplier)
+	case p.Jitter != nil && (*p.Jitter < 0 || *p.Jitter > 1):
+		return fmt.Errorf("invalid jitter %v not between 0 and 1", *p.Jitter)
+	}
+	for _, class := range p.RetryOn {
+		if class != RetryOnUnreachable && class != RetryOnCommunication && class != RetryOnOverloaded {
+			return fmt.Errorf("unknown retry_on error class %q", class)
+		}
+	}
+	return nil
+}
+
+// componentSettingsKeys holds the TOML keys of the ComponentSettings fields.
+var componentSettingsKeys = func() map[string]bool {
+	keys := map[string]bool{}
+	t := reflect.TypeOf(ComponentSettings{})
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("toml"), ",")
+		keys[key] = true
+	}
+	return keys
+}()
+
+// ParseComponentSettings parses the ComponentSettings in the config section
+// of the named component, ignoring any other keys. iface is the component's
+// interface type, against which method names are checked; if nil, method names
+// are not checked. If the section is missing, ParseComponentSettings returns
+// empty settings.
+func ParseComponentSettings(name string, iface reflect.Type, sections map[string]string) (*ComponentSettings, error) {
+	settings := &ComponentSettings{}
+	section, ok := sections[name]
+	if !ok {
+		return settings, nil
+	}
+	if _, err := toml.Decode(section, settings); err != nil {
+		return nil, fmt.Errorf("section %q: %w", name, err)
+	}
+	if err := settings.validate(iface); err != nil {
+		return nil, fmt.Errorf("section %q: %w", name, err)
+	}
+	return settings, nil
+}
+
+// validate checks that the settings are valid for a component with the
+// provided interface type, if not nil.
+func (s *ComponentSettings) validate(iface reflect.Type) error {
+	var methods []string
+	for method := range s.MethodTimeouts {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		if !hasMethod(iface, method) {
+			return fmt.Errorf("method_timeouts: unknown method %q", method)
+		}
+		if s.MethodTimeouts[method] <= 0 {
+			return fmt.Errorf("method_timeouts: invalid non-positive timeout %v for method %q", s.MethodTimeouts[method], method)
+		}
+	}
+	if err := s.Retry.validate(); err != nil {
+		return fmt.Errorf("retry: %w", err)
+	}
+	methods = methods[:0]
+	for method := range s.MethodRetries {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		if !hasMethod(iface, method) {
+			return fmt.Errorf("method_retries: unknown method %q", method)
+		}
+		policy := s.MethodRetries[method]
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("method_retries: method %q: %w", method, err)
+		}
+	}
+	for _, method := range sortedKeys(s.MethodHedging) {
+		if !hasMethod(iface, method) {
+			return fmt.Errorf("method_hedging: unknown method %q", method)
+		}
+		policy := s.MethodHedging[method]
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("method_hedging: method %q: %w", method, err)
+		}
+	}
+	for _, method := range sortedKeys(s.MethodRateLimits) {
+		if !hasMethod(iface, method) {
+			return fmt.Errorf("method_rate_limits: unknown method %q", method)
+		}
+		policy := s.MethodRateLimits[method]
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("method_rate_limits: method %q: %w", method, err)
+		}
+	}
+	for _, method := range s.AuditedMethods {
+		if !hasMethod(iface, method) {
+			return fmt.Errorf("audited_methods: unknown method %q", method)
+		}
+	}
+	for _, caller := range s.AllowedCallers {
+		if caller == "" {
+			return fmt.Errorf("allowed_callers: empty component name")
+		}
+	}
+	if err := s.CircuitBreaker.validate(); err != nil {
+		return fmt.Errorf("circuit_breaker: %w", err)
+	}
+	if err := s.Concurrency.validate(); err != nil {
+		return fmt.Errorf("concurrency: %w", err)
+	}
+	if err := s.Batching.validate(iface); err != nil {
+		return fmt.Errorf("batching: %w", err)
+	}
+	if err := s.Actors.validate(); err != nil {
+		return fmt.Errorf("actors: %w", err)
+	}
+	if s.SnapshotInterval < 0 {
+		return fmt.Errorf("invalid negative snapshot_interval %v", s.SnapshotInterval)
+	}
+	switch s.Placement {
+	case "", PlacementAny, PlacementLocality:
+	default:
+		return fmt.Errorf("placement: unknown policy %q", s.Placement)
+	}
+	switch s.Balancing {
+	case "", BalancingRoundRobin, BalancingLeastOutstanding, BalancingPowerOfTwo:
+	default:
+		return fmt.Errorf("balancing: unknown policy %q", s.Balancing)
+	}
+	if err := s.Autoscale.validate(); err != nil {
+		return fmt.Errorf("autoscale: %w", err)
+	}
+	if err := s.Mirror.validate(); err != nil {
+		return fmt.Errorf("mirror: %w", err)
+	}
+	if err := s.Logging.validate(); err != nil {
+		return fmt.Errorf("logging: %w", err)
+	}
+	if s.TraceSampling != nil && (*s.TraceSampling < 0 || *s.TraceSampling > 1) {
+		return fmt.Errorf("trace_sampling: invalid fraction %v not between 0 and 1", *s.TraceSampling)
+	}
+	for _, method := range sortedKeys(s.MethodTraceSampling) {
+		if !hasMethod(iface, method) {
+			return fmt.Errorf("method_trace_sampling: unknown method %q", method)
+		}
+		if f := s.MethodTraceSampling[method]; f < 0 || f > 1 {
+			return fmt.Errorf("method_trace_sampling: invalid fraction %v for method %q not between 0 and 1", f, method)
+		}
+	}
+	if err := validateMaxMessageSize(s.MaxMessageSize); err != nil {
+		return err
+	}
+	return nil
+}
+
+// hasMethod returns whether the interface type has the named method. If iface
+// is nil, it has every method.
+func hasMethod(iface reflect.Type, method string) bool {
+	if iface == nil {
+		return true
+	}
+	_, ok := iface.MethodByName(method)
+	return ok
+}
+
+// ParseComponentConfigSection is like ParseConfigSection, for the config
+// section of the named component, except that it ignores the keys reserved
+// for ComponentSettings.
+func ParseComponentConfigSection(name string, sections map[string]string, dst any) error {
+	return parseConfigSection(name, "", sections, dst, componentSettingsKeys)
+}
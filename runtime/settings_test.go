@@ -0,0 +1,253 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/google/go-cmp/cmp"
+)
+
+type testCache interface {
+	Get(context.Context, string) (string, error)
+	Put(context.Context, string, string) error
+}
+
+// noValidation is a component config validator that accepts every config.
+func noValidation(string, string) error { return nil }
+
+func TestParseComponentSettings(t *testing.T) {
+	iface := reflect.TypeOf((*testCache)(nil)).Elem()
+	noJitter := 0.0
+	for _, c := range []struct {
+		name   string
+		config string
+		expect runtime.ComponentSettings
+	}{
+		{"missing", ``, runtime.ComponentSettings{}},
+		{"no settings", `cache = { size = 10 }`, runtime.ComponentSettings{}},
+		{
+			"timeouts",
+			`cache = { method_timeouts = { Get = "50ms", Put = "1s" }, size = 10 }`,
+			runtime.ComponentSettings{
+				MethodTimeouts: map[string]time.Duration{
+					"Get": 50 * time.Millisecond,
+					"Put": time.Second,
+				},
+			},
+		},
+		{
+			"retries",
+			`cache = { retry = { max_attempts = 3, multiplier = 2.0 }, method_retries = { Put = { max_attempts = 1, jitter = 0.0 } } }`,
+			runtime.ComponentSettings{
+				Retry: runtime.RetryPolicy{MaxAttempts: 3, Multiplier: 2},
+				MethodRetries: map[string]runtime.RetryPolicy{
+					"Put": {MaxAttempts: 1, Jitter: &noJitter},
+				},
+			},
+		},
+		{
+			"autoscale",
+			`cache = { autoscale = { metric = "queue_depth", target = 100.0, max_replicas = 5 } }`,
+			runtime.ComponentSettings{
+				Autoscale: runtime.AutoscalePolicy{Metric: "queue_depth", Target: 100, MaxReplicas: 5},
+			},
+		},
+		{
+			"hedging",
+			`cache = { method_hedging = { Get = { delay = "20ms", max_attempts = 3 } } }`,
+			runtime.ComponentSettings{
+				MethodHedging: map[string]runtime.HedgingPolicy{
+					"Get": {Delay: 20 * time.Millisecond, MaxAttempts: 3},
+				},
+			},
+		},
+		{
+			"rate limits",
+			`cache = { method_rate_limits = { Get = { rate = 100.0, burst = 20, key = "caller" } } }`,
+			runtime.ComponentSettings{
+				MethodRateLimits: map[string]runtime.RateLimitPolicy{
+					"Get": {Rate: 100, Burst: 20, Key: "caller"},
+				},
+			},
+		},
+		{
+			"actors",
+			`cache = { actors = { enabled = true, idle_timeout = "5m" } }`,
+			runtime.ComponentSettings{Actors: runtime.ActorPolicy{Enabled: true, IdleTimeout: 5 * time.Minute}},
+		},
+		{
+			"snapshot interval",
+			`cache = { snapshot_interval = "1m" }`,
+			runtime.ComponentSettings{SnapshotInterval: time.Minute},
+		},
+		{
+			"singleton",
+			`cache = { singleton = true }`,
+			runtime.ComponentSettings{Singleton: true},
+		},
+		{
+			"audited methods",
+			`cache = { audited_methods = ["Put"] }`,
+			runtime.ComponentSettings{AuditedMethods: []string{"Put"}},
+		},
+		{
+			"allowed callers",
+			`cache = { allowed_callers = ["main", "github.com/example/shop/Checkout"] }`,
+			runtime.ComponentSettings{
+				AllowedCallers: []string{"main", "github.com/example/shop/Checkout"},
+			},
+		},
+		{
+			"batching",
+			`cache = { batching = { max_delay = "500us", max_size = 64, methods = ["Get"] } }`,
+			runtime.ComponentSettings{
+				Batching: runtime.BatchingPolicy{MaxDelay: 500 * time.Microsecond, MaxSize: 64, Methods: []string{"Get"}},
+			},
+		},
+		{
+			"logging",
+			`cache = { logging = { sampling = { debug = 0.1 }, rate_limits = { debug = 100, info = 1000 } } }`,
+			runtime.ComponentSettings{
+				Logging: runtime.LogPolicy{
+					Sampling:   map[string]float64{"debug": 0.1},
+					RateLimits: map[string]float64{"debug": 100, "info": 1000},
+				},
+			},
+		},
+		{
+			"trace sampling",
+			`cache = { trace_sampling = 0.0, method_trace_sampling = { Get = 0.01 } }`,
+			runtime.ComponentSettings{
+				TraceSampling:       new(float64),
+				MethodTraceSampling: map[string]float64{"Get": 0.01},
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			config, err := runtime.ParseConfig("", c.config, noValidation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := runtime.ParseComponentSettings("cache", iface, config.Sections)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.expect, *got); diff != "" {
+				t.Fatalf("ParseComponentSettings: (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestComponentSettingsErrors(t *testing.T) {
+	iface := reflect.TypeOf((*testCache)(nil)).Elem()
+	for _, c := range []struct {
+		name          string
+		config        string
+		expectedError string
+	}{
+		{"unknown method", `cache = { method_timeouts = { Remove = "1s" } }`, `unknown method "Remove"`},
+		{"zero timeout", `cache = { method_timeouts = { Get = "0s" } }`, "non-positive timeout"},
+		{"bad timeout", `cache = { method_timeouts = { Get = "soon" } }`, "invalid duration"},
+		{"bad multiplier", `cache = { retry = { multiplier = 0.5 } }`, "invalid multiplier"},
+		{"bad jitter", `cache = { retry = { jitter = 2.0 } }`, "invalid jitter"},
+		{"bad error class", `cache = { retry = { retry_on = ["timeout"] } }`, `unknown retry_on error class "timeout"`},
+		{"bad error rate", `cache = { circuit_breaker = { window = "10s", error_rate = 1.5 } }`, "invalid error_rate"},
+		{"slow rate without slow call", `cache = { circuit_breaker = { window = "10s", slow_rate = 0.5 } }`, "slow_rate requires slow_call"},
+		{"negative max in flight", `cache = { concurrency = { max_in_flight = -1 } }`, "invalid negative max_in_flight"},
+		{"queue without max in flight", `cache = { concurrency = { max_queued = 10 } }`, "max_queued requires max_in_flight"},
+		{"unknown hedging method", `cache = { method_hedging = { Remove = { delay = "1ms" } } }`, `unknown method "Remove"`},
+		{"missing hedging delay", `cache = { method_hedging = { Get = { max_attempts = 2 } } }`, "non-positive delay"},
+		{"unknown rate limit method", `cache = { method_rate_limits = { Remove = { rate = 10.0 } } }`, `unknown method "Remove"`},
+		{"missing rate", `cache = { method_rate_limits = { Get = { burst = 10 } } }`, "non-positive rate"},
+		{"negative actor idle timeout", `cache = { actors = { enabled = true, idle_timeout = "-1s" } }`, "invalid negative idle_timeout"},
+		{"actor idle timeout without actors", `cache = { actors = { idle_timeout = "1m" } }`, "idle_timeout requires enabled"},
+		{"negative snapshot interval", `cache = { snapshot_interval = "-1m" }`, "invalid negative snapshot_interval"},
+		{"unknown audited method", `cache = { audited_methods = ["Remove"] }`, `unknown method "Remove"`},
+		{"empty allowed caller", `cache = { allowed_callers = [""] }`, "empty component name"},
+		{"unknown rate limit key", `cache = { method_rate_limits = { Get = { rate = 10.0, key = "ip" } } }`, `unknown key "ip"`},
+		{"negative batching delay", `cache = { batching = { max_delay = "-1ms" } }`, "invalid negative max_delay"},
+		{"unknown batching method", `cache = { batching = { max_delay = "1ms", methods = ["Remove"] } }`, `unknown method "Remove"`},
+		{"unknown retry method", `cache = { method_retries = { Remove = { max_attempts = 2 } } }`, `unknown method "Remove"`},
+		{"unknown placement", `cache = { placement = "nearest" }`, `unknown policy "nearest"`},
+		{"unknown balancing", `cache = { balancing = "random" }`, `unknown policy "random"`},
+		{"bad mirror fraction", `cache = { mirror = { fraction = 1.5 } }`, "invalid fraction"},
+		{"unknown log level", `cache = { logging = { rate_limits = { warning = 10 } } }`, `unknown log level "warning"`},
+		{"bad log sampling", `cache = { logging = { sampling = { debug = 2.0 } } }`, "not between 0 and 1"},
+		{"bad log rate", `cache = { logging = { rate_limits = { debug = 0 } } }`, "non-positive rate"},
+		{"bad trace sampling", `cache = { trace_sampling = 1.5 }`, "invalid fraction"},
+		{"unknown trace sampling method", `cache = { method_trace_sampling = { Remove = 0.5 } }`, `unknown method "Remove"`},
+		{"negative max message size", `cache = { max_message_size = -1 }`, "invalid negative max_message_size"},
+		{"autoscale without target", `cache = { autoscale = { metric = "queue_depth", max_replicas = 5 } }`, "non-positive target"},
+		{"autoscale max below min", `cache = { autoscale = { metric = "queue_depth", target = 1.0, min_replicas = 3, max_replicas = 2 } }`, "less than min_replicas"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			config, err := runtime.ParseConfig("", c.config, noValidation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = runtime.ParseComponentSettings("cache", iface, config.Sections)
+			if err == nil || !strings.Contains(err.Error(), c.expectedError) {
+				t.Fatalf("got error %v, want error containing %q", err, c.expectedError)
+			}
+		})
+	}
+}
+
+func TestParseComponentConfigSection(t *testing.T) {
+	type section struct {
+		Size int
+	}
+	config, err := runtime.ParseConfig("", `cache = { method_timeouts = { Get = "1s" }, size = 10 }`, noValidation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got section
+	if err := runtime.ParseComponentConfigSection("cache", config.Sections, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Size != 10 {
+		t.Fatalf("size: got %d, want 10", got.Size)
+	}
+
+	// Settings keys are only reserved in component config sections.
+	if err := runtime.ParseConfigSection("cache", "", config.Sections, &got); err == nil {
+		t.Fatal("ParseConfigSection: unexpected success")
+	}
+}
+
+func TestAutoscaleReplicas(t *testing.T) {
+	policy := runtime.AutoscalePolicy{Metric: "queue_depth", Target: 10, MinReplicas: 2, MaxReplicas: 5}
+	for _, c := range []struct {
+		total float64
+		want  int
+	}{
+		{0, 2},
+		{15, 2},
+		{21, 3},
+		{30, 3},
+		{1000, 5},
+	} {
+		if got := policy.Replicas(c.total); got != c.want {
+			t.Errorf("Replicas(%v): got %d, want %d", c.total, got, c.want)
+		}
+	}
+}
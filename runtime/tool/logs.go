@@ -21,6 +21,8 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -40,6 +42,103 @@ type LogsSpec struct {
 	follow bool
 	format string
 	system bool
+	logFilters
+}
+
+// logFilters are the filters, set by flags, that are combined with a query.
+type logFilters struct {
+	components stringList // components, abbreviated or not
+	level      string     // minimum level
+	attrs      stringList // key=value or key
+	since      string     // duration or RFC 3339 timestamp
+	until      string     // duration or RFC 3339 timestamp
+	grep       string     // regular expression over msg
+}
+
+// levels holds the log levels, by increasing severity.
+var levels = []string{"debug", "info", "warn", "error"}
+
+// stringList is a flag.Value that holds the values of a repeated flag.
+type stringList []string
+
+var _ flag.Value = &stringList{}
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(s string) error { *l = append(*l, s); return nil }
+
+// query returns the query, over log entries logged no later than now, that
+// is equivalent to the filters, or "" if there are no filters.
+func (f *logFilters) query(now time.Time) (string, error) {
+	var clauses []string
+	if len(f.components) > 0 {
+		var alts []string
+		for _, c := range f.components {
+			alts = append(alts, fmt.Sprintf("component == %s || full_component == %s", strconv.Quote(c), strconv.Quote(c)))
+		}
+		clauses = append(clauses, strings.Join(alts, " || "))
+	}
+	if f.level != "" {
+		i := 0
+		for i < len(levels) && levels[i] != f.level {
+			i++
+		}
+		if i == len(levels) {
+			return "", fmt.Errorf("invalid level %q; must be one of %s", f.level, strings.Join(levels, ", "))
+		}
+		var alts []string
+		for _, l := range levels[i:] {
+			alts = append(alts, fmt.Sprintf("level == %q", l))
+		}
+		clauses = append(clauses, strings.Join(alts, " || "))
+	}
+	for _, attr := range f.attrs {
+		key, value, ok := strings.Cut(attr, "=")
+		if key == "" {
+			return "", fmt.Errorf("invalid attribute %q; must be key=value or key", attr)
+		}
+		if ok {
+			clauses = append(clauses, fmt.Sprintf("attrs[%s] == %s", strconv.Quote(key), strconv.Quote(value)))
+		} else {
+			clauses = append(clauses, fmt.Sprintf("%s in attrs", strconv.Quote(key)))
+		}
+	}
+	for _, bound := range []struct{ flag, value, op string }{
+		{"since", f.since, ">="},
+		{"until", f.until, "<="},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := parseTime(bound.value, now)
+		if err != nil {
+			return "", fmt.Errorf("invalid --%s: %w", bound.flag, err)
+		}
+		clauses = append(clauses, fmt.Sprintf("time %s timestamp(%q)", bound.op, t.UTC().Format(time.RFC3339Nano)))
+	}
+	if f.grep != "" {
+		if _, err := regexp.Compile(f.grep); err != nil {
+			return "", fmt.Errorf("invalid --grep: %w", err)
+		}
+		clauses = append(clauses, fmt.Sprintf("msg.matches(%s)", strconv.Quote(f.grep)))
+	}
+
+	for i, c := range clauses {
+		clauses[i] = "(" + c + ")"
+	}
+	return strings.Join(clauses, " && "), nil
+}
+
+// parseTime parses a time that is either an RFC 3339 timestamp or a
+// duration, e.g., "1h30m", before now.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration nor an RFC 3339 timestamp", s)
+	}
+	return t, nil
 }
 
 // fullEntry is like runtime.LogEntry, but has all the fields present in the
@@ -69,8 +168,14 @@ func LogsCmd(spec *LogsSpec) *Command {
 	spec.Flags.BoolVar(&spec.follow, "follow", false, "Act like tail -f")
 	spec.Flags.StringVar(&spec.format, "format", "pretty", "Output format (pretty or json)")
 	spec.Flags.BoolVar(&spec.system, "system", false, "Show system internal logs")
+	spec.Flags.Var(&spec.components, "component", "Only show logs of this component (repeatable)")
+	spec.Flags.StringVar(&spec.level, "level", "", "Only show logs of this level (debug, info, warn, or error) or higher")
+	spec.Flags.Var(&spec.attrs, "attr", "Only show logs with this attribute, key=value or key (repeatable)")
+	spec.Flags.StringVar(&spec.since, "since", "", "Only show logs since this duration ago (e.g., 1h) or RFC 3339 timestamp")
+	spec.Flags.StringVar(&spec.until, "until", "", "Only show logs until this duration ago (e.g., 5m) or RFC 3339 timestamp")
+	spec.Flags.StringVar(&spec.grep, "grep", "", "Only show logs whose message matches this regular expression")
 	const help = `Usage:
-  {{.Tool}} logs [--follow] [--format=<format>] [--system] [query]
+  {{.Tool}} logs [--follow] [--format=<format>] [--system] [filters] [query]
 
 Flags:
   -h, --help	Print this help message.
@@ -99,6 +204,10 @@ Queries:
   see the "Query Reference" section below for a complete description of the
   query language.
 
+  The --component, --level, --attr, --since, --until, and --grep flags are
+  shorthands for common queries. They are combined with the query, if any,
+  and apply to followed logs too.
+
 Examples:
   # Display all of the logs
   {{.Tool}} logs
@@ -171,6 +280,17 @@ Examples:
   # Display all of the logs that don't have a "foo" attribute.
   {{.Tool}} logs '!("foo" in attrs)'
 
+  # Display the warnings and errors of the "Store" component logged in the last
+  # 30 minutes.
+  {{.Tool}} logs --component=Store --level=warn --since=30m
+
+  # Follow the logs of the "todo" app with attribute "user" set to "alice"
+  # and a message that matches the regex "timeout|deadline".
+  {{.Tool}} logs --follow --attr=user=alice --grep='timeout|deadline' 'app == "todo"'
+
+  # Display all of the logs between two times.
+  {{.Tool}} logs --since=2022-01-01T00:00:00Z --until=2022-01-02T00:00:00Z
+
   # Display all of the logs in JSON format. This is useful if you want to
   # perform some sort of post-processing on the logs.
   {{.Tool}} logs --format=json
@@ -234,14 +354,23 @@ func (s *LogsSpec) logFn(ctx context.Context, args []string) error {
 	if len(args) > 1 {
 		return fmt.Errorf("too many arguments")
 	}
+	filters, err := s.logFilters.query(time.Now())
+	if err != nil {
+		return err
+	}
 	var query string
-	if len(args) == 0 {
+	switch {
+	case len(args) == 1 && filters != "":
+		query = fmt.Sprintf("(%s) && %s", args[0], filters)
+	case len(args) == 1:
+		query = args[0]
+	case filters != "":
+		query = filters
+	default:
 		// If no query is provided, we want to show all logs. To do that, we
 		// use the following query, which evaluates to true for every log
 		// entry.
 		query = `app.contains("")`
-	} else {
-		query = args[0]
 	}
 	if s.format != "pretty" && s.format != "json" {
 		return fmt.Errorf("invalid format %q; must be %q or %q", s.format, "pretty", "json")
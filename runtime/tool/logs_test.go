@@ -0,0 +1,95 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+func TestLogFilters(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	entry := &protos.LogEntry{
+		App:        "todo",
+		Component:  "github.com/example/todo/store/Store",
+		Level:      "warn",
+		Msg:        "deadline exceeded",
+		Attrs:      []string{"user", "alice"},
+		TimeMicros: now.Add(-10 * time.Minute).UnixMicro(),
+	}
+	for _, test := range []struct {
+		name    string
+		filters logFilters
+		want    bool
+	}{
+		{"None", logFilters{}, true},
+		{"Component", logFilters{components: stringList{"store.Store"}}, true},
+		{"FullComponent", logFilters{components: stringList{"github.com/example/todo/store/Store"}}, true},
+		{"Components", logFilters{components: stringList{"cache.Cache", "store.Store"}}, true},
+		{"OtherComponent", logFilters{components: stringList{"cache.Cache"}}, false},
+		{"Level", logFilters{level: "info"}, true},
+		{"SameLevel", logFilters{level: "warn"}, true},
+		{"HigherLevel", logFilters{level: "error"}, false},
+		{"Attr", logFilters{attrs: stringList{"user=alice"}}, true},
+		{"AttrKey", logFilters{attrs: stringList{"user"}}, true},
+		{"OtherAttr", logFilters{attrs: stringList{"user=bob"}}, false},
+		{"MissingAttr", logFilters{attrs: stringList{"tenant"}}, false},
+		{"Since", logFilters{since: "1h"}, true},
+		{"SinceTooLate", logFilters{since: "5m"}, false},
+		{"Until", logFilters{until: "5m"}, true},
+		{"UntilTooEarly", logFilters{until: "2023-01-01T11:00:00Z"}, false},
+		{"Range", logFilters{since: "2023-01-01T11:00:00Z", until: "2023-01-01T12:00:00Z"}, true},
+		{"Grep", logFilters{grep: "dead(line|lock)"}, true},
+		{"OtherGrep", logFilters{grep: "^timeout"}, false},
+		{"All", logFilters{components: stringList{"store.Store"}, level: "warn", attrs: stringList{"user=alice"}, since: "1h", grep: "deadline"}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := test.filters.query(now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query == "" {
+				query = `app.contains("")`
+			}
+			matches, err := logging.Matcher(query)
+			if err != nil {
+				t.Fatalf("%s: %v", query, err)
+			}
+			got, err := matches(entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Fatalf("%s: got %v, want %v", query, got, test.want)
+			}
+		})
+	}
+}
+
+func TestInvalidLogFilters(t *testing.T) {
+	for _, f := range []logFilters{
+		{level: "fatal"},
+		{attrs: stringList{"=value"}},
+		{since: "yesterday"},
+		{grep: "("},
+	} {
+		if _, err := f.query(time.Now()); err == nil {
+			t.Errorf("%+v: unexpected success", f)
+		}
+	}
+}
@@ -21,11 +21,21 @@ import (
 	"github.com/google/uuid"
 )
 
+// ProtocolVersion is the version of the envelope protocol implemented by this
+// package. It is bumped only on incompatible changes; new fields and messages
+// that peers can safely ignore do not change the version. A WeaveletInfo with
+// a zero protocol version was sent by an envelope that predates versioning and
+// speaks version 1.
+const ProtocolVersion = 1
+
 // CheckWeaveletInfo checks that weavelet information is well-formed.
 func CheckWeaveletInfo(w *protos.WeaveletInfo) error {
 	if w == nil {
 		return fmt.Errorf("WeaveletInfo: nil")
 	}
+	if v := w.ProtocolVersion; v != 0 && v != ProtocolVersion {
+		return fmt.Errorf("WeaveletInfo: unsupported protocol version %d, want %d", v, ProtocolVersion)
+	}
 	if w.App == "" {
 		return fmt.Errorf("WeaveletInfo: missing app name")
 	}
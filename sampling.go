@@ -0,0 +1,81 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"github.com/ServiceWeaver/weaver/runtime"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceSampler decides which spans created by a weavelet are sampled.
+//
+// Spans with a remote parent, i.e., the server side of a component method
+// call, always take the sampling decision of the parent, so that a trace is
+// sampled consistently across processes. Spans of component methods that have
+// a sampling rate of their own, i.e., the client side of a method call, are
+// sampled at that rate. All other spans take the sampling decision of their
+// parent, if any, and are sampled at the application-wide rate otherwise.
+//
+// Rates are applied using the trace id, so all calls to a method within the
+// same trace get the same sampling decision.
+type traceSampler struct {
+	def   sdktrace.Sampler            // samples spans without a rule
+	rules map[string]sdktrace.Sampler // samplers of component method spans, by span name
+}
+
+var _ sdktrace.Sampler = &traceSampler{}
+
+// newTraceSampler returns a sampler for the provided tracing config and
+// components.
+func newTraceSampler(config runtime.TracingConfig, components map[string]*component) *traceSampler {
+	root := sdktrace.AlwaysSample()
+	if config.Sampling != nil {
+		root = sdktrace.TraceIDRatioBased(*config.Sampling)
+	}
+	s := &traceSampler{def: sdktrace.ParentBased(root), rules: map[string]sdktrace.Sampler{}}
+	for _, c := range components {
+		for i := 0; i < c.info.Iface.NumMethod(); i++ {
+			method := c.info.Iface.Method(i).Name
+			fraction, ok := c.settings.MethodTraceSampling[method]
+			if !ok {
+				if c.settings.TraceSampling == nil {
+					continue
+				}
+				fraction = *c.settings.TraceSampling
+			}
+			// The name of the spans created by the generated stubs, e.g.,
+			// "main.Reverser.Reverse".
+			name := c.info.Iface.String() + "." + method
+			s.rules[name] = sdktrace.TraceIDRatioBased(fraction)
+		}
+	}
+	return s
+}
+
+// ShouldSample implements the sdktrace.Sampler interface.
+func (s *traceSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if !trace.SpanContextFromContext(p.ParentContext).IsRemote() {
+		if rule, ok := s.rules[p.Name]; ok {
+			return rule.ShouldSample(p)
+		}
+	}
+	return s.def.ShouldSample(p)
+}
+
+// Description implements the sdktrace.Sampler interface.
+func (s *traceSampler) Description() string {
+	return "ServiceWeaverSampler"
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type samplingCache interface {
+	Get(context.Context, string) (string, error)
+	Put(context.Context, string, string) error
+}
+
+// parentContext returns a context with a parent span context.
+func parentContext(sampled, remote bool) context.Context {
+	var flags trace.TraceFlags
+	if sampled {
+		flags = trace.FlagsSampled
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: flags,
+		Remote:     remote,
+	})
+	return trace.ContextWithSpanContext(context.Background(), sc)
+}
+
+func TestTraceSampler(t *testing.T) {
+	never, always := 0.0, 1.0
+	cache := &component{
+		info: &codegen.Registration{
+			Name:  "github.com/ServiceWeaver/weaver/samplingCache",
+			Iface: reflect.TypeOf((*samplingCache)(nil)).Elem(),
+		},
+		settings: &runtime.ComponentSettings{
+			TraceSampling:       &never,
+			MethodTraceSampling: map[string]float64{"Put": 1},
+		},
+	}
+	s := newTraceSampler(runtime.TracingConfig{Sampling: &always}, map[string]*component{"cache": cache})
+
+	for _, test := range []struct {
+		name   string
+		ctx    context.Context
+		span   string
+		expect bool
+	}{
+		{"root", context.Background(), "handler", true},
+		{"sampled parent", parentContext(true, false), "handler", true},
+		{"unsampled parent", parentContext(false, false), "handler", false},
+		{"component rate", parentContext(true, false), "weaver.samplingCache.Get", false},
+		{"method rate", parentContext(false, false), "weaver.samplingCache.Put", true},
+		{"remote sampled parent", parentContext(true, true), "weaver.samplingCache.Get", true},
+		{"remote unsampled parent", parentContext(false, true), "weaver.samplingCache.Put", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			result := s.ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: test.ctx,
+				TraceID:       trace.TraceID{1},
+				Name:          test.span,
+			})
+			if got := result.Decision == sdktrace.RecordAndSample; got != test.expect {
+				t.Fatalf("sampled: got %t, want %t", got, test.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A SecretProvider resolves references to secrets in component configs.
+//
+// A reference is a string config value of the form "<scheme>://<path>", where
+// scheme is the name the provider is registered under. For example, with the
+// following config, the Password field of the config of the Cache component
+// is set to the value of the REDIS_PASSWORD environment variable.
+//
+//	["example.com/mypkg/Cache"]
+//	Password = "env://REDIS_PASSWORD"
+//
+// The following providers are registered by default:
+//
+//   - env://NAME: the value of the environment variable NAME.
+//   - secret://projects/P/secrets/S: the latest version of secret S of Google
+//     Cloud project P in Google Cloud Secret Manager. A specific version can be
+//     given with a /versions/V suffix. Requests are authenticated with the
+//     default service account of the machine.
+//   - vault://PATH#KEY: the value of KEY in the secret at PATH in HashiCorp
+//     Vault, e.g., vault://secret/data/redis#password. The Vault server and
+//     token are given by the VAULT_ADDR and VAULT_TOKEN environment variables.
+type SecretProvider interface {
+	// Resolve returns the value of the secret at the provided path, i.e.,
+	// the part of the reference after "<scheme>://".
+	Resolve(ctx context.Context, path string) (string, error)
+}
+
+// RegisterSecretProvider registers a provider that resolves references to
+// secrets of the form "<scheme>://<path>" in component configs. References
+// are resolved by every process when it creates a component, before the
+// component's Init method is called. Providers should be registered in init
+// functions, so that they are available when the components are created.
+//
+// RegisterSecretProvider panics if a provider is already registered for the
+// scheme.
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if _, ok := secretProviders[scheme]; ok {
+		panic(fmt.Sprintf("secret provider for scheme %q already registered", scheme))
+	}
+	secretProviders[scheme] = provider
+}
+
+var (
+	secretsMu       sync.Mutex
+	secretProviders = map[string]SecretProvider{
+		"env":    envSecrets{},
+		"secret": &gcpSecrets{endpoint: secretManagerEndpoint, client: &http.Client{Timeout: 30 * time.Second}},
+		"vault":  &vaultSecrets{client: &http.Client{Timeout: 30 * time.Second}},
+	}
+	resolvedSecrets = map[string]string{} // resolved references, by reference
+)
+
+// secretProvider returns the provider for the provided reference, along with
+// the path of the referenced secret. It returns false if s is not a reference
+// to a secret.
+func secretProvider(s string) (SecretProvider, string, bool) {
+	scheme, path, ok := strings.Cut(s, "://")
+	if !ok {
+		return nil, "", false
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	provider, ok := secretProviders[scheme]
+	return provider, path, ok
+}
+
+// resolveSecret returns the value of the referenced secret. Resolved secrets
+// are cached for the lifetime of the process.
+func resolveSecret(ctx context.Context, provider SecretProvider, ref, path string) (string, error) {
+	secretsMu.Lock()
+	value, ok := resolvedSecrets[ref]
+	secretsMu.Unlock()
+	if ok {
+		return value, nil
+	}
+	value, err := provider.Resolve(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	secretsMu.Lock()
+	resolvedSecrets[ref] = value
+	secretsMu.Unlock()
+	return value, nil
+}
+
+// resolveSecrets replaces the references to secrets in the provided config,
+// which must be a pointer, with the values of the secrets. References are
+// resolved in string fields, including the string fields of nested structs,
+// and in the string elements of slices, arrays, and maps.
+func resolveSecrets(ctx context.Context, config any) error {
+	return resolveValue(ctx, reflect.ValueOf(config), "")
+}
+
+// resolveValue resolves the references to secrets in v, which is found at the
+// provided path of the config.
+func resolveValue(ctx context.Context, v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return resolveValue(ctx, v.Elem(), path)
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if err := resolveValue(ctx, v.Field(i), fieldPath(path, t.Field(i).Name)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveValue(ctx, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := iter.Value()
+			if elem.Kind() != reflect.String {
+				if err := resolveValue(ctx, elem, fmt.Sprintf("%s[%v]", path, iter.Key())); err != nil {
+					return err
+				}
+				continue
+			}
+			// Map elements are not addressable, so they are replaced.
+			value, ok, err := resolveString(ctx, elem.String())
+			if err != nil {
+				return fmt.Errorf("%s[%v]: %w", path, iter.Key(), err)
+			}
+			if ok {
+				v.SetMapIndex(iter.Key(), reflect.ValueOf(value).Convert(elem.Type()))
+			}
+		}
+
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+		value, ok, err := resolveString(ctx, v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if ok {
+			v.SetString(value)
+		}
+	}
+	return nil
+}
+
+// resolveString returns the value of the secret referenced by s. It returns
+// false if s is not a reference to a secret.
+func resolveString(ctx context.Context, s string) (string, bool, error) {
+	provider, path, ok := secretProvider(s)
+	if !ok {
+		return "", false, nil
+	}
+	value, err := resolveSecret(ctx, provider, s, path)
+	if err != nil {
+		// Note that the error doesn't contain the value of the secret.
+		return "", false, fmt.Errorf("resolve secret %q: %w", s, err)
+	}
+	return value, true, nil
+}
+
+// fieldPath returns the path of the named field of the config at the provided
+// path.
+func fieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// envSecrets resolves env://NAME references to environment variables.
+type envSecrets struct{}
+
+// Resolve implements the SecretProvider interface.
+func (envSecrets) Resolve(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %q not set", name)
+	}
+	return value, nil
+}
+
+// secretManagerEndpoint is the endpoint of Google Cloud Secret Manager.
+const secretManagerEndpoint = "https://secretmanager.googleapis.com"
+
+// gcpSecrets resolves secret://projects/P/secrets/S references to secrets in
+// Google Cloud Secret Manager.
+type gcpSecrets struct {
+	endpoint string
+	client   *http.Client
+	tokens   metadataTokens
+}
+
+// Resolve implements the SecretProvider interface.
+func (g *gcpSecrets) Resolve(ctx context.Context, path string) (string, error) {
+	if !strings.HasPrefix(path, "projects/") || !strings.Contains(path, "/secrets/") {
+		return "", fmt.Errorf("invalid secret %q; want projects/<project>/secrets/<secret>", path)
+	}
+	if !strings.Contains(path, "/versions/") {
+		path += "/versions/latest"
+	}
+	token, err := g.tokens.get(ctx, g.client)
+	if err != nil {
+		return "", fmt.Errorf("get access token: %w", err)
+	}
+	var reply struct {
+		Payload struct {
+			Data []byte `json:"data"` // base64-decoded by encoding/json
+		} `json:"payload"`
+	}
+	headers := map[string]string{"Authorization": "Bearer " + token}
+	if err := getJSON(ctx, g.client, g.endpoint+"/v1/"+path+":access", headers, &reply); err != nil {
+		return "", err
+	}
+	return string(reply.Payload.Data), nil
+}
+
+// vaultSecrets resolves vault://PATH#KEY references to secrets in HashiCorp
+// Vault, using the server and token in the VAULT_ADDR and VAULT_TOKEN
+// environment variables.
+type vaultSecrets struct {
+	client *http.Client
+}
+
+// Resolve implements the SecretProvider interface.
+func (v *vaultSecrets) Resolve(ctx context.Context, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || key == "" {
+		return "", fmt.Errorf("invalid secret %q; want <path>#<key>", ref)
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR not set")
+	}
+	headers := map[string]string{"X-Vault-Token": os.Getenv("VAULT_TOKEN")}
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		headers["X-Vault-Namespace"] = ns
+	}
+
+	// Version 1 of the KV secrets engine returns the secret in data, and
+	// version 2 returns it in data.data.
+	var reply struct {
+		Data map[string]any `json:"data"`
+	}
+	url := strings.TrimSuffix(addr, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	if err := getJSON(ctx, v.client, url, headers, &reply); err != nil {
+		return "", err
+	}
+	data := reply.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found in %q", key, path)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("key %q of %q is not a string", key, path)
+	}
+	return s, nil
+}
+
+// getJSON gets the provided URL and decodes the JSON reply into dst.
+func getJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
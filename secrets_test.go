@@ -0,0 +1,164 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeSecrets is a SecretProvider that resolves "fake://<name>" references
+// to the uppercased name.
+type fakeSecrets struct{}
+
+func (fakeSecrets) Resolve(_ context.Context, name string) (string, error) {
+	if name == "missing" {
+		return "", fmt.Errorf("secret %q not found", name)
+	}
+	return strings.ToUpper(name), nil
+}
+
+func init() {
+	RegisterSecretProvider("fake", fakeSecrets{})
+}
+
+func TestResolveSecrets(t *testing.T) {
+	type nested struct {
+		Password string
+	}
+	type config struct {
+		Host     string
+		URL      string
+		Port     int
+		Nested   nested
+		Pointer  *nested
+		Replicas []string
+		Users    map[string]string
+		private  string
+	}
+	got := config{
+		Host:     "fake://host",
+		URL:      "http://example.com",
+		Port:     6379,
+		Nested:   nested{"fake://password"},
+		Pointer:  &nested{"fake://pointer"},
+		Replicas: []string{"fake://a", "b"},
+		Users:    map[string]string{"alice": "fake://alice", "bob": "bob"},
+		private:  "fake://private",
+	}
+	if err := resolveSecrets(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := config{
+		Host:     "HOST",
+		URL:      "http://example.com",
+		Port:     6379,
+		Nested:   nested{"PASSWORD"},
+		Pointer:  &nested{"POINTER"},
+		Replicas: []string{"A", "b"},
+		Users:    map[string]string{"alice": "ALICE", "bob": "bob"},
+		private:  "fake://private",
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(config{})); diff != "" {
+		t.Fatalf("resolveSecrets (-want +got):\n%s", diff)
+	}
+}
+
+func TestResolveSecretsErrors(t *testing.T) {
+	type config struct {
+		Nested struct{ Password string }
+	}
+	var c config
+	c.Nested.Password = "fake://missing"
+	err := resolveSecrets(context.Background(), &c)
+	if err == nil || !strings.Contains(err.Error(), `Nested.Password: resolve secret "fake://missing"`) {
+		t.Fatalf("resolveSecrets: got %v, want error for Nested.Password", err)
+	}
+}
+
+func TestEnvSecrets(t *testing.T) {
+	t.Setenv("WEAVER_TEST_SECRET", "hunter2")
+	got, err := envSecrets{}.Resolve(context.Background(), "WEAVER_TEST_SECRET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "hunter2" {
+		t.Fatalf("Resolve: got %q, want %q", got, "hunter2")
+	}
+	if _, err := (envSecrets{}).Resolve(context.Background(), "WEAVER_TEST_UNSET"); err == nil {
+		t.Fatal("Resolve: unexpected success for unset variable")
+	}
+}
+
+func TestGCPSecrets(t *testing.T) {
+	// Run a fake Secret Manager.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/p/secrets/redis-host/versions/latest:access" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		// "cmVkaXMuaW50ZXJuYWw=" is "redis.internal" in base64.
+		fmt.Fprint(w, `{"name": "projects/p/secrets/redis-host/versions/1", "payload": {"data": "cmVkaXMuaW50ZXJuYWw="}}`)
+	}))
+	defer server.Close()
+
+	g := &gcpSecrets{endpoint: server.URL, client: server.Client()}
+	g.tokens.token, g.tokens.expiry = "token", time.Now().Add(time.Hour)
+	got, err := g.Resolve(context.Background(), "projects/p/secrets/redis-host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "redis.internal" {
+		t.Fatalf("Resolve: got %q, want %q", got, "redis.internal")
+	}
+	if _, err := g.Resolve(context.Background(), "redis-host"); err == nil {
+		t.Fatal("Resolve: unexpected success for invalid secret name")
+	}
+}
+
+func TestVaultSecrets(t *testing.T) {
+	// Run a fake Vault server, with a KV version 2 secret engine.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/redis" || r.Header.Get("X-Vault-Token") != "token" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"data": {"data": {"password": "hunter2"}, "metadata": {"version": 1}}}`)
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+
+	v := &vaultSecrets{client: server.Client()}
+	got, err := v.Resolve(context.Background(), "secret/data/redis#password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "hunter2" {
+		t.Fatalf("Resolve: got %q, want %q", got, "hunter2")
+	}
+	for _, ref := range []string{"secret/data/redis", "secret/data/redis#user", "secret/data/mysql#password"} {
+		if _, err := v.Resolve(context.Background(), ref); err == nil {
+			t.Errorf("Resolve(%q): unexpected success", ref)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+)
+
+// defaultShutdownTimeout is the default time given to components to shut
+// down. See runtime.WeaveletConfig.ShutdownTimeout.
+const defaultShutdownTimeout = runtime.DefaultShutdownTimeout
+
+// errShuttingDown is returned by the calls that a weavelet receives once it
+// started shutting down. It wraps ErrRetriable, so that the calls can be
+// retried on another replica.
+var errShuttingDown = fmt.Errorf("%w: weavelet is shutting down", ErrRetriable)
+
+// handleShutdown arranges for the weavelet to be shut down when its context
+// is canceled. Service Weaver doesn't handle the signals of an application:
+// an application that wants to be shut down gracefully on SIGINT or SIGTERM
+// passes Init or Run a context that they cancel, e.g., one returned by
+// signal.NotifyContext.
+//
+// The exception is a weavelet started by an envelope, which the envelope
+// stops by sending it SIGTERM (see envelope.Envelope.Stop). On SIGTERM, such
+// a weavelet cancels its context, which shuts it down, and then exits if it
+// was started by Init. If it was started by Run, Run returns instead.
+func (d *weavelet) handleShutdown() {
+	if d.stopOnSIGTERM {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM)
+		go func() {
+			select {
+			case <-signals:
+				d.stop()
+				d.shutdown()
+				if d.exitOnStop {
+					os.Exit(0)
+				}
+			case <-d.shutdownDone:
+			}
+			signal.Stop(signals)
+		}()
+	}
+	go func() {
+		<-d.ctx.Done()
+		d.shutdown()
+	}()
+}
+
+// onShutdown registers a function to run when the weavelet is shut down,
+// after its components are shut down.
+func (d *weavelet) onShutdown(f func()) {
+	d.shutdownMu.Lock()
+	defer d.shutdownMu.Unlock()
+	d.shutdownHooks = append(d.shutdownHooks, f)
+}
+
+// shutdown shuts the weavelet down, in order:
+//
+//  1. It drains the listeners.
+//  2. It stops executing new calls, failing them with errShuttingDown, and
+//     waits for the calls being executed to finish.
+//  3. It stops serving calls, closing its connections.
+//  4. It calls the Shutdown method of every local component that has one,
+//     after storing a snapshot of the stateful ones, in the reverse order of
+//     initialization.
+//  5. It calls the functions registered with onShutdown.
+//
+// Steps 2 and 4 share a single deadline, which is set by the shutdown_timeout
+// config option. If shutdown is called again, it waits for the first call to
+// finish.
+func (d *weavelet) shutdown() {
+	d.shutdownOnce.Do(func() {
+		defer close(d.shutdownDone)
+		d.shutdownMu.Lock()
+		listeners := d.listeners
+		d.shutdownMu.Unlock()
+
+		d.drainListeners(listeners)
+
+		timeout := d.config.ShutdownTimeout
+		if timeout == 0 {
+			timeout = defaultShutdownTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := d.calls.drain(ctx); err != nil {
+			d.env.SystemLogger().Error("Calls still executing at shutdown", err)
+		}
+		d.stopServing()
+
+		// Components may be initialized by the calls drained above, so they
+		// are only read now.
+		d.shutdownMu.Lock()
+		components, hooks := d.initialized, d.shutdownHooks
+		d.shutdownMu.Unlock()
+		for i := len(components) - 1; i >= 0; i-- {
+			c := components[i]
+			if s, ok := c.impl.impl.(stateful); ok {
+				if file := d.snapshotFile(c, 0); file != "" {
+					if err := saveSnapshot(ctx, s, file); err != nil {
+						c.logger.Error("Snapshot failed", err, "file", file)
+					}
+				}
+			}
+			s, ok := c.impl.impl.(interface{ Shutdown(context.Context) error })
+			if !ok {
+				continue
+			}
+			if err := s.Shutdown(ctx); err != nil {
+				c.logger.Error("Shutdown failed", err)
+			}
+		}
+		for _, hook := range hooks {
+			hook()
+		}
+		d.stop()
+	})
+	<-d.shutdownDone
+}
+
+// drainListeners signals every listener to start draining, and waits for
+// their open connections to be closed, for at most the drain_timeout of each
+// listener's config.
+func (d *weavelet) drainListeners(listeners map[string][]*Listener) {
+	var wg sync.WaitGroup
+	for name, ls := range listeners {
+		timeout := d.config.Listeners[name].DrainTimeout
+		for _, l := range ls {
+			wg.Add(1)
+			l := l
+			go func() {
+				defer wg.Done()
+				l.conns.drain(timeout)
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+// inflight tracks the calls being executed by the handlers of a weavelet, so
+// that the weavelet can wait for them to finish when it shuts down.
+type inflight struct {
+	mu       sync.Mutex
+	n        int           // number of calls being executed
+	draining bool          // if true, new calls are rejected
+	drained  chan struct{} // closed when draining and n is zero
+}
+
+// start records the start of a call, returning false if the call must be
+// rejected because the weavelet is shutting down. If start returns true, end
+// must be called when the call finishes.
+func (f *inflight) start() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.draining {
+		return false
+	}
+	f.n++
+	return true
+}
+
+// end records the end of a call started with start.
+func (f *inflight) end() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n--
+	if f.n == 0 && f.draining {
+		close(f.drained)
+	}
+}
+
+// drain rejects new calls, and waits for the calls being executed to finish,
+// or for ctx to be done.
+func (f *inflight) drain(ctx context.Context) error {
+	f.mu.Lock()
+	f.draining = true
+	f.drained = make(chan struct{})
+	if f.n == 0 {
+		close(f.drained)
+	}
+	f.mu.Unlock()
+	select {
+	case <-f.drained:
+		return nil
+	case <-ctx.Done():
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return fmt.Errorf("%d calls: %w", f.n, ctx.Err())
+	}
+}
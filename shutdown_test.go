@@ -0,0 +1,62 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInflightDrain(t *testing.T) {
+	var calls inflight
+	if !calls.start() {
+		t.Fatal("start: call rejected before draining")
+	}
+
+	drained := make(chan error)
+	go func() {
+		drained <- calls.drain(context.Background())
+	}()
+
+	// Wait for the drain to start rejecting calls.
+	for calls.start() {
+		calls.end()
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned %v before the call ended", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	calls.end()
+	if err := <-drained; err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+}
+
+func TestInflightDrainTimeout(t *testing.T) {
+	var calls inflight
+	if !calls.start() {
+		t.Fatal("start: call rejected before draining")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := calls.drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("drain: got %v, want context.DeadlineExceeded", err)
+	}
+}
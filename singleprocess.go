@@ -28,6 +28,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ServiceWeaver/weaver/internal/election"
 	"github.com/ServiceWeaver/weaver/internal/envelope/conn"
 	"github.com/ServiceWeaver/weaver/internal/logtype"
 	imetrics "github.com/ServiceWeaver/weaver/internal/metrics"
@@ -52,10 +53,12 @@ type singleprocessEnv struct {
 	ctx      context.Context
 	weavelet *protos.WeaveletInfo
 	config   *protos.AppConfig
+	files    []string // config files, if read from SERVICEWEAVER_CONFIG
 
 	submissionTime time.Time
 	statsProcessor *imetrics.StatsProcessor // tracks and computes stats to be rendered on the /statusz page.
 	traceSaver     func(spans *protos.Spans) error
+	elections      *election.Leases // leases of the leader elections
 
 	mu         sync.Mutex
 	listeners  map[string][]string // listener addresses, keyed by name
@@ -68,27 +71,23 @@ func newSingleprocessEnv(bootstrap runtime.Bootstrap) (*singleprocessEnv, error)
 	ctx := context.Background()
 
 	// Get the config to use.
-	configFile := "[testconfig]"
-	config := bootstrap.TestConfig
-	if config == "" {
-		// Try to read from the file named by SERVICEWEAVER_CONFIG
-		configFile = os.Getenv("SERVICEWEAVER_CONFIG")
-		if configFile != "" {
-			contents, err := os.ReadFile(configFile)
-			if err != nil {
-				return nil, fmt.Errorf("config file: %w", err)
-			}
-			config = string(contents)
-		}
-	}
-
 	appConfig := &protos.AppConfig{}
-	if config != "" {
+	var configFiles []string
+	if bootstrap.TestConfig != "" {
 		var err error
-		appConfig, err = runtime.ParseConfig(configFile, config, codegen.ComponentConfigValidator)
+		appConfig, err = runtime.ParseConfig("[testconfig]", bootstrap.TestConfig, codegen.ComponentConfigValidator)
 		if err != nil {
 			return nil, err
 		}
+	} else if files := os.Getenv("SERVICEWEAVER_CONFIG"); files != "" {
+		// Read the config files listed in SERVICEWEAVER_CONFIG, separated
+		// like the directories in PATH.
+		var err error
+		configFiles = filepath.SplitList(files)
+		appConfig, err = runtime.LoadConfig(configFiles, codegen.ComponentConfigValidator)
+		if err != nil {
+			return nil, fmt.Errorf("config file: %w", err)
+		}
 	}
 
 	// Overwrite app config with the true command line used.
@@ -130,10 +129,12 @@ func newSingleprocessEnv(bootstrap runtime.Bootstrap) (*singleprocessEnv, error)
 		ctx:            ctx,
 		weavelet:       wlet,
 		config:         appConfig,
+		files:          configFiles,
 		submissionTime: time.Now(),
 		listeners:      map[string][]string{},
 		statsProcessor: imetrics.NewStatsProcessor(),
 		traceSaver:     traceSaver,
+		elections:      election.NewLeases(),
 	}
 	go env.statsProcessor.CollectMetrics(ctx, metrics.Snapshot)
 	return env, nil
@@ -184,8 +185,13 @@ func (e *singleprocessEnv) ExportListener(_ context.Context, lis *protos.Listene
 	return &protos.ExportListenerReply{}, nil
 }
 
-// serveStatus runs and registers the weaver-single status server.
-func (e *singleprocessEnv) serveStatus(ctx context.Context) error {
+func (e *singleprocessEnv) ElectLeader(_ context.Context, req *protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error) {
+	return e.elections.Elect(req, time.Now()), nil
+}
+
+// serveStatus runs and registers the weaver-single status server. The
+// server is unregistered with a function passed to onShutdown.
+func (e *singleprocessEnv) serveStatus(ctx context.Context, onShutdown func(func())) error {
 	mux := http.NewServeMux()
 	mux.Handle("/debug/pprof/", http.DefaultServeMux)
 	status.RegisterServer(mux, e, e.SystemLogger())
@@ -228,16 +234,12 @@ func (e *singleprocessEnv) serveStatus(ctx context.Context) error {
 		return err
 	}
 
-	// Unregister the deployment if this application is killed.
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-done
-		if err := registry.Unregister(ctx, reg.DeploymentId); err != nil {
+	// Unregister the deployment when the application is shut down.
+	onShutdown(func() {
+		if err := registry.Unregister(context.Background(), reg.DeploymentId); err != nil {
 			fmt.Fprintf(os.Stderr, "unregister deployment: %v\n", err)
 		}
-		os.Exit(1)
-	}()
+	})
 
 	return <-errs
 }
@@ -355,6 +357,34 @@ func (e *singleprocessEnv) SystemLogger() logtype.Logger {
 	return discardingLogger{}
 }
 
+// OnConfigUpdate implements the env interface. If the config was read from
+// the files listed in SERVICEWEAVER_CONFIG, the files are read again and
+// passed to f every time the process receives a SIGHUP.
+func (e *singleprocessEnv) OnConfigUpdate(f func(sections map[string]string) error) {
+	if len(e.files) == 0 {
+		return
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		sections := e.config.Sections
+		for range hup {
+			config, err := runtime.LoadConfig(e.files, codegen.ComponentConfigValidator)
+			if err == nil {
+				err = runtime.CheckConfigUpdate(sections, config.Sections)
+			}
+			if err == nil {
+				err = f(config.Sections)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "reload config: %v\n", err)
+				continue
+			}
+			sections = config.Sections
+		}
+	}()
+}
+
 // serveHTTP serves HTTP traffic on the provided listener using the provided
 // handler. The server is shut down when then provided context is cancelled.
 func serveHTTP(ctx context.Context, lis net.Listener, handler http.Handler) error {
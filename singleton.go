@@ -0,0 +1,171 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/ServiceWeaver/weaver/runtime/retry"
+)
+
+// singletonPollInterval is the interval between two lookups, by the callers
+// of a singleton component, of the component's active replica.
+const singletonPollInterval = time.Second
+
+// singleton holds the state of a singleton component, i.e., a component with
+// a single active replica deployment-wide. The replicas that host the
+// component elect the active replica, identified by its address, in a leader
+// election. The callers of the component look up the active replica and send
+// it all their calls.
+type singleton struct {
+	election string // name of the leader election
+
+	campaign sync.Once   // used to start campaigning, if the component is local
+	active   atomic.Bool // is this replica the active replica?
+
+	watch  sync.Once    // used to start watching the active replica
+	leader atomic.Value // address of the active replica, or ""
+}
+
+// newSingleton returns the state of the provided component, or nil if it
+// isn't a singleton.
+func newSingleton(c *component) *singleton {
+	if !c.settings.Singleton {
+		return nil
+	}
+	s := &singleton{election: "serviceweaver/singleton/" + c.info.Name}
+	s.leader.Store("")
+	return s
+}
+
+// startSingleton makes this replica a candidate to be the active replica of
+// the provided singleton component, which it initializes once elected. The
+// replica exits if it stops being the active replica, since the component
+// cannot be stopped, so that it can't keep executing calls alongside the new
+// active replica.
+func (d *weavelet) startSingleton(c *component) {
+	c.singleton.campaign.Do(func() {
+		startWork(d.ctx, "singleton "+c.info.Name, func() error {
+			election := newLeaderElection(d, c.singleton.election, defaultLease, defaultLease/3)
+			election.candidate = string(d.externalDialAddr)
+			leading, _, err := election.Lead(d.ctx)
+			if err != nil {
+				return err
+			}
+			d.env.SystemLogger().Info("Elected active replica of singleton", "component", c.info.Name)
+			c.singleton.active.Store(true)
+			if _, err := d.getImpl(c); err != nil {
+				return err
+			}
+			<-leading.Done()
+			if err := d.ctx.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("component %q: no longer the active replica", c.info.Name)
+		})
+	})
+}
+
+// watchSingleton starts looking up the active replica of the provided
+// singleton component periodically.
+func (d *weavelet) watchSingleton(c *component) {
+	c.singleton.watch.Do(func() {
+		// Look up the election without taking part in it.
+		req := &protos.LeaderElectionRequest{
+			App:          d.info.App,
+			DeploymentId: d.info.DeploymentId,
+			Election:     c.singleton.election,
+			Candidate:    "watcher/" + d.info.Id,
+		}
+		startWork(d.ctx, "watch singleton "+c.info.Name, func() error {
+			ticker := time.NewTicker(singletonPollInterval)
+			defer ticker.Stop()
+			for {
+				reply, err := d.env.ElectLeader(d.ctx, req)
+				switch {
+				case err != nil:
+					d.env.SystemLogger().Error("looking up active replica; will retry", err, "component", c.info.Name)
+				case reply.Leader == "":
+					c.singleton.leader.Store("")
+				default:
+					e, err := parseEndpoint(reply.Leader)
+					if err != nil {
+						d.env.SystemLogger().Error("looking up active replica", err, "component", c.info.Name)
+						break
+					}
+					c.singleton.leader.Store(e.Address())
+				}
+				select {
+				case <-d.ctx.Done():
+					return d.ctx.Err()
+				case <-ticker.C:
+				}
+			}
+		})
+	})
+}
+
+// checkActive returns an error that wraps call.Unreachable if this replica
+// isn't the active replica of the provided singleton component.
+func (s *singleton) checkActive(component string) error {
+	if !s.active.Load() {
+		return fmt.Errorf("%w: replica of singleton component %q is not active", call.Unreachable, component)
+	}
+	return nil
+}
+
+// waitUntilActive blocks until the active replica of a singleton component,
+// picked by the provided balancer, is elected and reachable.
+func waitUntilActive(ctx context.Context, client call.Connection, balancer call.Balancer) error {
+	for r := retry.Begin(); r.Continue(ctx); {
+		_, err := client.Call(ctx, readyMethodKey, nil, call.CallOptions{Balancer: balancer})
+		if err == nil || !errors.Is(err, call.Unreachable) {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// activeBalancer is a balancer that picks the active replica of a singleton
+// component.
+type activeBalancer struct {
+	singleton *singleton
+	endpoints []call.Endpoint
+}
+
+var _ call.Balancer = &activeBalancer{}
+
+// Update implements the call.Balancer interface.
+func (b *activeBalancer) Update(endpoints []call.Endpoint) {
+	b.endpoints = endpoints
+}
+
+// Pick implements the call.Balancer interface.
+func (b *activeBalancer) Pick(call.CallOptions) (call.Endpoint, error) {
+	leader := b.singleton.leader.Load().(string)
+	for _, e := range b.endpoints {
+		if e.Address() == leader {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no active replica", call.Unreachable)
+}
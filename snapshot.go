@@ -0,0 +1,115 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateful is implemented by the implementations of stateful components,
+// whose in-memory state is checkpointed by the runtime and restored when the
+// component, or an actor of the component, is created again, e.g., on a
+// replica restart, a rollout, or the movement of a routing key to another
+// replica. See runtime.SnapshotsConfig.
+type stateful interface {
+	// Snapshot returns a serialized snapshot of the state of the component.
+	// It may be called concurrently with the component's methods, except
+	// for actors.
+	Snapshot(context.Context) ([]byte, error)
+
+	// Restore restores a snapshot returned by Snapshot, possibly by a
+	// previous version of the component. It is called before Init.
+	Restore(context.Context, []byte) error
+}
+
+// snapshotFile returns the file that stores the snapshots of the provided
+// component or, if the component has actors, of its actor with the provided
+// routing key. It returns "" if snapshots are disabled.
+func (d *weavelet) snapshotFile(c *component, key uint64) string {
+	if d.config.Snapshots.Dir == "" {
+		return ""
+	}
+	// Snapshots are named by application, rather than deployment, so that
+	// the next version of the application restores them.
+	path := filepath.Join(d.config.Snapshots.Dir, d.info.App, filepath.FromSlash(c.info.Name))
+	if c.settings.Actors.Enabled {
+		return filepath.Join(path, fmt.Sprintf("%016x.snapshot", key))
+	}
+	return path + ".snapshot"
+}
+
+// restoreSnapshot restores the snapshot stored in file, if any.
+func restoreSnapshot(ctx context.Context, s stateful, file string) error {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.Restore(ctx, data)
+}
+
+// saveSnapshot stores a snapshot of s in file. The file is replaced
+// atomically, so that a crash never leaves a partial snapshot behind.
+func saveSnapshot(ctx context.Context, s stateful, file string) error {
+	data, err := s.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// snapshotPeriodically stores a snapshot of the provided component every
+// snapshot_interval, until the weavelet's context is done.
+func (d *weavelet) snapshotPeriodically(c *component, s stateful, file string) {
+	ticker := time.NewTicker(c.settings.SnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := saveSnapshot(d.ctx, s, file); err != nil {
+				c.logger.Error("Snapshot failed", err, "file", file)
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// statefulCounter is a counter whose count is snapshotted.
+type statefulCounter struct {
+	counter
+}
+
+func (c *statefulCounter) Snapshot(context.Context) ([]byte, error) {
+	return []byte(strconv.Itoa(c.n)), nil
+}
+
+func (c *statefulCounter) Restore(_ context.Context, snapshot []byte) error {
+	n, err := strconv.Atoi(string(snapshot))
+	c.n = n
+	return err
+}
+
+// newStatefulActorPool returns an actor pool of stateful counters that
+// stores snapshots in dir.
+func newStatefulActorPool(t *testing.T, dir string) *actorPool {
+	t.Helper()
+	p, _, _ := newTestActorPool(t)
+	p.c.wlet.config.Snapshots.Dir = dir
+	p.c.wlet.info = &protos.WeaveletInfo{App: "app"}
+	var shutdown atomic.Int32
+	p.c.info.New = func() any {
+		return &statefulCounter{counter{shutdown: &shutdown}}
+	}
+	p.c.info.ServerStubFn = func(impl any, _ func(uint64, float64)) codegen.Server {
+		return counterServer{&impl.(*statefulCounter).counter}
+	}
+	return p
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a", "b.snapshot")
+	c := &statefulCounter{}
+	c.n = 42
+	if err := saveSnapshot(context.Background(), c, file); err != nil {
+		t.Fatal(err)
+	}
+	restored := &statefulCounter{}
+	if err := restoreSnapshot(context.Background(), restored, file); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := restored.n, 42; got != want {
+		t.Fatalf("restored count: got %d, want %d", got, want)
+	}
+
+	// Restoring a missing snapshot is a no-op.
+	missing := &statefulCounter{}
+	if err := restoreSnapshot(context.Background(), missing, file+".missing"); err != nil {
+		t.Fatal(err)
+	}
+	if missing.n != 0 {
+		t.Fatalf("restored count: got %d, want 0", missing.n)
+	}
+}
+
+func TestActorSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	p := newStatefulActorPool(t, dir)
+	add(t, p, 1)
+	add(t, p, 1)
+	add(t, p, 2)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The actors of a new pool, e.g., in another replica, restore their
+	// state.
+	p = newStatefulActorPool(t, dir)
+	if got, want := add(t, p, 1), "3"; got != want {
+		t.Fatalf("Add(1): got %s, want %s", got, want)
+	}
+	if got, want := add(t, p, 2), "2"; got != want {
+		t.Fatalf("Add(2): got %s, want %s", got, want)
+	}
+	if got, want := add(t, p, 3), "1"; got != want {
+		t.Fatalf("Add(3): got %s, want %s", got, want)
+	}
+}
+
+func TestActorSnapshotsSkipUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	p := newStatefulActorPool(t, dir)
+	add(t, p, 1)
+	p.mu.Lock()
+	a := p.actors[1]
+	p.mu.Unlock()
+	file := p.c.wlet.snapshotFile(p.c, 1)
+	p.save(context.Background(), 1, a)
+	if _, err := os.Stat(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// An actor with no calls since its last snapshot is not saved again.
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	p.save(context.Background(), 1, a)
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("snapshot of unchanged actor: got %v, want not exist", err)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+)
+
+// defaultStatsDInterval is the interval between two exports of metrics to a
+// StatsD server if the config doesn't specify one.
+const defaultStatsDInterval = 10 * time.Second
+
+// maxStatsDPacketSize is the maximum size of a StatsD UDP packet. It is small
+// enough to avoid IP fragmentation on most networks, as recommended by the
+// DogStatsD documentation.
+const maxStatsDPacketSize = 1432
+
+// exportStatsDMetrics periodically exports the metrics of the weavelet to a
+// StatsD server, as configured by the [serviceweaver.statsd] section of the app
+// config. It returns when the weavelet's context is cancelled.
+func (d *weavelet) exportStatsDMetrics() error {
+	config := d.config.StatsD
+	interval := config.Interval
+	if interval == 0 {
+		interval = defaultStatsDInterval
+	}
+	conn, err := net.Dial("udp", config.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	encoder := newStatsDEncoder(config)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		for _, packet := range encoder.encode(d.prometheusSnapshots()) {
+			// StatsD is fire and forget: writes only fail if nobody listens
+			// on the address, and the server may come back.
+			conn.Write(packet) //nolint:errcheck // see above
+		}
+	}
+}
+
+// statsDEncoder encodes metric snapshots in the StatsD [1] or DogStatsD [2]
+// line protocol.
+//
+// StatsD counters are deltas, so counters are encoded as their increase since
+// the previous export. Gauges are encoded as gauges. StatsD has no bucketed
+// histograms, so a histogram is encoded as two counters, <name>.count and
+// <name>.sum.
+//
+// [1]: https://github.com/statsd/statsd/blob/master/docs/metric_types.md
+// [2]: https://docs.datadoghq.com/developers/dogstatsd/datagram_shell
+type statsDEncoder struct {
+	config runtime.StatsDConfig
+	last   map[string]float64 // last exported value of every counter, by key
+}
+
+func newStatsDEncoder(config runtime.StatsDConfig) *statsDEncoder {
+	return &statsDEncoder{config: config, last: map[string]float64{}}
+}
+
+// encode encodes the provided snapshots into UDP packets, each at most
+// maxStatsDPacketSize bytes long unless a single metric is longer.
+func (e *statsDEncoder) encode(snapshots []*metrics.MetricSnapshot) [][]byte {
+	var packets [][]byte
+	var packet, lines []byte
+	for _, s := range snapshots {
+		lines = e.appendLines(lines[:0], s)
+		if len(packet) > 0 && len(packet)+len(lines) > maxStatsDPacketSize {
+			packets = append(packets, packet)
+			packet = nil
+		}
+		packet = append(packet, lines...)
+	}
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+// appendLines appends the lines that encode a snapshot to b.
+func (e *statsDEncoder) appendLines(b []byte, s *metrics.MetricSnapshot) []byte {
+	name := e.config.Prefix + statsDReplacer.Replace(s.Name)
+	tags := e.tags(s.Labels)
+	key := name + "|" + tags
+	if e.config.Format == "statsd" {
+		// Plain StatsD has no tags. Counters with different labels are
+		// still tracked separately, and summed by the server.
+		tags = ""
+	}
+	switch s.Type {
+	case protos.MetricType_COUNTER:
+		b = appendStatsDLine(b, name, e.delta(key, s.Value), "c", tags)
+	case protos.MetricType_GAUGE:
+		if s.Value < 0 && e.config.Format == "statsd" {
+			// Plain StatsD treats a signed gauge value as a change to the
+			// current value, so we reset the gauge first.
+			b = appendStatsDLine(b, name, 0, "g", tags)
+		}
+		b = appendStatsDLine(b, name, s.Value, "g", tags)
+	case protos.MetricType_HISTOGRAM:
+		var count uint64
+		for _, c := range s.Counts {
+			count += c
+		}
+		b = appendStatsDLine(b, name+".count", e.delta(key+".count", float64(count)), "c", tags)
+		b = appendStatsDLine(b, name+".sum", e.delta(key+".sum", s.Value), "c", tags)
+	}
+	return b
+}
+
+// delta returns the increase of the counter with the provided key since the
+// previous export. Counters start at zero, so the first export sends the
+// current value. Counters never decrease, so a decrease means the metric was
+// reset, and the current value is sent as well.
+func (e *statsDEncoder) delta(key string, value float64) float64 {
+	last, ok := e.last[key]
+	e.last[key] = value
+	if !ok || value < last {
+		return value
+	}
+	return value - last
+}
+
+// tags returns the comma-separated DogStatsD tags of a metric with the
+// provided labels, in sorted order.
+func (e *statsDEncoder) tags(labels map[string]string) string {
+	var tags []string
+	for key, value := range e.config.Tags {
+		tags = append(tags, statsDReplacer.Replace(key)+":"+statsDReplacer.Replace(value))
+	}
+	for key, value := range labels {
+		if mapped, ok := e.config.TagMapping[key]; ok {
+			key = mapped
+		}
+		if key == "" {
+			continue
+		}
+		tags = append(tags, statsDReplacer.Replace(key)+":"+statsDReplacer.Replace(value))
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, ",")
+}
+
+// statsDReplacer replaces the characters that delimit the fields of a StatsD
+// line in metric names and tags.
+var statsDReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", ",", "_", "#", "_", "\n", "_")
+
+// appendStatsDLine appends a line like "name:42|c|#key:value" to b.
+func appendStatsDLine(b []byte, name string, value float64, typ, tags string) []byte {
+	b = append(b, name...)
+	b = append(b, ':')
+	b = strconv.AppendFloat(b, value, 'g', -1, 64)
+	b = append(b, '|')
+	b = append(b, typ...)
+	if tags != "" {
+		b = append(b, "|#"...)
+		b = append(b, tags...)
+	}
+	return append(b, '\n')
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStatsDEncoder(t *testing.T) {
+	encoder := newStatsDEncoder(runtime.StatsDConfig{
+		Address:    "localhost:8125",
+		Prefix:     "todo.",
+		Tags:       map[string]string{"env": "prod"},
+		TagMapping: map[string]string{"component": "service", "replica": ""},
+	})
+	labels := map[string]string{"component": "Cache", "replica": "1234"}
+	snapshots := func(calls, size float64, counts []uint64, sum float64) []*metrics.MetricSnapshot {
+		return []*metrics.MetricSnapshot{
+			{Type: protos.MetricType_COUNTER, Name: "calls", Labels: labels, Value: calls},
+			{Type: protos.MetricType_GAUGE, Name: "size", Labels: labels, Value: size},
+			{Type: protos.MetricType_HISTOGRAM, Name: "latency", Labels: labels, Bounds: []float64{10}, Counts: counts, Value: sum},
+		}
+	}
+	lines := func(packets [][]byte) []string {
+		if len(packets) != 1 {
+			t.Fatalf("got %d packets, want 1", len(packets))
+		}
+		return strings.Split(strings.TrimSuffix(string(packets[0]), "\n"), "\n")
+	}
+
+	// The first export sends the current values of counters.
+	got := lines(encoder.encode(snapshots(5, -3, []uint64{1, 1}, 20)))
+	want := []string{
+		"todo.calls:5|c|#env:prod,service:Cache",
+		"todo.size:-3|g|#env:prod,service:Cache",
+		"todo.latency.count:2|c|#env:prod,service:Cache",
+		"todo.latency.sum:20|c|#env:prod,service:Cache",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("first export (-want +got):\n%s", diff)
+	}
+
+	// Later exports send the increase of counters.
+	got = lines(encoder.encode(snapshots(7, 4, []uint64{2, 1}, 25)))
+	want = []string{
+		"todo.calls:2|c|#env:prod,service:Cache",
+		"todo.size:4|g|#env:prod,service:Cache",
+		"todo.latency.count:1|c|#env:prod,service:Cache",
+		"todo.latency.sum:5|c|#env:prod,service:Cache",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("second export (-want +got):\n%s", diff)
+	}
+}
+
+func TestStatsDEncoderPlainFormat(t *testing.T) {
+	encoder := newStatsDEncoder(runtime.StatsDConfig{Address: "localhost:8125", Format: "statsd"})
+	packets := encoder.encode([]*metrics.MetricSnapshot{
+		{Type: protos.MetricType_COUNTER, Name: "a:b", Labels: map[string]string{"method": "A"}, Value: 3},
+		{Type: protos.MetricType_COUNTER, Name: "a:b", Labels: map[string]string{"method": "B"}, Value: 4},
+		{Type: protos.MetricType_GAUGE, Name: "temperature", Value: -2},
+	})
+	want := "a_b:3|c\na_b:4|c\ntemperature:0|g\ntemperature:-2|g\n"
+	if len(packets) != 1 || string(packets[0]) != want {
+		t.Fatalf("got %q, want %q", packets, want)
+	}
+}
+
+func TestStatsDEncoderPackets(t *testing.T) {
+	encoder := newStatsDEncoder(runtime.StatsDConfig{Address: "localhost:8125"})
+	var snapshots []*metrics.MetricSnapshot
+	for i := 0; i < 200; i++ {
+		snapshots = append(snapshots, &metrics.MetricSnapshot{
+			Type:   protos.MetricType_GAUGE,
+			Name:   "gauge",
+			Labels: map[string]string{"index": strings.Repeat("x", i%10)},
+			Value:  float64(i),
+		})
+	}
+	packets := encoder.encode(snapshots)
+	if len(packets) < 2 {
+		t.Fatalf("got %d packets, want at least 2", len(packets))
+	}
+	n := 0
+	for _, packet := range packets {
+		if len(packet) > maxStatsDPacketSize {
+			t.Errorf("packet of %d bytes exceeds %d", len(packet), maxStatsDPacketSize)
+		}
+		if !strings.HasSuffix(string(packet), "\n") {
+			t.Errorf("packet %q splits a line", packet)
+		}
+		n += strings.Count(string(packet), "\n")
+	}
+	if n != len(snapshots) {
+		t.Fatalf("got %d lines, want %d", n, len(snapshots))
+	}
+}
@@ -17,10 +17,17 @@ package weaver
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
+	"time"
 
 	"go.opentelemetry.io/otel/trace"
+	"github.com/ServiceWeaver/weaver/internal/faults"
 	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/metrics"
+	"github.com/ServiceWeaver/weaver/runtime"
 	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/retry"
 )
 
 // retriable is a retriable error. If err is a retriable, then errors.Is(err,
@@ -56,6 +63,121 @@ type stub struct {
 	methods  []call.MethodKey // Keys for the remote component methods.
 	balancer call.Balancer    // if not nil, component load balancer
 	tracer   trace.Tracer     // component tracer
+	policies []methodPolicy   // if not nil, per-method call policies
+	breaker  *breaker         // if not nil, component circuit breaker
+	mirror   *mirror          // if not nil, mirrors calls to a shadow deployment
+	batcher  *batcher         // if not nil, batches calls
+	limit    *messageLimit    // if not nil, maximum size of the arguments
+	caller   uint64           // if not 0, identifies the caller to the callee
+	acl      *acl             // if not nil, fails the calls the callee denies
+	audit    *auditor         // if not nil, audits local calls
+	record   *recorder        // if not nil, records local calls
+}
+
+// methodPolicy holds the configured call policies of a component method.
+type methodPolicy struct {
+	timeout time.Duration  // if positive, timeout of the whole call
+	retry   *retryPolicy   // if not nil, retry policy
+	hedging *hedgingPolicy // if not nil, hedging policy
+	faults  []faults.Fault // faults injected by weavertest
+}
+
+// appliesLocally returns whether any of the provided policies applies to
+// local calls. Retries and hedging don't, since local calls never fail to
+// reach the component and there is no other replica to hedge with.
+func appliesLocally(policies []methodPolicy) bool {
+	for _, p := range policies {
+		if p.timeout > 0 || len(p.faults) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// retryPolicy is the retry policy of a component method. See
+// runtime.RetryPolicy.
+type retryPolicy struct {
+	maxAttempts   int
+	backoff       retry.Options
+	unreachable   bool // retry call.Unreachable errors?
+	communication bool // retry call.CommunicationError errors?
+	overloaded    bool // retry ErrOverloaded errors?
+}
+
+// hedgingPolicy is the hedging policy of a component method. See
+// runtime.HedgingPolicy.
+type hedgingPolicy struct {
+	delay       time.Duration
+	maxAttempts int
+	hedged      *metrics.Counter // counts the calls sent to hedge
+}
+
+type hedgingLabels struct {
+	Component string // full callee component name
+	Method    string // callee component method
+}
+
+var hedgedCalls = metrics.NewCounterMap[hedgingLabels](
+	"serviceweaver_method_hedged_count",
+	"Count of Service Weaver component method invocations sent again to hedge against a slow replica",
+)
+
+// messageLimit is the maximum size of the serialized arguments, and results,
+// of the methods of a component.
+type messageLimit struct {
+	component string
+	methods   []string // indexed like the methods of the component interface
+	max       int
+}
+
+type oversizedLabels struct {
+	Component string // full callee component name
+	Method    string // callee component method
+}
+
+var oversizedCalls = metrics.NewCounterMap[oversizedLabels](
+	"serviceweaver_method_oversized_count",
+	"Count of Service Weaver component method invocations rejected because their serialized arguments or results were too large",
+)
+
+// newMessageLimit returns the messageLimit of the provided component, given
+// the max_message_size of the application config.
+func newMessageLimit(c *component, global int) *messageLimit {
+	max := c.settings.MaxMessageSize
+	if max == 0 {
+		max = global
+	}
+	if max == 0 || max > call.MaxPayloadSize {
+		max = call.MaxPayloadSize
+	}
+	n := c.info.Iface.NumMethod()
+	methods := make([]string, n)
+	for i := 0; i < n; i++ {
+		methods[i] = c.info.Iface.Method(i).Name
+	}
+	return &messageLimit{component: c.info.Name, methods: methods, max: max}
+}
+
+// check returns a *MessageTooLargeError if a message of the provided size,
+// sent by a call to the provided method, is too large.
+func (l *messageLimit) check(method int, size int) error {
+	if size <= l.max {
+		return nil
+	}
+	oversizedCalls.Get(oversizedLabels{Component: l.component, Method: l.methods[method]}).Add(1)
+	return &MessageTooLargeError{
+		Component: l.component,
+		Method:    l.methods[method],
+		Size:      size,
+		Limit:     l.max,
+	}
+}
+
+// retriable returns whether a call that failed with err should be retried.
+func (p *retryPolicy) retriable(err error) bool {
+	return (p.unreachable && errors.Is(err, call.Unreachable)) ||
+		(p.communication && errors.Is(err, call.CommunicationError)) ||
+		(p.overloaded && errors.Is(err, ErrOverloaded))
 }
 
 var _ codegen.Stub = &stub{}
@@ -67,17 +189,315 @@ func (s *stub) Tracer() trace.Tracer {
 
 // Run implements the codegen.Stub interface.
 func (s *stub) Run(ctx context.Context, method int, args []byte, shardKey uint64) ([]byte, error) {
+	if s.audit == nil && s.record == nil {
+		return s.run(ctx, method, args, shardKey)
+	}
+	start := time.Now()
+	result, err := s.run(ctx, method, args, shardKey)
+	if s.audit != nil {
+		s.audit.record(method, s.caller, shardKey, err)
+	}
+	if s.record != nil {
+		s.record.record(method, s.caller, shardKey, start, args, result, err)
+	}
+	return result, err
+}
+
+// run implements Run.
+func (s *stub) run(ctx context.Context, method int, args []byte, shardKey uint64) ([]byte, error) {
+	if s.acl != nil {
+		if err := s.acl.check(method, s.caller); err != nil {
+			return nil, err
+		}
+	}
+	if s.limit != nil {
+		// Reject oversized arguments here, rather than let the server
+		// reject them, which closes the connection and fails the other
+		// calls on it too.
+		if err := s.limit.check(method, len(args)); err != nil {
+			return nil, err
+		}
+	}
+	var policy methodPolicy
+	if s.policies != nil {
+		policy = s.policies[method]
+	}
+	if policy.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.timeout)
+		defer cancel()
+	}
+	if s.mirror != nil {
+		s.mirror.call(s.methods[method], args, shardKey, policy.timeout)
+	}
 	opts := call.CallOptions{
 		ShardKey: shardKey,
 		Balancer: s.balancer,
+		Caller:   s.caller,
+	}
+	if policy.retry == nil {
+		return s.hedge(ctx, s.methods[method], args, opts, policy)
 	}
-	return s.client.Call(ctx, s.methods[method], args, opts)
+
+	var err error
+	r := retry.BeginWithOptions(policy.retry.backoff)
+	for attempt := 0; attempt < policy.retry.maxAttempts && r.Continue(ctx); attempt++ {
+		var reply []byte
+		reply, err = s.hedge(ctx, s.methods[method], args, opts, policy)
+		if err == nil || !policy.retry.retriable(err) {
+			return reply, err
+		}
+	}
+	if err == nil {
+		// ctx was done before the first attempt.
+		err = ctx.Err()
+	}
+	return nil, err
+}
+
+// hedge makes a call to the component, hedged according to the provided
+// policy if it has a hedging policy. It returns the first successful reply, or
+// the last error if every hedged call failed.
+func (s *stub) hedge(ctx context.Context, key call.MethodKey, args []byte, opts call.CallOptions, policy methodPolicy) ([]byte, error) {
+	h := policy.hedging
+	if h == nil {
+		return s.call(ctx, key, args, opts, policy.faults)
+	}
+
+	// The caller may reuse args once its call returns, but the calls that
+	// lose the race may outlive it.
+	args = append([]byte(nil), args...)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // cancels the calls that lost the race
+	type result struct {
+		reply []byte
+		err   error
+	}
+	results := make(chan result, h.maxAttempts)
+	send := func() {
+		reply, err := s.call(ctx, key, args, opts, policy.faults)
+		results <- result{reply, err}
+	}
+	go send()
+	sent, inflight := 1, 1
+	timer := time.NewTimer(h.delay)
+	defer timer.Stop()
+	for {
+		select {
+		case r := <-results:
+			inflight--
+			if r.err == nil || inflight == 0 {
+				return r.reply, r.err
+			}
+		case <-timer.C:
+			sent++
+			inflight++
+			h.hedged.Add(1)
+			go send()
+			if sent < h.maxAttempts {
+				timer.Reset(h.delay)
+			}
+		}
+	}
+}
+
+// call makes a single call to the component, through the circuit breaker and
+// the batcher if there are any, after injecting the provided faults.
+func (s *stub) call(ctx context.Context, key call.MethodKey, args []byte, opts call.CallOptions, fs []faults.Fault) ([]byte, error) {
+	do := func() ([]byte, error) {
+		if err := injectFaults(ctx, fs); err != nil {
+			return nil, err
+		}
+		if s.batcher != nil && s.batcher.batches(key) {
+			return s.batcher.call(ctx, key, args, opts)
+		}
+		return s.client.Call(ctx, key, args, opts)
+	}
+	if s.breaker == nil {
+		return do()
+	}
+	generation, err := s.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	reply, err := do()
+	// Calls canceled by the caller say nothing about the component.
+	failed := err != nil && !errors.Is(err, context.Canceled)
+	s.breaker.done(generation, failed, time.Since(start))
+	return reply, err
 }
 
 // WrapError implements the codegen.Stub interface.
 func (s *stub) WrapError(err error) error {
-	if errors.Is(err, call.CommunicationError) || errors.Is(err, call.Unreachable) {
+	if errors.Is(err, call.CommunicationError) || errors.Is(err, call.Unreachable) || errors.Is(err, ErrOverloaded) {
 		return retriable{err}
 	}
 	return err
 }
+
+// methodKeys returns the keys for the methods of the provided component,
+// indexed like the methods of the component interface.
+func methodKeys(c *component) []call.MethodKey {
+	n := c.info.Iface.NumMethod()
+	methods := make([]call.MethodKey, n)
+	for i := 0; i < n; i++ {
+		mname := c.info.Iface.Method(i).Name
+		methods[i] = call.MakeMethodKey(c.info.Name, mname)
+	}
+	return methods
+}
+
+// newBalancer returns the balancer for the calls to the provided unrouted
+// component, as configured by its placement and balancing settings, or nil if
+// the client's default round-robin balancer applies.
+func newBalancer(c *component) call.Balancer {
+	var newPolicy func() call.Balancer
+	switch c.settings.Balancing {
+	case runtime.BalancingLeastOutstanding:
+		newPolicy = call.LeastOutstanding
+	case runtime.BalancingPowerOfTwo:
+		newPolicy = call.PowerOfTwoChoices
+	default:
+		newPolicy = func() call.Balancer { return call.RoundRobin() }
+	}
+	if c.settings.Placement == runtime.PlacementLocality {
+		return call.PreferLocality(os.Getenv(runtime.LocalityKey), newPolicy)
+	}
+	if c.settings.Balancing == "" || c.settings.Balancing == runtime.BalancingRoundRobin {
+		return nil
+	}
+	return newPolicy()
+}
+
+// methodPolicies returns the configured call policies of the methods of the
+// provided component, indexed like the methods of the component interface,
+// or nil if none of the methods has a policy.
+func methodPolicies(c *component) []methodPolicy {
+	settings := c.settings
+	if len(settings.MethodTimeouts) == 0 && settings.Retry.MaxAttempts <= 1 && len(settings.MethodRetries) == 0 && len(settings.MethodHedging) == 0 && len(c.faults) == 0 {
+		return nil
+	}
+	n := c.info.Iface.NumMethod()
+	policies := make([]methodPolicy, n)
+	for i := 0; i < n; i++ {
+		mname := c.info.Iface.Method(i).Name
+		policies[i].timeout = settings.MethodTimeouts[mname]
+		policies[i].faults = methodFaults(c.faults, mname)
+		config, ok := settings.MethodRetries[mname]
+		if !ok {
+			config = settings.Retry
+		}
+		policies[i].retry = newRetryPolicy(config)
+		if hedging, ok := settings.MethodHedging[mname]; ok {
+			policies[i].hedging = newHedgingPolicy(c.info.Name, mname, hedging)
+		}
+	}
+	return policies
+}
+
+// newHedgingPolicy returns the hedgingPolicy of the named method for the
+// provided config.
+func newHedgingPolicy(component, method string, config runtime.HedgingPolicy) *hedgingPolicy {
+	p := &hedgingPolicy{
+		delay:       config.Delay,
+		maxAttempts: config.MaxAttempts,
+		hedged:      hedgedCalls.Get(hedgingLabels{Component: component, Method: method}),
+	}
+	if p.maxAttempts == 0 {
+		p.maxAttempts = 2
+	}
+	return p
+}
+
+// newRetryPolicy returns the retryPolicy for the provided config, or nil if
+// the config doesn't allow retries.
+func newRetryPolicy(config runtime.RetryPolicy) *retryPolicy {
+	if config.MaxAttempts <= 1 {
+		return nil
+	}
+	p := &retryPolicy{
+		maxAttempts: config.MaxAttempts,
+		backoff: retry.Options{
+			BackoffMultiplier:  config.Multiplier,
+			BackoffMinDuration: config.InitialBackoff,
+			BackoffMaxDuration: config.MaxBackoff,
+			Jitter:             config.Jitter,
+		},
+	}
+	if p.backoff.BackoffMultiplier == 0 {
+		p.backoff.BackoffMultiplier = retry.DefaultOptions.BackoffMultiplier
+	}
+	if p.backoff.BackoffMinDuration == 0 {
+		p.backoff.BackoffMinDuration = retry.DefaultOptions.BackoffMinDuration
+	}
+	if len(config.RetryOn) == 0 {
+		p.unreachable = true
+		p.overloaded = true
+	}
+	for _, class := range config.RetryOn {
+		switch class {
+		case runtime.RetryOnUnreachable:
+			p.unreachable = true
+		case runtime.RetryOnCommunication:
+			p.communication = true
+		case runtime.RetryOnOverloaded:
+			p.overloaded = true
+		}
+	}
+	return p
+}
+
+// localConnection is a call.Connection that executes calls on a local
+// component using the component's server stub. It lets local calls go through
+// a stub, so that the component's call policies (e.g., method timeouts) apply
+// to them too.
+type localConnection struct {
+	server codegen.Server
+	names  map[call.MethodKey]string // method key -> method name
+}
+
+var _ call.Connection = &localConnection{}
+
+// newLocalConnection returns a localConnection for the provided component,
+// whose implementation is impl.
+func newLocalConnection(c *component, impl *componentImpl) *localConnection {
+	names := map[call.MethodKey]string{}
+	for i, key := range methodKeys(c) {
+		names[key] = c.info.Iface.Method(i).Name
+	}
+	return &localConnection{server: impl.serverStub, names: names}
+}
+
+// Call implements the call.Connection interface.
+func (l *localConnection) Call(ctx context.Context, key call.MethodKey, args []byte, opts call.CallOptions) ([]byte, error) {
+	name, ok := l.names[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown method %v", key)
+	}
+	ctx = call.WithMetadata(ctx, opts)
+
+	// Run the method in a separate goroutine, so that we can return as soon
+	// as ctx is done, like a remote call would. The method may outlive the
+	// call, and may retain slices of its arguments, so it gets its own copy
+	// of args, which the caller may reuse once the call returns.
+	args = append([]byte(nil), args...)
+	type result struct {
+		reply []byte
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reply, err := l.server.GetStubFn(name)(ctx, args)
+		done <- result{reply, err}
+	}()
+	select {
+	case r := <-done:
+		return r.reply, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close implements the call.Connection interface.
+func (l *localConnection) Close() {}
@@ -20,10 +20,13 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/runtime"
 	"github.com/ServiceWeaver/weaver/runtime/codegen"
 )
 
@@ -273,6 +276,211 @@ func TestWrapErrors(t *testing.T) {
 }
 
 // convertCallPanicToError catches and returns errors detected during fn's execution.
+// failingClient is a call.Connection whose calls fail with the errors in
+// errs, in order, and then succeed.
+type failingClient struct {
+	errs  []error
+	calls int
+}
+
+var _ call.Connection = &failingClient{}
+
+func (c *failingClient) Call(context.Context, call.MethodKey, []byte, call.CallOptions) ([]byte, error) {
+	c.calls++
+	if c.calls <= len(c.errs) {
+		return nil, c.errs[c.calls-1]
+	}
+	return nil, nil
+}
+
+func (c *failingClient) Close() {}
+
+func TestRetries(t *testing.T) {
+	unreachable := fmt.Errorf("%w: no endpoints available", call.Unreachable)
+	communication := fmt.Errorf("%w: connection closed", call.CommunicationError)
+	overloaded := fmt.Errorf("%w: too many calls", ErrOverloaded)
+	other := errors.New("other")
+	for _, test := range []struct {
+		name      string
+		policy    runtime.RetryPolicy
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"no retries", runtime.RetryPolicy{}, []error{unreachable}, 1, unreachable},
+		{"retried", runtime.RetryPolicy{MaxAttempts: 3}, []error{unreachable, unreachable}, 3, nil},
+		{"attempts exhausted", runtime.RetryPolicy{MaxAttempts: 2}, []error{unreachable, unreachable}, 2, unreachable},
+		{"communication not retried by default", runtime.RetryPolicy{MaxAttempts: 3}, []error{communication}, 1, communication},
+		{
+			"communication retried",
+			runtime.RetryPolicy{MaxAttempts: 3, RetryOn: []string{"communication"}},
+			[]error{communication},
+			2,
+			nil,
+		},
+		{"overloaded retried by default", runtime.RetryPolicy{MaxAttempts: 3}, []error{overloaded}, 2, nil},
+		{
+			"overloaded not retried",
+			runtime.RetryPolicy{MaxAttempts: 3, RetryOn: []string{"unreachable"}},
+			[]error{overloaded},
+			1,
+			overloaded,
+		},
+		{"other errors not retried", runtime.RetryPolicy{MaxAttempts: 3}, []error{other}, 1, other},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.policy.InitialBackoff = time.Millisecond
+			client := &failingClient{errs: test.errs}
+			stub := stub{
+				client:   client,
+				methods:  []call.MethodKey{call.MakeMethodKey("", "test")},
+				policies: []methodPolicy{{retry: newRetryPolicy(test.policy)}},
+			}
+			if _, err := stub.Run(context.Background(), 0, nil, 0); err != test.wantErr {
+				t.Errorf("Run: got error %v, want %v", err, test.wantErr)
+			}
+			if client.calls != test.wantCalls {
+				t.Errorf("Run: got %d calls, want %d", client.calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+// hedgingClient is a call.Connection whose ith call blocks until canceled
+// if slow[i], and otherwise returns errs[i], or "reply i" if errs[i] is nil.
+type hedgingClient struct {
+	slow []bool
+	errs []error
+
+	mu       sync.Mutex
+	calls    int
+	canceled int
+}
+
+var _ call.Connection = &hedgingClient{}
+
+func (c *hedgingClient) Call(ctx context.Context, _ call.MethodKey, _ []byte, _ call.CallOptions) ([]byte, error) {
+	c.mu.Lock()
+	i := c.calls
+	c.calls++
+	c.mu.Unlock()
+	if i < len(c.slow) && c.slow[i] {
+		<-ctx.Done()
+		c.mu.Lock()
+		c.canceled++
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+	if i < len(c.errs) && c.errs[i] != nil {
+		return nil, c.errs[i]
+	}
+	return []byte(fmt.Sprintf("reply %d", i)), nil
+}
+
+func (c *hedgingClient) Close() {}
+
+func TestHedging(t *testing.T) {
+	unreachable := fmt.Errorf("%w: no endpoints available", call.Unreachable)
+	for _, test := range []struct {
+		name      string
+		policy    runtime.HedgingPolicy
+		slow      []bool
+		errs      []error
+		wantReply string
+		wantErr   error
+		wantCalls int
+	}{
+		{"fast", runtime.HedgingPolicy{}, nil, nil, "reply 0", nil, 1},
+		{"slow", runtime.HedgingPolicy{}, []bool{true}, nil, "reply 1", nil, 2},
+		{"slow twice", runtime.HedgingPolicy{MaxAttempts: 3}, []bool{true, true}, nil, "reply 2", nil, 3},
+		{"failed", runtime.HedgingPolicy{}, nil, []error{unreachable}, "", unreachable, 1},
+		{"hedge failed", runtime.HedgingPolicy{}, []bool{true}, []error{nil, unreachable}, "", context.DeadlineExceeded, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.policy.Delay = time.Millisecond
+			client := &hedgingClient{slow: test.slow, errs: test.errs}
+			stub := stub{
+				client:   client,
+				methods:  []call.MethodKey{call.MakeMethodKey("", "test")},
+				policies: []methodPolicy{{hedging: newHedgingPolicy("test", "test", test.policy)}},
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			reply, err := stub.Run(ctx, 0, nil, 0)
+			if string(reply) != test.wantReply || !errors.Is(err, test.wantErr) {
+				t.Errorf("Run: got (%q, %v), want (%q, %v)", reply, err, test.wantReply, test.wantErr)
+			}
+			client.mu.Lock()
+			defer client.mu.Unlock()
+			if client.calls != test.wantCalls {
+				t.Errorf("Run: got %d calls, want %d", client.calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+type mirroringClient struct {
+	args chan []byte
+}
+
+var _ call.Connection = &mirroringClient{}
+
+func (c *mirroringClient) Call(_ context.Context, _ call.MethodKey, args []byte, _ call.CallOptions) ([]byte, error) {
+	c.args <- args
+	return nil, errors.New("discarded")
+}
+
+func (c *mirroringClient) Close() {}
+
+func TestMirror(t *testing.T) {
+	primary := &failingClient{}
+	shadow := &mirroringClient{args: make(chan []byte, 1)}
+	stub := stub{
+		client:  primary,
+		methods: []call.MethodKey{call.MakeMethodKey("", "test")},
+		mirror:  newMirror(context.Background(), "test", shadow, nil, 1),
+	}
+	args := []byte("args")
+	if _, err := stub.Run(context.Background(), 0, args, 0); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	copy(args, "xxxx") // the mirror must not see changes made after Run
+	select {
+	case got := <-shadow.args:
+		if string(got) != "args" {
+			t.Errorf("mirrored args: got %q, want %q", got, "args")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("call not mirrored")
+	}
+	if primary.calls != 1 {
+		t.Errorf("Run: got %d calls, want 1", primary.calls)
+	}
+}
+
+func TestMessageLimit(t *testing.T) {
+	client := &failingClient{}
+	stub := stub{
+		client:  client,
+		methods: []call.MethodKey{call.MakeMethodKey("", "test")},
+		limit:   &messageLimit{component: "test", methods: []string{"test"}, max: 4},
+	}
+	if _, err := stub.Run(context.Background(), 0, []byte("args"), 0); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	_, err := stub.Run(context.Background(), 0, []byte("big args"), 0)
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("Run: got %v, want %v", err, ErrMessageTooLarge)
+	}
+	var tooLarge *MessageTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Size != 8 || tooLarge.Limit != 4 {
+		t.Fatalf("Run: got %#v, want a MessageTooLargeError of size 8 and limit 4", err)
+	}
+	if client.calls != 1 {
+		t.Errorf("Run: got %d calls, want 1", client.calls)
+	}
+}
+
 func convertCallPanicToError(fn func() error) (err error) {
 	defer func() {
 		if err == nil {
@@ -0,0 +1,245 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/logtype"
+	"github.com/ServiceWeaver/weaver/internal/spiffe"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/retry"
+)
+
+// certReloadInterval is the minimum interval between two checks of whether
+// the certificate files have changed on disk.
+const certReloadInterval = 10 * time.Second
+
+// workloadAPITimeout is how long a weavelet waits for its first X.509 SVID
+// from the SPIFFE Workload API.
+const workloadAPITimeout = 30 * time.Second
+
+// certLoader loads the certificate, key, and trusted CAs used for mutual TLS
+// between weavelets. It reloads the files when they change on disk, or
+// follows the X.509 SVIDs streamed by the SPIFFE Workload API, so that
+// certificates can be rotated without restarting the application.
+type certLoader struct {
+	config runtime.TLSConfig
+	logger logtype.Logger
+	now    func() time.Time // time.Now usually, but injected fake in tests
+
+	mu       sync.Mutex
+	checked  time.Time    // last time the files were checked
+	modTimes [3]time.Time // modification times of the loaded files
+	cert     *tls.Certificate
+	roots    *x509.CertPool
+}
+
+// newCertLoader returns a certLoader for the provided config, failing if the
+// files cannot be loaded. With a Workload API endpoint, newCertLoader waits
+// for the first SVID, and keeps watching the endpoint until ctx is cancelled.
+func newCertLoader(ctx context.Context, config runtime.TLSConfig, logger logtype.Logger) (*certLoader, error) {
+	l := &certLoader{config: config, logger: logger, now: time.Now}
+	if config.WorkloadAPI != "" {
+		client, err := spiffe.NewClient(config.WorkloadAPI)
+		if err != nil {
+			return nil, err
+		}
+		ready := make(chan struct{})
+		go l.watch(ctx, client, ready)
+		select {
+		case <-ready:
+			return l, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(workloadAPITimeout):
+			return nil, fmt.Errorf("tls: no X.509 SVID received from the SPIFFE Workload API at %q after %v", config.WorkloadAPI, workloadAPITimeout)
+		}
+	}
+	if _, _, err := l.get(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// watch installs the X.509 SVIDs streamed by the Workload API, reconnecting
+// when the stream fails, until ctx is cancelled. ready is closed once the
+// first SVID is installed.
+func (l *certLoader) watch(ctx context.Context, client *spiffe.Client, ready chan<- struct{}) {
+	var once sync.Once
+	for r := retry.Begin(); r.Continue(ctx); {
+		err := client.WatchX509SVIDs(ctx, func(svid *spiffe.X509SVID) {
+			l.setSVID(svid)
+			once.Do(func() { close(ready) })
+			r.Reset()
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		l.logger.Error("Watching X.509 SVIDs; using the last SVID received", err, "address", l.config.WorkloadAPI)
+	}
+}
+
+// setSVID installs the provided SVID, which is used for new connections.
+func (l *certLoader) setSVID(svid *spiffe.X509SVID) {
+	roots := x509.NewCertPool()
+	for _, ca := range svid.Bundle {
+		roots.AddCert(ca)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cert, l.roots = &svid.Certificate, roots
+}
+
+// get returns the current certificate and trusted CAs, reloading them if the
+// files have changed. If a reload fails, the previously loaded values are
+// returned, so that a partially written file doesn't break connectivity.
+func (l *certLoader) get() (*tls.Certificate, *x509.CertPool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.config.WorkloadAPI != "" {
+		// The SVIDs are installed by watch.
+		return l.cert, l.roots, nil
+	}
+	now := l.now()
+	if l.cert != nil && now.Sub(l.checked) < certReloadInterval {
+		return l.cert, l.roots, nil
+	}
+	l.checked = now
+
+	var modTimes [3]time.Time
+	for i, file := range []string{l.config.CertFile, l.config.KeyFile, l.config.CAFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return l.stale(fmt.Errorf("tls: %w", err))
+		}
+		modTimes[i] = info.ModTime()
+	}
+	if l.cert != nil && modTimes == l.modTimes {
+		return l.cert, l.roots, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.config.CertFile, l.config.KeyFile)
+	if err != nil {
+		return l.stale(fmt.Errorf("tls: load key pair: %w", err))
+	}
+	pem, err := os.ReadFile(l.config.CAFile)
+	if err != nil {
+		return l.stale(fmt.Errorf("tls: %w", err))
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return l.stale(fmt.Errorf("tls: no certificates found in %q", l.config.CAFile))
+	}
+	l.cert, l.roots, l.modTimes = &cert, roots, modTimes
+	return l.cert, l.roots, nil
+}
+
+// stale returns the previously loaded values, if any, or err if nothing was
+// ever loaded.
+//
+// REQUIRES: l.mu is held.
+func (l *certLoader) stale(err error) (*tls.Certificate, *x509.CertPool, error) {
+	if l.cert == nil {
+		return nil, nil, err
+	}
+	l.logger.Error("Reloading TLS certificates; using previously loaded certificates", err)
+	return l.cert, l.roots, nil
+}
+
+// verify verifies that the peer's certificate chain is signed by a trusted
+// CA. Peers are identified by their CA rather than their host name, since
+// weavelets are dialed by IP address.
+func (l *certLoader) verify(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	_, roots, err := l.get()
+	if err != nil {
+		return err
+	}
+	if len(rawCerts) == 0 {
+		return errors.New("tls: peer presented no certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("tls: parse peer certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return fmt.Errorf("tls: verify peer certificate: %w", err)
+	}
+	if l.config.TrustDomain != "" {
+		return verifySPIFFEID(certs[0], l.config.TrustDomain)
+	}
+	return nil
+}
+
+// verifySPIFFEID verifies that the provided certificate is an X.509 SVID
+// whose SPIFFE ID is in the provided trust domain.
+func verifySPIFFEID(cert *x509.Certificate, trustDomain string) error {
+	// An X.509 SVID holds exactly one URI SAN, its SPIFFE ID. See
+	// https://github.com/spiffe/spiffe/blob/main/standards/X509-SVID.md.
+	if len(cert.URIs) != 1 {
+		return fmt.Errorf("tls: peer certificate has %d URI SANs, want 1 SPIFFE ID", len(cert.URIs))
+	}
+	id := cert.URIs[0]
+	if id.Scheme != "spiffe" || id.Host != trustDomain {
+		return fmt.Errorf("tls: peer SPIFFE ID %q not in trust domain %q", id, trustDomain)
+	}
+	return nil
+}
+
+// serverConfig returns the TLS config used by weavelet servers.
+func (l *certLoader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAnyClientCert,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _, err := l.get()
+			return cert, err
+		},
+		VerifyPeerCertificate: l.verify,
+	}
+}
+
+// clientConfig returns the TLS config used by weavelet clients.
+func (l *certLoader) clientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// The server's certificate is verified by l.verify instead.
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _, err := l.get()
+			return cert, err
+		},
+		VerifyPeerCertificate: l.verify,
+	}
+}
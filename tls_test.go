@@ -0,0 +1,292 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weaver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/internal/spiffe"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
+)
+
+// testCA is a certificate authority used to sign test certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// writeFiles writes a certificate signed by ca, its key, and ca's certificate
+// into dir and returns the corresponding config.
+func (ca *testCA) writeFiles(t *testing.T, dir string) runtime.TLSConfig {
+	t.Helper()
+	return ca.writeSVID(t, dir, "")
+}
+
+// writeSVID is like writeFiles, but the certificate holds the provided SPIFFE
+// ID, if not empty.
+func (ca *testCA) writeSVID(t *testing.T, dir string, id string) runtime.TLSConfig {
+	t.Helper()
+	der, key := ca.issue(t, id)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := runtime.TLSConfig{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}
+	for file, data := range map[string][]byte{
+		config.CertFile: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		config.KeyFile:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		config.CAFile:   ca.pem,
+	} {
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return config
+}
+
+// issue returns a certificate signed by ca, holding the provided SPIFFE ID if
+// not empty, and its key.
+func (ca *testCA) issue(t *testing.T, id string) ([]byte, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "weavelet"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if id != "" {
+		u, err := url.Parse(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der, key
+}
+
+// svid returns an X.509 SVID signed by ca, as received from the SPIFFE
+// Workload API.
+func (ca *testCA) svid(t *testing.T, id string) *spiffe.X509SVID {
+	t.Helper()
+	der, key := ca.issue(t, id)
+	return &spiffe.X509SVID{
+		ID:          id,
+		Certificate: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		Bundle:      []*x509.Certificate{ca.cert},
+	}
+}
+
+// handshake performs a TLS handshake between a client and a server with the
+// provided configs.
+func handshake(client, server *tls.Config) error {
+	// Connect over TCP rather than net.Pipe, whose unbuffered writes would
+	// deadlock when both sides write at once (e.g., when the server rejects
+	// the client's certificate while the client finishes its handshake).
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return err
+	}
+	defer lis.Close()
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	s, err := lis.Accept()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	errs := make(chan error, 1)
+	go func() {
+		err := tls.Server(s, server).Handshake()
+		if err != nil {
+			s.Close()
+		}
+		errs <- err
+	}()
+	clientErr := tls.Client(c, client).Handshake()
+	if clientErr != nil {
+		c.Close()
+	}
+	serverErr := <-errs
+	if clientErr != nil {
+		return clientErr
+	}
+	return serverErr
+}
+
+func newTestCertLoader(t *testing.T, config runtime.TLSConfig) *certLoader {
+	t.Helper()
+	l, err := newCertLoader(context.Background(), config, logging.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestTLSHandshake(t *testing.T) {
+	ca := newTestCA(t)
+	a := newTestCertLoader(t, ca.writeFiles(t, t.TempDir()))
+	b := newTestCertLoader(t, ca.writeFiles(t, t.TempDir()))
+	if err := handshake(a.clientConfig(), b.serverConfig()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSRejectsUntrustedPeer(t *testing.T) {
+	trusted := newTestCertLoader(t, newTestCA(t).writeFiles(t, t.TempDir()))
+	untrusted := newTestCertLoader(t, newTestCA(t).writeFiles(t, t.TempDir()))
+	if err := handshake(untrusted.clientConfig(), trusted.serverConfig()); err == nil {
+		t.Error("untrusted client: unexpected success")
+	}
+	if err := handshake(trusted.clientConfig(), untrusted.serverConfig()); err == nil {
+		t.Error("untrusted server: unexpected success")
+	}
+}
+
+func TestTLSRotation(t *testing.T) {
+	dir := t.TempDir()
+	server := newTestCertLoader(t, newTestCA(t).writeFiles(t, dir))
+	now := time.Now()
+	server.now = func() time.Time { return now }
+
+	// Rotate the server's files to a new CA that the client trusts.
+	ca := newTestCA(t)
+	client := newTestCertLoader(t, ca.writeFiles(t, t.TempDir()))
+	ca.writeFiles(t, dir)
+	future := now.Add(time.Minute)
+	for _, file := range []string{server.config.CertFile, server.config.KeyFile, server.config.CAFile} {
+		if err := os.Chtimes(file, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The server doesn't notice the new files until the reload interval
+	// elapses.
+	if err := handshake(client.clientConfig(), server.serverConfig()); err == nil {
+		t.Fatal("handshake before reload: unexpected success")
+	}
+	now = now.Add(certReloadInterval)
+	if err := handshake(client.clientConfig(), server.serverConfig()); err != nil {
+		t.Fatalf("handshake after reload: %v", err)
+	}
+}
+
+func TestTLSTrustDomain(t *testing.T) {
+	ca := newTestCA(t)
+	server := ca.writeSVID(t, t.TempDir(), "spiffe://example.org/payments")
+	server.TrustDomain = "example.org"
+	s := newTestCertLoader(t, server)
+	for _, test := range []struct {
+		id   string // SPIFFE ID of the client
+		want bool   // whether the server accepts the client
+	}{
+		{"spiffe://example.org/checkout", true},
+		{"spiffe://other.org/checkout", false},
+		{"https://example.org/checkout", false},
+		{"", false},
+	} {
+		t.Run(test.id, func(t *testing.T) {
+			client := newTestCertLoader(t, ca.writeSVID(t, t.TempDir(), test.id))
+			err := handshake(client.clientConfig(), s.serverConfig())
+			if got := err == nil; got != test.want {
+				t.Fatalf("handshake: got %v, want success %t", err, test.want)
+			}
+		})
+	}
+}
+
+func TestTLSWorkloadAPIRotation(t *testing.T) {
+	// newLoader returns a certLoader that holds the provided SVID, as if it
+	// had been streamed by the Workload API.
+	newLoader := func(svid *spiffe.X509SVID) *certLoader {
+		config := runtime.TLSConfig{
+			WorkloadAPI: "unix:///run/spire/sockets/agent.sock",
+			TrustDomain: "example.org",
+		}
+		l := &certLoader{config: config, logger: logging.NewTestLogger(t), now: time.Now}
+		l.setSVID(svid)
+		return l
+	}
+	ca := newTestCA(t)
+	client := newLoader(ca.svid(t, "spiffe://example.org/checkout"))
+	server := newLoader(newTestCA(t).svid(t, "spiffe://example.org/payments"))
+	if err := handshake(client.clientConfig(), server.serverConfig()); err == nil {
+		t.Fatal("handshake before rotation: unexpected success")
+	}
+
+	// Rotate the server's SVID to one signed by the client's CA.
+	server.setSVID(ca.svid(t, "spiffe://example.org/payments"))
+	if err := handshake(client.clientConfig(), server.serverConfig()); err != nil {
+		t.Fatalf("handshake after rotation: %v", err)
+	}
+}
@@ -24,15 +24,20 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime/pprof"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ServiceWeaver/weaver/internal/bench"
+	"github.com/ServiceWeaver/weaver/internal/fakes"
 	"github.com/ServiceWeaver/weaver/internal/net/call"
+	"github.com/ServiceWeaver/weaver/internal/replay"
 	"github.com/ServiceWeaver/weaver/internal/traceio"
 	"github.com/ServiceWeaver/weaver/runtime"
 	"github.com/ServiceWeaver/weaver/runtime/codegen"
 	"github.com/ServiceWeaver/weaver/runtime/logging"
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
 	"github.com/ServiceWeaver/weaver/runtime/protos"
 	"github.com/ServiceWeaver/weaver/runtime/retry"
 	"github.com/google/uuid"
@@ -49,16 +54,28 @@ var readyMethodKey = call.MakeMethodKey("", "ready")
 
 // A weavelet is responsible for running and managing Service Weaver components. As the
 // name suggests, a weavelet is analogous to a kubelet or borglet. Every
+const (
+	// Name and version of the instrumentation library that creates the
+	// traces and metrics of weavelets.
+	instrumentationLibrary = "github.com/ServiceWeaver/weaver/serviceweaver"
+	instrumentationVersion = "0.0.1"
+)
+
 // weavelet executes components for a single Service Weaver process, but a process may be
 // implemented by multiple weavelets.
 type weavelet struct {
 	ctx               context.Context
-	env               env                  // Manages interactions with execution environment
-	info              *protos.WeaveletInfo // Information about this weavelet
-	internalTransport *transport           // Transport for intra-colocation-group communication
-	externalTransport *transport           // Transport for inter-colocation-group communication
-	externalDialAddr  call.NetworkAddress  // Address this weavelet is reachable from the outside
-	tracer            trace.Tracer         // Tracer for this weavelet
+	stop              context.CancelFunc      // Cancels ctx
+	env               env                     // Manages interactions with execution environment
+	info              *protos.WeaveletInfo    // Information about this weavelet
+	config            *runtime.WeaveletConfig // Settings from the app config
+	internalTransport *transport              // Transport for intra-colocation-group communication
+	externalTransport *transport              // Transport for inter-colocation-group communication
+	externalDialAddr  call.NetworkAddress     // Address this weavelet is reachable from the outside
+	auth              *authenticator          // If not nil, authenticates the callers of remote calls
+	sockets           hostSockets             // Unix sockets of weavelets on this machine
+	tracer            trace.Tracer            // Tracer for this weavelet
+	resource          *resource.Resource      // Resource that traces and metrics are attributed to
 
 	root             *component                  // The automatically created "root" component
 	componentsByName map[string]*component       // component name -> component
@@ -69,6 +86,24 @@ type weavelet struct {
 	tcpClients  map[string]*client // indexed by process name
 
 	loads map[string]*loadCollector // load for every local routed component
+
+	replayer  *replay.Replayer     // if not nil, replays a recording; see weavertest.Replay
+	fakes     map[reflect.Type]any // fake component implementations; see weavertest.Fake
+	serialize bool                 // serialize local calls; see weavertest.Bench
+
+	shutdownMu    sync.Mutex
+	initialized   []*component           // local components, in initialization order
+	shutdownHooks []func()               // run after the components are shut down
+	listeners     map[string][]*Listener // drained before shutdown, by name
+	shutdownOnce  sync.Once              // runs the shutdown
+	shutdownDone  chan struct{}          // closed once shut down
+	calls         inflight               // calls being executed by the handlers
+	stopServing   func()                 // stops serving calls
+	stopOnSIGTERM bool                   // shut down on SIGTERM; see handleShutdown
+	exitOnStop    bool                   // exit once shut down on SIGTERM
+
+	configMu sync.Mutex        // guards sections and serializes config updates
+	sections map[string]string // latest config sections
 }
 
 type transport struct {
@@ -95,6 +130,17 @@ func newWeavelet(ctx context.Context, componentInfos []*codegen.Registration) (*
 		return nil, fmt.Errorf("unable to get weavelet information")
 	}
 
+	config, err := runtime.ParseWeaveletConfig(wletInfo.Sections)
+	if err != nil {
+		return nil, err
+	}
+	if err := metrics.OverrideBounds(config.Metrics.Buckets); err != nil {
+		return nil, fmt.Errorf("metrics config: %w", err)
+	}
+	if config.Metrics.MethodLabelSets > 0 {
+		codegen.SetMethodLabelSets(config.Metrics.MethodLabelSets)
+	}
+
 	exporter, err := env.CreateTraceExporter()
 	if err != nil {
 		return nil, fmt.Errorf("internal error: cannot create trace exporter: %w", err)
@@ -102,23 +148,64 @@ func newWeavelet(ctx context.Context, componentInfos []*codegen.Registration) (*
 
 	byName := make(map[string]*component, len(componentInfos))
 	byType := make(map[reflect.Type]*component, len(componentInfos))
+	ctx, stop := context.WithCancel(ctx)
+	// A weavelet started by an envelope, rather than by weavertest, is
+	// stopped by the envelope with SIGTERM. See envelope.Envelope.Stop.
+	_, remote := env.(*remoteEnv)
 	d := &weavelet{
 		ctx:              ctx,
+		stop:             stop,
+		stopOnSIGTERM:    remote && ctx.Value(runtime.BootstrapKey{}) == nil,
 		env:              env,
 		info:             wletInfo,
+		config:           config,
+		sections:         wletInfo.Sections,
 		componentsByName: byName,
 		componentsByType: byType,
 		unixClients:      map[string]*client{},
 		tcpClients:       map[string]*client{},
 		loads:            map[string]*loadCollector{},
+		listeners:        map[string][]*Listener{},
+		shutdownDone:     make(chan struct{}),
+		stopServing:      func() {},
 	}
+	auditLog := &auditLog{dir: config.Audit.Dir, info: wletInfo, logger: env.SystemLogger()}
+	d.onShutdown(auditLog.close)
+	recordingLog := &recordingLog{dir: config.Recording.Dir, info: wletInfo, logger: env.SystemLogger()}
+	d.onShutdown(recordingLog.close)
 	for _, info := range componentInfos {
+		settings, err := runtime.ParseComponentSettings(info.Name, info.Iface, wletInfo.Sections)
+		if err != nil {
+			return nil, err
+		}
+		if settings.Router != "" {
+			if err := codegen.SetRouter(info.Iface, settings.Router); err != nil {
+				return nil, fmt.Errorf("component %q: %w", info.Name, err)
+			}
+		}
 		c := &component{
-			wlet: d,
-			info: info,
+			wlet:     d,
+			info:     info,
+			settings: settings,
 			// may be remote, so start with no-op logger. May set real logger later.
 			logger: discardingLogger{},
 		}
+		c.acl = newACL(c, env.SystemLogger())
+		if len(settings.AuditedMethods) > 0 && config.Audit.Dir == "" {
+			return nil, fmt.Errorf("component %q: audited_methods requires an audit dir in the app config", info.Name)
+		}
+		c.audit = newAuditor(c, auditLog, env.SystemLogger())
+		c.record = newRecorder(c, recordingLog, env.SystemLogger())
+		if settings.Singleton && info.Routed {
+			return nil, fmt.Errorf("component %q: routed components cannot be singletons", info.Name)
+		}
+		if settings.Actors.Enabled && !info.Routed {
+			return nil, fmt.Errorf("component %q: only routed components can have actors", info.Name)
+		}
+		if !wletInfo.SingleProcess {
+			// A single process hosts a single replica of every component.
+			c.singleton = newSingleton(c)
+		}
 		byName[info.Name] = c
 		byType[info.Iface] = c
 	}
@@ -126,29 +213,68 @@ func newWeavelet(ctx context.Context, componentInfos []*codegen.Registration) (*
 	if !ok {
 		return nil, fmt.Errorf("internal error: no main component registered")
 	}
+	faults, err := faultsByComponent(ctx, byName)
+	if err != nil {
+		return nil, err
+	}
+	for name, fs := range faults {
+		byName[name].faults = fs
+	}
+	if fs, ok := ctx.Value(fakes.Key{}).(map[reflect.Type]any); ok {
+		for t := range fs {
+			if _, ok := byType[t]; !ok {
+				return nil, fmt.Errorf("fake for unknown component %v", t)
+			}
+		}
+		d.fakes = fs
+	}
+	d.serialize, _ = ctx.Value(bench.Key{}).(bool)
+	if r, ok := ctx.Value(replay.Key{}).(*replay.Replayer); ok {
+		c, ok := byName[r.Component]
+		if !ok {
+			return nil, fmt.Errorf("replay of unknown component %q", r.Component)
+		}
+		d.replayer = r
+		r.Call = func(ctx context.Context, method string, args []byte) ([]byte, error) {
+			if _, ok := c.info.Iface.MethodByName(method); !ok {
+				return nil, fmt.Errorf("replay of unknown method %q of component %q", method, c.info.Name)
+			}
+			impl, err := d.getImpl(c)
+			if err != nil {
+				return nil, err
+			}
+			return impl.serverStub.GetStubFn(method)(ctx, args)
+		}
+	}
 	main.impl = &componentImpl{component: main}
 
 	// Place components into colocation groups and OS processes.
 	if err := place(byName, wletInfo); err != nil {
 		return nil, err
 	}
+	if nf := wletInfo.NetworkFaults; nf != nil {
+		for _, c := range byName {
+			if c.colocGroupName != wletInfo.Group.Name {
+				c.faults = append(c.faults, networkFaults(c.info.Name, nf)...)
+			}
+		}
+	}
 
-	const instrumentationLibrary = "github.com/ServiceWeaver/weaver/serviceweaver"
-	const instrumentationVersion = "0.0.1"
+	// The resource is shared by traces and metrics exported over OTLP, so
+	// that the two can be correlated.
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(fmt.Sprintf("serviceweaver/%s/%s", wletInfo.Process, wletInfo.Id[:4])),
+		semconv.ProcessPIDKey.Int(os.Getpid()),
+		traceio.AppNameTraceKey.String(wletInfo.App),
+		traceio.VersionTraceKey.String(wletInfo.DeploymentId),
+		traceio.ColocationGroupNameTraceKey.String(wletInfo.Group.Name),
+		traceio.GroupReplicaIDTraceKey.String(wletInfo.GroupId),
+	)
 	tracerProvider := sdktrace.NewTracerProvider(
 		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(fmt.Sprintf("serviceweaver/%s/%s", wletInfo.Process, wletInfo.Id[:4])),
-			semconv.ProcessPIDKey.Int(os.Getpid()),
-			traceio.AppNameTraceKey.String(wletInfo.App),
-			traceio.VersionTraceKey.String(wletInfo.DeploymentId),
-			traceio.ColocationGroupNameTraceKey.String(wletInfo.Group.Name),
-			traceio.GroupReplicaIDTraceKey.String(wletInfo.GroupId),
-		)),
-		// TODO(spetrovic): Allow the user to create new TracerProviders where
-		// they can control trace sampling and other options.
-		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())))
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(newTraceSampler(config.Tracing, byName)))
 	tracer := tracerProvider.Tracer(instrumentationLibrary, trace.WithInstrumentationVersion(instrumentationVersion))
 
 	// Set global tracing defaults.
@@ -186,9 +312,53 @@ func newWeavelet(ctx context.Context, componentInfos []*codegen.Registration) (*
 		},
 	}
 
+	// Secure the inter-colocation-group communication with mutual TLS, if
+	// configured. The intra-colocation-group communication uses Unix
+	// sockets and never leaves the machine.
+	if config.TLS.Enabled() {
+		certs, err := newCertLoader(ctx, config.TLS, env.SystemLogger())
+		if err != nil {
+			return nil, err
+		}
+		externalTransport.clientOpts.TLSConfig = certs.clientConfig()
+		externalTransport.serverOpts.TLSConfig = certs.serverConfig()
+
+		var local []string
+		for _, c := range byName {
+			if c.colocGroupName == wletInfo.Group.Name {
+				local = append(local, c.info.Name)
+			}
+		}
+		d.auth = newAuthenticator(config.TLS, local)
+	}
+
+	// Compress the large calls between colocation groups, if configured.
+	if config.Compression.Algorithm != "" {
+		compressor := call.Snappy
+		if config.Compression.Algorithm == runtime.ZstdCompression {
+			compressor = call.Zstd
+		}
+		threshold := config.Compression.Threshold
+		if threshold == 0 {
+			threshold = runtime.DefaultCompressionThreshold
+		}
+		externalTransport.clientOpts.Compression = compressor
+		externalTransport.clientOpts.CompressionThreshold = threshold
+		externalTransport.serverOpts.Compression = compressor
+		externalTransport.serverOpts.CompressionThreshold = threshold
+	}
+
+	// Carry the inter-colocation-group connections inside gRPC streams, if
+	// configured.
+	if config.Transport == runtime.GRPCTransport {
+		externalTransport.clientOpts.Transport = call.GRPC()
+		externalTransport.serverOpts.Transport = call.GRPC()
+	}
+
 	d.internalTransport = internalTransport
 	d.externalTransport = externalTransport
 	d.tracer = tracer
+	d.resource = res
 	main.tracer = tracer
 	d.root = main
 
@@ -198,17 +368,59 @@ func newWeavelet(ctx context.Context, componentInfos []*codegen.Registration) (*
 // start starts a weavelet, executing the logic to start and manage components.
 // If Start fails, it returns a non-nil error.
 // Otherwise, if this process hosts "main", start returns the main component.
-// Otherwise, Start never returns.
+// Otherwise, Start returns nil once the weavelet's context is canceled and
+// the weavelet is shut down.
 func (d *weavelet) start() (Instance, error) {
+	d.handleShutdown()
+
 	// Launch status server for single process deployments.
 	if single, ok := d.env.(*singleprocessEnv); ok {
 		go func() {
-			if err := single.serveStatus(d.ctx); err != nil {
+			if err := single.serveStatus(d.ctx, d.onShutdown); err != nil {
 				single.SystemLogger().Error("status server", err)
 			}
 		}()
 	}
 
+	// Apply config updates pushed by the environment.
+	d.env.OnConfigUpdate(d.updateConfig)
+
+	// Launch the OTLP metrics exporter, if configured.
+	if d.config.OTLP.Enabled() {
+		go func() {
+			if err := d.exportOTLPMetrics(); err != nil {
+				d.env.SystemLogger().Error("otlp metrics exporter", err)
+			}
+		}()
+	}
+
+	// Launch the StatsD metrics exporter, if configured.
+	if d.config.StatsD.Enabled() {
+		go func() {
+			if err := d.exportStatsDMetrics(); err != nil {
+				d.env.SystemLogger().Error("statsd metrics exporter", err)
+			}
+		}()
+	}
+
+	// Launch continuous profiling, if configured.
+	if d.config.Profiling.Enabled() {
+		go func() {
+			if err := d.runProfiling(); err != nil {
+				d.env.SystemLogger().Error("profiling", err)
+			}
+		}()
+	}
+
+	// Launch the Prometheus endpoint, if configured.
+	if d.config.Prometheus.Enabled() {
+		go func() {
+			if err := d.servePrometheus(); err != nil {
+				d.env.SystemLogger().Error("prometheus server", err)
+			}
+		}()
+	}
+
 	// Create handlers for all of the components served by this process. Note that
 	// the components themselves may not be started, but we still register their
 	// handlers because we want to avoid concurrency issues with on-demand
@@ -224,11 +436,14 @@ func (d *weavelet) start() (Instance, error) {
 	handlers.Set("", "ready", func(context.Context, []byte) ([]byte, error) {
 		return nil, nil
 	})
+	// Add a handler for the batches of calls sent by batching clients.
+	handlers.Set("", "batch", serveBatch(handlers))
 
 	isMain := d.info.Process == "main"
 	if isMain {
 		// Set appropriate logger and tracer for main.
-		logSaver := d.env.CreateLogSaver(d.ctx, "main")
+		logSaver := limitLogs(d.root.info.Name, d.root.settings.Logging,
+			withLogHandler(d.env.CreateLogSaver(d.ctx, "main")))
 		d.root.logger = newAttrLogger(
 			d.root.info.Name, d.info.DeploymentId, d.root.info.Name, d.info.Id, logSaver)
 	}
@@ -238,7 +453,9 @@ func (d *weavelet) start() (Instance, error) {
 	//    * One server for method invocations from weavelets that are in the
 	//      same colocation group as this weavelet, and
 	//    * One server for method invocations from weavelets that are in
-	//      different colocation groups than this weavelet.
+	//      different colocation groups than this weavelet. This server
+	//      listens on both TCP and a Unix socket; weavelets on the same
+	//      machine use the latter.
 	// For a singleprocess deployment, no servers are launched because all
 	// method invocations are process-local and executed as regular go function
 	// calls.
@@ -270,8 +487,26 @@ func (d *weavelet) start() (Instance, error) {
 		if err != nil {
 			return nil, fmt.Errorf("error creating external listener: %w", err)
 		}
+		if locality := os.Getenv(runtime.LocalityKey); locality != "" {
+			// Advertise our locality to callers, along with our address.
+			externalDialAddr += call.NetworkAddress("#" + locality)
+		}
 		d.externalDialAddr = externalDialAddr
 
+		// Also serve the external traffic on a Unix socket, which weavelets
+		// in other colocation groups on this machine use instead of the
+		// loopback TCP stack. This is only an optimization; if it fails,
+		// those weavelets fall back to TCP. With mutual TLS, the socket isn't
+		// used, since its clients couldn't be authenticated, and neither is
+		// it with the gRPC transport, which the socket doesn't carry.
+		var hostLis net.Listener
+		if d.auth == nil && d.externalTransport.serverOpts.Transport == nil {
+			hostLis, err = d.listenHostSocket(externalLis.Addr())
+			if err != nil {
+				d.env.SystemLogger().Error("cannot listen on host socket", err)
+			}
+		}
+
 		for _, c := range d.componentsByName {
 			if d.inLocalProcess(c) && c.info.Routed {
 				// TODO(rgrandl): In the future, we may want to collect load for all components.
@@ -280,7 +515,7 @@ func (d *weavelet) start() (Instance, error) {
 		}
 
 		// Monitor our routing assignment.
-		routelet := newRoutelet(d.ctx, d.env, d.info.Process)
+		routelet := newRoutelet(d.ctx, d.env, d.info.Process, d.sockets)
 		routelet.onChange(func(info *protos.RoutingInfo) {
 			if err := d.onNewRoutingInfo(info); err != nil {
 				fmt.Fprintln(os.Stderr, err)
@@ -307,14 +542,19 @@ func (d *weavelet) start() (Instance, error) {
 			return nil, err
 		}
 
+		// Serve calls until the weavelet shuts down, which stops serving once
+		// the calls being executed finish, rather than when d.ctx is
+		// canceled.
+		serveCtx, stopServing := context.WithCancel(context.Background())
+		d.stopServing = stopServing
 		serve := func(lis net.Listener, transport *transport) {
 			if lis == nil || transport == nil {
 				return
 			}
 
-			// Arrange to close the listener when we are canceled.
+			// Arrange to close the listener when we stop serving.
 			go func() {
-				<-d.ctx.Done()
+				<-serveCtx.Done()
 				lis.Close()
 			}()
 
@@ -324,12 +564,13 @@ func (d *weavelet) start() (Instance, error) {
 			//     which can cause unnecessary serving delays for this process, and
 			//  2. Get() may assign a random unused port to the component, which may
 			//     conflict with the port used by the transport.
-			startWork(d.ctx, "handle calls", func() error {
-				return call.Serve(d.ctx, lis, handlers, transport.serverOpts)
+			startWork(serveCtx, "handle calls", func() error {
+				return call.Serve(serveCtx, lis, handlers, transport.serverOpts)
 			})
 		}
 		serve(internalLis, d.internalTransport)
 		serve(externalLis, d.externalTransport)
+		serve(hostLis, d.externalTransport)
 	}
 
 	d.logRolodexCard()
@@ -357,8 +598,20 @@ func (d *weavelet) start() (Instance, error) {
 		return d.root.impl, nil
 	}
 
-	// Not the main-process. Run forever, or until there is an error.
-	return nil, d.watchComponentsToStart()
+	// Not the main-process. Run until we are canceled, or until there is an
+	// error. The envelope may never reply to a pending request for the
+	// components to start, so we don't wait for it once we are canceled.
+	errs := make(chan error, 1)
+	go func() { errs <- d.watchComponentsToStart() }()
+	select {
+	case err := <-errs:
+		if err != nil && d.ctx.Err() == nil {
+			return nil, err
+		}
+	case <-d.ctx.Done():
+	}
+	d.shutdown()
+	return nil, nil
 }
 
 // logRolodexCard pretty prints a card that includes basic information about
@@ -435,16 +688,34 @@ func (d *weavelet) getInstance(c *component, requester string) (interface{}, err
 	// reason is that A's call may get routed to an instance of B in a
 	// different colocation group.
 
+	if fake, ok := d.fakes[c.info.Iface]; ok {
+		return fake, nil
+	}
+
+	if d.replayer != nil && requester == d.replayer.Component && c.info.Name != requester {
+		// The calls of the component under test to other components are
+		// answered from the recording.
+		stub := &stub{
+			client:  newReplayConnection(c, d.replayer),
+			methods: methodKeys(c),
+			tracer:  d.tracer,
+		}
+		return c.info.ClientStubFn(stub, requester), nil
+	}
+
 	var local bool // should we perform local, in-process communication?
 	switch {
 	case d.info.SingleProcess:
 		local = true
-	case c.info.Routed:
+	case c.info.Routed, c.singleton != nil:
 		// TODO(mwhittaker): If the instance of the component that the slice
 		// routes us to is in the same process as us, we can use local
 		// communication. If it's in the same colocation group, we can use
 		// unix communication. Thus, we could pick a transport an a per-call
 		// basis, rather than a per-component basis.
+		//
+		// Similarly, the calls to a singleton component go to its active
+		// replica, which may be in a different colocation group.
 		local = false
 	default:
 		local = d.inLocalProcess(c)
@@ -455,13 +726,48 @@ func (d *weavelet) getInstance(c *component, requester string) (interface{}, err
 		if err != nil {
 			return nil, err
 		}
-		return c.info.LocalStubFn(impl.impl, impl.component.tracer), nil
+		policies := methodPolicies(c)
+		for i := range policies {
+			// There is no other replica to hedge local calls with.
+			policies[i].hedging = nil
+		}
+		denied := c.acl != nil && !c.acl.allows(callerKey(requester))
+		if !denied && !d.serialize && c.audit == nil && c.record == nil && !c.settings.Actors.Enabled && !appliesLocally(policies) {
+			return c.info.LocalStubFn(impl.impl, impl.component.tracer), nil
+		}
+		// Local calls are regular go function calls, which can't be
+		// interrupted. To enforce the call policies (e.g., method
+		// timeouts), fail the calls of callers that aren't allowed to call
+		// the component, audit or record the calls, dispatch them to
+		// actors, and measure the cost of serialization, make the calls
+		// through the client and server stubs instead.
+		stub := &stub{
+			client:   newLocalConnection(c, impl),
+			methods:  methodKeys(c),
+			tracer:   impl.component.tracer,
+			policies: policies,
+			caller:   callerKey(requester),
+			audit:    c.audit,
+			record:   c.record,
+		}
+		if denied {
+			stub.acl = c.acl
+		}
+		return c.info.ClientStubFn(stub, requester), nil
 	}
 
 	stub, err := d.getStub(c)
 	if err != nil {
 		return nil, err
 	}
+	if c.acl != nil || c.audit != nil || c.record != nil || keysByCaller(c) {
+		// Identify the requester to the component, which authorizes,
+		// audits, or records its calls, or rate limits the calls of every
+		// caller separately.
+		withCaller := *stub.stub
+		withCaller.caller = callerKey(requester)
+		return c.info.ClientStubFn(&withCaller, requester), nil
+	}
 	return c.info.ClientStubFn(stub.stub, requester), nil
 }
 
@@ -478,7 +784,8 @@ func (d *weavelet) getListener(name string, opts ListenerOptions) (*Listener, er
 	}
 
 	// Listen on the address.
-	l, err := net.Listen("tcp", addr.Address)
+	conns := newConnTracker()
+	l, err := listen(d.ctx, addr.Address, d.config.Listeners[name], conns)
 	if err != nil {
 		return nil, fmt.Errorf("getListener(%q): %w", name, err)
 	}
@@ -497,7 +804,48 @@ func (d *weavelet) getListener(name string, opts ListenerOptions) (*Listener, er
 	if reply.Error != "" {
 		return nil, fmt.Errorf("getListener(%q): %s", name, reply.Error)
 	}
-	return &Listener{Listener: l, proxyAddr: reply.ProxyAddress}, nil
+	result := &Listener{Listener: l, proxyAddr: reply.ProxyAddress, conns: conns}
+	d.shutdownMu.Lock()
+	d.listeners[name] = append(d.listeners[name], result)
+	d.shutdownMu.Unlock()
+	return result, nil
+}
+
+// getPacketListener returns a UDP listener with the given name.
+func (d *weavelet) getPacketListener(name string, opts ListenerOptions) (*PacketListener, error) {
+	if name == "" {
+		return nil, fmt.Errorf("getPacketListener(%q): empty listener name", name)
+	}
+
+	// Get the address to listen on.
+	addr, err := d.env.GetAddress(d.ctx, name, opts)
+	if err != nil {
+		return nil, fmt.Errorf("getPacketListener(%q): %w", name, err)
+	}
+
+	// Listen on the address.
+	conn, err := net.ListenPacket("udp", addr.Address)
+	if err != nil {
+		return nil, fmt.Errorf("getPacketListener(%q): %w", name, err)
+	}
+
+	// Export the listener.
+	lis := &protos.Listener{Name: name, Addr: conn.LocalAddr().String(), Network: "udp"}
+	errMsg := fmt.Sprintf("getPacketListener(%q): error exporting listener %v", name, lis.Addr)
+	var reply *protos.ExportListenerReply
+	if err := d.repeatedly(errMsg, func() error {
+		var err error
+		reply, err = d.env.ExportListener(d.ctx, lis, opts)
+		return err
+	}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if reply.Error != "" {
+		conn.Close()
+		return nil, fmt.Errorf("getPacketListener(%q): %s", name, reply.Error)
+	}
+	return &PacketListener{PacketConn: conn, proxyAddr: reply.ProxyAddress}, nil
 }
 
 // inLocalColocGroup returns whether the component is hosted in the same colocation
@@ -528,12 +876,9 @@ func numProcsIn(group *protos.ColocationGroup, components map[string]*component)
 // hosting the given Service Weaver process; the returned address must be dialable from
 // all weavelets in the same colocation group instance as us.
 func (d *weavelet) internalAddress(proc string) (string, error) {
-	dir := d.info.NetworkStorageDir
-	if dir == "" {
-		dir = filepath.Join(os.TempDir(), "serviceweaver", "network")
-	}
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", fmt.Errorf("cannot create network storage directory %q: %w", dir, err)
+	dir, err := d.networkDir()
+	if err != nil {
+		return "", err
 	}
 	return filepath.Join(dir, fmt.Sprintf("%s.%s.%s.proc%s",
 		d.info.App,
@@ -543,14 +888,103 @@ func (d *weavelet) internalAddress(proc string) (string, error) {
 	)), nil
 }
 
+// listenHostSocket listens on the Unix socket through which weavelets on this
+// machine can reach the external listener with the provided address, and
+// records the sockets of this machine in d.sockets.
+func (d *weavelet) listenHostSocket(addr net.Addr) (net.Listener, error) {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, err
+	}
+	dir, err := d.networkDir()
+	if err != nil {
+		return nil, err
+	}
+	sockets := hostSockets{
+		host:   host,
+		dir:    dir,
+		prefix: fmt.Sprintf("%s.%s", d.info.App, d.info.DeploymentId[:8]),
+	}
+
+	// A weavelet that previously listened on the same port may have left its
+	// socket behind.
+	path := sockets.path(port)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	lis, _, err := d.listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	d.sockets = sockets
+	return lis, nil
+}
+
+// networkDir returns the directory that holds the Unix sockets of this
+// weavelet, creating it if needed.
+func (d *weavelet) networkDir() (string, error) {
+	dir := d.info.NetworkStorageDir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "serviceweaver", "network")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("cannot create network storage directory %q: %w", dir, err)
+	}
+	return dir, nil
+}
+
 // addHandlers registers a component's methods as handlers in stub.HandlerMap.
 // Specifically, for every method m in the component, we register a function f
 // that (1) creates the local component if it hasn't been created yet and (2)
 // calls m.
 func (d *weavelet) addHandlers(handlers *call.HandlerMap, c *component) {
+	limit := newMessageLimit(c, d.config.MaxMessageSize)
+	limiter := newConcurrencyLimiter(c.info.Name, c.settings.Concurrency)
+	rateLimiters := newRateLimiters(c)
 	for i, n := 0, c.info.Iface.NumMethod(); i < n; i++ {
+		i := i
 		mname := c.info.Iface.Method(i).Name
 		handler := func(ctx context.Context, args []byte) (res []byte, err error) {
+			if !d.calls.start() {
+				return nil, errShuttingDown
+			}
+			defer d.calls.end()
+			if c.record != nil {
+				start := time.Now()
+				defer func() {
+					c.record.record(i, call.Caller(ctx), call.ShardKey(ctx), start, args, res, err)
+				}()
+			}
+			if c.audit != nil {
+				defer func() {
+					c.audit.record(i, call.Caller(ctx), call.ShardKey(ctx), err)
+				}()
+			}
+			if c.acl != nil {
+				if err := c.acl.checkRemote(ctx, i, d.auth); err != nil {
+					return nil, err
+				}
+			}
+			defer func() {
+				// Fail calls with oversized results, which the client would
+				// reject, closing the connection.
+				if err == nil {
+					if err = limit.check(i, len(res)); err != nil {
+						res = nil
+					}
+				}
+			}()
+			if rateLimiters != nil && rateLimiters[i] != nil {
+				if err := rateLimiters[i].allow(rateLimiters[i].keyOf(ctx)); err != nil {
+					return nil, err
+				}
+			}
+			if limiter != nil {
+				if err := limiter.acquire(ctx); err != nil {
+					return nil, err
+				}
+				defer limiter.release()
+			}
 			// This handler is supposed to invoke the method named mname on the
 			// local component. However, it is possible that the component has not
 			// yet been started (e.g., the start command was issued but hasn't
@@ -562,6 +996,14 @@ func (d *weavelet) addHandlers(handlers *call.HandlerMap, c *component) {
 				return nil, err
 			}
 			fn := impl.serverStub.GetStubFn(mname)
+			if d.config.Profiling.Enabled() {
+				// Label the call, so that the profiles of a process hosting
+				// many components can be broken down by component.
+				pprof.Do(ctx, pprof.Labels("component", c.info.Name), func(ctx context.Context) {
+					res, err = fn(ctx, args)
+				})
+				return res, err
+			}
 			return fn(ctx, args)
 		}
 		handlers.Set(c.info.Name, mname, handler)
@@ -588,6 +1030,12 @@ func (d *weavelet) watchComponentsToStart() error {
 			if err != nil {
 				return err
 			}
+			if c.singleton != nil {
+				// The component is initialized if and once this replica
+				// is elected its active replica.
+				d.startSingleton(c)
+				continue
+			}
 			if _, err = d.getImpl(c); err != nil {
 				return err
 			}
@@ -686,6 +1134,11 @@ func (d *weavelet) getImpl(c *component) (*componentImpl, error) {
 	if !d.inLocalProcess(c) {
 		return nil, fmt.Errorf("component %q is not local", c.info.Name)
 	}
+	if c.singleton != nil {
+		if err := c.singleton.checkActive(c.info.Name); err != nil {
+			return nil, err
+		}
+	}
 
 	init := func(c *component) error {
 		if err := d.env.RegisterComponentToStart(d.ctx, d.info.Process, d.info.Group.Name, c.info.Name, c.info.Routed); err != nil {
@@ -699,23 +1152,48 @@ func (d *weavelet) getImpl(c *component) (*componentImpl, error) {
 		// component is still being constructed is easy to get wrong. Figure out a
 		// way to make this less error-prone.
 		c.impl = &componentImpl{component: c}
-		logSaver := d.env.CreateLogSaver(d.ctx, c.info.Name)
+		logSaver := limitLogs(c.info.Name, c.settings.Logging,
+			withLogHandler(d.env.CreateLogSaver(d.ctx, c.info.Name)))
 		logger := newAttrLogger(d.info.App, d.info.DeploymentId, c.info.Name, d.info.Id, logSaver)
 		c.logger = logger
 		c.tracer = d.tracer
 
+		load := func(key uint64, v float64) {
+			// Note that there is no load collector for calls made in a
+			// single process, which may reach the server stub via a
+			// localConnection.
+			if lc := d.loads[c.info.Name]; c.info.Routed && lc != nil {
+				if err := lc.add(key, v); err != nil {
+					logger.Error("add load", err, "component", c.info.Name, "key", key)
+				}
+			}
+		}
+		if c.settings.Actors.Enabled {
+			// The component's instances, one per routing key, are created
+			// on demand by the actor pool, which stands in for the
+			// component's implementation and server stub.
+			actors := newActorPool(d.ctx, c, load)
+			c.impl.impl, c.impl.serverStub = actors, actors
+			d.shutdownMu.Lock()
+			d.initialized = append(d.initialized, c)
+			d.shutdownMu.Unlock()
+			return nil
+		}
+
 		d.env.SystemLogger().Debug("Constructing component", "component", c.info.Name)
 		if err := createComponent(d.ctx, c); err != nil {
 			return err
 		}
-
-		c.impl.serverStub = c.info.ServerStubFn(c.impl.impl, func(key uint64, v float64) {
-			if c.info.Routed {
-				if err := d.loads[c.info.Name].add(key, v); err != nil {
-					logger.Error("add load", err, "component", c.info.Name, "key", key)
-				}
+		d.shutdownMu.Lock()
+		d.initialized = append(d.initialized, c)
+		d.shutdownMu.Unlock()
+		if s, ok := c.impl.impl.(stateful); ok && c.settings.SnapshotInterval > 0 {
+			if file := d.snapshotFile(c, 0); file != "" {
+				go d.snapshotPeriodically(c, s, file)
 			}
-		})
+		}
+
+		c.impl.serverStub = c.info.ServerStubFn(c.impl.impl, load)
 		return nil
 	}
 	c.implInit.Do(func() { c.implErr = init(c) })
@@ -723,31 +1201,53 @@ func (d *weavelet) getImpl(c *component) (*componentImpl, error) {
 }
 
 func createComponent(ctx context.Context, c *component) error {
+	obj, err := newImplementation(ctx, c, c.wlet.snapshotFile(c, 0))
+	if err != nil {
+		return err
+	}
+	c.impl.impl = obj
+	return nil
+}
+
+// newImplementation creates and initializes a new implementation object of
+// the provided component. If the component is stateful, the object restores
+// the snapshot stored in the provided file, if any, before it is initialized.
+func newImplementation(ctx context.Context, c *component, snapshot string) (any, error) {
 	// Create the implementation object.
 	obj := c.info.New()
 
 	if c.info.ConfigFn != nil {
 		cfg := c.info.ConfigFn(obj)
-		if err := runtime.ParseConfigSection(c.info.Name, "", c.wlet.info.Sections, cfg); err != nil {
-			return err
+		if err := runtime.ParseComponentConfigSection(c.info.Name, c.wlet.getSections(), cfg); err != nil {
+			return nil, err
+		}
+		if err := resolveSecrets(ctx, cfg); err != nil {
+			return nil, fmt.Errorf("component %q config: %w", c.info.Name, err)
 		}
 	}
 
 	// Set obj.Implements.component to c.
 	if i, ok := obj.(interface{ setInstance(*componentImpl) }); !ok {
-		return fmt.Errorf("component %q: type %T is not a component implementation", c.info.Name, obj)
+		return nil, fmt.Errorf("component %q: type %T is not a component implementation", c.info.Name, obj)
 	} else {
 		i.setInstance(c.impl)
 	}
 
+	// Restore the latest snapshot, if any. A snapshot that can't be restored
+	// is skipped, and the state is rebuilt from scratch.
+	if s, ok := obj.(stateful); ok && snapshot != "" {
+		if err := restoreSnapshot(ctx, s, snapshot); err != nil {
+			c.logger.Error("Restoring snapshot failed", err, "file", snapshot)
+		}
+	}
+
 	// Call Init if available.
 	if i, ok := obj.(interface{ Init(context.Context) error }); ok {
 		if err := i.Init(ctx); err != nil {
-			return fmt.Errorf("component %q initialization failed: %w", c.info.Name, err)
+			return nil, fmt.Errorf("component %q initialization failed: %w", c.info.Name, err)
 		}
 	}
-	c.impl.impl = obj
-	return nil
+	return obj, nil
 }
 
 func (d *weavelet) repeatedly(errMsg string, f func() error) error {
@@ -791,24 +1291,34 @@ func (d *weavelet) getStub(c *component) (*componentStub, error) {
 			return err
 		}
 
-		// Construct the keys for the methods.
-		n := c.info.Iface.NumMethod()
-		methods := make([]call.MethodKey, n)
-		for i := 0; i < n; i++ {
-			mname := c.info.Iface.Method(i).Name
-			methods[i] = call.MakeMethodKey(c.info.Name, mname)
-		}
-
 		var balancer call.Balancer
-		if c.info.Routed {
+		switch {
+		case c.info.Routed:
 			balancer = client.routelet.balancer(c.info.Name)
+		case c.singleton != nil:
+			d.watchSingleton(c)
+			balancer = &activeBalancer{singleton: c.singleton}
+			if err := waitUntilActive(d.ctx, client.client, balancer); err != nil {
+				return err
+			}
+		default:
+			balancer = newBalancer(c)
+		}
+		mirror, err := d.getMirror(c)
+		if err != nil {
+			return err
 		}
 		c.stub = &componentStub{
 			stub: &stub{
 				client:   client.client,
-				methods:  methods,
+				methods:  methodKeys(c),
 				balancer: balancer,
 				tracer:   d.tracer,
+				policies: methodPolicies(c),
+				breaker:  newBreaker(c.info.Name, c.settings.CircuitBreaker),
+				mirror:   mirror,
+				batcher:  newBatcher(c.info.Name, client.client, c.settings.Batching),
+				limit:    newMessageLimit(c, d.config.MaxMessageSize),
 			},
 		}
 		return nil
@@ -817,6 +1327,25 @@ func (d *weavelet) getStub(c *component) (*componentStub, error) {
 	return c.stub, c.stubErr
 }
 
+// getMirror returns a mirror of the calls to the provided component to the
+// component's replicas in a shadow deployment, or nil if the component's
+// calls are not mirrored.
+func (d *weavelet) getMirror(c *component) (*mirror, error) {
+	if c.settings.Mirror.Fraction == 0 {
+		return nil, nil
+	}
+	routelet := newRoutelet(d.ctx, d.env, runtime.ShadowRoutingKey(c.info.Name), d.sockets)
+	client, err := call.Connect(d.ctx, routelet.resolver(), d.externalTransport.clientOpts)
+	if err != nil {
+		return nil, err
+	}
+	var balancer call.Balancer
+	if c.info.Routed {
+		balancer = routelet.balancer(c.info.Name)
+	}
+	return newMirror(d.ctx, c.info.Name, client, balancer, c.settings.Mirror.Fraction), nil
+}
+
 func waitUntilReady(ctx context.Context, client call.Connection) error {
 	for r := retry.Begin(); r.Continue(ctx); {
 		_, err := client.Call(ctx, readyMethodKey, nil, call.CallOptions{})
@@ -830,9 +1359,10 @@ func waitUntilReady(ctx context.Context, client call.Connection) error {
 // getClient returns a cached client connection to the specified component, or
 // creates a new connection if one doesn't already exist.
 func (d *weavelet) getClient(c *component) (*client, error) {
-	// If c is unrouted and in the same colocation group, we can use unix
-	// sockets. Otherwise, we use TCP. See getInstance for details.
-	if !c.info.Routed && d.inLocalColocGroup(c) {
+	// If c is unrouted, not a singleton, and in the same colocation group, we
+	// can use unix sockets. Otherwise, we use TCP. See getInstance for
+	// details.
+	if !c.info.Routed && c.singleton == nil && d.inLocalColocGroup(c) {
 		return d.getUnixClient(c)
 	}
 	return d.getTCPClient(c)
@@ -884,7 +1414,7 @@ func (d *weavelet) getTCPClient(component *component) (*client, error) {
 
 	// Initialize (or wait for initialization to complete.)
 	c.init.Do(func() {
-		routelet := newRoutelet(d.ctx, d.env, component.processName)
+		routelet := newRoutelet(d.ctx, d.env, component.processName, d.sockets)
 		c.routelet = routelet
 		c.client, c.err = call.Connect(d.ctx, routelet.resolver(), d.externalTransport.clientOpts)
 		if c.err != nil {
@@ -31,8 +31,13 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/ServiceWeaver/weaver/runtime"
 	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/logging"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -57,6 +62,57 @@ import (
 //	}
 var ErrRetriable = errors.New("retriable")
 
+// ErrCircuitOpen indicates a component method call was not made because the
+// circuit breaker for the component is open. See the circuit_breaker setting
+// in the documentation of component configs.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// ErrOverloaded indicates a component method call was not executed because
+// the replica that received it was already executing, and queueing, as many
+// calls as it is allowed to. See the concurrency setting in the documentation
+// of component configs.
+var ErrOverloaded = errors.New("overloaded")
+
+// ErrRateLimited indicates a component method call was not executed because
+// it exceeded the rate limit of the method. See the method_rate_limits setting
+// in the documentation of component configs.
+var ErrRateLimited = errors.New("rate limited")
+
+// ErrPermissionDenied indicates a component method call was not executed
+// because the calling component is not allowed to call the component. See the
+// allowed_callers setting in the documentation of component configs.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// ErrMessageTooLarge indicates a component method call failed because its
+// serialized arguments, or results, were larger than the maximum message size.
+// See the max_message_size setting in the documentation of component configs.
+// The call is rejected before the oversized message is sent, so it never
+// reaches the component if its arguments are too large.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// MessageTooLargeError is the error returned by a component method call whose
+// serialized arguments are larger than the maximum message size. If err is a
+// MessageTooLargeError, then errors.Is(err, ErrMessageTooLarge) is true. Calls
+// whose results are too large fail with an error that only satisfies
+// errors.Is(err, ErrMessageTooLarge), since the error is returned by a
+// different process.
+type MessageTooLargeError struct {
+	Component string // full component name
+	Method    string // component method
+	Size      int    // size of the serialized message, in bytes
+	Limit     int    // maximum message size, in bytes
+}
+
+// Error implements the error interface.
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("%s.%s: %d byte message larger than the maximum of %d bytes", logging.ShortenComponent(e.Component), e.Method, e.Size, e.Limit)
+}
+
+// Unwrap makes MessageTooLargeError compatible with errors.Is.
+func (e *MessageTooLargeError) Unwrap() error {
+	return ErrMessageTooLarge
+}
+
 // mainIface is an empty interface "implemented" by the user main function,
 // allowing us to treat the user main as a regular Service Weaver component in the
 // implementation.
@@ -93,21 +149,94 @@ func init() {
 //
 // If this process is not hosting the "main" component, Init will never return and will
 // just serve requests directed at the components being hosted inside the process.
+// Once ctx is canceled and the process is shut down, Init exits the process
+// with status 0. Use [weaver.Run] to have control returned instead.
+//
+// The process is shut down gracefully when ctx is canceled, or when its
+// deployer stops it; see [weaver.Run]. A process stopped by its deployer
+// exits with status 0 once it is shut down.
 func Init(ctx context.Context) Instance {
+	printComponentsIfRequested()
 	root, err := initInternal(ctx)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, fmt.Errorf("error initializing Service Weaver: %w", err))
 		os.Exit(1)
 	}
+	if root == nil {
+		// This process doesn't host the main component, and was shut down.
+		os.Exit(0)
+	}
 	return root
 }
 
+// Run is like Init, but it calls app with the main component, rather than
+// returning it, and returns once the process is shut down. For example:
+//
+//	func main() {
+//	    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+//	    defer stop()
+//	    if err := weaver.Run(ctx, serve); err != nil {
+//	        log.Fatal(err)
+//	    }
+//	}
+//
+// In the process that hosts the main component, Run calls app, and shuts the
+// process down once app returns, returning app's error. In the other
+// processes, Run serves the calls to the hosted components until ctx is
+// canceled, and then shuts the process down and returns nil.
+//
+// A process is shut down gracefully: the listeners are drained, the calls
+// being executed are allowed to finish while new calls are rejected with an
+// error that wraps ErrRetriable, and then the Shutdown methods of the
+// components are called. The process is also shut down when ctx is canceled,
+// so app should return once the context it is passed is canceled. Service
+// Weaver doesn't handle the signals of an application run locally; cancel ctx
+// on SIGINT or SIGTERM, as above, to shut down gracefully when the process is
+// stopped. A process started by a deployer is stopped by the deployer, which
+// sends it SIGTERM: the process cancels the context passed to app, shuts down
+// gracefully, and Run returns.
+func Run(ctx context.Context, app func(context.Context, Instance) error) error {
+	printComponentsIfRequested()
+	wlet, err := newWeavelet(ctx, codegen.Registered())
+	if err != nil {
+		return fmt.Errorf("internal error creating weavelet: %w", err)
+	}
+	defer wlet.shutdown()
+	root, err := wlet.start()
+	if err != nil || root == nil {
+		return err
+	}
+	return app(wlet.ctx, root)
+}
+
+// printComponentsIfRequested prints the registered components, and exits, if
+// the process was started by a tool that only wants to list them.
+func printComponentsIfRequested() {
+	if os.Getenv(runtime.ListComponentsKey) != "" {
+		for _, reg := range codegen.Registered() {
+			fmt.Println(reg.Name)
+		}
+		os.Exit(0)
+	}
+	if os.Getenv(runtime.ComponentGraphKey) != "" {
+		var names []string
+		for _, reg := range codegen.Registered() {
+			names = append(names, reg.Name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(strings.Join(append([]string{name}, codegen.Refs(name)...), "\t"))
+		}
+		os.Exit(0)
+	}
+}
+
 func initInternal(ctx context.Context) (Instance, error) {
 	wlet, err := newWeavelet(ctx, codegen.Registered())
 	if err != nil {
 		return nil, fmt.Errorf("internal error creating weavelet: %w", err)
 	}
-
+	wlet.exitOnStop = true
 	return wlet.start()
 }
 
@@ -142,3 +271,98 @@ func Get[T any](requester Instance) (T, error) {
 	}
 	return result.(T), nil
 }
+
+// GetByName is like Get, but returns the component with the provided full
+// name, e.g., "github.com/example/shop/CartService", rather than the component
+// of a given type. It lets frameworks and adapters that don't know the types
+// of the components they use at compile time obtain them at runtime. The
+// returned value implements the component's interface, and can be converted
+// to it with a type assertion, or inspected with reflection. For example:
+//
+//	cart, err := weaver.GetByName(root, "github.com/example/shop/CartService")
+//	if err != nil {
+//	    return err
+//	}
+//	items, err := cart.(CartService).Items(ctx, user)
+func GetByName(requester Instance, name string) (any, error) {
+	rep := requester.rep()
+	component, err := rep.wlet.getComponent(name)
+	if err != nil {
+		return nil, err
+	}
+	return rep.wlet.getInstance(component, rep.info.Name)
+}
+
+// Budget returns the time left before the deadline of ctx, and whether ctx
+// has a deadline. The deadline of the context passed to a component method
+// call is propagated to the method, even across processes, so within a
+// method, Budget returns the time left before the caller gives up on the
+// call. When the deadline passes, the method's context is canceled, and the
+// method's results are discarded. A method can use Budget to skip work that
+// can't complete in time:
+//
+//	if budget, ok := weaver.Budget(ctx); ok && budget < 10*time.Millisecond {
+//	    return cached, nil
+//	}
+func Budget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// WithMetricLabels returns a copy of ctx that attaches the provided labels,
+// given as alternating label names and values, to the auto-generated metrics
+// of the component method calls made with the returned context, like
+// serviceweaver_remote_method_count and
+// serviceweaver_remote_method_latency_micros. Use it to break down calls by
+// dimensions that Service Weaver doesn't know about, like a tenant:
+//
+//	ctx = weaver.WithMetricLabels(ctx, "tenant", tenant)
+//	err := store.Put(ctx, key, value)
+//
+// The labels are merged with the labels already attached to ctx, if any. They
+// apply to the calls made with ctx in the calling process; they are not
+// propagated to the calls that a remote callee makes.
+//
+// Every distinct set of label values creates new metrics, so labels should
+// take few values. To bound the cost of a mistake, the metrics of a method
+// record at most a limited number of label sets (see the method_label_sets
+// setting in runtime.MetricsConfig). Calls with more label sets are recorded
+// with the label values replaced by "other".
+//
+// WithMetricLabels panics if given an odd number of arguments, or a label
+// name that is not a valid Prometheus label name or that is reserved by
+// Service Weaver, like "component", "method", and "replica".
+func WithMetricLabels(ctx context.Context, labels ...string) context.Context {
+	if len(labels)%2 != 0 {
+		panic(fmt.Errorf("WithMetricLabels: odd number of arguments %d", len(labels)))
+	}
+	for i := 0; i < len(labels); i += 2 {
+		if err := checkMetricLabel(labels[i]); err != nil {
+			panic(fmt.Errorf("WithMetricLabels: %w", err))
+		}
+	}
+	return codegen.WithMetricLabels(ctx, labels...)
+}
+
+// checkMetricLabel returns an error if the provided label name can't be
+// attached to the auto-generated method metrics.
+func checkMetricLabel(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty label name")
+	}
+	for i, r := range name {
+		if !(r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || i > 0 && '0' <= r && r <= '9') {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	switch {
+	case name == "caller", name == "component", name == "method",
+		name == "app", name == "deployment", name == "replica",
+		strings.HasPrefix(name, "serviceweaver_"), strings.HasPrefix(name, "__"):
+		return fmt.Errorf("reserved label name %q", name)
+	}
+	return nil
+}
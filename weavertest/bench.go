@@ -0,0 +1,104 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weavertest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/internal/bench"
+)
+
+// Bench benchmarks the calls made by call to the component with interface T,
+// to quantify the cost of running the component in a separate process from
+// its callers. For example:
+//
+//	func BenchmarkGetProduct(b *testing.B) {
+//	    weavertest.Bench(context.Background(), b, weavertest.Options{},
+//	        func(ctx context.Context, catalog ProductCatalog) error {
+//	            _, err := catalog.GetProduct(ctx, "OLJCESPC7Z")
+//	            return err
+//	        })
+//	}
+//
+// Bench runs three sub-benchmarks:
+//
+//   - local, in which every component runs in the same process as the
+//     benchmark and calls are regular method calls;
+//   - serialized, in which every component runs in the same process as the
+//     benchmark, but the arguments and results of every call are serialized,
+//     as they are in remote calls; and
+//   - multi, in which every component runs in its own process.
+//
+// The multi sub-benchmark additionally reports, per call to call, the time
+// spent serializing arguments and results, as serialization-ns/op, and the
+// time spent sending them between processes, as transport-ns/op. These are
+// the differences between the serialized and local sub-benchmarks, and
+// between the multi and serialized sub-benchmarks, respectively, so they are
+// only reported when all three sub-benchmarks run.
+//
+// The SingleProcess and Colocate options are ignored.
+func Bench[T any](ctx context.Context, b *testing.B, opts Options, call func(ctx context.Context, component T) error) {
+	b.Helper()
+	opts.Colocate = nil
+
+	// Start the deployments before the sub-benchmarks, which the testing
+	// package runs multiple times, with an increasing number of calls.
+	opts.SingleProcess = false
+	multi := get[T](b, Init(ctx, b, opts))
+	opts.SingleProcess = true
+	local := get[T](b, Init(ctx, b, opts))
+	serialized := get[T](b, Init(context.WithValue(ctx, bench.Key{}, true), b, opts))
+
+	run := func(b *testing.B, component T) time.Duration {
+		b.Helper()
+		b.ResetTimer()
+		start := time.Now()
+		for i := 0; i < b.N; i++ {
+			if err := call(ctx, component); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+		return time.Since(start) / time.Duration(b.N)
+	}
+	var localOp, serializedOp time.Duration
+	b.Run("local", func(b *testing.B) {
+		localOp = run(b, local)
+	})
+	b.Run("serialized", func(b *testing.B) {
+		serializedOp = run(b, serialized)
+	})
+	b.Run("multi", func(b *testing.B) {
+		multiOp := run(b, multi)
+		if localOp > 0 && serializedOp > 0 {
+			b.ReportMetric(float64(serializedOp-localOp), "serialization-ns/op")
+			b.ReportMetric(float64(multiOp-serializedOp), "transport-ns/op")
+		}
+	})
+}
+
+// get returns the component with interface T, failing the benchmark if it
+// can't.
+func get[T any](b *testing.B, root weaver.Instance) T {
+	b.Helper()
+	component, err := weaver.Get[T](root)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return component
+}
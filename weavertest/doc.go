@@ -48,4 +48,15 @@
 //	    reverser, err := weaver.Get[Reverser](root)
 //	    // ...
 //	}
+//
+// Use the Colocate option to run groups of components in the same process,
+// e.g., to match the colocation of a deployment, and the Faults option to
+// inject errors, latency, or dropped calls into the calls to specific
+// components or methods, to test how failures propagate through your
+// application. See [Fault] for details. Use the Fakes option to replace
+// components with fakes, such as the ones generated by
+// "weaver generate -fakes". See [Fake] for details.
+//
+// Use [Bench] to measure the serialization and transport overhead of calling
+// a component in a separate process.
 package weavertest
@@ -16,9 +16,13 @@ package weavertest
 
 import (
 	"context"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/internal/fakes"
+	"github.com/ServiceWeaver/weaver/internal/faults"
 )
 
 // Options configure weavertest.Init.
@@ -31,6 +35,95 @@ type Options struct {
 	// Service Weaver config file. It can contain application level as well as component
 	// level configuration. Config is allowed to be empty.
 	Config string
+
+	// Faults lists the faults to inject into component method calls. See
+	// Fault for details.
+	Faults []Fault
+
+	// Colocate lists the groups of components, by full name, that share a
+	// process when SingleProcess is false, e.g.,
+	//
+	//	Colocate: [][]string{{
+	//	    "github.com/example/app/CartService",
+	//	    "github.com/example/app/CartCache",
+	//	}}
+	//
+	// Every other component runs in a process of its own. The groups are
+	// added to the colocate groups in Config, if any.
+	Colocate [][]string
+
+	// Replicas is the number of replicas of every process when SingleProcess
+	// is false, e.g., 1 to test a component that keeps its state in memory.
+	// If zero, every process has two replicas.
+	Replicas int
+
+	// Fakes lists the components to replace with fakes. See Fake for
+	// details. Fakes can only be used with SingleProcess.
+	Fakes []FakeComponent
+}
+
+// FakeComponent is a fake implementation of a component. See Fake.
+type FakeComponent struct {
+	intf reflect.Type // component interface type
+	impl any          // fake implementation of intf
+}
+
+// Fake returns a fake implementation of the component with interface T. The
+// fake is returned to every caller of weaver.Get[T], instead of the real
+// implementation, which is never created. For example:
+//
+//	fake := &app.FakeProductCatalog{}
+//	fake.GetProductReturns(app.Product{Name: "Sunglasses"}, nil)
+//	root := weavertest.Init(ctx, t, weavertest.Options{
+//	    SingleProcess: true,
+//	    Fakes:         []weavertest.FakeComponent{weavertest.Fake[app.ProductCatalog](fake)},
+//	})
+//
+// The fake can be any implementation of T. "weaver generate -fakes"
+// generates a configurable fake for every component interface, like
+// FakeProductCatalog above, which records its calls, returns scripted
+// results, and calls per-method hooks.
+func Fake[T any](impl T) FakeComponent {
+	return FakeComponent{intf: reflect.TypeOf((*T)(nil)).Elem(), impl: impl}
+}
+
+// Fault is a fault injected into calls to the methods of a component. Faults
+// are injected by the caller, before the call is sent, so they apply to both
+// remote and local calls. For example, the following fault makes half of the
+// calls to the ProductCatalog component fail after 100 milliseconds:
+//
+//	weavertest.Fault{
+//	    Component:   "github.com/example/app/ProductCatalog",
+//	    Probability: 0.5,
+//	    Delay:       100 * time.Millisecond,
+//	    Error:       errUnavailable,
+//	}
+//
+// If Error and Drop are unset, affected calls are only delayed. If a call is
+// affected by multiple faults, they are applied in order, until one of them
+// fails the call.
+type Fault struct {
+	// Component is the full name of the component, e.g.,
+	// "github.com/example/app/ProductCatalog".
+	Component string
+
+	// Method is the name of the method. If empty, the fault applies to every
+	// method of the component.
+	Method string
+
+	// Probability is the probability that a call is affected by the fault,
+	// between 0 and 1. If zero, every call is affected.
+	Probability float64
+
+	// Delay is added to affected calls.
+	Delay time.Duration
+
+	// Error, if not nil, is returned by affected calls, which are not made.
+	Error error
+
+	// Drop, if true, makes affected calls fail with a network error, as if
+	// the call was lost. The error wraps weaver.ErrRetriable.
+	Drop bool
 }
 
 // Init is a testing version of weaver.Init. Calling Init will create a brand
@@ -45,8 +138,47 @@ type Options struct {
 //	    // Test the Foo component...
 //	}
 func Init(ctx context.Context, t testing.TB, opts Options) weaver.Instance {
+	t.Helper()
+	fs := make([]faults.Fault, len(opts.Faults))
+	for i, f := range opts.Faults {
+		if f.Probability < 0 || f.Probability > 1 {
+			t.Fatalf("fault for component %q: invalid probability %v not between 0 and 1", f.Component, f.Probability)
+		}
+		fs[i] = faults.Fault(f)
+	}
+	if len(opts.Fakes) > 0 {
+		if !opts.SingleProcess {
+			t.Fatalf("fakes can only be used with SingleProcess")
+		}
+		fakeImpls := map[reflect.Type]any{}
+		for _, f := range opts.Fakes {
+			if _, ok := fakeImpls[f.intf]; ok {
+				t.Fatalf("multiple fakes for component %v", f.intf)
+			}
+			fakeImpls[f.intf] = f.impl
+		}
+		ctx = context.WithValue(ctx, fakes.Key{}, fakeImpls)
+	}
 	if opts.SingleProcess {
-		return initSingleProcess(ctx, t, opts.Config)
+		return initSingleProcess(ctx, t, opts.Config, fs)
+	}
+	return initMultiProcess(ctx, t, opts.Config, opts.Colocate, opts.Replicas, fs)
+}
+
+// InitComponent is a shorthand for calling Init and getting the component
+// with interface T from the returned main component, for a test of a single
+// component. For example:
+//
+//	func TestCache(t *testing.T) {
+//	    cache := weavertest.InitComponent[Cache](t, weavertest.Options{Replicas: 1})
+//	    // Test the Cache component...
+//	}
+func InitComponent[T any](t testing.TB, opts Options) T {
+	t.Helper()
+	root := Init(context.Background(), t, opts)
+	c, err := weaver.Get[T](root)
+	if err != nil {
+		t.Fatal(err)
 	}
-	return initMultiProcess(ctx, t, opts.Config)
+	return c
 }
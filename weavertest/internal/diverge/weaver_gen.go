@@ -23,6 +23,7 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return errer_server_stub{impl: impl.(Errer), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Err": {""}},
 	})
 	codegen.Register(codegen.Registration{
 		Name:        "github.com/ServiceWeaver/weaver/weavertest/internal/diverge/Failer",
@@ -50,6 +51,7 @@ func init() {
 			return pointer_server_stub{impl: impl.(Pointer), addLoad: addLoad}
 		},
 	})
+	codegen.RegisterRefs("main", "github.com/ServiceWeaver/weaver/weavertest/internal/diverge/Errer", "github.com/ServiceWeaver/weaver/weavertest/internal/diverge/Failer", "github.com/ServiceWeaver/weaver/weavertest/internal/diverge/Pointer")
 }
 
 // Local stub implementations.
@@ -130,7 +132,8 @@ type errer_client_stub struct {
 func (s errer_client_stub) Err(ctx context.Context, a0 int) (err error) {
 	// Update metrics.
 	start := time.Now()
-	s.errMetrics.Count.Add(1)
+	methodMetrics := s.errMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -148,31 +151,31 @@ func (s errer_client_stub) Err(ctx context.Context, a0 int) (err error) {
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.errMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.errMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += 8
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.Int(a0)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.errMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.errMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -188,7 +191,8 @@ type failer_client_stub struct {
 func (s failer_client_stub) ImJustHereSoWeaverGenerateDoesntComplain(ctx context.Context) (err error) {
 	// Update metrics.
 	start := time.Now()
-	s.imJustHereSoWeaverGenerateDoesntComplainMetrics.Count.Add(1)
+	methodMetrics := s.imJustHereSoWeaverGenerateDoesntComplainMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -206,23 +210,23 @@ func (s failer_client_stub) ImJustHereSoWeaverGenerateDoesntComplain(ctx context
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.imJustHereSoWeaverGenerateDoesntComplainMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.imJustHereSoWeaverGenerateDoesntComplainMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	var shardKey uint64
 
 	// Call the remote method.
-	s.imJustHereSoWeaverGenerateDoesntComplainMetrics.BytesRequest.Put(0)
+	methodMetrics.BytesRequest.Put(0)
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, nil, shardKey)
 	if err != nil {
 		return
 	}
-	s.imJustHereSoWeaverGenerateDoesntComplainMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -238,7 +242,8 @@ type pointer_client_stub struct {
 func (s pointer_client_stub) Get(ctx context.Context) (r0 Pair, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getMetrics.Count.Add(1)
+	methodMetrics := s.getMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -256,23 +261,23 @@ func (s pointer_client_stub) Get(ctx context.Context) (r0 Pair, err error) {
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	var shardKey uint64
 
 	// Call the remote method.
-	s.getMetrics.BytesRequest.Put(0)
+	methodMetrics.BytesRequest.Put(0)
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, nil, shardKey)
 	if err != nil {
 		return
 	}
-	s.getMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -386,6 +391,9 @@ func (s pointer_server_stub) get(ctx context.Context, args []byte) (res []byte,
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += serviceweaver_size_Pair_5761be45(&r0)
+	enc.Reset(size)
 	(r0).WeaverMarshal(enc)
 	enc.Error(appErr)
 	return enc.Data(), nil
@@ -428,3 +436,29 @@ func serviceweaver_dec_ptr_int_98a2a745(dec *codegen.Decoder) *int {
 	res = dec.Int()
 	return &res
 }
+
+func init() {
+	codegen.RegisterSerializable[Pair]()
+}
+
+// Size implementations.
+
+// serviceweaver_size_ptr_int_98a2a745 returns the size (in bytes) of the serialization
+// of the provided type.
+func serviceweaver_size_ptr_int_98a2a745(x *int) int {
+	if x == nil {
+		return 1
+	} else {
+		return 1 + 8
+	}
+}
+
+// serviceweaver_size_Pair_5761be45 returns the size (in bytes) of the serialization
+// of the provided type.
+func serviceweaver_size_Pair_5761be45(x *Pair) int {
+	size := 0
+	size += 0
+	size += serviceweaver_size_ptr_int_98a2a745(x.X)
+	size += serviceweaver_size_ptr_int_98a2a745(x.Y)
+	return size
+}
@@ -0,0 +1,45 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"math/big"
+	"net/netip"
+	"time"
+
+	"github.com/ServiceWeaver/weaver"
+)
+
+// uuid is a UUID-like type that implements encoding.BinaryMarshaler, but is
+// encoded natively.
+type uuid [16]byte
+
+func (u uuid) MarshalBinary() ([]byte, error) { return u[:], nil }
+
+func (u *uuid) UnmarshalBinary(b []byte) error {
+	copy(u[:], b)
+	return nil
+}
+
+// lease has fields of standard library types with native encodings.
+type lease struct {
+	weaver.AutoMarshal
+	ID      uuid
+	Expires time.Time
+	TTL     time.Duration
+	Addr    netip.Addr
+	Price   *big.Int
+	History []time.Time
+}
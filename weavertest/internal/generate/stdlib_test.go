@@ -0,0 +1,62 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"math/big"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+)
+
+func TestStdlibTypes(t *testing.T) {
+	now := time.Now().Round(0)
+	want := lease{
+		ID:      uuid{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		Expires: now,
+		TTL:     time.Minute,
+		Addr:    netip.MustParseAddr("10.0.0.1"),
+		Price:   big.NewInt(-12345),
+		History: []time.Time{now.Add(-time.Hour).UTC(), {}},
+	}
+	enc := codegen.NewEncoder()
+	want.WeaverMarshal(enc)
+	var got lease
+	dec := codegen.NewDecoder(enc.Data())
+	got.WeaverUnmarshal(dec)
+	if !dec.Empty() {
+		t.Fatal("leftover bytes after decoding")
+	}
+
+	if got.ID != want.ID || got.TTL != want.TTL || got.Addr != want.Addr {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !got.Expires.Equal(want.Expires) {
+		t.Errorf("Expires: got %v, want %v", got.Expires, want.Expires)
+	}
+	if got.Price.Cmp(want.Price) != 0 {
+		t.Errorf("Price: got %v, want %v", got.Price, want.Price)
+	}
+	if len(got.History) != len(want.History) {
+		t.Fatalf("History: got %v, want %v", got.History, want.History)
+	}
+	for i := range want.History {
+		if got.History[i] != want.History[i] {
+			t.Errorf("History[%d]: got %v, want %v", i, got.History[i], want.History[i])
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import "github.com/ServiceWeaver/weaver"
+
+// orderV1 and orderV2 are two versions of the same versioned struct, as
+// written by two versions of an application. orderV2 drops the note field
+// and adds the discount and address fields.
+type orderV1 struct {
+	weaver.AutoMarshal
+	ID    string   `weaver:"1"`
+	Items []string `weaver:"2"`
+	Note  string   `weaver:"3"`
+}
+
+type orderV2 struct {
+	weaver.AutoMarshal
+	Address  address  `weaver:"5"`
+	ID       string   `weaver:"1"`
+	Items    []string `weaver:"2"`
+	Discount int      `weaver:"4"`
+}
+
+type address struct {
+	weaver.AutoMarshal
+	Street string `weaver:"1"`
+	City   string `weaver:"2"`
+}
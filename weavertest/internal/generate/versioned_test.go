@@ -0,0 +1,63 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVersionedStructs(t *testing.T) {
+	v1 := orderV1{ID: "o1", Items: []string{"a", "b"}, Note: "fragile"}
+	v2 := orderV2{
+		ID:       "o2",
+		Items:    []string{"c"},
+		Discount: 10,
+		Address:  address{Street: "1 Main St", City: "Springfield"},
+	}
+
+	// A newer version decodes the fields it knows, and leaves the fields it
+	// doesn't find zero.
+	enc := codegen.NewEncoder()
+	v1.WeaverMarshal(enc)
+	var gotV2 orderV2
+	gotV2.WeaverUnmarshal(codegen.NewDecoder(enc.Data()))
+	if diff := cmp.Diff(orderV2{ID: "o1", Items: []string{"a", "b"}}, gotV2); diff != "" {
+		t.Errorf("v1 -> v2 (-want +got):\n%s", diff)
+	}
+
+	// An older version skips the fields it doesn't know.
+	enc = codegen.NewEncoder()
+	v2.WeaverMarshal(enc)
+	var gotV1 orderV1
+	gotV1.WeaverUnmarshal(codegen.NewDecoder(enc.Data()))
+	if diff := cmp.Diff(orderV1{ID: "o2", Items: []string{"c"}}, gotV1); diff != "" {
+		t.Errorf("v2 -> v1 (-want +got):\n%s", diff)
+	}
+
+	// The same version round trips.
+	enc = codegen.NewEncoder()
+	v2.WeaverMarshal(enc)
+	dec := codegen.NewDecoder(enc.Data())
+	gotV2.WeaverUnmarshal(dec)
+	if diff := cmp.Diff(v2, gotV2); diff != "" {
+		t.Errorf("v2 -> v2 (-want +got):\n%s", diff)
+	}
+	if !dec.Empty() {
+		t.Errorf("v2 -> v2: undecoded bytes")
+	}
+}
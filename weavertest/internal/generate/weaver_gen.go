@@ -3,9 +3,11 @@ package generate
 // Code generated by "weaver generate". DO NOT EDIT.
 import (
 	"context"
+	"fmt"
 	"github.com/ServiceWeaver/weaver/runtime/codegen"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
+	"math/big"
 	"reflect"
 	"time"
 )
@@ -24,6 +26,7 @@ func init() {
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return testApp_server_stub{impl: impl.(testApp), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Get": {"key", "behavior"}, "IncPointer": {"arg"}},
 	})
 }
 
@@ -79,7 +82,8 @@ type testApp_client_stub struct {
 func (s testApp_client_stub) Get(ctx context.Context, a0 string, a1 behaviorType) (r0 int, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getMetrics.Count.Add(1)
+	methodMetrics := s.getMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -97,19 +101,19 @@ func (s testApp_client_stub) Get(ctx context.Context, a0 string, a1 behaviorType
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
 	size += 8
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
@@ -117,13 +121,13 @@ func (s testApp_client_stub) Get(ctx context.Context, a0 string, a1 behaviorType
 	var shardKey uint64
 
 	// Call the remote method.
-	s.getMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.getMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -135,7 +139,8 @@ func (s testApp_client_stub) Get(ctx context.Context, a0 string, a1 behaviorType
 func (s testApp_client_stub) IncPointer(ctx context.Context, a0 *int) (r0 *int, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.incPointerMetrics.Count.Add(1)
+	methodMetrics := s.incPointerMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -153,31 +158,31 @@ func (s testApp_client_stub) IncPointer(ctx context.Context, a0 *int) (r0 *int,
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.incPointerMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.incPointerMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += serviceweaver_size_ptr_int_98a2a745(a0)
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	serviceweaver_enc_ptr_int_98a2a745(enc, a0)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.incPointerMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 1, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.incPointerMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -227,6 +232,9 @@ func (s testApp_server_stub) get(ctx context.Context, args []byte) (res []byte,
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += 8
+	enc.Reset(size)
 	enc.Int(r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
@@ -252,11 +260,226 @@ func (s testApp_server_stub) incPointer(ctx context.Context, args []byte) (res [
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += serviceweaver_size_ptr_int_98a2a745(r0)
+	enc.Reset(size)
 	serviceweaver_enc_ptr_int_98a2a745(enc, r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
 }
 
+// AutoMarshal implementations.
+
+var _ codegen.AutoMarshal = &address{}
+
+func (x *address) WeaverMarshal(enc *codegen.Encoder) {
+	if x == nil {
+		panic(fmt.Errorf("address.WeaverMarshal: nil receiver"))
+	}
+	enc.Len(2)
+	f1 := enc.BeginField(1)
+	enc.String(x.Street)
+	enc.EndField(f1)
+	f2 := enc.BeginField(2)
+	enc.String(x.City)
+	enc.EndField(f2)
+}
+
+func (x *address) WeaverUnmarshal(dec *codegen.Decoder) {
+	if x == nil {
+		panic(fmt.Errorf("address.WeaverUnmarshal: nil receiver"))
+	}
+	*x = address{}
+	for n := dec.Len(); n > 0; n-- {
+		switch num, field := dec.Field(); num {
+		case 1:
+			x.Street = field.String()
+		case 2:
+			x.City = field.String()
+		}
+	}
+}
+
+var _ codegen.AutoMarshal = &lease{}
+
+func (x *lease) WeaverMarshal(enc *codegen.Encoder) {
+	if x == nil {
+		panic(fmt.Errorf("lease.WeaverMarshal: nil receiver"))
+	}
+	serviceweaver_enc_array_16_byte_b1cd7684(enc, (*[16]byte)(&x.ID))
+	enc.Time(x.Expires)
+	enc.Int64((int64)(x.TTL))
+	enc.Addr(x.Addr)
+	serviceweaver_enc_ptr_Int_4c99ab68(enc, x.Price)
+	serviceweaver_enc_slice_Time_91150e37(enc, x.History)
+}
+
+func (x *lease) WeaverUnmarshal(dec *codegen.Decoder) {
+	if x == nil {
+		panic(fmt.Errorf("lease.WeaverUnmarshal: nil receiver"))
+	}
+	serviceweaver_dec_array_16_byte_b1cd7684(dec, (*[16]byte)(&x.ID))
+	x.Expires = dec.Time()
+	*(*int64)(&x.TTL) = dec.Int64()
+	x.Addr = dec.Addr()
+	x.Price = serviceweaver_dec_ptr_Int_4c99ab68(dec)
+	x.History = serviceweaver_dec_slice_Time_91150e37(dec)
+}
+
+func serviceweaver_enc_array_16_byte_b1cd7684(enc *codegen.Encoder, arg *[16]byte) {
+	copy(enc.Grow(16), arg[:])
+}
+
+func serviceweaver_dec_array_16_byte_b1cd7684(dec *codegen.Decoder, res *[16]byte) {
+	copy(res[:], dec.Read(16))
+}
+
+func serviceweaver_enc_ptr_Int_4c99ab68(enc *codegen.Encoder, arg *big.Int) {
+	if arg == nil {
+		enc.Bool(false)
+	} else {
+		enc.Bool(true)
+		enc.BigInt(arg)
+	}
+}
+
+func serviceweaver_dec_ptr_Int_4c99ab68(dec *codegen.Decoder) *big.Int {
+	if !dec.Bool() {
+		return nil
+	}
+	var res big.Int
+	dec.BigInt(&res)
+	return &res
+}
+
+func serviceweaver_enc_slice_Time_91150e37(enc *codegen.Encoder, arg []time.Time) {
+	if arg == nil {
+		enc.Len(-1)
+		return
+	}
+	enc.Len(len(arg))
+	for i := 0; i < len(arg); i++ {
+		enc.Time(arg[i])
+	}
+}
+
+func serviceweaver_dec_slice_Time_91150e37(dec *codegen.Decoder) []time.Time {
+	n := dec.Len()
+	if n == -1 {
+		return nil
+	}
+	res := make([]time.Time, n)
+	for i := 0; i < n; i++ {
+		res[i] = dec.Time()
+	}
+	return res
+}
+
+var _ codegen.AutoMarshal = &orderV1{}
+
+func (x *orderV1) WeaverMarshal(enc *codegen.Encoder) {
+	if x == nil {
+		panic(fmt.Errorf("orderV1.WeaverMarshal: nil receiver"))
+	}
+	enc.Len(3)
+	f1 := enc.BeginField(1)
+	enc.String(x.ID)
+	enc.EndField(f1)
+	f2 := enc.BeginField(2)
+	serviceweaver_enc_slice_string_4af10117(enc, x.Items)
+	enc.EndField(f2)
+	f3 := enc.BeginField(3)
+	enc.String(x.Note)
+	enc.EndField(f3)
+}
+
+func (x *orderV1) WeaverUnmarshal(dec *codegen.Decoder) {
+	if x == nil {
+		panic(fmt.Errorf("orderV1.WeaverUnmarshal: nil receiver"))
+	}
+	*x = orderV1{}
+	for n := dec.Len(); n > 0; n-- {
+		switch num, field := dec.Field(); num {
+		case 1:
+			x.ID = field.String()
+		case 2:
+			x.Items = serviceweaver_dec_slice_string_4af10117(field)
+		case 3:
+			x.Note = field.String()
+		}
+	}
+}
+
+func serviceweaver_enc_slice_string_4af10117(enc *codegen.Encoder, arg []string) {
+	if arg == nil {
+		enc.Len(-1)
+		return
+	}
+	enc.Len(len(arg))
+	for i := 0; i < len(arg); i++ {
+		enc.String(arg[i])
+	}
+}
+
+func serviceweaver_dec_slice_string_4af10117(dec *codegen.Decoder) []string {
+	n := dec.Len()
+	if n == -1 {
+		return nil
+	}
+	res := make([]string, n)
+	for i := 0; i < n; i++ {
+		res[i] = dec.String()
+	}
+	return res
+}
+
+var _ codegen.AutoMarshal = &orderV2{}
+
+func (x *orderV2) WeaverMarshal(enc *codegen.Encoder) {
+	if x == nil {
+		panic(fmt.Errorf("orderV2.WeaverMarshal: nil receiver"))
+	}
+	enc.Len(4)
+	f5 := enc.BeginField(5)
+	(x.Address).WeaverMarshal(enc)
+	enc.EndField(f5)
+	f1 := enc.BeginField(1)
+	enc.String(x.ID)
+	enc.EndField(f1)
+	f2 := enc.BeginField(2)
+	serviceweaver_enc_slice_string_4af10117(enc, x.Items)
+	enc.EndField(f2)
+	f4 := enc.BeginField(4)
+	enc.Int(x.Discount)
+	enc.EndField(f4)
+}
+
+func (x *orderV2) WeaverUnmarshal(dec *codegen.Decoder) {
+	if x == nil {
+		panic(fmt.Errorf("orderV2.WeaverUnmarshal: nil receiver"))
+	}
+	*x = orderV2{}
+	for n := dec.Len(); n > 0; n-- {
+		switch num, field := dec.Field(); num {
+		case 5:
+			(&x.Address).WeaverUnmarshal(field)
+		case 1:
+			x.ID = field.String()
+		case 2:
+			x.Items = serviceweaver_dec_slice_string_4af10117(field)
+		case 4:
+			x.Discount = field.Int()
+		}
+	}
+}
+
+func init() {
+	codegen.RegisterSerializable[address]()
+	codegen.RegisterSerializable[lease]()
+	codegen.RegisterSerializable[orderV1]()
+	codegen.RegisterSerializable[orderV2]()
+}
+
 // Encoding/decoding implementations.
 
 func serviceweaver_enc_ptr_int_98a2a745(enc *codegen.Encoder, arg *int) {
@@ -23,14 +23,17 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ServiceWeaver/weaver"
 )
 
-//go:generate ../../../cmd/weaver/weaver generate
+//go:generate ../../../cmd/weaver/weaver generate -fakes
 
 type Source interface {
 	Emit(ctx context.Context, file, msg string) error
+	Getpid(ctx context.Context) (int, error)
 }
 
 type source struct {
@@ -49,11 +52,16 @@ func (s *source) Emit(ctx context.Context, file, msg string) error {
 	return s.dst.Record(ctx, file, msg)
 }
 
+func (s *source) Getpid(_ context.Context) (int, error) {
+	return os.Getpid(), nil
+}
+
 type Destination interface {
 	Getpid(_ context.Context) (int, error)
 	Record(_ context.Context, file, msg string) error
 	GetAll(_ context.Context, file string) ([]string, error)
 	RoutedRecord(_ context.Context, file, msg string) error
+	Sleep(_ context.Context, d time.Duration) error
 }
 
 type destRouter struct{}
@@ -68,6 +76,17 @@ type destination struct {
 	mu sync.Mutex
 }
 
+// Shutdowns counts the number of times a destination was shut down in this
+// process.
+var Shutdowns atomic.Int32
+
+// Shutdown implements a component shutdown hook.
+func (d *destination) Shutdown(context.Context) error {
+	d.Logger().Debug("simple.Shutdown")
+	Shutdowns.Add(1)
+	return nil
+}
+
 func (d *destination) Getpid(_ context.Context) (int, error) {
 	return os.Getpid(), nil
 }
@@ -102,3 +121,13 @@ func (d *destination) GetAll(_ context.Context, file string) ([]string, error) {
 	str := strings.TrimSpace(string(data))
 	return strings.Split(str, "\n"), nil
 }
+
+// Sleep sleeps for the provided duration or until ctx is done.
+func (d *destination) Sleep(ctx context.Context, dur time.Duration) error {
+	select {
+	case <-time.After(dur):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -16,22 +16,52 @@ package simple_test
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/internal/babysitter"
+	"github.com/ServiceWeaver/weaver/runtime"
+	"github.com/ServiceWeaver/weaver/runtime/codegen"
+	"github.com/ServiceWeaver/weaver/runtime/envelope"
+	"github.com/ServiceWeaver/weaver/runtime/metrics"
+	"github.com/ServiceWeaver/weaver/runtime/protos"
+	"github.com/ServiceWeaver/weaver/runtime/retry"
 	"github.com/ServiceWeaver/weaver/weavertest"
 	"github.com/ServiceWeaver/weaver/weavertest/internal/simple"
 	"github.com/google/uuid"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
+func TestMain(m *testing.M) {
+	// When run with the "weavelet" subcommand, this test binary acts as a
+	// weavelet started by an envelope instead of running the tests. See
+	// TestStopShutsDown.
+	flag.Parse()
+	if flag.Arg(0) == "weavelet" {
+		err := weaver.Run(context.Background(), func(context.Context, weaver.Instance) error {
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
 func TestOneComponent(t *testing.T) {
 	for _, single := range []bool{true, false} {
 		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
@@ -70,6 +100,10 @@ func TestTwoComponents(t *testing.T) {
 	for _, c := range []testCase{
 		{"single", true, ""},
 		{"multi", false, ""},
+		{"grpc", false, `
+			[serviceweaver]
+			transport = "grpc"
+		`},
 		{"colocate", false, `
 			[serviceweaver]
 			colocate = [
@@ -113,6 +147,327 @@ func TestTwoComponents(t *testing.T) {
 	}
 }
 
+func TestColocateOption(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []struct {
+		name      string
+		colocate  [][]string
+		colocated bool
+	}{
+		{"separate", nil, false},
+		{"colocated", [][]string{{
+			"github.com/ServiceWeaver/weaver/weavertest/internal/simple/Source",
+			"github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination",
+		}}, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			root := weavertest.Init(ctx, t, weavertest.Options{Colocate: c.colocate})
+			src, err := weaver.Get[simple.Source](root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst, err := weaver.Get[simple.Destination](root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Collect the processes of the replicas of both components.
+			srcPids := map[int]bool{}
+			shared := false
+			for i := 0; i < 20; i++ {
+				pid, err := src.Getpid(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				srcPids[pid] = true
+			}
+			for i := 0; i < 20; i++ {
+				pid, err := dst.Getpid(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				shared = shared || srcPids[pid]
+			}
+			if shared != c.colocated {
+				t.Fatalf("components share a process: got %v, want %v", shared, c.colocated)
+			}
+		})
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(t.TempDir(), "simple")
+
+	// Record the calls of a multiprocess deployment.
+	t.Run("record", func(t *testing.T) {
+		config := fmt.Sprintf(`
+			[serviceweaver.recording]
+			dir = %q
+		`, dir)
+		root := weavertest.Init(ctx, t, weavertest.Options{Config: config})
+		src, err := weaver.Get[simple.Source](root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range []string{"a", "b"} {
+			if err := src.Emit(ctx, file, msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	recordings, err := filepath.Glob(filepath.Join(dir, "*.recording"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replay them against Source, whose calls to Destination are answered
+	// from the recordings.
+	os.Remove(file)
+	weavertest.Replay(ctx, t, weavertest.Options{},
+		"github.com/ServiceWeaver/weaver/weavertest/internal/simple/Source",
+		recordings...)
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("Destination executed calls during the replay: %v", err)
+	}
+}
+
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+	errFull := errors.New("full")
+	fake := &simple.FakeDestination{}
+	fake.RecordReturns(nil)
+	fake.RecordReturns(errFull)
+	fake.RecordHook = func(context.Context, string, string) error {
+		return nil
+	}
+
+	root := weavertest.Init(ctx, t, weavertest.Options{
+		SingleProcess: true,
+		Fakes:         []weavertest.FakeComponent{weavertest.Fake[simple.Destination](fake)},
+	})
+	src, err := weaver.Get[simple.Source](root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scripted results are returned first, followed by the hook's.
+	file := filepath.Join(t.TempDir(), "simple")
+	for i, want := range []error{nil, errFull, nil} {
+		if err := src.Emit(ctx, file, fmt.Sprint(i)); !errors.Is(err, want) {
+			t.Fatalf("Emit(%d): got %v, want %v", i, err, want)
+		}
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("the real Destination was called: %v", err)
+	}
+	want := []simple.FakeDestinationRecordCall{
+		{File: file, Msg: "0"},
+		{File: file, Msg: "1"},
+		{File: file, Msg: "2"},
+	}
+	if got := fake.RecordCalls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("RecordCalls: got %v, want %v", got, want)
+	}
+}
+
+func TestSingleton(t *testing.T) {
+	// Source is replicated, but only its active replica executes calls.
+	const config = `
+		["github.com/ServiceWeaver/weaver/weavertest/internal/simple/Source"]
+		singleton = true
+	`
+	ctx := context.Background()
+	root := weavertest.Init(ctx, t, weavertest.Options{Config: config})
+	src, err := weaver.Get[simple.Source](root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pids := map[int]bool{}
+	for i := 0; i < 10; i++ {
+		pid, err := src.Getpid(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pids[pid] = true
+	}
+	if len(pids) != 1 {
+		t.Fatalf("calls executed by %d replicas, want 1", len(pids))
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: single})
+			want := 1
+			if !single {
+				want = babysitter.DefaultReplication
+			}
+
+			// Replicas are started concurrently, so the first broadcasts
+			// may not reach all of them.
+			pids := map[int]bool{}
+			for r := retry.Begin(); r.Continue(ctx) && len(pids) < want; {
+				results, err := weaver.Broadcast(ctx, root, func(ctx context.Context, src simple.Source) (int, error) {
+					return src.Getpid(ctx)
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				pids = map[int]bool{}
+				for _, result := range results {
+					if result.Err != nil {
+						t.Fatalf("replica %q: %v", result.Replica, result.Err)
+					}
+					pids[result.Value] = true
+				}
+			}
+			if len(pids) != want {
+				t.Fatalf("broadcast reached %d replicas, want %d", len(pids), want)
+			}
+		})
+	}
+}
+
+func TestReplicas(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	const want = 3
+	root := weavertest.Init(ctx, t, weavertest.Options{Replicas: want})
+
+	// Replicas are started concurrently, so wait for all of them.
+	var pids map[int]bool
+	for r := retry.Begin(); r.Continue(ctx) && len(pids) < want; {
+		results, err := weaver.Broadcast(ctx, root, func(ctx context.Context, src simple.Source) (int, error) {
+			return src.Getpid(ctx)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pids = map[int]bool{}
+		for _, result := range results {
+			if result.Err != nil {
+				t.Fatalf("replica %q: %v", result.Replica, result.Err)
+			}
+			pids[result.Value] = true
+		}
+	}
+	if len(pids) != want {
+		t.Fatalf("broadcast reached %d replicas, want %d", len(pids), want)
+	}
+}
+
+// unlinked is a component interface with no implementation in the binary.
+type unlinked interface {
+	Ping(context.Context) error
+}
+
+func TestLazyRef(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: single})
+			ref := weaver.Lazy[simple.Source](root)
+			src, err := ref.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := src.Getpid(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := weaver.Lazy[unlinked](root).Get(); err == nil {
+				t.Fatal("unexpected success getting an unlinked component")
+			}
+		})
+	}
+}
+
+func TestOptionalRef(t *testing.T) {
+	ctx := context.Background()
+	root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: true})
+	if _, ok, err := weaver.Optional[simple.Source](root).Get(); err != nil || !ok {
+		t.Fatalf("Optional[Source].Get(): got %v, %v, want true, nil", ok, err)
+	}
+	if _, ok, err := weaver.Optional[unlinked](root).Get(); err != nil || ok {
+		t.Fatalf("Optional[unlinked].Get(): got %v, %v, want false, nil", ok, err)
+	}
+}
+
+func TestGetByName(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: single})
+			got, err := weaver.GetByName(root, "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Source")
+			if err != nil {
+				t.Fatal(err)
+			}
+			src, ok := got.(simple.Source)
+			if !ok {
+				t.Fatalf("GetByName: got %T, want a simple.Source", got)
+			}
+			if _, err := src.Getpid(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := weaver.GetByName(root, "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Missing"); err == nil {
+				t.Fatal("unexpected success getting an unregistered component")
+			}
+		})
+	}
+}
+
+func TestPacketListener(t *testing.T) {
+	for _, single := range []bool{true, false} {
+		// Get a packet listener, echo the packets it receives, and send a
+		// packet to it.
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: single})
+			lis, err := root.PacketListener("echo", weaver.ListenerOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			if proxy := lis.ProxyAddr(); !single && proxy == "" {
+				t.Fatal("no proxy address")
+			}
+			go func() {
+				buf := make([]byte, 1024)
+				for {
+					n, addr, err := lis.ReadFrom(buf)
+					if err != nil {
+						return
+					}
+					lis.WriteTo(buf[:n], addr)
+				}
+			}()
+
+			conn, err := net.Dial("udp", lis.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+			if _, err := conn.Write([]byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 1024)
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(buf[:n]), "hello"; got != want {
+				t.Fatalf("echo: got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
 func TestListener(t *testing.T) {
 	for _, single := range []bool{true, false} {
 		// Get a listener, serve on it, and make an HTTP request to the server.
@@ -203,3 +558,281 @@ func TestRoutedCall(t *testing.T) {
 		})
 	}
 }
+
+func TestShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: true})
+	dst, err := weaver.Get[simple.Destination](root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.Getpid(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	before := simple.Shutdowns.Load()
+	cancel()
+	for deadline := time.Now().Add(5 * time.Second); simple.Shutdowns.Load() == before; {
+		if time.Now().After(deadline) {
+			t.Fatal("destination was not shut down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRun(t *testing.T) {
+	// Run returns the error of the app, once the components are shut down.
+	ctx := context.WithValue(context.Background(), runtime.BootstrapKey{}, runtime.Bootstrap{})
+	before := simple.Shutdowns.Load()
+	errApp := errors.New("app error")
+	err := weaver.Run(ctx, func(ctx context.Context, root weaver.Instance) error {
+		dst, err := weaver.Get[simple.Destination](root)
+		if err != nil {
+			return err
+		}
+		if _, err := dst.Getpid(ctx); err != nil {
+			return err
+		}
+		return errApp
+	})
+	if !errors.Is(err, errApp) {
+		t.Fatalf("Run: got %v, want %v", err, errApp)
+	}
+	if simple.Shutdowns.Load() == before {
+		t.Fatal("destination was not shut down")
+	}
+}
+
+func TestStopShutsDown(t *testing.T) {
+	// Run this test binary as a weavelet that hosts Destination in its own
+	// process, under an envelope, like the deployers do.
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wlet := &protos.WeaveletInfo{
+		App:               "simple",
+		DeploymentId:      uuid.New().String(),
+		Group:             &protos.ColocationGroup{Name: destinationName},
+		GroupId:           uuid.New().String(),
+		Process:           destinationName,
+		Id:                uuid.New().String(),
+		UseLocalhost:      true,
+		ProcessPicksPorts: true,
+		ProtocolVersion:   runtime.ProtocolVersion,
+	}
+	config := &protos.AppConfig{
+		Name:   "simple",
+		Binary: executable,
+		Args:   []string{"weavelet"},
+	}
+	h := &stopHandler{
+		t:        t,
+		started:  make(chan struct{}),
+		shutdown: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	defer close(h.done)
+	e, err := envelope.NewEnvelope(wlet, config, h, envelope.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- e.Run(context.Background()) }()
+
+	select {
+	case <-h.started:
+	case err := <-errs:
+		t.Fatalf("weavelet exited before starting Destination: %v", err)
+	case <-time.After(30 * time.Second):
+		t.Fatal("weavelet did not start Destination")
+	}
+
+	// Stop the weavelet, which must shut Destination down before it exits.
+	if err := e.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.shutdown:
+	default:
+		t.Fatal("destination was not shut down")
+	}
+}
+
+// destinationName is the name of the Destination component, and of the
+// process that hosts it by default.
+const destinationName = "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination"
+
+// stopHandler is the envelope.EnvelopeHandler of TestStopShutsDown. It asks
+// the weavelet to start Destination, and records that Destination started
+// and was shut down.
+type stopHandler struct {
+	t        *testing.T
+	started  chan struct{} // closed once Destination started
+	shutdown chan struct{} // closed once Destination was shut down
+	done     chan struct{} // closed once the test finishes
+
+	mu       sync.Mutex
+	finished bool // has the test finished?
+}
+
+var _ envelope.EnvelopeHandler = &stopHandler{}
+
+func (h *stopHandler) RecvLogEntry(entry *protos.LogEntry) {
+	if entry.Msg == "simple.Shutdown" {
+		close(h.shutdown)
+	}
+	select {
+	case <-h.done:
+		// The test finished, and t.Log may no longer be called.
+	default:
+		h.t.Log(entry.Msg)
+	}
+}
+
+func (h *stopHandler) GetComponentsToStart(req *protos.GetComponentsToStart) (*protos.ComponentsToStart, error) {
+	if req.Version == "" {
+		return &protos.ComponentsToStart{Version: "1", Components: []string{destinationName}}, nil
+	}
+	// The weavelet asks again once it started the components.
+	h.mu.Lock()
+	if !h.finished {
+		h.finished = true
+		close(h.started)
+	}
+	h.mu.Unlock()
+	<-h.done
+	return nil, fmt.Errorf("test finished")
+}
+
+func (h *stopHandler) GetRoutingInfo(*protos.GetRoutingInfo) (*protos.RoutingInfo, error) {
+	<-h.done
+	return nil, fmt.Errorf("test finished")
+}
+
+func (h *stopHandler) GetAddress(*protos.GetAddressRequest) (*protos.GetAddressReply, error) {
+	return &protos.GetAddressReply{Address: "localhost:0"}, nil
+}
+
+func (h *stopHandler) ExportListener(*protos.ExportListenerRequest) (*protos.ExportListenerReply, error) {
+	return &protos.ExportListenerReply{}, nil
+}
+
+func (h *stopHandler) ElectLeader(*protos.LeaderElectionRequest) (*protos.LeaderElectionReply, error) {
+	return &protos.LeaderElectionReply{}, nil
+}
+
+func (h *stopHandler) RecvTraceSpans([]sdktrace.ReadOnlySpan) error       { return nil }
+func (h *stopHandler) StartComponent(*protos.ComponentToStart) error      { return nil }
+func (h *stopHandler) StartColocationGroup(*protos.ColocationGroup) error { return nil }
+func (h *stopHandler) RegisterReplica(*protos.ReplicaToRegister) error    { return nil }
+func (h *stopHandler) ReportLoad(*protos.WeaveletLoadReport) error        { return nil }
+
+func TestMethodTimeouts(t *testing.T) {
+	const config = `
+["github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination"]
+method_timeouts = { Sleep = "10ms" }
+`
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: single, Config: config})
+			dst, err := weaver.Get[simple.Destination](root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			if err := dst.Sleep(ctx, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("Sleep: got %v, want context.DeadlineExceeded", err)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Fatalf("Sleep: timeout not enforced, took %v", elapsed)
+			}
+
+			// Methods without a timeout are unaffected.
+			if _, err := dst.Getpid(ctx); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestFaults(t *testing.T) {
+	const dst = "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination"
+	errInjected := errors.New("injected")
+	for _, single := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Single=%t", single), func(t *testing.T) {
+			ctx := context.Background()
+			root := weavertest.Init(ctx, t, weavertest.Options{
+				SingleProcess: single,
+				Faults: []weavertest.Fault{
+					{Component: dst, Method: "Record", Error: errInjected},
+					{Component: dst, Method: "Getpid", Drop: true},
+				},
+			})
+			src, err := weaver.Get[simple.Source](root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst, err := weaver.Get[simple.Destination](root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The fault is injected into calls made by other components.
+			file := filepath.Join(t.TempDir(), "faults")
+			if err := src.Emit(ctx, file, "hello"); !errors.Is(err, errInjected) {
+				t.Errorf("Emit: got %v, want %v", err, errInjected)
+			}
+			if _, err := dst.Getpid(ctx); !errors.Is(err, weaver.ErrRetriable) {
+				t.Errorf("Getpid: got %v, want weaver.ErrRetriable", err)
+			}
+
+			// Other methods are unaffected.
+			if err := dst.RoutedRecord(ctx, file, "hello"); err != nil {
+				t.Errorf("RoutedRecord: %v", err)
+			}
+		})
+	}
+}
+
+func BenchmarkGetpid(b *testing.B) {
+	weavertest.Bench(context.Background(), b, weavertest.Options{},
+		func(ctx context.Context, src simple.Source) error {
+			_, err := src.Getpid(ctx)
+			return err
+		})
+}
+
+func TestMetricLabels(t *testing.T) {
+	// Method metrics are recorded for remote calls only.
+	ctx := context.Background()
+	root := weavertest.Init(ctx, t, weavertest.Options{SingleProcess: false})
+	dst, err := weaver.Get[simple.Destination](root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenant := uuid.NewString()
+	labeled := weaver.WithMetricLabels(ctx, "tenant", tenant)
+	for i := 0; i < 3; i++ {
+		if _, err := dst.Getpid(labeled); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var calls float64
+	for _, s := range metrics.Snapshot() {
+		if s.Name == codegen.MethodCounts.Name() && s.Labels["method"] == "Getpid" && s.Labels["tenant"] == tenant {
+			calls += s.Value
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("calls with tenant label: got %v, want 3", calls)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"reflect"
+	"sync"
 	"time"
 )
 
@@ -16,15 +17,17 @@ func init() {
 		Iface:  reflect.TypeOf((*Destination)(nil)).Elem(),
 		New:    func() any { return &destination{} },
 		Routed: true,
+		Router: reflect.TypeOf((*destination_router)(nil)).Elem(),
 		LocalStubFn: func(impl any, tracer trace.Tracer) any {
 			return destination_local_stub{impl: impl.(Destination), tracer: tracer}
 		},
 		ClientStubFn: func(stub codegen.Stub, caller string) any {
-			return destination_client_stub{stub: stub, getpidMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination", Method: "Getpid"}), recordMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination", Method: "Record"}), getAllMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination", Method: "GetAll"}), routedRecordMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination", Method: "RoutedRecord"})}
+			return destination_client_stub{stub: stub, getpidMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination", Method: "Getpid"}), recordMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination", Method: "Record"}), getAllMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination", Method: "GetAll"}), routedRecordMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination", Method: "RoutedRecord"}), sleepMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination", Method: "Sleep"})}
 		},
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return destination_server_stub{impl: impl.(Destination), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Record": {"file", "msg"}, "GetAll": {"file"}, "RoutedRecord": {"file", "msg"}, "Sleep": {"d"}},
 	})
 	codegen.Register(codegen.Registration{
 		Name:        "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Source",
@@ -32,12 +35,14 @@ func init() {
 		New:         func() any { return &source{} },
 		LocalStubFn: func(impl any, tracer trace.Tracer) any { return source_local_stub{impl: impl.(Source), tracer: tracer} },
 		ClientStubFn: func(stub codegen.Stub, caller string) any {
-			return source_client_stub{stub: stub, emitMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Source", Method: "Emit"})}
+			return source_client_stub{stub: stub, emitMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Source", Method: "Emit"}), getpidMetrics: codegen.MethodMetricsFor(codegen.MethodLabels{Caller: caller, Component: "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Source", Method: "Getpid"})}
 		},
 		ServerStubFn: func(impl any, addLoad func(uint64, float64)) codegen.Server {
 			return source_server_stub{impl: impl.(Source), addLoad: addLoad}
 		},
+		ParamNames: map[string][]string{"Emit": {"file", "msg"}},
 	})
+	codegen.RegisterRefs("github.com/ServiceWeaver/weaver/weavertest/internal/simple/Source", "github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination")
 }
 
 // Local stub implementations.
@@ -115,6 +120,23 @@ func (s destination_local_stub) RoutedRecord(ctx context.Context, a0 string, a1
 	return s.impl.RoutedRecord(ctx, a0, a1)
 }
 
+func (s destination_local_stub) Sleep(ctx context.Context, a0 time.Duration) (err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "simple.Destination.Sleep", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.Sleep(ctx, a0)
+}
+
 type source_local_stub struct {
 	impl   Source
 	tracer trace.Tracer
@@ -137,6 +159,23 @@ func (s source_local_stub) Emit(ctx context.Context, a0 string, a1 string) (err
 	return s.impl.Emit(ctx, a0, a1)
 }
 
+func (s source_local_stub) Getpid(ctx context.Context) (r0 int, err error) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.tracer.Start(ctx, "simple.Source.Getpid", trace.WithSpanKind(trace.SpanKindInternal))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	return s.impl.Getpid(ctx)
+}
+
 // Client stub implementations.
 
 type destination_client_stub struct {
@@ -145,12 +184,14 @@ type destination_client_stub struct {
 	recordMetrics       *codegen.MethodMetrics
 	getAllMetrics       *codegen.MethodMetrics
 	routedRecordMetrics *codegen.MethodMetrics
+	sleepMetrics        *codegen.MethodMetrics
 }
 
 func (s destination_client_stub) Getpid(ctx context.Context) (r0 int, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getpidMetrics.Count.Add(1)
+	methodMetrics := s.getpidMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -168,23 +209,23 @@ func (s destination_client_stub) Getpid(ctx context.Context) (r0 int, err error)
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getpidMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getpidMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	var shardKey uint64
 
 	// Call the remote method.
-	s.getpidMetrics.BytesRequest.Put(0)
+	methodMetrics.BytesRequest.Put(0)
 	var results []byte
 	results, err = s.stub.Run(ctx, 1, nil, shardKey)
 	if err != nil {
 		return
 	}
-	s.getpidMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -196,7 +237,8 @@ func (s destination_client_stub) Getpid(ctx context.Context) (r0 int, err error)
 func (s destination_client_stub) Record(ctx context.Context, a0 string, a1 string) (err error) {
 	// Update metrics.
 	start := time.Now()
-	s.recordMetrics.Count.Add(1)
+	methodMetrics := s.recordMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -214,19 +256,19 @@ func (s destination_client_stub) Record(ctx context.Context, a0 string, a1 strin
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.recordMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.recordMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
 	size += (4 + len(a1))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
@@ -234,13 +276,13 @@ func (s destination_client_stub) Record(ctx context.Context, a0 string, a1 strin
 	var shardKey uint64
 
 	// Call the remote method.
-	s.recordMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 2, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.recordMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -251,7 +293,8 @@ func (s destination_client_stub) Record(ctx context.Context, a0 string, a1 strin
 func (s destination_client_stub) GetAll(ctx context.Context, a0 string) (r0 []string, err error) {
 	// Update metrics.
 	start := time.Now()
-	s.getAllMetrics.Count.Add(1)
+	methodMetrics := s.getAllMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -269,31 +312,31 @@ func (s destination_client_stub) GetAll(ctx context.Context, a0 string) (r0 []st
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.getAllMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.getAllMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
 	var shardKey uint64
 
 	// Call the remote method.
-	s.getAllMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.getAllMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -305,7 +348,8 @@ func (s destination_client_stub) GetAll(ctx context.Context, a0 string) (r0 []st
 func (s destination_client_stub) RoutedRecord(ctx context.Context, a0 string, a1 string) (err error) {
 	// Update metrics.
 	start := time.Now()
-	s.routedRecordMetrics.Count.Add(1)
+	methodMetrics := s.routedRecordMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -323,36 +367,89 @@ func (s destination_client_stub) RoutedRecord(ctx context.Context, a0 string, a1
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.routedRecordMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.routedRecordMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
 	size += (4 + len(a1))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
 	enc.String(a1)
 
 	// Set the shardKey.
-	var r destRouter
-	shardKey := _hashDestination(r.RoutedRecord(ctx, a0, a1))
+	shardKey := _hashDestination(_routerDestination().RoutedRecord(ctx, a0, a1))
 
 	// Call the remote method.
-	s.routedRecordMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 3, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.routedRecordMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	err = dec.Error()
+	return
+}
+
+func (s destination_client_stub) Sleep(ctx context.Context, a0 time.Duration) (err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.sleepMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "simple.Destination.Sleep", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	// Preallocate a buffer of the right size.
+	size := 0
+	size += 8
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
+
+	// Encode arguments.
+	enc.Int64((int64)(a0))
+	var shardKey uint64
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	var results []byte
+	results, err = s.stub.Run(ctx, 4, enc.Data(), shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -361,14 +458,16 @@ func (s destination_client_stub) RoutedRecord(ctx context.Context, a0 string, a1
 }
 
 type source_client_stub struct {
-	stub        codegen.Stub
-	emitMetrics *codegen.MethodMetrics
+	stub          codegen.Stub
+	emitMetrics   *codegen.MethodMetrics
+	getpidMetrics *codegen.MethodMetrics
 }
 
 func (s source_client_stub) Emit(ctx context.Context, a0 string, a1 string) (err error) {
 	// Update metrics.
 	start := time.Now()
-	s.emitMetrics.Count.Add(1)
+	methodMetrics := s.emitMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
 
 	span := trace.SpanFromContext(ctx)
 	if span.SpanContext().IsValid() {
@@ -386,19 +485,19 @@ func (s source_client_stub) Emit(ctx context.Context, a0 string, a1 string) (err
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-			s.emitMetrics.ErrorCount.Add(1)
+			methodMetrics.ErrorCount.Add(1)
 		}
 		span.End()
 
-		s.emitMetrics.Latency.Put(float64(time.Since(start).Microseconds()))
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
 	}()
 
 	// Preallocate a buffer of the right size.
 	size := 0
 	size += (4 + len(a0))
 	size += (4 + len(a1))
-	enc := codegen.NewEncoder()
-	enc.Reset(size)
+	enc := codegen.NewPooledEncoder(size)
+	defer enc.Release()
 
 	// Encode arguments.
 	enc.String(a0)
@@ -406,13 +505,13 @@ func (s source_client_stub) Emit(ctx context.Context, a0 string, a1 string) (err
 	var shardKey uint64
 
 	// Call the remote method.
-	s.emitMetrics.BytesRequest.Put(float64(len(enc.Data())))
+	methodMetrics.BytesRequest.Put(float64(len(enc.Data())))
 	var results []byte
 	results, err = s.stub.Run(ctx, 0, enc.Data(), shardKey)
 	if err != nil {
 		return
 	}
-	s.emitMetrics.BytesReply.Put(float64(len(results)))
+	methodMetrics.BytesReply.Put(float64(len(results)))
 
 	// Decode the results.
 	dec := codegen.NewDecoder(results)
@@ -420,6 +519,53 @@ func (s source_client_stub) Emit(ctx context.Context, a0 string, a1 string) (err
 	return
 }
 
+func (s source_client_stub) Getpid(ctx context.Context) (r0 int, err error) {
+	// Update metrics.
+	start := time.Now()
+	methodMetrics := s.getpidMetrics.ForContext(ctx)
+	methodMetrics.Count.Add(1)
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		// Create a child span for this method.
+		ctx, span = s.stub.Tracer().Start(ctx, "simple.Source.Getpid", trace.WithSpanKind(trace.SpanKindClient))
+	}
+
+	defer func() {
+		// Catch and return any panics detected during encoding/decoding/rpc.
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+		err = s.stub.WrapError(err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			methodMetrics.ErrorCount.Add(1)
+		}
+		span.End()
+
+		methodMetrics.Latency.PutContext(ctx, float64(time.Since(start).Microseconds()))
+	}()
+
+	var shardKey uint64
+
+	// Call the remote method.
+	methodMetrics.BytesRequest.Put(0)
+	var results []byte
+	results, err = s.stub.Run(ctx, 1, nil, shardKey)
+	if err != nil {
+		return
+	}
+	methodMetrics.BytesReply.Put(float64(len(results)))
+
+	// Decode the results.
+	dec := codegen.NewDecoder(results)
+	r0 = dec.Int()
+	err = dec.Error()
+	return
+}
+
 // Server stub implementations.
 
 type destination_server_stub struct {
@@ -438,6 +584,8 @@ func (s destination_server_stub) GetStubFn(method string) func(ctx context.Conte
 		return s.getAll
 	case "RoutedRecord":
 		return s.routedRecord
+	case "Sleep":
+		return s.sleep
 	default:
 		return nil
 	}
@@ -458,6 +606,9 @@ func (s destination_server_stub) getpid(ctx context.Context, args []byte) (res [
 
 	// Encode the results.
 	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += 8
+	enc.Reset(size)
 	enc.Int(r0)
 	enc.Error(appErr)
 	return enc.Data(), nil
@@ -528,8 +679,7 @@ func (s destination_server_stub) routedRecord(ctx context.Context, args []byte)
 	a0 = dec.String()
 	var a1 string
 	a1 = dec.String()
-	var r destRouter
-	s.addLoad(_hashDestination(r.RoutedRecord(ctx, a0, a1)), 1.0)
+	s.addLoad(_hashDestination(_routerDestination().RoutedRecord(ctx, a0, a1)), 1.0)
 
 	// TODO(rgrandl): The deferred function above will recover from panics in the
 	// user code: fix this.
@@ -542,6 +692,30 @@ func (s destination_server_stub) routedRecord(ctx context.Context, args []byte)
 	return enc.Data(), nil
 }
 
+func (s destination_server_stub) sleep(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// Decode arguments.
+	dec := codegen.NewDecoder(args)
+	var a0 time.Duration
+	*(*int64)(&a0) = dec.Int64()
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	appErr := s.impl.Sleep(ctx, a0)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
 type source_server_stub struct {
 	impl    Source
 	addLoad func(key uint64, load float64)
@@ -552,6 +726,8 @@ func (s source_server_stub) GetStubFn(method string) func(ctx context.Context, a
 	switch method {
 	case "Emit":
 		return s.emit
+	case "Getpid":
+		return s.getpid
 	default:
 		return nil
 	}
@@ -583,8 +759,44 @@ func (s source_server_stub) emit(ctx context.Context, args []byte) (res []byte,
 	return enc.Data(), nil
 }
 
+func (s source_server_stub) getpid(ctx context.Context, args []byte) (res []byte, err error) {
+	// Catch and return any panics detected during encoding/decoding/rpc.
+	defer func() {
+		if err == nil {
+			err = codegen.CatchPanics(recover())
+		}
+	}()
+
+	// TODO(rgrandl): The deferred function above will recover from panics in the
+	// user code: fix this.
+	// Call the local method.
+	r0, appErr := s.impl.Getpid(ctx)
+
+	// Encode the results.
+	enc := codegen.NewEncoder()
+	size := 8 // nil error
+	size += 8
+	enc.Reset(size)
+	enc.Int(r0)
+	enc.Error(appErr)
+	return enc.Data(), nil
+}
+
 // Router methods.
 
+// destination_router holds the routing methods of the Destination component.
+type destination_router interface {
+	RoutedRecord(ctx context.Context, a0 string, a1 string) string
+}
+
+// _routerDestination returns the router installed for the Destination component.
+func _routerDestination() destination_router {
+	if r, ok := codegen.Router("github.com/ServiceWeaver/weaver/weavertest/internal/simple/Destination").(destination_router); ok {
+		return r
+	}
+	return new(destRouter)
+}
+
 // _hashDestination returns a 64 bit hash of the provided value.
 func _hashDestination(r string) uint64 {
 	var h codegen.Hasher
@@ -623,3 +835,351 @@ func serviceweaver_dec_slice_string_4af10117(dec *codegen.Decoder) []string {
 	}
 	return res
 }
+
+// Fakes.
+
+// FakeDestination is a configurable fake implementation of the Destination component,
+// for use with weavertest.Fake. Every method records its calls and then
+// returns the next scripted results, if any, or else calls the method's
+// hook, if set, or else returns zero values.
+type FakeDestination struct {
+	// GetpidHook, if not nil, is called by Getpid when no scripted results remain.
+	GetpidHook func(ctx context.Context) (r0 int, err error)
+
+	// RecordHook, if not nil, is called by Record when no scripted results remain.
+	RecordHook func(ctx context.Context, a0 string, a1 string) (err error)
+
+	// GetAllHook, if not nil, is called by GetAll when no scripted results remain.
+	GetAllHook func(ctx context.Context, a0 string) (r0 []string, err error)
+
+	// RoutedRecordHook, if not nil, is called by RoutedRecord when no scripted results remain.
+	RoutedRecordHook func(ctx context.Context, a0 string, a1 string) (err error)
+
+	// SleepHook, if not nil, is called by Sleep when no scripted results remain.
+	SleepHook func(ctx context.Context, a0 time.Duration) (err error)
+
+	mu                  sync.Mutex
+	getpidCalls         []FakeDestinationGetpidCall
+	getpidResults       []fakeDestinationGetpidResults
+	recordCalls         []FakeDestinationRecordCall
+	recordResults       []fakeDestinationRecordResults
+	getAllCalls         []FakeDestinationGetAllCall
+	getAllResults       []fakeDestinationGetAllResults
+	routedRecordCalls   []FakeDestinationRoutedRecordCall
+	routedRecordResults []fakeDestinationRoutedRecordResults
+	sleepCalls          []FakeDestinationSleepCall
+	sleepResults        []fakeDestinationSleepResults
+}
+
+var _ Destination = (*FakeDestination)(nil)
+
+// FakeDestinationGetpidCall records a call to FakeDestination.Getpid.
+type FakeDestinationGetpidCall struct {
+}
+
+type fakeDestinationGetpidResults struct {
+	r0  int
+	err error
+}
+
+func (f *FakeDestination) Getpid(ctx context.Context) (r0 int, err error) {
+	f.mu.Lock()
+	f.getpidCalls = append(f.getpidCalls, FakeDestinationGetpidCall{})
+	if len(f.getpidResults) > 0 {
+		res := f.getpidResults[0]
+		f.getpidResults = f.getpidResults[1:]
+		f.mu.Unlock()
+		return res.r0, res.err
+	}
+	hook := f.GetpidHook
+	f.mu.Unlock()
+	if hook != nil {
+		return hook(ctx)
+	}
+	return
+}
+
+// GetpidReturns scripts the results of a call to Getpid. Scripted results are
+// returned in the order in which they were scripted, one per call.
+func (f *FakeDestination) GetpidReturns(r0 int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.getpidResults = append(f.getpidResults, fakeDestinationGetpidResults{r0: r0, err: err})
+}
+
+// GetpidCalls returns the calls made to Getpid, in order.
+func (f *FakeDestination) GetpidCalls() []FakeDestinationGetpidCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeDestinationGetpidCall(nil), f.getpidCalls...)
+}
+
+// FakeDestinationRecordCall records a call to FakeDestination.Record.
+type FakeDestinationRecordCall struct {
+	File string
+	Msg  string
+}
+
+type fakeDestinationRecordResults struct {
+	err error
+}
+
+func (f *FakeDestination) Record(ctx context.Context, a0 string, a1 string) (err error) {
+	f.mu.Lock()
+	f.recordCalls = append(f.recordCalls, FakeDestinationRecordCall{File: a0, Msg: a1})
+	if len(f.recordResults) > 0 {
+		res := f.recordResults[0]
+		f.recordResults = f.recordResults[1:]
+		f.mu.Unlock()
+		return res.err
+	}
+	hook := f.RecordHook
+	f.mu.Unlock()
+	if hook != nil {
+		return hook(ctx, a0, a1)
+	}
+	return
+}
+
+// RecordReturns scripts the results of a call to Record. Scripted results are
+// returned in the order in which they were scripted, one per call.
+func (f *FakeDestination) RecordReturns(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recordResults = append(f.recordResults, fakeDestinationRecordResults{err: err})
+}
+
+// RecordCalls returns the calls made to Record, in order.
+func (f *FakeDestination) RecordCalls() []FakeDestinationRecordCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeDestinationRecordCall(nil), f.recordCalls...)
+}
+
+// FakeDestinationGetAllCall records a call to FakeDestination.GetAll.
+type FakeDestinationGetAllCall struct {
+	File string
+}
+
+type fakeDestinationGetAllResults struct {
+	r0  []string
+	err error
+}
+
+func (f *FakeDestination) GetAll(ctx context.Context, a0 string) (r0 []string, err error) {
+	f.mu.Lock()
+	f.getAllCalls = append(f.getAllCalls, FakeDestinationGetAllCall{File: a0})
+	if len(f.getAllResults) > 0 {
+		res := f.getAllResults[0]
+		f.getAllResults = f.getAllResults[1:]
+		f.mu.Unlock()
+		return res.r0, res.err
+	}
+	hook := f.GetAllHook
+	f.mu.Unlock()
+	if hook != nil {
+		return hook(ctx, a0)
+	}
+	return
+}
+
+// GetAllReturns scripts the results of a call to GetAll. Scripted results are
+// returned in the order in which they were scripted, one per call.
+func (f *FakeDestination) GetAllReturns(r0 []string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.getAllResults = append(f.getAllResults, fakeDestinationGetAllResults{r0: r0, err: err})
+}
+
+// GetAllCalls returns the calls made to GetAll, in order.
+func (f *FakeDestination) GetAllCalls() []FakeDestinationGetAllCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeDestinationGetAllCall(nil), f.getAllCalls...)
+}
+
+// FakeDestinationRoutedRecordCall records a call to FakeDestination.RoutedRecord.
+type FakeDestinationRoutedRecordCall struct {
+	File string
+	Msg  string
+}
+
+type fakeDestinationRoutedRecordResults struct {
+	err error
+}
+
+func (f *FakeDestination) RoutedRecord(ctx context.Context, a0 string, a1 string) (err error) {
+	f.mu.Lock()
+	f.routedRecordCalls = append(f.routedRecordCalls, FakeDestinationRoutedRecordCall{File: a0, Msg: a1})
+	if len(f.routedRecordResults) > 0 {
+		res := f.routedRecordResults[0]
+		f.routedRecordResults = f.routedRecordResults[1:]
+		f.mu.Unlock()
+		return res.err
+	}
+	hook := f.RoutedRecordHook
+	f.mu.Unlock()
+	if hook != nil {
+		return hook(ctx, a0, a1)
+	}
+	return
+}
+
+// RoutedRecordReturns scripts the results of a call to RoutedRecord. Scripted results are
+// returned in the order in which they were scripted, one per call.
+func (f *FakeDestination) RoutedRecordReturns(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.routedRecordResults = append(f.routedRecordResults, fakeDestinationRoutedRecordResults{err: err})
+}
+
+// RoutedRecordCalls returns the calls made to RoutedRecord, in order.
+func (f *FakeDestination) RoutedRecordCalls() []FakeDestinationRoutedRecordCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeDestinationRoutedRecordCall(nil), f.routedRecordCalls...)
+}
+
+// FakeDestinationSleepCall records a call to FakeDestination.Sleep.
+type FakeDestinationSleepCall struct {
+	D time.Duration
+}
+
+type fakeDestinationSleepResults struct {
+	err error
+}
+
+func (f *FakeDestination) Sleep(ctx context.Context, a0 time.Duration) (err error) {
+	f.mu.Lock()
+	f.sleepCalls = append(f.sleepCalls, FakeDestinationSleepCall{D: a0})
+	if len(f.sleepResults) > 0 {
+		res := f.sleepResults[0]
+		f.sleepResults = f.sleepResults[1:]
+		f.mu.Unlock()
+		return res.err
+	}
+	hook := f.SleepHook
+	f.mu.Unlock()
+	if hook != nil {
+		return hook(ctx, a0)
+	}
+	return
+}
+
+// SleepReturns scripts the results of a call to Sleep. Scripted results are
+// returned in the order in which they were scripted, one per call.
+func (f *FakeDestination) SleepReturns(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sleepResults = append(f.sleepResults, fakeDestinationSleepResults{err: err})
+}
+
+// SleepCalls returns the calls made to Sleep, in order.
+func (f *FakeDestination) SleepCalls() []FakeDestinationSleepCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeDestinationSleepCall(nil), f.sleepCalls...)
+}
+
+// FakeSource is a configurable fake implementation of the Source component,
+// for use with weavertest.Fake. Every method records its calls and then
+// returns the next scripted results, if any, or else calls the method's
+// hook, if set, or else returns zero values.
+type FakeSource struct {
+	// EmitHook, if not nil, is called by Emit when no scripted results remain.
+	EmitHook func(ctx context.Context, a0 string, a1 string) (err error)
+
+	// GetpidHook, if not nil, is called by Getpid when no scripted results remain.
+	GetpidHook func(ctx context.Context) (r0 int, err error)
+
+	mu            sync.Mutex
+	emitCalls     []FakeSourceEmitCall
+	emitResults   []fakeSourceEmitResults
+	getpidCalls   []FakeSourceGetpidCall
+	getpidResults []fakeSourceGetpidResults
+}
+
+var _ Source = (*FakeSource)(nil)
+
+// FakeSourceEmitCall records a call to FakeSource.Emit.
+type FakeSourceEmitCall struct {
+	File string
+	Msg  string
+}
+
+type fakeSourceEmitResults struct {
+	err error
+}
+
+func (f *FakeSource) Emit(ctx context.Context, a0 string, a1 string) (err error) {
+	f.mu.Lock()
+	f.emitCalls = append(f.emitCalls, FakeSourceEmitCall{File: a0, Msg: a1})
+	if len(f.emitResults) > 0 {
+		res := f.emitResults[0]
+		f.emitResults = f.emitResults[1:]
+		f.mu.Unlock()
+		return res.err
+	}
+	hook := f.EmitHook
+	f.mu.Unlock()
+	if hook != nil {
+		return hook(ctx, a0, a1)
+	}
+	return
+}
+
+// EmitReturns scripts the results of a call to Emit. Scripted results are
+// returned in the order in which they were scripted, one per call.
+func (f *FakeSource) EmitReturns(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.emitResults = append(f.emitResults, fakeSourceEmitResults{err: err})
+}
+
+// EmitCalls returns the calls made to Emit, in order.
+func (f *FakeSource) EmitCalls() []FakeSourceEmitCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeSourceEmitCall(nil), f.emitCalls...)
+}
+
+// FakeSourceGetpidCall records a call to FakeSource.Getpid.
+type FakeSourceGetpidCall struct {
+}
+
+type fakeSourceGetpidResults struct {
+	r0  int
+	err error
+}
+
+func (f *FakeSource) Getpid(ctx context.Context) (r0 int, err error) {
+	f.mu.Lock()
+	f.getpidCalls = append(f.getpidCalls, FakeSourceGetpidCall{})
+	if len(f.getpidResults) > 0 {
+		res := f.getpidResults[0]
+		f.getpidResults = f.getpidResults[1:]
+		f.mu.Unlock()
+		return res.r0, res.err
+	}
+	hook := f.GetpidHook
+	f.mu.Unlock()
+	if hook != nil {
+		return hook(ctx)
+	}
+	return
+}
+
+// GetpidReturns scripts the results of a call to Getpid. Scripted results are
+// returned in the order in which they were scripted, one per call.
+func (f *FakeSource) GetpidReturns(r0 int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.getpidResults = append(f.getpidResults, fakeSourceGetpidResults{r0: r0, err: err})
+}
+
+// GetpidCalls returns the calls made to Getpid, in order.
+func (f *FakeSource) GetpidCalls() []FakeSourceGetpidCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeSourceGetpidCall(nil), f.getpidCalls...)
+}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/ServiceWeaver/weaver"
 	"github.com/ServiceWeaver/weaver/internal/babysitter"
+	"github.com/ServiceWeaver/weaver/internal/faults"
 	"github.com/ServiceWeaver/weaver/runtime"
 	"github.com/ServiceWeaver/weaver/runtime/codegen"
 	"github.com/ServiceWeaver/weaver/runtime/colors"
@@ -35,15 +36,17 @@ import (
 )
 
 // initMultiProcess initializes a brand new multi-process execution environment
-// that places every component in its own collocation group and returns the root
-// component for the new application.
+// that places every component in its own collocation group, unless colocated
+// by config or colocate, and returns the root component for the new
+// application.
 //
 // config contains configuration identical to what might be found in a file passed
 // when deploying an application. It can contain application level as well as
-// component level configs. config is allowed to be empty.
-//
-// Future extension: allow options so the user can control collocation/replication/etc.
-func initMultiProcess(ctx context.Context, t testing.TB, config string) weaver.Instance {
+// component level configs. config is allowed to be empty. colocate lists
+// additional colocation groups. replicas is the number of replicas of every
+// process, or zero for the default. fs lists the faults to inject into
+// component method calls.
+func initMultiProcess(ctx context.Context, t testing.TB, config string, colocate [][]string, replicas int, fs []faults.Fault) weaver.Instance {
 	t.Helper()
 	bootstrap, err := runtime.GetBootstrap(ctx)
 	if err != nil {
@@ -59,7 +62,9 @@ func initMultiProcess(ctx context.Context, t testing.TB, config string) weaver.I
 			}
 			os.Exit(1)
 		}()
-		weaver.Init(context.Background())
+		// The child process runs the same test, so it knows the faults to
+		// inject into the calls it makes.
+		weaver.Init(context.WithValue(context.Background(), faults.Key{}, fs))
 		return nil
 	}
 
@@ -80,11 +85,14 @@ func initMultiProcess(ctx context.Context, t testing.TB, config string) weaver.I
 			t.Log(logging.NewPrettyPrinter(colors.Enabled()).Format(e))
 		}
 	}
-	dep := createDeployment(t, config)
+	dep := createDeployment(t, config, colocate)
 	b, err := babysitter.NewBabysitter(ctx, dep, logSaver)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if replicas > 0 {
+		b.SetReplication(replicas)
+	}
 
 	// Deploy main.
 	toWeavelet, toEnvelope, err := b.CreateAndRunEnvelopeForMain(createWeaveletForMain(dep), dep.App)
@@ -96,6 +104,7 @@ func initMultiProcess(ctx context.Context, t testing.TB, config string) weaver.I
 		ToEnvelopeFd: toEnvelope,
 		TestConfig:   config,
 	})
+	ctx = context.WithValue(ctx, faults.Key{}, fs)
 
 	t.Cleanup(func() {
 		cancelFunc()
@@ -108,7 +117,7 @@ func initMultiProcess(ctx context.Context, t testing.TB, config string) weaver.I
 	return weaver.Init(ctx)
 }
 
-func createDeployment(t testing.TB, config string) *protos.Deployment {
+func createDeployment(t testing.TB, config string, colocate [][]string) *protos.Deployment {
 	// Parse supplied config, if any.
 	appConfig := &protos.AppConfig{}
 	if config != "" {
@@ -119,6 +128,23 @@ func createDeployment(t testing.TB, config string) *protos.Deployment {
 		}
 	}
 
+	// Add the colocation groups from the options.
+	placed := map[string]bool{}
+	for _, group := range appConfig.SameProcess {
+		for _, component := range group.Components {
+			placed[component] = true
+		}
+	}
+	for _, components := range colocate {
+		for _, component := range components {
+			if placed[component] {
+				t.Fatalf("component %q placed multiple times", component)
+			}
+			placed[component] = true
+		}
+		appConfig.SameProcess = append(appConfig.SameProcess, &protos.ComponentGroup{Components: components})
+	}
+
 	// Overwrite app config with true executable info.
 	exe, err := os.Executable()
 	if err != nil {
@@ -130,6 +156,10 @@ func createDeployment(t testing.TB, config string) *protos.Deployment {
 	appConfig.Binary = exe
 	// TODO: Forward os.Args[1:] as well?
 	appConfig.Args = []string{"-test.run", regexp.QuoteMeta(t.Name())}
+	if _, ok := t.(*testing.B); ok {
+		// The child process runs the same benchmark, and no tests.
+		appConfig.Args = []string{"-test.run", "^$", "-test.bench", "^" + regexp.QuoteMeta(t.Name()) + "$"}
+	}
 	dep := &protos.Deployment{
 		Id:                uuid.New().String(),
 		App:               appConfig,
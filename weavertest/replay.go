@@ -0,0 +1,75 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weavertest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ServiceWeaver/weaver/internal/replay"
+	"github.com/ServiceWeaver/weaver/runtime/recording"
+)
+
+// Replay replays the calls to the provided component, recorded in the
+// provided recordings, against the component in isolation, and fails the
+// test if the component's results differ from the recorded ones. Calls are
+// recorded by deployments with a recording dir in their config; see
+// runtime.RecordingConfig. For example:
+//
+//	func TestCheckoutRegression(t *testing.T) {
+//	    weavertest.Replay(context.Background(), t, weavertest.Options{},
+//	        "github.com/example/shop/CheckoutService",
+//	        "testdata/checkout.recording")
+//	}
+//
+// The component runs in a single process, with the provided options. Its
+// calls to other components are not executed, but answered with the results
+// of the recorded calls with the same arguments, in the order they were
+// recorded. A call without a matching recorded call fails.
+//
+// Results are compared in their serialized form, so results that serialize
+// differently on every call, e.g., maps with more than one entry, are
+// reported as different.
+func Replay(ctx context.Context, t testing.TB, opts Options, component string, files ...string) {
+	t.Helper()
+	calls, err := recording.Read(files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer := replay.New(component, calls)
+	opts.SingleProcess = true
+	Init(context.WithValue(ctx, replay.Key{}, replayer), t, opts)
+
+	n := 0
+	for _, c := range calls {
+		if c.Component != component || c.Caller == component {
+			continue
+		}
+		n++
+		result, err := replayer.Call(ctx, c.Method, c.Args)
+		switch {
+		case err != nil && c.Error == "":
+			t.Errorf("%s (seq %d in weavelet %s): got error %v, want success", c.Method, c.Seq, c.Weavelet, err)
+		case err == nil && c.Error != "":
+			t.Errorf("%s (seq %d in weavelet %s): got success, want error %q", c.Method, c.Seq, c.Weavelet, c.Error)
+		case err == nil && !bytes.Equal(result, c.Result):
+			t.Errorf("%s (seq %d in weavelet %s): results differ from the recording", c.Method, c.Seq, c.Weavelet)
+		}
+	}
+	if n == 0 {
+		t.Fatalf("no recorded calls to component %q", component)
+	}
+}
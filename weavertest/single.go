@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/ServiceWeaver/weaver"
+	"github.com/ServiceWeaver/weaver/internal/faults"
 	"github.com/ServiceWeaver/weaver/runtime"
 )
 
@@ -31,8 +32,9 @@ import (
 //
 // config contains configuration identical to what might be found in a file passed
 // when deploying an application. It can contain application level as well as
-// component level configs. config is allowed to be empty.
-func initSingleProcess(ctx context.Context, t testing.TB, config string) weaver.Instance {
+// component level configs. config is allowed to be empty. fs lists the faults
+// to inject into component method calls.
+func initSingleProcess(ctx context.Context, t testing.TB, config string, fs []faults.Fault) weaver.Instance {
 	t.Helper()
 	ctx, cancelFunc := context.WithCancel(ctx)
 	t.Cleanup(func() {
@@ -42,6 +44,7 @@ func initSingleProcess(ctx context.Context, t testing.TB, config string) weaver.
 	ctx = context.WithValue(ctx, runtime.BootstrapKey{}, runtime.Bootstrap{
 		TestConfig: config,
 	})
+	ctx = context.WithValue(ctx, faults.Key{}, fs)
 	return weaver.Init(ctx)
 }
 
@@ -0,0 +1,254 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Kind is the kind of a journal entry.
+type Kind int
+
+const (
+	Started     Kind = iota + 1 // the run started; Data holds the input
+	StepDone                    // a step finished; Data or Error holds its result
+	Compensated                 // a step was compensated
+	Finished                    // the run finished; Data or Error holds its result
+)
+
+// String implements the fmt.Stringer interface.
+func (k Kind) String() string {
+	switch k {
+	case Started:
+		return "Started"
+	case StepDone:
+		return "StepDone"
+	case Compensated:
+		return "Compensated"
+	case Finished:
+		return "Finished"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// Entry is an entry in the journal of a run.
+type Entry struct {
+	Kind  Kind            `json:"kind"`
+	Index int             `json:"index,omitempty"` // index of the step
+	Step  string          `json:"step,omitempty"`  // name of the step
+	Data  json.RawMessage `json:"data,omitempty"`  // JSON-encoded value
+	Error string          `json:"error,omitempty"` // error message
+}
+
+// A Store durably stores the journals of workflow runs. A Store must be safe
+// for concurrent use.
+//
+// Runs survive the failure of a process only if their store does. Use a
+// store backed by a replicated database to survive the loss of a machine.
+type Store interface {
+	// Append appends an entry to the journal of the provided run. When
+	// Append returns successfully, the entry must be durable.
+	Append(ctx context.Context, workflow, id string, e Entry) error
+
+	// Load returns the journal of the provided run, or an empty journal if
+	// the run doesn't exist.
+	Load(ctx context.Context, workflow, id string) ([]Entry, error)
+
+	// Unfinished returns the ids of the runs of the provided workflow whose
+	// journal doesn't end with a Finished entry.
+	Unfinished(ctx context.Context, workflow string) ([]string, error)
+}
+
+// memoryStore is a Store that keeps journals in memory.
+type memoryStore struct {
+	mu       sync.Mutex
+	journals map[[2]string][]Entry // keyed by workflow and run id
+}
+
+var _ Store = &memoryStore{}
+
+// NewMemoryStore returns a Store that keeps journals in memory. Journals are
+// lost when the process exits, so it is mostly useful for tests.
+func NewMemoryStore() Store {
+	return &memoryStore{journals: map[[2]string][]Entry{}}
+}
+
+// Append implements the Store interface.
+func (m *memoryStore) Append(_ context.Context, workflow, id string, e Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := [2]string{workflow, id}
+	m.journals[key] = append(m.journals[key], e)
+	return nil
+}
+
+// Load implements the Store interface.
+func (m *memoryStore) Load(_ context.Context, workflow, id string) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	journal := m.journals[[2]string{workflow, id}]
+	return append([]Entry(nil), journal...), nil
+}
+
+// Unfinished implements the Store interface.
+func (m *memoryStore) Unfinished(_ context.Context, workflow string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for key, journal := range m.journals {
+		if key[0] == workflow && journal[len(journal)-1].Kind != Finished {
+			ids = append(ids, key[1])
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// fileStore is a Store that keeps every journal in a file, with one
+// JSON-encoded entry per line.
+type fileStore struct {
+	dir string
+	mu  sync.Mutex // serializes appends
+}
+
+var _ Store = &fileStore{}
+
+// NewFileStore returns a Store that keeps journals in files under the
+// provided directory, creating the directory if needed. Journals survive
+// process restarts, but not the loss of the machine or disk.
+func NewFileStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (f *fileStore) path(workflow, id string) string {
+	return filepath.Join(f.dir, url.PathEscape(workflow), url.PathEscape(id)+".jsonl")
+}
+
+// Append implements the Store interface.
+func (f *fileStore) Append(_ context.Context, workflow, id string, e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	filename := f.path(workflow, id)
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if info, err := file.Stat(); err != nil {
+		file.Close()
+		return err
+	} else if info.Size() > 0 {
+		// If the process crashed while appending the last line, terminate
+		// the incomplete line, so that it doesn't corrupt the new one.
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+			file.Close()
+			return err
+		}
+		if last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Load implements the Store interface.
+func (f *fileStore) Load(_ context.Context, workflow, id string) ([]Entry, error) {
+	return f.load(f.path(workflow, id))
+}
+
+func (f *fileStore) load(filename string) ([]Entry, error) {
+	file, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var journal []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// A line is incomplete if the process crashed while appending
+			// it. The entry wasn't durable, so it is ignored.
+			continue
+		}
+		journal = append(journal, e)
+	}
+	return journal, scanner.Err()
+}
+
+// Unfinished implements the Store interface.
+func (f *fileStore) Unfinished(_ context.Context, workflow string) ([]string, error) {
+	dir := filepath.Join(f.dir, url.PathEscape(workflow))
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".jsonl") {
+			continue
+		}
+		id, err := url.PathUnescape(strings.TrimSuffix(file.Name(), ".jsonl"))
+		if err != nil {
+			continue
+		}
+		journal, err := f.load(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(journal) > 0 && journal[len(journal)-1].Kind != Finished {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,334 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package workflow runs durable workflows: functions whose steps are
+// journaled, so that a workflow interrupted by a crash resumes where it left
+// off, and whose completed steps are compensated if the workflow fails.
+//
+// A workflow is a function that performs its side effects, typically calls to
+// other components, in steps:
+//
+//	checkout := workflow.New(store, "checkout", func(r *workflow.Run, req Request) (Order, error) {
+//		tx, err := workflow.StepWithCompensation(r, "charge",
+//			func(ctx context.Context) (string, error) {
+//				return payments.Charge(ctx, req.Total, req.Card)
+//			},
+//			func(ctx context.Context, tx string) error {
+//				return payments.Refund(ctx, tx)
+//			})
+//		if err != nil {
+//			return Order{}, err
+//		}
+//		tracking, err := workflow.Step(r, "ship", func(ctx context.Context) (string, error) {
+//			return shipping.Ship(ctx, req.Address, req.Items)
+//		})
+//		if err != nil {
+//			return Order{}, err // refunds the charge
+//		}
+//		return Order{Transaction: tx, Tracking: tracking}, nil
+//	})
+//
+//	order, err := checkout.Execute(ctx, orderID, req)
+//
+// The input of a run, the result of every step, and the result of the run are
+// journaled in a [Store]. When an unfinished run is resumed, e.g., by
+// [Workflow.Resume] after a crash, the workflow function is executed again
+// from the beginning, and the steps that were journaled return their
+// journaled results instead of executing again. Workflow functions must
+// therefore be deterministic: they must execute the same steps in the same
+// order given the same input and step results. A step that was executing when
+// the run was interrupted is executed again, so steps should be idempotent,
+// e.g., by using [Run.ID] as an idempotency key.
+//
+// If a workflow function returns an error, the compensations of the steps
+// that succeeded are executed in reverse order, and then the run finishes
+// with the error. A run that is interrupted, i.e., whose context is canceled,
+// is neither compensated nor finished, and can be resumed later.
+//
+// Inputs, outputs, and step results are encoded as JSON. Errors are journaled
+// as strings, so a replayed error has the same message as the original error
+// but not the same type.
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrRunning is returned when executing a run that is already executing in
+// the same process.
+var ErrRunning = errors.New("workflow: run is already executing")
+
+// A Workflow is a durable workflow. See the package documentation.
+type Workflow[In, Out any] struct {
+	store Store
+	name  string
+	fn    func(*Run, In) (Out, error)
+
+	mu      sync.Mutex
+	running map[string]bool // ids of the runs executing in this process
+}
+
+// New returns a workflow with the provided name that executes fn and
+// journals its runs in store. Workflows sharing a store must have different
+// names.
+func New[In, Out any](store Store, name string, fn func(*Run, In) (Out, error)) *Workflow[In, Out] {
+	return &Workflow[In, Out]{
+		store:   store,
+		name:    name,
+		fn:      fn,
+		running: map[string]bool{},
+	}
+}
+
+// Execute executes the run with the provided id and input, and returns its
+// result. If the run already finished, Execute returns its journaled result.
+// If the run was started but didn't finish, Execute resumes it with its
+// journaled input, and the provided input is ignored.
+func (w *Workflow[In, Out]) Execute(ctx context.Context, id string, in In) (Out, error) {
+	out, result, err := w.execute(ctx, id, &in)
+	if err != nil {
+		return out, err
+	}
+	return out, result
+}
+
+// Resume resumes every unfinished run of the workflow. Runs that are already
+// executing in this process are skipped. Resume should be called by a single
+// process at a time, e.g., by the leader of a [weaver.LeaderElection], so
+// that a run isn't resumed by two processes concurrently.
+func (w *Workflow[In, Out]) Resume(ctx context.Context) error {
+	ids, err := w.store.Unfinished(ctx, w.name)
+	if err != nil {
+		return fmt.Errorf("workflow %q: list unfinished runs: %w", w.name, err)
+	}
+	var first error
+	for _, id := range ids {
+		if _, _, err := w.execute(ctx, id, nil); err != nil && !errors.Is(err, ErrRunning) && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// execute executes the run with the provided id, starting it with the
+// provided input if it isn't journaled yet. It returns the output and error
+// of the run, or an error if the run couldn't be executed to completion.
+func (w *Workflow[In, Out]) execute(ctx context.Context, id string, in *In) (out Out, result error, err error) {
+	var zero Out
+	w.mu.Lock()
+	if w.running[id] {
+		w.mu.Unlock()
+		return zero, nil, ErrRunning
+	}
+	w.running[id] = true
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.running, id)
+		w.mu.Unlock()
+	}()
+
+	fail := func(format string, args ...any) (Out, error, error) {
+		return zero, nil, fmt.Errorf("workflow %q run %q: %s", w.name, id, fmt.Sprintf(format, args...))
+	}
+
+	journal, err := w.store.Load(ctx, w.name, id)
+	if err != nil {
+		return fail("load journal: %v", err)
+	}
+	if len(journal) == 0 {
+		if in == nil {
+			return fail("not found")
+		}
+		data, err := json.Marshal(*in)
+		if err != nil {
+			return fail("encode input: %v", err)
+		}
+		started := Entry{Kind: Started, Data: data}
+		if err := w.store.Append(ctx, w.name, id, started); err != nil {
+			return fail("journal start: %v", err)
+		}
+		journal = append(journal, started)
+	}
+	if journal[0].Kind != Started {
+		return fail("journal starts with %v", journal[0].Kind)
+	}
+	if last := journal[len(journal)-1]; last.Kind == Finished {
+		if last.Error != "" {
+			return zero, errors.New(last.Error), nil
+		}
+		if err := json.Unmarshal(last.Data, &out); err != nil {
+			return fail("decode output: %v", err)
+		}
+		return out, nil, nil
+	}
+	var input In
+	if err := json.Unmarshal(journal[0].Data, &input); err != nil {
+		return fail("decode input: %v", err)
+	}
+
+	r := &Run{ctx: ctx, id: id, compensated: map[int]bool{}}
+	for _, e := range journal[1:] {
+		switch e.Kind {
+		case StepDone:
+			r.journal = append(r.journal, e)
+		case Compensated:
+			r.compensated[e.Index] = true
+		}
+	}
+	r.append = func(e Entry) error { return w.store.Append(ctx, w.name, id, e) }
+
+	out, result = w.fn(r, input)
+	if r.err != nil {
+		return fail("%v", r.err)
+	}
+	if result != nil && ctx.Err() != nil {
+		// The run was interrupted. It is resumed later.
+		return fail("interrupted: %v", result)
+	}
+	if result != nil {
+		if err := r.compensate(); err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	finished := Entry{Kind: Finished}
+	if result != nil {
+		finished.Error = result.Error()
+		out = zero
+	} else if finished.Data, err = json.Marshal(out); err != nil {
+		return fail("encode output: %v", err)
+	}
+	if err := w.store.Append(ctx, w.name, id, finished); err != nil {
+		return fail("journal finish: %v", err)
+	}
+	return out, result, nil
+}
+
+// A Run is an execution of a workflow. It is passed to the workflow function,
+// which uses it to execute steps.
+type Run struct {
+	ctx         context.Context
+	id          string
+	journal     []Entry           // journaled steps, in order
+	compensated map[int]bool      // indices of compensated steps
+	append      func(Entry) error // journals an entry
+	next        int               // index of the next step
+	undo        []compensation    // compensations of successful steps
+	err         error             // the first journaling error, if any
+}
+
+// compensation is the compensation of a successful step.
+type compensation struct {
+	index int
+	name  string
+	fn    func(context.Context) error
+}
+
+// ID returns the id of the run.
+func (r *Run) ID() string {
+	return r.id
+}
+
+// Context returns the context of the run.
+func (r *Run) Context() context.Context {
+	return r.ctx
+}
+
+// Step executes a step of the run with the provided name, or returns the
+// journaled result of the step if the run is being resumed.
+func Step[T any](r *Run, name string, fn func(context.Context) (T, error)) (T, error) {
+	return StepWithCompensation(r, name, fn, nil)
+}
+
+// StepWithCompensation is like Step, but if the step succeeds and the run
+// later fails, compensate is called with the result of the step to undo it.
+// Compensations are executed in the reverse order of their steps, and a
+// compensation that fails is retried the next time the run is resumed.
+func StepWithCompensation[T any](r *Run, name string, fn func(context.Context) (T, error), compensate func(context.Context, T) error) (T, error) {
+	var zero T
+	if r.err != nil {
+		return zero, r.err
+	}
+	index := r.next
+	r.next++
+
+	var entry Entry
+	if index < len(r.journal) {
+		// Replay the step.
+		entry = r.journal[index]
+		if entry.Step != name {
+			r.err = fmt.Errorf("nondeterministic workflow: step %d is %q, journaled as %q", index, name, entry.Step)
+			return zero, r.err
+		}
+	} else {
+		// Execute the step.
+		v, err := fn(r.ctx)
+		if err != nil && r.ctx.Err() != nil {
+			// Don't journal the failures of interrupted steps.
+			return zero, err
+		}
+		entry = Entry{Kind: StepDone, Index: index, Step: name}
+		if err != nil {
+			entry.Error = err.Error()
+		} else if entry.Data, err = json.Marshal(v); err != nil {
+			r.err = fmt.Errorf("step %q: encode result: %w", name, err)
+			return zero, r.err
+		}
+		if err := r.append(entry); err != nil {
+			r.err = fmt.Errorf("step %q: journal: %w", name, err)
+			return zero, r.err
+		}
+	}
+
+	if entry.Error != "" {
+		return zero, errors.New(entry.Error)
+	}
+	var v T
+	if err := json.Unmarshal(entry.Data, &v); err != nil {
+		r.err = fmt.Errorf("step %q: decode result: %w", name, err)
+		return zero, r.err
+	}
+	if compensate != nil {
+		r.undo = append(r.undo, compensation{
+			index: index,
+			name:  name,
+			fn:    func(ctx context.Context) error { return compensate(ctx, v) },
+		})
+	}
+	return v, nil
+}
+
+// compensate executes the compensations of the successful steps that haven't
+// been compensated yet, in reverse order.
+func (r *Run) compensate() error {
+	for i := len(r.undo) - 1; i >= 0; i-- {
+		c := r.undo[i]
+		if r.compensated[c.index] {
+			continue
+		}
+		if err := c.fn(r.ctx); err != nil {
+			return fmt.Errorf("compensate step %q: %w", c.name, err)
+		}
+		if err := r.append(Entry{Kind: Compensated, Index: c.index, Step: c.name}); err != nil {
+			return fmt.Errorf("compensate step %q: journal: %w", c.name, err)
+		}
+		r.compensated[c.index] = true
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// recorder records the steps and compensations executed by a test workflow.
+type recorder struct {
+	calls []string
+}
+
+// newCheckout returns a workflow that charges, ships, and emails. The
+// provided fail function can make a step fail.
+func newCheckout(store Store, rec *recorder, fail func(step string) error) *Workflow[int, string] {
+	step := func(r *Run, name string, compensate bool) (string, error) {
+		fn := func(context.Context) (string, error) {
+			rec.calls = append(rec.calls, name)
+			if err := fail(name); err != nil {
+				return "", err
+			}
+			return name + "-ok", nil
+		}
+		if !compensate {
+			return Step(r, name, fn)
+		}
+		return StepWithCompensation(r, name, fn, func(context.Context, string) error {
+			rec.calls = append(rec.calls, "undo-"+name)
+			return fail("undo-" + name)
+		})
+	}
+	return New(store, "checkout", func(r *Run, total int) (string, error) {
+		if _, err := step(r, "charge", true); err != nil {
+			return "", err
+		}
+		tracking, err := step(r, "ship", true)
+		if err != nil {
+			return "", err
+		}
+		if _, err := step(r, "email", false); err != nil {
+			return "", err
+		}
+		return tracking, nil
+	})
+}
+
+func noFailures(string) error { return nil }
+
+func TestExecute(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{}
+	w := newCheckout(NewMemoryStore(), rec, noFailures)
+	for i := 0; i < 2; i++ {
+		// The second execution returns the journaled result.
+		got, err := w.Execute(ctx, "order", 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "ship-ok"; got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+	if want := []string{"charge", "ship", "email"}; !reflect.DeepEqual(rec.calls, want) {
+		t.Fatalf("got calls %v, want %v", rec.calls, want)
+	}
+}
+
+func TestCompensate(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{}
+	w := newCheckout(NewMemoryStore(), rec, func(step string) error {
+		if step == "email" {
+			return errors.New("email down")
+		}
+		return nil
+	})
+	if _, err := w.Execute(ctx, "order", 42); err == nil || err.Error() != "email down" {
+		t.Fatalf("got error %v, want email down", err)
+	}
+	want := []string{"charge", "ship", "email", "undo-ship", "undo-charge"}
+	if !reflect.DeepEqual(rec.calls, want) {
+		t.Fatalf("got calls %v, want %v", rec.calls, want)
+	}
+}
+
+func TestResumeInterrupted(t *testing.T) {
+	store := NewMemoryStore()
+	rec := &recorder{}
+
+	// The run is interrupted while shipping.
+	ctx, cancel := context.WithCancel(context.Background())
+	w := newCheckout(store, rec, func(step string) error {
+		if step == "ship" {
+			cancel()
+			return ctx.Err()
+		}
+		return nil
+	})
+	if _, err := w.Execute(ctx, "order", 42); err == nil {
+		t.Fatal("unexpected success")
+	}
+	ids, err := store.Unfinished(context.Background(), "checkout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"order"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("got unfinished %v, want %v", ids, want)
+	}
+
+	// Resuming the run skips the charge, which was journaled.
+	w = newCheckout(store, rec, noFailures)
+	if err := w.Resume(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"charge", "ship", "ship", "email"}
+	if !reflect.DeepEqual(rec.calls, want) {
+		t.Fatalf("got calls %v, want %v", rec.calls, want)
+	}
+	got, err := w.Execute(context.Background(), "order", 0)
+	if err != nil || got != "ship-ok" {
+		t.Fatalf("got %q, %v; want ship-ok", got, err)
+	}
+}
+
+func TestResumeFailedCompensation(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	rec := &recorder{}
+	refunds := 0
+	w := newCheckout(store, rec, func(step string) error {
+		switch step {
+		case "email":
+			return errors.New("email down")
+		case "undo-charge":
+			refunds++
+			if refunds == 1 {
+				return errors.New("payments down")
+			}
+		}
+		return nil
+	})
+	if _, err := w.Execute(ctx, "order", 42); err == nil || err.Error() == "email down" {
+		t.Fatalf("got error %v, want compensation failure", err)
+	}
+
+	// Resuming the run retries the failed compensation, but not the others.
+	if err := w.Resume(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"charge", "ship", "email", "undo-ship", "undo-charge", "undo-charge"}
+	if !reflect.DeepEqual(rec.calls, want) {
+		t.Fatalf("got calls %v, want %v", rec.calls, want)
+	}
+	if _, err := w.Execute(ctx, "order", 42); err == nil || err.Error() != "email down" {
+		t.Fatalf("got error %v, want email down", err)
+	}
+}
+
+func TestNondeterministic(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	cancelled, cancel := context.WithCancel(ctx)
+	name := "a"
+	w := New(store, "w", func(r *Run, _ int) (int, error) {
+		if _, err := Step(r, name, func(context.Context) (int, error) { return 1, nil }); err != nil {
+			return 0, err
+		}
+		return Step(r, "b", func(context.Context) (int, error) {
+			cancel()
+			return 0, cancelled.Err()
+		})
+	})
+	if _, err := w.Execute(cancelled, "run", 0); err == nil {
+		t.Fatal("unexpected success")
+	}
+	name = "c"
+	if _, err := w.Execute(ctx, "run", 0); err == nil {
+		t.Fatal("unexpected success for nondeterministic workflow")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []Entry{
+		{Kind: Started, Data: []byte(`42`)},
+		{Kind: StepDone, Index: 0, Step: "charge", Data: []byte(`"tx"`)},
+	}
+	for _, e := range entries {
+		if err := store.Append(ctx, "checkout", "a/b", e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Simulate a crash while appending an entry.
+	filename := filepath.Join(dir, "checkout", "a%2Fb.jsonl")
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"kind":2,"ste`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	last := Entry{Kind: StepDone, Index: 1, Step: "ship", Error: "oops"}
+	if err := store.Append(ctx, "checkout", "a/b", last); err != nil {
+		t.Fatal(err)
+	}
+	entries = append(entries, last)
+
+	got, err := store.Load(ctx, "checkout", "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Fatalf("got %v, want %v", got, entries)
+	}
+	ids, err := store.Unfinished(ctx, "checkout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a/b"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("got unfinished %v, want %v", ids, want)
+	}
+}